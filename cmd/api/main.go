@@ -1,20 +1,32 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/assylzhan-a/subscription-service/configs"
 	"github.com/assylzhan-a/subscription-service/internal/app/auth"
+	"github.com/assylzhan-a/subscription-service/internal/app/credit"
+	"github.com/assylzhan-a/subscription-service/internal/app/exchange"
+	"github.com/assylzhan-a/subscription-service/internal/app/invoice"
+	"github.com/assylzhan-a/subscription-service/internal/app/ledger"
+	"github.com/assylzhan-a/subscription-service/internal/app/payment"
 	"github.com/assylzhan-a/subscription-service/internal/app/product"
+	"github.com/assylzhan-a/subscription-service/internal/app/report"
 	"github.com/assylzhan-a/subscription-service/internal/app/subscription"
+	"github.com/assylzhan-a/subscription-service/internal/app/tax"
 	"github.com/assylzhan-a/subscription-service/internal/app/voucher"
+	"github.com/assylzhan-a/subscription-service/internal/app/webhook"
 	"github.com/assylzhan-a/subscription-service/internal/middleware"
 	"github.com/assylzhan-a/subscription-service/internal/repository/migrations"
 	"github.com/assylzhan-a/subscription-service/internal/repository/postgres"
 	httpTransport "github.com/assylzhan-a/subscription-service/internal/transport/http"
+	"github.com/assylzhan-a/subscription-service/internal/worker"
 	"github.com/assylzhan-a/subscription-service/pkg/jwt"
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
@@ -44,7 +56,7 @@ func main() {
 	log.Println("Connected to database")
 
 	// Run migrations
-	if err := migrations.Migrate(db); err != nil {
+	if err := migrations.Migrate(db, config.Currency.Default); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
@@ -53,21 +65,170 @@ func main() {
 	productRepo := postgres.NewProductRepository(db)
 	subscriptionRepo := postgres.NewSubscriptionRepository(db)
 	voucherRepo := postgres.NewVoucherRepository(db)
+	campaignRepo := postgres.NewCampaignRepository(db)
+	invoiceRepo := postgres.NewInvoiceRepository(db)
+	paymentRepo := postgres.NewPaymentRepository(db)
+	webhookEventRepo := postgres.NewWebhookEventRepository(db)
+	creditRepo := postgres.NewCreditRepository(db)
+	creditNoteRepo := postgres.NewCreditNoteRepository(db)
+	exchangeRateRepo := postgres.NewExchangeRateRepository(db)
+	ledgerRepo := postgres.NewLedgerRepository(db)
+	vatValidationRepo := postgres.NewVATValidationRepository(db)
+	tokenRepo := postgres.NewTokenRepository(db)
+	unitOfWork := postgres.NewUnitOfWork(db)
 
 	// Initialize JWT manager
-	jwtManager := jwt.NewManager(config.JWT.SecretKey, config.JWT.Issuer)
+	jwtManager, err := newJWTManager(config.JWT)
+	if err != nil {
+		log.Fatalf("Failed to initialize JWT manager: %v", err)
+	}
+
+	// Initialize services
+	authService := auth.NewService(
+		userRepo,
+		tokenRepo,
+		jwtManager,
+		config.JWT.GetJWTExpirationDuration(),
+		config.JWT.GetRefreshTokenExpirationDuration(),
+	)
+	productService := product.NewService(productRepo, config.Currency.Default)
+	paymentProvider := newPaymentProvider(config.Payment)
+	paymentService := payment.NewService(paymentProvider, paymentRepo, userRepo, config.Payment.GetTimeout())
+	taxService := tax.NewService(tax.NewRulesCalculator(tax.DefaultRules()), userRepo, vatValidationRepo,
+		newVATValidator(config.Tax, config.Seller), config.Seller.Country)
+	exchangeService := exchange.NewService(exchangeRateRepo, config.Currency.Reporting, config.Currency.RateBase)
+	subscriptionService := subscription.NewService(subscriptionRepo, productRepo, voucherRepo, unitOfWork, paymentService, taxService, exchangeService, newDunningPolicy(config.Dunning))
+	webhookService := webhook.NewService(webhookEventRepo, paymentProvider, config.Payment.WebhookSecret, config.Payment.GetWebhookTolerance())
+	webhookService.Handle(payment.EventPaymentSucceeded, subscriptionService.HandlePaymentSucceeded)
+	webhookService.Handle(payment.EventPaymentFailed, subscriptionService.HandlePaymentFailed)
+	webhookService.Handle(payment.EventPaymentRefunded, subscriptionService.HandlePaymentRefunded)
+	webhookService.Handle(payment.EventPaymentDisputed, subscriptionService.HandlePaymentDisputed)
+	if config.Payment.WebhookSecret == "" {
+		log.Println("WARNING: PAYMENT_WEBHOOK_SECRET is not set. Payment webhooks are rejected!")
+	}
+	voucherService := voucher.NewService(voucherRepo, productRepo, campaignRepo, unitOfWork)
+	seller, err := newSeller(config.Seller)
+	if err != nil {
+		log.Fatalf("Failed to load seller details: %v", err)
+	}
+	invoiceService := invoice.NewService(invoiceRepo, userRepo, seller)
+	creditService := credit.NewService(creditRepo, userRepo, unitOfWork)
+	reportService := report.NewService(invoiceRepo, creditNoteRepo, exchangeService)
+	ledgerService := ledger.NewService(ledgerRepo, unitOfWork)
 
 	// Initialize auth middleware
-	middleware.InitAuthMiddleware(jwtManager)
+	middleware.InitAuthMiddleware(jwtManager, authService)
 
-	// Initialize services
-	authService := auth.NewService(userRepo, jwtManager, config.JWT.GetJWTExpirationDuration())
-	productService := product.NewService(productRepo)
-	subscriptionService := subscription.NewService(subscriptionRepo, productRepo, voucherRepo)
-	voucherService := voucher.NewService(voucherRepo, productRepo)
+	// Bootstrap the first admin user if configured
+	if config.Admin.Email != "" {
+		admin, err := authService.BootstrapAdmin(context.Background(), auth.RegisterUserInput{
+			Email:    config.Admin.Email,
+			Password: config.Admin.Password,
+			Name:     config.Admin.Name,
+		})
+		if err != nil {
+			log.Fatalf("Failed to bootstrap admin user: %v", err)
+		}
+		if admin != nil {
+			log.Printf("Bootstrapped admin user %s", admin.Email)
+		}
+	}
+
+	// Exchange rates are only imported from a configured file
+	exchangeRateInterval := config.Worker.GetExchangeRateInterval()
+	if config.Currency.RatesFile == "" {
+		exchangeRateInterval = 0
+	}
+
+	// Start background jobs
+	scheduler := worker.NewScheduler(
+		worker.Job{
+			Name:     "subscription-renewals",
+			Interval: config.Worker.GetRenewalInterval(),
+			Run: func(ctx context.Context) error {
+				renewed, err := subscriptionService.ProcessRenewals(ctx, config.Worker.BatchSize)
+				if renewed > 0 {
+					log.Printf("Processed %d subscription renewals", renewed)
+				}
+				return err
+			},
+		},
+		worker.Job{
+			Name:     "subscription-resumes",
+			Interval: config.Worker.GetResumeInterval(),
+			Run: func(ctx context.Context) error {
+				resumed, err := subscriptionService.ProcessResumes(ctx, config.Worker.BatchSize)
+				if resumed > 0 {
+					log.Printf("Resumed %d paused subscriptions", resumed)
+				}
+				return err
+			},
+		},
+		worker.Job{
+			Name:     "subscription-trial-ends",
+			Interval: config.Worker.GetTrialInterval(),
+			Run: func(ctx context.Context) error {
+				ended, err := subscriptionService.ProcessTrialEnds(ctx, config.Worker.BatchSize)
+				if ended > 0 {
+					log.Printf("Ended %d subscription trials", ended)
+				}
+				return err
+			},
+		},
+		worker.Job{
+			Name:     "subscription-cancellations",
+			Interval: config.Worker.GetCancellationInterval(),
+			Run: func(ctx context.Context) error {
+				cancelled, err := subscriptionService.ProcessCancellations(ctx, config.Worker.BatchSize)
+				if cancelled > 0 {
+					log.Printf("Finalized %d scheduled cancellations", cancelled)
+				}
+				return err
+			},
+		},
+		worker.Job{
+			Name:     "subscription-payment-retries",
+			Interval: config.Worker.GetPaymentRetryInterval(),
+			Run: func(ctx context.Context) error {
+				retried, err := subscriptionService.ProcessPaymentRetries(ctx, config.Worker.BatchSize)
+				if retried > 0 {
+					log.Printf("Retried payments of %d past due subscriptions", retried)
+				}
+				return err
+			},
+		},
+		worker.Job{
+			Name:     "exchange-rate-import",
+			Interval: exchangeRateInterval,
+			Run: func(ctx context.Context) error {
+				imported, err := exchangeService.ImportFile(ctx, config.Currency.RatesFile)
+				if imported > 0 {
+					log.Printf("Imported %d exchange rates from %s", imported, config.Currency.RatesFile)
+				}
+				return err
+			},
+		},
+		worker.Job{
+			Name:     "revenue-recognition",
+			Interval: config.Worker.GetRevenueRecognitionInterval(),
+			Run: func(ctx context.Context) error {
+				recognized, err := ledgerService.RecognizeRevenue(ctx, config.Worker.BatchSize)
+				if recognized > 0 {
+					log.Printf("Recognized the deferred revenue of %d invoices", recognized)
+				}
+				return err
+			},
+		},
+		worker.Job{
+			Name:     "ledger-check",
+			Interval: config.Worker.GetLedgerCheckInterval(),
+			Run:      ledgerService.Check,
+		},
+	)
+	scheduler.Start(context.Background())
 
 	// Initialize HTTP router
-	router := httpTransport.NewRouter(authService, productService, subscriptionService, voucherService)
+	router := httpTransport.NewRouter(authService, productService, subscriptionService, voucherService, invoiceService, paymentService, webhookService, creditService, taxService, exchangeService, reportService, ledgerService, jwtManager)
 	router.Setup()
 
 	// Start HTTP server
@@ -77,3 +238,107 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// newPaymentProvider returns the configured payment provider. LoadConfig only
+// accepts the providers listed here.
+func newPaymentProvider(config configs.PaymentConfig) payment.PaymentProvider {
+	switch config.Provider {
+	case "fake":
+		log.Println("WARNING: Using the fake payment provider. No real payments are collected!")
+		return payment.NewFakeProvider()
+	default:
+		log.Fatalf("Unsupported payment provider %q", config.Provider)
+		return nil
+	}
+}
+
+// newVATValidator returns the configured online VAT ID validator, or nil if VAT IDs
+// are only validated offline. LoadConfig only accepts the validators listed here.
+func newVATValidator(config configs.TaxConfig, seller configs.SellerConfig) tax.VATValidator {
+	switch config.VATValidator {
+	case "offline":
+		return nil
+	case "vies":
+		return tax.NewVIESValidator(config.VIESURL, seller.TaxID, config.GetVIESTimeout())
+	default:
+		log.Fatalf("Unsupported VAT validator %q", config.VATValidator)
+		return nil
+	}
+}
+
+// newDunningPolicy builds the retry schedule for failed renewal payments
+func newDunningPolicy(config configs.DunningConfig) subscription.DunningPolicy {
+	policy := subscription.DunningPolicy{
+		RetryAfter:  config.GetRetryDelays(),
+		FinalAction: subscription.ActionCancel,
+	}
+	if config.FinalAction == "pause" {
+		policy.FinalAction = subscription.ActionSuspend
+	}
+	return policy
+}
+
+// newSeller builds the seller details printed on invoices, reading the logo from disk
+func newSeller(config configs.SellerConfig) (invoice.Seller, error) {
+	seller := invoice.Seller{
+		Name:    config.Name,
+		Address: config.Address,
+		Email:   config.Email,
+		TaxID:   config.TaxID,
+	}
+
+	if config.LogoPath != "" {
+		logo, err := os.ReadFile(config.LogoPath)
+		if err != nil {
+			return invoice.Seller{}, fmt.Errorf("failed to read logo: %w", err)
+		}
+		seller.Logo = logo
+	}
+
+	return seller, nil
+}
+
+// newJWTManager builds the JWT manager. With an asymmetric algorithm, keys are
+// loaded from the keys directory (a key is generated when none exists) and,
+// if configured, rotated in the background.
+func newJWTManager(config configs.JWTConfig) (*jwt.Manager, error) {
+	if !config.IsAsymmetric() {
+		return jwt.NewManager(config.SecretKey, config.Issuer), nil
+	}
+
+	// Tokens signed with the shared secret before the switch stay valid until they expire
+	opts := []jwt.Option{
+		jwt.WithGracePeriod(time.Duration(config.KeyGraceHours) * time.Hour),
+		jwt.WithHMACAcceptedUntil(config.HMACAcceptUntil),
+	}
+
+	if config.KeysDir != "" {
+		opts = append(opts, jwt.WithKeyStore(jwt.NewFileKeyStore(config.KeysDir)))
+	} else {
+		log.Println("WARNING: JWT_KEYS_DIR is not set. Signing keys are kept in memory and lost on restart!")
+	}
+
+	manager := jwt.NewManager(config.SecretKey, config.Issuer, opts...)
+	if err := manager.LoadKeys(); err != nil {
+		return nil, err
+	}
+
+	key, err := manager.EnsureKey(jwt.Algorithm(config.Algorithm))
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		log.Printf("Generated JWT signing key %s", key.ID)
+	}
+
+	if config.KeyRotationHours > 0 {
+		go manager.RunKeyRotation(context.Background(), jwt.RotationConfig{
+			Algorithm:       jwt.Algorithm(config.Algorithm),
+			Interval:        time.Duration(config.KeyRotationHours) * time.Hour,
+			ActivationDelay: time.Duration(config.KeyActivationDelayMin) * time.Minute,
+			CheckInterval:   time.Minute,
+		})
+	}
+
+	return manager, nil
+}
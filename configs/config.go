@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
+	"github.com/assylzhan-a/subscription-service/pkg/vatid"
 	"github.com/joho/godotenv"
 )
 
@@ -14,6 +17,13 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	JWT      JWTConfig
+	Admin    AdminConfig
+	Worker   WorkerConfig
+	Seller   SellerConfig
+	Tax      TaxConfig
+	Payment  PaymentConfig
+	Dunning  DunningConfig
+	Currency CurrencyConfig
 }
 
 // ServerConfig holds the server configuration
@@ -34,9 +44,97 @@ type DatabaseConfig struct {
 
 // JWTConfig holds the JWT configuration
 type JWTConfig struct {
-	SecretKey    string
-	Issuer       string
-	ExpiresInMin int
+	SecretKey             string
+	Issuer                string
+	ExpiresInMin          int
+	RefreshExpiresInHours int
+
+	// Asymmetric signing; HS256 keeps using SecretKey only
+	Algorithm             string
+	KeysDir               string
+	KeyRotationHours      int
+	KeyGraceHours         int
+	KeyActivationDelayMin int
+	HMACAcceptUntil       time.Time
+}
+
+// AdminConfig holds the credentials used to bootstrap the first admin user
+type AdminConfig struct {
+	Email    string
+	Password string
+	Name     string
+}
+
+// WorkerConfig holds the background job configuration
+type WorkerConfig struct {
+	RenewalIntervalSec      int
+	ResumeIntervalSec       int
+	TrialIntervalSec        int
+	CancellationIntervalSec int
+	PaymentRetryIntervalSec int
+	// ExchangeRateIntervalSec is how often the exchange rates file is imported
+	ExchangeRateIntervalSec int
+	// RevenueRecognitionIntervalSec is how often the deferred revenue of ended periods is recognized
+	RevenueRecognitionIntervalSec int
+	// LedgerCheckIntervalSec is how often the ledger is checked to be balanced
+	LedgerCheckIntervalSec int
+	BatchSize              int
+}
+
+// SellerConfig holds the seller details printed on invoices
+type SellerConfig struct {
+	Name     string
+	Address  []string
+	Email    string
+	TaxID    string
+	LogoPath string
+	// Country is the EU member state the seller is registered for VAT in; sales to
+	// businesses in other member states are reverse charged
+	Country string
+}
+
+// TaxConfig holds the configuration of VAT ID validation
+type TaxConfig struct {
+	// VATValidator is "offline", which only checks the format of VAT IDs, or "vies",
+	// which also asks the tax authorities
+	VATValidator   string
+	VIESURL        string
+	VIESTimeoutSec int
+}
+
+// PaymentConfig holds the payment provider configuration
+type PaymentConfig struct {
+	Provider   string
+	TimeoutSec int
+	// WebhookSecret verifies the signatures of the provider's webhooks; without it
+	// all webhooks are rejected
+	WebhookSecret       string
+	WebhookToleranceSec int
+}
+
+// DunningConfig holds the retry schedule for failed renewal payments
+type DunningConfig struct {
+	// RetryDays lists the days after the end of the unpaid period on which the
+	// payment is retried, in increasing order
+	RetryDays []int
+	// FinalAction is "cancel" or "pause", taken when the last retry fails
+	FinalAction string
+}
+
+// CurrencyConfig holds the currency configuration
+type CurrencyConfig struct {
+	// Default is the currency of new products without one and of the prices,
+	// subscriptions and payments that existed before multi-currency pricing
+	Default string
+	// Reporting is the currency finance reports revenue in; all amounts are converted
+	// to it
+	Reporting string
+	// RateBase is the currency imported exchange rates are quoted against, EUR for ECB
+	// reference rates. Amounts are converted through it when there is no direct rate.
+	RateBase string
+	// RatesFile is a local CSV or ECB XML file exchange rates are imported from; rates
+	// are not imported when empty
+	RatesFile string
 }
 
 // LoadConfig loads the application configuration from environment variables
@@ -58,9 +156,59 @@ func LoadConfig() (*Config, error) {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		JWT: JWTConfig{
-			SecretKey:    getEnv("JWT_SECRET_KEY", "your-secret-key"),
-			Issuer:       getEnv("JWT_ISSUER", "subscription-service"),
-			ExpiresInMin: getEnvAsInt("JWT_EXPIRES_IN_MIN", 60), // 1 hour default
+			SecretKey:             getEnv("JWT_SECRET_KEY", "your-secret-key"),
+			Issuer:                getEnv("JWT_ISSUER", "subscription-service"),
+			ExpiresInMin:          getEnvAsInt("JWT_EXPIRES_IN_MIN", 60),              // 1 hour default
+			RefreshExpiresInHours: getEnvAsInt("JWT_REFRESH_EXPIRES_IN_HOURS", 24*30), // 30 days default
+			Algorithm:             getEnv("JWT_SIGNING_ALGORITHM", "HS256"),
+			KeysDir:               getEnv("JWT_KEYS_DIR", ""),
+			KeyRotationHours:      getEnvAsInt("JWT_KEY_ROTATION_HOURS", 0), // rotation disabled by default
+			KeyGraceHours:         getEnvAsInt("JWT_KEY_GRACE_HOURS", 24),
+			KeyActivationDelayMin: getEnvAsInt("JWT_KEY_ACTIVATION_DELAY_MIN", 10),
+			HMACAcceptUntil:       getEnvAsTime("JWT_HMAC_ACCEPT_UNTIL", time.Time{}),
+		},
+		Admin: AdminConfig{
+			Email:    getEnv("ADMIN_EMAIL", ""),
+			Password: getEnv("ADMIN_PASSWORD", ""),
+			Name:     getEnv("ADMIN_NAME", "Administrator"),
+		},
+		Worker: WorkerConfig{
+			RenewalIntervalSec:            getEnvAsInt("RENEWAL_INTERVAL_SEC", 60),       // 0 disables the renewal job
+			ResumeIntervalSec:             getEnvAsInt("RESUME_INTERVAL_SEC", 60),        // 0 disables the resume job
+			TrialIntervalSec:              getEnvAsInt("TRIAL_INTERVAL_SEC", 60),         // 0 disables the trial end job
+			CancellationIntervalSec:       getEnvAsInt("CANCELLATION_INTERVAL_SEC", 60),  // 0 disables the cancellation job
+			PaymentRetryIntervalSec:       getEnvAsInt("PAYMENT_RETRY_INTERVAL_SEC", 60), // 0 disables the payment retry job
+			ExchangeRateIntervalSec:       getEnvAsInt("EXCHANGE_RATE_INTERVAL_SEC", 3600),
+			RevenueRecognitionIntervalSec: getEnvAsInt("REVENUE_RECOGNITION_INTERVAL_SEC", 3600),
+			LedgerCheckIntervalSec:        getEnvAsInt("LEDGER_CHECK_INTERVAL_SEC", 3600),
+			BatchSize:                     getEnvAsInt("WORKER_BATCH_SIZE", 100),
+		},
+		Seller: SellerConfig{
+			Name:     getEnv("SELLER_NAME", "Subscription Service"),
+			Address:  getEnvAsList("SELLER_ADDRESS", "|"), // address lines separated by |
+			Email:    getEnv("SELLER_EMAIL", ""),
+			TaxID:    getEnv("SELLER_TAX_ID", ""),
+			LogoPath: getEnv("SELLER_LOGO_PATH", ""), // PNG or JPEG, no logo when empty
+			Country:  strings.ToUpper(getEnv("SELLER_COUNTRY", "")),
+		},
+		Tax: TaxConfig{
+			VATValidator:   getEnv("VAT_VALIDATOR", "offline"),
+			VIESURL:        getEnv("VIES_URL", "https://ec.europa.eu/taxation_customs/vies/rest-api"),
+			VIESTimeoutSec: getEnvAsInt("VIES_TIMEOUT_SEC", 10),
+		},
+		Payment: PaymentConfig{
+			Provider:            getEnv("PAYMENT_PROVIDER", "fake"),
+			TimeoutSec:          getEnvAsInt("PAYMENT_TIMEOUT_SEC", 30),
+			WebhookSecret:       getEnv("PAYMENT_WEBHOOK_SECRET", ""),
+			WebhookToleranceSec: getEnvAsInt("PAYMENT_WEBHOOK_TOLERANCE_SEC", 300),
+		},
+		Dunning: DunningConfig{
+			FinalAction: getEnv("DUNNING_FINAL_ACTION", "cancel"),
+		},
+		Currency: CurrencyConfig{
+			Default:   currency.Normalize(getEnv("DEFAULT_CURRENCY", "EUR")),
+			RateBase:  currency.Normalize(getEnv("EXCHANGE_RATE_BASE", "EUR")),
+			RatesFile: getEnv("EXCHANGE_RATES_FILE", ""),
 		},
 	}
 
@@ -69,6 +217,60 @@ func LoadConfig() (*Config, error) {
 		fmt.Println("WARNING: Using default JWT secret key. This is insecure!")
 	}
 
+	switch config.JWT.Algorithm {
+	case "HS256", "RS256", "EdDSA":
+	default:
+		return nil, fmt.Errorf("unsupported JWT_SIGNING_ALGORITHM %q", config.JWT.Algorithm)
+	}
+
+	// A default computed at startup would move with every restart, so the end of the
+	// switch from the shared secret is set once by the operator
+	if config.JWT.IsAsymmetric() && config.JWT.HMACAcceptUntil.IsZero() {
+		return nil, fmt.Errorf("JWT_HMAC_ACCEPT_UNTIL must be an RFC 3339 time when JWT_SIGNING_ALGORITHM is %s", config.JWT.Algorithm)
+	}
+
+	switch config.Payment.Provider {
+	case "fake":
+	default:
+		return nil, fmt.Errorf("unsupported PAYMENT_PROVIDER %q", config.Payment.Provider)
+	}
+
+	switch config.Tax.VATValidator {
+	case "offline", "vies":
+	default:
+		return nil, fmt.Errorf("unsupported VAT_VALIDATOR %q", config.Tax.VATValidator)
+	}
+
+	// Without the seller's member state, reverse charge is disabled
+	if config.Seller.Country != "" && !vatid.IsMemberState(config.Seller.Country) {
+		return nil, fmt.Errorf("SELLER_COUNTRY %q is not an EU member state", config.Seller.Country)
+	}
+
+	retryDays, err := parseRetryDays(getEnv("DUNNING_RETRY_DAYS", "1,3,7"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DUNNING_RETRY_DAYS: %w", err)
+	}
+	config.Dunning.RetryDays = retryDays
+
+	switch config.Dunning.FinalAction {
+	case "cancel", "pause":
+	default:
+		return nil, fmt.Errorf("unsupported DUNNING_FINAL_ACTION %q", config.Dunning.FinalAction)
+	}
+
+	if !currency.Valid(config.Currency.Default) {
+		return nil, fmt.Errorf("unsupported DEFAULT_CURRENCY %q", config.Currency.Default)
+	}
+
+	config.Currency.Reporting = currency.Normalize(getEnv("REPORTING_CURRENCY", config.Currency.Default))
+	if !currency.Valid(config.Currency.Reporting) {
+		return nil, fmt.Errorf("unsupported REPORTING_CURRENCY %q", config.Currency.Reporting)
+	}
+
+	if !currency.Valid(config.Currency.RateBase) {
+		return nil, fmt.Errorf("unsupported EXCHANGE_RATE_BASE %q", config.Currency.RateBase)
+	}
+
 	return config, nil
 }
 
@@ -85,6 +287,80 @@ func (c *JWTConfig) GetJWTExpirationDuration() time.Duration {
 	return time.Duration(c.ExpiresInMin) * time.Minute
 }
 
+// GetRefreshTokenExpirationDuration returns the refresh token expiration duration
+func (c *JWTConfig) GetRefreshTokenExpirationDuration() time.Duration {
+	return time.Duration(c.RefreshExpiresInHours) * time.Hour
+}
+
+// IsAsymmetric reports whether tokens are signed with rotating asymmetric keys
+func (c *JWTConfig) IsAsymmetric() bool {
+	return c.Algorithm != "HS256"
+}
+
+// GetRenewalInterval returns how often due subscriptions are renewed
+func (c *WorkerConfig) GetRenewalInterval() time.Duration {
+	return time.Duration(c.RenewalIntervalSec) * time.Second
+}
+
+// GetResumeInterval returns how often paused subscriptions are checked for a due resume date
+func (c *WorkerConfig) GetResumeInterval() time.Duration {
+	return time.Duration(c.ResumeIntervalSec) * time.Second
+}
+
+// GetTrialInterval returns how often subscriptions with ended trials are activated
+func (c *WorkerConfig) GetTrialInterval() time.Duration {
+	return time.Duration(c.TrialIntervalSec) * time.Second
+}
+
+// GetCancellationInterval returns how often scheduled cancellations are finalized
+func (c *WorkerConfig) GetCancellationInterval() time.Duration {
+	return time.Duration(c.CancellationIntervalSec) * time.Second
+}
+
+// GetPaymentRetryInterval returns how often due payment retries of past due subscriptions are made
+func (c *WorkerConfig) GetPaymentRetryInterval() time.Duration {
+	return time.Duration(c.PaymentRetryIntervalSec) * time.Second
+}
+
+// GetExchangeRateInterval returns how often the exchange rates file is imported
+func (c *WorkerConfig) GetExchangeRateInterval() time.Duration {
+	return time.Duration(c.ExchangeRateIntervalSec) * time.Second
+}
+
+// GetRevenueRecognitionInterval returns how often the deferred revenue of ended periods is recognized
+func (c *WorkerConfig) GetRevenueRecognitionInterval() time.Duration {
+	return time.Duration(c.RevenueRecognitionIntervalSec) * time.Second
+}
+
+// GetLedgerCheckInterval returns how often the ledger is checked to be balanced
+func (c *WorkerConfig) GetLedgerCheckInterval() time.Duration {
+	return time.Duration(c.LedgerCheckIntervalSec) * time.Second
+}
+
+// GetRetryDelays returns the retry days as durations
+func (c *DunningConfig) GetRetryDelays() []time.Duration {
+	delays := make([]time.Duration, len(c.RetryDays))
+	for i, days := range c.RetryDays {
+		delays[i] = time.Duration(days) * 24 * time.Hour
+	}
+	return delays
+}
+
+// GetVIESTimeout returns how long a VIES check may take
+func (c *TaxConfig) GetVIESTimeout() time.Duration {
+	return time.Duration(c.VIESTimeoutSec) * time.Second
+}
+
+// GetTimeout returns how long a call to the payment provider may take
+func (c *PaymentConfig) GetTimeout() time.Duration {
+	return time.Duration(c.TimeoutSec) * time.Second
+}
+
+// GetWebhookTolerance returns how old a webhook's signature may be
+func (c *PaymentConfig) GetWebhookTolerance() time.Duration {
+	return time.Duration(c.WebhookToleranceSec) * time.Second
+}
+
 // Helper function to get environment variable with fallback
 func getEnv(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -102,3 +378,40 @@ func getEnvAsInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+// Helper function to get environment variable as a list of non-empty, trimmed values
+func getEnvAsList(key, separator string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), separator) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// parseRetryDays parses a comma-separated list of increasing, positive day counts
+func parseRetryDays(value string) ([]int, error) {
+	var days []int
+	for _, field := range strings.Split(value, ",") {
+		day, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || day <= 0 {
+			return nil, fmt.Errorf("%q is not a positive number of days", field)
+		}
+		if len(days) > 0 && day <= days[len(days)-1] {
+			return nil, fmt.Errorf("days must be increasing")
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// Helper function to get environment variable as an RFC 3339 time with fallback
+func getEnvAsTime(key string, fallback time.Time) time.Time {
+	if value, exists := os.LookupEnv(key); exists {
+		if timeValue, err := time.Parse(time.RFC3339, value); err == nil {
+			return timeValue
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/pkg/vatid"
+	"github.com/google/uuid"
+)
+
+// maxAddressLineLength limits each line of a billing address
+const maxAddressLineLength = 255
+
+type UpdateBillingAddressInput struct {
+	UserID  uuid.UUID
+	Address models.Address
+}
+
+func (i *UpdateBillingAddressInput) Validate() errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	if i.UserID == uuid.Nil {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "user_id",
+			Message: "must not be empty",
+		})
+	}
+
+	if !isLetters(i.Address.Country, 2, 2) {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "country",
+			Message: "must be a two-letter ISO 3166-1 country code",
+		})
+	}
+
+	if i.Address.Region != "" && !isAlphanumeric(i.Address.Region, 1, 3) {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "region",
+			Message: "must be the subdivision part of an ISO 3166-2 code, e.g. QC",
+		})
+	}
+
+	lines := []struct{ field, value string }{
+		{"line1", i.Address.Line1},
+		{"line2", i.Address.Line2},
+		{"city", i.Address.City},
+		{"postal_code", i.Address.PostalCode},
+	}
+	for _, line := range lines {
+		if len(line.value) > maxAddressLineLength {
+			validationErrors = append(validationErrors, errors.ValidationError{
+				Field:   line.field,
+				Message: fmt.Sprintf("must not be longer than %d characters", maxAddressLineLength),
+			})
+		}
+	}
+
+	return validationErrors
+}
+
+// UpdateBillingAddress sets the address the user is billed at, which decides the
+// taxes they pay from their next charge on
+func (s *Service) UpdateBillingAddress(ctx context.Context, input UpdateBillingAddressInput) (*models.User, error) {
+	input.Address.Country = strings.ToUpper(strings.TrimSpace(input.Address.Country))
+	input.Address.Region = strings.ToUpper(strings.TrimSpace(input.Address.Region))
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	user, err := s.userRepo.GetByID(ctx, input.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	address := input.Address
+	user.BillingAddress = &address
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update billing address: %w", err)
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+// maxCompanyNameLength limits the company name of a business profile
+const maxCompanyNameLength = 255
+
+type UpdateBusinessProfileInput struct {
+	UserID      uuid.UUID
+	CompanyName string
+	VATID       string
+}
+
+func (i *UpdateBusinessProfileInput) Validate() errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	if i.UserID == uuid.Nil {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "user_id",
+			Message: "must not be empty",
+		})
+	}
+
+	if i.CompanyName == "" {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "company_name",
+			Message: "must not be empty",
+		})
+	} else if len(i.CompanyName) > maxCompanyNameLength {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "company_name",
+			Message: fmt.Sprintf("must not be longer than %d characters", maxCompanyNameLength),
+		})
+	}
+
+	if i.VATID != "" {
+		if err := vatid.Validate(i.VATID); err != nil {
+			validationErrors = append(validationErrors, errors.ValidationError{
+				Field:   "vat_id",
+				Message: "must be a valid EU VAT ID: " + err.Error(),
+			})
+		}
+	}
+
+	return validationErrors
+}
+
+// UpdateBusinessProfile makes the user buy as a business. Businesses registered for
+// VAT in another EU member state than the seller are not charged VAT from their next
+// charge on, once their VAT ID has been checked.
+func (s *Service) UpdateBusinessProfile(ctx context.Context, input UpdateBusinessProfileInput) (*models.User, error) {
+	input.CompanyName = strings.TrimSpace(input.CompanyName)
+	input.VATID = vatid.Normalize(input.VATID)
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	user, err := s.userRepo.GetByID(ctx, input.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.BusinessProfile = &models.BusinessProfile{
+		CompanyName: input.CompanyName,
+		VATID:       input.VATID,
+	}
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update business profile: %w", err)
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+// RemoveBusinessProfile makes the user buy as a consumer again
+func (s *Service) RemoveBusinessProfile(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.BusinessProfile = nil
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to remove business profile: %w", err)
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+// isLetters reports whether s is between minLength and maxLength ASCII letters long
+func isLetters(s string, minLength, maxLength int) bool {
+	if len(s) < minLength || len(s) > maxLength {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// isAlphanumeric reports whether s is between minLength and maxLength ASCII letters
+// and digits long
+func isAlphanumeric(s string, minLength, maxLength int) bool {
+	if len(s) < minLength || len(s) > maxLength {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
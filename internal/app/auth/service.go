@@ -2,6 +2,10 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"strings"
 	"time"
@@ -16,19 +20,25 @@ import (
 
 type Service struct {
 	userRepo   repository.UserRepository
+	tokenRepo  repository.TokenRepository
 	jwtManager *jwt.Manager
 	jwtTTL     time.Duration
+	refreshTTL time.Duration
 }
 
 func NewService(
 	userRepo repository.UserRepository,
+	tokenRepo repository.TokenRepository,
 	jwtManager *jwt.Manager,
 	jwtTTL time.Duration,
+	refreshTTL time.Duration,
 ) *Service {
 	return &Service{
 		userRepo:   userRepo,
+		tokenRepo:  tokenRepo,
 		jwtManager: jwtManager,
 		jwtTTL:     jwtTTL,
+		refreshTTL: refreshTTL,
 	}
 }
 
@@ -80,6 +90,7 @@ func (s *Service) RegisterUser(ctx context.Context, input RegisterUserInput) (*m
 		Email:    input.Email,
 		Password: hashedPassword,
 		Name:     input.Name,
+		Role:     models.UserRoleCustomer,
 	}
 
 	if err := s.userRepo.Create(ctx, user); err != nil {
@@ -90,6 +101,46 @@ func (s *Service) RegisterUser(ctx context.Context, input RegisterUserInput) (*m
 	return user, nil
 }
 
+// BootstrapAdmin makes sure at least one admin exists. If no admin is present
+// the user with the given email is created, or promoted if the password matches
+// theirs; otherwise it fails with ErrInvalidCredentials. It returns nil without
+// changes once an admin is in place.
+func (s *Service) BootstrapAdmin(ctx context.Context, input RegisterUserInput) (*models.User, error) {
+	count, err := s.userRepo.CountByRole(ctx, models.UserRoleAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count admins: %w", err)
+	}
+
+	if count > 0 {
+		return nil, nil
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, input.Email)
+	if err == errors.ErrUserNotFound {
+		if _, err := s.RegisterUser(ctx, input); err != nil {
+			return nil, err
+		}
+		// Reload so the stored password hash is preserved on update
+		user, err = s.userRepo.GetByEmail(ctx, input.Email)
+	} else if err == nil {
+		// Anyone can register with the address, so only its owner is promoted
+		if err := validatePassword(input.Password, user.Password); err != nil {
+			return nil, errors.ErrInvalidCredentials
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin user: %w", err)
+	}
+
+	user.Role = models.UserRoleAdmin
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to promote user to admin: %w", err)
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
 type LoginUserInput struct {
 	Email    string
 	Password string
@@ -116,9 +167,11 @@ func (i *LoginUserInput) Validate() errors.ValidationErrors {
 }
 
 type LoginResponse struct {
-	User      *models.User `json:"user"`
-	Token     string       `json:"token"`
-	ExpiresAt int64        `json:"expires_at"`
+	User                  *models.User `json:"user"`
+	Token                 string       `json:"token"`
+	ExpiresAt             int64        `json:"expires_at"`
+	RefreshToken          string       `json:"refresh_token"`
+	RefreshTokenExpiresAt int64        `json:"refresh_token_expires_at"`
 }
 
 func (s *Service) LoginUser(ctx context.Context, input LoginUserInput) (*LoginResponse, error) {
@@ -135,8 +188,124 @@ func (s *Service) LoginUser(ctx context.Context, input LoginUserInput) (*LoginRe
 		return nil, errors.ErrInvalidCredentials
 	}
 
+	// Every login starts a new refresh token family
+	refreshToken, rawRefreshToken, err := s.newRefreshToken(user.ID, uuid.New())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.tokenRepo.CreateRefreshToken(ctx, refreshToken); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return s.issueTokens(user, refreshToken, rawRefreshToken)
+}
+
+// RefreshTokens exchanges a refresh token for a new access token and a new refresh token.
+// Refresh tokens are single-use: presenting one that was already rotated is treated as
+// theft, and every token descending from the same login is revoked.
+func (s *Service) RefreshTokens(ctx context.Context, rawRefreshToken string) (*LoginResponse, error) {
+	if strings.TrimSpace(rawRefreshToken) == "" {
+		return nil, errors.ErrInvalidRefreshToken
+	}
+
+	current, err := s.tokenRepo.GetRefreshTokenByHash(ctx, hashToken(rawRefreshToken))
+	if err != nil {
+		if err == errors.ErrInvalidRefreshToken {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	if current.RevokedAt != nil {
+		return nil, s.revokeReusedFamily(ctx, current)
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		return nil, errors.ErrInvalidRefreshToken
+	}
+
+	// Reload the user so role changes are picked up on refresh
+	user, err := s.userRepo.GetByID(ctx, current.UserID)
+	if err != nil {
+		if err == errors.ErrUserNotFound {
+			return nil, errors.ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	replacement, rawReplacement, err := s.newRefreshToken(user.ID, current.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.tokenRepo.RotateRefreshToken(ctx, current.ID, replacement); err != nil {
+		if err == errors.ErrRefreshTokenReused {
+			return nil, s.revokeReusedFamily(ctx, current)
+		}
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	return s.issueTokens(user, replacement, rawReplacement)
+}
+
+type LogoutInput struct {
+	UserID         uuid.UUID
+	TokenID        string
+	TokenExpiresAt time.Time
+	RefreshToken   string
+}
+
+// Logout revokes the access token used for the request and, if provided,
+// the refresh token family of the session.
+func (s *Service) Logout(ctx context.Context, input LogoutInput) error {
+	if input.TokenID != "" {
+		if err := s.tokenRepo.RevokeAccessToken(ctx, input.TokenID, input.TokenExpiresAt); err != nil {
+			return fmt.Errorf("failed to revoke access token: %w", err)
+		}
+	}
+
+	if strings.TrimSpace(input.RefreshToken) == "" {
+		return nil
+	}
+
+	refreshToken, err := s.tokenRepo.GetRefreshTokenByHash(ctx, hashToken(input.RefreshToken))
+	if err != nil {
+		if err == errors.ErrInvalidRefreshToken {
+			return err
+		}
+		return fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	if refreshToken.UserID != input.UserID {
+		return errors.ErrInvalidRefreshToken
+	}
+
+	if err := s.tokenRepo.RevokeRefreshTokenFamily(ctx, refreshToken.FamilyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// IsTokenRevoked reports whether the access token with the given ID (jti) was revoked
+func (s *Service) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	return s.tokenRepo.IsAccessTokenRevoked(ctx, tokenID)
+}
+
+// GetUserRole returns the user's current role. Access tokens keep the role they were
+// issued with, so requests are authorized with this one.
+func (s *Service) GetUserRole(ctx context.Context, userID uuid.UUID) (models.UserRole, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return user.Role, nil
+}
+
+func (s *Service) issueTokens(user *models.User, refreshToken *models.RefreshToken, rawRefreshToken string) (*LoginResponse, error) {
 	expiresAt := time.Now().Add(s.jwtTTL)
-	token, err := s.jwtManager.GenerateToken(user.ID, s.jwtTTL)
+	token, err := s.jwtManager.GenerateToken(user.ID, string(user.Role), s.jwtTTL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate token: %w", err)
 	}
@@ -144,12 +313,40 @@ func (s *Service) LoginUser(ctx context.Context, input LoginUserInput) (*LoginRe
 	user.Password = ""
 
 	return &LoginResponse{
-		User:      user,
-		Token:     token,
-		ExpiresAt: expiresAt.Unix(),
+		User:                  user,
+		Token:                 token,
+		ExpiresAt:             expiresAt.Unix(),
+		RefreshToken:          rawRefreshToken,
+		RefreshTokenExpiresAt: refreshToken.ExpiresAt.Unix(),
 	}, nil
 }
 
+func (s *Service) newRefreshToken(userID, familyID uuid.UUID) (*models.RefreshToken, string, error) {
+	raw, err := generateOpaqueToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	now := time.Now()
+	token := &models.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: now.Add(s.refreshTTL),
+		CreatedAt: now,
+	}
+
+	return token, raw, nil
+}
+
+func (s *Service) revokeReusedFamily(ctx context.Context, token *models.RefreshToken) error {
+	if err := s.tokenRepo.RevokeRefreshTokenFamily(ctx, token.FamilyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+	return errors.ErrRefreshTokenReused
+}
+
 func (s *Service) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
@@ -160,6 +357,81 @@ func (s *Service) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User,
 	return user, nil
 }
 
+type ChangeUserRoleInput struct {
+	ActorID uuid.UUID
+	UserID  uuid.UUID
+	Role    models.UserRole
+}
+
+func (i *ChangeUserRoleInput) Validate() errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	if i.UserID == uuid.Nil {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "user_id",
+			Message: "must not be empty",
+		})
+	}
+
+	if !i.Role.IsValid() {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "role",
+			Message: "must be one of 'customer', 'support' or 'admin'",
+		})
+	}
+
+	return validationErrors
+}
+
+// ChangeUserRole assigns a new role to a user. Only admins may change roles,
+// and an admin cannot demote themselves so the system never loses its last admin
+// by accident.
+func (s *Service) ChangeUserRole(ctx context.Context, input ChangeUserRoleInput) (*models.User, error) {
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	actor, err := s.userRepo.GetByID(ctx, input.ActorID)
+	if err != nil {
+		if err == errors.ErrUserNotFound {
+			return nil, errors.ErrUnauthorized
+		}
+		return nil, err
+	}
+
+	if err := Authorize(actor.Role, models.UserRoleAdmin); err != nil {
+		return nil, err
+	}
+
+	if actor.ID == input.UserID && input.Role != models.UserRoleAdmin {
+		return nil, errors.ValidationErrors{{
+			Field:   "role",
+			Message: "admins cannot demote themselves",
+		}}
+	}
+
+	user, err := s.userRepo.GetByID(ctx, input.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Role = input.Role
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update user role: %w", err)
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+// Authorize checks that role is one of the allowed roles, see models.UserRole.OneOf
+func Authorize(role models.UserRole, allowed ...models.UserRole) error {
+	if !role.OneOf(allowed...) {
+		return errors.ErrForbidden
+	}
+	return nil
+}
+
 func hashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(bytes), err
@@ -168,3 +440,16 @@ func hashPassword(password string) (string, error) {
 func validatePassword(password, hashedPassword string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
+
+func generateOpaqueToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -68,6 +68,74 @@ func (m *mockUserRepository) Update(ctx context.Context, user *models.User) erro
 	return nil
 }
 
+func (m *mockUserRepository) CountByRole(ctx context.Context, role models.UserRole) (int, error) {
+	count := 0
+	for _, user := range m.users {
+		if user.Role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type mockTokenRepository struct {
+	refreshTokens map[uuid.UUID]*models.RefreshToken
+	revoked       map[string]time.Time
+}
+
+func newMockTokenRepository() *mockTokenRepository {
+	return &mockTokenRepository{
+		refreshTokens: make(map[uuid.UUID]*models.RefreshToken),
+		revoked:       make(map[string]time.Time),
+	}
+}
+
+func (m *mockTokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	m.refreshTokens[token.ID] = token
+	return nil
+}
+
+func (m *mockTokenRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	for _, token := range m.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+	return nil, errors.ErrInvalidRefreshToken
+}
+
+func (m *mockTokenRepository) RotateRefreshToken(ctx context.Context, oldID uuid.UUID, replacement *models.RefreshToken) error {
+	old, ok := m.refreshTokens[oldID]
+	if !ok || old.RevokedAt != nil {
+		return errors.ErrRefreshTokenReused
+	}
+	now := time.Now()
+	old.RevokedAt = &now
+	old.ReplacedBy = &replacement.ID
+	m.refreshTokens[replacement.ID] = replacement
+	return nil
+}
+
+func (m *mockTokenRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	now := time.Now()
+	for _, token := range m.refreshTokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockTokenRepository) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	m.revoked[tokenID] = expiresAt
+	return nil
+}
+
+func (m *mockTokenRepository) IsAccessTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	_, ok := m.revoked[tokenID]
+	return ok, nil
+}
+
 type mockJWTManager struct{}
 
 func newMockJWTManager() *jwt.Manager {
@@ -85,7 +153,7 @@ func TestRegisterUser(t *testing.T) {
 	ctx := context.Background()
 	userRepo := newMockUserRepository()
 	jwtManager := newMockJWTManager()
-	service := auth.NewService(userRepo, jwtManager, time.Hour)
+	service := auth.NewService(userRepo, newMockTokenRepository(), jwtManager, time.Hour, 24*time.Hour)
 
 	// Test case 1: Register valid user
 	input := auth.RegisterUserInput{
@@ -135,7 +203,7 @@ func TestLoginUser(t *testing.T) {
 	ctx := context.Background()
 	userRepo := newMockUserRepository()
 	jwtManager := newMockJWTManager()
-	service := auth.NewService(userRepo, jwtManager, time.Hour)
+	service := auth.NewService(userRepo, newMockTokenRepository(), jwtManager, time.Hour, 24*time.Hour)
 
 	// Create a test user with known password
 	hashedPassword := hashPassword("password123")
@@ -219,7 +287,7 @@ func TestGetUserByID(t *testing.T) {
 	ctx := context.Background()
 	userRepo := newMockUserRepository()
 	jwtManager := newMockJWTManager()
-	service := auth.NewService(userRepo, jwtManager, time.Hour)
+	service := auth.NewService(userRepo, newMockTokenRepository(), jwtManager, time.Hour, 24*time.Hour)
 
 	// Create a test user
 	testUser := &models.User{
@@ -264,3 +332,451 @@ func TestGetUserByID(t *testing.T) {
 		t.Errorf("Expected error %v, got %v", errors.ErrUserNotFound, err)
 	}
 }
+
+func TestLoginUserTokenCarriesRole(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	userRepo := newMockUserRepository()
+	jwtManager := newMockJWTManager()
+	service := auth.NewService(userRepo, newMockTokenRepository(), jwtManager, time.Hour, 24*time.Hour)
+
+	testUser := &models.User{
+		ID:       uuid.New(),
+		Email:    "support@example.com",
+		Password: hashPassword("password123"),
+		Name:     "Support User",
+		Role:     models.UserRoleSupport,
+	}
+	if err := userRepo.Create(ctx, testUser); err != nil {
+		t.Fatal("Failed to create test user:", err)
+	}
+
+	response, err := service.LoginUser(ctx, auth.LoginUserInput{
+		Email:    "support@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatal("Failed to login user:", err)
+	}
+
+	claims, err := jwtManager.ValidateToken(response.Token)
+	if err != nil {
+		t.Fatal("Failed to validate token:", err)
+	}
+
+	if claims.Role != string(models.UserRoleSupport) {
+		t.Errorf("Expected role %v in token, got %v", models.UserRoleSupport, claims.Role)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	// Test case 1: Customers are rejected from admin-only operations
+	if err := auth.Authorize(models.UserRoleCustomer, models.UserRoleAdmin); err != errors.ErrForbidden {
+		t.Errorf("Expected error %v for customer, got %v", errors.ErrForbidden, err)
+	}
+
+	// Test case 2: Tokens without a role are treated as customers
+	if err := auth.Authorize("", models.UserRoleAdmin, models.UserRoleSupport); err != errors.ErrForbidden {
+		t.Errorf("Expected error %v for empty role, got %v", errors.ErrForbidden, err)
+	}
+
+	// Test case 3: Support is allowed where listed
+	if err := auth.Authorize(models.UserRoleSupport, models.UserRoleAdmin, models.UserRoleSupport); err != nil {
+		t.Errorf("Expected support to be authorized, got %v", err)
+	}
+
+	// Test case 4: Admin is allowed
+	if err := auth.Authorize(models.UserRoleAdmin, models.UserRoleAdmin); err != nil {
+		t.Errorf("Expected admin to be authorized, got %v", err)
+	}
+}
+
+func TestChangeUserRole(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	userRepo := newMockUserRepository()
+	jwtManager := newMockJWTManager()
+	service := auth.NewService(userRepo, newMockTokenRepository(), jwtManager, time.Hour, 24*time.Hour)
+
+	admin := &models.User{ID: uuid.New(), Email: "admin@example.com", Role: models.UserRoleAdmin}
+	customer := &models.User{ID: uuid.New(), Email: "customer@example.com", Role: models.UserRoleCustomer}
+	for _, user := range []*models.User{admin, customer} {
+		if err := userRepo.Create(ctx, user); err != nil {
+			t.Fatal("Failed to create test user:", err)
+		}
+	}
+
+	// Test case 1: Customer cannot change roles, not even their own
+	_, err := service.ChangeUserRole(ctx, auth.ChangeUserRoleInput{
+		ActorID: customer.ID,
+		UserID:  customer.ID,
+		Role:    models.UserRoleAdmin,
+	})
+	if err != errors.ErrForbidden {
+		t.Errorf("Expected error %v, got %v", errors.ErrForbidden, err)
+	}
+	if customer.Role != models.UserRoleCustomer {
+		t.Errorf("Expected role to stay %v, got %v", models.UserRoleCustomer, customer.Role)
+	}
+
+	// Test case 2: Admin can promote a customer to support
+	user, err := service.ChangeUserRole(ctx, auth.ChangeUserRoleInput{
+		ActorID: admin.ID,
+		UserID:  customer.ID,
+		Role:    models.UserRoleSupport,
+	})
+	if err != nil {
+		t.Fatal("Failed to change user role:", err)
+	}
+	if user.Role != models.UserRoleSupport {
+		t.Errorf("Expected role %v, got %v", models.UserRoleSupport, user.Role)
+	}
+
+	// Requests with tokens issued before the change are authorized with the new role
+	if role, err := service.GetUserRole(ctx, customer.ID); err != nil || role != models.UserRoleSupport {
+		t.Errorf("Expected current role %v, got %v (err %v)", models.UserRoleSupport, role, err)
+	}
+
+	// Test case 3: Admin cannot demote themselves
+	_, err = service.ChangeUserRole(ctx, auth.ChangeUserRoleInput{
+		ActorID: admin.ID,
+		UserID:  admin.ID,
+		Role:    models.UserRoleCustomer,
+	})
+	if _, ok := err.(errors.ValidationErrors); !ok {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+
+	// Test case 4: Invalid role
+	_, err = service.ChangeUserRole(ctx, auth.ChangeUserRoleInput{
+		ActorID: admin.ID,
+		UserID:  customer.ID,
+		Role:    "superuser",
+	})
+	if _, ok := err.(errors.ValidationErrors); !ok {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+}
+
+func TestUpdateBillingAddress(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	userRepo := newMockUserRepository()
+	service := auth.NewService(userRepo, newMockTokenRepository(), newMockJWTManager(), time.Hour, 24*time.Hour)
+
+	customer := &models.User{ID: uuid.New(), Email: "customer@example.com", Role: models.UserRoleCustomer}
+	if err := userRepo.Create(ctx, customer); err != nil {
+		t.Fatal("Failed to create test user:", err)
+	}
+
+	// Test case 1: Country and region codes are stored in upper case
+	user, err := service.UpdateBillingAddress(ctx, auth.UpdateBillingAddressInput{
+		UserID: customer.ID,
+		Address: models.Address{
+			Line1:      "1000 Rue Sherbrooke",
+			City:       "Montreal",
+			PostalCode: "H3A 3G4",
+			Region:     "qc",
+			Country:    " ca",
+		},
+	})
+	if err != nil {
+		t.Fatal("Failed to update billing address:", err)
+	}
+	if user.BillingAddress == nil || user.BillingAddress.Country != "CA" || user.BillingAddress.Region != "QC" {
+		t.Errorf("Expected a billing address in CA-QC, got %+v", user.BillingAddress)
+	}
+
+	// Test case 2: Country must be a two-letter code
+	_, err = service.UpdateBillingAddress(ctx, auth.UpdateBillingAddressInput{
+		UserID:  customer.ID,
+		Address: models.Address{Country: "Canada"},
+	})
+	if _, ok := err.(errors.ValidationErrors); !ok {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+
+	// Test case 3: Unknown user
+	_, err = service.UpdateBillingAddress(ctx, auth.UpdateBillingAddressInput{
+		UserID:  uuid.New(),
+		Address: models.Address{Country: "DE"},
+	})
+	if err != errors.ErrUserNotFound {
+		t.Errorf("Expected error %v, got %v", errors.ErrUserNotFound, err)
+	}
+}
+
+func TestBusinessProfile(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	userRepo := newMockUserRepository()
+	service := auth.NewService(userRepo, newMockTokenRepository(), newMockJWTManager(), time.Hour, 24*time.Hour)
+
+	customer := &models.User{ID: uuid.New(), Email: "customer@example.com", Role: models.UserRoleCustomer}
+	if err := userRepo.Create(ctx, customer); err != nil {
+		t.Fatal("Failed to create test user:", err)
+	}
+
+	// Test case 1: VAT IDs are stored without spaces and punctuation
+	user, err := service.UpdateBusinessProfile(ctx, auth.UpdateBusinessProfileInput{
+		UserID:      customer.ID,
+		CompanyName: " Example GmbH ",
+		VATID:       "de 136.695.976",
+	})
+	if err != nil {
+		t.Fatal("Failed to update business profile:", err)
+	}
+	if user.BusinessProfile == nil || user.BusinessProfile.CompanyName != "Example GmbH" || user.BusinessProfile.VATID != "DE136695976" {
+		t.Errorf("Expected Example GmbH with VAT ID DE136695976, got %+v", user.BusinessProfile)
+	}
+
+	// Test case 2: VAT IDs with a wrong check digit are rejected
+	_, err = service.UpdateBusinessProfile(ctx, auth.UpdateBusinessProfileInput{
+		UserID:      customer.ID,
+		CompanyName: "Example GmbH",
+		VATID:       "DE136695977",
+	})
+	if _, ok := err.(errors.ValidationErrors); !ok {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+
+	// Test case 3: Businesses without a VAT ID need a company name
+	_, err = service.UpdateBusinessProfile(ctx, auth.UpdateBusinessProfileInput{UserID: customer.ID})
+	if _, ok := err.(errors.ValidationErrors); !ok {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+
+	// Test case 4: Removing the profile makes the user a consumer again
+	user, err = service.RemoveBusinessProfile(ctx, customer.ID)
+	if err != nil {
+		t.Fatal("Failed to remove business profile:", err)
+	}
+	if user.BusinessProfile != nil {
+		t.Errorf("Expected no business profile, got %+v", user.BusinessProfile)
+	}
+
+	// Test case 5: Unknown user
+	_, err = service.RemoveBusinessProfile(ctx, uuid.New())
+	if err != errors.ErrUserNotFound {
+		t.Errorf("Expected error %v, got %v", errors.ErrUserNotFound, err)
+	}
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	userRepo := newMockUserRepository()
+	jwtManager := newMockJWTManager()
+	service := auth.NewService(userRepo, newMockTokenRepository(), jwtManager, time.Hour, 24*time.Hour)
+
+	input := auth.RegisterUserInput{
+		Email:    "admin@example.com",
+		Password: "password123",
+		Name:     "Admin",
+	}
+
+	// Test case 1: First admin is created when none exists
+	admin, err := service.BootstrapAdmin(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to bootstrap admin:", err)
+	}
+	if admin == nil || admin.Role != models.UserRoleAdmin {
+		t.Fatalf("Expected an admin user, got %+v", admin)
+	}
+
+	// Test case 2: Bootstrap is a no-op once an admin exists
+	input.Email = "another@example.com"
+	admin, err = service.BootstrapAdmin(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to bootstrap admin:", err)
+	}
+	if admin != nil {
+		t.Errorf("Expected no admin to be created, got %v", admin.Email)
+	}
+	if _, err := userRepo.GetByEmail(ctx, "another@example.com"); err != errors.ErrUserNotFound {
+		t.Errorf("Expected user not to be created, got %v", err)
+	}
+
+	// Test case 3: An existing user is only promoted with their password
+	userRepo = newMockUserRepository()
+	service = auth.NewService(userRepo, newMockTokenRepository(), jwtManager, time.Hour, 24*time.Hour)
+	existing := &models.User{
+		ID:       uuid.New(),
+		Email:    "admin@example.com",
+		Password: hashPassword("someone-elses"),
+		Role:     models.UserRoleCustomer,
+	}
+	if err := userRepo.Create(ctx, existing); err != nil {
+		t.Fatal("Failed to create user:", err)
+	}
+
+	input.Email = existing.Email
+	if _, err := service.BootstrapAdmin(ctx, input); err != errors.ErrInvalidCredentials {
+		t.Errorf("Expected error %v, got %v", errors.ErrInvalidCredentials, err)
+	}
+	if user, _ := userRepo.GetByID(ctx, existing.ID); user.Role != models.UserRoleCustomer {
+		t.Errorf("Expected the user to stay a customer, got %v", user.Role)
+	}
+
+	input.Password = "someone-elses"
+	admin, err = service.BootstrapAdmin(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to bootstrap admin:", err)
+	}
+	if admin == nil || admin.ID != existing.ID || admin.Role != models.UserRoleAdmin {
+		t.Errorf("Expected user %s to be promoted, got %+v", existing.ID, admin)
+	}
+}
+
+func createLoggedInUser(t *testing.T, service *auth.Service, userRepo *mockUserRepository) *auth.LoginResponse {
+	t.Helper()
+	ctx := context.Background()
+
+	testUser := &models.User{
+		ID:       uuid.New(),
+		Email:    "test@example.com",
+		Password: hashPassword("password123"),
+		Name:     "Test User",
+		Role:     models.UserRoleCustomer,
+	}
+	if err := userRepo.Create(ctx, testUser); err != nil {
+		t.Fatal("Failed to create test user:", err)
+	}
+
+	response, err := service.LoginUser(ctx, auth.LoginUserInput{
+		Email:    "test@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatal("Failed to login user:", err)
+	}
+
+	return response
+}
+
+func TestRefreshTokens(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	userRepo := newMockUserRepository()
+	tokenRepo := newMockTokenRepository()
+	service := auth.NewService(userRepo, tokenRepo, newMockJWTManager(), time.Hour, 24*time.Hour)
+
+	login := createLoggedInUser(t, service, userRepo)
+	if login.RefreshToken == "" {
+		t.Fatal("Expected refresh token to be non-empty")
+	}
+
+	// Test case 1: Refresh returns a new access token and a rotated refresh token
+	refreshed, err := service.RefreshTokens(ctx, login.RefreshToken)
+	if err != nil {
+		t.Fatal("Failed to refresh tokens:", err)
+	}
+
+	if refreshed.Token == "" {
+		t.Error("Expected access token to be non-empty")
+	}
+
+	if refreshed.RefreshToken == login.RefreshToken {
+		t.Error("Expected refresh token to be rotated")
+	}
+
+	// Raw tokens must never be stored
+	for _, token := range tokenRepo.refreshTokens {
+		if token.TokenHash == login.RefreshToken || token.TokenHash == refreshed.RefreshToken {
+			t.Error("Expected refresh tokens to be stored hashed")
+		}
+	}
+
+	// Test case 2: Unknown refresh token
+	_, err = service.RefreshTokens(ctx, "not-a-token")
+	if err != errors.ErrInvalidRefreshToken {
+		t.Errorf("Expected error %v, got %v", errors.ErrInvalidRefreshToken, err)
+	}
+
+	// Test case 3: Expired refresh token
+	for _, token := range tokenRepo.refreshTokens {
+		if token.RevokedAt == nil {
+			token.ExpiresAt = time.Now().Add(-time.Minute)
+		}
+	}
+	_, err = service.RefreshTokens(ctx, refreshed.RefreshToken)
+	if err != errors.ErrInvalidRefreshToken {
+		t.Errorf("Expected error %v, got %v", errors.ErrInvalidRefreshToken, err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	userRepo := newMockUserRepository()
+	tokenRepo := newMockTokenRepository()
+	service := auth.NewService(userRepo, tokenRepo, newMockJWTManager(), time.Hour, 24*time.Hour)
+
+	login := createLoggedInUser(t, service, userRepo)
+
+	refreshed, err := service.RefreshTokens(ctx, login.RefreshToken)
+	if err != nil {
+		t.Fatal("Failed to refresh tokens:", err)
+	}
+
+	// Replaying the original token is detected as reuse
+	_, err = service.RefreshTokens(ctx, login.RefreshToken)
+	if err != errors.ErrRefreshTokenReused {
+		t.Errorf("Expected error %v, got %v", errors.ErrRefreshTokenReused, err)
+	}
+
+	// The legitimately rotated token is revoked along with the rest of the family
+	_, err = service.RefreshTokens(ctx, refreshed.RefreshToken)
+	if err != errors.ErrRefreshTokenReused {
+		t.Errorf("Expected error %v, got %v", errors.ErrRefreshTokenReused, err)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	userRepo := newMockUserRepository()
+	tokenRepo := newMockTokenRepository()
+	jwtManager := newMockJWTManager()
+	service := auth.NewService(userRepo, tokenRepo, jwtManager, time.Hour, 24*time.Hour)
+
+	login := createLoggedInUser(t, service, userRepo)
+
+	claims, err := jwtManager.ValidateToken(login.Token)
+	if err != nil {
+		t.Fatal("Failed to validate token:", err)
+	}
+
+	// Test case 1: Refresh token belonging to another user is rejected
+	err = service.Logout(ctx, auth.LogoutInput{
+		UserID:       uuid.New(),
+		RefreshToken: login.RefreshToken,
+	})
+	if err != errors.ErrInvalidRefreshToken {
+		t.Errorf("Expected error %v, got %v", errors.ErrInvalidRefreshToken, err)
+	}
+
+	// Test case 2: Logout revokes the access token and the refresh token
+	err = service.Logout(ctx, auth.LogoutInput{
+		UserID:         claims.UserID,
+		TokenID:        claims.ID,
+		TokenExpiresAt: claims.ExpiresAt.Time,
+		RefreshToken:   login.RefreshToken,
+	})
+	if err != nil {
+		t.Fatal("Failed to logout:", err)
+	}
+
+	revoked, err := service.IsTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		t.Fatal("Failed to check revocation:", err)
+	}
+	if !revoked {
+		t.Error("Expected access token to be revoked")
+	}
+
+	_, err = service.RefreshTokens(ctx, login.RefreshToken)
+	if err == nil {
+		t.Error("Expected refresh to fail after logout")
+	}
+}
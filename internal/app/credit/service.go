@@ -0,0 +1,143 @@
+package credit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/ledger"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// maxNoteLength limits the note an admin leaves on granted credit
+const maxNoteLength = 1000
+
+// Service manages the users' credit balances. Credit is spent by the subscription
+// service, which pays invoices from the balance before charging the payment method.
+type Service struct {
+	repo     repository.CreditRepository
+	userRepo repository.UserRepository
+	uow      repository.UnitOfWork
+}
+
+func NewService(repo repository.CreditRepository, userRepo repository.UserRepository, uow repository.UnitOfWork) *Service {
+	return &Service{
+		repo:     repo,
+		userRepo: userRepo,
+		uow:      uow,
+	}
+}
+
+// Balance is a user's credit balances by currency with the entries that make them up,
+// most recent first
+type Balance struct {
+	UserID   uuid.UUID
+	Balances map[string]decimal.Decimal
+	Entries  []*models.CreditEntry
+}
+
+func (s *Service) GetBalance(ctx context.Context, userID uuid.UUID) (*Balance, error) {
+	balances, err := s.repo.GetBalances(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credit balance: %w", err)
+	}
+
+	entries, err := s.repo.GetEntries(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credit entries: %w", err)
+	}
+
+	return &Balance{
+		UserID:   userID,
+		Balances: balances,
+		Entries:  entries,
+	}, nil
+}
+
+type GrantInput struct {
+	UserID    uuid.UUID
+	Amount    decimal.Decimal
+	Currency  string
+	Note      string
+	GrantedBy uuid.UUID
+}
+
+func (i *GrantInput) Validate() errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	if i.UserID == uuid.Nil {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "user_id",
+			Message: "must not be empty",
+		})
+	}
+
+	if !currency.Valid(i.Currency) {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "currency",
+			Message: "must be a supported ISO 4217 currency code",
+		})
+	} else if !currency.Round(i.Amount, i.Currency).IsPositive() {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "amount",
+			Message: fmt.Sprintf("must be at least one minor unit of %s", i.Currency),
+		})
+	}
+
+	if strings.TrimSpace(i.Note) == "" {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "note",
+			Message: "must not be empty",
+		})
+	} else if len(i.Note) > maxNoteLength {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "note",
+			Message: fmt.Sprintf("must not be longer than %d characters", maxNoteLength),
+		})
+	}
+
+	return validationErrors
+}
+
+// Grant adds credit to a user's balance in the input's currency, e.g. as a goodwill
+// gesture. It is used up by the user's next charges in that currency.
+func (s *Service) Grant(ctx context.Context, input GrantInput) (*models.CreditEntry, error) {
+	input.Currency = currency.Normalize(input.Currency)
+
+	// Validate input
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	if _, err := s.userRepo.GetByID(ctx, input.UserID); err != nil {
+		return nil, err
+	}
+
+	entry := &models.CreditEntry{
+		ID:        uuid.New(),
+		UserID:    input.UserID,
+		Type:      models.CreditEntryTypeCredit,
+		Amount:    currency.Round(input.Amount, input.Currency),
+		Currency:  input.Currency,
+		Reason:    models.CreditEntryReasonGrant,
+		Note:      strings.TrimSpace(input.Note),
+		CreatedBy: &input.GrantedBy,
+	}
+
+	err := s.uow.Do(ctx, func(tx repository.Transaction) error {
+		if err := tx.Credits().AddEntry(ctx, entry); err != nil {
+			return fmt.Errorf("failed to grant credit: %w", err)
+		}
+		return ledger.Post(ctx, tx.Ledger(), ledger.CreditGrantEntry(entry))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
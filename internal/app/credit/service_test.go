@@ -0,0 +1,278 @@
+package credit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/credit"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// mockCreditRepository keeps the balances like the database, never below zero
+type mockCreditRepository struct {
+	balances map[uuid.UUID]map[string]decimal.Decimal
+	entries  []*models.CreditEntry
+}
+
+func newMockCreditRepository() *mockCreditRepository {
+	return &mockCreditRepository{balances: make(map[uuid.UUID]map[string]decimal.Decimal)}
+}
+
+func (m *mockCreditRepository) GetBalance(ctx context.Context, userID uuid.UUID, currency string) (decimal.Decimal, error) {
+	return m.balances[userID][currency], nil
+}
+
+func (m *mockCreditRepository) GetBalances(ctx context.Context, userID uuid.UUID) (map[string]decimal.Decimal, error) {
+	balances := make(map[string]decimal.Decimal)
+	for currency, balance := range m.balances[userID] {
+		balances[currency] = balance
+	}
+	return balances, nil
+}
+
+func (m *mockCreditRepository) AddEntry(ctx context.Context, entry *models.CreditEntry) error {
+	change := entry.Amount
+	if entry.Type == models.CreditEntryTypeDebit {
+		change = change.Neg()
+	}
+
+	balance := m.balances[entry.UserID][entry.Currency].Add(change)
+	if balance.IsNegative() {
+		return errors.ErrInsufficientCredit
+	}
+
+	if m.balances[entry.UserID] == nil {
+		m.balances[entry.UserID] = make(map[string]decimal.Decimal)
+	}
+	m.balances[entry.UserID][entry.Currency] = balance
+	entry.BalanceAfter = balance
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *mockCreditRepository) GetEntries(ctx context.Context, userID uuid.UUID) ([]*models.CreditEntry, error) {
+	var result []*models.CreditEntry
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		if m.entries[i].UserID == userID {
+			result = append(result, m.entries[i])
+		}
+	}
+	return result, nil
+}
+
+// mockLedgerRepository records the posted journal entries
+type mockLedgerRepository struct {
+	entries []*models.JournalEntry
+}
+
+func (m *mockLedgerRepository) Post(ctx context.Context, entry *models.JournalEntry) error {
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *mockLedgerRepository) GetDeferredRevenue(ctx context.Context, invoiceID uuid.UUID) (decimal.Decimal, error) {
+	return decimal.Zero, nil
+}
+
+func (m *mockLedgerRepository) GetDueDeferredRevenue(ctx context.Context, end time.Time, limit int) ([]*models.DeferredRevenue, error) {
+	return nil, nil
+}
+
+func (m *mockLedgerRepository) GetAccountTotals(ctx context.Context, asOf time.Time) ([]*models.AccountTotals, error) {
+	return nil, nil
+}
+
+func (m *mockLedgerRepository) GetUnbalancedEntries(ctx context.Context) ([]uuid.UUID, error) {
+	return nil, nil
+}
+
+// mockUnitOfWork runs the function against the mock repositories without a real transaction
+type mockUnitOfWork struct {
+	credits *mockCreditRepository
+	ledger  *mockLedgerRepository
+}
+
+func (m *mockUnitOfWork) Do(ctx context.Context, fn func(tx repository.Transaction) error) error {
+	return fn(m)
+}
+
+func (m *mockUnitOfWork) Subscriptions() repository.SubscriptionRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Vouchers() repository.VoucherRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Campaigns() repository.CampaignRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Invoices() repository.InvoiceRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Payments() repository.PaymentRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) CreditNotes() repository.CreditNoteRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Credits() repository.CreditRepository {
+	return m.credits
+}
+
+func (m *mockUnitOfWork) Ledger() repository.LedgerRepository {
+	return m.ledger
+}
+
+type mockUserRepository struct {
+	users map[uuid.UUID]*models.User
+}
+
+func (m *mockUserRepository) Create(ctx context.Context, user *models.User) error {
+	m.users[user.ID] = user
+	return nil
+}
+
+func (m *mockUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if user, ok := m.users[id]; ok {
+		return user, nil
+	}
+	return nil, errors.ErrUserNotFound
+}
+
+func (m *mockUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return nil, errors.ErrUserNotFound
+}
+
+func (m *mockUserRepository) Update(ctx context.Context, user *models.User) error {
+	return nil
+}
+
+func (m *mockUserRepository) CountByRole(ctx context.Context, role models.UserRole) (int, error) {
+	return 0, nil
+}
+
+func TestGrant(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	repo := newMockCreditRepository()
+	userRepo := &mockUserRepository{users: make(map[uuid.UUID]*models.User)}
+	ledgerRepo := &mockLedgerRepository{}
+	service := credit.NewService(repo, userRepo, &mockUnitOfWork{credits: repo, ledger: ledgerRepo})
+
+	user := &models.User{ID: uuid.New(), Email: "user@example.com"}
+	userRepo.Create(ctx, user)
+	adminID := uuid.New()
+
+	// Test case 1: Granted credit is added to the balance and recorded
+	entry, err := service.Grant(ctx, credit.GrantInput{
+		UserID:    user.ID,
+		Amount:    decimal.NewFromFloat(10.005),
+		Currency:  "eur",
+		Note:      "  Sorry for the outage ",
+		GrantedBy: adminID,
+	})
+	if err != nil {
+		t.Fatal("Failed to grant credit:", err)
+	}
+
+	if entry.Type != models.CreditEntryTypeCredit || entry.Reason != models.CreditEntryReasonGrant ||
+		!entry.Amount.Equal(decimal.NewFromFloat(10.01)) || entry.Currency != "EUR" {
+		t.Errorf("Expected a granted credit of 10.01 EUR, got %v %v of %s %s", entry.Type, entry.Reason, entry.Amount, entry.Currency)
+	}
+
+	if entry.Note != "Sorry for the outage" || entry.CreatedBy == nil || *entry.CreatedBy != adminID {
+		t.Errorf("Expected the trimmed note and the granting admin, got %q by %v", entry.Note, entry.CreatedBy)
+	}
+
+	if len(ledgerRepo.entries) != 1 || ledgerRepo.entries[0].Type != models.JournalEntryTypeCreditGrant ||
+		!ledgerRepo.entries[0].IsBalanced() || ledgerRepo.entries[0].ReferenceID != entry.ID {
+		t.Errorf("Expected a balanced credit grant journal entry, got %v", ledgerRepo.entries)
+	}
+
+	// Test case 2: The balance lists its entries, most recent first
+	if _, err := service.Grant(ctx, credit.GrantInput{
+		UserID:    user.ID,
+		Amount:    decimal.NewFromInt(5),
+		Currency:  "EUR",
+		Note:      "Referral bonus",
+		GrantedBy: adminID,
+	}); err != nil {
+		t.Fatal("Failed to grant credit:", err)
+	}
+
+	balance, err := service.GetBalance(ctx, user.ID)
+	if err != nil {
+		t.Fatal("Failed to get balance:", err)
+	}
+
+	if !balance.Balances["EUR"].Equal(decimal.NewFromFloat(15.01)) {
+		t.Errorf("Expected balance 15.01, got %s", balance.Balances["EUR"])
+	}
+
+	if len(balance.Entries) != 2 || balance.Entries[0].Note != "Referral bonus" ||
+		!balance.Entries[0].BalanceAfter.Equal(balance.Balances["EUR"]) {
+		t.Errorf("Expected 2 entries, the referral bonus first, got %d", len(balance.Entries))
+	}
+
+	// Test case 3: Credit in another currency is kept in a balance of its own
+	if _, err := service.Grant(ctx, credit.GrantInput{
+		UserID:    user.ID,
+		Amount:    decimal.NewFromFloat(500.4),
+		Currency:  "JPY",
+		Note:      "Goodwill",
+		GrantedBy: adminID,
+	}); err != nil {
+		t.Fatal("Failed to grant credit:", err)
+	}
+
+	balance, err = service.GetBalance(ctx, user.ID)
+	if err != nil {
+		t.Fatal("Failed to get balance:", err)
+	}
+
+	if len(balance.Balances) != 2 || !balance.Balances["JPY"].Equal(decimal.NewFromInt(500)) ||
+		!balance.Balances["EUR"].Equal(decimal.NewFromFloat(15.01)) {
+		t.Errorf("Expected balances of 15.01 EUR and 500 JPY, got %v", balance.Balances)
+	}
+
+	// Test case 4: Credit must be positive, in a supported currency and explained
+	_, err = service.Grant(ctx, credit.GrantInput{UserID: user.ID, Amount: decimal.NewFromFloat(0.001), Currency: "EUR", GrantedBy: adminID})
+	validationErrors, ok := err.(errors.ValidationErrors)
+	if !ok || len(validationErrors) != 2 {
+		t.Errorf("Expected validation errors for amount and note, got %v", err)
+	}
+
+	_, err = service.Grant(ctx, credit.GrantInput{UserID: user.ID, Amount: decimal.NewFromInt(5), Currency: "XXX", Note: "Goodwill", GrantedBy: adminID})
+	validationErrors, ok = err.(errors.ValidationErrors)
+	if !ok || len(validationErrors) != 1 || validationErrors[0].Field != "currency" {
+		t.Errorf("Expected a validation error for currency, got %v", err)
+	}
+
+	// Test case 5: Credit cannot be granted to an unknown user
+	_, err = service.Grant(ctx, credit.GrantInput{
+		UserID:    uuid.New(),
+		Amount:    decimal.NewFromInt(5),
+		Currency:  "EUR",
+		Note:      "Goodwill",
+		GrantedBy: adminID,
+	})
+	if err != errors.ErrUserNotFound {
+		t.Errorf("Expected error %v, got %v", errors.ErrUserNotFound, err)
+	}
+
+	// Test case 6: A user without credit has no balances
+	balance, err = service.GetBalance(ctx, uuid.New())
+	if err != nil || len(balance.Balances) != 0 || len(balance.Entries) != 0 {
+		t.Errorf("Expected an empty balance, got %v (%v)", balance, err)
+	}
+}
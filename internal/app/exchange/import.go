@@ -0,0 +1,129 @@
+package exchange
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
+	"github.com/shopspring/decimal"
+)
+
+// ecbBase is the currency the ECB's reference rates are quoted against
+const ecbBase = "EUR"
+
+// csvHeader is the header CSV rate files must start with
+var csvHeader = []string{"date", "base", "currency", "rate"}
+
+func parseFile(path string, parse func(io.Reader) ([]*models.ExchangeRate, error)) ([]*models.ExchangeRate, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open exchange rate file: %w", err)
+	}
+	defer file.Close()
+
+	rates, err := parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rate file %s: %w", path, err)
+	}
+	return rates, nil
+}
+
+// ParseCSV reads rates from CSV with the columns date, base, currency and rate, e.g.
+// "2025-03-03,EUR,USD,1.0465" for 1 EUR = 1.0465 USD. Dates are in the YYYY-MM-DD
+// format.
+func ParseCSV(r io.Reader) ([]*models.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(csvHeader)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	for i, column := range csvHeader {
+		if strings.ToLower(strings.TrimSpace(header[i])) != column {
+			return nil, fmt.Errorf("expected the header %s", strings.Join(csvHeader, ","))
+		}
+	}
+
+	var rates []*models.ExchangeRate
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		rate, err := parseRate(record[0], record[1], record[2], record[3], "csv")
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
+
+// ecbEnvelope is the format of the ECB's euro foreign exchange reference rates, e.g.
+// https://www.ecb.europa.eu/stats/eurofxref/eurofxref-hist.xml. The daily, 90 day and
+// full history files all have it.
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// ParseECB reads the ECB's euro foreign exchange reference rates, which give the value
+// of 1 EUR in each currency
+func ParseECB(r io.Reader) ([]*models.ExchangeRate, error) {
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&envelope); err != nil {
+		return nil, err
+	}
+
+	var rates []*models.ExchangeRate
+	for _, day := range envelope.Days {
+		for _, entry := range day.Rates {
+			rate, err := parseRate(day.Time, ecbBase, entry.Currency, entry.Rate, "ecb")
+			if err != nil {
+				return nil, fmt.Errorf("rate of %s on %s: %w", entry.Currency, day.Time, err)
+			}
+			rates = append(rates, rate)
+		}
+	}
+
+	return rates, nil
+}
+
+func parseRate(date, base, quote, value, source string) (*models.ExchangeRate, error) {
+	day, err := time.Parse("2006-01-02", strings.TrimSpace(date))
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+	}
+
+	rate, err := decimal.NewFromString(strings.TrimSpace(value))
+	if err != nil || !rate.IsPositive() {
+		return nil, fmt.Errorf("invalid rate %q, expected a positive number", value)
+	}
+
+	return &models.ExchangeRate{
+		Date:     day,
+		Base:     currency.Normalize(base),
+		Currency: currency.Normalize(quote),
+		Rate:     rate,
+		Source:   source,
+	}, nil
+}
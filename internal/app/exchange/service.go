@@ -0,0 +1,213 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
+	"github.com/shopspring/decimal"
+)
+
+// maxRateAge is how much older than a day the latest rate may be to still be valid
+// on it. No rates are published on weekends and public holidays.
+const maxRateAge = 7 * 24 * time.Hour
+
+// rateDecimals is the precision of derived rates, which the database also stores
+const rateDecimals = 10
+
+// Service keeps the exchange rates and converts amounts to the reporting currency,
+// the currency finance reports all revenue in
+type Service struct {
+	repo              repository.ExchangeRateRepository
+	reportingCurrency string
+	// baseCurrency is the currency imported rates are quoted against, e.g. EUR for ECB
+	// rates. Amounts are converted through it when there is no rate between their
+	// currency and the reporting currency.
+	baseCurrency string
+}
+
+func NewService(repo repository.ExchangeRateRepository, reportingCurrency, baseCurrency string) *Service {
+	return &Service{
+		repo:              repo,
+		reportingCurrency: reportingCurrency,
+		baseCurrency:      baseCurrency,
+	}
+}
+
+// ReportingCurrency returns the currency amounts are converted to
+func (s *Service) ReportingCurrency() string {
+	return s.reportingCurrency
+}
+
+// Rate returns the rate an amount in the currency is converted to the reporting
+// currency with on the day of on: the latest rate on or before that day. It returns
+// ErrExchangeRateNotFound if no such rate has been imported.
+func (s *Service) Rate(ctx context.Context, currencyCode string, on time.Time) (*models.ExchangeRateSnapshot, error) {
+	day := startOfDay(on)
+	if currencyCode == s.reportingCurrency {
+		return &models.ExchangeRateSnapshot{
+			ReportingCurrency: s.reportingCurrency,
+			Rate:              decimal.NewFromInt(1),
+			Date:              day,
+		}, nil
+	}
+
+	rate, date, err := s.pairRate(ctx, currencyCode, s.reportingCurrency, day)
+	if err == errors.ErrExchangeRateNotFound && currencyCode != s.baseCurrency && s.reportingCurrency != s.baseCurrency {
+		rate, date, err = s.crossRate(ctx, currencyCode, day)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ExchangeRateSnapshot{
+		ReportingCurrency: s.reportingCurrency,
+		Rate:              rate,
+		Date:              date,
+	}, nil
+}
+
+// RecordRate returns the rate a financial record in the currency is converted with:
+// the rate stored with it, or the rate valid on its date if it has none or its rate
+// is for another reporting currency
+func (s *Service) RecordRate(ctx context.Context, stored *models.ExchangeRateSnapshot, currencyCode string, on time.Time) (*models.ExchangeRateSnapshot, error) {
+	if stored != nil && stored.ReportingCurrency == s.reportingCurrency {
+		return stored, nil
+	}
+	return s.Rate(ctx, currencyCode, on)
+}
+
+// Convert returns an amount in the currency in the reporting currency, at the rate
+// valid on the day of on, together with the rate
+func (s *Service) Convert(ctx context.Context, amount decimal.Decimal, currencyCode string, on time.Time) (decimal.Decimal, *models.ExchangeRateSnapshot, error) {
+	rate, err := s.Rate(ctx, currencyCode, on)
+	if err != nil {
+		return decimal.Zero, nil, err
+	}
+	return rate.Convert(amount), rate, nil
+}
+
+// pairRate returns the value of one unit of from in to on the day, from the latest
+// rate from from to to or from to to from. It returns the day of the rate.
+func (s *Service) pairRate(ctx context.Context, from, to string, day time.Time) (decimal.Decimal, time.Time, error) {
+	direct, err := s.repo.GetLatest(ctx, from, to, day)
+	if err != nil && err != errors.ErrExchangeRateNotFound {
+		return decimal.Zero, time.Time{}, fmt.Errorf("failed to get exchange rate: %w", err)
+	}
+
+	inverse, err := s.repo.GetLatest(ctx, to, from, day)
+	if err != nil && err != errors.ErrExchangeRateNotFound {
+		return decimal.Zero, time.Time{}, fmt.Errorf("failed to get exchange rate: %w", err)
+	}
+
+	// The more recent of the two is the rate in force
+	switch {
+	case direct != nil && (inverse == nil || !inverse.Date.After(direct.Date)):
+		if day.Sub(direct.Date) <= maxRateAge {
+			return direct.Rate, direct.Date, nil
+		}
+	case inverse != nil:
+		if day.Sub(inverse.Date) <= maxRateAge {
+			return decimal.NewFromInt(1).DivRound(inverse.Rate, rateDecimals), inverse.Date, nil
+		}
+	}
+
+	return decimal.Zero, time.Time{}, errors.ErrExchangeRateNotFound
+}
+
+// crossRate returns the value of one unit of the currency in the reporting currency
+// on the day through the base currency. The day of the older of the two rates is
+// returned.
+func (s *Service) crossRate(ctx context.Context, currencyCode string, day time.Time) (decimal.Decimal, time.Time, error) {
+	toBase, toBaseDate, err := s.pairRate(ctx, currencyCode, s.baseCurrency, day)
+	if err != nil {
+		return decimal.Zero, time.Time{}, err
+	}
+
+	fromBase, fromBaseDate, err := s.pairRate(ctx, s.baseCurrency, s.reportingCurrency, day)
+	if err != nil {
+		return decimal.Zero, time.Time{}, err
+	}
+
+	date := toBaseDate
+	if fromBaseDate.Before(date) {
+		date = fromBaseDate
+	}
+
+	return toBase.Mul(fromBase).Round(rateDecimals), date, nil
+}
+
+// GetRatesByDate returns the rates imported for the day of date
+func (s *Service) GetRatesByDate(ctx context.Context, date time.Time) ([]*models.ExchangeRate, error) {
+	return s.repo.GetByDate(ctx, startOfDay(date))
+}
+
+// Import saves rates, replacing the rates already imported for the same currencies and
+// days. Rates of currencies amounts cannot be in are skipped, and of rates repeated
+// for the same currencies and day the last one is kept. It returns the number of rates
+// saved.
+func (s *Service) Import(ctx context.Context, rates []*models.ExchangeRate) (int, error) {
+	type key struct {
+		base, currency string
+		date           time.Time
+	}
+
+	positions := make(map[key]int)
+	var unique []*models.ExchangeRate
+	for _, rate := range rates {
+		if !currency.Valid(rate.Base) || !currency.Valid(rate.Currency) || rate.Base == rate.Currency {
+			continue
+		}
+		rate.Date = startOfDay(rate.Date)
+
+		k := key{rate.Base, rate.Currency, rate.Date}
+		if i, ok := positions[k]; ok {
+			unique[i] = rate
+			continue
+		}
+		positions[k] = len(unique)
+		unique = append(unique, rate)
+	}
+
+	if len(unique) == 0 {
+		return 0, nil
+	}
+
+	if err := s.repo.Save(ctx, unique); err != nil {
+		return 0, fmt.Errorf("failed to save exchange rates: %w", err)
+	}
+
+	return len(unique), nil
+}
+
+// ImportFile imports the rates in a local file: a CSV file if its name ends in .csv,
+// or an ECB reference rates file if it ends in .xml
+func (s *Service) ImportFile(ctx context.Context, path string) (int, error) {
+	parse := ParseCSV
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+	case ".xml":
+		parse = ParseECB
+	default:
+		return 0, fmt.Errorf("unsupported exchange rate file %q, expected a .csv or .xml file", path)
+	}
+
+	rates, err := parseFile(path, parse)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.Import(ctx, rates)
+}
+
+// startOfDay returns midnight UTC of the day of t
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
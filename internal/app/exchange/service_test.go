@@ -0,0 +1,219 @@
+package exchange_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/exchange"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/shopspring/decimal"
+)
+
+type mockExchangeRateRepository struct {
+	rates []*models.ExchangeRate
+}
+
+func (m *mockExchangeRateRepository) Save(ctx context.Context, rates []*models.ExchangeRate) error {
+	m.rates = append(m.rates, rates...)
+	return nil
+}
+
+func (m *mockExchangeRateRepository) GetLatest(ctx context.Context, base, currency string, on time.Time) (*models.ExchangeRate, error) {
+	var latest *models.ExchangeRate
+	for _, rate := range m.rates {
+		if rate.Base == base && rate.Currency == currency && !rate.Date.After(on) && (latest == nil || rate.Date.After(latest.Date)) {
+			latest = rate
+		}
+	}
+	if latest == nil {
+		return nil, errors.ErrExchangeRateNotFound
+	}
+	return latest, nil
+}
+
+func (m *mockExchangeRateRepository) GetByDate(ctx context.Context, date time.Time) ([]*models.ExchangeRate, error) {
+	var result []*models.ExchangeRate
+	for _, rate := range m.rates {
+		if rate.Date.Equal(date) {
+			result = append(result, rate)
+		}
+	}
+	return result, nil
+}
+
+func day(value string) time.Time {
+	date, _ := time.Parse("2006-01-02", value)
+	return date
+}
+
+func rate(date, base, currency, value string) *models.ExchangeRate {
+	return &models.ExchangeRate{
+		Date:     day(date),
+		Base:     base,
+		Currency: currency,
+		Rate:     decimal.RequireFromString(value),
+		Source:   "csv",
+	}
+}
+
+func TestRate(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	repo := &mockExchangeRateRepository{rates: []*models.ExchangeRate{
+		rate("2025-03-03", "EUR", "USD", "1.25"),
+		rate("2025-03-05", "EUR", "USD", "1.2"),
+		rate("2025-03-05", "EUR", "JPY", "160"),
+		rate("2025-03-04", "EUR", "GBP", "0.8"),
+	}}
+
+	tests := []struct {
+		name      string
+		reporting string
+		currency  string
+		on        time.Time
+		expected  string
+		date      string
+		err       error
+	}{
+		// Test case 1: The latest rate on or before the day is used
+		{"direct", "USD", "EUR", time.Date(2025, 3, 4, 15, 0, 0, 0, time.UTC), "1.25", "2025-03-03", nil},
+		{"direct latest", "USD", "EUR", day("2025-03-09"), "1.2", "2025-03-05", nil},
+		// Test case 2: Rates quoted the other way around are inverted
+		{"inverse", "EUR", "USD", day("2025-03-05"), "0.8333333333", "2025-03-05", nil},
+		// Test case 3: Other currencies are converted through the base currency, as of
+		// the older of the two rates
+		{"cross", "GBP", "USD", day("2025-03-06"), "0.6666666666", "2025-03-04", nil},
+		// Test case 4: Amounts in the reporting currency are not converted
+		{"same", "EUR", "EUR", day("2020-01-01"), "1", "2020-01-01", nil},
+		// Test case 5: Rates older than a week are not used
+		{"stale", "USD", "EUR", day("2025-03-13"), "", "", errors.ErrExchangeRateNotFound},
+		{"before first", "USD", "EUR", day("2025-03-02"), "", "", errors.ErrExchangeRateNotFound},
+		{"unknown", "EUR", "CHF", day("2025-03-05"), "", "", errors.ErrExchangeRateNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := exchange.NewService(repo, tt.reporting, "EUR")
+
+			snapshot, err := service.Rate(ctx, tt.currency, tt.on)
+			if err != tt.err {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if tt.err != nil {
+				return
+			}
+
+			if snapshot.ReportingCurrency != tt.reporting {
+				t.Errorf("Expected a rate to %s, got %s", tt.reporting, snapshot.ReportingCurrency)
+			}
+			if !snapshot.Rate.Equal(decimal.RequireFromString(tt.expected)) {
+				t.Errorf("Expected a rate of %s, got %s", tt.expected, snapshot.Rate)
+			}
+			if !snapshot.Date.Equal(day(tt.date)) {
+				t.Errorf("Expected the rate of %s, got %s", tt.date, snapshot.Date.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	repo := &mockExchangeRateRepository{rates: []*models.ExchangeRate{
+		rate("2025-03-05", "EUR", "JPY", "160"),
+	}}
+	service := exchange.NewService(repo, "JPY", "EUR")
+
+	// Test case 1: Converted amounts are rounded to the reporting currency
+	converted, snapshot, err := service.Convert(ctx, decimal.RequireFromString("19.99"), "EUR", day("2025-03-05"))
+	if err != nil {
+		t.Fatal("Failed to convert:", err)
+	}
+	if !converted.Equal(decimal.NewFromInt(3198)) {
+		t.Errorf("Expected 3198 JPY, got %s", converted)
+	}
+
+	// Test case 2: A record's stored rate is used over the current one
+	recorded, err := service.RecordRate(ctx, &models.ExchangeRateSnapshot{
+		ReportingCurrency: "JPY",
+		Rate:              decimal.NewFromInt(150),
+		Date:              day("2025-01-02"),
+	}, "EUR", day("2025-03-05"))
+	if err != nil || !recorded.Rate.Equal(decimal.NewFromInt(150)) {
+		t.Errorf("Expected the stored rate of 150, got %+v (%v)", recorded, err)
+	}
+
+	// Test case 3: A rate stored for another reporting currency is not
+	recorded, err = service.RecordRate(ctx, &models.ExchangeRateSnapshot{
+		ReportingCurrency: "USD",
+		Rate:              decimal.RequireFromString("1.05"),
+	}, "EUR", day("2025-03-05"))
+	if err != nil || !recorded.Rate.Equal(snapshot.Rate) {
+		t.Errorf("Expected the rate of the day, got %+v (%v)", recorded, err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+
+	// Test case 1: CSV files have a header and a rate per line
+	rates, err := exchange.ParseCSV(strings.NewReader("date,base,currency,rate\n2025-03-03,eur,USD,1.0465\n2025-03-03,EUR,JPY, 157.12\n"))
+	if err != nil {
+		t.Fatal("Failed to parse CSV:", err)
+	}
+	if len(rates) != 2 || rates[0].Base != "EUR" || rates[0].Currency != "USD" || !rates[0].Rate.Equal(decimal.RequireFromString("1.0465")) {
+		t.Fatalf("Expected the EUR rates of USD and JPY, got %+v", rates)
+	}
+
+	_, err = exchange.ParseCSV(strings.NewReader("date,base,currency,rate\n2025-03-03,EUR,USD,-1\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error on line 2, got %v", err)
+	}
+
+	_, err = exchange.ParseCSV(strings.NewReader("day,from,to,rate\n"))
+	if err == nil {
+		t.Error("Expected an error for an unknown header")
+	}
+
+	// Test case 2: ECB files quote all currencies against EUR
+	ecb := `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2025-03-04">
+			<Cube currency="USD" rate="1.0557"/>
+			<Cube currency="JPY" rate="157.12"/>
+		</Cube>
+		<Cube time="2025-03-03">
+			<Cube currency="USD" rate="1.0465"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+	ecbRates, err := exchange.ParseECB(strings.NewReader(ecb))
+	if err != nil {
+		t.Fatal("Failed to parse ECB rates:", err)
+	}
+	if len(ecbRates) != 3 || ecbRates[1].Currency != "JPY" || !ecbRates[2].Date.Equal(day("2025-03-03")) || ecbRates[2].Source != "ecb" {
+		t.Fatalf("Expected 3 ECB rates, got %+v", ecbRates)
+	}
+
+	// Test case 3: Unsupported currencies are skipped and repeated rates replaced
+	repo := &mockExchangeRateRepository{}
+	service := exchange.NewService(repo, "EUR", "EUR")
+
+	imported, err := service.Import(ctx, append(rates,
+		rate("2025-03-03", "EUR", "XAU", "0.0004"),
+		rate("2025-03-03", "EUR", "USD", "1.05"),
+	))
+	if err != nil {
+		t.Fatal("Failed to import rates:", err)
+	}
+	if imported != 2 || len(repo.rates) != 2 || !repo.rates[0].Rate.Equal(decimal.RequireFromString("1.05")) {
+		t.Errorf("Expected 2 rates with the last USD rate, got %d", imported)
+	}
+}
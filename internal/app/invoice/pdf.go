@@ -0,0 +1,173 @@
+package invoice
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
+	"github.com/assylzhan-a/subscription-service/pkg/pdf"
+	"github.com/shopspring/decimal"
+)
+
+// Seller is the business that issues the invoices
+type Seller struct {
+	Name    string
+	Address []string
+	Email   string
+	TaxID   string
+	// Logo is a PNG or JPEG image; no logo is drawn when it is empty
+	Logo []byte
+}
+
+// Page layout in points
+const (
+	marginLeft    = 50.0
+	marginRight   = pdf.PageWidth - 50
+	logoMaxWidth  = 150.0
+	logoMaxHeight = 60.0
+	lineHeight    = 14.0
+)
+
+// RenderInvoicePDF renders an invoice as a PDF document addressed to its customer
+func (s *Service) RenderInvoicePDF(ctx context.Context, invoice *models.Invoice) ([]byte, error) {
+	customer, err := s.userRepo.GetByID(ctx, invoice.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer: %w", err)
+	}
+
+	return RenderPDF(invoice, customer, s.seller)
+}
+
+// RenderPDF lays out an invoice on a single A4 page. The document only depends
+// on its arguments, so rendering the same invoice twice gives the same bytes.
+func RenderPDF(invoice *models.Invoice, customer *models.User, seller Seller) ([]byte, error) {
+	document := pdf.NewDocument()
+	page := document.AddPage()
+
+	// Header: logo and seller on the left, invoice details on the right
+	y := 50.0
+	if len(seller.Logo) > 0 {
+		logo, err := document.LoadImage(seller.Logo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load logo: %w", err)
+		}
+
+		width, height := fitBox(float64(logo.Width()), float64(logo.Height()), logoMaxWidth, logoMaxHeight)
+		page.Image(logo, marginLeft, y, width, height)
+		y += height + 20
+	}
+
+	page.TextRight(marginRight, 70, pdf.HelveticaBold, 22, "INVOICE")
+	details := [][2]string{
+		{"Invoice number", invoice.Number},
+		{"Issue date", invoice.IssuedAt.UTC().Format("2006-01-02")},
+		{"Billing period", invoice.PeriodStart.UTC().Format("2006-01-02") + " to " + invoice.PeriodEnd.UTC().Format("2006-01-02")},
+		{"Subscription", invoice.SubscriptionID.String()},
+	}
+	detailsY := 95.0
+	for _, detail := range details {
+		page.TextRight(marginRight-180, detailsY, pdf.Helvetica, 9, detail[0])
+		page.TextRight(marginRight, detailsY, pdf.HelveticaBold, 9, detail[1])
+		detailsY += lineHeight
+	}
+
+	y += 10
+	page.Text(marginLeft, y, pdf.HelveticaBold, 11, seller.Name)
+	for _, line := range sellerLines(seller) {
+		y += lineHeight
+		page.Text(marginLeft, y, pdf.Helvetica, 9, line)
+	}
+
+	// Customer
+	y = max(y, detailsY) + 30
+	page.Text(marginLeft, y, pdf.Helvetica, 9, "Bill to")
+	y += lineHeight
+	page.Text(marginLeft, y, pdf.HelveticaBold, 11, customer.Name)
+	y += lineHeight
+	page.Text(marginLeft, y, pdf.Helvetica, 9, customer.Email)
+	if invoice.CustomerVATID != "" {
+		y += lineHeight
+		page.Text(marginLeft, y, pdf.Helvetica, 9, "VAT ID: "+invoice.CustomerVATID)
+	}
+
+	// Lines, with tax in the totals below. Amounts have the currency's decimal places.
+	format := func(amount decimal.Decimal) string {
+		return currency.Format(amount, invoice.Currency)
+	}
+	y += 40
+	page.Text(marginLeft, y, pdf.HelveticaBold, 10, "Description")
+	page.TextRight(marginRight, y, pdf.HelveticaBold, 10, "Amount ("+invoice.Currency+")")
+	y += 8
+	page.Line(marginLeft, y, marginRight, y, 0.8)
+
+	for _, line := range invoice.Lines {
+		if line.Type == models.InvoiceLineTypeTax {
+			continue
+		}
+		y += 20
+		page.Text(marginLeft, y, pdf.Helvetica, 10, line.Description)
+		page.TextRight(marginRight, y, pdf.Helvetica, 10, format(line.Amount))
+	}
+
+	y += 12
+	page.Line(marginLeft, y, marginRight, y, 0.4)
+
+	totals := [][2]string{{"Subtotal", format(invoice.Subtotal)}}
+	for _, line := range invoice.Lines {
+		if line.Type == models.InvoiceLineTypeTax {
+			totals = append(totals, [2]string{line.Description, format(line.Amount)})
+		}
+	}
+	for _, total := range totals {
+		y += 20
+		page.TextRight(marginRight-120, y, pdf.Helvetica, 10, total[0])
+		page.TextRight(marginRight, y, pdf.Helvetica, 10, total[1])
+	}
+
+	y += 24
+	page.TextRight(marginRight-120, y, pdf.HelveticaBold, 12, "Total")
+	page.TextRight(marginRight, y, pdf.HelveticaBold, 12, format(invoice.Total))
+
+	if invoice.CreditApplied.IsPositive() {
+		y += 20
+		page.TextRight(marginRight-120, y, pdf.Helvetica, 10, "Paid from credit balance")
+		page.TextRight(marginRight, y, pdf.Helvetica, 10, format(invoice.CreditApplied.Neg()))
+		y += 20
+		page.TextRight(marginRight-120, y, pdf.HelveticaBold, 10, "Amount charged")
+		page.TextRight(marginRight, y, pdf.HelveticaBold, 10, format(invoice.AmountDue()))
+	}
+
+	if invoice.ReverseCharge {
+		y += 40
+		page.Text(marginLeft, y, pdf.Helvetica, 8, models.ReverseChargeNote)
+	}
+
+	// Footer
+	footer := seller.Name
+	if seller.TaxID != "" {
+		footer += " - Tax ID " + seller.TaxID
+	}
+	page.Line(marginLeft, pdf.PageHeight-60, marginRight, pdf.PageHeight-60, 0.4)
+	page.Text(marginLeft, pdf.PageHeight-45, pdf.Helvetica, 8, footer)
+
+	return document.Bytes(), nil
+}
+
+// sellerLines returns the seller details printed below the seller's name
+func sellerLines(seller Seller) []string {
+	lines := append([]string{}, seller.Address...)
+	if seller.Email != "" {
+		lines = append(lines, seller.Email)
+	}
+	if seller.TaxID != "" {
+		lines = append(lines, "Tax ID: "+seller.TaxID)
+	}
+	return lines
+}
+
+// fitBox scales a width and height down to fit into the box, keeping the aspect ratio
+func fitBox(width, height, maxWidth, maxHeight float64) (float64, float64) {
+	scale := min(maxWidth/width, maxHeight/height, 1)
+	return width * scale, height * scale
+}
@@ -0,0 +1,116 @@
+package invoice
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type Service struct {
+	repo     repository.InvoiceRepository
+	userRepo repository.UserRepository
+	seller   Seller
+}
+
+func NewService(repo repository.InvoiceRepository, userRepo repository.UserRepository, seller Seller) *Service {
+	return &Service{
+		repo:     repo,
+		userRepo: userRepo,
+		seller:   seller,
+	}
+}
+
+func (s *Service) GetInvoiceByID(ctx context.Context, id uuid.UUID) (*models.Invoice, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *Service) GetUserInvoices(ctx context.Context, userID uuid.UUID) ([]*models.Invoice, error) {
+	return s.repo.GetByUserID(ctx, userID)
+}
+
+// BuildInput describes the billing event an invoice is issued for
+type BuildInput struct {
+	// Subscription and Product are the state after the event
+	Subscription *models.Subscription
+	Product      *models.Product
+	Reason       models.InvoiceReason
+	IssuedAt     time.Time
+	// Credit is taken off the charge, e.g. the unused part of the previous plan.
+	// Credit beyond the charge is not used.
+	Credit decimal.Decimal
+	// Taxes are the taxes on the charge after credit, each of which gets a line
+	Taxes []models.TaxComponent
+}
+
+// Build returns the finalized invoice for the subscription's current period, in the
+// subscription's currency. Each line is rounded to the currency's minor unit and the
+// totals are the sums of the rounded lines.
+func Build(input BuildInput) *models.Invoice {
+	subscription := input.Subscription
+
+	invoice := &models.Invoice{
+		ID:             uuid.New(),
+		UserID:         subscription.UserID,
+		SubscriptionID: subscription.ID,
+		Reason:         input.Reason,
+		Status:         models.InvoiceStatusFinalized,
+		// Invoices are only issued for charges that were collected
+		PaymentStatus: models.InvoicePaymentStatusPaid,
+		PeriodStart:   subscription.StartDate,
+		PeriodEnd:     subscription.EndDate,
+		Currency:      subscription.Currency,
+		IssuedAt:      input.IssuedAt,
+
+		ReverseCharge:   subscription.ReverseCharge,
+		CustomerVATID:   subscription.CustomerVATID,
+		VATValidationID: subscription.VATValidationID,
+	}
+
+	addLine := func(lineType models.InvoiceLineType, description string, amount decimal.Decimal) {
+		invoice.Lines = append(invoice.Lines, &models.InvoiceLine{
+			ID:          uuid.New(),
+			InvoiceID:   invoice.ID,
+			Position:    len(invoice.Lines) + 1,
+			Type:        lineType,
+			Description: description,
+			Amount:      currency.Round(amount, subscription.Currency),
+		})
+	}
+
+	addLine(models.InvoiceLineTypePlan, fmt.Sprintf("%s (%s to %s)", input.Product.Name,
+		subscription.StartDate.Format("2006-01-02"), subscription.EndDate.Format("2006-01-02")), subscription.OriginalPrice)
+
+	charge := subscription.OriginalPrice
+	if subscription.DiscountedPrice != nil && subscription.DiscountedPrice.LessThan(subscription.OriginalPrice) {
+		charge = *subscription.DiscountedPrice
+		addLine(models.InvoiceLineTypeDiscount, "Voucher discount", charge.Sub(subscription.OriginalPrice))
+	}
+
+	if input.Credit.IsPositive() {
+		credit := decimal.Min(input.Credit, charge)
+		addLine(models.InvoiceLineTypeCredit, "Credit for unused time on the previous plan", credit.Neg())
+	}
+
+	invoice.Subtotal = decimal.Zero
+	for _, line := range invoice.Lines {
+		invoice.Subtotal = invoice.Subtotal.Add(line.Amount)
+	}
+
+	invoice.TaxAmount = decimal.Zero
+	for _, tax := range input.Taxes {
+		addLine(models.InvoiceLineTypeTax, fmt.Sprintf("%s (%s%%)", tax.Name, tax.Rate.Mul(decimal.NewFromInt(100)).String()), tax.Amount)
+
+		tax.Amount = invoice.Lines[len(invoice.Lines)-1].Amount
+		invoice.TaxComponents = append(invoice.TaxComponents, tax)
+		invoice.TaxAmount = invoice.TaxAmount.Add(tax.Amount)
+	}
+	invoice.Total = invoice.Subtotal.Add(invoice.TaxAmount)
+
+	return invoice
+}
@@ -0,0 +1,243 @@
+package invoice_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/invoice"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func TestBuild(t *testing.T) {
+	product := &models.Product{
+		ID:      uuid.New(),
+		Name:    "Premium",
+		Price:   decimal.NewFromInt(40),
+		TaxRate: decimal.NewFromFloat(0.2),
+	}
+
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	discountedPrice := decimal.NewFromInt(30)
+	subscription := &models.Subscription{
+		ID:              uuid.New(),
+		UserID:          uuid.New(),
+		ProductID:       product.ID,
+		StartDate:       start,
+		EndDate:         start.AddDate(0, 1, 0),
+		OriginalPrice:   product.Price,
+		DiscountedPrice: &discountedPrice,
+		Currency:        "EUR",
+	}
+
+	// Test case 1: Lines are plan, discount, credit and tax, and totals add up
+	result := invoice.Build(invoice.BuildInput{
+		Subscription: subscription,
+		Product:      product,
+		Reason:       models.InvoiceReasonPlanChange,
+		IssuedAt:     start,
+		Credit:       decimal.RequireFromString("10.004"),
+		Taxes:        []models.TaxComponent{{Name: "Tax", Rate: product.TaxRate, Amount: decimal.RequireFromString("3.9992")}},
+	})
+
+	expected := []struct {
+		lineType models.InvoiceLineType
+		amount   string
+	}{
+		{models.InvoiceLineTypePlan, "40"},
+		{models.InvoiceLineTypeDiscount, "-10"},
+		{models.InvoiceLineTypeCredit, "-10"},
+		{models.InvoiceLineTypeTax, "4"},
+	}
+
+	if len(result.Lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d", len(expected), len(result.Lines))
+	}
+
+	for i, line := range result.Lines {
+		if line.Type != expected[i].lineType || !line.Amount.Equal(decimal.RequireFromString(expected[i].amount)) {
+			t.Errorf("Expected line %d to be %v %s, got %v %v", i+1, expected[i].lineType, expected[i].amount, line.Type, line.Amount)
+		}
+		if line.Position != i+1 {
+			t.Errorf("Expected position %d, got %d", i+1, line.Position)
+		}
+	}
+
+	if !result.Subtotal.Equal(decimal.NewFromInt(20)) || !result.TaxAmount.Equal(decimal.NewFromInt(4)) ||
+		!result.Total.Equal(decimal.NewFromInt(24)) || result.Status != models.InvoiceStatusFinalized {
+		t.Errorf("Expected finalized invoice with subtotal 20, tax 4 and total 24, got %v, %v, %v (%v)",
+			result.Subtotal, result.TaxAmount, result.Total, result.Status)
+	}
+
+	// Test case 2: Credit beyond the charge is not used
+	result = invoice.Build(invoice.BuildInput{
+		Subscription: subscription,
+		Product:      product,
+		Reason:       models.InvoiceReasonPlanChange,
+		IssuedAt:     start,
+		Credit:       decimal.NewFromInt(50),
+	})
+
+	if !result.Total.IsZero() {
+		t.Errorf("Expected total 0, got %v", result.Total)
+	}
+
+	// Test case 3: Each tax component gets a line and the tax is their sum
+	result = invoice.Build(invoice.BuildInput{
+		Subscription: subscription,
+		Product:      product,
+		Reason:       models.InvoiceReasonRenewal,
+		IssuedAt:     start,
+		Taxes: []models.TaxComponent{
+			{Name: "GST", Jurisdiction: "CA", Rate: decimal.RequireFromString("0.05"), Amount: decimal.RequireFromString("1.5")},
+			{Name: "QST", Jurisdiction: "CA-QC", Rate: decimal.RequireFromString("0.09975"), Amount: decimal.RequireFromString("2.9925")},
+		},
+	})
+
+	taxLines := result.Lines[len(result.Lines)-2:]
+	if taxLines[0].Description != "GST (5%)" || taxLines[1].Description != "QST (9.975%)" ||
+		!taxLines[1].Amount.Equal(decimal.RequireFromString("2.99")) {
+		t.Errorf("Expected GST and QST lines, got %q %v and %q %v",
+			taxLines[0].Description, taxLines[0].Amount, taxLines[1].Description, taxLines[1].Amount)
+	}
+
+	if !result.TaxAmount.Equal(decimal.RequireFromString("4.49")) || !result.Total.Equal(decimal.RequireFromString("34.49")) ||
+		len(result.TaxComponents) != 2 || !result.TaxComponents[1].Amount.Equal(decimal.RequireFromString("2.99")) {
+		t.Errorf("Expected tax 4.49 and total 34.49, got %v and %v (%v)", result.TaxAmount, result.Total, result.TaxComponents)
+	}
+
+	// Test case 4: Amounts are rounded to the minor unit of the subscription's currency
+	yenPrice := decimal.NewFromInt(2999)
+	yenSubscription := *subscription
+	yenSubscription.Currency = "JPY"
+	yenSubscription.OriginalPrice = yenPrice
+	yenSubscription.DiscountedPrice = nil
+	result = invoice.Build(invoice.BuildInput{
+		Subscription: &yenSubscription,
+		Product:      product,
+		Reason:       models.InvoiceReasonRenewal,
+		IssuedAt:     start,
+		Taxes:        []models.TaxComponent{{Name: "Tax", Rate: product.TaxRate, Amount: yenPrice.Mul(product.TaxRate)}},
+	})
+
+	if result.Currency != "JPY" || !result.TaxAmount.Equal(decimal.NewFromInt(600)) || !result.Total.Equal(decimal.NewFromInt(3599)) {
+		t.Errorf("Expected a JPY invoice with tax 600 and total 3599, got %v %v and %v", result.Currency, result.TaxAmount, result.Total)
+	}
+}
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestRenderPDF(t *testing.T) {
+	logo, err := os.ReadFile(filepath.Join("testdata", "logo.png"))
+	if err != nil {
+		t.Fatal("Failed to read logo:", err)
+	}
+
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	discountedPrice := decimal.RequireFromString("29.99")
+	product := &models.Product{
+		ID:      uuid.MustParse("6f1c2a38-55b4-4c1e-9a53-0d6f3c1d8e11"),
+		Name:    "Premium (Annual)",
+		Price:   decimal.RequireFromString("39.99"),
+		TaxRate: decimal.NewFromFloat(0.2),
+	}
+	subscription := &models.Subscription{
+		ID:              uuid.MustParse("0b7e4f5a-8d2c-4a61-b3e9-5c4d2a1f7e90"),
+		UserID:          uuid.MustParse("a3d5c7e9-1b2f-4c6d-8e0a-9f8e7d6c5b4a"),
+		ProductID:       product.ID,
+		StartDate:       start,
+		EndDate:         start.AddDate(0, 1, 0),
+		OriginalPrice:   product.Price,
+		DiscountedPrice: &discountedPrice,
+		Currency:        "EUR",
+	}
+	customer := &models.User{
+		ID:    subscription.UserID,
+		Name:  "Jane Müller",
+		Email: "jane@example.com",
+	}
+
+	built := invoice.Build(invoice.BuildInput{
+		Subscription: subscription,
+		Product:      product,
+		Reason:       models.InvoiceReasonPlanChange,
+		IssuedAt:     start,
+		Credit:       decimal.RequireFromString("5.5"),
+		Taxes:        []models.TaxComponent{{Name: "Tax", Rate: product.TaxRate, Amount: decimal.RequireFromString("4.898")}},
+	})
+	built.Number = "INV-2025-000042"
+
+	seller := invoice.Seller{
+		Name:    "Example GmbH",
+		Address: []string{"Hauptstraße 1", "10115 Berlin", "Germany"},
+		Email:   "billing@example.com",
+		TaxID:   "DE123456789",
+		Logo:    logo,
+	}
+
+	reverseCharged := *subscription
+	reverseCharged.ReverseCharge = true
+	reverseCharged.CustomerVATID = "ATU13585627"
+	builtReverseCharged := invoice.Build(invoice.BuildInput{
+		Subscription: &reverseCharged,
+		Product:      product,
+		Reason:       models.InvoiceReasonPlanChange,
+		IssuedAt:     start,
+	})
+	builtReverseCharged.Number = "INV-2025-000043"
+
+	tests := []struct {
+		name    string
+		golden  string
+		invoice *models.Invoice
+		seller  invoice.Seller
+	}{
+		// Test case 1: Invoice with logo, discount, credit and tax
+		{"with logo", "invoice.golden.pdf", built, seller},
+		// Test case 2: Without a logo or tax ID
+		{"without logo", "invoice_no_logo.golden.pdf", built, invoice.Seller{Name: seller.Name, Address: seller.Address}},
+		// Test case 3: A reverse-charged invoice shows the customer's VAT ID and the note
+		{"reverse charge", "invoice_reverse_charge.golden.pdf", builtReverseCharged, seller},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, err := invoice.RenderPDF(tt.invoice, customer, tt.seller)
+			if err != nil {
+				t.Fatal("Failed to render PDF:", err)
+			}
+
+			// Rendering again gives the same bytes
+			again, _ := invoice.RenderPDF(tt.invoice, customer, tt.seller)
+			if !bytes.Equal(document, again) {
+				t.Error("Expected rendering to be deterministic")
+			}
+
+			golden := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(golden, document, 0o644); err != nil {
+					t.Fatal("Failed to update golden file:", err)
+				}
+			}
+
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal("Failed to read golden file:", err)
+			}
+
+			if !bytes.Equal(document, expected) {
+				t.Errorf("PDF does not match %s; run go test with -update if the change is intended", golden)
+			}
+		})
+	}
+
+	// Test case 4: A logo that is not an image is rejected
+	if _, err := invoice.RenderPDF(built, customer, invoice.Seller{Name: "Example", Logo: []byte("not an image")}); err == nil {
+		t.Error("Expected error for invalid logo")
+	}
+}
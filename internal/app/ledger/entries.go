@@ -0,0 +1,116 @@
+package ledger
+
+import (
+	"fmt"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// The functions below build the journal entries of the business changes that move
+// money. Callers post them with Post in the transaction that saves the change.
+
+func newEntry(entryType models.JournalEntryType, referenceID uuid.UUID, invoiceID *uuid.UUID, userID uuid.UUID, currency, description string) *models.JournalEntry {
+	return &models.JournalEntry{
+		ID:          uuid.New(),
+		Type:        entryType,
+		ReferenceID: referenceID,
+		InvoiceID:   invoiceID,
+		UserID:      &userID,
+		Currency:    currency,
+		Description: description,
+	}
+}
+
+// InvoiceEntry records an issued invoice. Its price is deferred until its period
+// ends, less the credit for unused time on a previous plan; discounts are taken
+// from revenue right away. What the credit balance does not pay is owed by the
+// customer until the payment is collected.
+func InvoiceEntry(issued *models.Invoice) *models.JournalEntry {
+	entry := newEntry(models.JournalEntryTypeInvoice, issued.ID, &issued.ID, issued.UserID, issued.Currency,
+		fmt.Sprintf("Invoice %s", issued.Number))
+
+	entry.Debit(models.LedgerAccountReceivables, issued.AmountDue())
+	entry.Debit(models.LedgerAccountCustomerCredit, issued.CreditApplied)
+
+	for _, line := range issued.Lines {
+		switch line.Type {
+		case models.InvoiceLineTypePlan, models.InvoiceLineTypeCredit:
+			// Credit lines are negative and reduce the deferred revenue
+			entry.Credit(models.LedgerAccountDeferredRevenue, line.Amount)
+		case models.InvoiceLineTypeDiscount:
+			entry.Debit(models.LedgerAccountDiscounts, line.Amount.Neg())
+		}
+	}
+	entry.Credit(models.LedgerAccountTaxPayable, issued.TaxAmount)
+
+	return entry
+}
+
+// PaymentEntry records an amount of a payment collected for its invoice
+func PaymentEntry(paid *models.Payment, amount decimal.Decimal) *models.JournalEntry {
+	entry := newEntry(models.JournalEntryTypePayment, paid.ID, paid.InvoiceID, paid.UserID, paid.Currency,
+		fmt.Sprintf("Payment %s collected", paid.ID))
+
+	entry.Debit(models.LedgerAccountCash, amount)
+	entry.Credit(models.LedgerAccountReceivables, amount)
+	return entry
+}
+
+// PaymentReversalEntry records an amount of a collected payment that was taken back
+// after it failed or was disputed. The customer owes it for the invoice again.
+func PaymentReversalEntry(paid *models.Payment, amount decimal.Decimal, reason string) *models.JournalEntry {
+	entry := newEntry(models.JournalEntryTypePaymentReversal, paid.ID, paid.InvoiceID, paid.UserID, paid.Currency,
+		fmt.Sprintf("Payment %s %s", paid.ID, reason))
+
+	entry.Debit(models.LedgerAccountReceivables, amount)
+	entry.Credit(models.LedgerAccountCash, amount)
+	return entry
+}
+
+// RefundEntry records money paid back for an invoice. The refunded price is taken
+// from the invoice's deferred revenue as far as it is still deferred, and from
+// revenue otherwise.
+func RefundEntry(referenceID uuid.UUID, refunded *models.Invoice, subtotal, taxAmount, deferred decimal.Decimal, description string) *models.JournalEntry {
+	entry := newEntry(models.JournalEntryTypeRefund, referenceID, &refunded.ID, refunded.UserID, refunded.Currency, description)
+
+	fromDeferred := decimal.Max(decimal.Min(deferred, subtotal), decimal.Zero)
+	entry.Debit(models.LedgerAccountDeferredRevenue, fromDeferred)
+	entry.Debit(models.LedgerAccountRevenue, subtotal.Sub(fromDeferred))
+	entry.Debit(models.LedgerAccountTaxPayable, taxAmount)
+	entry.Credit(models.LedgerAccountCash, subtotal.Add(taxAmount))
+	return entry
+}
+
+// CreditGrantEntry records credit an admin granted, which is given up like a discount
+func CreditGrantEntry(granted *models.CreditEntry) *models.JournalEntry {
+	entry := newEntry(models.JournalEntryTypeCreditGrant, granted.ID, nil, granted.UserID, granted.Currency,
+		"Credit granted")
+
+	entry.Debit(models.LedgerAccountDiscounts, granted.Amount)
+	entry.Credit(models.LedgerAccountCustomerCredit, granted.Amount)
+	return entry
+}
+
+// PlanChangeCreditEntry records unused time on the previous plan beyond the new
+// plan's price added to the credit balance. It is taken back from revenue.
+func PlanChangeCreditEntry(credited *models.CreditEntry) *models.JournalEntry {
+	entry := newEntry(models.JournalEntryTypePlanChangeCredit, credited.ID, credited.ReferenceID, credited.UserID, credited.Currency,
+		"Unused time on the previous plan added to the credit balance")
+
+	entry.Debit(models.LedgerAccountRevenue, credited.Amount)
+	entry.Credit(models.LedgerAccountCustomerCredit, credited.Amount)
+	return entry
+}
+
+// RevenueRecognitionEntry moves the deferred revenue of an invoice whose period has
+// ended to revenue
+func RevenueRecognitionEntry(deferred *models.DeferredRevenue) *models.JournalEntry {
+	entry := newEntry(models.JournalEntryTypeRevenueRecognition, deferred.InvoiceID, &deferred.InvoiceID, deferred.UserID, deferred.Currency,
+		"Revenue recognized at the end of the invoiced period")
+
+	entry.Debit(models.LedgerAccountDeferredRevenue, deferred.Amount)
+	entry.Credit(models.LedgerAccountRevenue, deferred.Amount)
+	return entry
+}
@@ -0,0 +1,240 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const defaultBatchSize = 100
+
+// Post saves a journal entry in the transaction of the repository. An entry without
+// lines records no money and is not saved; an entry whose debits do not equal its
+// credits is rejected with ErrUnbalancedJournalEntry.
+func Post(ctx context.Context, repo repository.LedgerRepository, entry *models.JournalEntry) error {
+	if len(entry.Lines) == 0 {
+		return nil
+	}
+
+	if !entry.IsBalanced() {
+		return errors.ErrUnbalancedJournalEntry
+	}
+
+	if err := repo.Post(ctx, entry); err != nil {
+		if err == errors.ErrJournalEntryExists {
+			return err
+		}
+		return fmt.Errorf("failed to post %s journal entry: %w", entry.Type, err)
+	}
+	return nil
+}
+
+// Service reports on the ledger and recognizes deferred revenue. Journal entries are
+// posted by the services that make the business changes.
+type Service struct {
+	repo repository.LedgerRepository
+	uow  repository.UnitOfWork
+}
+
+func NewService(repo repository.LedgerRepository, uow repository.UnitOfWork) *Service {
+	return &Service{
+		repo: repo,
+		uow:  uow,
+	}
+}
+
+// AccountBalance is what was posted to an account. Balance is in the account's
+// normal direction, e.g. debits less credits for receivables.
+type AccountBalance struct {
+	Account models.LedgerAccount
+	Debits  decimal.Decimal
+	Credits decimal.Decimal
+	Balance decimal.Decimal
+}
+
+// CurrencyTrialBalance lists the accounts posted to in one currency. The ledger is
+// balanced in the currency if Debits equals Credits.
+type CurrencyTrialBalance struct {
+	Currency string
+	Accounts []*AccountBalance
+	Debits   decimal.Decimal
+	Credits  decimal.Decimal
+	Balanced bool
+}
+
+// TrialBalance is the ledger's accounts in each currency as of a time. UnbalancedEntries
+// lists the journal entries whose debits do not equal their credits, which there
+// should never be.
+type TrialBalance struct {
+	AsOf              time.Time
+	Currencies        []*CurrencyTrialBalance
+	UnbalancedEntries []uuid.UUID
+	Balanced          bool
+}
+
+// GetTrialBalance returns the trial balance of the entries posted before asOf
+func (s *Service) GetTrialBalance(ctx context.Context, asOf time.Time) (*TrialBalance, error) {
+	totals, err := s.repo.GetAccountTotals(ctx, asOf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account totals: %w", err)
+	}
+
+	unbalanced, err := s.repo.GetUnbalancedEntries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unbalanced journal entries: %w", err)
+	}
+
+	trialBalance := &TrialBalance{
+		AsOf:              asOf,
+		UnbalancedEntries: unbalanced,
+		Balanced:          len(unbalanced) == 0,
+	}
+
+	currencies := make(map[string]*CurrencyTrialBalance)
+	for _, total := range totals {
+		currency, ok := currencies[total.Currency]
+		if !ok {
+			currency = &CurrencyTrialBalance{Currency: total.Currency}
+			currencies[total.Currency] = currency
+			trialBalance.Currencies = append(trialBalance.Currencies, currency)
+		}
+
+		balance := total.Credits.Sub(total.Debits)
+		if total.Account.DebitNormal() {
+			balance = balance.Neg()
+		}
+		currency.Accounts = append(currency.Accounts, &AccountBalance{
+			Account: total.Account,
+			Debits:  total.Debits,
+			Credits: total.Credits,
+			Balance: balance,
+		})
+		currency.Debits = currency.Debits.Add(total.Debits)
+		currency.Credits = currency.Credits.Add(total.Credits)
+	}
+
+	sort.Slice(trialBalance.Currencies, func(i, j int) bool {
+		return trialBalance.Currencies[i].Currency < trialBalance.Currencies[j].Currency
+	})
+	for _, currency := range trialBalance.Currencies {
+		sortAccounts(currency.Accounts)
+		currency.Balanced = currency.Debits.Equal(currency.Credits)
+		if !currency.Balanced {
+			trialBalance.Balanced = false
+		}
+	}
+
+	return trialBalance, nil
+}
+
+// Check verifies that the debits of every journal entry, and so of the whole ledger,
+// equal its credits. It returns an error naming what is unbalanced otherwise.
+func (s *Service) Check(ctx context.Context) error {
+	trialBalance, err := s.GetTrialBalance(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if trialBalance.Balanced {
+		return nil
+	}
+
+	if len(trialBalance.UnbalancedEntries) > 0 {
+		return fmt.Errorf("%w: %d entries, the first is %s", errors.ErrUnbalancedJournalEntry,
+			len(trialBalance.UnbalancedEntries), trialBalance.UnbalancedEntries[0])
+	}
+
+	for _, currency := range trialBalance.Currencies {
+		if !currency.Balanced {
+			return fmt.Errorf("ledger is not balanced in %s: debits %s, credits %s", currency.Currency, currency.Debits, currency.Credits)
+		}
+	}
+	return nil
+}
+
+// RecognizeRevenue moves the deferred revenue of invoices whose period has ended to
+// revenue. Several replicas can run it at the same time; an invoice's revenue is only
+// recognized once.
+func (s *Service) RecognizeRevenue(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	recognized := 0
+
+	for {
+		due, err := s.repo.GetDueDeferredRevenue(ctx, time.Now(), batchSize)
+		if err != nil {
+			return recognized, fmt.Errorf("failed to get deferred revenue: %w", err)
+		}
+
+		recognizedInBatch := 0
+		for _, deferred := range due {
+			ok, err := s.recognize(ctx, deferred)
+			if err != nil {
+				log.Printf("Failed to recognize revenue of invoice %s: %v", deferred.InvoiceID, err)
+				continue
+			}
+			if ok {
+				recognizedInBatch++
+			}
+		}
+		recognized += recognizedInBatch
+
+		// A batch that only failed would be returned again
+		if len(due) < batchSize || recognizedInBatch == 0 {
+			return recognized, nil
+		}
+	}
+}
+
+// recognize recognizes an invoice's deferred revenue as it is in the transaction.
+// It returns false if there is none left, e.g. because another replica recognized
+// it first.
+func (s *Service) recognize(ctx context.Context, deferred *models.DeferredRevenue) (bool, error) {
+	err := s.uow.Do(ctx, func(tx repository.Transaction) error {
+		amount, err := tx.Ledger().GetDeferredRevenue(ctx, deferred.InvoiceID)
+		if err != nil {
+			return fmt.Errorf("failed to get deferred revenue: %w", err)
+		}
+		deferred.Amount = amount
+
+		return Post(ctx, tx.Ledger(), RevenueRecognitionEntry(deferred))
+	})
+	if err != nil {
+		if err == errors.ErrJournalEntryExists {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return !deferred.Amount.IsZero(), nil
+}
+
+// sortAccounts orders accounts like the chart of accounts
+func sortAccounts(accounts []*AccountBalance) {
+	positions := make(map[models.LedgerAccount]int, len(models.LedgerAccounts))
+	for i, account := range models.LedgerAccounts {
+		positions[account] = i
+	}
+
+	sort.SliceStable(accounts, func(i, j int) bool {
+		pi, ok := positions[accounts[i].Account]
+		if !ok {
+			pi = len(positions)
+		}
+		pj, ok := positions[accounts[j].Account]
+		if !ok {
+			pj = len(positions)
+		}
+		return pi < pj
+	})
+}
@@ -0,0 +1,419 @@
+package ledger_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/ledger"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// mockLedgerRepository keeps the posted entries and sums them like the database.
+// periodEnds holds the end of the period of the invoices that defer revenue.
+type mockLedgerRepository struct {
+	entries    []*models.JournalEntry
+	periodEnds map[uuid.UUID]time.Time
+}
+
+func newMockLedgerRepository() *mockLedgerRepository {
+	return &mockLedgerRepository{periodEnds: make(map[uuid.UUID]time.Time)}
+}
+
+func (m *mockLedgerRepository) Post(ctx context.Context, entry *models.JournalEntry) error {
+	if entry.Type == models.JournalEntryTypeRevenueRecognition {
+		for _, posted := range m.entries {
+			if posted.Type == entry.Type && *posted.InvoiceID == *entry.InvoiceID {
+				return errors.ErrJournalEntryExists
+			}
+		}
+	}
+
+	entry.CreatedAt = time.Now()
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *mockLedgerRepository) GetDeferredRevenue(ctx context.Context, invoiceID uuid.UUID) (decimal.Decimal, error) {
+	amount := decimal.Zero
+	for _, entry := range m.entries {
+		if entry.InvoiceID == nil || *entry.InvoiceID != invoiceID {
+			continue
+		}
+		for _, line := range entry.Lines {
+			if line.Account == models.LedgerAccountDeferredRevenue {
+				amount = amount.Add(line.Credit).Sub(line.Debit)
+			}
+		}
+	}
+	return amount, nil
+}
+
+func (m *mockLedgerRepository) GetDueDeferredRevenue(ctx context.Context, end time.Time, limit int) ([]*models.DeferredRevenue, error) {
+	var due []*models.DeferredRevenue
+	seen := make(map[uuid.UUID]bool)
+	for _, entry := range m.entries {
+		if entry.InvoiceID == nil || seen[*entry.InvoiceID] {
+			continue
+		}
+		periodEnd, ok := m.periodEnds[*entry.InvoiceID]
+		if !ok || !periodEnd.Before(end) {
+			continue
+		}
+		seen[*entry.InvoiceID] = true
+
+		amount, _ := m.GetDeferredRevenue(ctx, *entry.InvoiceID)
+		if amount.IsZero() {
+			continue
+		}
+		due = append(due, &models.DeferredRevenue{
+			InvoiceID: *entry.InvoiceID,
+			UserID:    *entry.UserID,
+			Currency:  entry.Currency,
+			Amount:    amount,
+		})
+		if len(due) == limit {
+			break
+		}
+	}
+	return due, nil
+}
+
+func (m *mockLedgerRepository) GetAccountTotals(ctx context.Context, asOf time.Time) ([]*models.AccountTotals, error) {
+	type key struct {
+		account  models.LedgerAccount
+		currency string
+	}
+	sums := make(map[key]*models.AccountTotals)
+	var totals []*models.AccountTotals
+	for _, entry := range m.entries {
+		if !entry.CreatedAt.Before(asOf) {
+			continue
+		}
+		for _, line := range entry.Lines {
+			k := key{line.Account, entry.Currency}
+			total, ok := sums[k]
+			if !ok {
+				total = &models.AccountTotals{Account: line.Account, Currency: entry.Currency}
+				sums[k] = total
+				totals = append(totals, total)
+			}
+			total.Debits = total.Debits.Add(line.Debit)
+			total.Credits = total.Credits.Add(line.Credit)
+		}
+	}
+
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Currency != totals[j].Currency {
+			return totals[i].Currency < totals[j].Currency
+		}
+		return totals[i].Account < totals[j].Account
+	})
+	return totals, nil
+}
+
+func (m *mockLedgerRepository) GetUnbalancedEntries(ctx context.Context) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for _, entry := range m.entries {
+		if !entry.IsBalanced() {
+			ids = append(ids, entry.ID)
+		}
+	}
+	return ids, nil
+}
+
+// mockUnitOfWork runs the function against the mock repositories without a real transaction
+type mockUnitOfWork struct {
+	ledger *mockLedgerRepository
+}
+
+func (m *mockUnitOfWork) Do(ctx context.Context, fn func(tx repository.Transaction) error) error {
+	return fn(m)
+}
+
+func (m *mockUnitOfWork) Subscriptions() repository.SubscriptionRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Vouchers() repository.VoucherRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Campaigns() repository.CampaignRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Invoices() repository.InvoiceRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Payments() repository.PaymentRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) CreditNotes() repository.CreditNoteRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Credits() repository.CreditRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Ledger() repository.LedgerRepository {
+	return m.ledger
+}
+
+// createTestInvoice returns a 24 EUR invoice for a 30 EUR plan with a 10 EUR discount,
+// 4 EUR tax and 5 EUR of it paid from the credit balance
+func createTestInvoice(periodEnd time.Time) *models.Invoice {
+	id := uuid.New()
+	return &models.Invoice{
+		ID:            id,
+		Number:        "INV-2026-000001",
+		UserID:        uuid.New(),
+		Currency:      "EUR",
+		PeriodStart:   periodEnd.AddDate(0, -1, 0),
+		PeriodEnd:     periodEnd,
+		Subtotal:      decimal.NewFromInt(20),
+		TaxAmount:     decimal.NewFromInt(4),
+		Total:         decimal.NewFromInt(24),
+		CreditApplied: decimal.NewFromInt(5),
+		Lines: []*models.InvoiceLine{
+			{InvoiceID: id, Position: 1, Type: models.InvoiceLineTypePlan, Amount: decimal.NewFromInt(30)},
+			{InvoiceID: id, Position: 2, Type: models.InvoiceLineTypeDiscount, Amount: decimal.NewFromInt(-10)},
+			{InvoiceID: id, Position: 3, Type: models.InvoiceLineTypeTax, Amount: decimal.NewFromInt(4)},
+		},
+	}
+}
+
+func accountBalance(trialBalance *ledger.CurrencyTrialBalance, account models.LedgerAccount) decimal.Decimal {
+	for _, balance := range trialBalance.Accounts {
+		if balance.Account == account {
+			return balance.Balance
+		}
+	}
+	return decimal.Zero
+}
+
+func TestEntries(t *testing.T) {
+	issued := createTestInvoice(time.Now())
+	paid := &models.Payment{ID: uuid.New(), UserID: issued.UserID, InvoiceID: &issued.ID, Currency: "EUR", Amount: issued.AmountDue()}
+	granted := &models.CreditEntry{ID: uuid.New(), UserID: issued.UserID, Amount: decimal.NewFromInt(5), Currency: "EUR"}
+
+	// Test case 1: Every entry is balanced
+	entries := []*models.JournalEntry{
+		ledger.InvoiceEntry(issued),
+		ledger.PaymentEntry(paid, paid.Amount),
+		ledger.PaymentReversalEntry(paid, paid.Amount, "disputed"),
+		ledger.RefundEntry(uuid.New(), issued, decimal.NewFromInt(10), decimal.NewFromInt(2), decimal.NewFromInt(30), "Refund"),
+		ledger.CreditGrantEntry(granted),
+		ledger.PlanChangeCreditEntry(granted),
+		ledger.RevenueRecognitionEntry(&models.DeferredRevenue{InvoiceID: issued.ID, UserID: issued.UserID, Currency: "EUR", Amount: decimal.NewFromInt(30)}),
+	}
+	for _, entry := range entries {
+		debits, credits := entry.Totals()
+		if !entry.IsBalanced() || debits.IsZero() {
+			t.Errorf("Expected a balanced %s entry, got debits %s and credits %s", entry.Type, debits, credits)
+		}
+	}
+
+	// Test case 2: The invoice defers the plan's price and takes the discount from revenue
+	invoiceEntry := entries[0]
+	expected := map[models.LedgerAccount][2]int64{
+		models.LedgerAccountReceivables:     {19, 0},
+		models.LedgerAccountCustomerCredit:  {5, 0},
+		models.LedgerAccountDeferredRevenue: {0, 30},
+		models.LedgerAccountDiscounts:       {10, 0},
+		models.LedgerAccountTaxPayable:      {0, 4},
+	}
+	if len(invoiceEntry.Lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d", len(expected), len(invoiceEntry.Lines))
+	}
+	for _, line := range invoiceEntry.Lines {
+		amounts := expected[line.Account]
+		if !line.Debit.Equal(decimal.NewFromInt(amounts[0])) || !line.Credit.Equal(decimal.NewFromInt(amounts[1])) {
+			t.Errorf("Expected %s debit %d credit %d, got %s and %s", line.Account, amounts[0], amounts[1], line.Debit, line.Credit)
+		}
+	}
+
+	// Test case 3: A refund beyond the deferred revenue is taken from revenue
+	refund := ledger.RefundEntry(uuid.New(), issued, decimal.NewFromInt(10), decimal.NewFromInt(2), decimal.NewFromInt(4), "Refund")
+	for _, line := range refund.Lines {
+		switch line.Account {
+		case models.LedgerAccountDeferredRevenue:
+			if !line.Debit.Equal(decimal.NewFromInt(4)) {
+				t.Errorf("Expected 4 from deferred revenue, got %s", line.Debit)
+			}
+		case models.LedgerAccountRevenue:
+			if !line.Debit.Equal(decimal.NewFromInt(6)) {
+				t.Errorf("Expected 6 from revenue, got %s", line.Debit)
+			}
+		}
+	}
+}
+
+func TestPost(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	repo := newMockLedgerRepository()
+
+	// Test case 1: An unbalanced entry is rejected
+	entry := &models.JournalEntry{ID: uuid.New(), Type: models.JournalEntryTypePayment, Currency: "EUR"}
+	entry.Debit(models.LedgerAccountCash, decimal.NewFromInt(10))
+	entry.Credit(models.LedgerAccountReceivables, decimal.NewFromInt(9))
+	if err := ledger.Post(ctx, repo, entry); err != errors.ErrUnbalancedJournalEntry {
+		t.Errorf("Expected error %v, got %v", errors.ErrUnbalancedJournalEntry, err)
+	}
+
+	// Test case 2: An entry without amounts is not saved
+	paid := &models.Payment{ID: uuid.New(), UserID: uuid.New(), Currency: "EUR"}
+	if err := ledger.Post(ctx, repo, ledger.PaymentEntry(paid, decimal.Zero)); err != nil {
+		t.Fatal("Failed to post entry:", err)
+	}
+
+	if len(repo.entries) != 0 {
+		t.Errorf("Expected no entries, got %d", len(repo.entries))
+	}
+
+	// Test case 3: A negative amount is posted to the other side
+	entry = &models.JournalEntry{ID: uuid.New(), Type: models.JournalEntryTypeInvoice, Currency: "EUR"}
+	entry.Debit(models.LedgerAccountDiscounts, decimal.NewFromInt(-3))
+	entry.Credit(models.LedgerAccountRevenue, decimal.NewFromInt(-3))
+	if !entry.Lines[0].Credit.Equal(decimal.NewFromInt(3)) || !entry.Lines[1].Debit.Equal(decimal.NewFromInt(3)) || !entry.IsBalanced() {
+		t.Errorf("Expected negative amounts on the other side, got %+v %+v", entry.Lines[0], entry.Lines[1])
+	}
+}
+
+func TestTrialBalance(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	repo := newMockLedgerRepository()
+	service := ledger.NewService(repo, &mockUnitOfWork{ledger: repo})
+
+	issued := createTestInvoice(time.Now())
+	paid := &models.Payment{ID: uuid.New(), UserID: issued.UserID, InvoiceID: &issued.ID, Currency: "EUR", Amount: issued.AmountDue()}
+	for _, entry := range []*models.JournalEntry{ledger.InvoiceEntry(issued), ledger.PaymentEntry(paid, paid.Amount)} {
+		if err := ledger.Post(ctx, repo, entry); err != nil {
+			t.Fatal("Failed to post entry:", err)
+		}
+	}
+
+	usd := createTestInvoice(time.Now())
+	usd.Currency = "USD"
+	if err := ledger.Post(ctx, repo, ledger.InvoiceEntry(usd)); err != nil {
+		t.Fatal("Failed to post entry:", err)
+	}
+
+	// Test case 1: Accounts are listed by currency in chart order with their normal balance
+	trialBalance, err := service.GetTrialBalance(ctx, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal("Failed to get trial balance:", err)
+	}
+
+	if !trialBalance.Balanced || len(trialBalance.Currencies) != 2 || trialBalance.Currencies[0].Currency != "EUR" {
+		t.Fatalf("Expected a balanced trial balance in EUR and USD, got %+v", trialBalance)
+	}
+
+	eur := trialBalance.Currencies[0]
+	if eur.Accounts[0].Account != models.LedgerAccountCash || !accountBalance(eur, models.LedgerAccountCash).Equal(decimal.NewFromInt(19)) {
+		t.Errorf("Expected cash of 19 first, got %+v", eur.Accounts[0])
+	}
+
+	if !accountBalance(eur, models.LedgerAccountReceivables).IsZero() ||
+		!accountBalance(eur, models.LedgerAccountDeferredRevenue).Equal(decimal.NewFromInt(30)) ||
+		!accountBalance(eur, models.LedgerAccountCustomerCredit).Equal(decimal.NewFromInt(-5)) {
+		t.Errorf("Expected nothing receivable, 30 deferred and 5 of credit used, got %+v", eur.Accounts)
+	}
+
+	if !eur.Balanced || !eur.Debits.Equal(eur.Credits) {
+		t.Errorf("Expected debits to equal credits, got %s and %s", eur.Debits, eur.Credits)
+	}
+
+	// Test case 2: Entries posted after the date are left out
+	trialBalance, err = service.GetTrialBalance(ctx, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal("Failed to get trial balance:", err)
+	}
+
+	if len(trialBalance.Currencies) != 0 {
+		t.Errorf("Expected no currencies, got %d", len(trialBalance.Currencies))
+	}
+
+	// Test case 3: The check passes on a balanced ledger and fails on an unbalanced one
+	if err := service.Check(ctx); err != nil {
+		t.Errorf("Expected a balanced ledger, got %v", err)
+	}
+
+	broken := &models.JournalEntry{ID: uuid.New(), Type: models.JournalEntryTypePayment, Currency: "EUR", CreatedAt: time.Now()}
+	broken.Debit(models.LedgerAccountCash, decimal.NewFromInt(1))
+	repo.entries = append(repo.entries, broken)
+
+	if err := service.Check(ctx); err == nil {
+		t.Error("Expected the check to fail")
+	}
+
+	trialBalance, _ = service.GetTrialBalance(ctx, time.Now().Add(time.Second))
+	if trialBalance.Balanced || len(trialBalance.UnbalancedEntries) != 1 || trialBalance.UnbalancedEntries[0] != broken.ID {
+		t.Errorf("Expected entry %s to be unbalanced, got %v", broken.ID, trialBalance.UnbalancedEntries)
+	}
+}
+
+func TestRecognizeRevenue(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	repo := newMockLedgerRepository()
+	service := ledger.NewService(repo, &mockUnitOfWork{ledger: repo})
+
+	ended := createTestInvoice(time.Now().AddDate(0, 0, -1))
+	current := createTestInvoice(time.Now().AddDate(0, 0, 10))
+	for _, issued := range []*models.Invoice{ended, current} {
+		repo.periodEnds[issued.ID] = issued.PeriodEnd
+		if err := ledger.Post(ctx, repo, ledger.InvoiceEntry(issued)); err != nil {
+			t.Fatal("Failed to post entry:", err)
+		}
+	}
+
+	// A part of the ended period was refunded
+	refund := ledger.RefundEntry(uuid.New(), ended, decimal.NewFromInt(10), decimal.NewFromInt(2), decimal.NewFromInt(30), "Refund")
+	if err := ledger.Post(ctx, repo, refund); err != nil {
+		t.Fatal("Failed to post entry:", err)
+	}
+
+	// Test case 1: Only the revenue of invoices whose period ended is recognized
+	recognized, err := service.RecognizeRevenue(ctx, 1)
+	if err != nil {
+		t.Fatal("Failed to recognize revenue:", err)
+	}
+
+	if recognized != 1 {
+		t.Errorf("Expected 1 invoice recognized, got %d", recognized)
+	}
+
+	if deferred, _ := repo.GetDeferredRevenue(ctx, ended.ID); !deferred.IsZero() {
+		t.Errorf("Expected no deferred revenue left, got %s", deferred)
+	}
+
+	if deferred, _ := repo.GetDeferredRevenue(ctx, current.ID); !deferred.Equal(decimal.NewFromInt(30)) {
+		t.Errorf("Expected 30 still deferred, got %s", deferred)
+	}
+
+	trialBalance, err := service.GetTrialBalance(ctx, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal("Failed to get trial balance:", err)
+	}
+
+	if revenue := accountBalance(trialBalance.Currencies[0], models.LedgerAccountRevenue); !revenue.Equal(decimal.NewFromInt(20)) {
+		t.Errorf("Expected 20 of revenue, got %s", revenue)
+	}
+
+	// Test case 2: Revenue is recognized only once
+	recognized, err = service.RecognizeRevenue(ctx, 10)
+	if err != nil || recognized != 0 {
+		t.Errorf("Expected nothing recognized, got %d (%v)", recognized, err)
+	}
+}
@@ -0,0 +1,291 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/shopspring/decimal"
+)
+
+// Outcome is what the fake provider does with a charge
+type Outcome string
+
+const (
+	OutcomeSucceed       Outcome = "succeed"
+	OutcomeDecline       Outcome = "decline"
+	OutcomeRequireAction Outcome = "require_action"
+	// OutcomeTimeout blocks until the request's context is done
+	OutcomeTimeout Outcome = "timeout"
+)
+
+// Payment method tokens the fake provider understands. Charges to any other
+// token succeed.
+const (
+	FakeTokenSucceed       = "tok_succeed"
+	FakeTokenDecline       = "tok_decline"
+	FakeTokenRequireAction = "tok_require_action"
+	FakeTokenTimeout       = "tok_timeout"
+)
+
+var fakeTokenOutcomes = map[string]Outcome{
+	FakeTokenSucceed:       OutcomeSucceed,
+	FakeTokenDecline:       OutcomeDecline,
+	FakeTokenRequireAction: OutcomeRequireAction,
+	FakeTokenTimeout:       OutcomeTimeout,
+}
+
+// FakeProvider is an in-process PaymentProvider for local development and tests.
+// A charge's outcome is taken from the queue filled by Script, or else from the
+// token the payment method was attached with.
+type FakeProvider struct {
+	mu             sync.Mutex
+	script         []Outcome
+	customers      map[string]Customer
+	paymentMethods map[string]string // payment method ID -> token
+	charges        map[string]*fakeCharge
+	idempotency    map[string]string // idempotency key -> charge or refund ID
+	nextID         int
+}
+
+type fakeCharge struct {
+	charge   Charge
+	amount   decimal.Decimal
+	refunded decimal.Decimal
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{
+		customers:      make(map[string]Customer),
+		paymentMethods: make(map[string]string),
+		charges:        make(map[string]*fakeCharge),
+		idempotency:    make(map[string]string),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+// Script queues the outcomes of the next charges, in order
+func (p *FakeProvider) Script(outcomes ...Outcome) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.script = append(p.script, outcomes...)
+}
+
+// Charges returns how many charges were made, whatever their outcome
+func (p *FakeProvider) Charges() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.charges)
+}
+
+// Collected returns the money the provider holds: what its charges collected less
+// what was refunded
+func (p *FakeProvider) Collected() decimal.Decimal {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	collected := decimal.Zero
+	for _, charge := range p.charges {
+		switch charge.charge.Status {
+		case models.PaymentStatusSucceeded, models.PaymentStatusRefunded:
+			collected = collected.Add(charge.amount).Sub(charge.refunded)
+		}
+	}
+	return collected
+}
+
+// SetChargeStatus changes the status of a charge, like a provider does when a
+// customer authenticates a charge or a bank reverses it
+func (p *FakeProvider) SetChargeStatus(paymentID string, status models.PaymentStatus) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	charge, ok := p.charges[paymentID]
+	if !ok {
+		return fmt.Errorf("unknown payment %s", paymentID)
+	}
+	charge.charge.Status = status
+	return nil
+}
+
+func (p *FakeProvider) CreateCustomer(ctx context.Context, customer Customer) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := p.newID("cus")
+	p.customers[id] = customer
+	return id, nil
+}
+
+func (p *FakeProvider) AttachPaymentMethod(ctx context.Context, customerID, token string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.customers[customerID]; !ok {
+		return "", fmt.Errorf("unknown customer %s", customerID)
+	}
+
+	id := p.newID("pm")
+	p.paymentMethods[id] = token
+	return id, nil
+}
+
+func (p *FakeProvider) Charge(ctx context.Context, request ChargeRequest) (*Charge, error) {
+	p.mu.Lock()
+
+	if id, ok := p.idempotency[request.IdempotencyKey]; ok && request.IdempotencyKey != "" {
+		charge := p.charges[id].charge
+		p.mu.Unlock()
+		return &charge, nil
+	}
+
+	token, ok := p.paymentMethods[request.PaymentMethodID]
+	if !ok {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("unknown payment method %s", request.PaymentMethodID)
+	}
+
+	outcome := OutcomeSucceed
+	if len(p.script) > 0 {
+		outcome = p.script[0]
+		p.script = p.script[1:]
+	} else if tokenOutcome, ok := fakeTokenOutcomes[token]; ok {
+		outcome = tokenOutcome
+	}
+
+	if outcome == OutcomeTimeout {
+		p.mu.Unlock()
+		<-ctx.Done()
+		return nil, ErrProviderTimeout
+	}
+	defer p.mu.Unlock()
+
+	charge := Charge{ID: p.newID("ch"), Status: models.PaymentStatusSucceeded}
+	switch outcome {
+	case OutcomeDecline:
+		charge.Status = models.PaymentStatusFailed
+		charge.FailureCode = "card_declined"
+		charge.FailureMessage = "Your card was declined."
+	case OutcomeRequireAction:
+		charge.Status = models.PaymentStatusRequiresAction
+		charge.FailureCode = "authentication_required"
+		charge.FailureMessage = "The payment requires authentication."
+	}
+
+	p.charges[charge.ID] = &fakeCharge{charge: charge, amount: request.Amount, refunded: decimal.Zero}
+	if request.IdempotencyKey != "" {
+		p.idempotency[request.IdempotencyKey] = charge.ID
+	}
+
+	return &charge, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, request RefundRequest) (*Refund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if id, ok := p.idempotency[request.IdempotencyKey]; ok && request.IdempotencyKey != "" {
+		return &Refund{ID: id, Amount: request.Amount}, nil
+	}
+
+	charge, ok := p.charges[request.PaymentID]
+	if !ok {
+		return nil, fmt.Errorf("unknown payment %s", request.PaymentID)
+	}
+	if charge.charge.Status != models.PaymentStatusSucceeded && charge.charge.Status != models.PaymentStatusRefunded {
+		return nil, fmt.Errorf("payment %s was not collected", request.PaymentID)
+	}
+	if charge.refunded.Add(request.Amount).GreaterThan(charge.amount) {
+		return nil, fmt.Errorf("refund exceeds the remaining amount of payment %s", request.PaymentID)
+	}
+
+	charge.refunded = charge.refunded.Add(request.Amount)
+	if charge.refunded.Equal(charge.amount) {
+		charge.charge.Status = models.PaymentStatusRefunded
+	}
+
+	refund := &Refund{ID: p.newID("re"), Amount: request.Amount}
+	if request.IdempotencyKey != "" {
+		p.idempotency[request.IdempotencyKey] = refund.ID
+	}
+
+	return refund, nil
+}
+
+func (p *FakeProvider) GetPaymentStatus(ctx context.Context, paymentID string) (models.PaymentStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	charge, ok := p.charges[paymentID]
+	if !ok {
+		return "", fmt.Errorf("unknown payment %s", paymentID)
+	}
+	return charge.charge.Status, nil
+}
+
+// fakeEvent is the webhook payload of the fake provider
+type fakeEvent struct {
+	ID      string        `json:"id"`
+	Type    string        `json:"type"`
+	Created int64         `json:"created"`
+	Data    fakeEventData `json:"data"`
+}
+
+type fakeEventData struct {
+	PaymentID      string          `json:"payment_id"`
+	IdempotencyKey string          `json:"idempotency_key,omitempty"`
+	Amount         decimal.Decimal `json:"amount"`
+	FailureCode    string          `json:"failure_code,omitempty"`
+	FailureMessage string          `json:"failure_message,omitempty"`
+}
+
+func (p *FakeProvider) ParseEvent(payload []byte) (*Event, error) {
+	var raw fakeEvent
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("invalid event: %w", err)
+	}
+	if raw.ID == "" || raw.Type == "" || raw.Data.PaymentID == "" {
+		return nil, fmt.Errorf("event is missing its id, type or payment")
+	}
+
+	return &Event{
+		ID:             raw.ID,
+		Type:           EventType(raw.Type),
+		PaymentID:      raw.Data.PaymentID,
+		IdempotencyKey: raw.Data.IdempotencyKey,
+		Amount:         raw.Data.Amount,
+		FailureCode:    raw.Data.FailureCode,
+		FailureMessage: raw.Data.FailureMessage,
+		CreatedAt:      time.Unix(raw.Created, 0),
+	}, nil
+}
+
+// EncodeEvent returns the webhook payload the fake provider sends for an event,
+// for simulating webhooks in tests and during development
+func (p *FakeProvider) EncodeEvent(event Event) []byte {
+	payload, _ := json.Marshal(fakeEvent{
+		ID:      event.ID,
+		Type:    string(event.Type),
+		Created: event.CreatedAt.Unix(),
+		Data: fakeEventData{
+			PaymentID:      event.PaymentID,
+			IdempotencyKey: event.IdempotencyKey,
+			Amount:         event.Amount,
+			FailureCode:    event.FailureCode,
+			FailureMessage: event.FailureMessage,
+		},
+	})
+	return payload
+}
+
+// newID returns a new sequential ID; the caller holds the lock
+func (p *FakeProvider) newID(prefix string) string {
+	p.nextID++
+	return fmt.Sprintf("%s_fake_%06d", prefix, p.nextID)
+}
@@ -0,0 +1,103 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// ErrProviderTimeout is returned by providers that gave up waiting for the gateway.
+// Whether the charge went through is unknown until the provider reports it.
+var ErrProviderTimeout = errors.New("payment provider timed out")
+
+// isTimeout reports whether a provider call failed because it took too long
+func isTimeout(err error) bool {
+	return errors.Is(err, ErrProviderTimeout) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// PaymentProvider is a payment gateway that keeps customers and their payment
+// methods and charges them. Implementations must be safe for concurrent use.
+type PaymentProvider interface {
+	// Name identifies the provider in stored accounts and payments
+	Name() string
+	CreateCustomer(ctx context.Context, customer Customer) (string, error)
+	// AttachPaymentMethod stores the payment method a client-side token stands for
+	// and makes it the customer's default. It returns the payment method ID.
+	AttachPaymentMethod(ctx context.Context, customerID, token string) (string, error)
+	// Charge collects money from a payment method. A declined charge is not an
+	// error; its outcome is in the returned Charge.
+	Charge(ctx context.Context, request ChargeRequest) (*Charge, error)
+	Refund(ctx context.Context, request RefundRequest) (*Refund, error)
+	GetPaymentStatus(ctx context.Context, paymentID string) (models.PaymentStatus, error)
+	// ParseEvent reads the payload of a webhook the provider sent. The signature is
+	// checked before. Event types the service does not know keep the provider's name.
+	ParseEvent(payload []byte) (*Event, error)
+}
+
+// Customer is what a provider is told about a user
+type Customer struct {
+	UserID uuid.UUID
+	Email  string
+	Name   string
+}
+
+type ChargeRequest struct {
+	CustomerID      string
+	PaymentMethodID string
+	Amount          decimal.Decimal
+	Currency        string
+	Description     string
+	// IdempotencyKey makes retrying a charge safe: the provider charges a key only once
+	IdempotencyKey string
+}
+
+// Charge is the outcome of a charge request
+type Charge struct {
+	ID     string
+	Status models.PaymentStatus
+	// FailureCode is a machine-readable reason, e.g. "card_declined"
+	FailureCode    string
+	FailureMessage string
+}
+
+type RefundRequest struct {
+	PaymentID      string
+	Amount         decimal.Decimal
+	Currency       string
+	IdempotencyKey string
+}
+
+type Refund struct {
+	ID     string
+	Amount decimal.Decimal
+}
+
+// EventType is the kind of a webhook event, named the same for every provider
+type EventType string
+
+const (
+	EventPaymentSucceeded EventType = "payment.succeeded"
+	EventPaymentFailed    EventType = "payment.failed"
+	EventPaymentRefunded  EventType = "payment.refunded"
+	EventPaymentDisputed  EventType = "payment.disputed"
+)
+
+// Event is a webhook event about a payment
+type Event struct {
+	// ID is the provider's event ID
+	ID        string
+	Type      EventType
+	PaymentID string
+	// IdempotencyKey is the key the charge was requested with, for providers that
+	// report it. It identifies charges whose response was lost to a timeout.
+	IdempotencyKey string
+	// Amount is the amount the event is about, e.g. the amount refunded
+	Amount         decimal.Decimal
+	FailureCode    string
+	FailureMessage string
+	CreatedAt      time.Time
+}
@@ -0,0 +1,306 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Failure codes recorded for charges the provider did not decide
+const (
+	FailureCodeNoPaymentMethod = "payment_method_missing"
+	FailureCodeTimeout         = "provider_timeout"
+	FailureCodeProviderError   = "provider_error"
+)
+
+type Service struct {
+	provider PaymentProvider
+	repo     repository.PaymentRepository
+	userRepo repository.UserRepository
+	// timeout bounds every call to the provider
+	timeout time.Duration
+}
+
+func NewService(
+	provider PaymentProvider,
+	repo repository.PaymentRepository,
+	userRepo repository.UserRepository,
+	timeout time.Duration,
+) *Service {
+	return &Service{
+		provider: provider,
+		repo:     repo,
+		userRepo: userRepo,
+		timeout:  timeout,
+	}
+}
+
+type SetPaymentMethodInput struct {
+	UserID uuid.UUID
+	// Token is the payment method token created by the provider's client-side SDK
+	Token string
+}
+
+func (i *SetPaymentMethodInput) Validate() errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	if i.UserID == uuid.Nil {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "user_id",
+			Message: "must not be empty",
+		})
+	}
+
+	if strings.TrimSpace(i.Token) == "" {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "token",
+			Message: "must not be empty",
+		})
+	}
+
+	return validationErrors
+}
+
+// SetPaymentMethod makes the payment method the user's default, creating the
+// user's customer at the provider first if needed
+func (s *Service) SetPaymentMethod(ctx context.Context, input SetPaymentMethodInput) (*models.PaymentAccount, error) {
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	account, err := s.repo.GetAccount(ctx, input.UserID, s.provider.Name())
+	if err != nil {
+		if err != errors.ErrPaymentAccountNotFound {
+			return nil, fmt.Errorf("failed to get payment account: %w", err)
+		}
+
+		user, err := s.userRepo.GetByID(ctx, input.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+
+		customerID, err := s.provider.CreateCustomer(ctx, Customer{UserID: user.ID, Email: user.Email, Name: user.Name})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create customer: %w", err)
+		}
+
+		account = &models.PaymentAccount{
+			UserID:     input.UserID,
+			Provider:   s.provider.Name(),
+			CustomerID: customerID,
+		}
+	}
+
+	paymentMethodID, err := s.provider.AttachPaymentMethod(ctx, account.CustomerID, strings.TrimSpace(input.Token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach payment method: %w", err)
+	}
+	account.PaymentMethodID = paymentMethodID
+
+	if err := s.repo.SaveAccount(ctx, account); err != nil {
+		return nil, fmt.Errorf("failed to save payment account: %w", err)
+	}
+
+	return account, nil
+}
+
+// GetPaymentMethod returns the user's payment account at the configured provider
+func (s *Service) GetPaymentMethod(ctx context.Context, userID uuid.UUID) (*models.PaymentAccount, error) {
+	return s.repo.GetAccount(ctx, userID, s.provider.Name())
+}
+
+// RequirePaymentMethod returns ErrPaymentMethodRequired if the user cannot be charged
+func (s *Service) RequirePaymentMethod(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.repo.GetAccount(ctx, userID, s.provider.Name())
+	if err == errors.ErrPaymentAccountNotFound {
+		return errors.ErrPaymentMethodRequired
+	}
+	return err
+}
+
+type ChargeInput struct {
+	UserID         uuid.UUID
+	SubscriptionID uuid.UUID
+	// InvoiceID is the invoice the charge pays, if any
+	InvoiceID *uuid.UUID
+	Reason    models.InvoiceReason
+	// Attempt numbers the charge among retries of the same billing event; 0 means the first
+	Attempt     int
+	Amount      decimal.Decimal
+	Currency    string
+	Description string
+}
+
+// Charge collects an amount from the user's payment method. It returns nil for
+// a zero amount. Otherwise it returns the payment for the caller to save, also
+// when the charge failed, together with ErrPaymentMethodRequired,
+// ErrPaymentDeclined, ErrPaymentRequiresAction or ErrPaymentTimeout. A payment
+// that timed out stays pending, because the provider may still collect it.
+func (s *Service) Charge(ctx context.Context, input ChargeInput) (*models.Payment, error) {
+	amount := currency.Round(input.Amount, input.Currency)
+	if !amount.IsPositive() {
+		return nil, nil
+	}
+
+	attempt := input.Attempt
+	if attempt <= 0 {
+		attempt = 1
+	}
+
+	payment := &models.Payment{
+		ID:             uuid.New(),
+		UserID:         input.UserID,
+		SubscriptionID: input.SubscriptionID,
+		InvoiceID:      input.InvoiceID,
+		Reason:         input.Reason,
+		Attempt:        attempt,
+		Provider:       s.provider.Name(),
+		Amount:         amount,
+		Currency:       input.Currency,
+		Status:         models.PaymentStatusFailed,
+	}
+
+	account, err := s.repo.GetAccount(ctx, input.UserID, s.provider.Name())
+	if err != nil {
+		if err == errors.ErrPaymentAccountNotFound {
+			payment.FailureCode = FailureCodeNoPaymentMethod
+			payment.FailureMessage = "No payment method on file"
+			return payment, errors.ErrPaymentMethodRequired
+		}
+		return nil, fmt.Errorf("failed to get payment account: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	charge, err := s.provider.Charge(ctx, ChargeRequest{
+		CustomerID:      account.CustomerID,
+		PaymentMethodID: account.PaymentMethodID,
+		Amount:          amount,
+		Currency:        input.Currency,
+		Description:     input.Description,
+		// The payment ID is new for every attempt, so only a retry of this attempt is deduplicated
+		IdempotencyKey: payment.ID.String(),
+	})
+	if err != nil {
+		if isTimeout(err) {
+			payment.Status = models.PaymentStatusPending
+			payment.FailureCode = FailureCodeTimeout
+			payment.FailureMessage = "The payment provider did not respond in time"
+			return payment, errors.ErrPaymentTimeout
+		}
+		SetFailure(payment, FailureCodeProviderError, err.Error())
+		return payment, fmt.Errorf("failed to charge payment method: %w", err)
+	}
+
+	payment.ProviderPaymentID = charge.ID
+	payment.Status = charge.Status
+	SetFailure(payment, charge.FailureCode, charge.FailureMessage)
+
+	switch charge.Status {
+	case models.PaymentStatusSucceeded:
+		return payment, nil
+	case models.PaymentStatusRequiresAction:
+		return payment, errors.ErrPaymentRequiresAction
+	default:
+		return payment, errors.ErrPaymentDeclined
+	}
+}
+
+// Refund returns a collected payment in full
+func (s *Service) Refund(ctx context.Context, payment *models.Payment) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, err := s.provider.Refund(ctx, RefundRequest{
+		PaymentID:      payment.ProviderPaymentID,
+		Amount:         payment.Amount,
+		Currency:       payment.Currency,
+		IdempotencyKey: "refund-" + payment.ID.String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refund payment %s: %w", payment.ID, err)
+	}
+
+	payment.Status = models.PaymentStatusRefunded
+	payment.RefundedAmount = payment.Amount
+	return nil
+}
+
+// RefundAmount returns part of a collected payment and returns the provider's refund
+// ID. The idempotency key makes a retried refund return the first one. The payment
+// is marked as refunded once nothing is left to refund.
+func (s *Service) RefundAmount(ctx context.Context, payment *models.Payment, amount decimal.Decimal, idempotencyKey string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	refund, err := s.provider.Refund(ctx, RefundRequest{
+		PaymentID:      payment.ProviderPaymentID,
+		Amount:         amount,
+		Currency:       payment.Currency,
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to refund payment %s: %w", payment.ID, err)
+	}
+
+	payment.RefundedAmount = payment.RefundedAmount.Add(amount)
+	if payment.RefundedAmount.GreaterThanOrEqual(payment.Amount) {
+		payment.Status = models.PaymentStatusRefunded
+	}
+	return refund.ID, nil
+}
+
+// FindPayment returns the payment a webhook event is about. A payment whose charge
+// timed out does not know the provider's payment ID yet; it is found by its
+// idempotency key if the event has one, and linked to the provider's payment.
+func (s *Service) FindPayment(ctx context.Context, event *Event) (*models.Payment, error) {
+	found, err := s.repo.GetByProviderPaymentID(ctx, s.provider.Name(), event.PaymentID)
+	if err != errors.ErrPaymentNotFound || event.IdempotencyKey == "" {
+		return found, err
+	}
+
+	// The payment ID is the charge's idempotency key
+	id, parseErr := uuid.Parse(event.IdempotencyKey)
+	if parseErr != nil {
+		return nil, errors.ErrPaymentNotFound
+	}
+
+	found, err = s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if found.Provider != s.provider.Name() || found.ProviderPaymentID != "" {
+		return nil, errors.ErrPaymentNotFound
+	}
+
+	found.ProviderPaymentID = event.PaymentID
+	return found, nil
+}
+
+// SetFailure records why a payment failed. The code and message come from the
+// provider and are cut to the length the payments table stores.
+func SetFailure(payment *models.Payment, code, message string) {
+	payment.FailureCode = truncate(code, 50)
+	payment.FailureMessage = truncate(message, 255)
+}
+
+// truncate cuts s to at most length characters
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+	return string(runes[:length])
+}
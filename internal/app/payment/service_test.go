@@ -0,0 +1,309 @@
+package payment_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/payment"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type mockPaymentRepository struct {
+	accounts map[uuid.UUID]*models.PaymentAccount
+	payments []*models.Payment
+}
+
+func newMockPaymentRepository() *mockPaymentRepository {
+	return &mockPaymentRepository{
+		accounts: make(map[uuid.UUID]*models.PaymentAccount),
+	}
+}
+
+func (m *mockPaymentRepository) GetAccount(ctx context.Context, userID uuid.UUID, provider string) (*models.PaymentAccount, error) {
+	if account, ok := m.accounts[userID]; ok && account.Provider == provider {
+		copied := *account
+		return &copied, nil
+	}
+	return nil, errors.ErrPaymentAccountNotFound
+}
+
+func (m *mockPaymentRepository) SaveAccount(ctx context.Context, account *models.PaymentAccount) error {
+	copied := *account
+	m.accounts[account.UserID] = &copied
+	return nil
+}
+
+func (m *mockPaymentRepository) Create(ctx context.Context, payment *models.Payment) error {
+	m.payments = append(m.payments, payment)
+	return nil
+}
+
+func (m *mockPaymentRepository) GetBySubscriptionID(ctx context.Context, subscriptionID uuid.UUID) ([]*models.Payment, error) {
+	var result []*models.Payment
+	for _, payment := range m.payments {
+		if payment.SubscriptionID == subscriptionID {
+			result = append(result, payment)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockPaymentRepository) GetByInvoiceID(ctx context.Context, invoiceID uuid.UUID) ([]*models.Payment, error) {
+	var result []*models.Payment
+	for _, payment := range m.payments {
+		if payment.InvoiceID != nil && *payment.InvoiceID == invoiceID {
+			result = append(result, payment)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockPaymentRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Payment, error) {
+	for _, payment := range m.payments {
+		if payment.ID == id {
+			copied := *payment
+			return &copied, nil
+		}
+	}
+	return nil, errors.ErrPaymentNotFound
+}
+
+func (m *mockPaymentRepository) GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*models.Payment, error) {
+	return m.GetByID(ctx, id)
+}
+
+func (m *mockPaymentRepository) GetByProviderPaymentID(ctx context.Context, provider, providerPaymentID string) (*models.Payment, error) {
+	for _, payment := range m.payments {
+		if payment.Provider == provider && payment.ProviderPaymentID == providerPaymentID {
+			copied := *payment
+			return &copied, nil
+		}
+	}
+	return nil, errors.ErrPaymentNotFound
+}
+
+func (m *mockPaymentRepository) Update(ctx context.Context, payment *models.Payment) error {
+	for i, existing := range m.payments {
+		if existing.ID == payment.ID {
+			copied := *payment
+			m.payments[i] = &copied
+			return nil
+		}
+	}
+	return errors.ErrPaymentNotFound
+}
+
+type mockUserRepository struct {
+	users map[uuid.UUID]*models.User
+}
+
+func (m *mockUserRepository) Create(ctx context.Context, user *models.User) error {
+	m.users[user.ID] = user
+	return nil
+}
+
+func (m *mockUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if user, ok := m.users[id]; ok {
+		return user, nil
+	}
+	return nil, errors.ErrUserNotFound
+}
+
+func (m *mockUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, errors.ErrUserNotFound
+}
+
+func (m *mockUserRepository) Update(ctx context.Context, user *models.User) error {
+	m.users[user.ID] = user
+	return nil
+}
+
+func (m *mockUserRepository) CountByRole(ctx context.Context, role models.UserRole) (int, error) {
+	return 0, nil
+}
+
+// Helper function to set up a service with a fake provider and one registered user
+func newTestService(t *testing.T) (*payment.Service, *payment.FakeProvider, *mockPaymentRepository, uuid.UUID) {
+	t.Helper()
+	user := &models.User{ID: uuid.New(), Email: "test@example.com", Name: "Test User"}
+	userRepo := &mockUserRepository{users: map[uuid.UUID]*models.User{user.ID: user}}
+	repo := newMockPaymentRepository()
+	provider := payment.NewFakeProvider()
+
+	return payment.NewService(provider, repo, userRepo, 50*time.Millisecond), provider, repo, user.ID
+}
+
+func TestSetPaymentMethod(t *testing.T) {
+	ctx := context.Background()
+	service, _, repo, userID := newTestService(t)
+
+	// Test case 1: A token is required
+	_, err := service.SetPaymentMethod(ctx, payment.SetPaymentMethodInput{UserID: userID, Token: " "})
+	if _, ok := err.(errors.ValidationErrors); !ok {
+		t.Errorf("Expected validation errors, got %v", err)
+	}
+
+	// Test case 2: The first payment method creates the customer
+	first, err := service.SetPaymentMethod(ctx, payment.SetPaymentMethodInput{UserID: userID, Token: payment.FakeTokenSucceed})
+	if err != nil {
+		t.Fatal("Failed to set payment method:", err)
+	}
+
+	if first.CustomerID == "" || first.PaymentMethodID == "" || first.Provider != "fake" {
+		t.Errorf("Expected a fake customer and payment method, got %+v", first)
+	}
+
+	// Test case 3: Another payment method replaces it for the same customer
+	second, err := service.SetPaymentMethod(ctx, payment.SetPaymentMethodInput{UserID: userID, Token: payment.FakeTokenDecline})
+	if err != nil {
+		t.Fatal("Failed to set payment method:", err)
+	}
+
+	if second.CustomerID != first.CustomerID || second.PaymentMethodID == first.PaymentMethodID {
+		t.Errorf("Expected a new payment method for customer %s, got %+v", first.CustomerID, second)
+	}
+
+	if repo.accounts[userID].PaymentMethodID != second.PaymentMethodID {
+		t.Error("Expected the new payment method to be saved")
+	}
+}
+
+func TestCharge(t *testing.T) {
+	ctx := context.Background()
+	service, provider, _, userID := newTestService(t)
+	input := payment.ChargeInput{
+		UserID:         userID,
+		SubscriptionID: uuid.New(),
+		Amount:         decimal.RequireFromString("23.988"),
+		Description:    "Test Product",
+	}
+
+	// Test case 1: Without a payment method the charge fails before reaching the provider
+	result, err := service.Charge(ctx, input)
+	if err != errors.ErrPaymentMethodRequired || result.FailureCode != payment.FailureCodeNoPaymentMethod {
+		t.Errorf("Expected error %v, got %v", errors.ErrPaymentMethodRequired, err)
+	}
+
+	if _, err := service.SetPaymentMethod(ctx, payment.SetPaymentMethodInput{UserID: userID, Token: payment.FakeTokenSucceed}); err != nil {
+		t.Fatal("Failed to set payment method:", err)
+	}
+
+	// Test case 2: A zero amount is not charged
+	free := input
+	free.Amount = decimal.Zero
+	if result, err := service.Charge(ctx, free); result != nil || err != nil {
+		t.Errorf("Expected no payment for a zero amount, got %v (err %v)", result, err)
+	}
+
+	// Test case 3: Scripted outcomes map to payment statuses and errors
+	tests := []struct {
+		outcome  payment.Outcome
+		status   models.PaymentStatus
+		expected error
+	}{
+		{payment.OutcomeSucceed, models.PaymentStatusSucceeded, nil},
+		{payment.OutcomeDecline, models.PaymentStatusFailed, errors.ErrPaymentDeclined},
+		{payment.OutcomeRequireAction, models.PaymentStatusRequiresAction, errors.ErrPaymentRequiresAction},
+		{payment.OutcomeTimeout, models.PaymentStatusPending, errors.ErrPaymentTimeout},
+	}
+
+	for _, tt := range tests {
+		provider.Script(tt.outcome)
+
+		result, err := service.Charge(ctx, input)
+		if err != tt.expected {
+			t.Errorf("Expected error %v for outcome %v, got %v", tt.expected, tt.outcome, err)
+		}
+		if result == nil || result.Status != tt.status {
+			t.Errorf("Expected status %v for outcome %v, got %+v", tt.status, tt.outcome, result)
+			continue
+		}
+		if !result.Amount.Equal(decimal.RequireFromString("23.99")) {
+			t.Errorf("Expected the amount rounded to 23.99, got %v", result.Amount)
+		}
+	}
+
+	// Test case 4: A collected payment can be refunded once in full
+	collected, err := service.Charge(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to charge:", err)
+	}
+
+	if err := service.Refund(ctx, collected); err != nil {
+		t.Fatal("Failed to refund:", err)
+	}
+
+	status, err := provider.GetPaymentStatus(ctx, collected.ProviderPaymentID)
+	if err != nil || status != models.PaymentStatusRefunded || collected.Status != models.PaymentStatusRefunded {
+		t.Errorf("Expected the payment to be refunded, got %v (err %v)", status, err)
+	}
+}
+
+func TestFindPayment(t *testing.T) {
+	ctx := context.Background()
+	service, provider, repo, userID := newTestService(t)
+	if _, err := service.SetPaymentMethod(ctx, payment.SetPaymentMethodInput{UserID: userID, Token: payment.FakeTokenSucceed}); err != nil {
+		t.Fatal("Failed to set payment method:", err)
+	}
+
+	input := payment.ChargeInput{UserID: userID, SubscriptionID: uuid.New(), Amount: decimal.NewFromInt(10)}
+	collected, _ := service.Charge(ctx, input)
+	provider.Script(payment.OutcomeTimeout)
+	timedOut, _ := service.Charge(ctx, input)
+	repo.payments = []*models.Payment{collected, timedOut}
+
+	// Test case 1: Events are matched by the provider's payment ID, after a round trip through the payload
+	event, err := provider.ParseEvent(provider.EncodeEvent(payment.Event{
+		ID:        "evt_1",
+		Type:      payment.EventPaymentRefunded,
+		PaymentID: collected.ProviderPaymentID,
+		Amount:    decimal.NewFromInt(10),
+	}))
+	if err != nil {
+		t.Fatal("Failed to parse event:", err)
+	}
+
+	found, err := service.FindPayment(ctx, event)
+	if err != nil || found.ID != collected.ID {
+		t.Errorf("Expected payment %s, got %v (err %v)", collected.ID, found, err)
+	}
+
+	// Test case 2: A payment whose charge timed out is matched by its idempotency key
+	late := &payment.Event{ID: "evt_2", Type: payment.EventPaymentSucceeded, PaymentID: "ch_late", IdempotencyKey: timedOut.ID.String()}
+	found, err = service.FindPayment(ctx, late)
+	if err != nil || found.ID != timedOut.ID || found.ProviderPaymentID != "ch_late" {
+		t.Errorf("Expected payment %s linked to ch_late, got %v (err %v)", timedOut.ID, found, err)
+	}
+
+	// Test case 3: A key cannot claim a payment already linked to another charge
+	late.IdempotencyKey = collected.ID.String()
+	if _, err := service.FindPayment(ctx, late); err != errors.ErrPaymentNotFound {
+		t.Errorf("Expected error %v, got %v", errors.ErrPaymentNotFound, err)
+	}
+}
+
+func TestSetFailure(t *testing.T) {
+	failed := &models.Payment{}
+
+	// Test case 1: Short reasons are kept as they are
+	payment.SetFailure(failed, "card_declined", "Your card was declined.")
+	if failed.FailureCode != "card_declined" || failed.FailureMessage != "Your card was declined." {
+		t.Errorf("Expected the reasons to be kept, got %q and %q", failed.FailureCode, failed.FailureMessage)
+	}
+
+	// Test case 2: Long reasons are cut by character, not by byte
+	payment.SetFailure(failed, strings.Repeat("é", 60), strings.Repeat("€", 300))
+	if failed.FailureCode != strings.Repeat("é", 50) || failed.FailureMessage != strings.Repeat("€", 255) {
+		t.Errorf("Expected 50 and 255 whole characters, got %q and %q", failed.FailureCode, failed.FailureMessage)
+	}
+}
@@ -8,16 +8,19 @@ import (
 	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
 	"github.com/assylzhan-a/subscription-service/internal/domain/models"
 	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
 type Service struct {
 	repo repository.ProductRepository
+	// defaultCurrency is the currency of products created without one
+	defaultCurrency string
 }
 
-func NewService(repo repository.ProductRepository) *Service {
-	return &Service{repo: repo}
+func NewService(repo repository.ProductRepository, defaultCurrency string) *Service {
+	return &Service{repo: repo, defaultCurrency: defaultCurrency}
 }
 
 type CreateProductInput struct {
@@ -27,6 +30,17 @@ type CreateProductInput struct {
 	DurationMonths int
 	TaxRate        decimal.Decimal
 	IsActive       bool
+	MaxPauseDays   int
+	// Currency is the currency of Price and defaults to the service's default currency
+	Currency string
+	// Prices are the price points in other currencies
+	Prices []models.ProductPrice
+	// RefundPolicy defaults to models.RefundPolicyNone
+	RefundPolicy     models.RefundPolicy
+	RefundWindowDays int
+	// TaxCategory defaults to models.TaxCategoryStandard
+	TaxCategory  models.TaxCategory
+	TaxInclusive bool
 }
 
 func (i *CreateProductInput) Validate() errors.ValidationErrors {
@@ -60,23 +74,73 @@ func (i *CreateProductInput) Validate() errors.ValidationErrors {
 		})
 	}
 
+	if i.MaxPauseDays < 0 {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "max_pause_days",
+			Message: "must not be negative",
+		})
+	}
+
+	if i.RefundPolicy != "" && !i.RefundPolicy.IsValid() {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "refund_policy",
+			Message: "must be one of: none, prorated, full_within_days",
+		})
+	}
+
+	if i.RefundWindowDays < 0 {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "refund_window_days",
+			Message: "must not be negative",
+		})
+	} else if i.RefundPolicy == models.RefundPolicyFullWithinDays && i.RefundWindowDays == 0 {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "refund_window_days",
+			Message: "must be greater than 0 for the full_within_days refund policy",
+		})
+	}
+
+	if i.TaxCategory != "" && !i.TaxCategory.IsValid() {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "tax_category",
+			Message: "must be one of: standard, reduced, exempt",
+		})
+	}
+
+	if i.Currency != "" {
+		validationErrors = append(validationErrors, validatePricing(i.Currency, i.Price, i.Prices)...)
+	}
+
 	return validationErrors
 }
 
 func (s *Service) CreateProduct(ctx context.Context, input CreateProductInput) (*models.Product, error) {
+	input.Currency = currency.Normalize(input.Currency)
+	if input.Currency == "" {
+		input.Currency = s.defaultCurrency
+	}
+	input.Prices = normalizePrices(input.Prices)
+
 	// Validate input
 	if validationErrors := input.Validate(); len(validationErrors) > 0 {
 		return nil, validationErrors
 	}
 
 	product := &models.Product{
-		ID:             uuid.New(),
-		Name:           input.Name,
-		Description:    input.Description,
-		Price:          input.Price,
-		DurationMonths: input.DurationMonths,
-		TaxRate:        input.TaxRate,
-		IsActive:       input.IsActive,
+		ID:               uuid.New(),
+		Name:             input.Name,
+		Description:      input.Description,
+		Price:            input.Price,
+		Currency:         input.Currency,
+		Prices:           input.Prices,
+		DurationMonths:   input.DurationMonths,
+		TaxRate:          input.TaxRate,
+		IsActive:         input.IsActive,
+		MaxPauseDays:     input.MaxPauseDays,
+		RefundPolicy:     refundPolicyOrDefault(input.RefundPolicy),
+		RefundWindowDays: input.RefundWindowDays,
+		TaxCategory:      taxCategoryOrDefault(input.TaxCategory),
+		TaxInclusive:     input.TaxInclusive,
 	}
 
 	if err := s.repo.Create(ctx, product); err != nil {
@@ -106,6 +170,17 @@ type UpdateProductInput struct {
 	DurationMonths int
 	TaxRate        decimal.Decimal
 	IsActive       bool
+	MaxPauseDays   int
+	// Currency is the currency of Price and defaults to the product's current currency
+	Currency string
+	// Prices replace the price points in other currencies
+	Prices []models.ProductPrice
+	// RefundPolicy defaults to models.RefundPolicyNone
+	RefundPolicy     models.RefundPolicy
+	RefundWindowDays int
+	// TaxCategory defaults to models.TaxCategoryStandard
+	TaxCategory  models.TaxCategory
+	TaxInclusive bool
 }
 
 // Validate validates the input for updating a product
@@ -147,10 +222,50 @@ func (i *UpdateProductInput) Validate() errors.ValidationErrors {
 		})
 	}
 
+	if i.MaxPauseDays < 0 {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "max_pause_days",
+			Message: "must not be negative",
+		})
+	}
+
+	if i.RefundPolicy != "" && !i.RefundPolicy.IsValid() {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "refund_policy",
+			Message: "must be one of: none, prorated, full_within_days",
+		})
+	}
+
+	if i.RefundWindowDays < 0 {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "refund_window_days",
+			Message: "must not be negative",
+		})
+	} else if i.RefundPolicy == models.RefundPolicyFullWithinDays && i.RefundWindowDays == 0 {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "refund_window_days",
+			Message: "must be greater than 0 for the full_within_days refund policy",
+		})
+	}
+
+	if i.TaxCategory != "" && !i.TaxCategory.IsValid() {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "tax_category",
+			Message: "must be one of: standard, reduced, exempt",
+		})
+	}
+
+	if i.Currency != "" {
+		validationErrors = append(validationErrors, validatePricing(i.Currency, i.Price, i.Prices)...)
+	}
+
 	return validationErrors
 }
 
 func (s *Service) UpdateProduct(ctx context.Context, input UpdateProductInput) (*models.Product, error) {
+	input.Currency = currency.Normalize(input.Currency)
+	input.Prices = normalizePrices(input.Prices)
+
 	if validationErrors := input.Validate(); len(validationErrors) > 0 {
 		return nil, validationErrors
 	}
@@ -161,12 +276,26 @@ func (s *Service) UpdateProduct(ctx context.Context, input UpdateProductInput) (
 		return nil, err
 	}
 
+	if input.Currency == "" {
+		input.Currency = existingProduct.Currency
+		if validationErrors := validatePricing(input.Currency, input.Price, input.Prices); len(validationErrors) > 0 {
+			return nil, validationErrors
+		}
+	}
+
 	existingProduct.Name = input.Name
 	existingProduct.Description = input.Description
 	existingProduct.Price = input.Price
+	existingProduct.Currency = input.Currency
+	existingProduct.Prices = input.Prices
 	existingProduct.DurationMonths = input.DurationMonths
 	existingProduct.TaxRate = input.TaxRate
 	existingProduct.IsActive = input.IsActive
+	existingProduct.MaxPauseDays = input.MaxPauseDays
+	existingProduct.RefundPolicy = refundPolicyOrDefault(input.RefundPolicy)
+	existingProduct.RefundWindowDays = input.RefundWindowDays
+	existingProduct.TaxCategory = taxCategoryOrDefault(input.TaxCategory)
+	existingProduct.TaxInclusive = input.TaxInclusive
 
 	if err := s.repo.Update(ctx, existingProduct); err != nil {
 		return nil, fmt.Errorf("failed to update product: %w", err)
@@ -178,3 +307,85 @@ func (s *Service) UpdateProduct(ctx context.Context, input UpdateProductInput) (
 func (s *Service) DeleteProduct(ctx context.Context, id uuid.UUID) error {
 	return s.repo.Delete(ctx, id)
 }
+
+// refundPolicyOrDefault returns the policy, or no refunds if none is set
+func refundPolicyOrDefault(policy models.RefundPolicy) models.RefundPolicy {
+	if policy == "" {
+		return models.RefundPolicyNone
+	}
+	return policy
+}
+
+// taxCategoryOrDefault returns the category, or the standard category if none is set
+func taxCategoryOrDefault(category models.TaxCategory) models.TaxCategory {
+	if category == "" {
+		return models.TaxCategoryStandard
+	}
+	return category
+}
+
+// validatePricing validates a product's price in its currency and its price points
+// in other currencies
+func validatePricing(code string, price decimal.Decimal, prices []models.ProductPrice) errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	if !currency.Valid(code) {
+		return append(validationErrors, errors.ValidationError{
+			Field:   "currency",
+			Message: "must be a supported ISO 4217 currency code",
+		})
+	}
+
+	if !currency.IsRounded(price, code) {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "price",
+			Message: fmt.Sprintf("must not have more than %d decimal places in %s", currency.MinorUnits(code), code),
+		})
+	}
+
+	seen := map[string]bool{code: true}
+	for i, point := range prices {
+		field := fmt.Sprintf("prices[%d]", i)
+
+		switch {
+		case !currency.Valid(point.Currency):
+			validationErrors = append(validationErrors, errors.ValidationError{
+				Field:   field + ".currency",
+				Message: "must be a supported ISO 4217 currency code",
+			})
+			continue
+		case seen[point.Currency]:
+			validationErrors = append(validationErrors, errors.ValidationError{
+				Field:   field + ".currency",
+				Message: "must differ from the product's currency and the other price points",
+			})
+		}
+		seen[point.Currency] = true
+
+		if point.Amount.IsNegative() {
+			validationErrors = append(validationErrors, errors.ValidationError{
+				Field:   field + ".amount",
+				Message: "must not be negative",
+			})
+		} else if !currency.IsRounded(point.Amount, point.Currency) {
+			validationErrors = append(validationErrors, errors.ValidationError{
+				Field:   field + ".amount",
+				Message: fmt.Sprintf("must not have more than %d decimal places in %s", currency.MinorUnits(point.Currency), point.Currency),
+			})
+		}
+	}
+
+	return validationErrors
+}
+
+// normalizePrices returns a copy of the price points with normalized currency codes
+func normalizePrices(prices []models.ProductPrice) []models.ProductPrice {
+	normalized := make([]models.ProductPrice, 0, len(prices))
+	for _, price := range prices {
+		normalized = append(normalized, models.ProductPrice{
+			Currency: currency.Normalize(price.Currency),
+			Amount:   price.Amount,
+		})
+	}
+	return normalized
+}
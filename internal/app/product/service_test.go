@@ -62,7 +62,7 @@ func TestCreateProduct(t *testing.T) {
 	// Setup
 	ctx := context.Background()
 	repo := newMockProductRepository()
-	service := product.NewService(repo)
+	service := product.NewService(repo, "EUR")
 
 	// Test case 1: Create valid product
 	input := product.CreateProductInput{
@@ -162,13 +162,92 @@ func TestCreateProduct(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for empty name")
 	}
+
+	// Test case 6: Products default to no refunds
+	if p.RefundPolicy != models.RefundPolicyNone {
+		t.Errorf("Expected refund policy none, got %v", p.RefundPolicy)
+	}
+
+	// Test case 7: A refund window is required for full refunds within days
+	input = product.CreateProductInput{
+		Name:           "Refundable Product",
+		Price:          decimal.NewFromFloat(10.00),
+		DurationMonths: 1,
+		TaxRate:        decimal.NewFromFloat(0.20),
+		IsActive:       true,
+		RefundPolicy:   models.RefundPolicyFullWithinDays,
+	}
+
+	_, err = service.CreateProduct(ctx, input)
+	if err == nil {
+		t.Error("Expected error for missing refund window")
+	}
+
+	input.RefundWindowDays = 14
+	p, err = service.CreateProduct(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to create product:", err)
+	}
+
+	if p.RefundPolicy != models.RefundPolicyFullWithinDays || p.RefundWindowDays != 14 {
+		t.Errorf("Expected a 14 day refund window, got %v with %d days", p.RefundPolicy, p.RefundWindowDays)
+	}
+
+	// Test case 8: Products default to the standard tax category and unknown categories are rejected
+	if p.TaxCategory != models.TaxCategoryStandard || p.TaxInclusive {
+		t.Errorf("Expected the standard tax category without tax included, got %v (inclusive %v)", p.TaxCategory, p.TaxInclusive)
+	}
+
+	input.TaxCategory = "luxury"
+	_, err = service.CreateProduct(ctx, input)
+	if err == nil {
+		t.Error("Expected error for unknown tax category")
+	}
+
+	// Test case 9: Products are priced in the default currency unless given one, with price points in others
+	if p.Currency != "EUR" || len(p.Prices) != 0 {
+		t.Errorf("Expected a product priced in EUR only, got %s with %d price points", p.Currency, len(p.Prices))
+	}
+
+	input = product.CreateProductInput{
+		Name:           "International Product",
+		Price:          decimal.NewFromFloat(12.99),
+		Currency:       "usd",
+		Prices:         []models.ProductPrice{{Currency: "jpy", Amount: decimal.NewFromInt(1500)}},
+		DurationMonths: 1,
+	}
+
+	p, err = service.CreateProduct(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to create product:", err)
+	}
+
+	if jpy, ok := p.PriceIn("JPY"); p.Currency != "USD" || !ok || !jpy.Equal(decimal.NewFromInt(1500)) {
+		t.Errorf("Expected a USD product sold for 1500 JPY, got %s and %s", p.Currency, jpy)
+	}
+
+	if _, ok := p.PriceIn("EUR"); ok {
+		t.Error("Expected the product not to be sold in EUR")
+	}
+
+	// Test case 10: Prices must fit their currency's minor units and price points must not repeat a currency
+	input.Prices = []models.ProductPrice{
+		{Currency: "JPY", Amount: decimal.NewFromFloat(1500.5)},
+		{Currency: "USD", Amount: decimal.NewFromInt(13)},
+		{Currency: "XXX", Amount: decimal.NewFromInt(13)},
+	}
+	_, err = service.CreateProduct(ctx, input)
+	validationErrors, ok := err.(errors.ValidationErrors)
+	if !ok || len(validationErrors) != 3 {
+		t.Errorf("Expected 3 validation errors for the price points, got %v", err)
+	}
 }
 
 func TestGetProductByID(t *testing.T) {
 	// Setup
 	ctx := context.Background()
 	repo := newMockProductRepository()
-	service := product.NewService(repo)
+	service := product.NewService(repo, "EUR")
 
 	// Create a test product
 	testProduct := &models.Product{
@@ -216,7 +295,7 @@ func TestUpdateProduct(t *testing.T) {
 	// Setup
 	ctx := context.Background()
 	repo := newMockProductRepository()
-	service := product.NewService(repo)
+	service := product.NewService(repo, "EUR")
 
 	// Create a test product
 	testProduct := &models.Product{
@@ -224,6 +303,7 @@ func TestUpdateProduct(t *testing.T) {
 		Name:           "Original Name",
 		Description:    "Original Description",
 		Price:          decimal.NewFromFloat(19.99),
+		Currency:       "EUR",
 		DurationMonths: 1,
 		TaxRate:        decimal.NewFromFloat(0.20),
 		IsActive:       true,
@@ -293,13 +373,31 @@ func TestUpdateProduct(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for negative price")
 	}
+
+	// Test case 4: The product keeps its currency, whose minor units the price must fit
+	input.Price = decimal.NewFromFloat(29.999)
+	_, err = service.UpdateProduct(ctx, input)
+	if err == nil {
+		t.Error("Expected error for a price with more decimal places than EUR has")
+	}
+
+	input.Price = decimal.NewFromInt(3000)
+	input.Currency = "JPY"
+	p, err = service.UpdateProduct(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to update product:", err)
+	}
+
+	if p.Currency != "JPY" || !p.Price.Equal(decimal.NewFromInt(3000)) {
+		t.Errorf("Expected a price of 3000 JPY, got %s %s", p.Price, p.Currency)
+	}
 }
 
 func TestDeleteProduct(t *testing.T) {
 	// Setup
 	ctx := context.Background()
 	repo := newMockProductRepository()
-	service := product.NewService(repo)
+	service := product.NewService(repo, "EUR")
 
 	// Create a test product
 	testProduct := &models.Product{
@@ -348,7 +446,7 @@ func TestGetAllProducts(t *testing.T) {
 	// Setup
 	ctx := context.Background()
 	repo := newMockProductRepository()
-	service := product.NewService(repo)
+	service := product.NewService(repo, "EUR")
 
 	// Test with empty repository
 	products, err := service.GetAllProducts(ctx)
@@ -0,0 +1,212 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/exchange"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/shopspring/decimal"
+)
+
+// maxReportDays limits the period a report covers
+const maxReportDays = 366
+
+// Service reports the revenue of all currencies in the reporting currency
+type Service struct {
+	invoiceRepo    repository.InvoiceRepository
+	creditNoteRepo repository.CreditNoteRepository
+	rates          *exchange.Service
+}
+
+func NewService(invoiceRepo repository.InvoiceRepository, creditNoteRepo repository.CreditNoteRepository, rates *exchange.Service) *Service {
+	return &Service{
+		invoiceRepo:    invoiceRepo,
+		creditNoteRepo: creditNoteRepo,
+		rates:          rates,
+	}
+}
+
+type RevenueInput struct {
+	// From is the first day of the period and To the day after its last
+	From time.Time
+	To   time.Time
+}
+
+func (i *RevenueInput) Validate() errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	if i.From.IsZero() {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "from",
+			Message: "must not be empty",
+		})
+	}
+
+	if i.To.IsZero() {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "to",
+			Message: "must not be empty",
+		})
+	}
+
+	if !i.From.IsZero() && !i.To.IsZero() {
+		if !i.To.After(i.From) {
+			validationErrors = append(validationErrors, errors.ValidationError{
+				Field:   "to",
+				Message: "must be after from",
+			})
+		} else if i.To.Sub(i.From) > maxReportDays*24*time.Hour {
+			validationErrors = append(validationErrors, errors.ValidationError{
+				Field:   "to",
+				Message: fmt.Sprintf("must be at most %d days after from", maxReportDays),
+			})
+		}
+	}
+
+	return validationErrors
+}
+
+// Amounts are the revenue of a period: the totals of the invoices issued less the
+// totals of the credit notes that refunded them
+type Amounts struct {
+	Invoiced decimal.Decimal
+	Refunded decimal.Decimal
+	Net      decimal.Decimal
+}
+
+func (a *Amounts) add(invoiced, refunded decimal.Decimal) {
+	a.Invoiced = a.Invoiced.Add(invoiced)
+	a.Refunded = a.Refunded.Add(refunded)
+	a.Net = a.Invoiced.Sub(a.Refunded)
+}
+
+// CurrencyRevenue is the revenue in one currency, and the part of it that could be
+// converted in the reporting currency
+type CurrencyRevenue struct {
+	Currency  string
+	Amounts   Amounts
+	Converted Amounts
+}
+
+// MissingRate is a currency and day records were issued in and on that no exchange
+// rate is known for
+type MissingRate struct {
+	Currency string
+	Date     time.Time
+}
+
+// RevenueReport is the revenue of a period in the reporting currency. Records are
+// converted at the rate stored with them, or at the rate of the day they were issued
+// if they have none. Records no rate is known for are left out of the totals and
+// listed by currency and day in MissingRates.
+type RevenueReport struct {
+	From              time.Time
+	To                time.Time
+	ReportingCurrency string
+	Totals            Amounts
+	Currencies        []*CurrencyRevenue
+	MissingRates      []MissingRate
+}
+
+func (s *Service) GetRevenueReport(ctx context.Context, input RevenueInput) (*RevenueReport, error) {
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	invoices, err := s.invoiceRepo.GetIssuedBetween(ctx, input.From, input.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invoices: %w", err)
+	}
+
+	creditNotes, err := s.creditNoteRepo.GetIssuedBetween(ctx, input.From, input.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credit notes: %w", err)
+	}
+
+	report := &RevenueReport{
+		From:              input.From,
+		To:                input.To,
+		ReportingCurrency: s.rates.ReportingCurrency(),
+	}
+	builder := &revenueBuilder{
+		report:     report,
+		currencies: make(map[string]*CurrencyRevenue),
+		missing:    make(map[MissingRate]bool),
+	}
+
+	for _, issued := range invoices {
+		err := builder.add(ctx, s.rates, issued.Currency, issued.ExchangeRate, issued.IssuedAt, issued.Total, decimal.Zero)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, creditNote := range creditNotes {
+		err := builder.add(ctx, s.rates, creditNote.Currency, creditNote.ExchangeRate, creditNote.IssuedAt, decimal.Zero, creditNote.Total)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(report.Currencies, func(i, j int) bool {
+		return report.Currencies[i].Currency < report.Currencies[j].Currency
+	})
+	sort.Slice(report.MissingRates, func(i, j int) bool {
+		a, b := report.MissingRates[i], report.MissingRates[j]
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		return a.Date.Before(b.Date)
+	})
+
+	return report, nil
+}
+
+type revenueBuilder struct {
+	report     *RevenueReport
+	currencies map[string]*CurrencyRevenue
+	missing    map[MissingRate]bool
+}
+
+// add adds a record's invoiced and refunded amounts to the report
+func (b *revenueBuilder) add(
+	ctx context.Context,
+	rates *exchange.Service,
+	currencyCode string,
+	stored *models.ExchangeRateSnapshot,
+	issuedAt time.Time,
+	invoiced, refunded decimal.Decimal,
+) error {
+	revenue, ok := b.currencies[currencyCode]
+	if !ok {
+		revenue = &CurrencyRevenue{Currency: currencyCode}
+		b.currencies[currencyCode] = revenue
+		b.report.Currencies = append(b.report.Currencies, revenue)
+	}
+	revenue.Amounts.add(invoiced, refunded)
+
+	rate, err := rates.RecordRate(ctx, stored, currencyCode, issuedAt)
+	if err != nil {
+		if err != errors.ErrExchangeRateNotFound {
+			return err
+		}
+
+		year, month, day := issuedAt.UTC().Date()
+		missing := MissingRate{Currency: currencyCode, Date: time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+		if !b.missing[missing] {
+			b.missing[missing] = true
+			b.report.MissingRates = append(b.report.MissingRates, missing)
+		}
+		return nil
+	}
+
+	convertedInvoiced, convertedRefunded := rate.Convert(invoiced), rate.Convert(refunded)
+	revenue.Converted.add(convertedInvoiced, convertedRefunded)
+	b.report.Totals.add(convertedInvoiced, convertedRefunded)
+	return nil
+}
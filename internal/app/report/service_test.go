@@ -0,0 +1,135 @@
+package report_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/exchange"
+	"github.com/assylzhan-a/subscription-service/internal/app/report"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type mockInvoiceRepository struct {
+	repository.InvoiceRepository
+	invoices []*models.Invoice
+}
+
+func (m *mockInvoiceRepository) GetIssuedBetween(ctx context.Context, start, end time.Time) ([]*models.Invoice, error) {
+	var result []*models.Invoice
+	for _, invoice := range m.invoices {
+		if !invoice.IssuedAt.Before(start) && invoice.IssuedAt.Before(end) {
+			result = append(result, invoice)
+		}
+	}
+	return result, nil
+}
+
+type mockCreditNoteRepository struct {
+	repository.CreditNoteRepository
+	creditNotes []*models.CreditNote
+}
+
+func (m *mockCreditNoteRepository) GetIssuedBetween(ctx context.Context, start, end time.Time) ([]*models.CreditNote, error) {
+	var result []*models.CreditNote
+	for _, creditNote := range m.creditNotes {
+		if !creditNote.IssuedAt.Before(start) && creditNote.IssuedAt.Before(end) {
+			result = append(result, creditNote)
+		}
+	}
+	return result, nil
+}
+
+type mockExchangeRateRepository struct {
+	repository.ExchangeRateRepository
+	rates []*models.ExchangeRate
+}
+
+func (m *mockExchangeRateRepository) GetLatest(ctx context.Context, base, currency string, on time.Time) (*models.ExchangeRate, error) {
+	var latest *models.ExchangeRate
+	for _, rate := range m.rates {
+		if rate.Base == base && rate.Currency == currency && !rate.Date.After(on) && (latest == nil || rate.Date.After(latest.Date)) {
+			latest = rate
+		}
+	}
+	if latest == nil {
+		return nil, errors.ErrExchangeRateNotFound
+	}
+	return latest, nil
+}
+
+func date(day int) time.Time {
+	return time.Date(2025, 3, day, 0, 0, 0, 0, time.UTC)
+}
+
+func amount(value string) decimal.Decimal {
+	return decimal.RequireFromString(value)
+}
+
+func TestGetRevenueReport(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	rates := exchange.NewService(&mockExchangeRateRepository{rates: []*models.ExchangeRate{
+		{Date: date(3), Base: "EUR", Currency: "USD", Rate: amount("1.25")},
+	}}, "EUR", "EUR")
+
+	invoices := &mockInvoiceRepository{invoices: []*models.Invoice{
+		{ID: uuid.New(), Currency: "EUR", Total: amount("20"), IssuedAt: date(3).Add(time.Hour)},
+		// Converted at the rate of the day it was issued
+		{ID: uuid.New(), Currency: "USD", Total: amount("50"), IssuedAt: date(4)},
+		// Converted at its stored rate
+		{ID: uuid.New(), Currency: "USD", Total: amount("10"), IssuedAt: date(5), ExchangeRate: &models.ExchangeRateSnapshot{
+			ReportingCurrency: "EUR",
+			Rate:              amount("0.9"),
+			Date:              date(5),
+		}},
+		{ID: uuid.New(), Currency: "GBP", Total: amount("30"), IssuedAt: date(6)},
+		// Outside the period
+		{ID: uuid.New(), Currency: "EUR", Total: amount("99"), IssuedAt: date(10)},
+	}}
+	creditNotes := &mockCreditNoteRepository{creditNotes: []*models.CreditNote{
+		{ID: uuid.New(), Currency: "USD", Total: amount("5"), IssuedAt: date(7)},
+	}}
+
+	service := report.NewService(invoices, creditNotes, rates)
+
+	// Test case 1: Revenue is totalled in the reporting currency
+	revenue, err := service.GetRevenueReport(ctx, report.RevenueInput{From: date(1), To: date(10)})
+	if err != nil {
+		t.Fatal("Failed to get revenue report:", err)
+	}
+
+	// 20 EUR + 50 USD / 1.25 + 10 USD * 0.9 - 5 USD / 1.25
+	if !revenue.Totals.Invoiced.Equal(amount("69")) || !revenue.Totals.Refunded.Equal(amount("4")) || !revenue.Totals.Net.Equal(amount("65")) {
+		t.Errorf("Expected 69 EUR invoiced, 4 EUR refunded and 65 EUR net, got %+v", revenue.Totals)
+	}
+
+	if len(revenue.Currencies) != 3 || revenue.Currencies[2].Currency != "USD" {
+		t.Fatalf("Expected revenue in EUR, GBP and USD, got %d currencies", len(revenue.Currencies))
+	}
+
+	usd := revenue.Currencies[2]
+	if !usd.Amounts.Net.Equal(amount("55")) || !usd.Converted.Net.Equal(amount("45")) {
+		t.Errorf("Expected 55 USD worth 45 EUR, got %s worth %s", usd.Amounts.Net, usd.Converted.Net)
+	}
+
+	// Test case 2: Records no rate is known for are listed and left out of the totals
+	if len(revenue.MissingRates) != 1 || revenue.MissingRates[0].Currency != "GBP" || !revenue.MissingRates[0].Date.Equal(date(6)) {
+		t.Errorf("Expected the GBP rate of 2025-03-06 to be missing, got %+v", revenue.MissingRates)
+	}
+
+	gbp := revenue.Currencies[1]
+	if !gbp.Amounts.Invoiced.Equal(amount("30")) || !gbp.Converted.Invoiced.IsZero() {
+		t.Errorf("Expected 30 GBP that could not be converted, got %+v", gbp)
+	}
+
+	// Test case 3: The period must end after it starts
+	_, err = service.GetRevenueReport(ctx, report.RevenueInput{From: date(10), To: date(1)})
+	if _, ok := err.(errors.ValidationErrors); !ok {
+		t.Errorf("Expected validation errors, got %v", err)
+	}
+}
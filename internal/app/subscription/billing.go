@@ -0,0 +1,139 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/ledger"
+	"github.com/assylzhan-a/subscription-service/internal/app/payment"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/shopspring/decimal"
+)
+
+// chargeInvoice collects an invoice's total from the subscriber, paying as much of it as
+// possible from their credit balance first. See payment.Service.Charge for what is
+// returned when the charge fails. A past due subscription's charge is numbered after
+// its failed attempts.
+func (s *Service) chargeInvoice(ctx context.Context, subscription *models.Subscription, billed *models.Invoice) (*models.Payment, error) {
+	if err := s.applyCredit(ctx, billed); err != nil {
+		return nil, err
+	}
+
+	return s.payments.Charge(ctx, payment.ChargeInput{
+		UserID:         subscription.UserID,
+		SubscriptionID: subscription.ID,
+		InvoiceID:      &billed.ID,
+		Reason:         billed.Reason,
+		Attempt:        subscription.FailedPaymentAttempts + 1,
+		Amount:         billed.AmountDue(),
+		Currency:       billed.Currency,
+		Description:    billed.Lines[0].Description,
+	})
+}
+
+// applyCredit sets the part of an invoice the user's credit balance in the invoice's
+// currency pays for. The balance is only debited when the invoice is saved. If another
+// invoice used the credit in the meantime, saving fails with ErrInsufficientCredit
+// and the caller refunds the charge, see refundUnsaved.
+func (s *Service) applyCredit(ctx context.Context, billed *models.Invoice) error {
+	billed.CreditApplied = decimal.Zero
+	if !billed.Total.IsPositive() {
+		return nil
+	}
+
+	var balance decimal.Decimal
+	err := s.uow.Do(ctx, func(tx repository.Transaction) error {
+		var err error
+		balance, err = tx.Credits().GetBalance(ctx, billed.UserID, billed.Currency)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get credit balance: %w", err)
+	}
+
+	billed.CreditApplied = decimal.Min(balance, billed.Total)
+	return nil
+}
+
+// saveBilling saves an invoice and the payment that paid it; either may be nil. The
+// credit applied to the invoice is taken from the user's balance. Both are saved with
+// the exchange rate to the reporting currency of the day and posted to the ledger.
+func (s *Service) saveBilling(ctx context.Context, tx repository.Transaction, billed *models.Invoice, paid *models.Payment) error {
+	if billed != nil {
+		billed.ExchangeRate = s.exchangeRate(ctx, billed.Currency, billed.IssuedAt)
+		if err := tx.Invoices().Create(ctx, billed); err != nil {
+			return fmt.Errorf("failed to create invoice: %w", err)
+		}
+
+		if billed.CreditApplied.IsPositive() {
+			if err := tx.Credits().AddEntry(ctx, &models.CreditEntry{
+				UserID:      billed.UserID,
+				Type:        models.CreditEntryTypeDebit,
+				Amount:      billed.CreditApplied,
+				Currency:    billed.Currency,
+				Reason:      models.CreditEntryReasonInvoice,
+				ReferenceID: &billed.ID,
+				Note:        billed.Number,
+			}); err != nil {
+				return fmt.Errorf("failed to apply credit: %w", err)
+			}
+		}
+
+		if err := ledger.Post(ctx, tx.Ledger(), ledger.InvoiceEntry(billed)); err != nil {
+			return err
+		}
+	}
+
+	if paid != nil {
+		paid.ExchangeRate = s.exchangeRate(ctx, paid.Currency, time.Now())
+		if err := tx.Payments().Create(ctx, paid); err != nil {
+			return fmt.Errorf("failed to save payment: %w", err)
+		}
+
+		if paid.Status == models.PaymentStatusSucceeded && paid.InvoiceID != nil {
+			if err := ledger.Post(ctx, tx.Ledger(), ledger.PaymentEntry(paid, paid.Amount)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// refundUnsaved refunds a collected charge that could not be saved, e.g. because the
+// subscription changed while it was being charged. Nothing records the charge
+// otherwise, and the subscription is charged again when it is retried.
+func (s *Service) refundUnsaved(ctx context.Context, subscription *models.Subscription, paid *models.Payment) {
+	if paid == nil || paid.Status != models.PaymentStatusSucceeded {
+		return
+	}
+
+	if err := s.payments.Refund(ctx, paid); err != nil {
+		log.Printf("Failed to refund payment %s of subscription %s that was not saved: %v", paid.ID, subscription.ID, err)
+	}
+}
+
+// saveFailedPayment records a charge that was not collected. No invoice is issued
+// for it, so it is not linked to one.
+func (s *Service) saveFailedPayment(ctx context.Context, tx repository.Transaction, failed *models.Payment) error {
+	failed.InvoiceID = nil
+	return s.saveBilling(ctx, tx, nil, failed)
+}
+
+// exchangeRate returns the rate to convert an amount in the currency to the reporting
+// currency with on the day of on, or nil if none is known. Billing does not depend on
+// rates being imported; reports convert records without a rate when they are.
+func (s *Service) exchangeRate(ctx context.Context, currency string, on time.Time) *models.ExchangeRateSnapshot {
+	rate, err := s.rates.Rate(ctx, currency, on)
+	if err != nil {
+		if err != errors.ErrExchangeRateNotFound {
+			log.Printf("Failed to get exchange rate of %s on %s: %v", currency, on.Format("2006-01-02"), err)
+		}
+		return nil
+	}
+	return rate
+}
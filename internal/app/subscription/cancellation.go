@@ -0,0 +1,171 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+)
+
+// CancelMode controls when a cancellation takes effect
+type CancelMode string
+
+const (
+	CancelImmediately CancelMode = "immediately"
+	CancelAtPeriodEnd CancelMode = "at_period_end"
+)
+
+// maxCancellationReasonLength limits the free-text reason a customer can leave
+const maxCancellationReasonLength = 1000
+
+type CancelSubscriptionInput struct {
+	SubscriptionID uuid.UUID
+	Mode           CancelMode
+	Reason         string
+	Feedback       models.CancellationFeedback
+}
+
+func (i *CancelSubscriptionInput) Validate() errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	if i.SubscriptionID == uuid.Nil {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "subscription_id",
+			Message: "must not be empty",
+		})
+	}
+
+	if i.Mode != CancelImmediately && i.Mode != CancelAtPeriodEnd {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "mode",
+			Message: "must be one of: immediately, at_period_end",
+		})
+	}
+
+	if len(i.Reason) > maxCancellationReasonLength {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "reason",
+			Message: fmt.Sprintf("must not be longer than %d characters", maxCancellationReasonLength),
+		})
+	}
+
+	if i.Feedback != "" && !i.Feedback.IsValid() {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "feedback",
+			Message: "is not a known feedback category",
+		})
+	}
+
+	return validationErrors
+}
+
+// Cancel cancels a subscription. Cancelling at period end keeps the subscription
+// active until EndDate; the cancellation job then finalizes it. Cancelling
+// immediately refunds the paid period as the product's refund policy allows. The
+// reason and feedback are stored on the state change for churn analysis.
+func (s *Service) Cancel(ctx context.Context, input CancelSubscriptionInput) (*models.Subscription, error) {
+	// Validate input
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	subscription, err := s.repo.GetByID(ctx, input.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cancelling twice is a no-op
+	if subscription.Status == models.SubscriptionStatusCancelled {
+		return subscription, nil // Already cancelled, nothing to do
+	}
+
+	opts := transitionOptions{
+		CancellationReason: strings.TrimSpace(input.Reason),
+		Feedback:           input.Feedback,
+	}
+
+	if input.Mode == CancelAtPeriodEnd {
+		opts.Reason = fmt.Sprintf("User scheduled cancellation at period end (%s)", subscription.EndDate.Format(time.RFC3339))
+		if err := s.transition(ctx, subscription, ActionScheduleCancel, opts); err != nil {
+			return nil, err
+		}
+		return subscription, nil
+	}
+
+	now := time.Now()
+	if err := checkTransition(subscription, ActionCancel, now); err != nil {
+		return nil, err
+	}
+
+	// The cancellation is requested now, even if one was scheduled before
+	subscription.CancelledAt = nil
+	opts.At = now
+	opts.Reason = "User requested cancellation"
+	if err := s.transition(ctx, subscription, ActionCancel, opts); err != nil {
+		return nil, err
+	}
+
+	// The cancellation stands if the refund fails; support can still refund the invoice
+	if err := s.refundCancellation(ctx, subscription, now); err != nil {
+		log.Printf("Failed to refund cancelled subscription %s: %v", subscription.ID, err)
+	}
+
+	return subscription, nil
+}
+
+// UndoCancellation keeps a subscription that was scheduled to cancel at period end
+func (s *Service) UndoCancellation(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	subscription, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.transition(ctx, subscription, ActionUndoCancel, transitionOptions{
+		Reason: "User undid scheduled cancellation",
+	}); err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+// ProcessCancellations cancels every subscription scheduled to cancel whose period
+// has ended. Like ProcessRenewals it is safe to run on several replicas.
+func (s *Service) ProcessCancellations(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	processed := 0
+
+	for {
+		subscriptions, err := s.repo.ClaimDueForCancellation(ctx, time.Now(), claimLease, batchSize)
+		if err != nil {
+			return processed, fmt.Errorf("failed to claim subscriptions to cancel: %w", err)
+		}
+
+		for _, subscription := range subscriptions {
+			if err := s.finalizeCancellation(ctx, subscription); err != nil {
+				// The lease runs out and a later run retries the subscription
+				log.Printf("Failed to cancel subscription %s: %v", subscription.ID, err)
+				continue
+			}
+			processed++
+		}
+
+		if len(subscriptions) < batchSize {
+			return processed, nil
+		}
+	}
+}
+
+func (s *Service) finalizeCancellation(ctx context.Context, subscription *models.Subscription) error {
+	return s.transition(ctx, subscription, ActionCancel, transitionOptions{
+		Reason: "Scheduled cancellation at period end",
+	})
+}
@@ -0,0 +1,231 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/google/uuid"
+)
+
+// DunningPolicy is how the failed renewal payment of a past due subscription is retried
+type DunningPolicy struct {
+	// RetryAfter lists when the charge is retried, counted from the end of the unpaid
+	// period, in increasing order
+	RetryAfter []time.Duration
+	// FinalAction is taken when the last retry fails: ActionCancel or ActionSuspend
+	FinalAction Action
+}
+
+// DefaultDunningPolicy retries after 1, 3 and 7 days and then cancels the subscription
+func DefaultDunningPolicy() DunningPolicy {
+	return DunningPolicy{
+		RetryAfter: []time.Duration{
+			24 * time.Hour,
+			3 * 24 * time.Hour,
+			7 * 24 * time.Hour,
+		},
+		FinalAction: ActionCancel,
+	}
+}
+
+// nextAttempt returns when the charge is retried after the given number of failed
+// attempts, or nil when no retries are left. A retry is never scheduled before now.
+func (p DunningPolicy) nextAttempt(subscription *models.Subscription, failedAttempts int, now time.Time) *time.Time {
+	if failedAttempts < 1 || failedAttempts > len(p.RetryAfter) {
+		return nil
+	}
+
+	next := subscription.EndDate.Add(p.RetryAfter[failedAttempts-1])
+	if next.Before(now) {
+		next = now
+	}
+	return &next
+}
+
+// endDunning clears the retry schedule of a subscription that is no longer past due
+func endDunning(subscription *models.Subscription) {
+	subscription.FailedPaymentAttempts = 0
+	subscription.NextPaymentAttemptAt = nil
+}
+
+// markPastDue puts a subscription whose renewal payment failed past due and schedules
+// the first retry
+func (s *Service) markPastDue(ctx context.Context, subscription *models.Subscription, failed *models.Payment, now time.Time) error {
+	subscription.FailedPaymentAttempts = 1
+	subscription.NextPaymentAttemptAt = s.dunning.nextAttempt(subscription, 1, now)
+
+	return s.transition(ctx, subscription, ActionMarkPastDue, transitionOptions{
+		At:         now,
+		Reason:     fmt.Sprintf("Renewal payment failed: %s%s", failed.FailureCode, retryNote(subscription)),
+		ReasonCode: models.StateChangeReasonRenewalPaymentFailed,
+		Write: func(tx repository.Transaction) error {
+			return s.saveFailedPayment(ctx, tx, failed)
+		},
+	})
+}
+
+// ProcessPaymentRetries charges every past due subscription whose next payment attempt
+// is due. Like ProcessRenewals it claims subscriptions in batches and is safe to run
+// on several replicas.
+func (s *Service) ProcessPaymentRetries(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	processed := 0
+
+	for {
+		subscriptions, err := s.repo.ClaimDueForPaymentRetry(ctx, time.Now(), claimLease, batchSize)
+		if err != nil {
+			return processed, fmt.Errorf("failed to claim subscriptions for payment retry: %w", err)
+		}
+
+		for _, subscription := range subscriptions {
+			if err := s.retryPayment(ctx, subscription); err != nil {
+				// The lease runs out and a later run retries the subscription
+				log.Printf("Failed to retry payment of subscription %s: %v", subscription.ID, err)
+				continue
+			}
+			processed++
+		}
+
+		if len(subscriptions) < batchSize {
+			return processed, nil
+		}
+	}
+}
+
+// retryPayment charges the renewal of a past due subscription again. The subscription
+// recovers into the next period if the charge succeeds. Otherwise the next retry is
+// scheduled, or the policy's final action is taken when no retries are left.
+// A subscription scheduled to cancel is cancelled instead of charged.
+func (s *Service) retryPayment(ctx context.Context, subscription *models.Subscription) error {
+	if subscription.CancelAtPeriodEnd {
+		return s.finalizeCancellation(ctx, subscription)
+	}
+
+	// A subscription whose collected payment was reversed has no failed renewal to retry
+	if subscription.FailedPaymentAttempts == 0 {
+		return s.expireSubscription(ctx, subscription, "Period ended while its payment was reversed or disputed")
+	}
+
+	if !subscription.AutoRenew {
+		return s.expireSubscription(ctx, subscription, "Auto-renewal turned off while the renewal payment was past due")
+	}
+
+	product, err := s.renewalProduct(ctx, subscription)
+	if err != nil {
+		return err
+	}
+
+	if !product.IsActive {
+		return s.expireSubscription(ctx, subscription, "Product is no longer active")
+	}
+
+	if _, ok := product.PriceIn(subscription.Currency); !ok {
+		return s.expireSubscription(ctx, subscription, fmt.Sprintf("Product is no longer sold in %s", subscription.Currency))
+	}
+
+	now := time.Now()
+	if err := checkTransition(subscription, ActionRecover, now); err != nil {
+		return err
+	}
+
+	// The subscription is only rolled into the next period if the charge succeeds
+	previous := *subscription
+
+	renewalInvoice, err := s.rollOver(ctx, subscription, product, now)
+	if err != nil {
+		return err
+	}
+
+	renewalPayment, err := s.chargeInvoice(ctx, subscription, renewalInvoice)
+	if err != nil {
+		if renewalPayment == nil {
+			return err
+		}
+
+		*subscription = previous
+		return s.retryFailed(ctx, subscription, renewalPayment, now)
+	}
+
+	err = s.transition(ctx, subscription, ActionRecover, transitionOptions{
+		At:         now,
+		Reason:     fmt.Sprintf("Renewal payment retry succeeded, subscription renewed until %s", subscription.EndDate.Format(time.RFC3339)),
+		ReasonCode: models.StateChangeReasonPaymentRecovered,
+		Write: func(tx repository.Transaction) error {
+			return s.saveBilling(ctx, tx, renewalInvoice, renewalPayment)
+		},
+	})
+	if err != nil {
+		s.refundUnsaved(ctx, subscription, renewalPayment)
+	}
+	return err
+}
+
+// retryFailed records a failed retry and schedules the next one, or takes the
+// policy's final action when no retries are left
+func (s *Service) retryFailed(ctx context.Context, subscription *models.Subscription, failed *models.Payment, now time.Time) error {
+	subscription.FailedPaymentAttempts++
+	next := s.dunning.nextAttempt(subscription, subscription.FailedPaymentAttempts, now)
+
+	if next != nil {
+		subscription.NextPaymentAttemptAt = next
+		return s.transition(ctx, subscription, ActionRetryPayment, transitionOptions{
+			At: now,
+			Reason: fmt.Sprintf("Renewal payment retry %d failed: %s%s",
+				subscription.FailedPaymentAttempts-1, failed.FailureCode, retryNote(subscription)),
+			ReasonCode: models.StateChangeReasonPaymentRetryFailed,
+			Write: func(tx repository.Transaction) error {
+				return s.saveFailedPayment(ctx, tx, failed)
+			},
+		})
+	}
+
+	reason := fmt.Sprintf("Renewal payment failed %d times: %s", subscription.FailedPaymentAttempts, failed.FailureCode)
+
+	if s.dunning.FinalAction == ActionSuspend {
+		return s.transition(ctx, subscription, ActionSuspend, transitionOptions{
+			At:         now,
+			Reason:     reason,
+			ReasonCode: models.StateChangeReasonDunningExhausted,
+			Write: func(tx repository.Transaction) error {
+				if err := s.saveFailedPayment(ctx, tx, failed); err != nil {
+					return err
+				}
+				// Record the pause for the history
+				pause := &models.SubscriptionPause{
+					ID:             uuid.New(),
+					SubscriptionID: subscription.ID,
+					PausedAt:       *subscription.PausedAt,
+				}
+				if err := tx.Subscriptions().CreatePause(ctx, pause); err != nil {
+					return fmt.Errorf("failed to record pause: %w", err)
+				}
+				return nil
+			},
+		})
+	}
+
+	return s.transition(ctx, subscription, ActionCancel, transitionOptions{
+		At:                 now,
+		Reason:             reason,
+		ReasonCode:         models.StateChangeReasonDunningExhausted,
+		CancellationReason: "Renewal payment could not be collected",
+		Write: func(tx repository.Transaction) error {
+			return s.saveFailedPayment(ctx, tx, failed)
+		},
+	})
+}
+
+// retryNote describes when the failed payment of a subscription is retried next
+func retryNote(subscription *models.Subscription) string {
+	if subscription.NextPaymentAttemptAt == nil {
+		return ""
+	}
+	return fmt.Sprintf(", retrying at %s", subscription.NextPaymentAttemptAt.Format(time.RFC3339))
+}
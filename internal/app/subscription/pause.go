@@ -0,0 +1,69 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+)
+
+// PauseHistory lists a subscription's pauses, newest first
+type PauseHistory struct {
+	Pauses      []*models.SubscriptionPause
+	TotalPaused time.Duration
+}
+
+// GetPauseHistory returns every pause of a subscription and the total time paused
+func (s *Service) GetPauseHistory(ctx context.Context, id uuid.UUID) (*PauseHistory, error) {
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	pauses, err := s.repo.GetPausesBySubscriptionID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pauses: %w", err)
+	}
+
+	history := &PauseHistory{Pauses: pauses}
+
+	now := time.Now()
+	for _, pause := range pauses {
+		history.TotalPaused += pause.Duration(now)
+	}
+
+	return history, nil
+}
+
+// ProcessResumes resumes every paused subscription whose resume date has arrived.
+// Like ProcessRenewals it claims subscriptions in batches and is safe to run on
+// several replicas.
+func (s *Service) ProcessResumes(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	processed := 0
+
+	for {
+		subscriptions, err := s.repo.ClaimDueForResume(ctx, time.Now(), claimLease, batchSize)
+		if err != nil {
+			return processed, fmt.Errorf("failed to claim subscriptions to resume: %w", err)
+		}
+
+		for _, subscription := range subscriptions {
+			if err := s.resumeSubscription(ctx, subscription, "Scheduled resume"); err != nil {
+				// The lease runs out and a later run retries the subscription
+				log.Printf("Failed to resume subscription %s: %v", subscription.ID, err)
+				continue
+			}
+			processed++
+		}
+
+		if len(subscriptions) < batchSize {
+			return processed, nil
+		}
+	}
+}
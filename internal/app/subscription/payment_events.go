@@ -0,0 +1,294 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/ledger"
+	"github.com/assylzhan-a/subscription-service/internal/app/payment"
+	"github.com/assylzhan-a/subscription-service/internal/app/tax"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/shopspring/decimal"
+)
+
+// The handlers below apply payment webhook events. Providers deliver events more
+// than once and out of order, so each handler leaves a payment alone once it has
+// reached the state the event reports.
+
+// HandlePaymentSucceeded applies a charge that was collected after it was reported
+// as pending, failed or needing authentication. If the charge was for a renewal
+// of a subscription that is still past due, the subscription recovers into the
+// period the charge pays for. Otherwise nothing was issued for the charge any
+// more, e.g. the trial it would have ended was cancelled, and it is refunded.
+func (s *Service) HandlePaymentSucceeded(ctx context.Context, event *payment.Event) error {
+	paid, subscription, err := s.eventPayment(ctx, event)
+	if err != nil || paid == nil {
+		return err
+	}
+
+	switch paid.Status {
+	case models.PaymentStatusSucceeded, models.PaymentStatusRefunded, models.PaymentStatusDisputed:
+		return nil
+	}
+
+	paid.Status = models.PaymentStatusSucceeded
+	paid.FailureCode = ""
+	paid.FailureMessage = ""
+
+	switch {
+	case paid.InvoiceID != nil:
+		return s.uow.Do(ctx, func(tx repository.Transaction) error {
+			if err := updatePayment(ctx, tx, paid, models.InvoicePaymentStatusPaid); err != nil {
+				return err
+			}
+			return ledger.Post(ctx, tx.Ledger(), ledger.PaymentEntry(paid, paid.Refundable()))
+		})
+	case paid.Reason == models.InvoiceReasonRenewal && subscription != nil && subscription.Status == models.SubscriptionStatusPastDue:
+		return s.recoverSubscription(ctx, subscription, paid)
+	default:
+		if err := s.payments.Refund(ctx, paid); err != nil {
+			return err
+		}
+		log.Printf("Refunded payment %s of subscription %s that was collected after its %s was given up",
+			paid.ID, paid.SubscriptionID, paid.Reason)
+
+		return s.uow.Do(ctx, func(tx repository.Transaction) error {
+			return updatePayment(ctx, tx, paid, "")
+		})
+	}
+}
+
+// HandlePaymentFailed applies a charge that failed after it was reported as pending
+// or collected. A collected payment that is reversed puts its subscription past due.
+func (s *Service) HandlePaymentFailed(ctx context.Context, event *payment.Event) error {
+	paid, subscription, err := s.eventPayment(ctx, event)
+	if err != nil || paid == nil {
+		return err
+	}
+
+	if paid.Status != models.PaymentStatusPending && paid.Status != models.PaymentStatusRequiresAction &&
+		paid.Status != models.PaymentStatusSucceeded {
+		return nil
+	}
+
+	// A charge that was pending was already handled as failed when it was made
+	reversed := paid.Status == models.PaymentStatusSucceeded
+	collected := paid.Refundable()
+
+	paid.Status = models.PaymentStatusFailed
+	payment.SetFailure(paid, event.FailureCode, event.FailureMessage)
+
+	if !reversed {
+		return s.uow.Do(ctx, func(tx repository.Transaction) error {
+			return updatePayment(ctx, tx, paid, "")
+		})
+	}
+
+	return s.suspendForPayment(ctx, subscription, paid, collected, models.InvoicePaymentStatusFailed,
+		fmt.Sprintf("Payment failed after it was collected: %s", paid.FailureCode), models.StateChangeReasonPaymentReversed)
+}
+
+// HandlePaymentRefunded records a refund made at the provider. Partial refunds are
+// recorded with credit notes when they are made; only a full refund made at the
+// provider changes the payment and its invoice.
+func (s *Service) HandlePaymentRefunded(ctx context.Context, event *payment.Event) error {
+	paid, _, err := s.eventPayment(ctx, event)
+	if err != nil || paid == nil {
+		return err
+	}
+
+	if paid.Status == models.PaymentStatusRefunded {
+		return nil
+	}
+
+	if event.Amount.IsPositive() && event.Amount.LessThan(paid.Amount) {
+		log.Printf("Payment %s was partially refunded (%s of %s)", paid.ID, event.Amount, paid.Amount)
+		return nil
+	}
+
+	// Only money that was still collected is paid back
+	refunded := paid.Refundable()
+
+	paid.Status = models.PaymentStatusRefunded
+	paid.RefundedAmount = paid.Amount
+	return s.uow.Do(ctx, func(tx repository.Transaction) error {
+		if err := updatePayment(ctx, tx, paid, models.InvoicePaymentStatusRefunded); err != nil {
+			return err
+		}
+		if !refunded.IsPositive() || paid.InvoiceID == nil {
+			return nil
+		}
+
+		refundedInvoice, err := tx.Invoices().GetByID(ctx, *paid.InvoiceID)
+		if err != nil {
+			return fmt.Errorf("failed to get invoice: %w", err)
+		}
+		subtotal, taxAmount := splitTax(refunded, refundedInvoice)
+		return postRefund(ctx, tx, paid.ID, refundedInvoice, subtotal, taxAmount,
+			fmt.Sprintf("Payment %s refunded at the provider", paid.ID))
+	})
+}
+
+// HandlePaymentDisputed records a chargeback the customer opened with their bank.
+// The subscription is put past due until the dispute is resolved.
+func (s *Service) HandlePaymentDisputed(ctx context.Context, event *payment.Event) error {
+	paid, subscription, err := s.eventPayment(ctx, event)
+	if err != nil || paid == nil {
+		return err
+	}
+
+	if paid.Status == models.PaymentStatusDisputed {
+		return nil
+	}
+
+	collected := paid.Refundable()
+	paid.Status = models.PaymentStatusDisputed
+	return s.suspendForPayment(ctx, subscription, paid, collected, models.InvoicePaymentStatusDisputed,
+		"Payment disputed", models.StateChangeReasonPaymentDisputed)
+}
+
+// eventPayment returns the payment an event is about and the payment's subscription.
+// It returns no payment for charges this service did not make, and no subscription
+// for the first charge of a subscription that was not created.
+func (s *Service) eventPayment(ctx context.Context, event *payment.Event) (*models.Payment, *models.Subscription, error) {
+	paid, err := s.payments.FindPayment(ctx, event)
+	if err != nil {
+		if err == errors.ErrPaymentNotFound {
+			log.Printf("Ignoring %s event %s for unknown payment %s", event.Type, event.ID, event.PaymentID)
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+
+	subscription, err := s.repo.GetByID(ctx, paid.SubscriptionID)
+	if err != nil {
+		if err == errors.ErrSubscriptionNotFound && paid.InvoiceID == nil {
+			return paid, nil, nil
+		}
+		return nil, nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+
+	return paid, subscription, nil
+}
+
+// recoverSubscription moves a past due subscription into the period its failed
+// renewal was for, now that the renewal's payment was collected
+func (s *Service) recoverSubscription(ctx context.Context, subscription *models.Subscription, paid *models.Payment) error {
+	now := time.Now()
+	if err := checkTransition(subscription, ActionRecover, now); err != nil {
+		return err
+	}
+
+	product, err := s.renewalProduct(ctx, subscription)
+	if err != nil {
+		return err
+	}
+
+	renewalInvoice, err := s.rollOverPaid(ctx, subscription, product, paid, now)
+	if err != nil {
+		return err
+	}
+	paid.InvoiceID = &renewalInvoice.ID
+
+	return s.transition(ctx, subscription, ActionRecover, transitionOptions{
+		At:         now,
+		Reason:     fmt.Sprintf("Renewal payment collected, subscription renewed until %s", subscription.EndDate.Format(time.RFC3339)),
+		ReasonCode: models.StateChangeReasonPaymentRecovered,
+		Write: func(tx repository.Transaction) error {
+			if err := s.saveBilling(ctx, tx, renewalInvoice, nil); err != nil {
+				return err
+			}
+			if err := updatePayment(ctx, tx, paid, ""); err != nil {
+				return err
+			}
+			return ledger.Post(ctx, tx.Ledger(), ledger.PaymentEntry(paid, paid.Amount))
+		},
+	})
+}
+
+// rollOverPaid moves the subscription into its next period like rollOver, but billed
+// at the amount collected for it instead of the product's current price. Prices or
+// taxes may have changed since the charge was made. The amount is split into the
+// price and the tax at the rates of the period before. The credit balance was not
+// debited when the charge was made, so no credit is applied.
+func (s *Service) rollOverPaid(ctx context.Context, subscription *models.Subscription, product *models.Product, paid *models.Payment, now time.Time) (*models.Invoice, error) {
+	// The discounted periods are counted down as on any renewal
+	if _, err := s.nextPeriodDiscount(ctx, subscription, product); err != nil {
+		return nil, err
+	}
+
+	rates := make(tax.Rates, 0, len(subscription.TaxComponents))
+	for _, component := range subscription.TaxComponents {
+		rates = append(rates, tax.Rate{Name: component.Name, Jurisdiction: component.Jurisdiction, Rate: component.Rate})
+	}
+	taxed := rates.Inclusive(paid.Amount, subscription.Currency)
+
+	nextPeriod(subscription, product)
+	subscription.OriginalPrice = taxed.Net
+	subscription.DiscountedPrice = nil
+	subscription.TaxAmount = taxed.Tax
+	subscription.TaxComponents = taxed.Components
+	subscription.TotalAmount = taxed.Gross()
+
+	return billRenewal(subscription, product, now), nil
+}
+
+// suspendForPayment saves a payment that no longer pays for its invoice and puts an
+// active subscription past due. The period was already renewed, so the payment is
+// not retried; the subscription expires at the end of the period instead. The part
+// of the payment that was collected is taken back.
+func (s *Service) suspendForPayment(
+	ctx context.Context,
+	subscription *models.Subscription,
+	paid *models.Payment,
+	collected decimal.Decimal,
+	invoiceStatus models.InvoicePaymentStatus,
+	reason string,
+	reasonCode models.StateChangeReasonCode,
+) error {
+	write := func(tx repository.Transaction) error {
+		if err := updatePayment(ctx, tx, paid, invoiceStatus); err != nil {
+			return err
+		}
+		if paid.InvoiceID == nil {
+			return nil
+		}
+		return ledger.Post(ctx, tx.Ledger(), ledger.PaymentReversalEntry(paid, collected, string(paid.Status)))
+	}
+
+	if subscription == nil || checkTransition(subscription, ActionMarkPastDue, time.Now()) != nil {
+		return s.uow.Do(ctx, write)
+	}
+
+	// The payment retry job picks the subscription up at the end of the period and,
+	// with no failed renewal to retry, expires it
+	endDate := subscription.EndDate
+	subscription.FailedPaymentAttempts = 0
+	subscription.NextPaymentAttemptAt = &endDate
+
+	return s.transition(ctx, subscription, ActionMarkPastDue, transitionOptions{
+		Reason:     reason,
+		ReasonCode: reasonCode,
+		Write:      write,
+	})
+}
+
+// updatePayment saves a payment and, if it has an invoice and a status is given,
+// the invoice's payment status
+func updatePayment(ctx context.Context, tx repository.Transaction, paid *models.Payment, invoiceStatus models.InvoicePaymentStatus) error {
+	if err := tx.Payments().Update(ctx, paid); err != nil {
+		return fmt.Errorf("failed to update payment: %w", err)
+	}
+
+	if paid.InvoiceID != nil && invoiceStatus != "" {
+		if err := tx.Invoices().UpdatePaymentStatus(ctx, *paid.InvoiceID, invoiceStatus); err != nil {
+			return fmt.Errorf("failed to update invoice: %w", err)
+		}
+	}
+
+	return nil
+}
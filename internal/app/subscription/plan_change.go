@@ -0,0 +1,319 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/invoice"
+	"github.com/assylzhan-a/subscription-service/internal/app/ledger"
+	"github.com/assylzhan-a/subscription-service/internal/app/tax"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// PlanChangeMode controls when a plan change takes effect
+type PlanChangeMode string
+
+const (
+	PlanChangeImmediately PlanChangeMode = "immediately"
+	PlanChangeAtPeriodEnd PlanChangeMode = "at_period_end"
+)
+
+type ChangePlanInput struct {
+	SubscriptionID uuid.UUID
+	ProductID      uuid.UUID
+	Mode           PlanChangeMode
+}
+
+func (i *ChangePlanInput) Validate() errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	if i.SubscriptionID == uuid.Nil {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "subscription_id",
+			Message: "must not be empty",
+		})
+	}
+
+	if i.ProductID == uuid.Nil {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "product_id",
+			Message: "must not be empty",
+		})
+	}
+
+	if i.Mode != PlanChangeImmediately && i.Mode != PlanChangeAtPeriodEnd {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "mode",
+			Message: "must be one of: immediately, at_period_end",
+		})
+	}
+
+	return validationErrors
+}
+
+// PlanChange is the price breakdown of a plan change. Amounts exclude tax
+// unless stated otherwise.
+type PlanChange struct {
+	Subscription *models.Subscription
+	Mode         PlanChangeMode
+	EffectiveAt  time.Time
+
+	// Credit is the unused portion of what was paid for the current period
+	Credit decimal.Decimal
+	// Charge is the price of the new plan's first period
+	Charge decimal.Decimal
+	// AmountDue is Charge minus Credit, never below zero
+	AmountDue decimal.Decimal
+	TaxAmount decimal.Decimal
+	// TaxComponents break TaxAmount, the tax on AmountDue, down
+	TaxComponents []models.TaxComponent
+	TotalDue      decimal.Decimal
+	// CreditToBalance is the credit left after the charge, with the tax paid on it. It
+	// is added to the user's credit balance.
+	CreditToBalance decimal.Decimal
+}
+
+// ChangePlan moves a subscription to another product. Immediate changes credit
+// the unused part of the current period and start a new period on the new plan;
+// the trial and a voucher valid for the new product are kept. Changes at period
+// end are applied by the next renewal at the new plan's price, less the voucher
+// discount if the voucher is valid for it and has periods left.
+func (s *Service) ChangePlan(ctx context.Context, input ChangePlanInput) (*PlanChange, error) {
+	// Validate input
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	subscription, err := s.repo.GetByID(ctx, input.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := checkTransition(subscription, ActionChangePlan, now); err != nil {
+		return nil, err
+	}
+
+	if subscription.ProductID == input.ProductID {
+		return nil, errors.ErrSubscriptionSamePlan
+	}
+
+	product, err := s.productRepo.GetByID(ctx, input.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	if !product.IsActive {
+		return nil, errors.ErrInactiveProduct
+	}
+
+	// The subscription stays in its currency
+	if _, ok := product.PriceIn(subscription.Currency); !ok {
+		return nil, errors.ErrCurrencyNotSold
+	}
+
+	previousProductID := subscription.ProductID
+	previous := *subscription
+
+	// A scheduled change is only a preview; the renewal assesses the taxes again
+	assess := s.taxes.AssessPurchase
+	if input.Mode == PlanChangeAtPeriodEnd {
+		assess = s.taxes.Assess
+	}
+	taxes, err := assess(ctx, subscription.UserID, product)
+	if err != nil {
+		return nil, err
+	}
+
+	var change *PlanChange
+	if input.Mode == PlanChangeAtPeriodEnd {
+		change, err = s.schedulePlanChange(ctx, subscription, product, taxes)
+	} else {
+		change, err = s.applyPlanChange(ctx, subscription, product, taxes, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Only an immediate change bills now; a change at period end is billed by the renewal
+	// and a change during the trial by the end of the trial
+	var write func(tx repository.Transaction) error
+	var planChangePayment *models.Payment
+	if input.Mode == PlanChangeImmediately && !isInTrial(subscription, now) {
+		planChangeInvoice := invoice.Build(invoice.BuildInput{
+			Subscription: subscription,
+			Product:      product,
+			Reason:       models.InvoiceReasonPlanChange,
+			IssuedAt:     now,
+			Credit:       change.Credit,
+			Taxes:        change.TaxComponents,
+		})
+
+		// The plan only changes if the charge succeeds
+		planChangePayment, err = s.chargeInvoice(ctx, subscription, planChangeInvoice)
+		if err != nil {
+			*subscription = previous
+			if planChangePayment != nil {
+				if saveErr := s.uow.Do(ctx, func(tx repository.Transaction) error {
+					return s.saveFailedPayment(ctx, tx, planChangePayment)
+				}); saveErr != nil {
+					return nil, saveErr
+				}
+			}
+			return nil, err
+		}
+
+		write = func(tx repository.Transaction) error {
+			if err := s.saveBilling(ctx, tx, planChangeInvoice, planChangePayment); err != nil {
+				return err
+			}
+			if !change.CreditToBalance.IsPositive() {
+				return nil
+			}
+			credited := &models.CreditEntry{
+				UserID:      subscription.UserID,
+				Type:        models.CreditEntryTypeCredit,
+				Amount:      change.CreditToBalance,
+				Currency:    subscription.Currency,
+				Reason:      models.CreditEntryReasonPlanChange,
+				ReferenceID: &planChangeInvoice.ID,
+				Note:        fmt.Sprintf("Unused time on product %s", previousProductID),
+			}
+			if err := tx.Credits().AddEntry(ctx, credited); err != nil {
+				return fmt.Errorf("failed to add credit: %w", err)
+			}
+			return ledger.Post(ctx, tx.Ledger(), ledger.PlanChangeCreditEntry(credited))
+		}
+	}
+
+	if err := s.transition(ctx, subscription, ActionChangePlan, transitionOptions{
+		At: now,
+		Reason: fmt.Sprintf("Plan change from product %s to %s %s (credit %s, charge %s)",
+			previousProductID, product.ID, input.Mode,
+			currency.Format(change.Credit, subscription.Currency), currency.Format(change.Charge, subscription.Currency)),
+		Write: write,
+	}); err != nil {
+		s.refundUnsaved(ctx, subscription, planChangePayment)
+		return nil, err
+	}
+
+	return change, nil
+}
+
+func (s *Service) applyPlanChange(
+	ctx context.Context,
+	subscription *models.Subscription,
+	product *models.Product,
+	taxes *tax.Assessment,
+	now time.Time,
+) (*PlanChange, error) {
+	// Nothing was paid during the trial, so nothing is credited
+	paid := paidPrice(subscription)
+	credit := decimal.Zero
+	if !isInTrial(subscription, now) {
+		credit = unusedAmount(paid, subscription.Currency, subscription.StartDate, subscription.EndDate, now)
+	}
+
+	// The tax paid on the credit is returned along with it
+	creditTaxRate := decimal.Zero
+	if paid.IsPositive() {
+		creditTaxRate = subscription.TaxAmount.Div(paid)
+	}
+
+	// Keep the voucher if it is valid for the new product and has discounted periods left.
+	// The new period takes the place of the current one, so no period is used up. The
+	// subscription's currency does not change, so a fixed discount stays valid.
+	var discountedPrice *decimal.Decimal
+	if subscription.HasDiscount() {
+		voucher, err := s.voucherRepo.GetByID(ctx, *subscription.VoucherID)
+		if err != nil && err != errors.ErrVoucherNotFound {
+			return nil, fmt.Errorf("failed to get voucher: %w", err)
+		}
+
+		if voucher != nil && (voucher.ProductID == nil || *voucher.ProductID == product.ID) {
+			listPrice, _ := product.PriceIn(subscription.Currency)
+			price := applyVoucher(listPrice, voucher, subscription.Currency)
+			discountedPrice = &price
+		} else {
+			endDiscount(subscription)
+		}
+	}
+
+	// A subscription still in trial keeps its trial; the new period starts when it ends
+	startDate := now
+	if subscription.StartDate.After(now) {
+		startDate = subscription.StartDate
+	}
+
+	subscription.ProductID = product.ID
+	subscription.Product = product
+	subscription.ScheduledProductID = nil
+	subscription.StartDate = startDate
+	subscription.EndDate = startDate.AddDate(0, product.DurationMonths, 0)
+	setPrice(subscription, product, discountedPrice, taxes)
+
+	// The credit is taken off the pre-tax charge and the rest is taxed
+	charge := paidPrice(subscription)
+	amountDue := charge.Sub(credit)
+	creditToBalance := decimal.Zero
+	if amountDue.IsNegative() {
+		creditToBalance = currency.Round(amountDue.Neg().Mul(decimal.NewFromInt(1).Add(creditTaxRate)), subscription.Currency)
+		amountDue = decimal.Zero
+	}
+	taxed := taxes.Exclusive(amountDue)
+
+	return &PlanChange{
+		Subscription:    subscription,
+		Mode:            PlanChangeImmediately,
+		EffectiveAt:     now,
+		Credit:          credit,
+		Charge:          charge,
+		AmountDue:       amountDue,
+		TaxAmount:       taxed.Tax,
+		TaxComponents:   taxed.Components,
+		TotalDue:        taxed.Gross(),
+		CreditToBalance: creditToBalance,
+	}, nil
+}
+
+func (s *Service) schedulePlanChange(
+	ctx context.Context,
+	subscription *models.Subscription,
+	product *models.Product,
+	taxes *tax.Assessment,
+) (*PlanChange, error) {
+	// Nothing is credited; the renewal bills the new plan's price, discounted the way
+	// the renewal discounts it, and taxed at the rates that apply then. The renewal
+	// counts down the discount, so it is worked out on a copy.
+	renewal := *subscription
+	discountedPrice, err := s.nextPeriodDiscount(ctx, &renewal, product)
+	if err != nil {
+		return nil, err
+	}
+
+	price, _ := product.PriceIn(subscription.Currency)
+	if discountedPrice != nil {
+		price = *discountedPrice
+	}
+	taxed := priceTax(price, product, taxes, subscription.Currency)
+
+	subscription.ScheduledProductID = &product.ID
+
+	return &PlanChange{
+		Subscription:  subscription,
+		Mode:          PlanChangeAtPeriodEnd,
+		EffectiveAt:   subscription.EndDate,
+		Credit:        decimal.Zero,
+		Charge:        taxed.Net,
+		AmountDue:     taxed.Net,
+		TaxAmount:     taxed.Tax,
+		TaxComponents: taxed.Components,
+		TotalDue:      taxed.Gross(),
+	}, nil
+}
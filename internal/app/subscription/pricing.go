@@ -0,0 +1,111 @@
+package subscription
+
+import (
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/tax"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
+	"github.com/shopspring/decimal"
+)
+
+// priceTax works out the tax on price, the product's price in the currency after any
+// discount. The price of a tax-inclusive product is split into its pre-tax amount and
+// the tax.
+func priceTax(price decimal.Decimal, product *models.Product, taxes *tax.Assessment, currencyCode string) tax.Result {
+	if product.TaxInclusive {
+		return taxes.Inclusive(price, currencyCode)
+	}
+	return taxes.Exclusive(price)
+}
+
+// setPrice prices the subscription's period on product in the subscription's currency,
+// at the discounted price if it is not nil. The product must be sold in the currency.
+// The prices are stored before tax and the tax as it was calculated, so that later
+// changes to the tax rules leave the period's total alone. The buyer's VAT ID is kept
+// with the check it was validated with, reverse charged or not.
+func setPrice(subscription *models.Subscription, product *models.Product, discountedPrice *decimal.Decimal, taxes *tax.Assessment) {
+	listPrice, _ := product.PriceIn(subscription.Currency)
+	price := listPrice
+	if discountedPrice != nil {
+		price = *discountedPrice
+	}
+	taxed := priceTax(price, product, taxes, subscription.Currency)
+
+	subscription.OriginalPrice = priceTax(listPrice, product, taxes, subscription.Currency).Net
+	subscription.DiscountedPrice = nil
+	if discountedPrice != nil {
+		subscription.DiscountedPrice = &taxed.Net
+	}
+	subscription.TaxAmount = taxed.Tax
+	subscription.TaxComponents = taxed.Components
+	subscription.TotalAmount = taxed.Gross()
+
+	subscription.ReverseCharge = taxes.ReverseCharge
+	subscription.CustomerVATID = ""
+	subscription.VATValidationID = nil
+	if taxes.Validation != nil {
+		subscription.CustomerVATID = taxes.Validation.VATID
+		subscription.VATValidationID = &taxes.Validation.ID
+	}
+}
+
+// applyVoucher returns price after the voucher's discount, rounded to the currency and
+// never below zero
+func applyVoucher(price decimal.Decimal, voucher *models.Voucher, currencyCode string) decimal.Decimal {
+	var discountedPrice decimal.Decimal
+	if voucher.DiscountType == models.DiscountTypeFixed {
+		discountedPrice = price.Sub(voucher.DiscountValue)
+	} else { // Percentage
+		discountedPrice = price.Sub(price.Mul(voucher.DiscountValue.Div(decimal.NewFromInt(100))))
+	}
+
+	// Ensure price doesn't go below zero
+	if discountedPrice.IsNegative() {
+		return decimal.Zero
+	}
+
+	return currency.Round(discountedPrice, currencyCode)
+}
+
+// startDiscount attaches the voucher to the subscription, counting its first
+// period as the first discounted one
+func startDiscount(subscription *models.Subscription, voucher *models.Voucher) {
+	subscription.VoucherID = &voucher.ID
+	subscription.DiscountDuration = voucher.DiscountDuration
+	subscription.DiscountPeriodsRemaining = 0
+	if periods := voucher.PeriodsDiscounted(); periods > 0 {
+		subscription.DiscountPeriodsRemaining = periods
+	}
+}
+
+// endDiscount detaches the voucher, so no further period is discounted
+func endDiscount(subscription *models.Subscription) {
+	subscription.VoucherID = nil
+	subscription.DiscountDuration = ""
+	subscription.DiscountPeriodsRemaining = 0
+}
+
+// paidPrice returns the pre-tax price paid for the subscription's current period
+func paidPrice(subscription *models.Subscription) decimal.Decimal {
+	if subscription.DiscountedPrice != nil {
+		return *subscription.DiscountedPrice
+	}
+	return subscription.OriginalPrice
+}
+
+// unusedAmount returns the share of amount that covers the part of the
+// period [start, end) remaining at the given time, rounded to the currency
+func unusedAmount(amount decimal.Decimal, currencyCode string, start, end, at time.Time) decimal.Decimal {
+	period := end.Sub(start)
+	if period <= 0 || !at.Before(end) {
+		return decimal.Zero
+	}
+
+	if at.Before(start) {
+		return amount
+	}
+
+	remaining := decimal.NewFromInt(int64(end.Sub(at)))
+	return currency.Round(amount.Mul(remaining).Div(decimal.NewFromInt(int64(period))), currencyCode)
+}
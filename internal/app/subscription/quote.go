@@ -0,0 +1,177 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/tax"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// trialMonths is the length of the free trial
+const trialMonths = 1
+
+// Quote is the price of a new subscription and the period it covers
+type Quote struct {
+	Product *models.Product
+	// Voucher is nil when no voucher code was given
+	Voucher *models.Voucher
+	// Currency is the currency of the prices
+	Currency string
+
+	StartDate    time.Time
+	EndDate      time.Time
+	TrialEndDate *time.Time
+
+	OriginalPrice decimal.Decimal
+	// Discount is taken off OriginalPrice; DiscountedPrice is nil without a voucher
+	Discount        decimal.Decimal
+	DiscountedPrice *decimal.Decimal
+	TaxAmount       decimal.Decimal
+	TaxComponents   []models.TaxComponent
+	TotalAmount     decimal.Decimal
+	// ReverseCharge is set when the buyer accounts for the VAT themselves
+	ReverseCharge bool
+
+	// validation is the check of the buyer's VAT ID, if one was made
+	validation *models.VATValidation
+}
+
+// PriceSubscription prices a subscription to product that is bought in the currency at
+// now by a buyer with the given taxes. The product must be sold in the currency. The
+// voucher may be nil and must already be valid for the product and currency. With a
+// trial the first billing period starts when the trial ends. Prices are before tax,
+// also for tax-inclusive products.
+func PriceSubscription(product *models.Product, currencyCode string, voucher *models.Voucher, taxes *tax.Assessment, withTrial bool, now time.Time) *Quote {
+	quote := &Quote{
+		Product:   product,
+		Voucher:   voucher,
+		Currency:  currencyCode,
+		StartDate: now,
+		Discount:  decimal.Zero,
+	}
+
+	if withTrial {
+		trialEnd := now.AddDate(0, trialMonths, 0)
+		quote.TrialEndDate = &trialEnd
+		quote.StartDate = trialEnd
+	}
+	quote.EndDate = quote.StartDate.AddDate(0, product.DurationMonths, 0)
+
+	listPrice, _ := product.PriceIn(currencyCode)
+	price := listPrice
+	if voucher != nil {
+		price = applyVoucher(listPrice, voucher, currencyCode)
+	}
+	taxed := priceTax(price, product, taxes, currencyCode)
+
+	quote.OriginalPrice = priceTax(listPrice, product, taxes, currencyCode).Net
+	if voucher != nil {
+		quote.DiscountedPrice = &taxed.Net
+		quote.Discount = quote.OriginalPrice.Sub(taxed.Net)
+	}
+
+	quote.TaxAmount = taxed.Tax
+	quote.TaxComponents = taxed.Components
+	quote.TotalAmount = taxed.Gross()
+	quote.ReverseCharge = taxes.ReverseCharge
+	quote.validation = taxes.Validation
+
+	return quote
+}
+
+type QuoteInput struct {
+	// UserID is the buyer, whose billing address decides the taxes
+	UserID      uuid.UUID
+	ProductID   uuid.UUID
+	VoucherCode string
+	WithTrial   bool
+	// Currency defaults to the product's currency
+	Currency string
+}
+
+func (i *QuoteInput) Validate() errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	if i.UserID == uuid.Nil {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "user_id",
+			Message: "must not be empty",
+		})
+	}
+
+	if i.ProductID == uuid.Nil {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "product_id",
+			Message: "must not be empty",
+		})
+	}
+
+	return validationErrors
+}
+
+// QuoteSubscription returns what a subscription would cost without creating it.
+// Voucher limits are checked again when the subscription is created.
+func (s *Service) QuoteSubscription(ctx context.Context, input QuoteInput) (*Quote, error) {
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	return s.quote(ctx, input, false, time.Now())
+}
+
+// quote loads and checks the product and voucher of a new subscription and prices it
+// in the requested currency. For a purchase, the check of the buyer's VAT ID is recorded.
+func (s *Service) quote(ctx context.Context, input QuoteInput, purchase bool, now time.Time) (*Quote, error) {
+	product, err := s.productRepo.GetByID(ctx, input.ProductID)
+	if err != nil {
+		if err == errors.ErrProductNotFound {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	if !product.IsActive {
+		return nil, errors.ErrInactiveProduct
+	}
+
+	currencyCode := currency.Normalize(input.Currency)
+	if currencyCode == "" {
+		currencyCode = product.Currency
+	}
+	if _, ok := product.PriceIn(currencyCode); !ok {
+		return nil, errors.ErrCurrencyNotSold
+	}
+
+	var voucher *models.Voucher
+	if code := strings.ToUpper(strings.TrimSpace(input.VoucherCode)); code != "" {
+		voucher, err = s.voucherRepo.GetByCode(ctx, code)
+		if err != nil {
+			if err == errors.ErrVoucherNotFound {
+				return nil, err
+			}
+			return nil, fmt.Errorf("invalid voucher code: %w", err)
+		}
+
+		if err := s.validateVoucher(voucher, product.ID, currencyCode); err != nil {
+			return nil, err
+		}
+	}
+
+	assess := s.taxes.Assess
+	if purchase {
+		assess = s.taxes.AssessPurchase
+	}
+	taxes, err := assess(ctx, input.UserID, product)
+	if err != nil {
+		return nil, err
+	}
+
+	return PriceSubscription(product, currencyCode, voucher, taxes, input.WithTrial, now), nil
+}
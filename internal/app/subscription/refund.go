@@ -0,0 +1,323 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/ledger"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// maxRefundNoteLength limits the note support staff can leave on a credit note
+const maxRefundNoteLength = 1000
+
+type RefundInput struct {
+	InvoiceID uuid.UUID
+	// Amount is refunded from the invoice's payment; nil refunds all that is left
+	Amount *decimal.Decimal
+	Note   string
+}
+
+func (i *RefundInput) Validate() errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	if i.InvoiceID == uuid.Nil {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "invoice_id",
+			Message: "must not be empty",
+		})
+	}
+
+	if len(i.Note) > maxRefundNoteLength {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "note",
+			Message: fmt.Sprintf("must not be longer than %d characters", maxRefundNoteLength),
+		})
+	}
+
+	return validationErrors
+}
+
+// RefundInvoice refunds all or part of an invoice's collected payment and issues a
+// credit note for it. The subscription is not changed.
+func (s *Service) RefundInvoice(ctx context.Context, input RefundInput) (*models.CreditNote, error) {
+	// Validate input
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	var refundedInvoice *models.Invoice
+	var paid *models.Payment
+	err := s.uow.Do(ctx, func(tx repository.Transaction) error {
+		var err error
+		refundedInvoice, err = tx.Invoices().GetByID(ctx, input.InvoiceID)
+		if err != nil {
+			return err
+		}
+
+		payments, err := tx.Payments().GetByInvoiceID(ctx, input.InvoiceID)
+		if err != nil {
+			return fmt.Errorf("failed to get payments: %w", err)
+		}
+		paid = collectedPayment(payments)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if paid == nil {
+		return nil, errors.ErrInvoiceNotRefundable
+	}
+
+	amount := paid.Refundable()
+	if input.Amount != nil {
+		requested := currency.Round(*input.Amount, refundedInvoice.Currency)
+		if !requested.IsPositive() {
+			return nil, errors.ValidationErrors{{
+				Field:   "amount",
+				Message: fmt.Sprintf("must be at least one minor unit of %s", refundedInvoice.Currency),
+			}}
+		}
+		if requested.GreaterThan(amount) {
+			return nil, errors.ErrRefundExceedsPayment
+		}
+		amount = requested
+	}
+
+	return s.refund(ctx, refundedInvoice, paid, amount, models.CreditNoteReasonSupport, input.Note, time.Now())
+}
+
+func (s *Service) GetCreditNoteByID(ctx context.Context, id uuid.UUID) (*models.CreditNote, error) {
+	var creditNote *models.CreditNote
+	err := s.uow.Do(ctx, func(tx repository.Transaction) error {
+		var err error
+		creditNote, err = tx.CreditNotes().GetByID(ctx, id)
+		return err
+	})
+	return creditNote, err
+}
+
+func (s *Service) GetUserCreditNotes(ctx context.Context, userID uuid.UUID) ([]*models.CreditNote, error) {
+	var creditNotes []*models.CreditNote
+	err := s.uow.Do(ctx, func(tx repository.Transaction) error {
+		var err error
+		creditNotes, err = tx.CreditNotes().GetByUserID(ctx, userID)
+		return err
+	})
+	return creditNotes, err
+}
+
+func (s *Service) GetInvoiceCreditNotes(ctx context.Context, invoiceID uuid.UUID) ([]*models.CreditNote, error) {
+	var creditNotes []*models.CreditNote
+	err := s.uow.Do(ctx, func(tx repository.Transaction) error {
+		if _, err := tx.Invoices().GetByID(ctx, invoiceID); err != nil {
+			return err
+		}
+
+		var err error
+		creditNotes, err = tx.CreditNotes().GetByInvoiceID(ctx, invoiceID)
+		return err
+	})
+	return creditNotes, err
+}
+
+// refundCancellation refunds what the product's refund policy gives back for the
+// paid period of a subscription cancelled at the given time. The refund is taken
+// from the payments of the invoices issued for the period, most recent first. An
+// invoice is for the current period if the period it bills starts within it; a
+// pause moves the end of the subscription's period but not of its invoices.
+func (s *Service) refundCancellation(ctx context.Context, subscription *models.Subscription, at time.Time) error {
+	product, err := s.productRepo.GetByID(ctx, subscription.ProductID)
+	if err != nil {
+		return fmt.Errorf("failed to get product: %w", err)
+	}
+
+	if product.RefundPolicy == models.RefundPolicyNone || product.RefundPolicy == "" {
+		return nil
+	}
+
+	type periodPayment struct {
+		invoice *models.Invoice
+		payment *models.Payment
+	}
+
+	var period []periodPayment
+	err = s.uow.Do(ctx, func(tx repository.Transaction) error {
+		payments, err := tx.Payments().GetBySubscriptionID(ctx, subscription.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get payments: %w", err)
+		}
+
+		for _, paid := range payments {
+			if paid.InvoiceID == nil || !paid.Refundable().IsPositive() {
+				continue
+			}
+
+			paidInvoice, err := tx.Invoices().GetByID(ctx, *paid.InvoiceID)
+			if err != nil {
+				return fmt.Errorf("failed to get invoice: %w", err)
+			}
+			// Only the current period is refunded
+			if !paidInvoice.PeriodStart.Before(subscription.StartDate) && paidInvoice.PeriodStart.Before(subscription.EndDate) {
+				period = append(period, periodPayment{invoice: paidInvoice, payment: paid})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(period) == 0 {
+		return nil
+	}
+
+	// The period was purchased with its first invoice; refunds start with the last one
+	sort.Slice(period, func(i, j int) bool {
+		return period[i].invoice.IssuedAt.After(period[j].invoice.IssuedAt)
+	})
+	purchasedAt := period[len(period)-1].invoice.IssuedAt
+	billed := decimal.Zero
+	for _, p := range period {
+		billed = billed.Add(p.invoice.Total)
+	}
+	remaining := policyRefund(product, subscription, billed, purchasedAt, at)
+
+	for _, p := range period {
+		if !remaining.IsPositive() {
+			break
+		}
+
+		amount := decimal.Min(remaining, p.payment.Refundable())
+		if _, err := s.refund(ctx, p.invoice, p.payment, amount, models.CreditNoteReasonCancellation, "", at); err != nil {
+			return err
+		}
+		remaining = remaining.Sub(amount)
+	}
+
+	return nil
+}
+
+// policyRefund returns what the product's refund policy gives back of billed, the
+// total invoiced for the current period of a subscription cancelled at the given time
+func policyRefund(product *models.Product, subscription *models.Subscription, billed decimal.Decimal, purchasedAt, at time.Time) decimal.Decimal {
+	switch product.RefundPolicy {
+	case models.RefundPolicyProrated:
+		return unusedAmount(billed, subscription.Currency, subscription.StartDate, subscription.EndDate, at)
+	case models.RefundPolicyFullWithinDays:
+		if at.Before(purchasedAt.AddDate(0, 0, product.RefundWindowDays)) {
+			return billed
+		}
+	}
+	return decimal.Zero
+}
+
+// refund returns amount of a collected payment and records it with a credit note
+// linked to the payment's invoice. The payment stays locked from the check that
+// enough of it is left until the refund is recorded, so concurrent refunds of the
+// same payment are made one at a time. ErrRefundExceedsPayment is returned if
+// another refund left less than amount.
+func (s *Service) refund(
+	ctx context.Context,
+	refundedInvoice *models.Invoice,
+	paid *models.Payment,
+	amount decimal.Decimal,
+	reason models.CreditNoteReason,
+	note string,
+	at time.Time,
+) (*models.CreditNote, error) {
+	creditNote := &models.CreditNote{
+		ID:             uuid.New(),
+		InvoiceID:      refundedInvoice.ID,
+		PaymentID:      paid.ID,
+		UserID:         refundedInvoice.UserID,
+		SubscriptionID: refundedInvoice.SubscriptionID,
+		Reason:         reason,
+		Note:           note,
+		Currency:       refundedInvoice.Currency,
+		Total:          amount,
+		IssuedAt:       at,
+		ExchangeRate:   s.exchangeRate(ctx, refundedInvoice.Currency, at),
+	}
+	creditNote.Subtotal, creditNote.TaxAmount = splitTax(amount, refundedInvoice)
+
+	err := s.uow.Do(ctx, func(tx repository.Transaction) error {
+		locked, err := tx.Payments().GetByIDForUpdate(ctx, paid.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get payment: %w", err)
+		}
+		if amount.GreaterThan(locked.Refundable()) {
+			return errors.ErrRefundExceedsPayment
+		}
+
+		// The credit note's ID makes a retried refund return the first one
+		refundID, err := s.payments.RefundAmount(ctx, locked, amount, "credit-note-"+creditNote.ID.String())
+		if err != nil {
+			return err
+		}
+		creditNote.ProviderRefundID = refundID
+		*paid = *locked
+
+		invoiceStatus := models.InvoicePaymentStatusPartiallyRefunded
+		if paid.Status == models.PaymentStatusRefunded {
+			invoiceStatus = models.InvoicePaymentStatusRefunded
+		}
+
+		if err := tx.CreditNotes().Create(ctx, creditNote); err != nil {
+			return fmt.Errorf("failed to create credit note: %w", err)
+		}
+		if err := postRefund(ctx, tx, creditNote.ID, refundedInvoice, creditNote.Subtotal, creditNote.TaxAmount,
+			fmt.Sprintf("Credit note %s", creditNote.Number)); err != nil {
+			return err
+		}
+		return updatePayment(ctx, tx, paid, invoiceStatus)
+	})
+	if err != nil {
+		if creditNote.ProviderRefundID != "" {
+			log.Printf("Refunded %s of payment %s (refund %s) but failed to record it: %v", amount, paid.ID, creditNote.ProviderRefundID, err)
+		}
+		return nil, err
+	}
+
+	return creditNote, nil
+}
+
+// collectedPayment returns the most recent payment of an invoice that has something
+// left to refund, or nil if there is none
+func collectedPayment(payments []*models.Payment) *models.Payment {
+	for _, paid := range payments {
+		if paid.Refundable().IsPositive() {
+			return paid
+		}
+	}
+	return nil
+}
+
+// postRefund posts money paid back for an invoice to the ledger
+func postRefund(ctx context.Context, tx repository.Transaction, referenceID uuid.UUID, refundedInvoice *models.Invoice, subtotal, taxAmount decimal.Decimal, description string) error {
+	deferred, err := tx.Ledger().GetDeferredRevenue(ctx, refundedInvoice.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get deferred revenue: %w", err)
+	}
+	return ledger.Post(ctx, tx.Ledger(), ledger.RefundEntry(referenceID, refundedInvoice, subtotal, taxAmount, deferred, description))
+}
+
+// splitTax splits a refund of part of an invoice's total into its pre-tax amount and
+// tax, in the proportions of the invoice and rounded to its currency
+func splitTax(amount decimal.Decimal, refundedInvoice *models.Invoice) (decimal.Decimal, decimal.Decimal) {
+	if !refundedInvoice.Total.IsPositive() {
+		return amount, decimal.Zero
+	}
+
+	tax := currency.Round(amount.Mul(refundedInvoice.TaxAmount).Div(refundedInvoice.Total), refundedInvoice.Currency)
+	return amount.Sub(tax), tax
+}
@@ -0,0 +1,286 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/invoice"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/shopspring/decimal"
+)
+
+// claimLease is how long a worker holds a claimed subscription before another worker may retry it
+const claimLease = 5 * time.Minute
+
+const defaultBatchSize = 100
+
+// ProcessRenewals renews or expires every active subscription whose billing period has ended.
+// Subscriptions are claimed in batches, so several replicas can run it at the same time.
+func (s *Service) ProcessRenewals(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	processed := 0
+
+	for {
+		now := time.Now()
+		subscriptions, err := s.repo.ClaimDueForRenewal(ctx, now, claimLease, batchSize)
+		if err != nil {
+			return processed, fmt.Errorf("failed to claim subscriptions for renewal: %w", err)
+		}
+
+		for _, subscription := range subscriptions {
+			if err := s.renewSubscription(ctx, subscription); err != nil {
+				// The lease runs out and a later run retries the subscription
+				log.Printf("Failed to renew subscription %s: %v", subscription.ID, err)
+				continue
+			}
+			processed++
+		}
+
+		if len(subscriptions) < batchSize {
+			return processed, nil
+		}
+	}
+}
+
+func (s *Service) renewSubscription(ctx context.Context, subscription *models.Subscription) error {
+	if !subscription.AutoRenew {
+		return s.expireSubscription(ctx, subscription, "Subscription period ended without auto-renewal")
+	}
+
+	product, err := s.renewalProduct(ctx, subscription)
+	if err != nil {
+		return err
+	}
+
+	if !product.IsActive {
+		return s.expireSubscription(ctx, subscription, "Product is no longer active")
+	}
+
+	if _, ok := product.PriceIn(subscription.Currency); !ok {
+		return s.expireSubscription(ctx, subscription, fmt.Sprintf("Product is no longer sold in %s", subscription.Currency))
+	}
+
+	now := time.Now()
+	if err := checkTransition(subscription, ActionRenew, now); err != nil {
+		return err
+	}
+
+	// The subscription is only rolled into the next period if the charge succeeds
+	previous := *subscription
+
+	renewalInvoice, err := s.rollOver(ctx, subscription, product, now)
+	if err != nil {
+		return err
+	}
+
+	renewalPayment, err := s.chargeInvoice(ctx, subscription, renewalInvoice)
+	if err != nil {
+		if renewalPayment == nil {
+			return err
+		}
+
+		*subscription = previous
+		return s.markPastDue(ctx, subscription, renewalPayment, now)
+	}
+
+	err = s.transition(ctx, subscription, ActionRenew, transitionOptions{
+		At:     now,
+		Reason: fmt.Sprintf("Subscription renewed until %s", subscription.EndDate.Format(time.RFC3339)),
+		Write: func(tx repository.Transaction) error {
+			return s.saveBilling(ctx, tx, renewalInvoice, renewalPayment)
+		},
+	})
+	if err != nil {
+		s.refundUnsaved(ctx, subscription, renewalPayment)
+	}
+	return err
+}
+
+// renewalProduct returns the product the subscription renews on. A plan change
+// scheduled for the period end takes effect at the renewal.
+func (s *Service) renewalProduct(ctx context.Context, subscription *models.Subscription) (*models.Product, error) {
+	productID := subscription.ProductID
+	if subscription.ScheduledProductID != nil {
+		productID = *subscription.ScheduledProductID
+	}
+
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	return product, nil
+}
+
+// rollOver moves the subscription into its next period, billed at the product's
+// current price less the voucher discount while it has periods left, and returns
+// the period's invoice
+func (s *Service) rollOver(ctx context.Context, subscription *models.Subscription, product *models.Product, now time.Time) (*models.Invoice, error) {
+	discountedPrice, err := s.nextPeriodDiscount(ctx, subscription, product)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each period is taxed at the rates of the buyer's billing address when it starts,
+	// and a business buyer's VAT ID is checked again
+	taxes, err := s.taxes.AssessPurchase(ctx, subscription.UserID, product)
+	if err != nil {
+		return nil, err
+	}
+
+	nextPeriod(subscription, product)
+	setPrice(subscription, product, discountedPrice, taxes)
+
+	return billRenewal(subscription, product, now), nil
+}
+
+// nextPeriod moves the subscription into the period after its current one, on product
+func nextPeriod(subscription *models.Subscription, product *models.Product) {
+	subscription.ProductID = product.ID
+	subscription.ScheduledProductID = nil
+	subscription.StartDate = subscription.EndDate
+	subscription.EndDate = subscription.StartDate.AddDate(0, product.DurationMonths, 0)
+	subscription.Product = product
+}
+
+// billRenewal bills the subscription's period at the price it was renewed for
+func billRenewal(subscription *models.Subscription, product *models.Product, now time.Time) *models.Invoice {
+	return invoice.Build(invoice.BuildInput{
+		Subscription: subscription,
+		Product:      product,
+		Reason:       models.InvoiceReasonRenewal,
+		IssuedAt:     now,
+		Taxes:        subscription.TaxComponents,
+	})
+}
+
+// nextPeriodDiscount counts down the subscription's discounted periods and returns
+// the discounted price of the next period, or nil once the discount has run out
+func (s *Service) nextPeriodDiscount(ctx context.Context, subscription *models.Subscription, product *models.Product) (*decimal.Decimal, error) {
+	if !subscription.HasDiscount() {
+		return nil, nil
+	}
+
+	if subscription.DiscountDuration != models.DiscountDurationForever {
+		subscription.DiscountPeriodsRemaining--
+		if subscription.DiscountPeriodsRemaining <= 0 {
+			subscription.DiscountPeriodsRemaining = 0
+			return nil, nil
+		}
+	}
+
+	voucher, err := s.voucherRepo.GetByID(ctx, *subscription.VoucherID)
+	if err != nil {
+		if err == errors.ErrVoucherNotFound {
+			endDiscount(subscription)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get voucher: %w", err)
+	}
+
+	// A plan change at period end may move the subscription to a product the voucher is not valid for
+	if voucher.ProductID != nil && *voucher.ProductID != product.ID {
+		endDiscount(subscription)
+		return nil, nil
+	}
+
+	listPrice, _ := product.PriceIn(subscription.Currency)
+	discountedPrice := applyVoucher(listPrice, voucher, subscription.Currency)
+	return &discountedPrice, nil
+}
+
+func (s *Service) expireSubscription(ctx context.Context, subscription *models.Subscription, reason string) error {
+	return s.transition(ctx, subscription, ActionExpire, transitionOptions{Reason: reason})
+}
+
+// ProcessTrialEnds activates every trialing subscription whose trial has ended.
+// A subscription scheduled to cancel is cancelled instead, so it is never billed.
+func (s *Service) ProcessTrialEnds(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	processed := 0
+
+	for {
+		subscriptions, err := s.repo.ClaimDueForActivation(ctx, time.Now(), claimLease, batchSize)
+		if err != nil {
+			return processed, fmt.Errorf("failed to claim subscriptions with ended trials: %w", err)
+		}
+
+		for _, subscription := range subscriptions {
+			if err := s.endTrial(ctx, subscription); err != nil {
+				// The lease runs out and a later run retries the subscription
+				log.Printf("Failed to end trial of subscription %s: %v", subscription.ID, err)
+				continue
+			}
+			processed++
+		}
+
+		if len(subscriptions) < batchSize {
+			return processed, nil
+		}
+	}
+}
+
+func (s *Service) endTrial(ctx context.Context, subscription *models.Subscription) error {
+	if subscription.CancelAtPeriodEnd {
+		return s.transition(ctx, subscription, ActionCancel, transitionOptions{
+			Reason: "Scheduled cancellation at trial end",
+		})
+	}
+
+	now := time.Now()
+	if err := checkTransition(subscription, ActionActivate, now); err != nil {
+		return err
+	}
+
+	product, err := s.productRepo.GetByID(ctx, subscription.ProductID)
+	if err != nil {
+		return fmt.Errorf("failed to get product: %w", err)
+	}
+
+	// The first period is billed when the trial ends
+	firstInvoice := invoice.Build(invoice.BuildInput{
+		Subscription: subscription,
+		Product:      product,
+		Reason:       models.InvoiceReasonSubscriptionCreate,
+		IssuedAt:     now,
+		Taxes:        subscription.TaxComponents,
+	})
+
+	firstPayment, err := s.chargeInvoice(ctx, subscription, firstInvoice)
+	if err != nil {
+		if firstPayment == nil {
+			return err
+		}
+
+		return s.transition(ctx, subscription, ActionCancel, transitionOptions{
+			At:         now,
+			Reason:     fmt.Sprintf("Payment failed at trial end: %s", firstPayment.FailureCode),
+			ReasonCode: models.StateChangeReasonTrialPaymentFailed,
+			Write: func(tx repository.Transaction) error {
+				return s.saveFailedPayment(ctx, tx, firstPayment)
+			},
+		})
+	}
+
+	err = s.transition(ctx, subscription, ActionActivate, transitionOptions{
+		At:     now,
+		Reason: "Trial ended",
+		Write: func(tx repository.Transaction) error {
+			return s.saveBilling(ctx, tx, firstInvoice, firstPayment)
+		},
+	})
+	if err != nil {
+		s.refundUnsaved(ctx, subscription, firstPayment)
+	}
+	return err
+}
@@ -3,9 +3,13 @@ package subscription
 import (
 	"context"
 	"fmt"
-	"github.com/shopspring/decimal"
+	"log"
 	"time"
 
+	"github.com/assylzhan-a/subscription-service/internal/app/exchange"
+	"github.com/assylzhan-a/subscription-service/internal/app/invoice"
+	"github.com/assylzhan-a/subscription-service/internal/app/payment"
+	"github.com/assylzhan-a/subscription-service/internal/app/tax"
 	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
 	"github.com/assylzhan-a/subscription-service/internal/domain/models"
 	"github.com/assylzhan-a/subscription-service/internal/repository"
@@ -16,17 +20,32 @@ type Service struct {
 	repo        repository.SubscriptionRepository
 	productRepo repository.ProductRepository
 	voucherRepo repository.VoucherRepository
+	uow         repository.UnitOfWork
+	payments    *payment.Service
+	taxes       *tax.Service
+	rates       *exchange.Service
+	dunning     DunningPolicy
 }
 
 func NewService(
 	repo repository.SubscriptionRepository,
 	productRepo repository.ProductRepository,
 	voucherRepo repository.VoucherRepository,
+	uow repository.UnitOfWork,
+	payments *payment.Service,
+	taxes *tax.Service,
+	rates *exchange.Service,
+	dunning DunningPolicy,
 ) *Service {
 	return &Service{
 		repo:        repo,
 		productRepo: productRepo,
 		voucherRepo: voucherRepo,
+		uow:         uow,
+		payments:    payments,
+		taxes:       taxes,
+		rates:       rates,
+		dunning:     dunning,
 	}
 }
 
@@ -35,6 +54,10 @@ type CreateSubscriptionInput struct {
 	ProductID   uuid.UUID
 	VoucherCode string
 	WithTrial   bool
+	AutoRenew   bool
+	// Currency is the currency the subscription is billed in and defaults to the
+	// product's currency
+	Currency string
 }
 
 func (i *CreateSubscriptionInput) Validate() errors.ValidationErrors {
@@ -63,84 +86,120 @@ func (s *Service) CreateSubscription(ctx context.Context, input CreateSubscripti
 		return nil, validationErrors
 	}
 
-	// Get product
-	product, err := s.productRepo.GetByID(ctx, input.ProductID)
+	// Check the product and voucher and calculate pricing and dates
+	quote, err := s.quote(ctx, QuoteInput{
+		UserID:      input.UserID,
+		ProductID:   input.ProductID,
+		VoucherCode: input.VoucherCode,
+		WithTrial:   input.WithTrial,
+		Currency:    input.Currency,
+	}, true, time.Now())
 	if err != nil {
-		return nil, fmt.Errorf("failed to get product: %w", err)
-	}
-
-	// Check if product is active
-	if !product.IsActive {
-		return nil, errors.ErrInactiveProduct
+		return nil, err
 	}
 
-	// Calculate pricing and dates
-	startDate := time.Now()
-	endDate := startDate.AddDate(0, product.DurationMonths, 0)
-	var trialEndDate *time.Time
-
-	// Handle trial period if requested
-	if input.WithTrial {
-		trialEnd := startDate.AddDate(0, 1, 0) // 1 month trial
-		trialEndDate = &trialEnd
-
-		// Start date is after trial period
-		startDate = trialEnd
-		endDate = trialEnd.AddDate(0, product.DurationMonths, 0)
+	status := models.SubscriptionStatusActive
+	if quote.TrialEndDate != nil {
+		status = models.SubscriptionStatusTrialing
 	}
 
 	// Create subscription object
 	subscription := &models.Subscription{
-		ID:            uuid.New(),
-		UserID:        input.UserID,
-		ProductID:     input.ProductID,
-		Status:        models.SubscriptionStatusActive,
-		StartDate:     startDate,
-		EndDate:       endDate,
-		TrialEndDate:  trialEndDate,
-		OriginalPrice: product.Price,
-		TaxAmount:     product.Price.Mul(product.TaxRate),
-		TotalAmount:   product.Price.Add(product.Price.Mul(product.TaxRate)),
+		ID:              uuid.New(),
+		UserID:          input.UserID,
+		ProductID:       input.ProductID,
+		Status:          status,
+		StartDate:       quote.StartDate,
+		EndDate:         quote.EndDate,
+		TrialEndDate:    quote.TrialEndDate,
+		Currency:        quote.Currency,
+		OriginalPrice:   quote.OriginalPrice,
+		DiscountedPrice: quote.DiscountedPrice,
+		TaxAmount:       quote.TaxAmount,
+		TaxComponents:   quote.TaxComponents,
+		TotalAmount:     quote.TotalAmount,
+		ReverseCharge:   quote.ReverseCharge,
+		AutoRenew:       input.AutoRenew,
+	}
+	if quote.validation != nil {
+		subscription.CustomerVATID = quote.validation.VATID
+		subscription.VATValidationID = &quote.validation.ID
 	}
 
-	// Apply voucher if provided
-	if input.VoucherCode != "" {
-		voucher, err := s.voucherRepo.GetByCode(ctx, input.VoucherCode)
-		if err != nil {
-			return nil, fmt.Errorf("invalid voucher code: %w", err)
+	// Redeem the voucher if provided
+	var redemption *models.VoucherRedemption
+	if quote.Voucher != nil {
+		startDiscount(subscription, quote.Voucher)
+
+		redemption = &models.VoucherRedemption{
+			ID:             uuid.New(),
+			VoucherID:      quote.Voucher.ID,
+			UserID:         subscription.UserID,
+			SubscriptionID: subscription.ID,
+			DiscountAmount: quote.Discount,
 		}
+	}
 
-		// Validate voucher
-		if err := s.validateVoucher(voucher, product.ID); err != nil {
-			return nil, err
+	// The first period is billed now, or when the trial ends. A trial still needs a
+	// payment method, so that it can be billed then.
+	var firstInvoice *models.Invoice
+	var firstPayment *models.Payment
+	if quote.TrialEndDate != nil {
+		if quote.TotalAmount.IsPositive() {
+			if err := s.payments.RequirePaymentMethod(ctx, input.UserID); err != nil {
+				return nil, err
+			}
 		}
+	} else {
+		firstInvoice = invoice.Build(invoice.BuildInput{
+			Subscription: subscription,
+			Product:      quote.Product,
+			Reason:       models.InvoiceReasonSubscriptionCreate,
+			IssuedAt:     time.Now(),
+			Taxes:        subscription.TaxComponents,
+		})
 
-		// Apply discount
-		var discountedPrice decimal.Decimal
-		if voucher.DiscountType == models.DiscountTypeFixed {
-			discountedPrice = product.Price.Sub(voucher.DiscountValue)
-		} else { // Percentage
-			discountedPrice = product.Price.Sub(product.Price.Mul(voucher.DiscountValue.Div(decimal.NewFromInt(100))))
+		// Nothing else is saved unless the charge succeeds. A charge the provider may
+		// still collect, because it timed out or needs authentication, is kept without
+		// its invoice, so that it is refunded if it is collected later.
+		firstPayment, err = s.chargeInvoice(ctx, subscription, firstInvoice)
+		if err != nil {
+			if firstPayment != nil && (firstPayment.Status == models.PaymentStatusPending ||
+				firstPayment.Status == models.PaymentStatusRequiresAction) {
+				if saveErr := s.uow.Do(ctx, func(tx repository.Transaction) error {
+					return s.saveFailedPayment(ctx, tx, firstPayment)
+				}); saveErr != nil {
+					log.Printf("Failed to save pending payment %s of subscription %s that was not created: %v",
+						firstPayment.ID, subscription.ID, saveErr)
+				}
+			}
+			return nil, err
 		}
+	}
 
-		// Ensure price doesn't go below zero
-		if discountedPrice.IsNegative() {
-			discountedPrice = decimal.NewFromInt(0)
+	// Save the subscription, redeem the voucher and invoice the first period together,
+	// so a redemption that exceeds the voucher's limits leaves no subscription behind
+	err = s.uow.Do(ctx, func(tx repository.Transaction) error {
+		if err := tx.Subscriptions().Create(ctx, subscription); err != nil {
+			return fmt.Errorf("failed to create subscription: %w", err)
 		}
 
-		subscription.VoucherID = &voucher.ID
-		subscription.DiscountedPrice = &discountedPrice
-		subscription.TaxAmount = discountedPrice.Mul(product.TaxRate)
-		subscription.TotalAmount = discountedPrice.Add(subscription.TaxAmount)
-	}
+		if redemption != nil {
+			if err := tx.Vouchers().Redeem(ctx, redemption); err != nil {
+				return err
+			}
+		}
 
-	// Save subscription
-	if err := s.repo.Create(ctx, subscription); err != nil {
-		return nil, fmt.Errorf("failed to create subscription: %w", err)
+		return s.saveBilling(ctx, tx, firstInvoice, firstPayment)
+	})
+	if err != nil {
+		// The customer was charged for a subscription that was not created
+		s.refundUnsaved(ctx, subscription, firstPayment)
+		return nil, err
 	}
 
 	// Set product relationship for the response
-	subscription.Product = product
+	subscription.Product = quote.Product
 
 	return subscription, nil
 }
@@ -153,123 +212,134 @@ func (s *Service) GetUserSubscriptions(ctx context.Context, userID uuid.UUID) ([
 	return s.repo.GetByUserID(ctx, userID)
 }
 
-func (s *Service) PauseSubscription(ctx context.Context, id uuid.UUID) error {
+// SetAutoRenew turns automatic renewal at the end of the billing period on or off
+func (s *Service) SetAutoRenew(ctx context.Context, id uuid.UUID, autoRenew bool) (*models.Subscription, error) {
 	subscription, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Check if the subscription is active
-	if subscription.Status != models.SubscriptionStatusActive {
-		return errors.ErrSubscriptionNotActive
+	if subscription.Status == models.SubscriptionStatusCancelled || subscription.Status == models.SubscriptionStatusExpired {
+		return nil, errors.ErrSubscriptionNotActive
 	}
 
-	// Check if subscription is in trial period
-	if subscription.TrialEndDate != nil && time.Now().Before(*subscription.TrialEndDate) {
-		return errors.ErrSubscriptionInTrial
-	}
+	subscription.AutoRenew = autoRenew
 
-	// Create state change record
-	previousState := subscription.Status
-	subscription.Status = models.SubscriptionStatusPaused
-
-	stateChange := &models.SubscriptionStateChange{
-		ID:             uuid.New(),
-		SubscriptionID: subscription.ID,
-		PreviousState:  previousState,
-		NewState:       subscription.Status,
-		ChangedAt:      time.Now(),
-		Reason:         "User requested pause",
-	}
-
-	// Update subscription
 	if err := s.repo.Update(ctx, subscription); err != nil {
-		return fmt.Errorf("failed to update subscription: %w", err)
+		if err == errors.ErrSubscriptionConflict {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update subscription: %w", err)
 	}
 
-	// Log state change
-	if err := s.repo.CreateStateChange(ctx, stateChange); err != nil {
-		return fmt.Errorf("failed to log state change: %w", err)
-	}
+	return subscription, nil
+}
 
-	return nil
+func (s *Service) PauseSubscription(ctx context.Context, id uuid.UUID) error {
+	_, err := s.PauseSubscriptionUntil(ctx, id, nil)
+	return err
 }
 
-func (s *Service) UnpauseSubscription(ctx context.Context, id uuid.UUID) error {
+// PauseSubscriptionUntil pauses a subscription. It resumes automatically at resumeAt,
+// or after the product's maximum pause length when no date is given.
+func (s *Service) PauseSubscriptionUntil(ctx context.Context, id uuid.UUID, resumeAt *time.Time) (*models.Subscription, error) {
 	subscription, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Check if the subscription is paused
-	if subscription.Status != models.SubscriptionStatusPaused {
-		return errors.ErrSubscriptionAlreadyPaused
+	now := time.Now()
+	if err := checkTransition(subscription, ActionPause, now); err != nil {
+		return nil, err
 	}
 
-	// Create state change record
-	previousState := subscription.Status
-	subscription.Status = models.SubscriptionStatusActive
-
-	stateChange := &models.SubscriptionStateChange{
-		ID:             uuid.New(),
-		SubscriptionID: subscription.ID,
-		PreviousState:  previousState,
-		NewState:       subscription.Status,
-		ChangedAt:      time.Now(),
-		Reason:         "User requested unpause",
+	if resumeAt != nil && !resumeAt.After(now) {
+		return nil, errors.ValidationErrors{{
+			Field:   "resume_at",
+			Message: "must be in the future",
+		}}
 	}
 
-	// Update subscription
-	if err := s.repo.Update(ctx, subscription); err != nil {
-		return fmt.Errorf("failed to update subscription: %w", err)
+	product, err := s.productRepo.GetByID(ctx, subscription.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
 	}
 
-	// Log state change
-	if err := s.repo.CreateStateChange(ctx, stateChange); err != nil {
-		return fmt.Errorf("failed to log state change: %w", err)
+	// Enforce the product's maximum pause length
+	if product.MaxPauseDays > 0 {
+		latestResume := now.AddDate(0, 0, product.MaxPauseDays)
+		if resumeAt == nil {
+			resumeAt = &latestResume
+		} else if resumeAt.After(latestResume) {
+			return nil, errors.ErrPauseTooLong
+		}
 	}
 
-	return nil
+	reason := "User requested pause"
+	if resumeAt != nil {
+		reason = fmt.Sprintf("User requested pause until %s", resumeAt.Format(time.RFC3339))
+	}
+
+	subscription.ResumeAt = resumeAt
+	if err := s.transition(ctx, subscription, ActionPause, transitionOptions{
+		At:     now,
+		Reason: reason,
+		Write: func(tx repository.Transaction) error {
+			// Record the pause for the history
+			pause := &models.SubscriptionPause{
+				ID:                uuid.New(),
+				SubscriptionID:    subscription.ID,
+				PausedAt:          *subscription.PausedAt,
+				ScheduledResumeAt: subscription.ResumeAt,
+			}
+			if err := tx.Subscriptions().CreatePause(ctx, pause); err != nil {
+				return fmt.Errorf("failed to record pause: %w", err)
+			}
+			return nil
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
 }
 
-func (s *Service) CancelSubscription(ctx context.Context, id uuid.UUID) error {
+func (s *Service) UnpauseSubscription(ctx context.Context, id uuid.UUID) error {
 	subscription, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	// Can cancel from any state
-	if subscription.Status == models.SubscriptionStatusCancelled {
-		return nil // Already cancelled, nothing to do
-	}
-
-	// Create state change record
-	previousState := subscription.Status
-	subscription.Status = models.SubscriptionStatusCancelled
-
-	stateChange := &models.SubscriptionStateChange{
-		ID:             uuid.New(),
-		SubscriptionID: subscription.ID,
-		PreviousState:  previousState,
-		NewState:       subscription.Status,
-		ChangedAt:      time.Now(),
-		Reason:         "User requested cancellation",
-	}
-
-	// Update subscription
-	if err := s.repo.Update(ctx, subscription); err != nil {
-		return fmt.Errorf("failed to update subscription: %w", err)
-	}
+	return s.resumeSubscription(ctx, subscription, "User requested unpause")
+}
 
-	// Log state change
-	if err := s.repo.CreateStateChange(ctx, stateChange); err != nil {
-		return fmt.Errorf("failed to log state change: %w", err)
-	}
+// resumeSubscription reactivates a paused subscription. The state machine extends
+// its end date by the time it spent paused.
+func (s *Service) resumeSubscription(ctx context.Context, subscription *models.Subscription, reason string) error {
+	now := time.Now()
+
+	return s.transition(ctx, subscription, ActionResume, transitionOptions{
+		At:     now,
+		Reason: reason,
+		Write: func(tx repository.Transaction) error {
+			// Close the pause in the history
+			if err := tx.Subscriptions().EndPause(ctx, subscription.ID, now); err != nil {
+				return fmt.Errorf("failed to record resume: %w", err)
+			}
+			return nil
+		},
+	})
+}
 
-	return nil
+func (s *Service) CancelSubscription(ctx context.Context, id uuid.UUID) error {
+	_, err := s.Cancel(ctx, CancelSubscriptionInput{
+		SubscriptionID: id,
+		Mode:           CancelImmediately,
+	})
+	return err
 }
 
-func (s *Service) validateVoucher(voucher *models.Voucher, productID uuid.UUID) error {
+func (s *Service) validateVoucher(voucher *models.Voucher, productID uuid.UUID, currencyCode string) error {
 	// Check if voucher is active
 	if !voucher.IsActive {
 		return errors.ErrVoucherInactive
@@ -285,5 +355,15 @@ func (s *Service) validateVoucher(voucher *models.Voucher, productID uuid.UUID)
 		return errors.ErrVoucherInvalid
 	}
 
+	// A fixed discount is an amount in the voucher's currency
+	if voucher.Currency != "" && voucher.Currency != currencyCode {
+		return errors.ErrVoucherCurrency
+	}
+
+	// Fail early when the voucher is used up; Redeem enforces the limits atomically
+	if voucher.RemainingRedemptions() == 0 {
+		return errors.ErrVoucherRedemptionLimitReached
+	}
+
 	return nil
 }
@@ -2,30 +2,40 @@ package subscription_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/assylzhan-a/subscription-service/internal/app/exchange"
+	"github.com/assylzhan-a/subscription-service/internal/app/payment"
 	"github.com/assylzhan-a/subscription-service/internal/app/subscription"
+	"github.com/assylzhan-a/subscription-service/internal/app/tax"
 	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
 	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
 type mockSubscriptionRepository struct {
 	subscriptions map[uuid.UUID]*models.Subscription
-	stateChanges  []*models.SubscriptionStateChange
+	// versions holds the stored version of each subscription
+	versions     map[uuid.UUID]int
+	stateChanges []*models.SubscriptionStateChange
+	pauses       []*models.SubscriptionPause
 }
 
 func newMockSubscriptionRepository() *mockSubscriptionRepository {
 	return &mockSubscriptionRepository{
 		subscriptions: make(map[uuid.UUID]*models.Subscription),
+		versions:      make(map[uuid.UUID]int),
 		stateChanges:  make([]*models.SubscriptionStateChange, 0),
 	}
 }
 
 func (m *mockSubscriptionRepository) Create(ctx context.Context, subscription *models.Subscription) error {
 	m.subscriptions[subscription.ID] = subscription
+	m.versions[subscription.ID] = subscription.Version
 	return nil
 }
 
@@ -50,6 +60,11 @@ func (m *mockSubscriptionRepository) Update(ctx context.Context, subscription *m
 	if _, ok := m.subscriptions[subscription.ID]; !ok {
 		return errors.ErrSubscriptionNotFound
 	}
+	if m.versions[subscription.ID] != subscription.Version {
+		return errors.ErrSubscriptionConflict
+	}
+	subscription.Version++
+	m.versions[subscription.ID] = subscription.Version
 	m.subscriptions[subscription.ID] = subscription
 	return nil
 }
@@ -77,377 +92,3465 @@ func (m *mockSubscriptionRepository) GetStateChangesBySubscriptionID(ctx context
 	return result, nil
 }
 
-type mockProductRepository struct {
-	products map[uuid.UUID]*models.Product
+func (m *mockSubscriptionRepository) ClaimDueForRenewal(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error) {
+	var result []*models.Subscription
+	for _, sub := range m.subscriptions {
+		if len(result) == limit {
+			break
+		}
+		if sub.Status == models.SubscriptionStatusActive && !sub.EndDate.After(now) && !sub.CancelAtPeriodEnd {
+			result = append(result, sub)
+		}
+	}
+	return result, nil
 }
 
-func newMockProductRepository() *mockProductRepository {
-	return &mockProductRepository{
-		products: make(map[uuid.UUID]*models.Product),
+func (m *mockSubscriptionRepository) ClaimDueForActivation(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error) {
+	var result []*models.Subscription
+	for _, sub := range m.subscriptions {
+		if len(result) == limit {
+			break
+		}
+		if sub.Status == models.SubscriptionStatusTrialing && sub.TrialEndDate != nil && !sub.TrialEndDate.After(now) {
+			result = append(result, sub)
+		}
 	}
+	return result, nil
 }
 
-func (m *mockProductRepository) Create(ctx context.Context, product *models.Product) error {
-	m.products[product.ID] = product
+func (m *mockSubscriptionRepository) ClaimDueForCancellation(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error) {
+	var result []*models.Subscription
+	for _, sub := range m.subscriptions {
+		if len(result) == limit {
+			break
+		}
+		live := sub.Status == models.SubscriptionStatusActive || sub.Status == models.SubscriptionStatusPastDue ||
+			sub.Status == models.SubscriptionStatusPaused && sub.ResumeAt == nil
+		if live && !sub.EndDate.After(now) && sub.CancelAtPeriodEnd {
+			result = append(result, sub)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockSubscriptionRepository) ClaimDueForResume(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error) {
+	var result []*models.Subscription
+	for _, sub := range m.subscriptions {
+		if len(result) == limit {
+			break
+		}
+		if sub.Status == models.SubscriptionStatusPaused && sub.ResumeAt != nil && !sub.ResumeAt.After(now) {
+			result = append(result, sub)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockSubscriptionRepository) ClaimDueForPaymentRetry(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error) {
+	var result []*models.Subscription
+	for _, sub := range m.subscriptions {
+		if len(result) == limit {
+			break
+		}
+		if sub.Status == models.SubscriptionStatusPastDue && sub.NextPaymentAttemptAt != nil && !sub.NextPaymentAttemptAt.After(now) && !sub.CancelAtPeriodEnd {
+			result = append(result, sub)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockSubscriptionRepository) CreatePause(ctx context.Context, pause *models.SubscriptionPause) error {
+	m.pauses = append(m.pauses, pause)
 	return nil
 }
 
-func (m *mockProductRepository) GetAll(ctx context.Context) ([]*models.Product, error) {
-	products := make([]*models.Product, 0, len(m.products))
-	for _, p := range m.products {
-		products = append(products, p)
+func (m *mockSubscriptionRepository) EndPause(ctx context.Context, subscriptionID uuid.UUID, resumedAt time.Time) error {
+	for _, pause := range m.pauses {
+		if pause.SubscriptionID == subscriptionID && pause.ResumedAt == nil {
+			pause.ResumedAt = &resumedAt
+		}
 	}
-	return products, nil
+	return nil
 }
 
-func (m *mockProductRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Product, error) {
-	if product, ok := m.products[id]; ok {
-		return product, nil
+func (m *mockSubscriptionRepository) GetPausesBySubscriptionID(ctx context.Context, subscriptionID uuid.UUID) ([]*models.SubscriptionPause, error) {
+	var result []*models.SubscriptionPause
+	for _, pause := range m.pauses {
+		if pause.SubscriptionID == subscriptionID {
+			result = append(result, pause)
+		}
 	}
-	return nil, errors.ErrProductNotFound
+	return result, nil
 }
 
-func (m *mockProductRepository) Update(ctx context.Context, product *models.Product) error {
-	if _, ok := m.products[product.ID]; !ok {
-		return errors.ErrProductNotFound
+// mockUnitOfWork runs the function against the mock repository without a real transaction
+type mockUnitOfWork struct {
+	subscriptions *mockSubscriptionRepository
+	vouchers      *mockVoucherRepository
+	invoices      *mockInvoiceRepository
+	payments      *mockPaymentRepository
+	creditNotes   *mockCreditNoteRepository
+	credits       *mockCreditRepository
+	ledger        *mockLedgerRepository
+}
+
+func newMockUnitOfWork(subscriptions *mockSubscriptionRepository, vouchers *mockVoucherRepository) *mockUnitOfWork {
+	return &mockUnitOfWork{
+		subscriptions: subscriptions,
+		vouchers:      vouchers,
+		invoices:      newMockInvoiceRepository(),
+		payments:      newMockPaymentRepository(),
+		creditNotes:   newMockCreditNoteRepository(),
+		credits:       newMockCreditRepository(),
+		ledger:        &mockLedgerRepository{},
 	}
-	m.products[product.ID] = product
+}
+
+func (m *mockUnitOfWork) Do(ctx context.Context, fn func(tx repository.Transaction) error) error {
+	return fn(m)
+}
+
+func (m *mockUnitOfWork) Subscriptions() repository.SubscriptionRepository {
+	return m.subscriptions
+}
+
+func (m *mockUnitOfWork) Vouchers() repository.VoucherRepository {
+	return m.vouchers
+}
+
+func (m *mockUnitOfWork) Campaigns() repository.CampaignRepository {
 	return nil
 }
 
-func (m *mockProductRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	if _, ok := m.products[id]; !ok {
-		return errors.ErrProductNotFound
+func (m *mockUnitOfWork) Invoices() repository.InvoiceRepository {
+	return m.invoices
+}
+
+func (m *mockUnitOfWork) Payments() repository.PaymentRepository {
+	return m.payments
+}
+
+func (m *mockUnitOfWork) CreditNotes() repository.CreditNoteRepository {
+	return m.creditNotes
+}
+
+func (m *mockUnitOfWork) Credits() repository.CreditRepository {
+	return m.credits
+}
+
+func (m *mockUnitOfWork) Ledger() repository.LedgerRepository {
+	return m.ledger
+}
+
+// mockLedgerRepository records the posted journal entries
+type mockLedgerRepository struct {
+	entries []*models.JournalEntry
+}
+
+func (m *mockLedgerRepository) Post(ctx context.Context, entry *models.JournalEntry) error {
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *mockLedgerRepository) GetDeferredRevenue(ctx context.Context, invoiceID uuid.UUID) (decimal.Decimal, error) {
+	amount := decimal.Zero
+	for _, entry := range m.entries {
+		if entry.InvoiceID == nil || *entry.InvoiceID != invoiceID {
+			continue
+		}
+		for _, line := range entry.Lines {
+			if line.Account == models.LedgerAccountDeferredRevenue {
+				amount = amount.Add(line.Credit).Sub(line.Debit)
+			}
+		}
 	}
-	delete(m.products, id)
+	return amount, nil
+}
+
+func (m *mockLedgerRepository) GetDueDeferredRevenue(ctx context.Context, end time.Time, limit int) ([]*models.DeferredRevenue, error) {
+	return nil, nil
+}
+
+func (m *mockLedgerRepository) GetAccountTotals(ctx context.Context, asOf time.Time) ([]*models.AccountTotals, error) {
+	return nil, nil
+}
+
+func (m *mockLedgerRepository) GetUnbalancedEntries(ctx context.Context) ([]uuid.UUID, error) {
+	return nil, nil
+}
+
+// ofType returns the posted entries of a type
+func (m *mockLedgerRepository) ofType(entryType models.JournalEntryType) []*models.JournalEntry {
+	var result []*models.JournalEntry
+	for _, entry := range m.entries {
+		if entry.Type == entryType {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+type mockPaymentRepository struct {
+	accounts map[uuid.UUID]*models.PaymentAccount
+	// defaultAccount is returned for users without an account of their own
+	defaultAccount *models.PaymentAccount
+	// withoutAccount lists users that have no account, not even the default one
+	withoutAccount map[uuid.UUID]bool
+	payments       []*models.Payment
+}
+
+func newMockPaymentRepository() *mockPaymentRepository {
+	return &mockPaymentRepository{
+		accounts:       make(map[uuid.UUID]*models.PaymentAccount),
+		withoutAccount: make(map[uuid.UUID]bool),
+	}
+}
+
+func (m *mockPaymentRepository) GetAccount(ctx context.Context, userID uuid.UUID, provider string) (*models.PaymentAccount, error) {
+	if account, ok := m.accounts[userID]; ok {
+		return account, nil
+	}
+	if m.defaultAccount != nil && !m.withoutAccount[userID] {
+		account := *m.defaultAccount
+		account.UserID = userID
+		return &account, nil
+	}
+	return nil, errors.ErrPaymentAccountNotFound
+}
+
+func (m *mockPaymentRepository) SaveAccount(ctx context.Context, account *models.PaymentAccount) error {
+	m.accounts[account.UserID] = account
 	return nil
 }
 
-type mockVoucherRepository struct {
-	vouchers map[uuid.UUID]*models.Voucher
-	codes    map[string]*models.Voucher
+func (m *mockPaymentRepository) Create(ctx context.Context, payment *models.Payment) error {
+	m.payments = append(m.payments, payment)
+	return nil
 }
 
-func newMockVoucherRepository() *mockVoucherRepository {
-	return &mockVoucherRepository{
-		vouchers: make(map[uuid.UUID]*models.Voucher),
-		codes:    make(map[string]*models.Voucher),
+func (m *mockPaymentRepository) GetBySubscriptionID(ctx context.Context, subscriptionID uuid.UUID) ([]*models.Payment, error) {
+	var result []*models.Payment
+	for _, payment := range m.payments {
+		if payment.SubscriptionID == subscriptionID {
+			result = append(result, payment)
+		}
 	}
+	return result, nil
 }
 
-func (m *mockVoucherRepository) Create(ctx context.Context, voucher *models.Voucher) error {
-	m.vouchers[voucher.ID] = voucher
-	m.codes[voucher.Code] = voucher
+func (m *mockPaymentRepository) GetByInvoiceID(ctx context.Context, invoiceID uuid.UUID) ([]*models.Payment, error) {
+	var result []*models.Payment
+	for _, payment := range m.payments {
+		if payment.InvoiceID != nil && *payment.InvoiceID == invoiceID {
+			result = append(result, payment)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockPaymentRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Payment, error) {
+	for _, payment := range m.payments {
+		if payment.ID == id {
+			copied := *payment
+			return &copied, nil
+		}
+	}
+	return nil, errors.ErrPaymentNotFound
+}
+
+func (m *mockPaymentRepository) GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*models.Payment, error) {
+	return m.GetByID(ctx, id)
+}
+
+func (m *mockPaymentRepository) GetByProviderPaymentID(ctx context.Context, provider, providerPaymentID string) (*models.Payment, error) {
+	for _, payment := range m.payments {
+		if payment.Provider == provider && payment.ProviderPaymentID == providerPaymentID {
+			copied := *payment
+			return &copied, nil
+		}
+	}
+	return nil, errors.ErrPaymentNotFound
+}
+
+func (m *mockPaymentRepository) Update(ctx context.Context, payment *models.Payment) error {
+	for i, existing := range m.payments {
+		if existing.ID == payment.ID {
+			copied := *payment
+			m.payments[i] = &copied
+			return nil
+		}
+	}
+	return errors.ErrPaymentNotFound
+}
+
+// newTestPayments returns a payment service backed by repo, in which every user has a
+// payment method at a fake provider. Charges succeed unless other outcomes are scripted.
+func newTestPayments(repo *mockPaymentRepository) (*payment.Service, *payment.FakeProvider) {
+	ctx := context.Background()
+	provider := payment.NewFakeProvider()
+	customerID, _ := provider.CreateCustomer(ctx, payment.Customer{})
+	paymentMethodID, _ := provider.AttachPaymentMethod(ctx, customerID, payment.FakeTokenSucceed)
+	repo.defaultAccount = &models.PaymentAccount{
+		Provider:        provider.Name(),
+		CustomerID:      customerID,
+		PaymentMethodID: paymentMethodID,
+	}
+
+	return payment.NewService(provider, repo, nil, 50*time.Millisecond), provider
+}
+
+func newTestPaymentService() *payment.Service {
+	service, _ := newTestPayments(newMockPaymentRepository())
+	return service
+}
+
+// mockUserRepository knows every user; users it has no entry for have no billing address
+type mockUserRepository struct {
+	users map[uuid.UUID]*models.User
+}
+
+func newMockUserRepository() *mockUserRepository {
+	return &mockUserRepository{users: make(map[uuid.UUID]*models.User)}
+}
+
+func (m *mockUserRepository) Create(ctx context.Context, user *models.User) error {
+	m.users[user.ID] = user
 	return nil
 }
 
-func (m *mockVoucherRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Voucher, error) {
-	if voucher, ok := m.vouchers[id]; ok {
-		return voucher, nil
+func (m *mockUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if user, ok := m.users[id]; ok {
+		return user, nil
 	}
-	return nil, errors.ErrVoucherNotFound
+	return &models.User{ID: id}, nil
 }
 
-func (m *mockVoucherRepository) GetByCode(ctx context.Context, code string) (*models.Voucher, error) {
-	if voucher, ok := m.codes[code]; ok {
-		return voucher, nil
+func (m *mockUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return nil, errors.ErrUserNotFound
+}
+
+func (m *mockUserRepository) Update(ctx context.Context, user *models.User) error {
+	m.users[user.ID] = user
+	return nil
+}
+
+func (m *mockUserRepository) CountByRole(ctx context.Context, role models.UserRole) (int, error) {
+	return len(m.users), nil
+}
+
+// newTestTaxService returns a tax service with the built-in rules for users without
+// a billing address, who pay the product's tax rate
+func newTestTaxService() *tax.Service {
+	return tax.NewService(tax.NewRulesCalculator(tax.DefaultRules()), newMockUserRepository(), &mockVATValidationRepository{}, nil, "")
+}
+
+// newTestExchangeService returns an exchange service reporting in EUR that knows the
+// rates in testExchangeRates
+func newTestExchangeService() *exchange.Service {
+	return exchange.NewService(&mockExchangeRateRepository{rates: testExchangeRates()}, "EUR", "EUR")
+}
+
+// testExchangeRates are the EUR rates of a week ago, which are valid today
+func testExchangeRates() []*models.ExchangeRate {
+	day := time.Now().UTC().AddDate(0, 0, -7).Truncate(24 * time.Hour)
+	return []*models.ExchangeRate{
+		{Date: day, Base: "EUR", Currency: "USD", Rate: decimal.RequireFromString("1.25"), Source: "csv"},
+		{Date: day, Base: "EUR", Currency: "JPY", Rate: decimal.RequireFromString("160"), Source: "csv"},
 	}
-	return nil, errors.ErrVoucherNotFound
 }
 
-func (m *mockVoucherRepository) GetByProductID(ctx context.Context, productID uuid.UUID) ([]*models.Voucher, error) {
-	var result []*models.Voucher
-	for _, v := range m.vouchers {
-		if v.ProductID != nil && *v.ProductID == productID {
-			result = append(result, v)
-		}
+type mockExchangeRateRepository struct {
+	rates []*models.ExchangeRate
+}
+
+func (m *mockExchangeRateRepository) Save(ctx context.Context, rates []*models.ExchangeRate) error {
+	m.rates = append(m.rates, rates...)
+	return nil
+}
+
+func (m *mockExchangeRateRepository) GetLatest(ctx context.Context, base, currency string, on time.Time) (*models.ExchangeRate, error) {
+	var latest *models.ExchangeRate
+	for _, rate := range m.rates {
+		if rate.Base == base && rate.Currency == currency && !rate.Date.After(on) && (latest == nil || rate.Date.After(latest.Date)) {
+			latest = rate
+		}
+	}
+	if latest == nil {
+		return nil, errors.ErrExchangeRateNotFound
+	}
+	return latest, nil
+}
+
+func (m *mockExchangeRateRepository) GetByDate(ctx context.Context, date time.Time) ([]*models.ExchangeRate, error) {
+	var result []*models.ExchangeRate
+	for _, rate := range m.rates {
+		if rate.Date.Equal(date) {
+			result = append(result, rate)
+		}
+	}
+	return result, nil
+}
+
+type mockVATValidationRepository struct {
+	validations []*models.VATValidation
+}
+
+func (m *mockVATValidationRepository) Create(ctx context.Context, validation *models.VATValidation) error {
+	m.validations = append(m.validations, validation)
+	return nil
+}
+
+func (m *mockVATValidationRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.VATValidation, error) {
+	var result []*models.VATValidation
+	for i := len(m.validations) - 1; i >= 0; i-- {
+		if m.validations[i].UserID == userID {
+			result = append(result, m.validations[i])
+		}
+	}
+	return result, nil
+}
+
+// mockInvoiceRepository numbers invoices like the database, per year without gaps
+type mockInvoiceRepository struct {
+	invoices []*models.Invoice
+	numbers  map[int]int
+}
+
+func newMockInvoiceRepository() *mockInvoiceRepository {
+	return &mockInvoiceRepository{numbers: make(map[int]int)}
+}
+
+func (m *mockInvoiceRepository) Create(ctx context.Context, invoice *models.Invoice) error {
+	year := invoice.IssuedAt.UTC().Year()
+	m.numbers[year]++
+	invoice.Number = fmt.Sprintf("INV-%d-%06d", year, m.numbers[year])
+	m.invoices = append(m.invoices, invoice)
+	return nil
+}
+
+func (m *mockInvoiceRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Invoice, error) {
+	for _, invoice := range m.invoices {
+		if invoice.ID == id {
+			return invoice, nil
+		}
+	}
+	return nil, errors.ErrInvoiceNotFound
+}
+
+func (m *mockInvoiceRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Invoice, error) {
+	var result []*models.Invoice
+	for _, invoice := range m.invoices {
+		if invoice.UserID == userID {
+			result = append(result, invoice)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockInvoiceRepository) GetIssuedBetween(ctx context.Context, start, end time.Time) ([]*models.Invoice, error) {
+	var result []*models.Invoice
+	for _, invoice := range m.invoices {
+		if !invoice.IssuedAt.Before(start) && invoice.IssuedAt.Before(end) {
+			result = append(result, invoice)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockInvoiceRepository) UpdatePaymentStatus(ctx context.Context, id uuid.UUID, status models.InvoicePaymentStatus) error {
+	for _, invoice := range m.invoices {
+		if invoice.ID == id {
+			invoice.PaymentStatus = status
+			return nil
+		}
+	}
+	return errors.ErrInvoiceNotFound
+}
+
+// mockCreditNoteRepository numbers credit notes like the database, per year without gaps
+type mockCreditNoteRepository struct {
+	creditNotes []*models.CreditNote
+	numbers     map[int]int
+}
+
+func newMockCreditNoteRepository() *mockCreditNoteRepository {
+	return &mockCreditNoteRepository{numbers: make(map[int]int)}
+}
+
+func (m *mockCreditNoteRepository) Create(ctx context.Context, creditNote *models.CreditNote) error {
+	year := creditNote.IssuedAt.UTC().Year()
+	m.numbers[year]++
+	creditNote.Number = fmt.Sprintf("CN-%d-%06d", year, m.numbers[year])
+	m.creditNotes = append(m.creditNotes, creditNote)
+	return nil
+}
+
+func (m *mockCreditNoteRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.CreditNote, error) {
+	for _, creditNote := range m.creditNotes {
+		if creditNote.ID == id {
+			return creditNote, nil
+		}
+	}
+	return nil, errors.ErrCreditNoteNotFound
+}
+
+func (m *mockCreditNoteRepository) GetByInvoiceID(ctx context.Context, invoiceID uuid.UUID) ([]*models.CreditNote, error) {
+	var result []*models.CreditNote
+	for _, creditNote := range m.creditNotes {
+		if creditNote.InvoiceID == invoiceID {
+			result = append(result, creditNote)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockCreditNoteRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.CreditNote, error) {
+	var result []*models.CreditNote
+	for _, creditNote := range m.creditNotes {
+		if creditNote.UserID == userID {
+			result = append(result, creditNote)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockCreditNoteRepository) GetIssuedBetween(ctx context.Context, start, end time.Time) ([]*models.CreditNote, error) {
+	var result []*models.CreditNote
+	for _, creditNote := range m.creditNotes {
+		if !creditNote.IssuedAt.Before(start) && creditNote.IssuedAt.Before(end) {
+			result = append(result, creditNote)
+		}
+	}
+	return result, nil
+}
+
+// mockCreditRepository keeps the balances like the database, never below zero
+type mockCreditRepository struct {
+	balances map[uuid.UUID]map[string]decimal.Decimal
+	entries  []*models.CreditEntry
+	// afterGetBalance runs after a balance is read, e.g. to spend it concurrently
+	afterGetBalance func()
+}
+
+func newMockCreditRepository() *mockCreditRepository {
+	return &mockCreditRepository{balances: make(map[uuid.UUID]map[string]decimal.Decimal)}
+}
+
+func (m *mockCreditRepository) GetBalance(ctx context.Context, userID uuid.UUID, currency string) (decimal.Decimal, error) {
+	balance := m.balances[userID][currency]
+	if m.afterGetBalance != nil {
+		m.afterGetBalance()
+	}
+	return balance, nil
+}
+
+func (m *mockCreditRepository) GetBalances(ctx context.Context, userID uuid.UUID) (map[string]decimal.Decimal, error) {
+	balances := make(map[string]decimal.Decimal)
+	for currency, balance := range m.balances[userID] {
+		balances[currency] = balance
+	}
+	return balances, nil
+}
+
+func (m *mockCreditRepository) AddEntry(ctx context.Context, entry *models.CreditEntry) error {
+	change := entry.Amount
+	if entry.Type == models.CreditEntryTypeDebit {
+		change = change.Neg()
+	}
+
+	balance := m.balances[entry.UserID][entry.Currency].Add(change)
+	if balance.IsNegative() {
+		return errors.ErrInsufficientCredit
+	}
+
+	if m.balances[entry.UserID] == nil {
+		m.balances[entry.UserID] = make(map[string]decimal.Decimal)
+	}
+	m.balances[entry.UserID][entry.Currency] = balance
+	entry.BalanceAfter = balance
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *mockCreditRepository) GetEntries(ctx context.Context, userID uuid.UUID) ([]*models.CreditEntry, error) {
+	var result []*models.CreditEntry
+	for _, entry := range m.entries {
+		if entry.UserID == userID {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+type mockProductRepository struct {
+	products map[uuid.UUID]*models.Product
+}
+
+func newMockProductRepository() *mockProductRepository {
+	return &mockProductRepository{
+		products: make(map[uuid.UUID]*models.Product),
+	}
+}
+
+func (m *mockProductRepository) Create(ctx context.Context, product *models.Product) error {
+	m.products[product.ID] = product
+	return nil
+}
+
+func (m *mockProductRepository) GetAll(ctx context.Context) ([]*models.Product, error) {
+	products := make([]*models.Product, 0, len(m.products))
+	for _, p := range m.products {
+		products = append(products, p)
+	}
+	return products, nil
+}
+
+func (m *mockProductRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Product, error) {
+	if product, ok := m.products[id]; ok {
+		return product, nil
+	}
+	return nil, errors.ErrProductNotFound
+}
+
+func (m *mockProductRepository) Update(ctx context.Context, product *models.Product) error {
+	if _, ok := m.products[product.ID]; !ok {
+		return errors.ErrProductNotFound
+	}
+	m.products[product.ID] = product
+	return nil
+}
+
+func (m *mockProductRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if _, ok := m.products[id]; !ok {
+		return errors.ErrProductNotFound
+	}
+	delete(m.products, id)
+	return nil
+}
+
+type mockVoucherRepository struct {
+	vouchers    map[uuid.UUID]*models.Voucher
+	codes       map[string]*models.Voucher
+	redemptions []*models.VoucherRedemption
+}
+
+func newMockVoucherRepository() *mockVoucherRepository {
+	return &mockVoucherRepository{
+		vouchers: make(map[uuid.UUID]*models.Voucher),
+		codes:    make(map[string]*models.Voucher),
+	}
+}
+
+func (m *mockVoucherRepository) Create(ctx context.Context, voucher *models.Voucher) error {
+	m.vouchers[voucher.ID] = voucher
+	m.codes[voucher.Code] = voucher
+	return nil
+}
+
+func (m *mockVoucherRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Voucher, error) {
+	if voucher, ok := m.vouchers[id]; ok {
+		return voucher, nil
+	}
+	return nil, errors.ErrVoucherNotFound
+}
+
+func (m *mockVoucherRepository) GetByCode(ctx context.Context, code string) (*models.Voucher, error) {
+	if voucher, ok := m.codes[code]; ok {
+		return voucher, nil
+	}
+	return nil, errors.ErrVoucherNotFound
+}
+
+func (m *mockVoucherRepository) GetByProductID(ctx context.Context, productID uuid.UUID) ([]*models.Voucher, error) {
+	var result []*models.Voucher
+	for _, v := range m.vouchers {
+		if v.ProductID != nil && *v.ProductID == productID {
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockVoucherRepository) GetAllActive(ctx context.Context) ([]*models.Voucher, error) {
+	var result []*models.Voucher
+	for _, v := range m.vouchers {
+		if v.IsActive && v.ExpiresAt.After(time.Now()) {
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockVoucherRepository) Update(ctx context.Context, voucher *models.Voucher) error {
+	if _, ok := m.vouchers[voucher.ID]; !ok {
+		return errors.ErrVoucherNotFound
+	}
+	m.vouchers[voucher.ID] = voucher
+	m.codes[voucher.Code] = voucher
+	return nil
+}
+
+func (m *mockVoucherRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if voucher, ok := m.vouchers[id]; ok {
+		delete(m.vouchers, id)
+		delete(m.codes, voucher.Code)
+		return nil
+	}
+	return errors.ErrVoucherNotFound
+}
+
+func (m *mockVoucherRepository) GetByCampaignID(ctx context.Context, campaignID uuid.UUID) ([]*models.Voucher, error) {
+	var result []*models.Voucher
+	for _, v := range m.vouchers {
+		if v.CampaignID != nil && *v.CampaignID == campaignID {
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockVoucherRepository) CreateBatch(ctx context.Context, vouchers []*models.Voucher) ([]string, error) {
+	var skipped []string
+	for _, v := range vouchers {
+		if _, exists := m.codes[v.Code]; exists {
+			skipped = append(skipped, v.Code)
+			continue
+		}
+		m.vouchers[v.ID] = v
+		m.codes[v.Code] = v
+	}
+	return skipped, nil
+}
+
+func (m *mockVoucherRepository) Redeem(ctx context.Context, redemption *models.VoucherRedemption) error {
+	voucher, ok := m.vouchers[redemption.VoucherID]
+	if !ok {
+		return errors.ErrVoucherNotFound
+	}
+	if voucher.MaxRedemptions > 0 && voucher.RedemptionCount >= voucher.MaxRedemptions {
+		return errors.ErrVoucherRedemptionLimitReached
+	}
+
+	userRedemptions := 0
+	for _, r := range m.redemptions {
+		if r.VoucherID == redemption.VoucherID && r.UserID == redemption.UserID {
+			userRedemptions++
+		}
+	}
+	if voucher.MaxRedemptionsPerUser > 0 && userRedemptions >= voucher.MaxRedemptionsPerUser {
+		return errors.ErrVoucherUserLimitReached
+	}
+
+	voucher.RedemptionCount++
+	m.redemptions = append(m.redemptions, redemption)
+	return nil
+}
+
+func (m *mockVoucherRepository) GetRedemptionsByVoucherID(ctx context.Context, voucherID uuid.UUID) ([]*models.VoucherRedemption, error) {
+	var result []*models.VoucherRedemption
+	for _, r := range m.redemptions {
+		if r.VoucherID == voucherID {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+// Helper function to create a test product
+func createTestProduct() *models.Product {
+	return &models.Product{
+		ID:             uuid.New(),
+		Name:           "Test Product",
+		Description:    "Test Description",
+		Price:          decimal.NewFromFloat(19.99),
+		Currency:       "EUR",
+		DurationMonths: 1,
+		TaxRate:        decimal.NewFromFloat(0.20), // 20% tax
+		IsActive:       true,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+}
+
+// Helper function to create a test subscription
+func createTestSubscription(userID, productID uuid.UUID, status models.SubscriptionStatus) *models.Subscription {
+	return &models.Subscription{
+		ID:            uuid.New(),
+		UserID:        userID,
+		ProductID:     productID,
+		Status:        status,
+		StartDate:     time.Now(),
+		EndDate:       time.Now().AddDate(0, 1, 0), // 1 month duration
+		OriginalPrice: decimal.NewFromFloat(19.99),
+		TaxAmount:     decimal.NewFromFloat(4.00),
+		TotalAmount:   decimal.NewFromFloat(23.99),
+		Currency:      "EUR",
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+}
+
+// Helper function to create a test voucher
+func createTestVoucher() *models.Voucher {
+	return &models.Voucher{
+		ID:            uuid.New(),
+		Code:          "TEST20",
+		DiscountType:  models.DiscountTypePercentage,
+		DiscountValue: decimal.NewFromInt(20), // 20% discount
+		IsActive:      true,
+		ExpiresAt:     time.Now().AddDate(0, 1, 0), // Expires in 1 month
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+}
+
+// Tests for SubscriptionService
+func TestCreateSubscription(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, newMockUnitOfWork(subRepo, voucherRepo), newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	// Create a test product
+	product := createTestProduct()
+	err := productRepo.Create(ctx, product)
+	if err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
+
+	// Test case 1: Create subscription without voucher or trial
+	userID := uuid.New()
+	input := subscription.CreateSubscriptionInput{
+		UserID:    userID,
+		ProductID: product.ID,
+		WithTrial: false,
+	}
+
+	sub, err := service.CreateSubscription(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	if sub.UserID != userID {
+		t.Errorf("Expected UserID %v, got %v", userID, sub.UserID)
+	}
+
+	if sub.ProductID != product.ID {
+		t.Errorf("Expected ProductID %v, got %v", product.ID, sub.ProductID)
+	}
+
+	if sub.Status != models.SubscriptionStatusActive {
+		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusActive, sub.Status)
+	}
+
+	if sub.TrialEndDate != nil {
+		t.Error("Expected TrialEndDate to be nil")
+	}
+
+	// Test case 2: Create subscription with trial period
+	input.WithTrial = true
+
+	subWithTrial, err := service.CreateSubscription(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to create subscription with trial:", err)
+	}
+
+	if subWithTrial.TrialEndDate == nil {
+		t.Error("Expected TrialEndDate not to be nil")
+	}
+}
+
+func TestPauseSubscription(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, newMockUnitOfWork(subRepo, voucherRepo), newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	userID := uuid.New()
+	product := createTestProduct()
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
+	productID := product.ID
+
+	// Create an active subscription
+	activeSub := createTestSubscription(userID, productID, models.SubscriptionStatusActive)
+	err := subRepo.Create(ctx, activeSub)
+	if err != nil {
+		t.Fatal("Failed to create active subscription:", err)
+	}
+
+	// Test case 1: Pause an active subscription
+	err = service.PauseSubscription(ctx, activeSub.ID)
+	if err != nil {
+		t.Fatal("Failed to pause subscription:", err)
+	}
+
+	// Retrieve the updated subscription
+	updatedSub, err := subRepo.GetByID(ctx, activeSub.ID)
+	if err != nil {
+		t.Fatal("Failed to get updated subscription:", err)
+	}
+
+	if updatedSub.Status != models.SubscriptionStatusPaused {
+		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusPaused, updatedSub.Status)
+	}
+
+	// Test case 2: Pause a subscription that's already paused
+	err = service.PauseSubscription(ctx, activeSub.ID)
+	if err == nil {
+		t.Error("Expected error when pausing already paused subscription")
+	}
+
+	// Test case 3: Pause a subscription that's in trial period
+	trialSub := createTestSubscription(userID, productID, models.SubscriptionStatusActive)
+	trialEnd := time.Now().AddDate(0, 1, 0) // 1 month trial
+	trialSub.TrialEndDate = &trialEnd
+
+	err = subRepo.Create(ctx, trialSub)
+	if err != nil {
+		t.Fatal("Failed to create trial subscription:", err)
+	}
+
+	err = service.PauseSubscription(ctx, trialSub.ID)
+	if err == nil {
+		t.Error("Expected error when pausing subscription in trial period")
+	}
+}
+
+func TestUnpauseSubscription(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, newMockUnitOfWork(subRepo, voucherRepo), newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	userID := uuid.New()
+	productID := uuid.New()
+
+	// Create a paused subscription
+	pausedSub := createTestSubscription(userID, productID, models.SubscriptionStatusPaused)
+	err := subRepo.Create(ctx, pausedSub)
+	if err != nil {
+		t.Fatal("Failed to create paused subscription:", err)
+	}
+
+	// Test case 1: Unpause a paused subscription
+	err = service.UnpauseSubscription(ctx, pausedSub.ID)
+	if err != nil {
+		t.Fatal("Failed to unpause subscription:", err)
+	}
+
+	// Retrieve the updated subscription
+	updatedSub, err := subRepo.GetByID(ctx, pausedSub.ID)
+	if err != nil {
+		t.Fatal("Failed to get updated subscription:", err)
+	}
+
+	if updatedSub.Status != models.SubscriptionStatusActive {
+		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusActive, updatedSub.Status)
+	}
+
+	// Test case 2: Unpause a subscription that's already active
+	err = service.UnpauseSubscription(ctx, pausedSub.ID)
+	if err == nil {
+		t.Error("Expected error when unpausing already active subscription")
+	}
+}
+
+func TestCancelSubscription(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, newMockUnitOfWork(subRepo, voucherRepo), newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	userID := uuid.New()
+	productID := uuid.New()
+
+	// Create subscriptions with different statuses
+	activeSub := createTestSubscription(userID, productID, models.SubscriptionStatusActive)
+	pausedSub := createTestSubscription(userID, productID, models.SubscriptionStatusPaused)
+
+	err := subRepo.Create(ctx, activeSub)
+	if err != nil {
+		t.Fatal("Failed to create active subscription:", err)
+	}
+
+	err = subRepo.Create(ctx, pausedSub)
+	if err != nil {
+		t.Fatal("Failed to create paused subscription:", err)
+	}
+
+	// Test case 1: Cancel an active subscription
+	err = service.CancelSubscription(ctx, activeSub.ID)
+	if err != nil {
+		t.Fatal("Failed to cancel active subscription:", err)
+	}
+
+	// Retrieve the updated subscription
+	updatedActiveSub, err := subRepo.GetByID(ctx, activeSub.ID)
+	if err != nil {
+		t.Fatal("Failed to get updated active subscription:", err)
+	}
+
+	if updatedActiveSub.Status != models.SubscriptionStatusCancelled {
+		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusCancelled, updatedActiveSub.Status)
+	}
+
+	// Test case 2: Cancel a paused subscription
+	err = service.CancelSubscription(ctx, pausedSub.ID)
+	if err != nil {
+		t.Fatal("Failed to cancel paused subscription:", err)
+	}
+
+	// Retrieve the updated subscription
+	updatedPausedSub, err := subRepo.GetByID(ctx, pausedSub.ID)
+	if err != nil {
+		t.Fatal("Failed to get updated paused subscription:", err)
+	}
+
+	if updatedPausedSub.Status != models.SubscriptionStatusCancelled {
+		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusCancelled, updatedPausedSub.Status)
+	}
+}
+
+func TestProcessRenewals(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, newMockUnitOfWork(subRepo, voucherRepo), newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	product := createTestProduct()
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
+
+	userID := uuid.New()
+	periodEnd := time.Now().Add(-time.Hour)
+
+	// A due subscription that renews, bought with a discount
+	renewingSub := createTestSubscription(userID, product.ID, models.SubscriptionStatusActive)
+	renewingSub.EndDate = periodEnd
+	renewingSub.AutoRenew = true
+	discountedPrice := decimal.NewFromFloat(9.99)
+	renewingSub.DiscountedPrice = &discountedPrice
+
+	// A due subscription that does not renew
+	expiringSub := createTestSubscription(userID, product.ID, models.SubscriptionStatusActive)
+	expiringSub.EndDate = periodEnd
+	expiringSub.AutoRenew = false
+
+	// A subscription that is not due yet
+	currentSub := createTestSubscription(userID, product.ID, models.SubscriptionStatusActive)
+	currentSub.AutoRenew = true
+	currentEnd := currentSub.EndDate
+
+	for _, sub := range []*models.Subscription{renewingSub, expiringSub, currentSub} {
+		if err := subRepo.Create(ctx, sub); err != nil {
+			t.Fatal("Failed to create subscription:", err)
+		}
+	}
+
+	processed, err := service.ProcessRenewals(ctx, 10)
+	if err != nil {
+		t.Fatal("Failed to process renewals:", err)
+	}
+
+	if processed != 2 {
+		t.Errorf("Expected 2 processed subscriptions, got %d", processed)
+	}
+
+	// Test case 1: A renewing subscription rolls into the next period at full price
+	if renewingSub.Status != models.SubscriptionStatusActive {
+		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusActive, renewingSub.Status)
+	}
+
+	if !renewingSub.StartDate.Equal(periodEnd) {
+		t.Errorf("Expected StartDate %v, got %v", periodEnd, renewingSub.StartDate)
+	}
+
+	if expectedEnd := periodEnd.AddDate(0, product.DurationMonths, 0); !renewingSub.EndDate.Equal(expectedEnd) {
+		t.Errorf("Expected EndDate %v, got %v", expectedEnd, renewingSub.EndDate)
+	}
+
+	if renewingSub.DiscountedPrice != nil {
+		t.Error("Expected DiscountedPrice to be cleared on renewal")
+	}
+
+	expectedTotal := product.Price.Add(product.Price.Mul(product.TaxRate))
+	if !renewingSub.TotalAmount.Equal(expectedTotal) {
+		t.Errorf("Expected TotalAmount %v, got %v", expectedTotal, renewingSub.TotalAmount)
+	}
+
+	// Test case 2: A subscription without auto-renewal expires
+	if expiringSub.Status != models.SubscriptionStatusExpired {
+		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusExpired, expiringSub.Status)
+	}
+
+	// Test case 3: A subscription that is not due is left untouched
+	if !currentSub.EndDate.Equal(currentEnd) {
+		t.Errorf("Expected EndDate %v, got %v", currentEnd, currentSub.EndDate)
+	}
+
+	// Test case 4: Both renewals are recorded as state changes
+	if len(subRepo.stateChanges) != 2 {
+		t.Errorf("Expected 2 state changes, got %d", len(subRepo.stateChanges))
+	}
+}
+
+func TestSetAutoRenew(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, newMockUnitOfWork(subRepo, voucherRepo), newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	userID := uuid.New()
+	productID := uuid.New()
+
+	activeSub := createTestSubscription(userID, productID, models.SubscriptionStatusActive)
+	activeSub.AutoRenew = true
+	if err := subRepo.Create(ctx, activeSub); err != nil {
+		t.Fatal("Failed to create active subscription:", err)
+	}
+
+	// Test case 1: Turn off auto-renewal
+	updatedSub, err := service.SetAutoRenew(ctx, activeSub.ID, false)
+	if err != nil {
+		t.Fatal("Failed to update auto-renewal:", err)
+	}
+
+	if updatedSub.AutoRenew {
+		t.Error("Expected AutoRenew to be false")
+	}
+
+	// Test case 2: Cancelled subscriptions cannot be changed
+	cancelledSub := createTestSubscription(userID, productID, models.SubscriptionStatusCancelled)
+	if err := subRepo.Create(ctx, cancelledSub); err != nil {
+		t.Fatal("Failed to create cancelled subscription:", err)
+	}
+
+	if _, err := service.SetAutoRenew(ctx, cancelledSub.ID, true); err != errors.ErrSubscriptionNotActive {
+		t.Errorf("Expected error %v, got %v", errors.ErrSubscriptionNotActive, err)
+	}
+}
+
+func TestChangePlan(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, newMockUnitOfWork(subRepo, voucherRepo), newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	basicProduct := createTestProduct()
+	premiumProduct := createTestProduct()
+	premiumProduct.Name = "Premium Product"
+	premiumProduct.Price = decimal.NewFromInt(40)
+	for _, product := range []*models.Product{basicProduct, premiumProduct} {
+		if err := productRepo.Create(ctx, product); err != nil {
+			t.Fatal("Failed to create test product:", err)
+		}
+	}
+
+	userID := uuid.New()
+
+	// A subscription halfway through a 20.00 period
+	sub := createTestSubscription(userID, basicProduct.ID, models.SubscriptionStatusActive)
+	sub.StartDate = time.Now().Add(-15 * 24 * time.Hour)
+	sub.EndDate = time.Now().Add(15 * 24 * time.Hour)
+	sub.OriginalPrice = decimal.NewFromInt(20)
+	if err := subRepo.Create(ctx, sub); err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	// Test case 1: Changing to the current plan is rejected
+	_, err := service.ChangePlan(ctx, subscription.ChangePlanInput{
+		SubscriptionID: sub.ID,
+		ProductID:      basicProduct.ID,
+		Mode:           subscription.PlanChangeImmediately,
+	})
+	if err != errors.ErrSubscriptionSamePlan {
+		t.Errorf("Expected error %v, got %v", errors.ErrSubscriptionSamePlan, err)
+	}
+
+	// Test case 2: An immediate upgrade credits the unused half of the period
+	change, err := service.ChangePlan(ctx, subscription.ChangePlanInput{
+		SubscriptionID: sub.ID,
+		ProductID:      premiumProduct.ID,
+		Mode:           subscription.PlanChangeImmediately,
+	})
+	if err != nil {
+		t.Fatal("Failed to change plan:", err)
+	}
+
+	if !change.Credit.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("Expected credit 10, got %v", change.Credit)
+	}
+
+	if !change.AmountDue.Equal(decimal.NewFromInt(30)) {
+		t.Errorf("Expected amount due 30, got %v", change.AmountDue)
+	}
+
+	if sub.ProductID != premiumProduct.ID {
+		t.Errorf("Expected ProductID %v, got %v", premiumProduct.ID, sub.ProductID)
+	}
+
+	if !sub.OriginalPrice.Equal(premiumProduct.Price) {
+		t.Errorf("Expected OriginalPrice %v, got %v", premiumProduct.Price, sub.OriginalPrice)
+	}
+
+	if len(subRepo.stateChanges) != 1 {
+		t.Errorf("Expected 1 state change, got %d", len(subRepo.stateChanges))
+	}
+
+	// Test case 3: A downgrade at period end is applied by the next renewal
+	change, err = service.ChangePlan(ctx, subscription.ChangePlanInput{
+		SubscriptionID: sub.ID,
+		ProductID:      basicProduct.ID,
+		Mode:           subscription.PlanChangeAtPeriodEnd,
+	})
+	if err != nil {
+		t.Fatal("Failed to schedule plan change:", err)
+	}
+
+	if !change.EffectiveAt.Equal(sub.EndDate) {
+		t.Errorf("Expected EffectiveAt %v, got %v", sub.EndDate, change.EffectiveAt)
+	}
+
+	if sub.ProductID != premiumProduct.ID || sub.ScheduledProductID == nil || *sub.ScheduledProductID != basicProduct.ID {
+		t.Error("Expected the plan change to be scheduled without changing the current plan")
+	}
+
+	sub.EndDate = time.Now().Add(-time.Minute)
+	sub.AutoRenew = true
+	if _, err := service.ProcessRenewals(ctx, 10); err != nil {
+		t.Fatal("Failed to process renewals:", err)
+	}
+
+	if sub.ProductID != basicProduct.ID || sub.ScheduledProductID != nil {
+		t.Error("Expected the renewal to switch to the scheduled plan")
+	}
+
+	if !sub.OriginalPrice.Equal(basicProduct.Price) {
+		t.Errorf("Expected OriginalPrice %v, got %v", basicProduct.Price, sub.OriginalPrice)
+	}
+
+	// Test case 4: The preview of a change at period end is discounted like the renewal
+	voucher := createTestVoucher()
+	voucher.DiscountDuration = models.DiscountDurationForever
+	if err := voucherRepo.Create(ctx, voucher); err != nil {
+		t.Fatal("Failed to create test voucher:", err)
+	}
+
+	discounted, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:      uuid.New(),
+		ProductID:   basicProduct.ID,
+		VoucherCode: voucher.Code,
+		AutoRenew:   true,
+	})
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	change, err = service.ChangePlan(ctx, subscription.ChangePlanInput{
+		SubscriptionID: discounted.ID,
+		ProductID:      premiumProduct.ID,
+		Mode:           subscription.PlanChangeAtPeriodEnd,
+	})
+	if err != nil {
+		t.Fatal("Failed to schedule plan change:", err)
+	}
+
+	if !change.Charge.Equal(decimal.NewFromInt(32)) {
+		t.Errorf("Expected the discounted charge 32, got %v", change.Charge)
+	}
+
+	discounted.EndDate = time.Now().Add(-time.Minute)
+	if _, err := service.ProcessRenewals(ctx, 10); err != nil {
+		t.Fatal("Failed to process renewals:", err)
+	}
+
+	if discounted.ProductID != premiumProduct.ID || !discounted.TotalAmount.Equal(change.TotalDue) {
+		t.Errorf("Expected the renewal to bill the previewed %v, got %v", change.TotalDue, discounted.TotalAmount)
+	}
+
+	// Test case 5: Nothing is credited for a plan change during the trial
+	trialing, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:    uuid.New(),
+		ProductID: premiumProduct.ID,
+		WithTrial: true,
+	})
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	change, err = service.ChangePlan(ctx, subscription.ChangePlanInput{
+		SubscriptionID: trialing.ID,
+		ProductID:      basicProduct.ID,
+		Mode:           subscription.PlanChangeImmediately,
+	})
+	if err != nil {
+		t.Fatal("Failed to change plan:", err)
+	}
+
+	if !change.Credit.IsZero() || !change.CreditToBalance.IsZero() || !change.AmountDue.Equal(change.Charge) {
+		t.Errorf("Expected no credit during the trial, got credit %v, %v to the balance", change.Credit, change.CreditToBalance)
+	}
+}
+
+func TestPauseWithScheduledResume(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, newMockUnitOfWork(subRepo, voucherRepo), newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	product := createTestProduct()
+	product.MaxPauseDays = 60
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
+
+	userID := uuid.New()
+
+	// Test case 1: A resume date beyond the product's maximum pause length is rejected
+	sub := createTestSubscription(userID, product.ID, models.SubscriptionStatusActive)
+	if err := subRepo.Create(ctx, sub); err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	tooLate := time.Now().AddDate(0, 0, 90)
+	if _, err := service.PauseSubscriptionUntil(ctx, sub.ID, &tooLate); err != errors.ErrPauseTooLong {
+		t.Errorf("Expected error %v, got %v", errors.ErrPauseTooLong, err)
+	}
+
+	// Test case 2: Without a resume date the pause is capped at the maximum pause length
+	if _, err := service.PauseSubscriptionUntil(ctx, sub.ID, nil); err != nil {
+		t.Fatal("Failed to pause subscription:", err)
+	}
+
+	if sub.ResumeAt == nil || sub.ResumeAt.Sub(*sub.PausedAt) != 60*24*time.Hour {
+		t.Errorf("Expected resume date 60 days after the pause, got %v", sub.ResumeAt)
+	}
+
+	// Test case 3: The resume job reactivates the subscription and extends the end date
+	// by the time spent paused
+	originalEnd := sub.EndDate
+	pausedAt := time.Now().Add(-10 * 24 * time.Hour)
+	resumeAt := time.Now().Add(-time.Minute)
+	sub.PausedAt = &pausedAt
+	sub.ResumeAt = &resumeAt
+	subRepo.pauses[0].PausedAt = pausedAt
+
+	resumed, err := service.ProcessResumes(ctx, 10)
+	if err != nil {
+		t.Fatal("Failed to process resumes:", err)
+	}
+
+	if resumed != 1 {
+		t.Errorf("Expected 1 resumed subscription, got %d", resumed)
+	}
+
+	if sub.Status != models.SubscriptionStatusActive || sub.PausedAt != nil || sub.ResumeAt != nil {
+		t.Error("Expected subscription to be active with no pause scheduled")
+	}
+
+	if extension := sub.EndDate.Sub(originalEnd); extension < 10*24*time.Hour || extension > 10*24*time.Hour+time.Minute {
+		t.Errorf("Expected EndDate to be extended by 10 days, got %v", extension)
+	}
+
+	// Test case 4: The pause history reports the total time paused
+	history, err := service.GetPauseHistory(ctx, sub.ID)
+	if err != nil {
+		t.Fatal("Failed to get pause history:", err)
+	}
+
+	if len(history.Pauses) != 1 || history.Pauses[0].ResumedAt == nil {
+		t.Fatal("Expected one completed pause in the history")
+	}
+
+	if days := history.TotalPaused.Hours() / 24; days < 10 || days > 10.01 {
+		t.Errorf("Expected 10 days paused, got %v", days)
+	}
+}
+
+func TestCancelAtPeriodEnd(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, newMockUnitOfWork(subRepo, voucherRepo), newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	userID := uuid.New()
+	productID := uuid.New()
+
+	sub := createTestSubscription(userID, productID, models.SubscriptionStatusActive)
+	sub.AutoRenew = true
+	if err := subRepo.Create(ctx, sub); err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	// Test case 1: An unknown feedback category is rejected
+	_, err := service.Cancel(ctx, subscription.CancelSubscriptionInput{
+		SubscriptionID: sub.ID,
+		Mode:           subscription.CancelAtPeriodEnd,
+		Feedback:       "bored",
+	})
+	if _, ok := err.(errors.ValidationErrors); !ok {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+
+	// Test case 2: Scheduling the cancellation keeps the subscription active
+	_, err = service.Cancel(ctx, subscription.CancelSubscriptionInput{
+		SubscriptionID: sub.ID,
+		Mode:           subscription.CancelAtPeriodEnd,
+		Reason:         "Found a cheaper plan",
+		Feedback:       models.CancellationFeedbackTooExpensive,
+	})
+	if err != nil {
+		t.Fatal("Failed to schedule cancellation:", err)
+	}
+
+	if sub.Status != models.SubscriptionStatusActive || !sub.CancelAtPeriodEnd || sub.CancelledAt == nil {
+		t.Error("Expected an active subscription scheduled to cancel")
+	}
+
+	stateChange := subRepo.stateChanges[len(subRepo.stateChanges)-1]
+	if stateChange.CancellationReason != "Found a cheaper plan" || stateChange.FeedbackCategory != models.CancellationFeedbackTooExpensive {
+		t.Errorf("Expected cancellation feedback on the state change, got %+v", stateChange)
+	}
+
+	// Test case 3: The scheduled cancellation can be undone
+	if _, err := service.UndoCancellation(ctx, sub.ID); err != nil {
+		t.Fatal("Failed to undo cancellation:", err)
+	}
+
+	if sub.CancelAtPeriodEnd || sub.CancelledAt != nil {
+		t.Error("Expected the scheduled cancellation to be cleared")
+	}
+
+	if _, err := service.UndoCancellation(ctx, sub.ID); err != errors.ErrCancellationNotScheduled {
+		t.Errorf("Expected error %v, got %v", errors.ErrCancellationNotScheduled, err)
+	}
+
+	// Test case 4: Once the period ends, the job cancels instead of renewing
+	_, err = service.Cancel(ctx, subscription.CancelSubscriptionInput{
+		SubscriptionID: sub.ID,
+		Mode:           subscription.CancelAtPeriodEnd,
+	})
+	if err != nil {
+		t.Fatal("Failed to schedule cancellation:", err)
+	}
+
+	sub.EndDate = time.Now().Add(-time.Minute)
+
+	if renewed, err := service.ProcessRenewals(ctx, 10); err != nil || renewed != 0 {
+		t.Errorf("Expected no renewals, got %d (err %v)", renewed, err)
+	}
+
+	cancelled, err := service.ProcessCancellations(ctx, 10)
+	if err != nil {
+		t.Fatal("Failed to process cancellations:", err)
+	}
+
+	if cancelled != 1 || sub.Status != models.SubscriptionStatusCancelled {
+		t.Errorf("Expected the subscription to be cancelled, got status %v", sub.Status)
+	}
+
+	// Test case 5: A paused subscription is cancelled once its period has ended, unless
+	// it resumes first
+	paused := createTestSubscription(userID, productID, models.SubscriptionStatusPaused)
+	resuming := createTestSubscription(userID, productID, models.SubscriptionStatusPaused)
+	resumeAt := time.Now().Add(time.Hour)
+	resuming.ResumeAt = &resumeAt
+	for _, s := range []*models.Subscription{paused, resuming} {
+		pausedAt := time.Now().Add(-48 * time.Hour)
+		s.PausedAt = &pausedAt
+		s.EndDate = time.Now().Add(-time.Minute)
+		if err := subRepo.Create(ctx, s); err != nil {
+			t.Fatal("Failed to create subscription:", err)
+		}
+		if _, err := service.Cancel(ctx, subscription.CancelSubscriptionInput{
+			SubscriptionID: s.ID,
+			Mode:           subscription.CancelAtPeriodEnd,
+		}); err != nil {
+			t.Fatal("Failed to schedule cancellation:", err)
+		}
+	}
+
+	if cancelled, err := service.ProcessCancellations(ctx, 10); err != nil || cancelled != 1 {
+		t.Fatalf("Expected 1 cancellation, got %d (%v)", cancelled, err)
+	}
+
+	if paused.Status != models.SubscriptionStatusCancelled || resuming.Status != models.SubscriptionStatusPaused {
+		t.Errorf("Expected only the subscription without a resume date to be cancelled, got %v and %v", paused.Status, resuming.Status)
+	}
+}
+
+func TestTrialLifecycle(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, newMockUnitOfWork(subRepo, voucherRepo), newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	product := createTestProduct()
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
+
+	// Test case 1: A subscription with a trial starts in the trialing state
+	sub, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:    uuid.New(),
+		ProductID: product.ID,
+		WithTrial: true,
+	})
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	if sub.Status != models.SubscriptionStatusTrialing {
+		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusTrialing, sub.Status)
+	}
+
+	// Test case 2: A running trial cannot be paused or activated early
+	if err := service.PauseSubscription(ctx, sub.ID); err != errors.ErrSubscriptionInTrial {
+		t.Errorf("Expected error %v, got %v", errors.ErrSubscriptionInTrial, err)
+	}
+
+	if activated, err := service.ProcessTrialEnds(ctx, 10); err != nil || activated != 0 {
+		t.Errorf("Expected no trials to end, got %d (err %v)", activated, err)
+	}
+
+	// Test case 3: Once the trial ends the job activates the subscription
+	trialEnd := time.Now().Add(-time.Minute)
+	sub.TrialEndDate = &trialEnd
+
+	activated, err := service.ProcessTrialEnds(ctx, 10)
+	if err != nil {
+		t.Fatal("Failed to process trial ends:", err)
+	}
+
+	if activated != 1 || sub.Status != models.SubscriptionStatusActive {
+		t.Errorf("Expected the subscription to be active, got status %v", sub.Status)
+	}
+
+	stateChange := subRepo.stateChanges[len(subRepo.stateChanges)-1]
+	if stateChange.PreviousState != models.SubscriptionStatusTrialing || stateChange.NewState != models.SubscriptionStatusActive {
+		t.Errorf("Expected a trialing to active state change, got %v to %v", stateChange.PreviousState, stateChange.NewState)
+	}
+
+	// Test case 4: A trial scheduled to cancel is cancelled when it ends
+	trialSub := createTestSubscription(uuid.New(), product.ID, models.SubscriptionStatusTrialing)
+	trialSub.TrialEndDate = &trialEnd
+	trialSub.CancelAtPeriodEnd = true
+	if err := subRepo.Create(ctx, trialSub); err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	if _, err := service.ProcessTrialEnds(ctx, 10); err != nil {
+		t.Fatal("Failed to process trial ends:", err)
+	}
+
+	if trialSub.Status != models.SubscriptionStatusCancelled {
+		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusCancelled, trialSub.Status)
+	}
+}
+
+func TestAllowedActions(t *testing.T) {
+	now := time.Now()
+	trialEnd := now.AddDate(0, 0, 7)
+
+	tests := []struct {
+		name     string
+		modify   func(sub *models.Subscription)
+		expected []subscription.Action
+	}{
+		{
+			name:   "active",
+			modify: func(sub *models.Subscription) {},
+			expected: []subscription.Action{
+				subscription.ActionPause,
+				subscription.ActionChangePlan,
+				subscription.ActionScheduleCancel,
+				subscription.ActionCancel,
+			},
+		},
+		{
+			name: "trialing",
+			modify: func(sub *models.Subscription) {
+				sub.Status = models.SubscriptionStatusTrialing
+				sub.TrialEndDate = &trialEnd
+			},
+			expected: []subscription.Action{
+				subscription.ActionChangePlan,
+				subscription.ActionScheduleCancel,
+				subscription.ActionCancel,
+			},
+		},
+		{
+			name: "paused with cancellation scheduled",
+			modify: func(sub *models.Subscription) {
+				sub.Status = models.SubscriptionStatusPaused
+				sub.CancelAtPeriodEnd = true
+			},
+			expected: []subscription.Action{
+				subscription.ActionResume,
+				subscription.ActionUndoCancel,
+				subscription.ActionCancel,
+			},
+		},
+		{
+			name: "cancelled",
+			modify: func(sub *models.Subscription) {
+				sub.Status = models.SubscriptionStatusCancelled
+			},
+			expected: []subscription.Action{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := createTestSubscription(uuid.New(), uuid.New(), models.SubscriptionStatusActive)
+			tt.modify(sub)
+
+			actions := subscription.AllowedActions(sub, now)
+			if fmt.Sprint(actions) != fmt.Sprint(tt.expected) {
+				t.Errorf("Expected actions %v, got %v", tt.expected, actions)
+			}
+		})
+	}
+}
+
+func TestConcurrentUpdateConflict(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, newMockUnitOfWork(subRepo, voucherRepo), newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	product := createTestProduct()
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
+
+	sub := createTestSubscription(uuid.New(), product.ID, models.SubscriptionStatusActive)
+	sub.Version = 1
+	if err := subRepo.Create(ctx, sub); err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	// Test case 1: A successful update increments the version
+	if err := service.PauseSubscription(ctx, sub.ID); err != nil {
+		t.Fatal("Failed to pause subscription:", err)
+	}
+
+	if sub.Version != 2 {
+		t.Errorf("Expected version 2, got %d", sub.Version)
+	}
+
+	// Test case 2: An update based on a stale version is rejected and nothing is recorded
+	subRepo.versions[sub.ID]++ // another request saved the subscription in the meantime
+	stateChanges := len(subRepo.stateChanges)
+
+	if err := service.UnpauseSubscription(ctx, sub.ID); err != errors.ErrSubscriptionConflict {
+		t.Errorf("Expected error %v, got %v", errors.ErrSubscriptionConflict, err)
+	}
+
+	if len(subRepo.stateChanges) != stateChanges {
+		t.Error("Expected no state change to be recorded on conflict")
+	}
+}
+
+func TestVoucherRedemptionLimits(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, newMockUnitOfWork(subRepo, voucherRepo), newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	product := createTestProduct()
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
+
+	voucher := createTestVoucher()
+	voucher.MaxRedemptions = 2
+	voucher.MaxRedemptionsPerUser = 1
+	if err := voucherRepo.Create(ctx, voucher); err != nil {
+		t.Fatal("Failed to create test voucher:", err)
+	}
+
+	firstUser := uuid.New()
+
+	// Test case 1: A redemption is recorded with the discount amount
+	sub, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:      firstUser,
+		ProductID:   product.ID,
+		VoucherCode: "test20",
+	})
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	if voucher.RedemptionCount != 1 || len(voucherRepo.redemptions) != 1 {
+		t.Fatalf("Expected 1 redemption, got %d", voucher.RedemptionCount)
+	}
+
+	expectedDiscount := product.Price.Sub(*sub.DiscountedPrice)
+	if !voucherRepo.redemptions[0].DiscountAmount.Equal(expectedDiscount) {
+		t.Errorf("Expected discount amount %v, got %v", expectedDiscount, voucherRepo.redemptions[0].DiscountAmount)
+	}
+
+	// Test case 2: The same user cannot redeem the voucher twice
+	_, err = service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:      firstUser,
+		ProductID:   product.ID,
+		VoucherCode: "TEST20",
+	})
+	if err != errors.ErrVoucherUserLimitReached {
+		t.Errorf("Expected error %v, got %v", errors.ErrVoucherUserLimitReached, err)
+	}
+
+	// Test case 3: Once the global limit is reached nobody can redeem it
+	for i := 0; i < 2; i++ {
+		_, err = service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+			UserID:      uuid.New(),
+			ProductID:   product.ID,
+			VoucherCode: "TEST20",
+		})
+	}
+	if err != errors.ErrVoucherRedemptionLimitReached {
+		t.Errorf("Expected error %v, got %v", errors.ErrVoucherRedemptionLimitReached, err)
+	}
+
+	if voucher.RedemptionCount != 2 {
+		t.Errorf("Expected 2 redemptions, got %d", voucher.RedemptionCount)
+	}
+}
+
+func TestDiscountDuration(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, newMockUnitOfWork(subRepo, voucherRepo), newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	product := createTestProduct()
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
+
+	repeating := createTestVoucher()
+	repeating.Code = "THREEMONTHS"
+	repeating.DiscountDuration = models.DiscountDurationRepeating
+	repeating.DiscountPeriods = 3
+
+	forever := createTestVoucher()
+	forever.Code = "FOREVER"
+	forever.DiscountDuration = models.DiscountDurationForever
+
+	for _, v := range []*models.Voucher{repeating, forever} {
+		if err := voucherRepo.Create(ctx, v); err != nil {
+			t.Fatal("Failed to create test voucher:", err)
+		}
+	}
+
+	repeatingSub, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:      uuid.New(),
+		ProductID:   product.ID,
+		VoucherCode: "THREEMONTHS",
+		AutoRenew:   true,
+	})
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	foreverSub, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:      uuid.New(),
+		ProductID:   product.ID,
+		VoucherCode: "FOREVER",
+		AutoRenew:   true,
+	})
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	// Test case 1: The first period counts as the first discounted period
+	if repeatingSub.DiscountPeriodsRemaining != 3 {
+		t.Errorf("Expected 3 discounted periods remaining, got %d", repeatingSub.DiscountPeriodsRemaining)
+	}
+
+	discountedPrice := *repeatingSub.DiscountedPrice
+	renew := func() {
+		for _, sub := range []*models.Subscription{repeatingSub, foreverSub} {
+			sub.EndDate = time.Now().Add(-time.Minute)
+		}
+		if _, err := service.ProcessRenewals(ctx, 10); err != nil {
+			t.Fatal("Failed to process renewals:", err)
+		}
+	}
+
+	// Test case 2: Renewals stay discounted while periods remain
+	for remaining := 2; remaining >= 1; remaining-- {
+		renew()
+
+		if repeatingSub.DiscountPeriodsRemaining != remaining {
+			t.Errorf("Expected %d discounted periods remaining, got %d", remaining, repeatingSub.DiscountPeriodsRemaining)
+		}
+		if repeatingSub.DiscountedPrice == nil || !repeatingSub.DiscountedPrice.Equal(discountedPrice) {
+			t.Errorf("Expected DiscountedPrice %v, got %v", discountedPrice, repeatingSub.DiscountedPrice)
+		}
+	}
+
+	// Test case 3: Once the discount runs out the renewal reverts to the original price
+	renew()
+
+	if repeatingSub.DiscountPeriodsRemaining != 0 || repeatingSub.DiscountedPrice != nil {
+		t.Errorf("Expected the discount to have run out, got %d periods and price %v",
+			repeatingSub.DiscountPeriodsRemaining, repeatingSub.DiscountedPrice)
+	}
+
+	expectedTotal := product.Price.Add(product.Price.Mul(product.TaxRate))
+	if !repeatingSub.TotalAmount.Equal(expectedTotal) {
+		t.Errorf("Expected TotalAmount %v, got %v", expectedTotal, repeatingSub.TotalAmount)
+	}
+
+	renew()
+
+	if repeatingSub.DiscountedPrice != nil {
+		t.Error("Expected no discount after the discount ran out")
+	}
+
+	// Test case 4: A forever discount applies to every renewal
+	if foreverSub.DiscountedPrice == nil || !foreverSub.DiscountedPrice.Equal(discountedPrice) {
+		t.Errorf("Expected DiscountedPrice %v, got %v", discountedPrice, foreverSub.DiscountedPrice)
+	}
+}
+
+func TestPriceSubscription(t *testing.T) {
+	product := createTestProduct()
+	product.Price = decimal.NewFromInt(100)
+	voucher := createTestVoucher()
+	now := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	taxes := &tax.Assessment{Rates: tax.Rates{{Name: "VAT", Jurisdiction: "GB", Rate: decimal.NewFromFloat(0.2)}}}
+
+	// Test case 1: Without voucher or trial the first period starts now at full price
+	quote := subscription.PriceSubscription(product, "EUR", nil, taxes, false, now)
+
+	if !quote.StartDate.Equal(now) || !quote.EndDate.Equal(now.AddDate(0, 1, 0)) || quote.TrialEndDate != nil {
+		t.Errorf("Unexpected period %v - %v (trial %v)", quote.StartDate, quote.EndDate, quote.TrialEndDate)
+	}
+
+	if quote.DiscountedPrice != nil || !quote.Discount.IsZero() || !quote.TotalAmount.Equal(decimal.NewFromInt(120)) {
+		t.Errorf("Expected total 120 without discount, got %v (discount %v)", quote.TotalAmount, quote.Discount)
+	}
+
+	// Test case 2: A voucher is taken off before tax and a trial delays the first period
+	quote = subscription.PriceSubscription(product, "EUR", voucher, taxes, true, now)
+
+	trialEnd := now.AddDate(0, 1, 0)
+	if quote.TrialEndDate == nil || !quote.TrialEndDate.Equal(trialEnd) || !quote.StartDate.Equal(trialEnd) {
+		t.Errorf("Expected the period to start at the trial end %v, got %v", trialEnd, quote.StartDate)
+	}
+
+	if !quote.Discount.Equal(decimal.NewFromInt(20)) || !quote.TaxAmount.Equal(decimal.NewFromInt(16)) ||
+		!quote.TotalAmount.Equal(decimal.NewFromInt(96)) {
+		t.Errorf("Expected discount 20, tax 16 and total 96, got %v, %v and %v", quote.Discount, quote.TaxAmount, quote.TotalAmount)
+	}
+
+	// Test case 3: A tax-inclusive price is split into the pre-tax price and the tax
+	product.Price = decimal.NewFromInt(120)
+	product.TaxInclusive = true
+	quote = subscription.PriceSubscription(product, "EUR", voucher, taxes, false, now)
+
+	if !quote.OriginalPrice.Equal(decimal.NewFromInt(100)) || !quote.DiscountedPrice.Equal(decimal.NewFromInt(80)) ||
+		!quote.TaxAmount.Equal(decimal.NewFromInt(16)) || !quote.TotalAmount.Equal(decimal.NewFromInt(96)) {
+		t.Errorf("Expected price 100, discounted 80, tax 16 and total 96, got %v, %v, %v and %v",
+			quote.OriginalPrice, quote.DiscountedPrice, quote.TaxAmount, quote.TotalAmount)
+	}
+
+	if len(quote.TaxComponents) != 1 || quote.TaxComponents[0].Name != "VAT" || !quote.TaxComponents[0].Amount.Equal(decimal.NewFromInt(16)) {
+		t.Errorf("Expected a VAT component of 16, got %v", quote.TaxComponents)
+	}
+
+	// Test case 4: A reverse-charged buyer pays the pre-tax price of a tax-inclusive product
+	taxes.ReverseCharge = true
+	quote = subscription.PriceSubscription(product, "EUR", voucher, taxes, false, now)
+
+	if !quote.ReverseCharge || !quote.TaxAmount.IsZero() || len(quote.TaxComponents) != 0 ||
+		!quote.TotalAmount.Equal(decimal.NewFromInt(80)) {
+		t.Errorf("Expected a reverse charge of 80 without tax, got %v with tax %v", quote.TotalAmount, quote.TaxAmount)
+	}
+}
+
+func TestQuoteSubscription(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, newMockUnitOfWork(subRepo, voucherRepo), newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	product := createTestProduct()
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
+
+	voucher := createTestVoucher()
+	if err := voucherRepo.Create(ctx, voucher); err != nil {
+		t.Fatal("Failed to create test voucher:", err)
+	}
+
+	// Test case 1: A quote matches the subscription it previews and saves nothing
+	userID := uuid.New()
+	quote, err := service.QuoteSubscription(ctx, subscription.QuoteInput{
+		UserID:      userID,
+		ProductID:   product.ID,
+		VoucherCode: "test20",
+		WithTrial:   true,
+	})
+	if err != nil {
+		t.Fatal("Failed to quote subscription:", err)
+	}
+
+	if len(subRepo.subscriptions) != 0 || voucher.RedemptionCount != 0 {
+		t.Error("Expected a quote not to create a subscription or redeem the voucher")
+	}
+
+	sub, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:      userID,
+		ProductID:   product.ID,
+		VoucherCode: "test20",
+		WithTrial:   true,
+	})
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	if !sub.TotalAmount.Equal(quote.TotalAmount) || !sub.DiscountedPrice.Equal(*quote.DiscountedPrice) {
+		t.Errorf("Expected total %v, got %v", quote.TotalAmount, sub.TotalAmount)
+	}
+
+	// Test case 2: An invalid voucher is reported like at checkout
+	_, err = service.QuoteSubscription(ctx, subscription.QuoteInput{
+		UserID:      userID,
+		ProductID:   product.ID,
+		VoucherCode: "UNKNOWN",
+	})
+	if err != errors.ErrVoucherNotFound {
+		t.Errorf("Expected error %v, got %v", errors.ErrVoucherNotFound, err)
+	}
+}
+
+func TestSubscriptionCurrency(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	uow := newMockUnitOfWork(subRepo, voucherRepo)
+	payments, _ := newTestPayments(uow.payments)
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, uow, payments, newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	product := createTestProduct()
+	product.Prices = []models.ProductPrice{{Currency: "JPY", Amount: decimal.NewFromInt(2999)}}
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
+
+	percentage := createTestVoucher()
+	fixed := createTestVoucher()
+	fixed.Code = "FIVEOFF"
+	fixed.DiscountType = models.DiscountTypeFixed
+	fixed.DiscountValue = decimal.NewFromInt(5)
+	fixed.Currency = "EUR"
+	for _, voucher := range []*models.Voucher{percentage, fixed} {
+		if err := voucherRepo.Create(ctx, voucher); err != nil {
+			t.Fatal("Failed to create test voucher:", err)
+		}
+	}
+
+	// Test case 1: A subscription is billed and charged in the currency it is bought in
+	sub, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:    uuid.New(),
+		ProductID: product.ID,
+		Currency:  "jpy",
+	})
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	if sub.Currency != "JPY" || !sub.OriginalPrice.Equal(decimal.NewFromInt(2999)) {
+		t.Errorf("Expected a price of 2999 JPY, got %s %s", sub.OriginalPrice, sub.Currency)
+	}
+
+	invoice := uow.invoices.invoices[len(uow.invoices.invoices)-1]
+	charge := uow.payments.payments[len(uow.payments.payments)-1]
+	if invoice.Currency != "JPY" || charge.Currency != "JPY" || !charge.Amount.Equal(invoice.Total) {
+		t.Errorf("Expected an invoice and a charge in JPY, got %s and %s", invoice.Currency, charge.Currency)
+	}
+
+	// Test case 2: Discounted prices are rounded to the currency's minor unit
+	quote, err := service.QuoteSubscription(ctx, subscription.QuoteInput{
+		UserID:      uuid.New(),
+		ProductID:   product.ID,
+		VoucherCode: percentage.Code,
+		Currency:    "JPY",
+	})
+	if err != nil {
+		t.Fatal("Failed to quote subscription:", err)
+	}
+
+	if quote.DiscountedPrice == nil || !quote.DiscountedPrice.Equal(decimal.NewFromInt(2399)) {
+		t.Errorf("Expected a discounted price of 2399 JPY, got %v", quote.DiscountedPrice)
+	}
+
+	// Test case 3: The product must be sold in the currency
+	_, err = service.QuoteSubscription(ctx, subscription.QuoteInput{
+		UserID:    uuid.New(),
+		ProductID: product.ID,
+		Currency:  "USD",
+	})
+	if err != errors.ErrCurrencyNotSold {
+		t.Errorf("Expected error %v, got %v", errors.ErrCurrencyNotSold, err)
+	}
+
+	// Test case 4: A fixed discount only applies in the voucher's currency
+	_, err = service.QuoteSubscription(ctx, subscription.QuoteInput{
+		UserID:      uuid.New(),
+		ProductID:   product.ID,
+		VoucherCode: fixed.Code,
+		Currency:    "JPY",
+	})
+	if err != errors.ErrVoucherCurrency {
+		t.Errorf("Expected error %v, got %v", errors.ErrVoucherCurrency, err)
+	}
+
+	quote, err = service.QuoteSubscription(ctx, subscription.QuoteInput{
+		UserID:      uuid.New(),
+		ProductID:   product.ID,
+		VoucherCode: fixed.Code,
+	})
+	if err != nil || !quote.DiscountedPrice.Equal(decimal.NewFromFloat(14.99)) {
+		t.Errorf("Expected a discounted price of 14.99 EUR, got %v (%v)", quote, err)
+	}
+}
+
+func TestExchangeRateSnapshots(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	uow := newMockUnitOfWork(subRepo, voucherRepo)
+	payments, _ := newTestPayments(uow.payments)
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, uow, payments, newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	product := createTestProduct()
+	product.Prices = []models.ProductPrice{
+		{Currency: "JPY", Amount: decimal.NewFromInt(2999)},
+		{Currency: "GBP", Amount: decimal.NewFromFloat(16.99)},
+	}
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
+
+	latest := testExchangeRates()[0].Date
+
+	// Test case 1: The invoice and payment store the rate to the reporting currency
+	if _, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:    uuid.New(),
+		ProductID: product.ID,
+		Currency:  "JPY",
+	}); err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	invoice := uow.invoices.invoices[len(uow.invoices.invoices)-1]
+	charge := uow.payments.payments[len(uow.payments.payments)-1]
+	for _, rate := range []*models.ExchangeRateSnapshot{invoice.ExchangeRate, charge.ExchangeRate} {
+		if rate == nil || rate.ReportingCurrency != "EUR" || !rate.Rate.Equal(decimal.RequireFromString("0.00625")) || !rate.Date.Equal(latest) {
+			t.Fatalf("Expected the EUR rate of JPY of %s, got %+v", latest.Format("2006-01-02"), rate)
+		}
+	}
+
+	// 2999 JPY with 20% tax
+	if converted := invoice.ExchangeRate.Convert(invoice.Total); !converted.Equal(decimal.NewFromFloat(22.49)) {
+		t.Errorf("Expected %s JPY to be worth 22.49 EUR, got %s", invoice.Total, converted)
+	}
+
+	// Test case 2: Amounts in the reporting currency have a rate of 1
+	if _, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:    uuid.New(),
+		ProductID: product.ID,
+	}); err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	invoice = uow.invoices.invoices[len(uow.invoices.invoices)-1]
+	if invoice.ExchangeRate == nil || !invoice.ExchangeRate.Rate.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("Expected a rate of 1, got %+v", invoice.ExchangeRate)
+	}
+
+	// Test case 3: Billing does not depend on a rate being known
+	if _, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:    uuid.New(),
+		ProductID: product.ID,
+		Currency:  "GBP",
+	}); err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	invoice = uow.invoices.invoices[len(uow.invoices.invoices)-1]
+	if invoice.Currency != "GBP" || invoice.ExchangeRate != nil {
+		t.Errorf("Expected a GBP invoice without a rate, got %s %+v", invoice.Currency, invoice.ExchangeRate)
+	}
+}
+
+func TestInvoicing(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	uow := newMockUnitOfWork(subRepo, voucherRepo)
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, uow, newTestPaymentService(), newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	basicProduct := createTestProduct()
+	premiumProduct := createTestProduct()
+	premiumProduct.Name = "Premium Product"
+	premiumProduct.Price = decimal.NewFromInt(40)
+	for _, product := range []*models.Product{basicProduct, premiumProduct} {
+		if err := productRepo.Create(ctx, product); err != nil {
+			t.Fatal("Failed to create test product:", err)
+		}
+	}
+
+	if err := voucherRepo.Create(ctx, createTestVoucher()); err != nil {
+		t.Fatal("Failed to create test voucher:", err)
+	}
+
+	sub, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:      uuid.New(),
+		ProductID:   basicProduct.ID,
+		VoucherCode: "TEST20",
+		AutoRenew:   true,
+	})
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	// Test case 1: Creating a subscription invoices the plan, the discount and tax
+	if len(uow.invoices.invoices) != 1 {
+		t.Fatalf("Expected 1 invoice, got %d", len(uow.invoices.invoices))
+	}
+
+	first := uow.invoices.invoices[0]
+	if first.Reason != models.InvoiceReasonSubscriptionCreate || first.Status != models.InvoiceStatusFinalized {
+		t.Errorf("Expected a finalized creation invoice, got %v %v", first.Reason, first.Status)
+	}
+
+	expectedTypes := []models.InvoiceLineType{models.InvoiceLineTypePlan, models.InvoiceLineTypeDiscount, models.InvoiceLineTypeTax}
+	if len(first.Lines) != len(expectedTypes) {
+		t.Fatalf("Expected %d lines, got %d", len(expectedTypes), len(first.Lines))
+	}
+	for i, line := range first.Lines {
+		if line.Type != expectedTypes[i] {
+			t.Errorf("Expected line %d to be %v, got %v", i+1, expectedTypes[i], line.Type)
+		}
+	}
+
+	// 19.99 less 4.00 discount, plus 3.20 tax
+	if !first.Subtotal.Equal(decimal.RequireFromString("15.99")) || !first.Total.Equal(decimal.RequireFromString("19.19")) {
+		t.Errorf("Expected subtotal 15.99 and total 19.19, got %v and %v", first.Subtotal, first.Total)
+	}
+
+	// Test case 2: A renewal is invoiced with the next number
+	sub.EndDate = time.Now().Add(-time.Minute)
+	if _, err := service.ProcessRenewals(ctx, 10); err != nil {
+		t.Fatal("Failed to process renewals:", err)
+	}
+
+	if len(uow.invoices.invoices) != 2 {
+		t.Fatalf("Expected 2 invoices, got %d", len(uow.invoices.invoices))
+	}
+
+	renewal := uow.invoices.invoices[1]
+	if renewal.Reason != models.InvoiceReasonRenewal || !renewal.PeriodStart.Equal(sub.StartDate) {
+		t.Errorf("Expected a renewal invoice for the period starting %v, got %v from %v", sub.StartDate, renewal.Reason, renewal.PeriodStart)
+	}
+
+	year := renewal.IssuedAt.UTC().Year()
+	if first.Number != fmt.Sprintf("INV-%d-000001", year) || renewal.Number != fmt.Sprintf("INV-%d-000002", year) {
+		t.Errorf("Expected sequential numbers, got %s and %s", first.Number, renewal.Number)
+	}
+
+	// Test case 3: An immediate plan change is invoiced with the credit for the old plan
+	change, err := service.ChangePlan(ctx, subscription.ChangePlanInput{
+		SubscriptionID: sub.ID,
+		ProductID:      premiumProduct.ID,
+		Mode:           subscription.PlanChangeImmediately,
+	})
+	if err != nil {
+		t.Fatal("Failed to change plan:", err)
+	}
+
+	planChange := uow.invoices.invoices[len(uow.invoices.invoices)-1]
+	if planChange.Reason != models.InvoiceReasonPlanChange {
+		t.Fatalf("Expected a plan change invoice, got %v", planChange.Reason)
+	}
+
+	if !planChange.Subtotal.Equal(change.AmountDue.Round(2)) {
+		t.Errorf("Expected subtotal %v, got %v", change.AmountDue.Round(2), planChange.Subtotal)
+	}
+
+	// Test case 4: A plan change at period end is invoiced by the renewal, not right away
+	count := len(uow.invoices.invoices)
+	if _, err := service.ChangePlan(ctx, subscription.ChangePlanInput{
+		SubscriptionID: sub.ID,
+		ProductID:      basicProduct.ID,
+		Mode:           subscription.PlanChangeAtPeriodEnd,
+	}); err != nil {
+		t.Fatal("Failed to change plan:", err)
+	}
+
+	if len(uow.invoices.invoices) != count {
+		t.Errorf("Expected no invoice for a scheduled plan change, got %d", len(uow.invoices.invoices)-count)
+	}
+}
+
+func TestPayments(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	uow := newMockUnitOfWork(subRepo, voucherRepo)
+	payments, provider := newTestPayments(uow.payments)
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, uow, payments, newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	product := createTestProduct()
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
+
+	input := subscription.CreateSubscriptionInput{
+		UserID:    uuid.New(),
+		ProductID: product.ID,
+		AutoRenew: true,
+	}
+
+	// Test case 1: Creating a subscription charges the first invoice
+	sub, err := service.CreateSubscription(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	if len(uow.payments.payments) != 1 || provider.Charges() != 1 {
+		t.Fatalf("Expected 1 payment, got %d (%d charges)", len(uow.payments.payments), provider.Charges())
+	}
+
+	paid := uow.payments.payments[0]
+	firstInvoice := uow.invoices.invoices[0]
+	if paid.Status != models.PaymentStatusSucceeded || paid.InvoiceID == nil || *paid.InvoiceID != firstInvoice.ID ||
+		!paid.Amount.Equal(firstInvoice.Total) || paid.SubscriptionID != sub.ID {
+		t.Errorf("Expected a succeeded payment of %v for the first invoice, got %v of %v", firstInvoice.Total, paid.Status, paid.Amount)
+	}
+
+	// Test case 2: A failed charge leaves no subscription or invoice behind. A charge the
+	// provider may still collect is saved without an invoice, so it can be refunded.
+	for _, tc := range []struct {
+		outcome  payment.Outcome
+		expected error
+		status   models.PaymentStatus
+	}{
+		{payment.OutcomeDecline, errors.ErrPaymentDeclined, ""},
+		{payment.OutcomeRequireAction, errors.ErrPaymentRequiresAction, models.PaymentStatusRequiresAction},
+		{payment.OutcomeTimeout, errors.ErrPaymentTimeout, models.PaymentStatusPending},
+	} {
+		provider.Script(tc.outcome)
+		subscriptions, invoices, recorded := len(subRepo.subscriptions), len(uow.invoices.invoices), len(uow.payments.payments)
+
+		if _, err := service.CreateSubscription(ctx, input); err != tc.expected {
+			t.Errorf("Expected error %v for outcome %v, got %v", tc.expected, tc.outcome, err)
+		}
+
+		if len(subRepo.subscriptions) != subscriptions || len(uow.invoices.invoices) != invoices {
+			t.Errorf("Expected no subscription or invoice to be saved for outcome %v", tc.outcome)
+		}
+
+		if tc.status == "" {
+			if len(uow.payments.payments) != recorded {
+				t.Errorf("Expected no payment to be saved for outcome %v", tc.outcome)
+			}
+			continue
+		}
+
+		saved := uow.payments.payments[len(uow.payments.payments)-1]
+		if len(uow.payments.payments) != recorded+1 || saved.Status != tc.status || saved.InvoiceID != nil {
+			t.Errorf("Expected a %v payment without invoice for outcome %v, got %v", tc.status, tc.outcome, saved.Status)
+		}
+	}
+
+	// Test case 3: Without a payment method neither a paid subscription nor a trial can start
+	noMethod := input
+	noMethod.UserID = uuid.New()
+	uow.payments.withoutAccount[noMethod.UserID] = true
+
+	if _, err := service.CreateSubscription(ctx, noMethod); err != errors.ErrPaymentMethodRequired {
+		t.Errorf("Expected error %v, got %v", errors.ErrPaymentMethodRequired, err)
+	}
+
+	noMethod.WithTrial = true
+	if _, err := service.CreateSubscription(ctx, noMethod); err != errors.ErrPaymentMethodRequired {
+		t.Errorf("Expected error %v for a trial, got %v", errors.ErrPaymentMethodRequired, err)
+	}
+
+	// Test case 4: A declined renewal marks the subscription past due without renewing it
+	periodEnd := time.Now().Add(-time.Minute)
+	sub.EndDate = periodEnd
+	provider.Script(payment.OutcomeDecline)
+	invoices := len(uow.invoices.invoices)
+
+	if _, err := service.ProcessRenewals(ctx, 10); err != nil {
+		t.Fatal("Failed to process renewals:", err)
+	}
+
+	if sub.Status != models.SubscriptionStatusPastDue || !sub.EndDate.Equal(periodEnd) {
+		t.Errorf("Expected a past due subscription ending %v, got %v ending %v", periodEnd, sub.Status, sub.EndDate)
+	}
+
+	failed := uow.payments.payments[len(uow.payments.payments)-1]
+	if failed.Status != models.PaymentStatusFailed || failed.FailureCode != "card_declined" || failed.InvoiceID != nil {
+		t.Errorf("Expected a recorded card_declined payment without invoice, got %v %q", failed.Status, failed.FailureCode)
+	}
+
+	if len(uow.invoices.invoices) != invoices {
+		t.Error("Expected no invoice for a failed renewal")
+	}
+
+	// Test case 5: A trial is charged when it ends and cancelled if the charge fails
+	trialInput := input
+	trialInput.WithTrial = true
+	charges := provider.Charges()
+
+	trialSub, err := service.CreateSubscription(ctx, trialInput)
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	if provider.Charges() != charges {
+		t.Error("Expected no charge when a trial starts")
+	}
+
+	trialEnd := time.Now().Add(-time.Minute)
+	trialSub.TrialEndDate = &trialEnd
+	provider.Script(payment.OutcomeDecline)
+
+	if _, err := service.ProcessTrialEnds(ctx, 10); err != nil {
+		t.Fatal("Failed to process trial ends:", err)
+	}
+
+	if trialSub.Status != models.SubscriptionStatusCancelled {
+		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusCancelled, trialSub.Status)
+	}
+	// Test case 6: A collected renewal that cannot be saved is refunded
+	conflicted, err := service.CreateSubscription(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+	conflicted.EndDate = time.Now().Add(-time.Minute)
+	subRepo.versions[conflicted.ID]++ // the customer changed the subscription while it was charged
+	charges, collected, recorded := provider.Charges(), provider.Collected(), len(uow.payments.payments)
+
+	if _, err := service.ProcessRenewals(ctx, 10); err != nil {
+		t.Fatal("Failed to process renewals:", err)
+	}
+
+	if provider.Charges() != charges+1 || !provider.Collected().Equal(collected) {
+		t.Errorf("Expected the renewal to be charged and refunded, got %d charges and %s collected (was %s)",
+			provider.Charges()-charges, provider.Collected(), collected)
+	}
+
+	if len(uow.payments.payments) != recorded {
+		t.Errorf("Expected no payment to be saved, got %d", len(uow.payments.payments)-recorded)
+	}
+}
+
+func TestPaymentEvents(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	uow := newMockUnitOfWork(subRepo, voucherRepo)
+	payments, provider := newTestPayments(uow.payments)
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, uow, payments, newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	product := createTestProduct()
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
+
+	input := subscription.CreateSubscriptionInput{
+		UserID:    uuid.New(),
+		ProductID: product.ID,
+		AutoRenew: true,
+	}
+
+	sub, err := service.CreateSubscription(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+	firstPayment := uow.payments.payments[0]
+	firstInvoice := uow.invoices.invoices[0]
+
+	lastPayment := func() *models.Payment {
+		return uow.payments.payments[len(uow.payments.payments)-1]
+	}
+
+	// Test case 1: A renewal whose charge timed out recovers when the charge is confirmed
+	periodEnd := time.Now().Add(-time.Minute)
+	sub.EndDate = periodEnd
+	provider.Script(payment.OutcomeTimeout)
+
+	if _, err := service.ProcessRenewals(ctx, 10); err != nil {
+		t.Fatal("Failed to process renewals:", err)
+	}
+
+	pending := lastPayment()
+	if sub.Status != models.SubscriptionStatusPastDue || pending.Status != models.PaymentStatusPending {
+		t.Fatalf("Expected a past due subscription with a pending payment, got %v and %v", sub.Status, pending.Status)
+	}
+
+	// The renewal is billed at the price it was charged at, not the price when it is collected
+	price := product.Price
+	product.Price = price.Add(decimal.NewFromInt(10))
+
+	succeeded := &payment.Event{
+		ID:             "evt_1",
+		Type:           payment.EventPaymentSucceeded,
+		PaymentID:      "ch_late_1",
+		IdempotencyKey: pending.ID.String(),
+	}
+	if err := service.HandlePaymentSucceeded(ctx, succeeded); err != nil {
+		t.Fatal("Failed to handle payment succeeded event:", err)
+	}
+	product.Price = price
+
+	expectedEnd := periodEnd.AddDate(0, product.DurationMonths, 0)
+	if sub.Status != models.SubscriptionStatusActive || !sub.EndDate.Equal(expectedEnd) {
+		t.Errorf("Expected an active subscription ending %v, got %v ending %v", expectedEnd, sub.Status, sub.EndDate)
+	}
+
+	recovered := lastPayment()
+	renewalInvoice := uow.invoices.invoices[len(uow.invoices.invoices)-1]
+	if recovered.Status != models.PaymentStatusSucceeded || recovered.ProviderPaymentID != "ch_late_1" ||
+		recovered.InvoiceID == nil || *recovered.InvoiceID != renewalInvoice.ID || renewalInvoice.Reason != models.InvoiceReasonRenewal {
+		t.Errorf("Expected the payment to be collected and linked to the renewal invoice, got %+v", recovered)
+	}
+
+	if !renewalInvoice.Total.Equal(pending.Amount) || !renewalInvoice.CreditApplied.IsZero() ||
+		!renewalInvoice.Subtotal.Add(renewalInvoice.TaxAmount).Equal(renewalInvoice.Total) || !sub.TotalAmount.Equal(pending.Amount) {
+		t.Errorf("Expected the renewal to be billed at the %s charged, got invoice total %s (credit %s) and subscription total %s",
+			pending.Amount, renewalInvoice.Total, renewalInvoice.CreditApplied, sub.TotalAmount)
+	}
+
+	// Test case 2: The same event again changes nothing
+	invoices := len(uow.invoices.invoices)
+	succeeded.IdempotencyKey = ""
+	if err := service.HandlePaymentSucceeded(ctx, succeeded); err != nil {
+		t.Fatal("Failed to handle payment succeeded event:", err)
+	}
+
+	if len(uow.invoices.invoices) != invoices || !sub.EndDate.Equal(expectedEnd) {
+		t.Error("Expected a repeated event not to renew the subscription again")
+	}
+
+	// Test case 3: A dispute puts the subscription past due and marks the invoice disputed
+	disputed := &payment.Event{ID: "evt_2", Type: payment.EventPaymentDisputed, PaymentID: firstPayment.ProviderPaymentID}
+	if err := service.HandlePaymentDisputed(ctx, disputed); err != nil {
+		t.Fatal("Failed to handle payment disputed event:", err)
+	}
+
+	if sub.Status != models.SubscriptionStatusPastDue || firstInvoice.PaymentStatus != models.InvoicePaymentStatusDisputed {
+		t.Errorf("Expected a past due subscription and a disputed invoice, got %v and %v", sub.Status, firstInvoice.PaymentStatus)
+	}
+
+	// Test case 4: Only a full refund marks the payment and invoice refunded
+	refunded := &payment.Event{
+		ID:        "evt_3",
+		Type:      payment.EventPaymentRefunded,
+		PaymentID: "ch_late_1",
+		Amount:    decimal.NewFromInt(1),
+	}
+	if err := service.HandlePaymentRefunded(ctx, refunded); err != nil {
+		t.Fatal("Failed to handle payment refunded event:", err)
+	}
+
+	if renewalInvoice.PaymentStatus != models.InvoicePaymentStatusPaid {
+		t.Errorf("Expected a partial refund to leave the invoice %v, got %v", models.InvoicePaymentStatusPaid, renewalInvoice.PaymentStatus)
+	}
+
+	refunded.Amount = decimal.Zero
+	if err := service.HandlePaymentRefunded(ctx, refunded); err != nil {
+		t.Fatal("Failed to handle payment refunded event:", err)
+	}
+
+	if lastPayment().Status != models.PaymentStatusRefunded || renewalInvoice.PaymentStatus != models.InvoicePaymentStatusRefunded {
+		t.Errorf("Expected a refunded payment and invoice, got %v and %v", lastPayment().Status, renewalInvoice.PaymentStatus)
+	}
+
+	// Test case 5: A charge collected after its trial was cancelled is refunded
+	trialInput := input
+	trialInput.WithTrial = true
+	trialSub, err := service.CreateSubscription(ctx, trialInput)
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	trialEnd := time.Now().Add(-time.Minute)
+	trialSub.TrialEndDate = &trialEnd
+	provider.Script(payment.OutcomeRequireAction)
+
+	if _, err := service.ProcessTrialEnds(ctx, 10); err != nil {
+		t.Fatal("Failed to process trial ends:", err)
+	}
+
+	authenticated := lastPayment()
+	if trialSub.Status != models.SubscriptionStatusCancelled || authenticated.Status != models.PaymentStatusRequiresAction {
+		t.Fatalf("Expected a cancelled trial with a payment requiring action, got %v and %v", trialSub.Status, authenticated.Status)
+	}
+
+	if err := provider.SetChargeStatus(authenticated.ProviderPaymentID, models.PaymentStatusSucceeded); err != nil {
+		t.Fatal("Failed to set charge status:", err)
+	}
+
+	late := &payment.Event{ID: "evt_4", Type: payment.EventPaymentSucceeded, PaymentID: authenticated.ProviderPaymentID}
+	if err := service.HandlePaymentSucceeded(ctx, late); err != nil {
+		t.Fatal("Failed to handle payment succeeded event:", err)
+	}
+
+	status, _ := provider.GetPaymentStatus(ctx, authenticated.ProviderPaymentID)
+	if lastPayment().Status != models.PaymentStatusRefunded || status != models.PaymentStatusRefunded {
+		t.Errorf("Expected the late payment to be refunded, got %v (provider: %v)", lastPayment().Status, status)
+	}
+
+	if trialSub.Status != models.SubscriptionStatusCancelled {
+		t.Errorf("Expected the trial to stay cancelled, got %v", trialSub.Status)
+	}
+
+	// Test case 6: A first charge that timed out and is collected later is refunded, since
+	// its subscription was never created
+	provider.Script(payment.OutcomeTimeout)
+	if _, err := service.CreateSubscription(ctx, input); err != errors.ErrPaymentTimeout {
+		t.Fatalf("Expected error %v, got %v", errors.ErrPaymentTimeout, err)
+	}
+
+	timedOut := lastPayment()
+	account := uow.payments.defaultAccount
+	collected, err := provider.Charge(ctx, payment.ChargeRequest{
+		CustomerID:      account.CustomerID,
+		PaymentMethodID: account.PaymentMethodID,
+		Amount:          timedOut.Amount,
+		Currency:        timedOut.Currency,
+		IdempotencyKey:  timedOut.ID.String(),
+	})
+	if err != nil {
+		t.Fatal("Failed to collect the charge:", err)
+	}
+
+	collectedLate := &payment.Event{ID: "evt_6", Type: payment.EventPaymentSucceeded, PaymentID: collected.ID, IdempotencyKey: timedOut.ID.String()}
+	if err := service.HandlePaymentSucceeded(ctx, collectedLate); err != nil {
+		t.Fatal("Failed to handle payment succeeded event:", err)
+	}
+
+	status, _ = provider.GetPaymentStatus(ctx, collected.ID)
+	if lastPayment().Status != models.PaymentStatusRefunded || status != models.PaymentStatusRefunded {
+		t.Errorf("Expected the payment to be refunded, got %v (provider: %v)", lastPayment().Status, status)
+	}
+
+	// Test case 7: Events about payments this service did not make are ignored
+	unknown := &payment.Event{ID: "evt_5", Type: payment.EventPaymentFailed, PaymentID: "ch_elsewhere"}
+	if err := service.HandlePaymentFailed(ctx, unknown); err != nil {
+		t.Errorf("Expected no error for an unknown payment, got %v", err)
+	}
+
+	// Test case 8: A subscription past due for a disputed payment expires at the end of its period
+	disputedSub, err := service.CreateSubscription(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	disputed = &payment.Event{ID: "evt_7", Type: payment.EventPaymentDisputed, PaymentID: lastPayment().ProviderPaymentID}
+	if err := service.HandlePaymentDisputed(ctx, disputed); err != nil {
+		t.Fatal("Failed to handle payment disputed event:", err)
+	}
+
+	if disputedSub.Status != models.SubscriptionStatusPastDue || disputedSub.NextPaymentAttemptAt == nil ||
+		!disputedSub.NextPaymentAttemptAt.Equal(disputedSub.EndDate) {
+		t.Fatalf("Expected a past due subscription due at its end date %v, got %v due at %v",
+			disputedSub.EndDate, disputedSub.Status, disputedSub.NextPaymentAttemptAt)
+	}
+
+	ended := time.Now().Add(-time.Minute)
+	disputedSub.EndDate = ended
+	disputedSub.NextPaymentAttemptAt = &ended
+	charges := provider.Charges()
+
+	if _, err := service.ProcessPaymentRetries(ctx, 10); err != nil {
+		t.Fatal("Failed to process payment retries:", err)
+	}
+
+	if disputedSub.Status != models.SubscriptionStatusExpired || provider.Charges() != charges {
+		t.Errorf("Expected the subscription to expire without a charge, got %v after %d charges",
+			disputedSub.Status, provider.Charges()-charges)
+	}
+}
+
+func TestDunning(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	uow := newMockUnitOfWork(subRepo, voucherRepo)
+	payments, provider := newTestPayments(uow.payments)
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, uow, payments, newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	product := createTestProduct()
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
+
+	input := subscription.CreateSubscriptionInput{
+		UserID:    uuid.New(),
+		ProductID: product.ID,
+		AutoRenew: true,
+	}
+
+	lastPayment := func() *models.Payment {
+		return uow.payments.payments[len(uow.payments.payments)-1]
+	}
+	lastReasonCode := func(sub *models.Subscription) models.StateChangeReasonCode {
+		changes, _ := subRepo.GetStateChangesBySubscriptionID(ctx, sub.ID)
+		return changes[len(changes)-1].ReasonCode
+	}
+	retryNow := func(sub *models.Subscription) {
+		due := time.Now().Add(-time.Second)
+		sub.NextPaymentAttemptAt = &due
+	}
+
+	sub, err := service.CreateSubscription(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	// Test case 1: A declined renewal schedules the first retry a day after the period ended
+	periodEnd := time.Now().Add(-time.Minute)
+	sub.EndDate = periodEnd
+	provider.Script(payment.OutcomeDecline)
+
+	if _, err := service.ProcessRenewals(ctx, 10); err != nil {
+		t.Fatal("Failed to process renewals:", err)
+	}
+
+	if sub.Status != models.SubscriptionStatusPastDue || sub.FailedPaymentAttempts != 1 ||
+		sub.NextPaymentAttemptAt == nil || !sub.NextPaymentAttemptAt.Equal(periodEnd.Add(24*time.Hour)) {
+		t.Errorf("Expected a past due subscription retried at %v, got %v after %d attempts, retried at %v",
+			periodEnd.Add(24*time.Hour), sub.Status, sub.FailedPaymentAttempts, sub.NextPaymentAttemptAt)
+	}
+
+	if code := lastReasonCode(sub); code != models.StateChangeReasonRenewalPaymentFailed {
+		t.Errorf("Expected reason code %v, got %v", models.StateChangeReasonRenewalPaymentFailed, code)
+	}
+
+	if lastPayment().Attempt != 1 {
+		t.Errorf("Expected attempt 1, got %d", lastPayment().Attempt)
+	}
+
+	// Test case 2: Retries are not made before they are due
+	if retried, err := service.ProcessPaymentRetries(ctx, 10); err != nil || retried != 0 {
+		t.Errorf("Expected no retries, got %d (%v)", retried, err)
+	}
+
+	// Test case 3: A failed retry is recorded and schedules the next one
+	retryNow(sub)
+	provider.Script(payment.OutcomeDecline)
+
+	if retried, err := service.ProcessPaymentRetries(ctx, 10); err != nil || retried != 1 {
+		t.Fatalf("Expected 1 retry, got %d (%v)", retried, err)
+	}
+
+	if sub.Status != models.SubscriptionStatusPastDue || sub.FailedPaymentAttempts != 2 ||
+		sub.NextPaymentAttemptAt == nil || !sub.NextPaymentAttemptAt.Equal(periodEnd.Add(3*24*time.Hour)) {
+		t.Errorf("Expected a retry at %v after 2 attempts, got %v after %d attempts",
+			periodEnd.Add(3*24*time.Hour), sub.NextPaymentAttemptAt, sub.FailedPaymentAttempts)
+	}
+
+	if code := lastReasonCode(sub); code != models.StateChangeReasonPaymentRetryFailed {
+		t.Errorf("Expected reason code %v, got %v", models.StateChangeReasonPaymentRetryFailed, code)
+	}
+
+	if failed := lastPayment(); failed.Attempt != 2 || failed.Status != models.PaymentStatusFailed {
+		t.Errorf("Expected failed attempt 2, got %v attempt %d", failed.Status, failed.Attempt)
+	}
+
+	// Test case 4: A successful retry renews the subscription into the unpaid period's successor
+	retryNow(sub)
+	invoices := len(uow.invoices.invoices)
+
+	if _, err := service.ProcessPaymentRetries(ctx, 10); err != nil {
+		t.Fatal("Failed to process payment retries:", err)
+	}
+
+	expectedEnd := periodEnd.AddDate(0, product.DurationMonths, 0)
+	if sub.Status != models.SubscriptionStatusActive || !sub.EndDate.Equal(expectedEnd) {
+		t.Errorf("Expected an active subscription ending %v, got %v ending %v", expectedEnd, sub.Status, sub.EndDate)
+	}
+
+	if sub.FailedPaymentAttempts != 0 || sub.NextPaymentAttemptAt != nil {
+		t.Errorf("Expected the retry schedule to be cleared, got %d attempts, next at %v", sub.FailedPaymentAttempts, sub.NextPaymentAttemptAt)
+	}
+
+	if code := lastReasonCode(sub); code != models.StateChangeReasonPaymentRecovered {
+		t.Errorf("Expected reason code %v, got %v", models.StateChangeReasonPaymentRecovered, code)
+	}
+
+	if len(uow.invoices.invoices) != invoices+1 || lastPayment().Attempt != 3 || lastPayment().InvoiceID == nil {
+		t.Errorf("Expected an invoice paid by attempt 3, got attempt %d", lastPayment().Attempt)
+	}
+
+	// Test case 5: The subscription is cancelled when every retry failed
+	sub.EndDate = time.Now().Add(-time.Minute)
+	provider.Script(payment.OutcomeDecline, payment.OutcomeDecline, payment.OutcomeDecline, payment.OutcomeDecline)
+
+	if _, err := service.ProcessRenewals(ctx, 10); err != nil {
+		t.Fatal("Failed to process renewals:", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		retryNow(sub)
+		if _, err := service.ProcessPaymentRetries(ctx, 10); err != nil {
+			t.Fatal("Failed to process payment retries:", err)
+		}
+	}
+
+	if sub.Status != models.SubscriptionStatusCancelled || sub.NextPaymentAttemptAt != nil {
+		t.Errorf("Expected a cancelled subscription without retries, got %v, next at %v", sub.Status, sub.NextPaymentAttemptAt)
+	}
+
+	if code := lastReasonCode(sub); code != models.StateChangeReasonDunningExhausted {
+		t.Errorf("Expected reason code %v, got %v", models.StateChangeReasonDunningExhausted, code)
+	}
+
+	if lastPayment().Attempt != 4 {
+		t.Errorf("Expected 4 attempts, got %d", lastPayment().Attempt)
+	}
+
+	// Test case 6: A policy that pauses instead counts the unpaid time as paused
+	pausing := subscription.NewService(subRepo, productRepo, voucherRepo, uow, payments, newTestTaxService(), newTestExchangeService(), subscription.DunningPolicy{
+		RetryAfter:  []time.Duration{24 * time.Hour},
+		FinalAction: subscription.ActionSuspend,
+	})
+
+	paused, err := pausing.CreateSubscription(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	periodEnd = time.Now().Add(-time.Hour)
+	paused.EndDate = periodEnd
+	provider.Script(payment.OutcomeDecline, payment.OutcomeDecline)
+
+	if _, err := pausing.ProcessRenewals(ctx, 10); err != nil {
+		t.Fatal("Failed to process renewals:", err)
+	}
+
+	retryNow(paused)
+	if _, err := pausing.ProcessPaymentRetries(ctx, 10); err != nil {
+		t.Fatal("Failed to process payment retries:", err)
+	}
+
+	if paused.Status != models.SubscriptionStatusPaused || paused.PausedAt == nil || !paused.PausedAt.Equal(periodEnd) {
+		t.Fatalf("Expected a subscription paused at %v, got %v paused at %v", periodEnd, paused.Status, paused.PausedAt)
+	}
+
+	if code := lastReasonCode(paused); code != models.StateChangeReasonDunningExhausted {
+		t.Errorf("Expected reason code %v, got %v", models.StateChangeReasonDunningExhausted, code)
+	}
+
+	pauses, _ := subRepo.GetPausesBySubscriptionID(ctx, paused.ID)
+	if len(pauses) != 1 || pauses[0].ScheduledResumeAt != nil {
+		t.Errorf("Expected 1 pause without a resume date, got %d", len(pauses))
+	}
+
+	// Test case 7: Resuming makes the renewal due right away
+	if err := pausing.UnpauseSubscription(ctx, paused.ID); err != nil {
+		t.Fatal("Failed to resume subscription:", err)
+	}
+
+	if paused.EndDate.After(time.Now()) || time.Since(paused.EndDate) > time.Minute {
+		t.Errorf("Expected the period to end now, got %v", paused.EndDate)
+	}
+
+	// Test case 8: A past due subscription scheduled to cancel is cancelled instead of charged
+	cancelling, err := service.CreateSubscription(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+
+	cancelling.Status = models.SubscriptionStatusPastDue
+	cancelling.EndDate = time.Now().Add(-time.Minute)
+	cancelling.FailedPaymentAttempts = 1
+
+	if _, err := service.Cancel(ctx, subscription.CancelSubscriptionInput{
+		SubscriptionID: cancelling.ID,
+		Mode:           subscription.CancelAtPeriodEnd,
+	}); err != nil {
+		t.Fatal("Failed to schedule cancellation:", err)
+	}
+
+	retryNow(cancelling)
+	charges := provider.Charges()
+
+	if retried, err := service.ProcessPaymentRetries(ctx, 10); err != nil || retried != 0 {
+		t.Errorf("Expected no retries, got %d (%v)", retried, err)
+	}
+
+	if cancelled, err := service.ProcessCancellations(ctx, 10); err != nil || cancelled != 1 {
+		t.Fatalf("Expected 1 cancellation, got %d (%v)", cancelled, err)
+	}
+
+	if cancelling.Status != models.SubscriptionStatusCancelled || cancelling.NextPaymentAttemptAt != nil || provider.Charges() != charges {
+		t.Errorf("Expected a cancelled subscription without retries or charges, got %v, next at %v, %d charges",
+			cancelling.Status, cancelling.NextPaymentAttemptAt, provider.Charges()-charges)
+	}
+}
+
+func TestRefunds(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	subRepo := newMockSubscriptionRepository()
+	productRepo := newMockProductRepository()
+	voucherRepo := newMockVoucherRepository()
+	uow := newMockUnitOfWork(subRepo, voucherRepo)
+	payments, _ := newTestPayments(uow.payments)
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, uow, payments, newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
+
+	newProduct := func(policy models.RefundPolicy, windowDays int) *models.Product {
+		product := createTestProduct()
+		product.RefundPolicy = policy
+		product.RefundWindowDays = windowDays
+		if err := productRepo.Create(ctx, product); err != nil {
+			t.Fatal("Failed to create test product:", err)
+		}
+		return product
+	}
+	subscribe := func(product *models.Product) (*models.Subscription, *models.Invoice) {
+		sub, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+			UserID:    uuid.New(),
+			ProductID: product.ID,
+			AutoRenew: true,
+		})
+		if err != nil {
+			t.Fatal("Failed to create subscription:", err)
+		}
+		return sub, uow.invoices.invoices[len(uow.invoices.invoices)-1]
+	}
+	cancel := func(sub *models.Subscription) {
+		if _, err := service.Cancel(ctx, subscription.CancelSubscriptionInput{
+			SubscriptionID: sub.ID,
+			Mode:           subscription.CancelImmediately,
+		}); err != nil {
+			t.Fatal("Failed to cancel subscription:", err)
+		}
+	}
+	creditNotes := func(invoice *models.Invoice) []*models.CreditNote {
+		notes, err := service.GetInvoiceCreditNotes(ctx, invoice.ID)
+		if err != nil {
+			t.Fatal("Failed to get credit notes:", err)
+		}
+		return notes
+	}
+
+	sub, invoice := subscribe(newProduct(models.RefundPolicyNone, 0))
+
+	// Test case 1: Part of an invoice is refunded with a credit note
+	amount := decimal.NewFromInt(5)
+	creditNote, err := service.RefundInvoice(ctx, subscription.RefundInput{
+		InvoiceID: invoice.ID,
+		Amount:    &amount,
+		Note:      "Goodwill",
+	})
+	if err != nil {
+		t.Fatal("Failed to refund invoice:", err)
+	}
+
+	if !creditNote.Total.Equal(amount) || !creditNote.Subtotal.Add(creditNote.TaxAmount).Equal(amount) {
+		t.Errorf("Expected a credit note of %s split into subtotal and tax, got %s + %s = %s",
+			amount, creditNote.Subtotal, creditNote.TaxAmount, creditNote.Total)
+	}
+
+	if creditNote.InvoiceID != invoice.ID || creditNote.Reason != models.CreditNoteReasonSupport ||
+		creditNote.ProviderRefundID == "" {
+		t.Errorf("Expected a support credit note for invoice %s with a provider refund, got %+v", invoice.ID, creditNote)
+	}
+
+	expectedNumber := fmt.Sprintf("CN-%d-000001", creditNote.IssuedAt.UTC().Year())
+	if creditNote.Number != expectedNumber {
+		t.Errorf("Expected credit note number %s, got %s", expectedNumber, creditNote.Number)
+	}
+
+	if invoice.PaymentStatus != models.InvoicePaymentStatusPartiallyRefunded {
+		t.Errorf("Expected invoice payment status %v, got %v", models.InvoicePaymentStatusPartiallyRefunded, invoice.PaymentStatus)
+	}
+
+	// Test case 2: More than is left to refund is rejected
+	tooMuch := invoice.Total
+	if _, err := service.RefundInvoice(ctx, subscription.RefundInput{InvoiceID: invoice.ID, Amount: &tooMuch}); err != errors.ErrRefundExceedsPayment {
+		t.Errorf("Expected error %v, got %v", errors.ErrRefundExceedsPayment, err)
+	}
+
+	// Test case 3: Without an amount the rest of the payment is refunded
+	creditNote, err = service.RefundInvoice(ctx, subscription.RefundInput{InvoiceID: invoice.ID})
+	if err != nil {
+		t.Fatal("Failed to refund invoice:", err)
+	}
+
+	if !creditNote.Total.Equal(invoice.Total.Sub(amount)) {
+		t.Errorf("Expected a credit note of %s, got %s", invoice.Total.Sub(amount), creditNote.Total)
+	}
+
+	paid := uow.payments.payments[len(uow.payments.payments)-1]
+	if invoice.PaymentStatus != models.InvoicePaymentStatusRefunded || paid.Status != models.PaymentStatusRefunded ||
+		!paid.RefundedAmount.Equal(invoice.Total) {
+		t.Errorf("Expected a refunded invoice and payment, got %v and %v with %s refunded",
+			invoice.PaymentStatus, paid.Status, paid.RefundedAmount)
+	}
+
+	if notes := creditNotes(invoice); len(notes) != 2 {
+		t.Errorf("Expected 2 credit notes, got %d", len(notes))
+	}
+
+	// Test case 4: A refunded invoice cannot be refunded again
+	if _, err := service.RefundInvoice(ctx, subscription.RefundInput{InvoiceID: invoice.ID}); err != errors.ErrInvoiceNotRefundable {
+		t.Errorf("Expected error %v, got %v", errors.ErrInvoiceNotRefundable, err)
+	}
+
+	// Test case 5: Cancelling under the none policy refunds nothing
+	sub, invoice = subscribe(newProduct(models.RefundPolicyNone, 0))
+	cancel(sub)
+
+	if notes := creditNotes(invoice); len(notes) != 0 {
+		t.Errorf("Expected no credit notes, got %d", len(notes))
+	}
+
+	// Test case 6: Cancelling halfway through the period refunds half under the prorated policy
+	sub, invoice = subscribe(newProduct(models.RefundPolicyProrated, 0))
+	sub.StartDate = time.Now().Add(-sub.EndDate.Sub(time.Now()))
+	cancel(sub)
+
+	notes := creditNotes(invoice)
+	if len(notes) != 1 {
+		t.Fatalf("Expected 1 credit note, got %d", len(notes))
+	}
+
+	half := sub.TotalAmount.Div(decimal.NewFromInt(2))
+	if notes[0].Reason != models.CreditNoteReasonCancellation || notes[0].Total.Sub(half).Abs().GreaterThan(decimal.NewFromFloat(0.01)) {
+		t.Errorf("Expected a cancellation credit note of about %s, got %v of %s", half, notes[0].Reason, notes[0].Total)
 	}
-	return result, nil
-}
 
-func (m *mockVoucherRepository) GetAllActive(ctx context.Context) ([]*models.Voucher, error) {
-	var result []*models.Voucher
-	for _, v := range m.vouchers {
-		if v.IsActive && v.ExpiresAt.After(time.Now()) {
-			result = append(result, v)
-		}
+	// Test case 7: Cancelling within the refund window refunds the whole period
+	sub, invoice = subscribe(newProduct(models.RefundPolicyFullWithinDays, 14))
+	cancel(sub)
+
+	notes = creditNotes(invoice)
+	if len(notes) != 1 || !notes[0].Total.Equal(invoice.Total) {
+		t.Errorf("Expected a credit note of %s, got %v", invoice.Total, notes)
 	}
-	return result, nil
-}
 
-func (m *mockVoucherRepository) Update(ctx context.Context, voucher *models.Voucher) error {
-	if _, ok := m.vouchers[voucher.ID]; !ok {
-		return errors.ErrVoucherNotFound
+	// Test case 8: Cancelling after the refund window refunds nothing
+	sub, invoice = subscribe(newProduct(models.RefundPolicyFullWithinDays, 14))
+	invoice.IssuedAt = time.Now().AddDate(0, 0, -15)
+	cancel(sub)
+
+	if notes := creditNotes(invoice); len(notes) != 0 {
+		t.Errorf("Expected no credit notes, got %d", len(notes))
 	}
-	m.vouchers[voucher.ID] = voucher
-	m.codes[voucher.Code] = voucher
-	return nil
-}
 
-func (m *mockVoucherRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	if voucher, ok := m.vouchers[id]; ok {
-		delete(m.vouchers, id)
-		delete(m.codes, voucher.Code)
-		return nil
+	// Test case 9: A period that was paused and resumed is still refunded
+	sub, invoice = subscribe(newProduct(models.RefundPolicyFullWithinDays, 14))
+	sub.EndDate = sub.EndDate.AddDate(0, 0, 10)
+	cancel(sub)
+
+	notes = creditNotes(invoice)
+	if len(notes) != 1 || !notes[0].Total.Equal(invoice.Total) {
+		t.Errorf("Expected a credit note of %s, got %v", invoice.Total, notes)
 	}
-	return errors.ErrVoucherNotFound
-}
 
-// Helper function to create a test product
-func createTestProduct() *models.Product {
-	return &models.Product{
-		ID:             uuid.New(),
-		Name:           "Test Product",
-		Description:    "Test Description",
-		Price:          decimal.NewFromFloat(19.99),
-		DurationMonths: 1,
-		TaxRate:        decimal.NewFromFloat(0.20), // 20% tax
-		IsActive:       true,
-		CreatedAt:      time.Now(),
-		UpdatedAt:      time.Now(),
+	// Test case 10: After a plan change the refund is prorated from what the new plan was invoiced
+	sub, invoice = subscribe(newProduct(models.RefundPolicyProrated, 0))
+	invoice.PeriodStart = invoice.PeriodStart.AddDate(0, -2, 0)
+	premiumProduct := newProduct(models.RefundPolicyProrated, 0)
+	premiumProduct.Price = decimal.NewFromInt(100)
+	if _, err := service.ChangePlan(ctx, subscription.ChangePlanInput{
+		SubscriptionID: sub.ID,
+		ProductID:      premiumProduct.ID,
+		Mode:           subscription.PlanChangeImmediately,
+	}); err != nil {
+		t.Fatal("Failed to change plan:", err)
 	}
-}
+	invoice = uow.invoices.invoices[len(uow.invoices.invoices)-1]
+	sub.StartDate = time.Now().Add(-sub.EndDate.Sub(time.Now()))
+	cancel(sub)
 
-// Helper function to create a test subscription
-func createTestSubscription(userID, productID uuid.UUID, status models.SubscriptionStatus) *models.Subscription {
-	return &models.Subscription{
-		ID:            uuid.New(),
-		UserID:        userID,
-		ProductID:     productID,
-		Status:        status,
-		StartDate:     time.Now(),
-		EndDate:       time.Now().AddDate(0, 1, 0), // 1 month duration
-		OriginalPrice: decimal.NewFromFloat(19.99),
-		TaxAmount:     decimal.NewFromFloat(4.00),
-		TotalAmount:   decimal.NewFromFloat(23.99),
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
+	notes = creditNotes(invoice)
+	if len(notes) != 1 {
+		t.Fatalf("Expected 1 credit note, got %d", len(notes))
 	}
-}
 
-// Helper function to create a test voucher
-func createTestVoucher() *models.Voucher {
-	return &models.Voucher{
-		ID:            uuid.New(),
-		Code:          "TEST20",
-		DiscountType:  models.DiscountTypePercentage,
-		DiscountValue: decimal.NewFromInt(20), // 20% discount
-		IsActive:      true,
-		ExpiresAt:     time.Now().AddDate(0, 1, 0), // Expires in 1 month
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
+	half = invoice.Total.Div(decimal.NewFromInt(2))
+	if notes[0].Total.Sub(half).Abs().GreaterThan(decimal.NewFromFloat(0.01)) {
+		t.Errorf("Expected a credit note of about %s of the %s invoiced, got %s", half, invoice.Total, notes[0].Total)
+	}
+	// Test case 11: Amounts below the currency's minor unit are rejected
+	_, invoice = subscribe(newProduct(models.RefundPolicyNone, 0))
+	for _, value := range []string{"0.004", "-1"} {
+		amount := decimal.RequireFromString(value)
+		_, err := service.RefundInvoice(ctx, subscription.RefundInput{InvoiceID: invoice.ID, Amount: &amount})
+		if validationErrors, ok := err.(errors.ValidationErrors); !ok || validationErrors[0].Field != "amount" {
+			t.Errorf("Expected a validation error for amount %s, got %v", value, err)
+		}
 	}
 }
 
-// Tests for SubscriptionService
-func TestCreateSubscription(t *testing.T) {
+func TestCreditBalance(t *testing.T) {
 	// Setup
 	ctx := context.Background()
 	subRepo := newMockSubscriptionRepository()
 	productRepo := newMockProductRepository()
 	voucherRepo := newMockVoucherRepository()
-	service := subscription.NewService(subRepo, productRepo, voucherRepo)
+	uow := newMockUnitOfWork(subRepo, voucherRepo)
+	payments, provider := newTestPayments(uow.payments)
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, uow, payments, newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
 
-	// Create a test product
 	product := createTestProduct()
-	err := productRepo.Create(ctx, product)
-	if err != nil {
-		t.Fatal("Failed to create test product:", err)
+	premiumProduct := createTestProduct()
+	premiumProduct.Price = decimal.NewFromInt(100)
+	for _, p := range []*models.Product{product, premiumProduct} {
+		if err := productRepo.Create(ctx, p); err != nil {
+			t.Fatal("Failed to create test product:", err)
+		}
 	}
 
-	// Test case 1: Create subscription without voucher or trial
 	userID := uuid.New()
-	input := subscription.CreateSubscriptionInput{
-		UserID:    userID,
-		ProductID: product.ID,
-		WithTrial: false,
+	grant := func(amount decimal.Decimal, currency string) {
+		if err := uow.credits.AddEntry(ctx, &models.CreditEntry{
+			UserID:   userID,
+			Type:     models.CreditEntryTypeCredit,
+			Amount:   amount,
+			Currency: currency,
+			Reason:   models.CreditEntryReasonGrant,
+		}); err != nil {
+			t.Fatal("Failed to grant credit:", err)
+		}
+	}
+	lastInvoice := func() *models.Invoice {
+		return uow.invoices.invoices[len(uow.invoices.invoices)-1]
+	}
+	lastPayment := func() *models.Payment {
+		return uow.payments.payments[len(uow.payments.payments)-1]
 	}
 
-	sub, err := service.CreateSubscription(ctx, input)
+	// Test case 1: Credit pays part of the first invoice and the rest is charged
+	grant(decimal.NewFromInt(10), "EUR")
+
+	sub, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:    userID,
+		ProductID: product.ID,
+		AutoRenew: true,
+	})
 	if err != nil {
 		t.Fatal("Failed to create subscription:", err)
 	}
 
-	if sub.UserID != userID {
-		t.Errorf("Expected UserID %v, got %v", userID, sub.UserID)
+	invoice := lastInvoice()
+	if !invoice.CreditApplied.Equal(decimal.NewFromInt(10)) || !lastPayment().Amount.Equal(invoice.Total.Sub(decimal.NewFromInt(10))) {
+		t.Errorf("Expected 10 of %s paid from credit and the rest charged, got %s from credit and %s charged",
+			invoice.Total, invoice.CreditApplied, lastPayment().Amount)
 	}
 
-	if sub.ProductID != product.ID {
-		t.Errorf("Expected ProductID %v, got %v", product.ID, sub.ProductID)
+	if balance := uow.credits.balances[userID]["EUR"]; !balance.IsZero() {
+		t.Errorf("Expected the credit to be used up, got balance %s", balance)
 	}
 
-	if sub.Status != models.SubscriptionStatusActive {
-		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusActive, sub.Status)
+	debit := uow.credits.entries[len(uow.credits.entries)-1]
+	if debit.Type != models.CreditEntryTypeDebit || debit.Reason != models.CreditEntryReasonInvoice ||
+		debit.ReferenceID == nil || *debit.ReferenceID != invoice.ID {
+		t.Errorf("Expected a debit for invoice %s, got %v %v for %v", invoice.ID, debit.Type, debit.Reason, debit.ReferenceID)
 	}
 
-	if sub.TrialEndDate != nil {
-		t.Error("Expected TrialEndDate to be nil")
+	// Test case 2: A renewal covered by credit charges nothing
+	grant(decimal.NewFromInt(50), "EUR")
+	paymentCount := len(uow.payments.payments)
+	sub.EndDate = time.Now().Add(-time.Minute)
+
+	if _, err := service.ProcessRenewals(ctx, 10); err != nil {
+		t.Fatal("Failed to process renewals:", err)
 	}
 
-	// Test case 2: Create subscription with trial period
-	input.WithTrial = true
+	invoice = lastInvoice()
+	if invoice.Reason != models.InvoiceReasonRenewal || !invoice.CreditApplied.Equal(invoice.Total) || !invoice.AmountDue().IsZero() {
+		t.Errorf("Expected a renewal invoice paid from credit, got %v with %s of %s from credit",
+			invoice.Reason, invoice.CreditApplied, invoice.Total)
+	}
 
-	subWithTrial, err := service.CreateSubscription(ctx, input)
+	if len(uow.payments.payments) != paymentCount {
+		t.Errorf("Expected no charge, got %d new payments", len(uow.payments.payments)-paymentCount)
+	}
+
+	if balance := uow.credits.balances[userID]["EUR"]; !balance.Equal(decimal.NewFromInt(50).Sub(invoice.Total)) {
+		t.Errorf("Expected balance %s, got %s", decimal.NewFromInt(50).Sub(invoice.Total), balance)
+	}
+
+	// Test case 3: Unused time beyond the new plan's price is added to the balance, with tax
+	if _, err := service.ChangePlan(ctx, subscription.ChangePlanInput{
+		SubscriptionID: sub.ID,
+		ProductID:      premiumProduct.ID,
+		Mode:           subscription.PlanChangeImmediately,
+	}); err != nil {
+		t.Fatal("Failed to change plan:", err)
+	}
+
+	sub.StartDate = time.Now().Add(-time.Hour)
+	sub.EndDate = time.Now().AddDate(0, 1, 0)
+	before := uow.credits.balances[userID]["EUR"]
+
+	change, err := service.ChangePlan(ctx, subscription.ChangePlanInput{
+		SubscriptionID: sub.ID,
+		ProductID:      product.ID,
+		Mode:           subscription.PlanChangeImmediately,
+	})
 	if err != nil {
-		t.Fatal("Failed to create subscription with trial:", err)
+		t.Fatal("Failed to change plan:", err)
 	}
 
-	if subWithTrial.TrialEndDate == nil {
-		t.Error("Expected TrialEndDate not to be nil")
+	leftover := change.Credit.Sub(change.Charge)
+	expected := leftover.Add(leftover.Mul(decimal.NewFromFloat(0.20))).Round(2)
+	if !change.CreditToBalance.Equal(expected) {
+		t.Errorf("Expected %s added to the balance, got %s", expected, change.CreditToBalance)
+	}
+
+	credited := uow.credits.entries[len(uow.credits.entries)-1]
+	if credited.Reason != models.CreditEntryReasonPlanChange || !credited.Amount.Equal(expected) ||
+		!uow.credits.balances[userID]["EUR"].Equal(before.Add(expected)) {
+		t.Errorf("Expected a plan change credit of %s, got %v of %s", expected, credited.Reason, credited.Amount)
+	}
+
+	// Test case 4: Credit in another currency is not spent on the subscription's invoices
+	uow.credits.balances[userID]["EUR"] = decimal.Zero
+	grant(decimal.NewFromInt(5000), "JPY")
+	sub.EndDate = time.Now().Add(-time.Minute)
+
+	if _, err := service.ProcessRenewals(ctx, 10); err != nil {
+		t.Fatal("Failed to process renewals:", err)
+	}
+
+	invoice = lastInvoice()
+	if invoice.Currency != "EUR" || !invoice.CreditApplied.IsZero() || !lastPayment().Amount.Equal(invoice.Total) {
+		t.Errorf("Expected the EUR renewal to be charged in full, got %s of %s %s from credit",
+			invoice.CreditApplied, invoice.Total, invoice.Currency)
+	}
+
+	if balance := uow.credits.balances[userID]["JPY"]; !balance.Equal(decimal.NewFromInt(5000)) {
+		t.Errorf("Expected the JPY balance to be kept, got %s", balance)
+	}
+	// Test case 5: A charge is refunded if its credit was spent by another invoice before it was saved
+	grant(decimal.NewFromInt(10), "EUR")
+	uow.credits.afterGetBalance = func() {
+		uow.credits.balances[userID]["EUR"] = decimal.Zero
+	}
+	collected := provider.Collected()
+
+	_, err = service.ChangePlan(ctx, subscription.ChangePlanInput{
+		SubscriptionID: sub.ID,
+		ProductID:      premiumProduct.ID,
+		Mode:           subscription.PlanChangeImmediately,
+	})
+	uow.credits.afterGetBalance = nil
+	if err == nil {
+		t.Fatal("Expected the plan change to fail")
+	}
+
+	if !provider.Collected().Equal(collected) {
+		t.Errorf("Expected the charge to be refunded, got %s collected (was %s)", provider.Collected(), collected)
 	}
 }
 
-func TestPauseSubscription(t *testing.T) {
+func TestBuyerTaxes(t *testing.T) {
 	// Setup
 	ctx := context.Background()
 	subRepo := newMockSubscriptionRepository()
 	productRepo := newMockProductRepository()
 	voucherRepo := newMockVoucherRepository()
-	service := subscription.NewService(subRepo, productRepo, voucherRepo)
+	uow := newMockUnitOfWork(subRepo, voucherRepo)
+	userRepo := newMockUserRepository()
+	taxes := tax.NewService(tax.NewRulesCalculator(tax.DefaultRules()), userRepo, &mockVATValidationRepository{}, nil, "")
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, uow, newTestPaymentService(), taxes, newTestExchangeService(), subscription.DefaultDunningPolicy())
 
-	userID := uuid.New()
-	productID := uuid.New()
-
-	// Create an active subscription
-	activeSub := createTestSubscription(userID, productID, models.SubscriptionStatusActive)
-	err := subRepo.Create(ctx, activeSub)
-	if err != nil {
-		t.Fatal("Failed to create active subscription:", err)
+	product := createTestProduct()
+	product.Price = decimal.NewFromInt(100)
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
 	}
 
-	// Test case 1: Pause an active subscription
-	err = service.PauseSubscription(ctx, activeSub.ID)
-	if err != nil {
-		t.Fatal("Failed to pause subscription:", err)
+	buyer := &models.User{ID: uuid.New(), BillingAddress: &models.Address{Country: "CA", Region: "QC"}}
+	if err := userRepo.Create(ctx, buyer); err != nil {
+		t.Fatal("Failed to create test user:", err)
 	}
 
-	// Retrieve the updated subscription
-	updatedSub, err := subRepo.GetByID(ctx, activeSub.ID)
+	// Test case 1: A buyer in Quebec is charged the federal and the provincial tax
+	sub, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:    buyer.ID,
+		ProductID: product.ID,
+	})
 	if err != nil {
-		t.Fatal("Failed to get updated subscription:", err)
+		t.Fatal("Failed to create subscription:", err)
 	}
 
-	if updatedSub.Status != models.SubscriptionStatusPaused {
-		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusPaused, updatedSub.Status)
+	if len(sub.TaxComponents) != 2 || !sub.TaxAmount.Equal(decimal.RequireFromString("14.975")) {
+		t.Errorf("Expected GST and QST totalling 14.975, got %v", sub.TaxComponents)
 	}
 
-	// Test case 2: Pause a subscription that's already paused
-	err = service.PauseSubscription(ctx, activeSub.ID)
-	if err == nil {
-		t.Error("Expected error when pausing already paused subscription")
+	created := uow.invoices.invoices[0]
+	var taxLines []string
+	for _, line := range created.Lines {
+		if line.Type == models.InvoiceLineTypeTax {
+			taxLines = append(taxLines, line.Description+" "+line.Amount.String())
+		}
+	}
+	if len(taxLines) != 2 || taxLines[0] != "GST (5%) 5" || taxLines[1] != "QST (9.975%) 9.98" {
+		t.Errorf("Expected GST and QST lines, got %v", taxLines)
+	}
+	if !created.Total.Equal(decimal.RequireFromString("114.98")) {
+		t.Errorf("Expected total 114.98, got %v", created.Total)
 	}
 
-	// Test case 3: Pause a subscription that's in trial period
-	trialSub := createTestSubscription(userID, productID, models.SubscriptionStatusActive)
-	trialEnd := time.Now().AddDate(0, 1, 0) // 1 month trial
-	trialSub.TrialEndDate = &trialEnd
+	// Test case 2: A renewal is taxed at the buyer's new address
+	buyer.BillingAddress = &models.Address{Country: "DE"}
+	sub.EndDate = time.Now().Add(-time.Minute)
+	sub.AutoRenew = true
+	if _, err := service.ProcessRenewals(ctx, 10); err != nil {
+		t.Fatal("Failed to process renewals:", err)
+	}
 
-	err = subRepo.Create(ctx, trialSub)
+	renewed, err := service.GetSubscriptionByID(ctx, sub.ID)
 	if err != nil {
-		t.Fatal("Failed to create trial subscription:", err)
+		t.Fatal("Failed to get subscription:", err)
 	}
-
-	err = service.PauseSubscription(ctx, trialSub.ID)
-	if err == nil {
-		t.Error("Expected error when pausing subscription in trial period")
+	if len(renewed.TaxComponents) != 1 || renewed.TaxComponents[0].Jurisdiction != "DE" ||
+		!renewed.TotalAmount.Equal(decimal.NewFromInt(119)) {
+		t.Errorf("Expected German VAT on the renewal, got %v totalling %v", renewed.TaxComponents, renewed.TotalAmount)
 	}
 }
 
-func TestUnpauseSubscription(t *testing.T) {
+func TestReverseCharge(t *testing.T) {
 	// Setup
 	ctx := context.Background()
 	subRepo := newMockSubscriptionRepository()
 	productRepo := newMockProductRepository()
 	voucherRepo := newMockVoucherRepository()
-	service := subscription.NewService(subRepo, productRepo, voucherRepo)
+	uow := newMockUnitOfWork(subRepo, voucherRepo)
+	userRepo := newMockUserRepository()
+	validationRepo := &mockVATValidationRepository{}
+	taxes := tax.NewService(tax.NewRulesCalculator(tax.DefaultRules()), userRepo, validationRepo, nil, "IE")
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, uow, newTestPaymentService(), taxes, newTestExchangeService(), subscription.DefaultDunningPolicy())
 
-	userID := uuid.New()
-	productID := uuid.New()
+	product := createTestProduct()
+	product.Price = decimal.NewFromInt(100)
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
 
-	// Create a paused subscription
-	pausedSub := createTestSubscription(userID, productID, models.SubscriptionStatusPaused)
-	err := subRepo.Create(ctx, pausedSub)
-	if err != nil {
-		t.Fatal("Failed to create paused subscription:", err)
+	business := func(country, vatID string) *models.User {
+		user := &models.User{
+			ID:              uuid.New(),
+			BillingAddress:  &models.Address{Country: country},
+			BusinessProfile: &models.BusinessProfile{CompanyName: "Example", VATID: vatID},
+		}
+		userRepo.Create(ctx, user)
+		return user
 	}
 
-	// Test case 1: Unpause a paused subscription
-	err = service.UnpauseSubscription(ctx, pausedSub.ID)
+	// Test case 1: A business in another member state with a valid VAT ID is not charged VAT
+	german := business("DE", "DE136695976")
+	quote, err := service.QuoteSubscription(ctx, subscription.QuoteInput{UserID: german.ID, ProductID: product.ID})
 	if err != nil {
-		t.Fatal("Failed to unpause subscription:", err)
+		t.Fatal("Failed to quote subscription:", err)
+	}
+	if !quote.ReverseCharge || !quote.TotalAmount.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("Expected a reverse-charged quote of 100, got %v", quote.TotalAmount)
+	}
+	if len(validationRepo.validations) != 0 {
+		t.Errorf("Expected a quote not to record the VAT ID check, got %d records", len(validationRepo.validations))
 	}
 
-	// Retrieve the updated subscription
-	updatedSub, err := subRepo.GetByID(ctx, pausedSub.ID)
+	sub, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{UserID: german.ID, ProductID: product.ID})
 	if err != nil {
-		t.Fatal("Failed to get updated subscription:", err)
+		t.Fatal("Failed to create subscription:", err)
 	}
 
-	if updatedSub.Status != models.SubscriptionStatusActive {
-		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusActive, updatedSub.Status)
+	if len(validationRepo.validations) != 1 || validationRepo.validations[0].Status != models.VATValidationStatusValid {
+		t.Fatalf("Expected 1 valid VAT ID check on record, got %v", validationRepo.validations)
 	}
+	validation := validationRepo.validations[0]
 
-	// Test case 2: Unpause a subscription that's already active
-	err = service.UnpauseSubscription(ctx, pausedSub.ID)
-	if err == nil {
-		t.Error("Expected error when unpausing already active subscription")
+	if !sub.ReverseCharge || !sub.TaxAmount.IsZero() || sub.CustomerVATID != "DE136695976" ||
+		sub.VATValidationID == nil || *sub.VATValidationID != validation.ID {
+		t.Errorf("Expected a reverse-charged subscription linked to the check, got tax %v for %q", sub.TaxAmount, sub.CustomerVATID)
+	}
+
+	created := uow.invoices.invoices[0]
+	if !created.ReverseCharge || created.CustomerVATID != "DE136695976" || !created.Total.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("Expected a reverse-charged invoice of 100, got %v", created.Total)
+	}
+	for _, line := range created.Lines {
+		if line.Type == models.InvoiceLineTypeTax {
+			t.Errorf("Expected no tax lines, got %q", line.Description)
+		}
+	}
+
+	// Test case 2: A business in the seller's member state is charged VAT
+	irish := business("IE", "IE6388047V")
+	sub, err = service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{UserID: irish.ID, ProductID: product.ID})
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+	if sub.ReverseCharge || !sub.TotalAmount.Equal(decimal.NewFromInt(123)) || len(validationRepo.validations) != 1 {
+		t.Errorf("Expected Irish VAT and no VAT ID check, got total %v", sub.TotalAmount)
+	}
+
+	// Test case 3: A VAT ID that fails validation is recorded and VAT is charged
+	invalid := business("FR", "FR00303265045")
+	sub, err = service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{UserID: invalid.ID, ProductID: product.ID})
+	if err != nil {
+		t.Fatal("Failed to create subscription:", err)
+	}
+	if sub.ReverseCharge || !sub.TotalAmount.Equal(decimal.NewFromInt(120)) {
+		t.Errorf("Expected French VAT, got total %v", sub.TotalAmount)
+	}
+	if len(validationRepo.validations) != 2 || validationRepo.validations[1].Status != models.VATValidationStatusInvalid {
+		t.Errorf("Expected the failed check on record, got %v", validationRepo.validations)
 	}
 }
 
-func TestCancelSubscription(t *testing.T) {
+func TestLedgerPostings(t *testing.T) {
 	// Setup
 	ctx := context.Background()
 	subRepo := newMockSubscriptionRepository()
 	productRepo := newMockProductRepository()
 	voucherRepo := newMockVoucherRepository()
-	service := subscription.NewService(subRepo, productRepo, voucherRepo)
+	uow := newMockUnitOfWork(subRepo, voucherRepo)
+	payments, _ := newTestPayments(uow.payments)
+	service := subscription.NewService(subRepo, productRepo, voucherRepo, uow, payments, newTestTaxService(), newTestExchangeService(), subscription.DefaultDunningPolicy())
 
-	userID := uuid.New()
-	productID := uuid.New()
+	product := createTestProduct()
+	if err := productRepo.Create(ctx, product); err != nil {
+		t.Fatal("Failed to create test product:", err)
+	}
 
-	// Create subscriptions with different statuses
-	activeSub := createTestSubscription(userID, productID, models.SubscriptionStatusActive)
-	pausedSub := createTestSubscription(userID, productID, models.SubscriptionStatusPaused)
+	lineAmount := func(entry *models.JournalEntry, account models.LedgerAccount) decimal.Decimal {
+		amount := decimal.Zero
+		for _, line := range entry.Lines {
+			if line.Account == account {
+				amount = amount.Add(line.Debit).Sub(line.Credit)
+			}
+		}
+		return amount
+	}
 
-	err := subRepo.Create(ctx, activeSub)
-	if err != nil {
-		t.Fatal("Failed to create active subscription:", err)
+	// Test case 1: The invoice defers its price and is owed until the payment is collected
+	if _, err := service.CreateSubscription(ctx, subscription.CreateSubscriptionInput{
+		UserID:    uuid.New(),
+		ProductID: product.ID,
+	}); err != nil {
+		t.Fatal("Failed to create subscription:", err)
 	}
+	invoice := uow.invoices.invoices[len(uow.invoices.invoices)-1]
 
-	err = subRepo.Create(ctx, pausedSub)
-	if err != nil {
-		t.Fatal("Failed to create paused subscription:", err)
+	invoiceEntries := uow.ledger.ofType(models.JournalEntryTypeInvoice)
+	if len(invoiceEntries) != 1 {
+		t.Fatalf("Expected 1 invoice entry, got %d", len(invoiceEntries))
+	}
+	if entry := invoiceEntries[0]; !lineAmount(entry, models.LedgerAccountReceivables).Equal(invoice.Total) ||
+		!lineAmount(entry, models.LedgerAccountDeferredRevenue).Equal(invoice.Subtotal.Neg()) ||
+		!lineAmount(entry, models.LedgerAccountTaxPayable).Equal(invoice.TaxAmount.Neg()) {
+		t.Errorf("Expected %s receivable, %s deferred and %s tax, got %+v", invoice.Total, invoice.Subtotal, invoice.TaxAmount, entry.Lines)
 	}
 
-	// Test case 1: Cancel an active subscription
-	err = service.CancelSubscription(ctx, activeSub.ID)
-	if err != nil {
-		t.Fatal("Failed to cancel active subscription:", err)
+	paymentEntries := uow.ledger.ofType(models.JournalEntryTypePayment)
+	if len(paymentEntries) != 1 || !lineAmount(paymentEntries[0], models.LedgerAccountCash).Equal(invoice.Total) ||
+		!lineAmount(paymentEntries[0], models.LedgerAccountReceivables).Equal(invoice.Total.Neg()) {
+		t.Errorf("Expected a payment entry of %s, got %v", invoice.Total, paymentEntries)
 	}
 
-	// Retrieve the updated subscription
-	updatedActiveSub, err := subRepo.GetByID(ctx, activeSub.ID)
+	// Test case 2: A refund takes the price back from deferred revenue and the tax from tax payable
+	amount := decimal.NewFromInt(6)
+	creditNote, err := service.RefundInvoice(ctx, subscription.RefundInput{InvoiceID: invoice.ID, Amount: &amount})
 	if err != nil {
-		t.Fatal("Failed to get updated active subscription:", err)
+		t.Fatal("Failed to refund invoice:", err)
 	}
 
-	if updatedActiveSub.Status != models.SubscriptionStatusCancelled {
-		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusCancelled, updatedActiveSub.Status)
+	refundEntries := uow.ledger.ofType(models.JournalEntryTypeRefund)
+	if len(refundEntries) != 1 || refundEntries[0].ReferenceID != creditNote.ID {
+		t.Fatalf("Expected 1 refund entry for the credit note, got %v", refundEntries)
+	}
+	if entry := refundEntries[0]; !lineAmount(entry, models.LedgerAccountDeferredRevenue).Equal(creditNote.Subtotal) ||
+		!lineAmount(entry, models.LedgerAccountTaxPayable).Equal(creditNote.TaxAmount) ||
+		!lineAmount(entry, models.LedgerAccountCash).Equal(amount.Neg()) {
+		t.Errorf("Expected %s from deferred revenue and %s from tax, got %+v", creditNote.Subtotal, creditNote.TaxAmount, entry.Lines)
 	}
 
-	// Test case 2: Cancel a paused subscription
-	err = service.CancelSubscription(ctx, pausedSub.ID)
-	if err != nil {
-		t.Fatal("Failed to cancel paused subscription:", err)
+	deferred, _ := uow.ledger.GetDeferredRevenue(ctx, invoice.ID)
+	if !deferred.Equal(invoice.Subtotal.Sub(creditNote.Subtotal)) {
+		t.Errorf("Expected %s deferred revenue left, got %s", invoice.Subtotal.Sub(creditNote.Subtotal), deferred)
 	}
 
-	// Retrieve the updated subscription
-	updatedPausedSub, err := subRepo.GetByID(ctx, pausedSub.ID)
-	if err != nil {
-		t.Fatal("Failed to get updated paused subscription:", err)
+	// Test case 3: Every posted entry is balanced and the ledger as a whole is too
+	totals := make(map[models.LedgerAccount]decimal.Decimal)
+	for _, entry := range uow.ledger.entries {
+		if !entry.IsBalanced() {
+			t.Errorf("Expected a balanced %s entry, got %+v", entry.Type, entry.Lines)
+		}
+		for _, line := range entry.Lines {
+			totals[line.Account] = totals[line.Account].Add(line.Debit).Sub(line.Credit)
+		}
 	}
 
-	if updatedPausedSub.Status != models.SubscriptionStatusCancelled {
-		t.Errorf("Expected status %v, got %v", models.SubscriptionStatusCancelled, updatedPausedSub.Status)
+	sum := decimal.Zero
+	for _, total := range totals {
+		sum = sum.Add(total)
+	}
+	if !sum.IsZero() || !totals[models.LedgerAccountReceivables].IsZero() {
+		t.Errorf("Expected a balanced ledger with nothing receivable, got %v", totals)
 	}
 }
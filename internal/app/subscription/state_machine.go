@@ -0,0 +1,333 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Action is an event that moves a subscription through its lifecycle
+type Action string
+
+const (
+	ActionPause          Action = "pause"
+	ActionResume         Action = "resume"
+	ActionCancel         Action = "cancel"
+	ActionScheduleCancel Action = "schedule_cancel"
+	ActionUndoCancel     Action = "undo_cancel"
+	ActionChangePlan     Action = "change_plan"
+
+	// System actions, triggered by background jobs
+	ActionActivate    Action = "activate"
+	ActionRenew       Action = "renew"
+	ActionExpire      Action = "expire"
+	ActionMarkPastDue Action = "mark_past_due"
+	ActionRecover     Action = "recover"
+	// ActionRetryPayment records a failed retry of a past due subscription's renewal
+	ActionRetryPayment Action = "retry_payment"
+	// ActionSuspend pauses a past due subscription whose renewal retries ran out
+	ActionSuspend Action = "suspend"
+)
+
+// transition describes one action of the state machine
+type transition struct {
+	// from lists the states the action is allowed in
+	from []models.SubscriptionStatus
+	// to is the state after the action; empty keeps the current state
+	to models.SubscriptionStatus
+	// notAllowed is returned when the subscription is in none of the from states
+	notAllowed error
+	// guard rejects the action based on the rest of the subscription
+	guard func(subscription *models.Subscription, now time.Time) error
+	// effect updates the subscription as part of the action
+	effect func(subscription *models.Subscription, now time.Time)
+}
+
+var (
+	liveStates = []models.SubscriptionStatus{
+		models.SubscriptionStatusTrialing,
+		models.SubscriptionStatusActive,
+		models.SubscriptionStatusPastDue,
+		models.SubscriptionStatusPaused,
+	}
+
+	// userActions are the actions customers trigger, in the order they are listed
+	userActions = []Action{
+		ActionPause,
+		ActionResume,
+		ActionChangePlan,
+		ActionScheduleCancel,
+		ActionUndoCancel,
+		ActionCancel,
+	}
+)
+
+// transitions is the subscription state machine. Every status change goes
+// through it and is recorded as a SubscriptionStateChange.
+var transitions = map[Action]transition{
+	ActionPause: {
+		from: []models.SubscriptionStatus{
+			models.SubscriptionStatusTrialing,
+			models.SubscriptionStatusActive,
+			models.SubscriptionStatusPaused,
+		},
+		to:         models.SubscriptionStatusPaused,
+		notAllowed: errors.ErrSubscriptionNotActive,
+		guard: func(subscription *models.Subscription, now time.Time) error {
+			if subscription.Status == models.SubscriptionStatusPaused {
+				return errors.ErrSubscriptionAlreadyPaused
+			}
+			if isInTrial(subscription, now) {
+				return errors.ErrSubscriptionInTrial
+			}
+			return nil
+		},
+		effect: func(subscription *models.Subscription, now time.Time) {
+			subscription.PausedAt = &now
+		},
+	},
+	ActionResume: {
+		from:       []models.SubscriptionStatus{models.SubscriptionStatusPaused},
+		to:         models.SubscriptionStatusActive,
+		notAllowed: errors.ErrSubscriptionNotPaused,
+		effect: func(subscription *models.Subscription, now time.Time) {
+			// Paused time is not lost: the period is extended by the pause
+			if subscription.PausedAt != nil {
+				subscription.EndDate = subscription.EndDate.Add(now.Sub(*subscription.PausedAt))
+			}
+			subscription.PausedAt = nil
+			subscription.ResumeAt = nil
+		},
+	},
+	ActionCancel: {
+		from:       liveStates,
+		to:         models.SubscriptionStatusCancelled,
+		notAllowed: errors.ErrSubscriptionNotActive,
+		effect: func(subscription *models.Subscription, now time.Time) {
+			if subscription.CancelledAt == nil {
+				subscription.CancelledAt = &now
+			}
+			subscription.CancelAtPeriodEnd = false
+			endDunning(subscription)
+		},
+	},
+	ActionScheduleCancel: {
+		from:       liveStates,
+		notAllowed: errors.ErrSubscriptionNotActive,
+		guard: func(subscription *models.Subscription, now time.Time) error {
+			if subscription.CancelAtPeriodEnd {
+				return errors.ErrCancellationAlreadyScheduled
+			}
+			return nil
+		},
+		effect: func(subscription *models.Subscription, now time.Time) {
+			subscription.CancelAtPeriodEnd = true
+			subscription.CancelledAt = &now
+		},
+	},
+	ActionUndoCancel: {
+		from:       liveStates,
+		notAllowed: errors.ErrCancellationNotScheduled,
+		guard: func(subscription *models.Subscription, now time.Time) error {
+			if !subscription.CancelAtPeriodEnd {
+				return errors.ErrCancellationNotScheduled
+			}
+			return nil
+		},
+		effect: func(subscription *models.Subscription, now time.Time) {
+			subscription.CancelAtPeriodEnd = false
+			subscription.CancelledAt = nil
+		},
+	},
+	ActionChangePlan: {
+		from: []models.SubscriptionStatus{
+			models.SubscriptionStatusTrialing,
+			models.SubscriptionStatusActive,
+		},
+		notAllowed: errors.ErrSubscriptionNotActive,
+	},
+	ActionActivate: {
+		from:       []models.SubscriptionStatus{models.SubscriptionStatusTrialing},
+		to:         models.SubscriptionStatusActive,
+		notAllowed: errors.ErrInvalidStateTransition,
+		guard: func(subscription *models.Subscription, now time.Time) error {
+			if isInTrial(subscription, now) {
+				return errors.ErrSubscriptionInTrial
+			}
+			return nil
+		},
+	},
+	ActionRenew: {
+		from:       []models.SubscriptionStatus{models.SubscriptionStatusActive},
+		to:         models.SubscriptionStatusActive,
+		notAllowed: errors.ErrSubscriptionNotActive,
+	},
+	ActionExpire: {
+		from: []models.SubscriptionStatus{
+			models.SubscriptionStatusActive,
+			models.SubscriptionStatusPastDue,
+		},
+		to:         models.SubscriptionStatusExpired,
+		notAllowed: errors.ErrInvalidStateTransition,
+		effect: func(subscription *models.Subscription, now time.Time) {
+			endDunning(subscription)
+		},
+	},
+	ActionMarkPastDue: {
+		from:       []models.SubscriptionStatus{models.SubscriptionStatusActive},
+		to:         models.SubscriptionStatusPastDue,
+		notAllowed: errors.ErrInvalidStateTransition,
+	},
+	ActionRecover: {
+		from:       []models.SubscriptionStatus{models.SubscriptionStatusPastDue},
+		to:         models.SubscriptionStatusActive,
+		notAllowed: errors.ErrInvalidStateTransition,
+		effect: func(subscription *models.Subscription, now time.Time) {
+			endDunning(subscription)
+		},
+	},
+	ActionRetryPayment: {
+		from:       []models.SubscriptionStatus{models.SubscriptionStatusPastDue},
+		notAllowed: errors.ErrInvalidStateTransition,
+	},
+	ActionSuspend: {
+		from:       []models.SubscriptionStatus{models.SubscriptionStatusPastDue},
+		to:         models.SubscriptionStatusPaused,
+		notAllowed: errors.ErrInvalidStateTransition,
+		effect: func(subscription *models.Subscription, now time.Time) {
+			// The unpaid period counts as paused, so a resume bills the renewal right away
+			pausedAt := subscription.EndDate
+			subscription.PausedAt = &pausedAt
+			subscription.ResumeAt = nil
+			endDunning(subscription)
+		},
+	},
+}
+
+// checkTransition returns an error if the action is not allowed for the subscription
+func checkTransition(subscription *models.Subscription, action Action, now time.Time) error {
+	t, ok := transitions[action]
+	if !ok {
+		return errors.ErrInvalidStateTransition
+	}
+
+	allowed := false
+	for _, status := range t.from {
+		if subscription.Status == status {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return t.notAllowed
+	}
+
+	if t.guard != nil {
+		return t.guard(subscription, now)
+	}
+
+	return nil
+}
+
+// AllowedActions returns the actions the customer can take on the subscription right now
+func AllowedActions(subscription *models.Subscription, now time.Time) []Action {
+	actions := []Action{}
+	for _, action := range userActions {
+		if checkTransition(subscription, action, now) == nil {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// GetAllowedActions returns the actions the customer can take on a subscription
+func (s *Service) GetAllowedActions(ctx context.Context, id uuid.UUID) ([]Action, error) {
+	subscription, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return AllowedActions(subscription, time.Now()), nil
+}
+
+// transitionOptions carries what a caller records alongside a transition
+type transitionOptions struct {
+	// At is when the transition happens; zero means now
+	At                 time.Time
+	Reason             string
+	ReasonCode         models.StateChangeReasonCode
+	CancellationReason string
+	Feedback           models.CancellationFeedback
+	// Write saves related records in the same transaction as the transition
+	Write func(tx repository.Transaction) error
+}
+
+// transition runs an action through the state machine, then saves the subscription
+// and records the state change in one transaction. The save fails with
+// ErrSubscriptionConflict if the subscription changed since it was read. Callers
+// that change other fields as part of the action call checkTransition first and
+// make their changes before calling it.
+func (s *Service) transition(ctx context.Context, subscription *models.Subscription, action Action, opts transitionOptions) error {
+	now := opts.At
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if err := checkTransition(subscription, action, now); err != nil {
+		return err
+	}
+
+	t := transitions[action]
+	previousState := subscription.Status
+	if t.to != "" {
+		subscription.Status = t.to
+	}
+	if t.effect != nil {
+		t.effect(subscription, now)
+	}
+
+	stateChange := &models.SubscriptionStateChange{
+		ID:                 uuid.New(),
+		SubscriptionID:     subscription.ID,
+		PreviousState:      previousState,
+		NewState:           subscription.Status,
+		ChangedAt:          now,
+		Reason:             opts.Reason,
+		ReasonCode:         opts.ReasonCode,
+		CancellationReason: opts.CancellationReason,
+		FeedbackCategory:   opts.Feedback,
+	}
+
+	return s.uow.Do(ctx, func(tx repository.Transaction) error {
+		repo := tx.Subscriptions()
+
+		// Update subscription
+		if err := repo.Update(ctx, subscription); err != nil {
+			if err == errors.ErrSubscriptionConflict {
+				return err
+			}
+			return fmt.Errorf("failed to update subscription: %w", err)
+		}
+
+		// Log state change
+		if err := repo.CreateStateChange(ctx, stateChange); err != nil {
+			return fmt.Errorf("failed to log state change: %w", err)
+		}
+
+		if opts.Write != nil {
+			return opts.Write(tx)
+		}
+
+		return nil
+	})
+}
+
+// isInTrial reports whether the subscription's trial is still running
+func isInTrial(subscription *models.Subscription, now time.Time) bool {
+	return subscription.TrialEndDate != nil && now.Before(*subscription.TrialEndDate)
+}
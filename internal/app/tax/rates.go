@@ -0,0 +1,84 @@
+package tax
+
+import (
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
+	"github.com/shopspring/decimal"
+)
+
+// Rate is one tax charged on a sale
+type Rate struct {
+	// Name is shown on invoices, e.g. "VAT" or "GST"
+	Name string
+	// Jurisdiction is the country, or the country and region, that levies the tax
+	Jurisdiction string
+	Rate         decimal.Decimal
+}
+
+// Rates are the taxes charged together on a sale. Each is charged on the pre-tax
+// amount; no tax is charged on another.
+type Rates []Rate
+
+// Total returns the sum of the rates
+func (r Rates) Total() decimal.Decimal {
+	total := decimal.Zero
+	for _, rate := range r {
+		total = total.Add(rate.Rate)
+	}
+	return total
+}
+
+// Result is the tax on an amount, broken down by the rates it was worked out with
+type Result struct {
+	// Net is the amount before tax
+	Net decimal.Decimal
+	// Tax is the sum of the components' amounts
+	Tax        decimal.Decimal
+	Components []models.TaxComponent
+}
+
+// Gross returns the amount with tax
+func (r Result) Gross() decimal.Decimal {
+	return r.Net.Add(r.Tax)
+}
+
+// Exclusive works out the tax added to a pre-tax amount. Like the amount, the tax is
+// not rounded; invoices round each line.
+func (r Rates) Exclusive(net decimal.Decimal) Result {
+	result := Result{Net: net, Tax: decimal.Zero}
+	for _, rate := range r {
+		amount := net.Mul(rate.Rate)
+		result.Components = append(result.Components, component(rate, amount))
+		result.Tax = result.Tax.Add(amount)
+	}
+	return result
+}
+
+// Inclusive splits an amount in the currency that includes tax into its pre-tax amount
+// and the tax. The pre-tax amount and each component are rounded to the currency's
+// minor unit and the last component takes the rounding difference, so that the parts
+// add up to the amount exactly.
+func (r Rates) Inclusive(gross decimal.Decimal, currencyCode string) Result {
+	net := currency.Round(gross.Div(decimal.NewFromInt(1).Add(r.Total())), currencyCode)
+	result := Result{Net: net, Tax: gross.Sub(net)}
+
+	remaining := result.Tax
+	for i, rate := range r {
+		amount := remaining
+		if i < len(r)-1 {
+			amount = currency.Round(net.Mul(rate.Rate), currencyCode)
+		}
+		result.Components = append(result.Components, component(rate, amount))
+		remaining = remaining.Sub(amount)
+	}
+	return result
+}
+
+func component(rate Rate, amount decimal.Decimal) models.TaxComponent {
+	return models.TaxComponent{
+		Name:         rate.Name,
+		Jurisdiction: rate.Jurisdiction,
+		Rate:         rate.Rate,
+		Amount:       amount,
+	}
+}
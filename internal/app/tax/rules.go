@@ -0,0 +1,144 @@
+package tax
+
+import (
+	"context"
+	"strings"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/shopspring/decimal"
+)
+
+// Rule sets the taxes charged to buyers in a country or region, on products of one
+// tax category or of all of them
+type Rule struct {
+	Country string
+	// Region is empty for a rule that applies to the whole country
+	Region string
+	// Category is empty for a rule that applies to every category
+	Category models.TaxCategory
+	Rates    Rates
+}
+
+type ruleKey struct {
+	country  string
+	region   string
+	category models.TaxCategory
+}
+
+// RulesCalculator looks the taxes of a buyer up in a table of rules. The most
+// specific rule applies: a rule for the buyer's region replaces the rules for their
+// country, and a rule for the product's category one for all categories. Buyers no
+// rule covers, and buyers without a billing address, pay the product's TaxRate.
+// Exempt products are not taxed anywhere.
+type RulesCalculator struct {
+	rules map[ruleKey]Rates
+}
+
+func NewRulesCalculator(rules []Rule) *RulesCalculator {
+	calculator := &RulesCalculator{rules: make(map[ruleKey]Rates, len(rules))}
+	for _, rule := range rules {
+		key := ruleKey{
+			country:  strings.ToUpper(rule.Country),
+			region:   strings.ToUpper(rule.Region),
+			category: rule.Category,
+		}
+
+		jurisdiction := key.country
+		if key.region != "" {
+			jurisdiction += "-" + key.region
+		}
+
+		rates := make(Rates, len(rule.Rates))
+		for i, rate := range rule.Rates {
+			rates[i] = rate
+			if rates[i].Jurisdiction == "" {
+				rates[i].Jurisdiction = jurisdiction
+			}
+		}
+		calculator.rules[key] = rates
+	}
+	return calculator
+}
+
+func (c *RulesCalculator) Rates(ctx context.Context, product *models.Product, address *models.Address) (Rates, error) {
+	category := product.TaxCategory
+	if category == "" {
+		category = models.TaxCategoryStandard
+	}
+
+	if category == models.TaxCategoryExempt {
+		return nil, nil
+	}
+
+	if address != nil && address.Country != "" {
+		country := strings.ToUpper(address.Country)
+		region := strings.ToUpper(address.Region)
+
+		keys := []ruleKey{
+			{country, region, category},
+			{country, region, ""},
+			{country, "", category},
+			{country, "", ""},
+		}
+		if region == "" {
+			keys = keys[2:]
+		}
+
+		for _, key := range keys {
+			if rates, ok := c.rules[key]; ok {
+				return rates, nil
+			}
+		}
+	}
+
+	if !product.TaxRate.IsPositive() {
+		return nil, nil
+	}
+	return Rates{{Name: "Tax", Rate: product.TaxRate}}, nil
+}
+
+// DefaultRules returns the built-in rules: standard and reduced VAT rates of some
+// European countries, and the sales taxes of Canada's provinces
+func DefaultRules() []Rule {
+	vat := func(country, standard, reduced string) []Rule {
+		return []Rule{
+			{Country: country, Rates: Rates{{Name: "VAT", Rate: decimal.RequireFromString(standard)}}},
+			{Country: country, Category: models.TaxCategoryReduced, Rates: Rates{{Name: "VAT", Rate: decimal.RequireFromString(reduced)}}},
+		}
+	}
+
+	// The federal GST is charged alongside the provincial taxes
+	gst := Rate{Name: "GST", Jurisdiction: "CA", Rate: decimal.RequireFromString("0.05")}
+	hst := func(rate string) Rates {
+		return Rates{{Name: "HST", Rate: decimal.RequireFromString(rate)}}
+	}
+
+	var rules []Rule
+	rules = append(rules, vat("AT", "0.20", "0.10")...)
+	rules = append(rules, vat("BE", "0.21", "0.06")...)
+	rules = append(rules, vat("DE", "0.19", "0.07")...)
+	rules = append(rules, vat("ES", "0.21", "0.10")...)
+	rules = append(rules, vat("FR", "0.20", "0.055")...)
+	rules = append(rules, vat("IE", "0.23", "0.135")...)
+	rules = append(rules, vat("IT", "0.22", "0.10")...)
+	rules = append(rules, vat("NL", "0.21", "0.09")...)
+	rules = append(rules, vat("PL", "0.23", "0.08")...)
+	rules = append(rules, vat("GB", "0.20", "0.05")...)
+	rules = append(rules, vat("CH", "0.081", "0.026")...)
+
+	rules = append(rules,
+		// Provinces without their own sales tax only charge the federal GST
+		Rule{Country: "CA", Rates: Rates{gst}},
+		Rule{Country: "CA", Region: "BC", Rates: Rates{gst, {Name: "PST", Rate: decimal.RequireFromString("0.07")}}},
+		Rule{Country: "CA", Region: "MB", Rates: Rates{gst, {Name: "RST", Rate: decimal.RequireFromString("0.07")}}},
+		Rule{Country: "CA", Region: "QC", Rates: Rates{gst, {Name: "QST", Rate: decimal.RequireFromString("0.09975")}}},
+		Rule{Country: "CA", Region: "SK", Rates: Rates{gst, {Name: "PST", Rate: decimal.RequireFromString("0.06")}}},
+		Rule{Country: "CA", Region: "ON", Rates: hst("0.13")},
+		Rule{Country: "CA", Region: "NB", Rates: hst("0.15")},
+		Rule{Country: "CA", Region: "NL", Rates: hst("0.15")},
+		Rule{Country: "CA", Region: "NS", Rates: hst("0.14")},
+		Rule{Country: "CA", Region: "PE", Rates: hst("0.15")},
+	)
+
+	return rules
+}
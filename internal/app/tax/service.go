@@ -0,0 +1,96 @@
+package tax
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/google/uuid"
+)
+
+// TaxCalculator decides which taxes are charged on a product sold to a buyer
+type TaxCalculator interface {
+	// Rates returns the taxes on product for a buyer with the given billing address,
+	// which is nil if the buyer has not set one
+	Rates(ctx context.Context, product *models.Product, address *models.Address) (Rates, error)
+}
+
+type Service struct {
+	calculator     TaxCalculator
+	userRepo       repository.UserRepository
+	validationRepo repository.VATValidationRepository
+	// validator is nil when VAT IDs are only validated offline
+	validator VATValidator
+	// sellerCountry is the member state the seller is registered for VAT in. Sales to
+	// businesses there are charged VAT like any other sale. When it is empty, no sale
+	// is reverse charged.
+	sellerCountry string
+}
+
+func NewService(
+	calculator TaxCalculator,
+	userRepo repository.UserRepository,
+	validationRepo repository.VATValidationRepository,
+	validator VATValidator,
+	sellerCountry string,
+) *Service {
+	return &Service{
+		calculator:     calculator,
+		userRepo:       userRepo,
+		validationRepo: validationRepo,
+		validator:      validator,
+		sellerCountry:  sellerCountry,
+	}
+}
+
+// Assess returns the taxes on product for the user, from the user's current billing
+// address and business profile. The check of a business's VAT ID is not recorded;
+// use AssessPurchase for sales that are made.
+func (s *Service) Assess(ctx context.Context, userID uuid.UUID, product *models.Product) (*Assessment, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	rates, err := s.calculator.Rates(ctx, product, user.BillingAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate tax: %w", err)
+	}
+
+	assessment := &Assessment{Rates: rates}
+	if len(rates) == 0 || !s.reverseChargeable(user) {
+		return assessment, nil
+	}
+
+	assessment.Validation = s.validateVATID(ctx, user)
+	assessment.ReverseCharge = assessment.Validation.Status == models.VATValidationStatusValid
+	return assessment, nil
+}
+
+// AssessPurchase is Assess for a sale that is made. The check of the buyer's VAT ID
+// is recorded as evidence for the VAT charged or not charged.
+func (s *Service) AssessPurchase(ctx context.Context, userID uuid.UUID, product *models.Product) (*Assessment, error) {
+	assessment, err := s.Assess(ctx, userID, product)
+	if err != nil {
+		return nil, err
+	}
+
+	if assessment.Validation != nil {
+		if err := s.validationRepo.Create(ctx, assessment.Validation); err != nil {
+			return nil, fmt.Errorf("failed to record VAT ID validation: %w", err)
+		}
+	}
+
+	return assessment, nil
+}
+
+// GetUserVATValidations returns the recorded checks of the user's VAT IDs, most
+// recent first
+func (s *Service) GetUserVATValidations(ctx context.Context, userID uuid.UUID) ([]*models.VATValidation, error) {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return s.validationRepo.GetByUserID(ctx, userID)
+}
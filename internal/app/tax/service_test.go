@@ -0,0 +1,380 @@
+package tax_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/tax"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type mockUserRepository struct {
+	users map[uuid.UUID]*models.User
+}
+
+func (m *mockUserRepository) Create(ctx context.Context, user *models.User) error {
+	m.users[user.ID] = user
+	return nil
+}
+
+func (m *mockUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if user, ok := m.users[id]; ok {
+		return user, nil
+	}
+	return nil, errors.ErrUserNotFound
+}
+
+func (m *mockUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return nil, errors.ErrUserNotFound
+}
+
+func (m *mockUserRepository) Update(ctx context.Context, user *models.User) error {
+	m.users[user.ID] = user
+	return nil
+}
+
+func (m *mockUserRepository) CountByRole(ctx context.Context, role models.UserRole) (int, error) {
+	return len(m.users), nil
+}
+
+type mockVATValidationRepository struct {
+	validations []*models.VATValidation
+}
+
+func (m *mockVATValidationRepository) Create(ctx context.Context, validation *models.VATValidation) error {
+	m.validations = append(m.validations, validation)
+	return nil
+}
+
+func (m *mockVATValidationRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.VATValidation, error) {
+	var result []*models.VATValidation
+	for i := len(m.validations) - 1; i >= 0; i-- {
+		if m.validations[i].UserID == userID {
+			result = append(result, m.validations[i])
+		}
+	}
+	return result, nil
+}
+
+// mockVATValidator knows the registered VAT IDs; it is unavailable while err is set
+type mockVATValidator struct {
+	registered map[string]bool
+	err        error
+}
+
+func (m *mockVATValidator) Name() string {
+	return "mock"
+}
+
+func (m *mockVATValidator) Check(ctx context.Context, vatID string) (*tax.VATCheck, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &tax.VATCheck{Valid: m.registered[vatID], Reference: "ref-" + vatID}, nil
+}
+
+// Helper function to describe rates as "name jurisdiction rate" for comparisons
+func describe(rates tax.Rates) []string {
+	var described []string
+	for _, rate := range rates {
+		described = append(described, rate.Name+" "+rate.Jurisdiction+" "+rate.Rate.String())
+	}
+	return described
+}
+
+func TestRulesCalculator(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	calculator := tax.NewRulesCalculator(tax.DefaultRules())
+
+	standard := &models.Product{TaxRate: decimal.NewFromFloat(0.1), TaxCategory: models.TaxCategoryStandard}
+	reduced := &models.Product{TaxRate: decimal.NewFromFloat(0.1), TaxCategory: models.TaxCategoryReduced}
+	exempt := &models.Product{TaxRate: decimal.NewFromFloat(0.1), TaxCategory: models.TaxCategoryExempt}
+	untaxed := &models.Product{TaxRate: decimal.Zero}
+
+	for _, tc := range []struct {
+		name     string
+		product  *models.Product
+		address  *models.Address
+		expected []string
+	}{
+		// Test case 1: A region with its own sales tax is charged it alongside the federal tax
+		{"Quebec", standard, &models.Address{Country: "CA", Region: "QC"}, []string{"GST CA 0.05", "QST CA-QC 0.09975"}},
+		// Test case 2: A region without a rule falls back to its country's
+		{"Alberta", standard, &models.Address{Country: "CA", Region: "AB"}, []string{"GST CA 0.05"}},
+		{"Ontario", standard, &models.Address{Country: "ca", Region: "on"}, []string{"HST CA-ON 0.13"}},
+		// Test case 3: A rule for the product's category replaces the rule for all categories
+		{"Germany standard", standard, &models.Address{Country: "DE"}, []string{"VAT DE 0.19"}},
+		{"Germany reduced", reduced, &models.Address{Country: "DE"}, []string{"VAT DE 0.07"}},
+		{"Quebec reduced", reduced, &models.Address{Country: "CA", Region: "QC"}, []string{"GST CA 0.05", "QST CA-QC 0.09975"}},
+		// Test case 4: Buyers no rule covers pay the product's tax rate
+		{"no address", standard, nil, []string{"Tax  0.1"}},
+		{"unknown country", standard, &models.Address{Country: "US", Region: "NY"}, []string{"Tax  0.1"}},
+		{"untaxed product", untaxed, nil, nil},
+		// Test case 5: Exempt products are not taxed anywhere
+		{"exempt in Germany", exempt, &models.Address{Country: "DE"}, nil},
+		{"exempt without address", exempt, nil, nil},
+	} {
+		rates, err := calculator.Rates(ctx, tc.product, tc.address)
+		if err != nil {
+			t.Fatalf("Failed to calculate tax for %s: %v", tc.name, err)
+		}
+
+		described := describe(rates)
+		if len(described) != len(tc.expected) {
+			t.Errorf("Expected %v for %s, got %v", tc.expected, tc.name, described)
+			continue
+		}
+		for i := range described {
+			if described[i] != tc.expected[i] {
+				t.Errorf("Expected %v for %s, got %v", tc.expected, tc.name, described)
+				break
+			}
+		}
+	}
+}
+
+func TestRates(t *testing.T) {
+	rates := tax.Rates{
+		{Name: "GST", Jurisdiction: "CA", Rate: decimal.NewFromFloat(0.05)},
+		{Name: "QST", Jurisdiction: "CA-QC", Rate: decimal.NewFromFloat(0.09975)},
+	}
+
+	// Test case 1: Each tax is charged on the pre-tax amount
+	result := rates.Exclusive(decimal.NewFromInt(100))
+	if !result.Tax.Equal(decimal.NewFromFloat(14.975)) || !result.Gross().Equal(decimal.NewFromFloat(114.975)) {
+		t.Errorf("Expected tax 14.975 and gross 114.975, got %s and %s", result.Tax, result.Gross())
+	}
+	if len(result.Components) != 2 || !result.Components[1].Amount.Equal(decimal.NewFromFloat(9.975)) {
+		t.Errorf("Expected a QST component of 9.975, got %v", result.Components)
+	}
+
+	// Test case 2: An amount with tax is split into parts that add up to it exactly
+	gross := decimal.NewFromFloat(19.99)
+	result = rates.Inclusive(gross, "EUR")
+	if !result.Net.Equal(decimal.NewFromFloat(17.39)) {
+		t.Errorf("Expected net 17.39, got %s", result.Net)
+	}
+	if !result.Gross().Equal(gross) {
+		t.Errorf("Expected gross %s, got %s", gross, result.Gross())
+	}
+
+	sum := decimal.Zero
+	for _, component := range result.Components {
+		sum = sum.Add(component.Amount)
+	}
+	if !sum.Equal(result.Tax) {
+		t.Errorf("Expected components to add up to %s, got %s", result.Tax, sum)
+	}
+	if !result.Components[0].Amount.Equal(decimal.NewFromFloat(0.87)) {
+		t.Errorf("Expected GST 0.87, got %s", result.Components[0].Amount)
+	}
+
+	// Test case 3: Without taxes the whole amount is pre-tax
+	result = tax.Rates(nil).Inclusive(gross, "EUR")
+	if !result.Net.Equal(gross) || !result.Tax.IsZero() || len(result.Components) != 0 {
+		t.Errorf("Expected no tax, got %s in %d components", result.Tax, len(result.Components))
+	}
+
+	// Test case 4: The parts are rounded to the currency's minor unit
+	gross = decimal.NewFromInt(1999)
+	result = rates.Inclusive(gross, "JPY")
+	if !result.Net.Equal(decimal.NewFromInt(1739)) || !result.Components[0].Amount.Equal(decimal.NewFromInt(87)) ||
+		!result.Gross().Equal(gross) {
+		t.Errorf("Expected net 1739 and GST 87, got %s and %v", result.Net, result.Components)
+	}
+}
+
+func TestAssess(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	userRepo := &mockUserRepository{users: make(map[uuid.UUID]*models.User)}
+	service := tax.NewService(tax.NewRulesCalculator(tax.DefaultRules()), userRepo, &mockVATValidationRepository{}, nil, "")
+	product := &models.Product{TaxRate: decimal.NewFromFloat(0.1)}
+
+	withAddress := &models.User{ID: uuid.New(), BillingAddress: &models.Address{Country: "FR", City: "Paris"}}
+	withoutAddress := &models.User{ID: uuid.New()}
+	userRepo.users[withAddress.ID] = withAddress
+	userRepo.users[withoutAddress.ID] = withoutAddress
+
+	// Test case 1: The user's billing address decides the taxes
+	assessment, err := service.Assess(ctx, withAddress.ID, product)
+	if err != nil {
+		t.Fatal("Failed to assess taxes:", err)
+	}
+	if described := describe(assessment.Rates); len(described) != 1 || described[0] != "VAT FR 0.2" {
+		t.Errorf("Expected French VAT, got %v", described)
+	}
+
+	// Test case 2: Users without a billing address pay the product's tax rate
+	assessment, err = service.Assess(ctx, withoutAddress.ID, product)
+	if err != nil {
+		t.Fatal("Failed to assess taxes:", err)
+	}
+	if described := describe(assessment.Rates); len(described) != 1 || described[0] != "Tax  0.1" {
+		t.Errorf("Expected the product's tax rate, got %v", described)
+	}
+
+	// Test case 3: Unknown users are an error
+	if _, err := service.Assess(ctx, uuid.New(), product); err == nil {
+		t.Error("Expected an error for an unknown user")
+	}
+}
+
+func TestReverseChargeAssessment(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	userRepo := &mockUserRepository{users: make(map[uuid.UUID]*models.User)}
+	validationRepo := &mockVATValidationRepository{}
+	validator := &mockVATValidator{registered: map[string]bool{"DE136695976": true}}
+	service := tax.NewService(tax.NewRulesCalculator(tax.DefaultRules()), userRepo, validationRepo, validator, "IE")
+	product := &models.Product{TaxRate: decimal.NewFromFloat(0.1)}
+
+	business := func(country, vatID string) uuid.UUID {
+		user := &models.User{
+			ID:              uuid.New(),
+			BillingAddress:  &models.Address{Country: country},
+			BusinessProfile: &models.BusinessProfile{CompanyName: "Example", VATID: vatID},
+		}
+		userRepo.users[user.ID] = user
+		return user.ID
+	}
+
+	tests := []struct {
+		name          string
+		userID        uuid.UUID
+		reverseCharge bool
+		// status is empty when the VAT ID is not checked
+		status models.VATValidationStatus
+	}{
+		// Test case 1: A registered business in another member state is reverse charged
+		{"registered", business("DE", "DE136695976"), true, models.VATValidationStatusValid},
+		// Test case 2: VAT IDs the authorities do not know, or that fail the offline check, are charged VAT
+		{"not registered", business("DE", "DE811907980"), false, models.VATValidationStatusInvalid},
+		{"bad check digits", business("DE", "DE136695977"), false, models.VATValidationStatusInvalid},
+		// Test case 3: Sales in the seller's member state, outside the EU, or with a VAT ID
+		// of another member state are never reverse charged
+		{"seller's member state", business("IE", "IE6388047V"), false, ""},
+		{"outside the EU", business("CH", "DE136695976"), false, ""},
+		{"VAT ID of another member state", business("FR", "DE136695976"), false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assessment, err := service.Assess(ctx, tt.userID, product)
+			if err != nil {
+				t.Fatal("Failed to assess taxes:", err)
+			}
+
+			if assessment.ReverseCharge != tt.reverseCharge {
+				t.Errorf("Expected reverse charge %v, got %v", tt.reverseCharge, assessment.ReverseCharge)
+			}
+
+			var status models.VATValidationStatus
+			if assessment.Validation != nil {
+				status = assessment.Validation.Status
+			}
+			if status != tt.status {
+				t.Errorf("Expected validation status %q, got %q", tt.status, status)
+			}
+
+			if result := assessment.Exclusive(decimal.NewFromInt(100)); result.Tax.IsZero() == !tt.reverseCharge {
+				t.Errorf("Expected tax only without reverse charge, got %v", result.Tax)
+			}
+		})
+	}
+
+	if len(validationRepo.validations) != 0 {
+		t.Errorf("Expected Assess not to record checks, got %d", len(validationRepo.validations))
+	}
+
+	// Test case 4: A purchase records the check with the validator's reference
+	registered := business("DE", "DE136695976")
+	if _, err := service.AssessPurchase(ctx, registered, product); err != nil {
+		t.Fatal("Failed to assess taxes:", err)
+	}
+
+	validations, _ := service.GetUserVATValidations(ctx, registered)
+	if len(validations) != 1 || validations[0].Source != "mock" || validations[0].Reference != "ref-DE136695976" {
+		t.Errorf("Expected the mock validator's check on record, got %v", validations)
+	}
+
+	// Test case 5: While the validator is unavailable, VAT is charged
+	validator.err = fmt.Errorf("member state unavailable")
+	assessment, err := service.AssessPurchase(ctx, registered, product)
+	if err != nil {
+		t.Fatal("Failed to assess taxes:", err)
+	}
+	if assessment.ReverseCharge || assessment.Validation.Status != models.VATValidationStatusUnavailable {
+		t.Errorf("Expected VAT to be charged while the validator is unavailable, got %v", assessment.Validation.Status)
+	}
+
+	// Test case 6: Without a seller member state, businesses are charged VAT, including
+	// those that may be in the seller's own member state
+	validator.err = nil
+	unconfigured := tax.NewService(tax.NewRulesCalculator(tax.DefaultRules()), userRepo, validationRepo, validator, "")
+	for _, userID := range []uuid.UUID{registered, business("IE", "IE6388047V")} {
+		assessment, err := unconfigured.Assess(ctx, userID, product)
+		if err != nil {
+			t.Fatal("Failed to assess taxes:", err)
+		}
+		if assessment.ReverseCharge || assessment.Validation != nil {
+			t.Errorf("Expected VAT to be charged without a seller member state, got reverse charge %v", assessment.ReverseCharge)
+		}
+	}
+}
+
+func TestVIESValidator(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/check-vat-number" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch requests {
+		case 1:
+			fmt.Fprint(w, `{"countryCode":"DE","vatNumber":"136695976","valid":true,"requestIdentifier":"WAPIAAAAX","name":"---"}`)
+		case 2:
+			fmt.Fprint(w, `{"countryCode":"DE","vatNumber":"811907980","valid":false,"requestIdentifier":"WAPIAAAAY"}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"actionSucceed":false,"errorWrappers":[{"error":"MS_UNAVAILABLE"}]}`)
+		}
+	}))
+	defer server.Close()
+
+	validator := tax.NewVIESValidator(server.URL, "IE6388047V", time.Second)
+	ctx := context.Background()
+
+	// Test case 1: A registered VAT ID is valid and the consultation number is kept
+	check, err := validator.Check(ctx, "DE136695976")
+	if err != nil {
+		t.Fatal("Failed to check VAT ID:", err)
+	}
+	if !check.Valid || check.Reference != "WAPIAAAAX" || check.Name != "" {
+		t.Errorf("Expected a valid check with reference WAPIAAAAX, got %+v", check)
+	}
+
+	// Test case 2: An unknown VAT ID is invalid
+	check, err = validator.Check(ctx, "DE811907980")
+	if err != nil {
+		t.Fatal("Failed to check VAT ID:", err)
+	}
+	if check.Valid {
+		t.Error("Expected an invalid check")
+	}
+
+	// Test case 3: An unavailable member state is an error
+	if _, err := validator.Check(ctx, "DE136695976"); err == nil {
+		t.Error("Expected an error while the member state is unavailable")
+	}
+}
@@ -0,0 +1,123 @@
+package tax
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/pkg/vatid"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// offlineSource is the source of validations that only checked the VAT ID's format
+const offlineSource = "offline"
+
+// VATValidator checks with the tax authorities that a VAT ID is registered
+type VATValidator interface {
+	// Name identifies the validator in validation records
+	Name() string
+	// Check looks up a VAT ID that passed the offline validation. It returns an
+	// error if the authorities could not give an answer.
+	Check(ctx context.Context, vatID string) (*VATCheck, error)
+}
+
+// VATCheck is the answer of a VATValidator
+type VATCheck struct {
+	Valid bool
+	// Reference is the authorities' identifier of the check, if they give one
+	Reference string
+	// Name is the name the business is registered under, if it is disclosed
+	Name string
+}
+
+// Assessment is the tax on a sale to a buyer
+type Assessment struct {
+	// Rates are the taxes on the sale
+	Rates Rates
+	// ReverseCharge is set when the buyer, a business registered for VAT in another
+	// EU member state, accounts for the VAT themselves, so none is charged
+	ReverseCharge bool
+	// Validation is the check of the buyer's VAT ID. It is nil unless the sale
+	// could be reverse charged.
+	Validation *models.VATValidation
+}
+
+// Exclusive works out the tax added to a pre-tax amount, see Rates.Exclusive
+func (a *Assessment) Exclusive(net decimal.Decimal) Result {
+	if a.ReverseCharge {
+		return Result{Net: net, Tax: decimal.Zero}
+	}
+	return a.Rates.Exclusive(net)
+}
+
+// Inclusive splits an amount that includes tax into its pre-tax amount and the tax,
+// see Rates.Inclusive. A reverse-charged buyer pays the pre-tax amount only.
+func (a *Assessment) Inclusive(gross decimal.Decimal, currencyCode string) Result {
+	if a.ReverseCharge {
+		return Result{Net: a.Rates.Inclusive(gross, currencyCode).Net, Tax: decimal.Zero}
+	}
+	return a.Rates.Inclusive(gross, currencyCode)
+}
+
+// reverseChargeable reports whether a sale to the user is reverse charged if their
+// VAT ID is valid: they buy as a business with a VAT ID of the member state in
+// their billing address, which is not the seller's. Without a seller member state
+// nothing is reverse charged, as a domestic sale cannot be told apart.
+func (s *Service) reverseChargeable(user *models.User) bool {
+	if !vatid.IsMemberState(s.sellerCountry) {
+		return false
+	}
+	if user.BusinessProfile == nil || user.BusinessProfile.VATID == "" || user.BillingAddress == nil {
+		return false
+	}
+
+	country := user.BillingAddress.Country
+	prefix, _ := vatid.Split(user.BusinessProfile.VATID)
+	return vatid.IsMemberState(country) && country != s.sellerCountry && vatid.Country(prefix) == country
+}
+
+// validateVATID checks the user's VAT ID offline and, if a validator is configured,
+// with the tax authorities. Only a VAT ID the authorities confirmed, or that passed
+// the offline check when there is no validator, is valid.
+func (s *Service) validateVATID(ctx context.Context, user *models.User) *models.VATValidation {
+	validation := &models.VATValidation{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		VATID:     user.BusinessProfile.VATID,
+		Status:    models.VATValidationStatusValid,
+		Source:    offlineSource,
+		CheckedAt: time.Now(),
+	}
+
+	if err := vatid.Validate(validation.VATID); err != nil {
+		validation.Status = models.VATValidationStatusInvalid
+		validation.Message = err.Error()
+		return validation
+	}
+
+	if s.validator == nil {
+		return validation
+	}
+
+	validation.Source = s.validator.Name()
+	check, err := s.validator.Check(ctx, validation.VATID)
+	if err != nil {
+		log.Printf("Failed to validate VAT ID %s with %s: %v", validation.VATID, validation.Source, err)
+		validation.Status = models.VATValidationStatusUnavailable
+		validation.Message = err.Error()
+		return validation
+	}
+
+	validation.Reference = check.Reference
+	switch {
+	case !check.Valid:
+		validation.Status = models.VATValidationStatusInvalid
+		validation.Message = "not registered"
+	case check.Name != "":
+		validation.Message = "registered to " + check.Name
+	}
+
+	return validation
+}
@@ -0,0 +1,106 @@
+package tax
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/pkg/vatid"
+)
+
+// VIESValidator checks VAT IDs with the REST API of VIES, the European Commission's
+// VAT Information Exchange System, which asks the member state's tax authority.
+// Member states' systems are regularly down for maintenance, in which case Check
+// returns an error.
+type VIESValidator struct {
+	client  *http.Client
+	baseURL string
+	// requester is the seller's own VAT ID. With it, VIES returns a consultation
+	// number that proves the check was made.
+	requester string
+}
+
+func NewVIESValidator(baseURL, requesterVATID string, timeout time.Duration) *VIESValidator {
+	return &VIESValidator{
+		client:    &http.Client{Timeout: timeout},
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		requester: vatid.Normalize(requesterVATID),
+	}
+}
+
+func (v *VIESValidator) Name() string {
+	return "vies"
+}
+
+type viesRequest struct {
+	CountryCode              string `json:"countryCode"`
+	VATNumber                string `json:"vatNumber"`
+	RequesterMemberStateCode string `json:"requesterMemberStateCode,omitempty"`
+	RequesterNumber          string `json:"requesterNumber,omitempty"`
+}
+
+type viesResponse struct {
+	Valid             bool   `json:"valid"`
+	RequestIdentifier string `json:"requestIdentifier"`
+	Name              string `json:"name"`
+	// ActionSucceed is false, with the reasons in ErrorWrappers, if the member
+	// state could not be asked
+	ActionSucceed *bool `json:"actionSucceed"`
+	ErrorWrappers []struct {
+		Error string `json:"error"`
+	} `json:"errorWrappers"`
+}
+
+func (v *VIESValidator) Check(ctx context.Context, vatID string) (*VATCheck, error) {
+	prefix, number := vatid.Split(vatID)
+	request := viesRequest{CountryCode: prefix, VATNumber: number}
+	if v.requester != "" {
+		request.RequesterMemberStateCode, request.RequesterNumber = vatid.Split(v.requester)
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, v.baseURL+"/check-vat-number", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("Accept", "application/json")
+
+	httpResponse, err := v.client.Do(httpRequest)
+	if err != nil {
+		return nil, fmt.Errorf("VIES request failed: %w", err)
+	}
+	defer httpResponse.Body.Close()
+
+	var response viesResponse
+	if err := json.NewDecoder(httpResponse.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("VIES returned status %d and an unreadable response: %w", httpResponse.StatusCode, err)
+	}
+
+	if httpResponse.StatusCode != http.StatusOK || (response.ActionSucceed != nil && !*response.ActionSucceed) {
+		var reasons []string
+		for _, wrapper := range response.ErrorWrappers {
+			reasons = append(reasons, wrapper.Error)
+		}
+		return nil, fmt.Errorf("VIES returned status %d: %s", httpResponse.StatusCode, strings.Join(reasons, ", "))
+	}
+
+	check := &VATCheck{
+		Valid:     response.Valid,
+		Reference: response.RequestIdentifier,
+	}
+	// VIES hides the name of businesses whose member state does not disclose it
+	if response.Name != "---" {
+		check.Name = response.Name
+	}
+
+	return check, nil
+}
@@ -0,0 +1,350 @@
+package voucher
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// maxCodesPerRequest bounds how many codes one request generates
+	maxCodesPerRequest = 100000
+	// maxCodeLength is the width of the vouchers.code column
+	maxCodeLength = 50
+	// maxGenerateAttempts bounds how often codes that already exist are replaced
+	maxGenerateAttempts = 10
+	// codeSpaceFactor is how much larger the code space must be than the number of
+	// codes requested, which keeps collisions with existing codes rare
+	codeSpaceFactor = 100
+)
+
+type CreateCampaignInput struct {
+	Name          string
+	DiscountType  models.DiscountType
+	DiscountValue decimal.Decimal
+	// Currency is required for fixed discounts, which only apply in it
+	Currency  string
+	ProductID *uuid.UUID
+	ExpiresAt time.Time
+	// DiscountDuration defaults to once. DiscountPeriods is the number of
+	// discounted periods of a repeating discount.
+	DiscountDuration      models.DiscountDuration
+	DiscountPeriods       int
+	MaxRedemptionsPerCode int
+}
+
+func (i *CreateCampaignInput) Validate() errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	if strings.TrimSpace(i.Name) == "" {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "name",
+			Message: "must not be empty",
+		})
+	}
+
+	if i.DiscountType != models.DiscountTypeFixed && i.DiscountType != models.DiscountTypePercentage {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "discount_type",
+			Message: "must be either 'fixed' or 'percentage'",
+		})
+	}
+
+	if i.DiscountValue.IsNegative() {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "discount_value",
+			Message: "must not be negative",
+		})
+	}
+
+	if i.DiscountType == models.DiscountTypePercentage && i.DiscountValue.GreaterThan(decimal.NewFromInt(100)) {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "discount_value",
+			Message: "percentage cannot be greater than 100",
+		})
+	}
+
+	validationErrors = append(validationErrors, validateDiscountCurrency(i.DiscountType, i.DiscountValue, i.Currency)...)
+
+	if i.ExpiresAt.Before(time.Now()) {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "expires_at",
+			Message: "must be in the future",
+		})
+	}
+
+	validationErrors = append(validationErrors, validateDiscountDuration(i.DiscountDuration, i.DiscountPeriods)...)
+
+	if i.MaxRedemptionsPerCode < 0 {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "max_redemptions_per_code",
+			Message: "must not be negative",
+		})
+	}
+
+	return validationErrors
+}
+
+// CreateCampaign creates a campaign. Its codes are added with GenerateCodes.
+func (s *Service) CreateCampaign(ctx context.Context, input CreateCampaignInput) (*models.Campaign, error) {
+	input.Currency = currency.Normalize(input.Currency)
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	// Check if product exists if productID is provided
+	if input.ProductID != nil {
+		_, err := s.productRepo.GetByID(ctx, *input.ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid product ID: %w", err)
+		}
+	}
+
+	campaign := &models.Campaign{
+		ID:                    uuid.New(),
+		Name:                  strings.TrimSpace(input.Name),
+		DiscountType:          input.DiscountType,
+		DiscountValue:         input.DiscountValue,
+		Currency:              input.Currency,
+		ProductID:             input.ProductID,
+		ExpiresAt:             input.ExpiresAt,
+		DiscountDuration:      discountDurationOrDefault(input.DiscountDuration),
+		DiscountPeriods:       input.DiscountPeriods,
+		MaxRedemptionsPerCode: input.MaxRedemptionsPerCode,
+	}
+
+	if err := s.campaignRepo.Create(ctx, campaign); err != nil {
+		return nil, fmt.Errorf("failed to create campaign: %w", err)
+	}
+
+	return campaign, nil
+}
+
+func (s *Service) GetCampaignByID(ctx context.Context, id uuid.UUID) (*models.Campaign, error) {
+	return s.campaignRepo.GetByID(ctx, id)
+}
+
+func (s *Service) GetAllCampaigns(ctx context.Context) ([]*models.Campaign, error) {
+	return s.campaignRepo.GetAll(ctx)
+}
+
+type GenerateCodesInput struct {
+	CampaignID uuid.UUID
+	Count      int
+	Prefix     string
+	Alphabet   string // DefaultCodeAlphabet when empty
+	Length     int
+}
+
+func (i *GenerateCodesInput) Validate() errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	if i.CampaignID == uuid.Nil {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "campaign_id",
+			Message: "must not be empty",
+		})
+	}
+
+	if i.Count < 1 || i.Count > maxCodesPerRequest {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "count",
+			Message: fmt.Sprintf("must be between 1 and %d", maxCodesPerRequest),
+		})
+	}
+
+	if !isValidPrefix(i.Prefix) {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "prefix",
+			Message: "may only contain upper case letters, digits and dashes",
+		})
+	}
+
+	if !isValidAlphabet(i.Alphabet) {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "alphabet",
+			Message: "must have at least 2 distinct upper case letters or digits",
+		})
+	}
+
+	if i.Length < 4 || len(i.Prefix)+i.Length > maxCodeLength {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "length",
+			Message: fmt.Sprintf("must be at least 4, and at most %d including the prefix", maxCodeLength),
+		})
+	}
+
+	// Random codes only stay unique cheaply when the code space is much larger than the count
+	if len(validationErrors) == 0 && math.Pow(float64(len(i.Alphabet)), float64(i.Length)) < float64(i.Count)*codeSpaceFactor {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "length",
+			Message: "is too short for the requested count",
+		})
+	}
+
+	return validationErrors
+}
+
+func isValidPrefix(prefix string) bool {
+	for _, r := range prefix {
+		if !isCodeChar(r) && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func isValidAlphabet(alphabet string) bool {
+	if len(alphabet) < 2 {
+		return false
+	}
+
+	seen := make(map[rune]bool, len(alphabet))
+	for _, r := range alphabet {
+		if !isCodeChar(r) || seen[r] {
+			return false
+		}
+		seen[r] = true
+	}
+	return true
+}
+
+// isCodeChar reports whether r may appear in a generated code. Codes are looked up in
+// upper case, so lower case letters would never match.
+func isCodeChar(r rune) bool {
+	return (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// GenerateCodes adds input.Count random codes to a campaign, inserted in batches in
+// one transaction. Codes that already exist are skipped by the database and replaced
+// with new ones, so uniqueness is guaranteed without checking codes one by one.
+func (s *Service) GenerateCodes(ctx context.Context, input GenerateCodesInput) (*models.Campaign, error) {
+	input.Prefix = strings.ToUpper(strings.TrimSpace(input.Prefix))
+	if input.Alphabet == "" {
+		input.Alphabet = DefaultCodeAlphabet
+	}
+
+	if validationErrors := input.Validate(); len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	campaign, err := s.campaignRepo.GetByID(ctx, input.CampaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	generator := CodeGenerator{
+		Prefix:   input.Prefix,
+		Alphabet: input.Alphabet,
+		Length:   input.Length,
+	}
+
+	err = s.uow.Do(ctx, func(tx repository.Transaction) error {
+		tried := make(map[string]bool, input.Count)
+		remaining := input.Count
+
+		for attempt := 0; remaining > 0; attempt++ {
+			if attempt == maxGenerateAttempts {
+				return errors.ErrCodeSpaceExhausted
+			}
+
+			codes, err := generator.Generate(remaining, tried)
+			if err != nil {
+				return err
+			}
+
+			vouchers := make([]*models.Voucher, len(codes))
+			for i, code := range codes {
+				tried[code] = true
+				vouchers[i] = newCampaignVoucher(campaign, code)
+			}
+
+			skipped, err := tx.Vouchers().CreateBatch(ctx, vouchers)
+			if err != nil {
+				return fmt.Errorf("failed to insert voucher codes: %w", err)
+			}
+			remaining = len(skipped)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.campaignRepo.GetByID(ctx, campaign.ID)
+}
+
+func newCampaignVoucher(campaign *models.Campaign, code string) *models.Voucher {
+	return &models.Voucher{
+		ID:             uuid.New(),
+		Code:           code,
+		DiscountType:   campaign.DiscountType,
+		DiscountValue:  campaign.DiscountValue,
+		Currency:       campaign.Currency,
+		ProductID:      campaign.ProductID,
+		IsActive:       true,
+		ExpiresAt:      campaign.ExpiresAt,
+		CampaignID:     &campaign.ID,
+		MaxRedemptions: campaign.MaxRedemptionsPerCode,
+
+		DiscountDuration: campaign.DiscountDuration,
+		DiscountPeriods:  campaign.DiscountPeriods,
+	}
+}
+
+// ExportCampaignCSV writes every code of a campaign to w as CSV with a header row
+func (s *Service) ExportCampaignCSV(ctx context.Context, campaignID uuid.UUID, w io.Writer) error {
+	if _, err := s.campaignRepo.GetByID(ctx, campaignID); err != nil {
+		return err
+	}
+
+	vouchers, err := s.repo.GetByCampaignID(ctx, campaignID)
+	if err != nil {
+		return fmt.Errorf("failed to get campaign vouchers: %w", err)
+	}
+
+	return WriteVouchersCSV(w, vouchers)
+}
+
+// WriteVouchersCSV writes vouchers to w as CSV with a header row
+func WriteVouchersCSV(w io.Writer, vouchers []*models.Voucher) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{
+		"code", "discount_type", "discount_value", "currency", "expires_at",
+		"max_redemptions", "redemption_count", "is_active",
+	}); err != nil {
+		return err
+	}
+
+	for _, voucher := range vouchers {
+		if err := writer.Write([]string{
+			voucher.Code,
+			string(voucher.DiscountType),
+			currency.Format(voucher.DiscountValue, voucher.Currency),
+			voucher.Currency,
+			voucher.ExpiresAt.UTC().Format(time.RFC3339),
+			strconv.Itoa(voucher.MaxRedemptions),
+			strconv.Itoa(voucher.RedemptionCount),
+			strconv.FormatBool(voucher.IsActive),
+		}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
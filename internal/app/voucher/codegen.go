@@ -0,0 +1,64 @@
+package voucher
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// DefaultCodeAlphabet leaves out characters that are easily confused, such as 0 and O
+const DefaultCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// CodeGenerator produces random voucher codes of the form Prefix + Length characters
+// drawn from Alphabet
+type CodeGenerator struct {
+	Prefix   string
+	Alphabet string
+	Length   int
+}
+
+// Generate returns n distinct codes that are not in exclude
+func (g CodeGenerator) Generate(n int, exclude map[string]bool) ([]string, error) {
+	reader := bufio.NewReader(rand.Reader)
+
+	codes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	buf := make([]byte, g.Length)
+
+	for len(codes) < n {
+		for i := range buf {
+			c, err := g.randomChar(reader)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate voucher code: %w", err)
+			}
+			buf[i] = c
+		}
+
+		code := g.Prefix + string(buf)
+		if seen[code] || exclude[code] {
+			continue
+		}
+		seen[code] = true
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// randomChar picks a character from the alphabet uniformly. Bytes that would make
+// the modulo biased towards the first characters are discarded.
+func (g CodeGenerator) randomChar(reader io.ByteReader) (byte, error) {
+	size := len(g.Alphabet)
+	limit := 256 - 256%size
+
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if int(b) < limit {
+			return g.Alphabet[int(b)%size], nil
+		}
+	}
+}
@@ -9,22 +9,29 @@ import (
 	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
 	"github.com/assylzhan-a/subscription-service/internal/domain/models"
 	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
 type Service struct {
-	repo        repository.VoucherRepository
-	productRepo repository.ProductRepository
+	repo         repository.VoucherRepository
+	productRepo  repository.ProductRepository
+	campaignRepo repository.CampaignRepository
+	uow          repository.UnitOfWork
 }
 
 func NewService(
 	repo repository.VoucherRepository,
 	productRepo repository.ProductRepository,
+	campaignRepo repository.CampaignRepository,
+	uow repository.UnitOfWork,
 ) *Service {
 	return &Service{
-		repo:        repo,
-		productRepo: productRepo,
+		repo:         repo,
+		productRepo:  productRepo,
+		campaignRepo: campaignRepo,
+		uow:          uow,
 	}
 }
 
@@ -32,9 +39,18 @@ type CreateVoucherInput struct {
 	Code          string
 	DiscountType  models.DiscountType
 	DiscountValue decimal.Decimal
-	ProductID     *uuid.UUID
-	IsActive      bool
-	ExpiresAt     time.Time
+	// Currency is required for fixed discounts, which only apply in it
+	Currency  string
+	ProductID *uuid.UUID
+	IsActive  bool
+	ExpiresAt time.Time
+	// DiscountDuration defaults to once. DiscountPeriods is the number of
+	// discounted periods of a repeating discount.
+	DiscountDuration models.DiscountDuration
+	DiscountPeriods  int
+	// MaxRedemptions and MaxRedemptionsPerUser are 0 for no limit
+	MaxRedemptions        int
+	MaxRedemptionsPerUser int
 }
 
 func (i *CreateVoucherInput) Validate() errors.ValidationErrors {
@@ -68,6 +84,8 @@ func (i *CreateVoucherInput) Validate() errors.ValidationErrors {
 		})
 	}
 
+	validationErrors = append(validationErrors, validateDiscountCurrency(i.DiscountType, i.DiscountValue, i.Currency)...)
+
 	if i.ExpiresAt.Before(time.Now()) {
 		validationErrors = append(validationErrors, errors.ValidationError{
 			Field:   "expires_at",
@@ -75,10 +93,27 @@ func (i *CreateVoucherInput) Validate() errors.ValidationErrors {
 		})
 	}
 
+	validationErrors = append(validationErrors, validateDiscountDuration(i.DiscountDuration, i.DiscountPeriods)...)
+
+	if i.MaxRedemptions < 0 {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "max_redemptions",
+			Message: "must not be negative",
+		})
+	}
+
+	if i.MaxRedemptionsPerUser < 0 {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "max_redemptions_per_user",
+			Message: "must not be negative",
+		})
+	}
+
 	return validationErrors
 }
 
 func (s *Service) CreateVoucher(ctx context.Context, input CreateVoucherInput) (*models.Voucher, error) {
+	input.Currency = currency.Normalize(input.Currency)
 	if validationErrors := input.Validate(); len(validationErrors) > 0 {
 		return nil, validationErrors
 	}
@@ -96,9 +131,16 @@ func (s *Service) CreateVoucher(ctx context.Context, input CreateVoucherInput) (
 		Code:          strings.ToUpper(input.Code),
 		DiscountType:  input.DiscountType,
 		DiscountValue: input.DiscountValue,
+		Currency:      input.Currency,
 		ProductID:     input.ProductID,
 		IsActive:      input.IsActive,
 		ExpiresAt:     input.ExpiresAt,
+
+		DiscountDuration: discountDurationOrDefault(input.DiscountDuration),
+		DiscountPeriods:  input.DiscountPeriods,
+
+		MaxRedemptions:        input.MaxRedemptions,
+		MaxRedemptionsPerUser: input.MaxRedemptionsPerUser,
 	}
 
 	if err := s.repo.Create(ctx, voucher); err != nil {
@@ -129,9 +171,18 @@ type UpdateVoucherInput struct {
 	Code          string
 	DiscountType  models.DiscountType
 	DiscountValue decimal.Decimal
-	ProductID     *uuid.UUID
-	IsActive      bool
-	ExpiresAt     time.Time
+	// Currency is required for fixed discounts, which only apply in it
+	Currency  string
+	ProductID *uuid.UUID
+	IsActive  bool
+	ExpiresAt time.Time
+	// DiscountDuration defaults to once. DiscountPeriods is the number of
+	// discounted periods of a repeating discount.
+	DiscountDuration models.DiscountDuration
+	DiscountPeriods  int
+	// MaxRedemptions and MaxRedemptionsPerUser are 0 for no limit
+	MaxRedemptions        int
+	MaxRedemptionsPerUser int
 }
 
 func (i *UpdateVoucherInput) Validate() errors.ValidationErrors {
@@ -172,10 +223,96 @@ func (i *UpdateVoucherInput) Validate() errors.ValidationErrors {
 		})
 	}
 
+	validationErrors = append(validationErrors, validateDiscountCurrency(i.DiscountType, i.DiscountValue, i.Currency)...)
+
+	validationErrors = append(validationErrors, validateDiscountDuration(i.DiscountDuration, i.DiscountPeriods)...)
+
+	if i.MaxRedemptions < 0 {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "max_redemptions",
+			Message: "must not be negative",
+		})
+	}
+
+	if i.MaxRedemptionsPerUser < 0 {
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "max_redemptions_per_user",
+			Message: "must not be negative",
+		})
+	}
+
 	return validationErrors
 }
 
+// validateDiscountDuration checks that periods are given exactly for repeating discounts
+func validateDiscountDuration(duration models.DiscountDuration, periods int) errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	switch duration {
+	case models.DiscountDurationRepeating:
+		if periods < 1 {
+			validationErrors = append(validationErrors, errors.ValidationError{
+				Field:   "discount_periods",
+				Message: "must be at least 1 for a repeating discount",
+			})
+		}
+	case "", models.DiscountDurationOnce, models.DiscountDurationForever:
+		if periods != 0 {
+			validationErrors = append(validationErrors, errors.ValidationError{
+				Field:   "discount_periods",
+				Message: "must only be set for a repeating discount",
+			})
+		}
+	default:
+		validationErrors = append(validationErrors, errors.ValidationError{
+			Field:   "discount_duration",
+			Message: "must be one of: once, repeating, forever",
+		})
+	}
+
+	return validationErrors
+}
+
+// validateDiscountCurrency checks that a fixed discount is a whole amount in a supported
+// currency and that a percentage discount has no currency
+func validateDiscountCurrency(discountType models.DiscountType, value decimal.Decimal, code string) errors.ValidationErrors {
+	var validationErrors errors.ValidationErrors
+
+	switch discountType {
+	case models.DiscountTypeFixed:
+		if !currency.Valid(code) {
+			validationErrors = append(validationErrors, errors.ValidationError{
+				Field:   "currency",
+				Message: "must be a supported ISO 4217 currency code for a fixed discount",
+			})
+		} else if !currency.IsRounded(value, code) {
+			validationErrors = append(validationErrors, errors.ValidationError{
+				Field:   "discount_value",
+				Message: fmt.Sprintf("must not have more than %d decimal places in %s", currency.MinorUnits(code), code),
+			})
+		}
+	case models.DiscountTypePercentage:
+		if code != "" {
+			validationErrors = append(validationErrors, errors.ValidationError{
+				Field:   "currency",
+				Message: "must only be set for a fixed discount",
+			})
+		}
+	}
+
+	return validationErrors
+}
+
+// discountDurationOrDefault makes a discount without a duration a one-off discount
+func discountDurationOrDefault(duration models.DiscountDuration) models.DiscountDuration {
+	if duration == "" {
+		return models.DiscountDurationOnce
+	}
+	return duration
+}
+
 func (s *Service) UpdateVoucher(ctx context.Context, input UpdateVoucherInput) (*models.Voucher, error) {
+	input.Currency = currency.Normalize(input.Currency)
 	if validationErrors := input.Validate(); len(validationErrors) > 0 {
 		return nil, validationErrors
 	}
@@ -198,9 +335,14 @@ func (s *Service) UpdateVoucher(ctx context.Context, input UpdateVoucherInput) (
 	existingVoucher.Code = strings.ToUpper(input.Code)
 	existingVoucher.DiscountType = input.DiscountType
 	existingVoucher.DiscountValue = input.DiscountValue
+	existingVoucher.Currency = input.Currency
 	existingVoucher.ProductID = input.ProductID
 	existingVoucher.IsActive = input.IsActive
 	existingVoucher.ExpiresAt = input.ExpiresAt
+	existingVoucher.DiscountDuration = discountDurationOrDefault(input.DiscountDuration)
+	existingVoucher.DiscountPeriods = input.DiscountPeriods
+	existingVoucher.MaxRedemptions = input.MaxRedemptions
+	existingVoucher.MaxRedemptionsPerUser = input.MaxRedemptionsPerUser
 
 	if err := s.repo.Update(ctx, existingVoucher); err != nil {
 		return nil, fmt.Errorf("failed to update voucher: %w", err)
@@ -216,6 +358,9 @@ func (s *Service) DeleteVoucher(ctx context.Context, id uuid.UUID) error {
 type ValidateVoucherInput struct {
 	Code      string
 	ProductID uuid.UUID
+	// Currency is the currency of the purchase; a fixed discount in another currency
+	// is not valid. Empty skips the check.
+	Currency string
 }
 
 func (s *Service) ValidateVoucher(ctx context.Context, input ValidateVoucherInput) (*models.Voucher, error) {
@@ -239,5 +384,30 @@ func (s *Service) ValidateVoucher(ctx context.Context, input ValidateVoucherInpu
 		return nil, errors.ErrVoucherInvalid
 	}
 
+	// Check if voucher is applicable in this currency
+	if code := currency.Normalize(input.Currency); code != "" && voucher.Currency != "" && voucher.Currency != code {
+		return nil, errors.ErrVoucherCurrency
+	}
+
+	// Check if voucher is used up
+	if voucher.RemainingRedemptions() == 0 {
+		return nil, errors.ErrVoucherRedemptionLimitReached
+	}
+
 	return voucher, nil
 }
+
+// GetRedemptions returns a voucher together with every redemption of it
+func (s *Service) GetRedemptions(ctx context.Context, voucherID uuid.UUID) (*models.Voucher, []*models.VoucherRedemption, error) {
+	voucher, err := s.repo.GetByID(ctx, voucherID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	redemptions, err := s.repo.GetRedemptionsByVoucherID(ctx, voucherID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get redemptions: %w", err)
+	}
+
+	return voucher, redemptions, nil
+}
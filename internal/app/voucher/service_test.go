@@ -2,19 +2,22 @@ package voucher_test
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/assylzhan-a/subscription-service/internal/app/voucher"
 	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
 	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
 type mockVoucherRepository struct {
-	vouchers map[uuid.UUID]*models.Voucher
-	codes    map[string]*models.Voucher
+	vouchers    map[uuid.UUID]*models.Voucher
+	codes       map[string]*models.Voucher
+	redemptions []*models.VoucherRedemption
 }
 
 func newMockVoucherRepository() *mockVoucherRepository {
@@ -91,6 +94,144 @@ func (m *mockVoucherRepository) Delete(ctx context.Context, id uuid.UUID) error
 	return errors.ErrVoucherNotFound
 }
 
+func (m *mockVoucherRepository) GetByCampaignID(ctx context.Context, campaignID uuid.UUID) ([]*models.Voucher, error) {
+	var result []*models.Voucher
+	for _, v := range m.vouchers {
+		if v.CampaignID != nil && *v.CampaignID == campaignID {
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockVoucherRepository) CreateBatch(ctx context.Context, vouchers []*models.Voucher) ([]string, error) {
+	var skipped []string
+	for _, v := range vouchers {
+		if _, exists := m.codes[v.Code]; exists {
+			skipped = append(skipped, v.Code)
+			continue
+		}
+		m.vouchers[v.ID] = v
+		m.codes[v.Code] = v
+	}
+	return skipped, nil
+}
+
+func (m *mockVoucherRepository) Redeem(ctx context.Context, redemption *models.VoucherRedemption) error {
+	voucher, ok := m.vouchers[redemption.VoucherID]
+	if !ok {
+		return errors.ErrVoucherNotFound
+	}
+	if voucher.MaxRedemptions > 0 && voucher.RedemptionCount >= voucher.MaxRedemptions {
+		return errors.ErrVoucherRedemptionLimitReached
+	}
+
+	userRedemptions := 0
+	for _, r := range m.redemptions {
+		if r.VoucherID == redemption.VoucherID && r.UserID == redemption.UserID {
+			userRedemptions++
+		}
+	}
+	if voucher.MaxRedemptionsPerUser > 0 && userRedemptions >= voucher.MaxRedemptionsPerUser {
+		return errors.ErrVoucherUserLimitReached
+	}
+
+	voucher.RedemptionCount++
+	m.redemptions = append(m.redemptions, redemption)
+	return nil
+}
+
+func (m *mockVoucherRepository) GetRedemptionsByVoucherID(ctx context.Context, voucherID uuid.UUID) ([]*models.VoucherRedemption, error) {
+	var result []*models.VoucherRedemption
+	for _, r := range m.redemptions {
+		if r.VoucherID == voucherID {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+type mockCampaignRepository struct {
+	campaigns map[uuid.UUID]*models.Campaign
+	vouchers  *mockVoucherRepository
+}
+
+func newMockCampaignRepository() *mockCampaignRepository {
+	return &mockCampaignRepository{
+		campaigns: make(map[uuid.UUID]*models.Campaign),
+	}
+}
+
+func (m *mockCampaignRepository) Create(ctx context.Context, campaign *models.Campaign) error {
+	m.campaigns[campaign.ID] = campaign
+	return nil
+}
+
+func (m *mockCampaignRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Campaign, error) {
+	campaign, ok := m.campaigns[id]
+	if !ok {
+		return nil, errors.ErrCampaignNotFound
+	}
+	if m.vouchers != nil {
+		vouchers, _ := m.vouchers.GetByCampaignID(ctx, id)
+		campaign.VoucherCount = len(vouchers)
+	}
+	return campaign, nil
+}
+
+func (m *mockCampaignRepository) GetAll(ctx context.Context) ([]*models.Campaign, error) {
+	campaigns := make([]*models.Campaign, 0, len(m.campaigns))
+	for _, c := range m.campaigns {
+		campaigns = append(campaigns, c)
+	}
+	return campaigns, nil
+}
+
+// mockUnitOfWork runs the function against the mock repositories without a real transaction
+type mockUnitOfWork struct {
+	vouchers *mockVoucherRepository
+}
+
+func newMockUnitOfWork(vouchers *mockVoucherRepository) *mockUnitOfWork {
+	return &mockUnitOfWork{vouchers: vouchers}
+}
+
+func (m *mockUnitOfWork) Do(ctx context.Context, fn func(tx repository.Transaction) error) error {
+	return fn(m)
+}
+
+func (m *mockUnitOfWork) Subscriptions() repository.SubscriptionRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Vouchers() repository.VoucherRepository {
+	return m.vouchers
+}
+
+func (m *mockUnitOfWork) Campaigns() repository.CampaignRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Invoices() repository.InvoiceRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Payments() repository.PaymentRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) CreditNotes() repository.CreditNoteRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Credits() repository.CreditRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Ledger() repository.LedgerRepository {
+	return nil
+}
+
 type mockProductRepository struct {
 	products map[uuid.UUID]*models.Product
 }
@@ -158,7 +299,7 @@ func TestCreateVoucher(t *testing.T) {
 	ctx := context.Background()
 	voucherRepo := newMockVoucherRepository()
 	productRepo := newMockProductRepository()
-	service := voucher.NewService(voucherRepo, productRepo)
+	service := voucher.NewService(voucherRepo, productRepo, newMockCampaignRepository(), newMockUnitOfWork(voucherRepo))
 
 	// Create a test product
 	product := createTestProduct()
@@ -203,6 +344,7 @@ func TestCreateVoucher(t *testing.T) {
 		Code:          "FIXED10",
 		DiscountType:  models.DiscountTypeFixed,
 		DiscountValue: decimal.NewFromInt(10), // $10 discount
+		Currency:      "usd",
 		ProductID:     &productID,
 		IsActive:      true,
 		ExpiresAt:     time.Now().AddDate(0, 1, 0), // 1 month expiry
@@ -225,6 +367,10 @@ func TestCreateVoucher(t *testing.T) {
 		t.Errorf("Expected discount value 10, got %v", v.DiscountValue)
 	}
 
+	if v.Currency != "USD" {
+		t.Errorf("Expected currency USD, got %v", v.Currency)
+	}
+
 	if v.ProductID == nil {
 		t.Error("Expected ProductID not to be nil")
 	} else if *v.ProductID != productID {
@@ -272,6 +418,73 @@ func TestCreateVoucher(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for past expiry date")
 	}
+
+	// Test case 6: A voucher without a duration discounts once
+	input = voucher.CreateVoucherInput{
+		Code:          "ONCE",
+		DiscountType:  models.DiscountTypePercentage,
+		DiscountValue: decimal.NewFromInt(50),
+		IsActive:      true,
+		ExpiresAt:     time.Now().AddDate(0, 1, 0),
+	}
+
+	once, err := service.CreateVoucher(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to create voucher:", err)
+	}
+
+	if once.DiscountDuration != models.DiscountDurationOnce || once.PeriodsDiscounted() != 1 {
+		t.Errorf("Expected a one-off discount, got %v", once.DiscountDuration)
+	}
+
+	// Test case 7: A repeating discount needs its number of periods
+	input = voucher.CreateVoucherInput{
+		Code:             "REPEATING",
+		DiscountType:     models.DiscountTypePercentage,
+		DiscountValue:    decimal.NewFromInt(50),
+		IsActive:         true,
+		ExpiresAt:        time.Now().AddDate(0, 1, 0),
+		DiscountDuration: models.DiscountDurationRepeating,
+	}
+
+	_, err = service.CreateVoucher(ctx, input)
+	if _, ok := err.(errors.ValidationErrors); !ok {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+
+	input.DiscountPeriods = 3
+	repeating, err := service.CreateVoucher(ctx, input)
+	if err != nil {
+		t.Fatal("Failed to create voucher:", err)
+	}
+
+	if repeating.PeriodsDiscounted() != 3 {
+		t.Errorf("Expected 3 discounted periods, got %d", repeating.PeriodsDiscounted())
+	}
+
+	// Test case 8: A fixed discount is a whole amount in its currency and a percentage has none
+	input = voucher.CreateVoucherInput{
+		Code:          "YEN500",
+		DiscountType:  models.DiscountTypeFixed,
+		DiscountValue: decimal.NewFromFloat(500.5),
+		IsActive:      true,
+		ExpiresAt:     time.Now().AddDate(0, 1, 0),
+	}
+
+	for _, code := range []string{"", "JPY"} {
+		input.Currency = code
+		_, err = service.CreateVoucher(ctx, input)
+		if _, ok := err.(errors.ValidationErrors); !ok {
+			t.Errorf("Expected validation error for currency %q, got %v", code, err)
+		}
+	}
+
+	input.DiscountType = models.DiscountTypePercentage
+	input.DiscountValue = decimal.NewFromInt(10)
+	_, err = service.CreateVoucher(ctx, input)
+	if _, ok := err.(errors.ValidationErrors); !ok {
+		t.Errorf("Expected validation error for a percentage with a currency, got %v", err)
+	}
 }
 
 func TestValidateVoucher(t *testing.T) {
@@ -279,7 +492,7 @@ func TestValidateVoucher(t *testing.T) {
 	ctx := context.Background()
 	voucherRepo := newMockVoucherRepository()
 	productRepo := newMockProductRepository()
-	service := voucher.NewService(voucherRepo, productRepo)
+	service := voucher.NewService(voucherRepo, productRepo, newMockCampaignRepository(), newMockUnitOfWork(voucherRepo))
 
 	// Create a test product
 	product := createTestProduct()
@@ -320,6 +533,7 @@ func TestValidateVoucher(t *testing.T) {
 		Code:          "PRODUCT10",
 		DiscountType:  models.DiscountTypeFixed,
 		DiscountValue: decimal.NewFromInt(10),
+		Currency:      "EUR",
 		ProductID:     &productID,
 		IsActive:      true,
 		ExpiresAt:     time.Now().AddDate(0, 1, 0),
@@ -445,4 +659,166 @@ func TestValidateVoucher(t *testing.T) {
 	if err != errors.ErrVoucherNotFound {
 		t.Errorf("Expected error %v, got %v", errors.ErrVoucherNotFound, err)
 	}
+	// Test case 7: Validate voucher that has reached its redemption limit
+	usedUpVoucher := &models.Voucher{
+		ID:              uuid.New(),
+		Code:            "USEDUP",
+		DiscountType:    models.DiscountTypeFixed,
+		DiscountValue:   decimal.NewFromInt(5),
+		Currency:        "EUR",
+		IsActive:        true,
+		ExpiresAt:       time.Now().AddDate(0, 1, 0),
+		MaxRedemptions:  2,
+		RedemptionCount: 2,
+	}
+	if err := voucherRepo.Create(ctx, usedUpVoucher); err != nil {
+		t.Fatal("Failed to create used up voucher:", err)
+	}
+
+	input = voucher.ValidateVoucherInput{
+		Code:      "USEDUP",
+		ProductID: product.ID,
+	}
+
+	_, err = service.ValidateVoucher(ctx, input)
+	if err != errors.ErrVoucherRedemptionLimitReached {
+		t.Errorf("Expected error %v, got %v", errors.ErrVoucherRedemptionLimitReached, err)
+	}
+
+	// Test case 8: Validate fixed voucher for a purchase in another currency
+	input = voucher.ValidateVoucherInput{
+		Code:      "PRODUCT10",
+		ProductID: product.ID,
+		Currency:  "usd",
+	}
+
+	_, err = service.ValidateVoucher(ctx, input)
+	if err != errors.ErrVoucherCurrency {
+		t.Errorf("Expected error %v, got %v", errors.ErrVoucherCurrency, err)
+	}
+}
+
+func TestGenerateCodes(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	voucherRepo := newMockVoucherRepository()
+	productRepo := newMockProductRepository()
+	campaignRepo := newMockCampaignRepository()
+	campaignRepo.vouchers = voucherRepo
+	service := voucher.NewService(voucherRepo, productRepo, campaignRepo, newMockUnitOfWork(voucherRepo))
+
+	campaign, err := service.CreateCampaign(ctx, voucher.CreateCampaignInput{
+		Name:                  "Summer",
+		DiscountType:          models.DiscountTypePercentage,
+		DiscountValue:         decimal.NewFromInt(25),
+		ExpiresAt:             time.Now().AddDate(0, 1, 0),
+		MaxRedemptionsPerCode: 1,
+	})
+	if err != nil {
+		t.Fatal("Failed to create campaign:", err)
+	}
+
+	// Test case 1: Codes are unique, carry the prefix and the campaign's settings
+	campaign, err = service.GenerateCodes(ctx, voucher.GenerateCodesInput{
+		CampaignID: campaign.ID,
+		Count:      500,
+		Prefix:     "summer-",
+		Length:     8,
+	})
+	if err != nil {
+		t.Fatal("Failed to generate codes:", err)
+	}
+
+	if campaign.VoucherCount != 500 {
+		t.Fatalf("Expected 500 codes, got %d", campaign.VoucherCount)
+	}
+
+	for code, v := range voucherRepo.codes {
+		if !strings.HasPrefix(code, "SUMMER-") || len(code) != len("SUMMER-")+8 {
+			t.Errorf("Unexpected code %q", code)
+		}
+		if v.MaxRedemptions != 1 || v.CampaignID == nil || *v.CampaignID != campaign.ID {
+			t.Errorf("Expected a single-use code of the campaign, got %+v", v)
+		}
+	}
+
+	// Test case 2: Codes that already exist are replaced
+	existing := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		code := "X"
+		for bit := 0; bit < 10; bit++ {
+			if (i>>bit)&1 == 1 {
+				code += "B"
+			} else {
+				code += "A"
+			}
+		}
+		existing[code] = true
+		if err := voucherRepo.Create(ctx, &models.Voucher{ID: uuid.New(), Code: code}); err != nil {
+			t.Fatal("Failed to create voucher:", err)
+		}
+	}
+
+	campaign, err = service.GenerateCodes(ctx, voucher.GenerateCodesInput{
+		CampaignID: campaign.ID,
+		Count:      10,
+		Prefix:     "X",
+		Alphabet:   "AB",
+		Length:     10,
+	})
+	if err != nil {
+		t.Fatal("Failed to generate codes:", err)
+	}
+
+	if campaign.VoucherCount != 510 {
+		t.Errorf("Expected 510 codes, got %d", campaign.VoucherCount)
+	}
+
+	// Test case 3: A code space too small for the count is rejected
+	_, err = service.GenerateCodes(ctx, voucher.GenerateCodesInput{
+		CampaignID: campaign.ID,
+		Count:      1000,
+		Alphabet:   "AB",
+		Length:     8,
+	})
+	if _, ok := err.(errors.ValidationErrors); !ok {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+
+	// Test case 4: A lower case alphabet is rejected, since codes are matched in upper case
+	_, err = service.GenerateCodes(ctx, voucher.GenerateCodesInput{
+		CampaignID: campaign.ID,
+		Count:      10,
+		Alphabet:   "abcdef",
+		Length:     8,
+	})
+	if _, ok := err.(errors.ValidationErrors); !ok {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+}
+
+func TestWriteVouchersCSV(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	vouchers := []*models.Voucher{
+		{
+			Code:           "SUMMER-ABCD",
+			DiscountType:   models.DiscountTypeFixed,
+			DiscountValue:  decimal.NewFromInt(5),
+			Currency:       "JPY",
+			ExpiresAt:      expiresAt,
+			IsActive:       true,
+			MaxRedemptions: 1,
+		},
+	}
+
+	var buf strings.Builder
+	if err := voucher.WriteVouchersCSV(&buf, vouchers); err != nil {
+		t.Fatal("Failed to write CSV:", err)
+	}
+
+	expected := "code,discount_type,discount_value,currency,expires_at,max_redemptions,redemption_count,is_active\n" +
+		"SUMMER-ABCD,fixed,5,JPY,2030-01-02T03:04:05Z,1,0,true\n"
+	if buf.String() != expected {
+		t.Errorf("Expected CSV %q, got %q", expected, buf.String())
+	}
 }
@@ -0,0 +1,212 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/payment"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+	"github.com/assylzhan-a/subscription-service/pkg/webhook"
+	"github.com/google/uuid"
+)
+
+const defaultListLimit = 100
+
+// processingTimeout is how long an event may stay received before it counts as
+// abandoned, e.g. by a replica that crashed while processing it
+const processingTimeout = 5 * time.Minute
+
+// Handler processes one type of payment event. It must be safe to call again for
+// an event it already processed.
+type Handler func(ctx context.Context, event *payment.Event) error
+
+type Service struct {
+	repo     repository.WebhookEventRepository
+	provider payment.PaymentProvider
+	secret   string
+	// tolerance is how far the signature's timestamp may be from the time the event is received
+	tolerance time.Duration
+	handlers  map[payment.EventType]Handler
+}
+
+func NewService(
+	repo repository.WebhookEventRepository,
+	provider payment.PaymentProvider,
+	secret string,
+	tolerance time.Duration,
+) *Service {
+	return &Service{
+		repo:      repo,
+		provider:  provider,
+		secret:    secret,
+		tolerance: tolerance,
+		handlers:  make(map[payment.EventType]Handler),
+	}
+}
+
+// Handle sets the handler for an event type. Events of types without a handler are
+// stored and marked as ignored.
+func (s *Service) Handle(eventType payment.EventType, handler Handler) {
+	s.handlers[eventType] = handler
+}
+
+type ReceiveInput struct {
+	Provider  string
+	Payload   []byte
+	Signature string
+}
+
+// Receive verifies an event sent to the webhook endpoint, stores it and processes it.
+// An event the provider sends again is not processed again unless it failed before,
+// or its processing was abandoned.
+// An error from the event's handler is returned after the failure is stored, so
+// that the provider retries the event.
+func (s *Service) Receive(ctx context.Context, input ReceiveInput) (*models.WebhookEvent, error) {
+	if input.Provider != s.provider.Name() {
+		return nil, errors.ErrUnknownPaymentProvider
+	}
+
+	now := time.Now()
+	if err := webhook.Verify(input.Payload, input.Signature, s.secret, s.tolerance, now); err != nil {
+		return nil, errors.ErrInvalidWebhookSignature
+	}
+
+	parsed, err := s.provider.ParseEvent(input.Payload)
+	if err != nil {
+		return nil, errors.ErrInvalidWebhookPayload
+	}
+
+	event := &models.WebhookEvent{
+		ID:         uuid.New(),
+		Provider:   input.Provider,
+		EventID:    parsed.ID,
+		Type:       string(parsed.Type),
+		Payload:    input.Payload,
+		Status:     models.WebhookEventStatusReceived,
+		ReceivedAt: now,
+	}
+
+	if err := s.repo.Create(ctx, event); err != nil {
+		if err != errors.ErrDuplicateWebhookEvent {
+			return nil, fmt.Errorf("failed to store webhook event: %w", err)
+		}
+
+		event, err = s.repo.GetByProviderEventID(ctx, input.Provider, parsed.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get webhook event: %w", err)
+		}
+		if !needsProcessing(event, now) {
+			return event, nil
+		}
+	}
+
+	return event, s.process(ctx, event, parsed)
+}
+
+func (s *Service) GetEvent(ctx context.Context, id uuid.UUID) (*models.WebhookEvent, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// ListEvents returns the most recently received events, only those with the status if it is set
+func (s *Service) ListEvents(ctx context.Context, status models.WebhookEventStatus, limit int) ([]*models.WebhookEvent, error) {
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	return s.repo.List(ctx, status, limit)
+}
+
+// Replay processes a stored event again, whatever its status. The signature is not
+// checked again; it was checked when the event was received.
+func (s *Service) Replay(ctx context.Context, id uuid.UUID) (*models.WebhookEvent, error) {
+	event, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if event.Provider != s.provider.Name() {
+		return nil, errors.ErrUnknownPaymentProvider
+	}
+
+	parsed, err := s.provider.ParseEvent(event.Payload)
+	if err != nil {
+		return nil, errors.ErrInvalidWebhookPayload
+	}
+
+	return event, s.process(ctx, event, parsed)
+}
+
+// ReplaySummary counts the outcomes of replaying events
+type ReplaySummary struct {
+	Replayed int `json:"replayed"`
+	Failed   int `json:"failed"`
+}
+
+// ReplayFailed replays up to limit events whose processing failed, oldest first
+func (s *Service) ReplayFailed(ctx context.Context, limit int) (ReplaySummary, error) {
+	var summary ReplaySummary
+
+	events, err := s.ListEvents(ctx, models.WebhookEventStatusFailed, limit)
+	if err != nil {
+		return summary, fmt.Errorf("failed to list failed webhook events: %w", err)
+	}
+
+	for i := len(events) - 1; i >= 0; i-- {
+		if _, err := s.Replay(ctx, events[i].ID); err != nil {
+			log.Printf("Failed to replay webhook event %s: %v", events[i].ID, err)
+			summary.Failed++
+			continue
+		}
+		summary.Replayed++
+	}
+
+	return summary, nil
+}
+
+// needsProcessing reports whether a stored event is processed again when it is
+// delivered again: it failed, or it is still received long after it arrived
+func needsProcessing(event *models.WebhookEvent, now time.Time) bool {
+	switch event.Status {
+	case models.WebhookEventStatusFailed:
+		return true
+	case models.WebhookEventStatusReceived:
+		return now.Sub(event.ReceivedAt) > processingTimeout
+	default:
+		return false
+	}
+}
+
+// process runs the event's handler and stores the outcome
+func (s *Service) process(ctx context.Context, event *models.WebhookEvent, parsed *payment.Event) error {
+	event.Attempts++
+
+	event.Status = models.WebhookEventStatusIgnored
+	event.LastError = ""
+
+	var handlerErr error
+	if handler, ok := s.handlers[parsed.Type]; ok {
+		event.Status = models.WebhookEventStatusProcessed
+		if handlerErr = handler(ctx, parsed); handlerErr != nil {
+			event.Status = models.WebhookEventStatusFailed
+			event.LastError = handlerErr.Error()
+		}
+	}
+
+	if handlerErr == nil {
+		now := time.Now()
+		event.ProcessedAt = &now
+	}
+
+	if err := s.repo.Update(ctx, event); err != nil {
+		return fmt.Errorf("failed to update webhook event: %w", err)
+	}
+
+	if handlerErr != nil {
+		return fmt.Errorf("failed to process %s event %s: %w", parsed.Type, parsed.ID, handlerErr)
+	}
+
+	return nil
+}
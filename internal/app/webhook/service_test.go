@@ -0,0 +1,272 @@
+package webhook_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/payment"
+	"github.com/assylzhan-a/subscription-service/internal/app/webhook"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	signature "github.com/assylzhan-a/subscription-service/pkg/webhook"
+	"github.com/google/uuid"
+)
+
+const testSecret = "whsec_test"
+
+type mockWebhookEventRepository struct {
+	events []*models.WebhookEvent
+}
+
+func (m *mockWebhookEventRepository) Create(ctx context.Context, event *models.WebhookEvent) error {
+	for _, existing := range m.events {
+		if existing.Provider == event.Provider && existing.EventID == event.EventID {
+			return errors.ErrDuplicateWebhookEvent
+		}
+	}
+	copied := *event
+	m.events = append(m.events, &copied)
+	return nil
+}
+
+func (m *mockWebhookEventRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.WebhookEvent, error) {
+	for _, event := range m.events {
+		if event.ID == id {
+			copied := *event
+			return &copied, nil
+		}
+	}
+	return nil, errors.ErrWebhookEventNotFound
+}
+
+func (m *mockWebhookEventRepository) GetByProviderEventID(ctx context.Context, provider, eventID string) (*models.WebhookEvent, error) {
+	for _, event := range m.events {
+		if event.Provider == provider && event.EventID == eventID {
+			copied := *event
+			return &copied, nil
+		}
+	}
+	return nil, errors.ErrWebhookEventNotFound
+}
+
+func (m *mockWebhookEventRepository) List(ctx context.Context, status models.WebhookEventStatus, limit int) ([]*models.WebhookEvent, error) {
+	var result []*models.WebhookEvent
+	for i := len(m.events) - 1; i >= 0 && len(result) < limit; i-- {
+		if status == "" || m.events[i].Status == status {
+			copied := *m.events[i]
+			result = append(result, &copied)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockWebhookEventRepository) Update(ctx context.Context, event *models.WebhookEvent) error {
+	for i, existing := range m.events {
+		if existing.ID == event.ID {
+			copied := *event
+			m.events[i] = &copied
+			return nil
+		}
+	}
+	return errors.ErrWebhookEventNotFound
+}
+
+// Helper function to build a signed delivery of a fake provider event
+func signedInput(provider *payment.FakeProvider, event payment.Event) webhook.ReceiveInput {
+	payload := provider.EncodeEvent(event)
+	return webhook.ReceiveInput{
+		Provider:  provider.Name(),
+		Payload:   payload,
+		Signature: signature.Sign(payload, testSecret, time.Now()),
+	}
+}
+
+func TestReceive(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	repo := &mockWebhookEventRepository{}
+	provider := payment.NewFakeProvider()
+	service := webhook.NewService(repo, provider, testSecret, 5*time.Minute)
+
+	var handled []string
+	var failNext bool
+	service.Handle(payment.EventPaymentSucceeded, func(ctx context.Context, event *payment.Event) error {
+		handled = append(handled, event.ID)
+		if failNext {
+			failNext = false
+			return fmt.Errorf("database unavailable")
+		}
+		return nil
+	})
+
+	event := payment.Event{ID: "evt_1", Type: payment.EventPaymentSucceeded, PaymentID: "ch_1", CreatedAt: time.Now()}
+
+	// Test case 1: Deliveries that cannot be trusted or read are rejected without being stored
+	wrongProvider := signedInput(provider, event)
+	wrongProvider.Provider = "other"
+
+	badSignature := signedInput(provider, event)
+	badSignature.Signature = signature.Sign(badSignature.Payload, "wrong", time.Now())
+
+	stale := signedInput(provider, event)
+	stale.Signature = signature.Sign(stale.Payload, testSecret, time.Now().Add(-10*time.Minute))
+
+	garbage := []byte("not json")
+	unreadable := webhook.ReceiveInput{Provider: provider.Name(), Payload: garbage, Signature: signature.Sign(garbage, testSecret, time.Now())}
+
+	for _, tc := range []struct {
+		name     string
+		input    webhook.ReceiveInput
+		expected error
+	}{
+		{"unknown provider", wrongProvider, errors.ErrUnknownPaymentProvider},
+		{"wrong secret", badSignature, errors.ErrInvalidWebhookSignature},
+		{"stale timestamp", stale, errors.ErrInvalidWebhookSignature},
+		{"unreadable payload", unreadable, errors.ErrInvalidWebhookPayload},
+	} {
+		if _, err := service.Receive(ctx, tc.input); err != tc.expected {
+			t.Errorf("Expected error %v for %s, got %v", tc.expected, tc.name, err)
+		}
+	}
+
+	if len(repo.events) != 0 {
+		t.Errorf("Expected no stored events, got %d", len(repo.events))
+	}
+
+	// Test case 2: A valid event is stored and handled once, however often it is delivered
+	for i := 0; i < 2; i++ {
+		stored, err := service.Receive(ctx, signedInput(provider, event))
+		if err != nil {
+			t.Fatal("Failed to receive event:", err)
+		}
+		if stored.Status != models.WebhookEventStatusProcessed || stored.Attempts != 1 {
+			t.Errorf("Expected a processed event after 1 attempt, got %v after %d", stored.Status, stored.Attempts)
+		}
+	}
+
+	if len(handled) != 1 || len(repo.events) != 1 {
+		t.Errorf("Expected 1 handled and stored event, got %d handled and %d stored", len(handled), len(repo.events))
+	}
+
+	// Test case 3: A failed event is stored with its error and handled again when redelivered
+	failNext = true
+	failing := payment.Event{ID: "evt_2", Type: payment.EventPaymentSucceeded, PaymentID: "ch_2", CreatedAt: time.Now()}
+
+	if _, err := service.Receive(ctx, signedInput(provider, failing)); err == nil {
+		t.Error("Expected the handler's error")
+	}
+
+	stored, _ := repo.GetByProviderEventID(ctx, provider.Name(), "evt_2")
+	if stored.Status != models.WebhookEventStatusFailed || stored.LastError == "" || stored.ProcessedAt != nil {
+		t.Errorf("Expected a failed event with its error, got %v %q", stored.Status, stored.LastError)
+	}
+
+	stored, err := service.Receive(ctx, signedInput(provider, failing))
+	if err != nil {
+		t.Fatal("Failed to receive event:", err)
+	}
+	if stored.Status != models.WebhookEventStatusProcessed || stored.Attempts != 2 || stored.LastError != "" {
+		t.Errorf("Expected the redelivered event to be processed on attempt 2, got %v on attempt %d", stored.Status, stored.Attempts)
+	}
+
+	// Test case 4: Events nobody handles are stored as ignored
+	disputed := payment.Event{ID: "evt_3", Type: payment.EventPaymentDisputed, PaymentID: "ch_3", CreatedAt: time.Now()}
+	stored, err = service.Receive(ctx, signedInput(provider, disputed))
+	if err != nil {
+		t.Fatal("Failed to receive event:", err)
+	}
+	if stored.Status != models.WebhookEventStatusIgnored {
+		t.Errorf("Expected status %v, got %v", models.WebhookEventStatusIgnored, stored.Status)
+	}
+
+	// Test case 5: An event left received is processed when redelivered, once it has been
+	// received for longer than processing can take
+	abandoned := payment.Event{ID: "evt_4", Type: payment.EventPaymentSucceeded, PaymentID: "ch_4", CreatedAt: time.Now()}
+	repo.events = append(repo.events, &models.WebhookEvent{
+		ID:         uuid.New(),
+		Provider:   provider.Name(),
+		EventID:    abandoned.ID,
+		Type:       string(abandoned.Type),
+		Status:     models.WebhookEventStatusReceived,
+		ReceivedAt: time.Now(),
+	})
+	handled = nil
+
+	stored, err = service.Receive(ctx, signedInput(provider, abandoned))
+	if err != nil {
+		t.Fatal("Failed to receive event:", err)
+	}
+	if stored.Status != models.WebhookEventStatusReceived || len(handled) != 0 {
+		t.Errorf("Expected an event still being processed to be left alone, got %v", stored.Status)
+	}
+
+	repo.events[len(repo.events)-1].ReceivedAt = time.Now().Add(-time.Hour)
+
+	stored, err = service.Receive(ctx, signedInput(provider, abandoned))
+	if err != nil {
+		t.Fatal("Failed to receive event:", err)
+	}
+	if stored.Status != models.WebhookEventStatusProcessed || len(handled) != 1 {
+		t.Errorf("Expected the abandoned event to be processed, got %v", stored.Status)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	repo := &mockWebhookEventRepository{}
+	provider := payment.NewFakeProvider()
+	service := webhook.NewService(repo, provider, testSecret, 5*time.Minute)
+
+	var handled []string
+	failing := true
+	service.Handle(payment.EventPaymentFailed, func(ctx context.Context, event *payment.Event) error {
+		handled = append(handled, event.ID)
+		if failing {
+			return fmt.Errorf("subscription was changed by another request")
+		}
+		return nil
+	})
+
+	for _, id := range []string{"evt_1", "evt_2"} {
+		event := payment.Event{ID: id, Type: payment.EventPaymentFailed, PaymentID: "ch_" + id, CreatedAt: time.Now()}
+		if _, err := service.Receive(ctx, signedInput(provider, event)); err == nil {
+			t.Fatal("Expected the handler's error")
+		}
+	}
+
+	// Test case 1: Replaying a missing event fails
+	if _, err := service.Replay(ctx, uuid.New()); err != errors.ErrWebhookEventNotFound {
+		t.Errorf("Expected error %v, got %v", errors.ErrWebhookEventNotFound, err)
+	}
+
+	// Test case 2: Failed events are replayed oldest first
+	failing = false
+	handled = nil
+
+	summary, err := service.ReplayFailed(ctx, 10)
+	if err != nil {
+		t.Fatal("Failed to replay events:", err)
+	}
+
+	if summary.Replayed != 2 || summary.Failed != 0 || len(handled) != 2 || handled[0] != "evt_1" {
+		t.Errorf("Expected evt_1 and evt_2 to be replayed in order, got %+v, handled %v", summary, handled)
+	}
+
+	failed, _ := service.ListEvents(ctx, models.WebhookEventStatusFailed, 0)
+	if len(failed) != 0 {
+		t.Errorf("Expected no failed events, got %d", len(failed))
+	}
+
+	// Test case 3: A processed event can be replayed on request
+	replayed, err := service.Replay(ctx, repo.events[0].ID)
+	if err != nil {
+		t.Fatal("Failed to replay event:", err)
+	}
+
+	if replayed.Attempts != 3 || len(handled) != 3 {
+		t.Errorf("Expected a third attempt, got %d", replayed.Attempts)
+	}
+}
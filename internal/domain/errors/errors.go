@@ -15,18 +15,62 @@ var (
 	ErrUserAlreadyExists  = errors.New("user already exists")
 	ErrInvalidCredentials = errors.New("invalid credentials")
 
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+	ErrTokenRevoked        = errors.New("token has been revoked")
+
 	ErrProductNotFound = errors.New("product not found")
 	ErrInactiveProduct = errors.New("product is not active")
+	ErrCurrencyNotSold = errors.New("product is not sold in this currency")
 
-	ErrSubscriptionNotFound      = errors.New("subscription not found")
-	ErrSubscriptionNotActive     = errors.New("subscription is not active")
-	ErrSubscriptionInTrial       = errors.New("subscription is in trial period")
-	ErrSubscriptionAlreadyPaused = errors.New("subscription is already paused")
+	ErrSubscriptionNotFound         = errors.New("subscription not found")
+	ErrSubscriptionNotActive        = errors.New("subscription is not active")
+	ErrSubscriptionInTrial          = errors.New("subscription is in trial period")
+	ErrSubscriptionAlreadyPaused    = errors.New("subscription is already paused")
+	ErrSubscriptionNotPaused        = errors.New("subscription is not paused")
+	ErrInvalidStateTransition       = errors.New("subscription cannot make this transition in its current state")
+	ErrSubscriptionSamePlan         = errors.New("subscription is already on this plan")
+	ErrPauseTooLong                 = errors.New("pause exceeds the product's maximum pause length")
+	ErrCancellationNotScheduled     = errors.New("subscription has no scheduled cancellation")
+	ErrCancellationAlreadyScheduled = errors.New("subscription is already scheduled to cancel")
+	ErrSubscriptionConflict         = errors.New("subscription was changed by another request, please retry")
 
 	ErrVoucherNotFound = errors.New("voucher not found")
 	ErrVoucherExpired  = errors.New("voucher is expired")
 	ErrVoucherInactive = errors.New("voucher is not active")
 	ErrVoucherInvalid  = errors.New("voucher is invalid")
+	ErrVoucherCurrency = errors.New("voucher is not valid in this currency")
+
+	ErrVoucherRedemptionLimitReached = errors.New("voucher has reached its maximum number of redemptions")
+	ErrVoucherUserLimitReached       = errors.New("voucher has already been redeemed the maximum number of times by this user")
+
+	ErrCampaignNotFound   = errors.New("campaign not found")
+	ErrCodeSpaceExhausted = errors.New("could not generate enough unique voucher codes, use a longer code or a larger alphabet")
+
+	ErrInvoiceNotFound = errors.New("invoice not found")
+
+	ErrCreditNoteNotFound   = errors.New("credit note not found")
+	ErrInsufficientCredit   = errors.New("credit balance is too low")
+	ErrInvoiceNotRefundable = errors.New("invoice has no collected payment to refund")
+	ErrRefundExceedsPayment = errors.New("refund exceeds the amount left to refund")
+
+	ErrExchangeRateNotFound = errors.New("no exchange rate is known for this currency and date")
+
+	ErrUnbalancedJournalEntry = errors.New("journal entry debits do not equal its credits")
+	ErrJournalEntryExists     = errors.New("journal entry already exists")
+
+	ErrPaymentAccountNotFound = errors.New("payment account not found")
+	ErrPaymentMethodRequired  = errors.New("a payment method is required, add one first")
+	ErrPaymentDeclined        = errors.New("payment was declined")
+	ErrPaymentRequiresAction  = errors.New("payment requires additional authentication")
+	ErrPaymentTimeout         = errors.New("payment provider did not respond in time")
+	ErrPaymentNotFound        = errors.New("payment not found")
+
+	ErrUnknownPaymentProvider  = errors.New("unknown payment provider")
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	ErrInvalidWebhookPayload   = errors.New("invalid webhook payload")
+	ErrWebhookEventNotFound    = errors.New("webhook event not found")
+	ErrDuplicateWebhookEvent   = errors.New("webhook event was already received")
 )
 
 type ValidationError struct {
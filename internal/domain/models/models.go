@@ -3,17 +3,140 @@ package models
 import (
 	"time"
 
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
+type UserRole string
+
+const (
+	UserRoleCustomer UserRole = "customer"
+	UserRoleSupport  UserRole = "support"
+	UserRoleAdmin    UserRole = "admin"
+)
+
+// IsValid reports whether the role is one of the known roles
+func (r UserRole) IsValid() bool {
+	switch r {
+	case UserRoleCustomer, UserRoleSupport, UserRoleAdmin:
+		return true
+	}
+	return false
+}
+
+// OneOf reports whether the role is one of the allowed roles. Users without a role
+// (e.g. tokens issued before roles existed) are treated as customers.
+func (r UserRole) OneOf(allowed ...UserRole) bool {
+	if r == "" {
+		r = UserRoleCustomer
+	}
+
+	for _, role := range allowed {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 type User struct {
 	ID        uuid.UUID `json:"id"`
 	Email     string    `json:"email"`
 	Password  string    `json:"-"` // Never expose password in JSON
 	Name      string    `json:"name"`
+	Role      UserRole  `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// BillingAddress decides the taxes the user pays; nil until the user sets it
+	BillingAddress *Address `json:"billing_address,omitempty"`
+	// BusinessProfile is set for users who buy as a business
+	BusinessProfile *BusinessProfile `json:"business_profile,omitempty"`
+}
+
+// Address is a postal address. Country is an ISO 3166-1 alpha-2 code and Region the
+// subdivision part of an ISO 3166-2 code, e.g. "QC" for Quebec in Canada.
+type Address struct {
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	PostalCode string `json:"postal_code"`
+	Region     string `json:"region,omitempty"`
+	Country    string `json:"country"`
+}
+
+// BusinessProfile describes the business a user buys for
+type BusinessProfile struct {
+	CompanyName string `json:"company_name"`
+	// VATID is an EU VAT ID with its country prefix, e.g. "DE136695976"; it is empty
+	// for businesses that are not registered for VAT in the EU
+	VATID string `json:"vat_id,omitempty"`
+}
+
+// RefreshToken is an opaque, single-use token that can be exchanged for a new
+// access token. Only its SHA-256 hash is stored. Tokens issued from the same
+// login share a FamilyID so that the whole chain can be revoked on reuse.
+type RefreshToken struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	FamilyID   uuid.UUID  `json:"family_id"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ReplacedBy *uuid.UUID `json:"replaced_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RefundPolicy decides what a customer gets back when they cancel during a paid period
+type RefundPolicy string
+
+const (
+	RefundPolicyNone     RefundPolicy = "none"
+	RefundPolicyProrated RefundPolicy = "prorated"
+	// RefundPolicyFullWithinDays refunds the whole period if it is cancelled within
+	// the product's RefundWindowDays of its purchase, and nothing after
+	RefundPolicyFullWithinDays RefundPolicy = "full_within_days"
+)
+
+// IsValid reports whether the policy is one of the known policies
+func (p RefundPolicy) IsValid() bool {
+	switch p {
+	case RefundPolicyNone, RefundPolicyProrated, RefundPolicyFullWithinDays:
+		return true
+	}
+	return false
+}
+
+// TaxCategory groups products that are taxed alike; some jurisdictions have lower
+// rates for some categories
+type TaxCategory string
+
+const (
+	TaxCategoryStandard TaxCategory = "standard"
+	TaxCategoryReduced  TaxCategory = "reduced"
+	TaxCategoryExempt   TaxCategory = "exempt"
+)
+
+// IsValid reports whether the category is one of the known categories
+func (c TaxCategory) IsValid() bool {
+	switch c {
+	case TaxCategoryStandard, TaxCategoryReduced, TaxCategoryExempt:
+		return true
+	}
+	return false
+}
+
+// TaxComponent is one tax charged on an amount, e.g. the federal or the provincial
+// part of a sales tax
+type TaxComponent struct {
+	// Name is shown on invoices, e.g. "VAT" or "GST"
+	Name string `json:"name"`
+	// Jurisdiction is the country, or the country and region, that levies the tax,
+	// e.g. "DE" or "CA-QC". It is empty for the product's default tax.
+	Jurisdiction string          `json:"jurisdiction,omitempty"`
+	Rate         decimal.Decimal `json:"rate"`
+	Amount       decimal.Decimal `json:"amount"`
 }
 
 type Product struct {
@@ -21,19 +144,51 @@ type Product struct {
 	Name           string          `json:"name"`
 	Description    string          `json:"description"`
 	Price          decimal.Decimal `json:"price"` // Using decimal for currency
+	Currency       string          `json:"currency"`
+	Prices         []ProductPrice  `json:"prices"` // Price points in currencies other than Currency
 	DurationMonths int             `json:"duration_months"`
-	TaxRate        decimal.Decimal `json:"tax_rate"` // Using decimal for tax rate
+	TaxRate        decimal.Decimal `json:"tax_rate"` // Charged where no tax rule covers the buyer
 	IsActive       bool            `json:"is_active"`
-	CreatedAt      time.Time       `json:"created_at"`
-	UpdatedAt      time.Time       `json:"updated_at"`
+	MaxPauseDays   int             `json:"max_pause_days"` // 0 means pauses are not limited
+	RefundPolicy   RefundPolicy    `json:"refund_policy"`
+	// RefundWindowDays is only used by RefundPolicyFullWithinDays
+	RefundWindowDays int `json:"refund_window_days"`
+	// TaxCategory selects the rates of the tax rules that apply to the product
+	TaxCategory TaxCategory `json:"tax_category"`
+	// TaxInclusive prices include tax, which is taken out of the price instead of added to it
+	TaxInclusive bool      `json:"tax_inclusive"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ProductPrice is a product's price in another currency than its own
+type ProductPrice struct {
+	Currency string          `json:"currency"`
+	Amount   decimal.Decimal `json:"amount"`
+}
+
+// PriceIn returns the product's price in the currency, and false if it is not sold in it
+func (p *Product) PriceIn(currency string) (decimal.Decimal, bool) {
+	if currency == p.Currency {
+		return p.Price, true
+	}
+	for _, price := range p.Prices {
+		if price.Currency == currency {
+			return price.Amount, true
+		}
+	}
+	return decimal.Zero, false
 }
 
 type SubscriptionStatus string
 
 const (
+	SubscriptionStatusTrialing  SubscriptionStatus = "trialing"
 	SubscriptionStatusActive    SubscriptionStatus = "active"
+	SubscriptionStatusPastDue   SubscriptionStatus = "past_due"
 	SubscriptionStatusPaused    SubscriptionStatus = "paused"
 	SubscriptionStatusCancelled SubscriptionStatus = "cancelled"
+	SubscriptionStatusExpired   SubscriptionStatus = "expired"
 )
 
 type Subscription struct {
@@ -45,18 +200,66 @@ type Subscription struct {
 	StartDate       time.Time          `json:"start_date"`
 	EndDate         time.Time          `json:"end_date"`
 	TrialEndDate    *time.Time         `json:"trial_end_date,omitempty"`
+	Currency        string             `json:"currency"`
 	OriginalPrice   decimal.Decimal    `json:"original_price"`
 	DiscountedPrice *decimal.Decimal   `json:"discounted_price,omitempty"`
 	TaxAmount       decimal.Decimal    `json:"tax_amount"`
 	TotalAmount     decimal.Decimal    `json:"total_amount"`
-	CreatedAt       time.Time          `json:"created_at"`
-	UpdatedAt       time.Time          `json:"updated_at"`
+	AutoRenew       bool               `json:"auto_renew"`
+
+	// TaxComponents break TaxAmount down as it was calculated for the current period.
+	// OriginalPrice and DiscountedPrice are always before tax, also for tax-inclusive
+	// products.
+	TaxComponents []TaxComponent `json:"tax_components"`
+	// ReverseCharge is set when the buyer, a business registered for VAT in another
+	// EU member state, accounts for the VAT on the current period themselves.
+	// CustomerVATID is their VAT ID and VATValidationID the check it was accepted on.
+	ReverseCharge   bool       `json:"reverse_charge"`
+	CustomerVATID   string     `json:"customer_vat_id,omitempty"`
+	VATValidationID *uuid.UUID `json:"vat_validation_id,omitempty"`
+
+	// DiscountDuration is copied from the voucher when it is redeemed.
+	// DiscountPeriodsRemaining counts the discounted periods left, including the
+	// current one; it is not used for forever discounts.
+	DiscountDuration         DiscountDuration `json:"discount_duration,omitempty"`
+	DiscountPeriodsRemaining int              `json:"discount_periods_remaining"`
+
+	// ScheduledProductID is the plan the subscription switches to at the next renewal
+	ScheduledProductID *uuid.UUID `json:"scheduled_product_id,omitempty"`
+
+	// PausedAt and ResumeAt are set while the subscription is paused
+	PausedAt *time.Time `json:"paused_at,omitempty"`
+	ResumeAt *time.Time `json:"resume_at,omitempty"`
+
+	// CancelAtPeriodEnd keeps the subscription running until EndDate, after which it is cancelled.
+	// CancelledAt is when the cancellation was requested.
+	CancelAtPeriodEnd bool       `json:"cancel_at_period_end"`
+	CancelledAt       *time.Time `json:"cancelled_at,omitempty"`
+
+	// FailedPaymentAttempts counts the failed charges for the unpaid renewal of a past
+	// due subscription. NextPaymentAttemptAt is when the charge is retried.
+	FailedPaymentAttempts int        `json:"failed_payment_attempts"`
+	NextPaymentAttemptAt  *time.Time `json:"next_payment_attempt_at,omitempty"`
+
+	// Version is incremented by every update and guards against concurrent writes
+	Version int `json:"version"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 
 	// Relations (not stored in DB)
 	Product *Product `json:"product,omitempty"`
 	Voucher *Voucher `json:"voucher,omitempty"`
 }
 
+// HasDiscount reports whether the subscription's voucher still discounts its billing periods
+func (s *Subscription) HasDiscount() bool {
+	if s.VoucherID == nil {
+		return false
+	}
+	return s.DiscountDuration == DiscountDurationForever || s.DiscountPeriodsRemaining > 0
+}
+
 type DiscountType string
 
 const (
@@ -64,16 +267,138 @@ const (
 	DiscountTypePercentage DiscountType = "percentage"
 )
 
+// DiscountDuration controls how many billing periods a voucher discounts
+type DiscountDuration string
+
+const (
+	DiscountDurationOnce      DiscountDuration = "once"
+	DiscountDurationRepeating DiscountDuration = "repeating"
+	DiscountDurationForever   DiscountDuration = "forever"
+)
+
 type Voucher struct {
 	ID            uuid.UUID       `json:"id"`
 	Code          string          `json:"code"`
 	DiscountType  DiscountType    `json:"discount_type"`
 	DiscountValue decimal.Decimal `json:"discount_value"`
+	Currency      string          `json:"currency,omitempty"`   // Set for fixed discounts, which only apply in it
 	ProductID     *uuid.UUID      `json:"product_id,omitempty"` // If null, applies to all products
 	IsActive      bool            `json:"is_active"`
 	ExpiresAt     time.Time       `json:"expires_at"`
-	CreatedAt     time.Time       `json:"created_at"`
-	UpdatedAt     time.Time       `json:"updated_at"`
+	CampaignID    *uuid.UUID      `json:"campaign_id,omitempty"` // Set for generated codes
+
+	// DiscountPeriods is the number of discounted periods of a repeating discount
+	DiscountDuration DiscountDuration `json:"discount_duration"`
+	DiscountPeriods  int              `json:"discount_periods"`
+
+	// MaxRedemptions and MaxRedemptionsPerUser limit how often the voucher can be
+	// redeemed in total and by one user; 0 means no limit
+	MaxRedemptions        int `json:"max_redemptions"`
+	MaxRedemptionsPerUser int `json:"max_redemptions_per_user"`
+	RedemptionCount       int `json:"redemption_count"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RemainingRedemptions returns how many more times the voucher can be redeemed,
+// or -1 if it has no limit
+func (v *Voucher) RemainingRedemptions() int {
+	if v.MaxRedemptions == 0 {
+		return -1
+	}
+	if v.RedemptionCount >= v.MaxRedemptions {
+		return 0
+	}
+	return v.MaxRedemptions - v.RedemptionCount
+}
+
+// PeriodsDiscounted returns how many billing periods the voucher discounts,
+// or -1 if the discount lasts forever
+func (v *Voucher) PeriodsDiscounted() int {
+	switch v.DiscountDuration {
+	case DiscountDurationForever:
+		return -1
+	case DiscountDurationRepeating:
+		return v.DiscountPeriods
+	default:
+		return 1
+	}
+}
+
+// Campaign groups generated vouchers that share their discount settings
+type Campaign struct {
+	ID            uuid.UUID       `json:"id"`
+	Name          string          `json:"name"`
+	DiscountType  DiscountType    `json:"discount_type"`
+	DiscountValue decimal.Decimal `json:"discount_value"`
+	Currency      string          `json:"currency,omitempty"`   // Set for fixed discounts
+	ProductID     *uuid.UUID      `json:"product_id,omitempty"` // If null, applies to all products
+	ExpiresAt     time.Time       `json:"expires_at"`
+
+	DiscountDuration DiscountDuration `json:"discount_duration"`
+	DiscountPeriods  int              `json:"discount_periods"`
+
+	// MaxRedemptionsPerCode is copied to each generated voucher; 1 makes single-use codes
+	MaxRedemptionsPerCode int       `json:"max_redemptions_per_code"`
+	CreatedAt             time.Time `json:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at"`
+
+	// VoucherCount is the number of generated codes (not stored in DB)
+	VoucherCount int `json:"voucher_count"`
+}
+
+// VoucherRedemption records one use of a voucher
+type VoucherRedemption struct {
+	ID             uuid.UUID       `json:"id"`
+	VoucherID      uuid.UUID       `json:"voucher_id"`
+	UserID         uuid.UUID       `json:"user_id"`
+	SubscriptionID uuid.UUID       `json:"subscription_id"`
+	DiscountAmount decimal.Decimal `json:"discount_amount"`
+	RedeemedAt     time.Time       `json:"redeemed_at"`
+}
+
+// SubscriptionPause records one period during which a subscription was paused
+type SubscriptionPause struct {
+	ID                uuid.UUID  `json:"id"`
+	SubscriptionID    uuid.UUID  `json:"subscription_id"`
+	PausedAt          time.Time  `json:"paused_at"`
+	ScheduledResumeAt *time.Time `json:"scheduled_resume_at,omitempty"`
+	ResumedAt         *time.Time `json:"resumed_at,omitempty"`
+}
+
+// Duration returns how long the pause lasted, or has lasted so far if the
+// subscription is still paused
+func (p *SubscriptionPause) Duration(now time.Time) time.Duration {
+	if p.ResumedAt != nil {
+		return p.ResumedAt.Sub(p.PausedAt)
+	}
+	return now.Sub(p.PausedAt)
+}
+
+// CancellationFeedback is the customer's answer to why they are leaving
+type CancellationFeedback string
+
+const (
+	CancellationFeedbackTooExpensive    CancellationFeedback = "too_expensive"
+	CancellationFeedbackMissingFeatures CancellationFeedback = "missing_features"
+	CancellationFeedbackSwitchedService CancellationFeedback = "switched_service"
+	CancellationFeedbackUnused          CancellationFeedback = "unused"
+	CancellationFeedbackCustomerService CancellationFeedback = "customer_service"
+	CancellationFeedbackTooComplex      CancellationFeedback = "too_complex"
+	CancellationFeedbackLowQuality      CancellationFeedback = "low_quality"
+	CancellationFeedbackOther           CancellationFeedback = "other"
+)
+
+// IsValid reports whether the feedback is one of the known categories
+func (f CancellationFeedback) IsValid() bool {
+	switch f {
+	case CancellationFeedbackTooExpensive, CancellationFeedbackMissingFeatures, CancellationFeedbackSwitchedService,
+		CancellationFeedbackUnused, CancellationFeedbackCustomerService, CancellationFeedbackTooComplex,
+		CancellationFeedbackLowQuality, CancellationFeedbackOther:
+		return true
+	}
+	return false
 }
 
 type SubscriptionStateChange struct {
@@ -83,4 +408,468 @@ type SubscriptionStateChange struct {
 	NewState       SubscriptionStatus `json:"new_state"`
 	ChangedAt      time.Time          `json:"changed_at"`
 	Reason         string             `json:"reason"`
+	// ReasonCode is a machine-readable form of Reason; it is only set for system changes
+	ReasonCode StateChangeReasonCode `json:"reason_code,omitempty"`
+
+	// Set when the change is a cancellation, for churn analysis
+	CancellationReason string               `json:"cancellation_reason,omitempty"`
+	FeedbackCategory   CancellationFeedback `json:"feedback_category,omitempty"`
+}
+
+// StateChangeReasonCode says why the system changed a subscription's state
+type StateChangeReasonCode string
+
+const (
+	StateChangeReasonRenewalPaymentFailed StateChangeReasonCode = "renewal_payment_failed"
+	StateChangeReasonPaymentRetryFailed   StateChangeReasonCode = "payment_retry_failed"
+	StateChangeReasonPaymentRecovered     StateChangeReasonCode = "payment_recovered"
+	StateChangeReasonDunningExhausted     StateChangeReasonCode = "dunning_exhausted"
+	StateChangeReasonTrialPaymentFailed   StateChangeReasonCode = "trial_payment_failed"
+	StateChangeReasonPaymentReversed      StateChangeReasonCode = "payment_reversed"
+	StateChangeReasonPaymentDisputed      StateChangeReasonCode = "payment_disputed"
+)
+
+type InvoiceStatus string
+
+const (
+	InvoiceStatusDraft     InvoiceStatus = "draft"
+	InvoiceStatusFinalized InvoiceStatus = "finalized"
+)
+
+// InvoicePaymentStatus tracks the payment of an invoice's total. It is the only
+// part of a finalized invoice that can still change.
+type InvoicePaymentStatus string
+
+const (
+	InvoicePaymentStatusPaid InvoicePaymentStatus = "paid"
+	// InvoicePaymentStatusFailed is set when a collected payment is reversed by the provider
+	InvoicePaymentStatusFailed   InvoicePaymentStatus = "failed"
+	InvoicePaymentStatusRefunded InvoicePaymentStatus = "refunded"
+	InvoicePaymentStatusDisputed InvoicePaymentStatus = "disputed"
+	// InvoicePaymentStatusPartiallyRefunded is set when credit notes cover part of the total
+	InvoicePaymentStatusPartiallyRefunded InvoicePaymentStatus = "partially_refunded"
+)
+
+// InvoiceReason is the billing event an invoice was issued for
+type InvoiceReason string
+
+const (
+	InvoiceReasonSubscriptionCreate InvoiceReason = "subscription_create"
+	InvoiceReasonRenewal            InvoiceReason = "renewal"
+	InvoiceReasonPlanChange         InvoiceReason = "plan_change"
+)
+
+// Invoice bills one period of a subscription. Finalized invoices cannot be changed.
+type Invoice struct {
+	ID             uuid.UUID            `json:"id"`
+	Number         string               `json:"number"` // Sequential per year, e.g. INV-2025-000042
+	UserID         uuid.UUID            `json:"user_id"`
+	SubscriptionID uuid.UUID            `json:"subscription_id"`
+	Reason         InvoiceReason        `json:"reason"`
+	Status         InvoiceStatus        `json:"status"`
+	PaymentStatus  InvoicePaymentStatus `json:"payment_status"`
+	PeriodStart    time.Time            `json:"period_start"`
+	PeriodEnd      time.Time            `json:"period_end"`
+	Currency       string               `json:"currency"`
+
+	// Subtotal is the sum of all lines except tax
+	Subtotal  decimal.Decimal `json:"subtotal"`
+	TaxAmount decimal.Decimal `json:"tax_amount"`
+	Total     decimal.Decimal `json:"total"`
+	// CreditApplied is the part of Total paid from the user's credit balance
+	CreditApplied decimal.Decimal `json:"credit_applied"`
+	// TaxComponents break TaxAmount down; there is a tax line for each of them
+	TaxComponents []TaxComponent `json:"tax_components"`
+	// ReverseCharge, CustomerVATID and VATValidationID are copied from the
+	// subscription; reverse-charged invoices carry no VAT and say so
+	ReverseCharge   bool       `json:"reverse_charge"`
+	CustomerVATID   string     `json:"customer_vat_id,omitempty"`
+	VATValidationID *uuid.UUID `json:"vat_validation_id,omitempty"`
+	// ExchangeRate converts the invoice to the reporting currency; nil if no rate
+	// was known when it was issued
+	ExchangeRate *ExchangeRateSnapshot `json:"exchange_rate,omitempty"`
+
+	IssuedAt  time.Time `json:"issued_at"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Lines []*InvoiceLine `json:"lines"`
+}
+
+// ReverseChargeNote is the statement reverse-charged invoices must carry
+const ReverseChargeNote = "Reverse charge: VAT to be accounted for by the recipient (Article 196, Council Directive 2006/112/EC)"
+
+type InvoiceLineType string
+
+const (
+	InvoiceLineTypePlan     InvoiceLineType = "plan"
+	InvoiceLineTypeDiscount InvoiceLineType = "discount"
+	InvoiceLineTypeCredit   InvoiceLineType = "credit"
+	InvoiceLineTypeTax      InvoiceLineType = "tax"
+)
+
+// InvoiceLine is one item of an invoice; discounts and credits are negative
+type InvoiceLine struct {
+	ID          uuid.UUID       `json:"id"`
+	InvoiceID   uuid.UUID       `json:"invoice_id"`
+	Position    int             `json:"position"`
+	Type        InvoiceLineType `json:"type"`
+	Description string          `json:"description"`
+	Amount      decimal.Decimal `json:"amount"`
+}
+
+// CreditNoteReason is why a credit note was issued
+type CreditNoteReason string
+
+const (
+	// CreditNoteReasonCancellation is a refund under the product's refund policy
+	CreditNoteReasonCancellation CreditNoteReason = "cancellation"
+	// CreditNoteReasonSupport is a refund issued by support staff
+	CreditNoteReasonSupport CreditNoteReason = "support"
+)
+
+// CreditNote records a refund of all or part of an invoice's total. Like invoices,
+// credit notes cannot be changed once they are issued.
+type CreditNote struct {
+	ID             uuid.UUID        `json:"id"`
+	Number         string           `json:"number"` // Sequential per year, e.g. CN-2025-000042
+	InvoiceID      uuid.UUID        `json:"invoice_id"`
+	PaymentID      uuid.UUID        `json:"payment_id"`
+	UserID         uuid.UUID        `json:"user_id"`
+	SubscriptionID uuid.UUID        `json:"subscription_id"`
+	Reason         CreditNoteReason `json:"reason"`
+	Note           string           `json:"note,omitempty"`
+	Currency       string           `json:"currency"`
+
+	// Total is split into Subtotal and TaxAmount in the proportions of the invoice
+	Subtotal  decimal.Decimal `json:"subtotal"`
+	TaxAmount decimal.Decimal `json:"tax_amount"`
+	Total     decimal.Decimal `json:"total"`
+
+	// ExchangeRate converts the credit note to the reporting currency; nil if no
+	// rate was known when it was issued
+	ExchangeRate *ExchangeRateSnapshot `json:"exchange_rate,omitempty"`
+
+	ProviderRefundID string    `json:"provider_refund_id,omitempty"`
+	IssuedAt         time.Time `json:"issued_at"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// AmountDue returns the part of the invoice's total that is charged to the payment method
+func (i *Invoice) AmountDue() decimal.Decimal {
+	return i.Total.Sub(i.CreditApplied)
+}
+
+// CreditEntryType is whether a credit balance entry adds to or takes from the balance
+type CreditEntryType string
+
+const (
+	CreditEntryTypeCredit CreditEntryType = "credit"
+	CreditEntryTypeDebit  CreditEntryType = "debit"
+)
+
+// CreditEntryReason is why a user's credit balance changed
+type CreditEntryReason string
+
+const (
+	// CreditEntryReasonGrant is credit granted by an admin, e.g. as a goodwill gesture
+	CreditEntryReasonGrant CreditEntryReason = "grant"
+	// CreditEntryReasonPlanChange is unused time on the previous plan beyond the new plan's price
+	CreditEntryReasonPlanChange CreditEntryReason = "plan_change"
+	// CreditEntryReasonInvoice is credit applied to an invoice
+	CreditEntryReasonInvoice CreditEntryReason = "invoice"
+)
+
+// CreditEntry is one change of a user's credit balance. Entries are never changed;
+// the balance is the sum of credits minus the sum of debits.
+type CreditEntry struct {
+	ID     uuid.UUID         `json:"id"`
+	UserID uuid.UUID         `json:"user_id"`
+	Type   CreditEntryType   `json:"type"`
+	Amount decimal.Decimal   `json:"amount"` // Always positive
+	Reason CreditEntryReason `json:"reason"`
+	// Currency is the currency of Amount; users have a separate balance in each currency
+	Currency string `json:"currency"`
+	// ReferenceID is the invoice or subscription the entry is for, if any
+	ReferenceID *uuid.UUID `json:"reference_id,omitempty"`
+	Note        string     `json:"note,omitempty"`
+	// BalanceAfter is the user's balance in Currency once the entry was added
+	BalanceAfter decimal.Decimal `json:"balance_after"`
+	// CreatedBy is the admin who granted the credit
+	CreatedBy *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// PaymentAccount links a user to their customer and payment method at a payment provider
+type PaymentAccount struct {
+	UserID          uuid.UUID `json:"user_id"`
+	Provider        string    `json:"provider"`
+	CustomerID      string    `json:"customer_id"`
+	PaymentMethodID string    `json:"payment_method_id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// PaymentStatus is the outcome of a charge at the payment provider
+type PaymentStatus string
+
+const (
+	PaymentStatusPending        PaymentStatus = "pending"
+	PaymentStatusSucceeded      PaymentStatus = "succeeded"
+	PaymentStatusFailed         PaymentStatus = "failed"
+	PaymentStatusRequiresAction PaymentStatus = "requires_action"
+	PaymentStatusRefunded       PaymentStatus = "refunded"
+	PaymentStatusDisputed       PaymentStatus = "disputed"
+)
+
+// Payment is one charge attempt for a subscription
+type Payment struct {
+	ID             uuid.UUID  `json:"id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	SubscriptionID uuid.UUID  `json:"subscription_id"`
+	InvoiceID      *uuid.UUID `json:"invoice_id,omitempty"`
+	// Reason is the billing event the charge is for
+	Reason InvoiceReason `json:"reason"`
+	// Attempt numbers the charges made for the same billing event, starting at 1
+	Attempt  int    `json:"attempt"`
+	Provider string `json:"provider"`
+	// ProviderPaymentID is empty when the provider did not answer
+	ProviderPaymentID string          `json:"provider_payment_id,omitempty"`
+	Amount            decimal.Decimal `json:"amount"`
+	Currency          string          `json:"currency"`
+	// RefundedAmount is the part of Amount that was refunded
+	RefundedAmount decimal.Decimal `json:"refunded_amount"`
+	Status         PaymentStatus   `json:"status"`
+	FailureCode    string          `json:"failure_code,omitempty"`
+	FailureMessage string          `json:"failure_message,omitempty"`
+	// ExchangeRate converts the payment to the reporting currency; nil if no rate
+	// was known when it was made
+	ExchangeRate *ExchangeRateSnapshot `json:"exchange_rate,omitempty"`
+	CreatedAt    time.Time             `json:"created_at"`
+	UpdatedAt    time.Time             `json:"updated_at"`
+}
+
+// Refundable returns the part of a collected payment that has not been refunded yet
+func (p *Payment) Refundable() decimal.Decimal {
+	if p.Status != PaymentStatusSucceeded {
+		return decimal.Zero
+	}
+	return p.Amount.Sub(p.RefundedAmount)
+}
+
+// WebhookEventStatus is how far a received webhook event has been processed
+type WebhookEventStatus string
+
+const (
+	WebhookEventStatusReceived  WebhookEventStatus = "received"
+	WebhookEventStatusProcessed WebhookEventStatus = "processed"
+	// WebhookEventStatusIgnored is set for event types nothing handles
+	WebhookEventStatusIgnored WebhookEventStatus = "ignored"
+	WebhookEventStatusFailed  WebhookEventStatus = "failed"
+)
+
+// WebhookEvent is an event a payment provider sent to the webhook endpoint. It is
+// stored as received, so that it can be processed again.
+type WebhookEvent struct {
+	ID       uuid.UUID `json:"id"`
+	Provider string    `json:"provider"`
+	// EventID is the provider's ID of the event; each one is processed once
+	EventID     string             `json:"event_id"`
+	Type        string             `json:"type"`
+	Payload     []byte             `json:"payload"`
+	Status      WebhookEventStatus `json:"status"`
+	Attempts    int                `json:"attempts"`
+	LastError   string             `json:"last_error,omitempty"`
+	ReceivedAt  time.Time          `json:"received_at"`
+	ProcessedAt *time.Time         `json:"processed_at,omitempty"`
+}
+
+// VATValidationStatus is the outcome of a VAT ID check
+type VATValidationStatus string
+
+const (
+	VATValidationStatusValid   VATValidationStatus = "valid"
+	VATValidationStatusInvalid VATValidationStatus = "invalid"
+	// VATValidationStatusUnavailable is set when the online validator could not be
+	// reached; the VAT ID passed the offline check but is not accepted
+	VATValidationStatusUnavailable VATValidationStatus = "unavailable"
+)
+
+// VATValidation records a check of a buyer's VAT ID made when they bought something.
+// It is the evidence a reverse charge was granted on and is never changed.
+type VATValidation struct {
+	ID     uuid.UUID           `json:"id"`
+	UserID uuid.UUID           `json:"user_id"`
+	VATID  string              `json:"vat_id"`
+	Status VATValidationStatus `json:"status"`
+	// Source is the validator that decided the status, e.g. "offline" or "vies"
+	Source  string `json:"source"`
+	Message string `json:"message,omitempty"`
+	// Reference is the validator's identifier of the check, if it gives one
+	Reference string    `json:"reference,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// ExchangeRate is the value of one unit of the base currency in another currency on
+// a day, e.g. 1 EUR = 1.0465 USD. Rates are imported from a file; ECB rates have EUR
+// as their base.
+type ExchangeRate struct {
+	Date     time.Time       `json:"date"`
+	Base     string          `json:"base"`
+	Currency string          `json:"currency"`
+	Rate     decimal.Decimal `json:"rate"`
+	// Source is the kind of file the rate was imported from, "ecb" or "csv"
+	Source     string    `json:"source"`
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+// ExchangeRateSnapshot is the rate a financial record's amounts are converted to the
+// reporting currency with. It is stored with the record, so that reports keep
+// converting it the same way when rates are imported again.
+type ExchangeRateSnapshot struct {
+	ReportingCurrency string `json:"reporting_currency"`
+	// Rate is the value of one unit of the record's currency in the reporting currency
+	Rate decimal.Decimal `json:"rate"`
+	// Date is the day of the rate, the latest one on or before the record's date
+	Date time.Time `json:"date"`
+}
+
+// Convert returns an amount in the record's currency in the reporting currency,
+// rounded to its minor unit
+func (s *ExchangeRateSnapshot) Convert(amount decimal.Decimal) decimal.Decimal {
+	return currency.Round(amount.Mul(s.Rate), s.ReportingCurrency)
+}
+
+// LedgerAccount is an account of the double-entry ledger
+type LedgerAccount string
+
+const (
+	// LedgerAccountCash is money collected at the payment provider
+	LedgerAccountCash LedgerAccount = "cash"
+	// LedgerAccountReceivables is what customers owe for invoices that are not paid yet
+	LedgerAccountReceivables LedgerAccount = "receivables"
+	// LedgerAccountRevenue is revenue earned for periods that have ended
+	LedgerAccountRevenue LedgerAccount = "revenue"
+	// LedgerAccountDeferredRevenue is revenue invoiced for periods that have not ended
+	LedgerAccountDeferredRevenue LedgerAccount = "deferred_revenue"
+	// LedgerAccountTaxPayable is tax collected for the tax authorities
+	LedgerAccountTaxPayable LedgerAccount = "tax_payable"
+	// LedgerAccountDiscounts is the revenue given up for voucher discounts and
+	// granted credit
+	LedgerAccountDiscounts LedgerAccount = "discounts"
+	// LedgerAccountCustomerCredit is the credit balances customers can spend
+	LedgerAccountCustomerCredit LedgerAccount = "customer_credit"
+)
+
+// LedgerAccounts are all accounts in the order of the chart of accounts
+var LedgerAccounts = []LedgerAccount{
+	LedgerAccountCash,
+	LedgerAccountReceivables,
+	LedgerAccountDiscounts,
+	LedgerAccountDeferredRevenue,
+	LedgerAccountRevenue,
+	LedgerAccountTaxPayable,
+	LedgerAccountCustomerCredit,
+}
+
+// DebitNormal reports whether the account's balance is its debits less its credits.
+// Assets and contra-revenue accounts are debit normal, the others credit normal.
+func (a LedgerAccount) DebitNormal() bool {
+	switch a {
+	case LedgerAccountCash, LedgerAccountReceivables, LedgerAccountDiscounts:
+		return true
+	}
+	return false
+}
+
+// JournalEntryType is the business change a journal entry records
+type JournalEntryType string
+
+const (
+	JournalEntryTypeInvoice JournalEntryType = "invoice"
+	// JournalEntryTypePayment is a payment collected for an invoice
+	JournalEntryTypePayment JournalEntryType = "payment"
+	// JournalEntryTypePaymentReversal is a collected payment that failed or was
+	// disputed afterwards
+	JournalEntryTypePaymentReversal JournalEntryType = "payment_reversal"
+	JournalEntryTypeRefund          JournalEntryType = "refund"
+	JournalEntryTypeCreditGrant     JournalEntryType = "credit_grant"
+	// JournalEntryTypePlanChangeCredit is unused time on the previous plan added to
+	// the credit balance
+	JournalEntryTypePlanChangeCredit JournalEntryType = "plan_change_credit"
+	// JournalEntryTypeRevenueRecognition moves an invoice's deferred revenue to
+	// revenue when its period has ended
+	JournalEntryTypeRevenueRecognition JournalEntryType = "revenue_recognition"
+)
+
+// JournalEntry records a money movement as lines whose debits equal their credits.
+// All lines are in the entry's currency. Entries cannot be changed; a mistake is
+// corrected with another entry.
+type JournalEntry struct {
+	ID   uuid.UUID        `json:"id"`
+	Type JournalEntryType `json:"type"`
+	// ReferenceID is the invoice, payment, credit note or credit entry recorded
+	ReferenceID uuid.UUID `json:"reference_id"`
+	// InvoiceID is the invoice the entry is about, if any. An invoice's deferred
+	// revenue is the balance of the deferred revenue lines of its entries.
+	InvoiceID   *uuid.UUID     `json:"invoice_id,omitempty"`
+	UserID      *uuid.UUID     `json:"user_id,omitempty"`
+	Currency    string         `json:"currency"`
+	Description string         `json:"description"`
+	Lines       []*JournalLine `json:"lines"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// JournalLine debits or credits an account; exactly one of Debit and Credit is positive
+type JournalLine struct {
+	Account LedgerAccount   `json:"account"`
+	Debit   decimal.Decimal `json:"debit"`
+	Credit  decimal.Decimal `json:"credit"`
+}
+
+// Debit adds a line debiting the account, unless the amount is zero. A negative
+// amount credits the account instead.
+func (e *JournalEntry) Debit(account LedgerAccount, amount decimal.Decimal) {
+	switch {
+	case amount.IsPositive():
+		e.Lines = append(e.Lines, &JournalLine{Account: account, Debit: amount, Credit: decimal.Zero})
+	case amount.IsNegative():
+		e.Lines = append(e.Lines, &JournalLine{Account: account, Debit: decimal.Zero, Credit: amount.Neg()})
+	}
+}
+
+// Credit adds a line crediting the account, unless the amount is zero. A negative
+// amount debits the account instead.
+func (e *JournalEntry) Credit(account LedgerAccount, amount decimal.Decimal) {
+	e.Debit(account, amount.Neg())
+}
+
+// Totals returns the sums of the entry's debits and credits
+func (e *JournalEntry) Totals() (debits, credits decimal.Decimal) {
+	for _, line := range e.Lines {
+		debits = debits.Add(line.Debit)
+		credits = credits.Add(line.Credit)
+	}
+	return debits, credits
+}
+
+// IsBalanced reports whether the entry's debits equal its credits
+func (e *JournalEntry) IsBalanced() bool {
+	debits, credits := e.Totals()
+	return debits.Equal(credits)
+}
+
+// DeferredRevenue is the revenue of an invoice that is still deferred
+type DeferredRevenue struct {
+	InvoiceID uuid.UUID       `json:"invoice_id"`
+	UserID    uuid.UUID       `json:"user_id"`
+	Currency  string          `json:"currency"`
+	Amount    decimal.Decimal `json:"amount"`
+}
+
+// AccountTotals are the debits and credits posted to an account in a currency
+type AccountTotals struct {
+	Account  LedgerAccount   `json:"account"`
+	Currency string          `json:"currency"`
+	Debits   decimal.Decimal `json:"debits"`
+	Credits  decimal.Decimal `json:"credits"`
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/assylzhan-a/subscription-service/internal/app/auth"
 	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
 	"github.com/assylzhan-a/subscription-service/internal/middleware"
 	"github.com/assylzhan-a/subscription-service/internal/transport/dto"
 	"github.com/gin-gonic/gin"
@@ -23,7 +24,12 @@ func NewAuthHandler(authService *auth.Service) *AuthHandler {
 func (h *AuthHandler) RegisterRoutes(router *gin.RouterGroup) {
 	router.POST("/register", h.RegisterUser)
 	router.POST("/login", h.LoginUser)
+	router.POST("/refresh", h.RefreshToken)
+	router.POST("/logout", middleware.GetAuthMiddleware().Authenticate(), h.Logout)
 	router.GET("/me", middleware.GetAuthMiddleware().Authenticate(), h.GetMe)
+	router.PUT("/me/billing-address", middleware.GetAuthMiddleware().Authenticate(), h.UpdateBillingAddress)
+	router.PUT("/me/business-profile", middleware.GetAuthMiddleware().Authenticate(), h.UpdateBusinessProfile)
+	router.DELETE("/me/business-profile", middleware.GetAuthMiddleware().Authenticate(), h.RemoveBusinessProfile)
 }
 
 func (h *AuthHandler) RegisterUser(c *gin.Context) {
@@ -82,11 +88,68 @@ func (h *AuthHandler) LoginUser(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.LoginResponse{
-		User:      dto.MapUserToResponse(response.User),
-		Token:     response.Token,
-		ExpiresAt: response.ExpiresAt,
-	})
+	c.JSON(http.StatusOK, mapLoginResponse(response))
+}
+
+func (h *AuthHandler) RefreshToken(c *gin.Context) {
+	var req dto.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.authService.RefreshTokens(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		if err == errors.ErrInvalidRefreshToken || err == errors.ErrRefreshTokenReused {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapLoginResponse(response))
+}
+
+func (h *AuthHandler) Logout(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokenID, tokenExpiresAt, err := middleware.GetTokenID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The body is optional; without a refresh token only the access token is revoked
+	var req dto.LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	input := auth.LogoutInput{
+		UserID:         userID,
+		TokenID:        tokenID,
+		TokenExpiresAt: tokenExpiresAt,
+		RefreshToken:   req.RefreshToken,
+	}
+
+	if err := h.authService.Logout(c.Request.Context(), input); err != nil {
+		if err == errors.ErrInvalidRefreshToken {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
 }
 
 func (h *AuthHandler) GetMe(c *gin.Context) {
@@ -108,3 +171,114 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 
 	c.JSON(http.StatusOK, dto.MapUserToResponse(user))
 }
+
+// UpdateBillingAddress sets the address the user is billed at, which decides their taxes
+func (h *AuthHandler) UpdateBillingAddress(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req dto.BillingAddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input := auth.UpdateBillingAddressInput{
+		UserID: userID,
+		Address: models.Address{
+			Line1:      req.Line1,
+			Line2:      req.Line2,
+			City:       req.City,
+			PostalCode: req.PostalCode,
+			Region:     req.Region,
+			Country:    req.Country,
+		},
+	}
+
+	user, err := h.authService.UpdateBillingAddress(c.Request.Context(), input)
+	if err != nil {
+		if validationErrors, ok := err.(errors.ValidationErrors); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": validationErrors})
+			return
+		}
+		if err == errors.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapUserToResponse(user))
+}
+
+// UpdateBusinessProfile makes the user buy as a business, with a VAT ID if they have one
+func (h *AuthHandler) UpdateBusinessProfile(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req dto.BusinessProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input := auth.UpdateBusinessProfileInput{
+		UserID:      userID,
+		CompanyName: req.CompanyName,
+		VATID:       req.VATID,
+	}
+
+	user, err := h.authService.UpdateBusinessProfile(c.Request.Context(), input)
+	if err != nil {
+		if validationErrors, ok := err.(errors.ValidationErrors); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": validationErrors})
+			return
+		}
+		if err == errors.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapUserToResponse(user))
+}
+
+// RemoveBusinessProfile makes the user buy as a consumer again
+func (h *AuthHandler) RemoveBusinessProfile(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.authService.RemoveBusinessProfile(c.Request.Context(), userID)
+	if err != nil {
+		if err == errors.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapUserToResponse(user))
+}
+
+func mapLoginResponse(response *auth.LoginResponse) dto.LoginResponse {
+	return dto.LoginResponse{
+		User:                  dto.MapUserToResponse(response.User),
+		Token:                 response.Token,
+		ExpiresAt:             response.ExpiresAt,
+		RefreshToken:          response.RefreshToken,
+		RefreshTokenExpiresAt: response.RefreshTokenExpiresAt,
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/voucher"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/middleware"
+	"github.com/assylzhan-a/subscription-service/internal/transport/dto"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// defaultCodeLength is used when a code generation request sets no length
+const defaultCodeLength = 8
+
+type CampaignHandler struct {
+	voucherService *voucher.Service
+}
+
+func NewCampaignHandler(voucherService *voucher.Service) *CampaignHandler {
+	return &CampaignHandler{
+		voucherService: voucherService,
+	}
+}
+
+func (h *CampaignHandler) RegisterRoutes(router *gin.RouterGroup) {
+	// Campaign management for admins; support staff get read-only access
+	authMiddleware := middleware.GetAuthMiddleware()
+	adminRouter := router.Group("/admin/campaigns")
+	adminRouter.Use(authMiddleware.Authenticate(), authMiddleware.RequireRole(models.UserRoleAdmin, models.UserRoleSupport))
+	{
+		adminRouter.GET("", h.GetAllCampaigns)
+		adminRouter.GET("/:id", h.GetCampaignByID)
+		adminRouter.GET("/:id/codes.csv", h.ExportCodes)
+
+		requireAdmin := authMiddleware.RequireRole(models.UserRoleAdmin)
+		adminRouter.POST("", requireAdmin, h.CreateCampaign)
+		adminRouter.POST("/:id/codes", requireAdmin, h.GenerateCodes)
+	}
+}
+
+func (h *CampaignHandler) CreateCampaign(c *gin.Context) {
+	var req dto.CreateCampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var productID *uuid.UUID
+	if req.ProductID != nil {
+		id, err := uuid.Parse(*req.ProductID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+			return
+		}
+		productID = &id
+	}
+
+	// Campaign codes are single-use unless the request says otherwise
+	maxRedemptionsPerCode := 1
+	if req.MaxRedemptionsPerCode != nil {
+		maxRedemptionsPerCode = *req.MaxRedemptionsPerCode
+	}
+
+	input := voucher.CreateCampaignInput{
+		Name:                  req.Name,
+		DiscountType:          models.DiscountType(req.DiscountType),
+		DiscountValue:         req.DiscountValue,
+		Currency:              req.Currency,
+		ProductID:             productID,
+		ExpiresAt:             req.ExpiresAt,
+		DiscountDuration:      models.DiscountDuration(req.DiscountDuration),
+		DiscountPeriods:       req.DiscountPeriods,
+		MaxRedemptionsPerCode: maxRedemptionsPerCode,
+	}
+
+	campaign, err := h.voucherService.CreateCampaign(c.Request.Context(), input)
+	if err != nil {
+		if validationErrors, ok := err.(errors.ValidationErrors); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": validationErrors})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.MapCampaignToResponse(campaign))
+}
+
+func (h *CampaignHandler) GetAllCampaigns(c *gin.Context) {
+	campaigns, err := h.voucherService.GetAllCampaigns(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapCampaignsToResponse(campaigns))
+}
+
+func (h *CampaignHandler) GetCampaignByID(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid campaign ID"})
+		return
+	}
+
+	campaign, err := h.voucherService.GetCampaignByID(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrCampaignNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapCampaignToResponse(campaign))
+}
+
+func (h *CampaignHandler) GenerateCodes(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid campaign ID"})
+		return
+	}
+
+	var req dto.GenerateCodesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	length := req.Length
+	if length == 0 {
+		length = defaultCodeLength
+	}
+
+	input := voucher.GenerateCodesInput{
+		CampaignID: id,
+		Count:      req.Count,
+		Prefix:     req.Prefix,
+		Alphabet:   req.Alphabet,
+		Length:     length,
+	}
+
+	campaign, err := h.voucherService.GenerateCodes(c.Request.Context(), input)
+	if err != nil {
+		if validationErrors, ok := err.(errors.ValidationErrors); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": validationErrors})
+			return
+		}
+		if err == errors.ErrCampaignNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err == errors.ErrCodeSpaceExhausted {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.MapCampaignToResponse(campaign))
+}
+
+func (h *CampaignHandler) ExportCodes(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid campaign ID"})
+		return
+	}
+
+	campaign, err := h.voucherService.GetCampaignByID(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrCampaignNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="campaign-%s.csv"`, campaign.ID))
+	c.Status(http.StatusOK)
+
+	// The status is already sent, so a failure can only cut the file short
+	if err := h.voucherService.ExportCampaignCSV(c.Request.Context(), id, c.Writer); err != nil {
+		log.Printf("Failed to export campaign %s: %v", id, err)
+	}
+}
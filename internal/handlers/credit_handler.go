@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/credit"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/middleware"
+	"github.com/assylzhan-a/subscription-service/internal/transport/dto"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type CreditHandler struct {
+	creditService *credit.Service
+}
+
+func NewCreditHandler(creditService *credit.Service) *CreditHandler {
+	return &CreditHandler{
+		creditService: creditService,
+	}
+}
+
+func (h *CreditHandler) RegisterRoutes(router *gin.RouterGroup) {
+	authMiddleware := middleware.GetAuthMiddleware()
+
+	// Protected routes
+	creditRouter := router.Group("/credit")
+	creditRouter.Use(authMiddleware.Authenticate())
+	{
+		creditRouter.GET("", h.GetBalance)
+	}
+
+	adminRouter := router.Group("/admin/users")
+	adminRouter.Use(authMiddleware.Authenticate(), authMiddleware.RequireRole(models.UserRoleAdmin, models.UserRoleSupport))
+	{
+		adminRouter.GET("/:id/credit", h.GetUserBalance)
+
+		requireAdmin := authMiddleware.RequireRole(models.UserRoleAdmin)
+		adminRouter.POST("/:id/credit", requireAdmin, h.GrantCredit)
+	}
+}
+
+func (h *CreditHandler) GetBalance(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	balance, err := h.creditService.GetBalance(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapCreditBalanceResponse(balance))
+}
+
+func (h *CreditHandler) GetUserBalance(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	balance, err := h.creditService.GetBalance(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapCreditBalanceResponse(balance))
+}
+
+// GrantCredit adds credit to a user's balance
+func (h *CreditHandler) GrantCredit(c *gin.Context) {
+	actorID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var req dto.GrantCreditRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := h.creditService.Grant(c.Request.Context(), credit.GrantInput{
+		UserID:    id,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+		Note:      req.Note,
+		GrantedBy: actorID,
+	})
+	if err != nil {
+		if validationErrors, ok := err.(errors.ValidationErrors); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": validationErrors})
+			return
+		}
+		if err == errors.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.MapCreditEntryToResponse(entry))
+}
+
+func mapCreditBalanceResponse(balance *credit.Balance) dto.CreditBalanceResponse {
+	return dto.CreditBalanceResponse{
+		UserID:   balance.UserID.String(),
+		Balances: balance.Balances,
+		Entries:  dto.MapCreditEntriesToResponse(balance.Entries),
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/subscription"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/middleware"
+	"github.com/assylzhan-a/subscription-service/internal/transport/dto"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type CreditNoteHandler struct {
+	subscriptionService *subscription.Service
+}
+
+func NewCreditNoteHandler(subscriptionService *subscription.Service) *CreditNoteHandler {
+	return &CreditNoteHandler{
+		subscriptionService: subscriptionService,
+	}
+}
+
+func (h *CreditNoteHandler) RegisterRoutes(router *gin.RouterGroup) {
+	// Protected routes
+	creditNoteRouter := router.Group("")
+	creditNoteRouter.Use(middleware.GetAuthMiddleware().Authenticate())
+	{
+		creditNoteRouter.GET("", h.GetUserCreditNotes)
+		creditNoteRouter.GET("/:id", h.GetCreditNoteByID)
+	}
+}
+
+// RegisterAdminRoutes registers the routes for refunding invoices, under the admin invoices group
+func (h *CreditNoteHandler) RegisterAdminRoutes(router *gin.RouterGroup) {
+	authMiddleware := middleware.GetAuthMiddleware()
+	adminRouter := router.Group("")
+	adminRouter.Use(authMiddleware.Authenticate(), authMiddleware.RequireRole(models.UserRoleAdmin, models.UserRoleSupport))
+	{
+		adminRouter.GET("/:id/credit-notes", h.GetInvoiceCreditNotes)
+
+		requireAdmin := authMiddleware.RequireRole(models.UserRoleAdmin)
+		adminRouter.POST("/:id/refund", requireAdmin, h.RefundInvoice)
+	}
+}
+
+func (h *CreditNoteHandler) GetUserCreditNotes(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	creditNotes, err := h.subscriptionService.GetUserCreditNotes(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapCreditNotesToResponse(creditNotes))
+}
+
+func (h *CreditNoteHandler) GetCreditNoteByID(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credit note ID"})
+		return
+	}
+
+	creditNote, err := h.subscriptionService.GetCreditNoteByID(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrCreditNoteNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Ensure the credit note belongs to the authenticated user
+	if creditNote.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapCreditNoteToResponse(creditNote))
+}
+
+func (h *CreditNoteHandler) GetInvoiceCreditNotes(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice ID"})
+		return
+	}
+
+	creditNotes, err := h.subscriptionService.GetInvoiceCreditNotes(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrInvoiceNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapCreditNotesToResponse(creditNotes))
+}
+
+// RefundInvoice refunds all or part of an invoice's payment and issues a credit note
+func (h *CreditNoteHandler) RefundInvoice(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice ID"})
+		return
+	}
+
+	// The body is optional; without an amount the rest of the payment is refunded
+	var req dto.RefundInvoiceRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	creditNote, err := h.subscriptionService.RefundInvoice(c.Request.Context(), subscription.RefundInput{
+		InvoiceID: id,
+		Amount:    req.Amount,
+		Note:      req.Note,
+	})
+	if err != nil {
+		if validationErrors, ok := err.(errors.ValidationErrors); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": validationErrors})
+			return
+		}
+		switch err {
+		case errors.ErrInvoiceNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.ErrInvoiceNotRefundable, errors.ErrRefundExceedsPayment:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.MapCreditNoteToResponse(creditNote))
+}
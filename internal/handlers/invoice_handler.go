@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/invoice"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/middleware"
+	"github.com/assylzhan-a/subscription-service/internal/transport/dto"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type InvoiceHandler struct {
+	invoiceService *invoice.Service
+}
+
+func NewInvoiceHandler(invoiceService *invoice.Service) *InvoiceHandler {
+	return &InvoiceHandler{
+		invoiceService: invoiceService,
+	}
+}
+
+func (h *InvoiceHandler) RegisterRoutes(router *gin.RouterGroup) {
+	// Protected routes
+	invoiceRouter := router.Group("")
+	invoiceRouter.Use(middleware.GetAuthMiddleware().Authenticate())
+	{
+		invoiceRouter.GET("", h.GetUserInvoices)
+		invoiceRouter.GET("/:id", h.GetInvoiceByID)
+		invoiceRouter.GET("/:id/pdf", h.GetInvoicePDF)
+	}
+}
+
+func (h *InvoiceHandler) GetUserInvoices(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	invoices, err := h.invoiceService.GetUserInvoices(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapInvoicesToResponse(invoices))
+}
+
+func (h *InvoiceHandler) GetInvoiceByID(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice ID"})
+		return
+	}
+
+	invoice, err := h.invoiceService.GetInvoiceByID(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrInvoiceNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Ensure the invoice belongs to the authenticated user
+	if invoice.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapInvoiceToResponse(invoice))
+}
+
+func (h *InvoiceHandler) GetInvoicePDF(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice ID"})
+		return
+	}
+
+	invoice, err := h.invoiceService.GetInvoiceByID(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrInvoiceNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Ensure the invoice belongs to the authenticated user
+	if invoice.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	document, err := h.invoiceService.RenderInvoicePDF(c.Request.Context(), invoice)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, invoice.Number))
+	c.Data(http.StatusOK, "application/pdf", document)
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/assylzhan-a/subscription-service/pkg/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler struct {
+	jwtManager *jwt.Manager
+}
+
+func NewJWKSHandler(jwtManager *jwt.Manager) *JWKSHandler {
+	return &JWKSHandler{
+		jwtManager: jwtManager,
+	}
+}
+
+func (h *JWKSHandler) RegisterRoutes(router gin.IRoutes) {
+	router.GET("/.well-known/jwks.json", h.GetJWKS)
+}
+
+func (h *JWKSHandler) GetJWKS(c *gin.Context) {
+	// Allow verifiers to cache the key set, but short enough that rotated keys are picked up quickly
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.jwtManager.JWKS())
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/ledger"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/middleware"
+	"github.com/assylzhan-a/subscription-service/internal/transport/dto"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type LedgerHandler struct {
+	ledgerService *ledger.Service
+}
+
+func NewLedgerHandler(ledgerService *ledger.Service) *LedgerHandler {
+	return &LedgerHandler{
+		ledgerService: ledgerService,
+	}
+}
+
+func (h *LedgerHandler) RegisterRoutes(router *gin.RouterGroup) {
+	authMiddleware := middleware.GetAuthMiddleware()
+	adminRouter := router.Group("/admin/ledger")
+	adminRouter.Use(authMiddleware.Authenticate(), authMiddleware.RequireRole(models.UserRoleAdmin, models.UserRoleSupport))
+	{
+		adminRouter.GET("/trial-balance", h.GetTrialBalance)
+	}
+}
+
+// GetTrialBalance returns the trial balance at the end of the day as_of, or now if
+// none is given
+func (h *LedgerHandler) GetTrialBalance(c *gin.Context) {
+	asOf := time.Now()
+	if c.Query("as_of") != "" {
+		date, ok := parseDateQuery(c, "as_of")
+		if !ok {
+			return
+		}
+		asOf = date.AddDate(0, 0, 1)
+	}
+
+	trialBalance, err := h.ledgerService.GetTrialBalance(c.Request.Context(), asOf)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapTrialBalanceResponse(trialBalance))
+}
+
+func mapTrialBalanceResponse(trialBalance *ledger.TrialBalance) dto.TrialBalanceResponse {
+	response := dto.TrialBalanceResponse{
+		AsOf:              trialBalance.AsOf.UTC().Format(time.RFC3339),
+		Currencies:        make([]dto.CurrencyTrialBalanceResponse, len(trialBalance.Currencies)),
+		UnbalancedEntries: trialBalance.UnbalancedEntries,
+		Balanced:          trialBalance.Balanced,
+	}
+	if response.UnbalancedEntries == nil {
+		response.UnbalancedEntries = []uuid.UUID{}
+	}
+
+	for i, currency := range trialBalance.Currencies {
+		accounts := make([]dto.AccountBalanceResponse, len(currency.Accounts))
+		for j, account := range currency.Accounts {
+			accounts[j] = dto.AccountBalanceResponse{
+				Account: string(account.Account),
+				Debits:  account.Debits,
+				Credits: account.Credits,
+				Balance: account.Balance,
+			}
+		}
+
+		response.Currencies[i] = dto.CurrencyTrialBalanceResponse{
+			Currency: currency.Currency,
+			Accounts: accounts,
+			Debits:   currency.Debits,
+			Credits:  currency.Credits,
+			Balanced: currency.Balanced,
+		}
+	}
+
+	return response
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/payment"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/middleware"
+	"github.com/assylzhan-a/subscription-service/internal/transport/dto"
+	"github.com/gin-gonic/gin"
+)
+
+type PaymentHandler struct {
+	paymentService *payment.Service
+}
+
+func NewPaymentHandler(paymentService *payment.Service) *PaymentHandler {
+	return &PaymentHandler{
+		paymentService: paymentService,
+	}
+}
+
+func (h *PaymentHandler) RegisterRoutes(router *gin.RouterGroup) {
+	// Protected routes
+	paymentRouter := router.Group("")
+	paymentRouter.Use(middleware.GetAuthMiddleware().Authenticate())
+	{
+		paymentRouter.GET("", h.GetPaymentMethod)
+		paymentRouter.PUT("", h.SetPaymentMethod)
+	}
+}
+
+func (h *PaymentHandler) GetPaymentMethod(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := h.paymentService.GetPaymentMethod(c.Request.Context(), userID)
+	if err != nil {
+		if err == errors.ErrPaymentAccountNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no payment method on file"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapPaymentAccountToResponse(account))
+}
+
+// SetPaymentMethod replaces the payment method subscriptions are charged to
+func (h *PaymentHandler) SetPaymentMethod(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req dto.SetPaymentMethodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := h.paymentService.SetPaymentMethod(c.Request.Context(), payment.SetPaymentMethodInput{
+		UserID: userID,
+		Token:  req.Token,
+	})
+	if err != nil {
+		if validationErrors, ok := err.(errors.ValidationErrors); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": validationErrors})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapPaymentAccountToResponse(account))
+}
+
+// paymentErrorStatus returns the HTTP status for an error of a failed charge
+func paymentErrorStatus(err error) (int, bool) {
+	switch err {
+	case errors.ErrPaymentMethodRequired, errors.ErrPaymentDeclined, errors.ErrPaymentRequiresAction:
+		return http.StatusPaymentRequired, true
+	case errors.ErrPaymentTimeout:
+		return http.StatusGatewayTimeout, true
+	default:
+		return 0, false
+	}
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/assylzhan-a/subscription-service/internal/app/product"
 	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/middleware"
 	"github.com/assylzhan-a/subscription-service/internal/transport/dto"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -23,9 +25,16 @@ func NewProductHandler(productService *product.Service) *ProductHandler {
 func (h *ProductHandler) RegisterRoutes(router *gin.RouterGroup) {
 	router.GET("/products", h.GetAllProducts)
 	router.GET("/products/:id", h.GetProductByID)
-	router.POST("/products", h.CreateProduct)
-	router.PUT("/products/:id", h.UpdateProduct)
-	router.DELETE("/products/:id", h.DeleteProduct)
+
+	// Catalog management is restricted to admins
+	authMiddleware := middleware.GetAuthMiddleware()
+	adminRouter := router.Group("/products")
+	adminRouter.Use(authMiddleware.Authenticate(), authMiddleware.RequireRole(models.UserRoleAdmin))
+	{
+		adminRouter.POST("", h.CreateProduct)
+		adminRouter.PUT("/:id", h.UpdateProduct)
+		adminRouter.DELETE("/:id", h.DeleteProduct)
+	}
 }
 
 func (h *ProductHandler) GetAllProducts(c *gin.Context) {
@@ -66,12 +75,19 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 	}
 
 	input := product.CreateProductInput{
-		Name:           req.Name,
-		Description:    req.Description,
-		Price:          req.Price,
-		DurationMonths: req.DurationMonths,
-		TaxRate:        req.TaxRate,
-		IsActive:       req.IsActive,
+		Name:             req.Name,
+		Description:      req.Description,
+		Price:            req.Price,
+		DurationMonths:   req.DurationMonths,
+		TaxRate:          req.TaxRate,
+		IsActive:         req.IsActive,
+		MaxPauseDays:     req.MaxPauseDays,
+		RefundPolicy:     models.RefundPolicy(req.RefundPolicy),
+		RefundWindowDays: req.RefundWindowDays,
+		TaxCategory:      models.TaxCategory(req.TaxCategory),
+		TaxInclusive:     req.TaxInclusive,
+		Currency:         req.Currency,
+		Prices:           dto.MapProductPricesFromRequest(req.Prices),
 	}
 
 	createdProduct, err := h.productService.CreateProduct(c.Request.Context(), input)
@@ -101,13 +117,20 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	}
 
 	input := product.UpdateProductInput{
-		ID:             id,
-		Name:           req.Name,
-		Description:    req.Description,
-		Price:          req.Price,
-		DurationMonths: req.DurationMonths,
-		TaxRate:        req.TaxRate,
-		IsActive:       req.IsActive,
+		ID:               id,
+		Name:             req.Name,
+		Description:      req.Description,
+		Price:            req.Price,
+		DurationMonths:   req.DurationMonths,
+		TaxRate:          req.TaxRate,
+		IsActive:         req.IsActive,
+		MaxPauseDays:     req.MaxPauseDays,
+		RefundPolicy:     models.RefundPolicy(req.RefundPolicy),
+		RefundWindowDays: req.RefundWindowDays,
+		TaxCategory:      models.TaxCategory(req.TaxCategory),
+		TaxInclusive:     req.TaxInclusive,
+		Currency:         req.Currency,
+		Prices:           dto.MapProductPricesFromRequest(req.Prices),
 	}
 
 	updatedProduct, err := h.productService.UpdateProduct(c.Request.Context(), input)
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/exchange"
+	"github.com/assylzhan-a/subscription-service/internal/app/report"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/middleware"
+	"github.com/assylzhan-a/subscription-service/internal/transport/dto"
+	"github.com/gin-gonic/gin"
+)
+
+type ReportHandler struct {
+	reportService   *report.Service
+	exchangeService *exchange.Service
+}
+
+func NewReportHandler(reportService *report.Service, exchangeService *exchange.Service) *ReportHandler {
+	return &ReportHandler{
+		reportService:   reportService,
+		exchangeService: exchangeService,
+	}
+}
+
+func (h *ReportHandler) RegisterRoutes(router *gin.RouterGroup) {
+	authMiddleware := middleware.GetAuthMiddleware()
+	adminRouter := router.Group("/admin")
+	adminRouter.Use(authMiddleware.Authenticate(), authMiddleware.RequireRole(models.UserRoleAdmin, models.UserRoleSupport))
+	{
+		adminRouter.GET("/reports/revenue", h.GetRevenueReport)
+		adminRouter.GET("/exchange-rates", h.GetExchangeRates)
+	}
+}
+
+// GetRevenueReport reports the revenue from the day from up to but excluding the day
+// to in the reporting currency
+func (h *ReportHandler) GetRevenueReport(c *gin.Context) {
+	from, ok := parseDateQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseDateQuery(c, "to")
+	if !ok {
+		return
+	}
+
+	revenue, err := h.reportService.GetRevenueReport(c.Request.Context(), report.RevenueInput{
+		From: from,
+		To:   to,
+	})
+	if err != nil {
+		if validationErrors, ok := err.(errors.ValidationErrors); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": validationErrors})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapRevenueReportResponse(revenue))
+}
+
+// GetExchangeRates lists the rates imported for a day, today if none is given
+func (h *ReportHandler) GetExchangeRates(c *gin.Context) {
+	date := time.Now()
+	if c.Query("date") != "" {
+		var ok bool
+		if date, ok = parseDateQuery(c, "date"); !ok {
+			return
+		}
+	}
+
+	rates, err := h.exchangeService.GetRatesByDate(c.Request.Context(), date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapExchangeRatesToResponse(rates))
+}
+
+// parseDateQuery parses a YYYY-MM-DD query parameter as a day in UTC. It responds
+// with 400 Bad Request and returns false if the parameter is missing or invalid.
+func parseDateQuery(c *gin.Context, name string) (time.Time, bool) {
+	date, err := time.Parse(time.DateOnly, c.Query(name))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + " date, expected YYYY-MM-DD"})
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+func mapRevenueReportResponse(revenue *report.RevenueReport) dto.RevenueReportResponse {
+	response := dto.RevenueReportResponse{
+		From:              revenue.From.Format(time.DateOnly),
+		To:                revenue.To.Format(time.DateOnly),
+		ReportingCurrency: revenue.ReportingCurrency,
+		Totals:            mapRevenueAmountsResponse(revenue.Totals),
+		Currencies:        make([]dto.CurrencyRevenueResponse, len(revenue.Currencies)),
+		MissingRates:      make([]dto.MissingRateResponse, len(revenue.MissingRates)),
+	}
+
+	for i, currency := range revenue.Currencies {
+		response.Currencies[i] = dto.CurrencyRevenueResponse{
+			Currency:  currency.Currency,
+			Amounts:   mapRevenueAmountsResponse(currency.Amounts),
+			Converted: mapRevenueAmountsResponse(currency.Converted),
+		}
+	}
+
+	for i, missing := range revenue.MissingRates {
+		response.MissingRates[i] = dto.MissingRateResponse{
+			Currency: missing.Currency,
+			Date:     missing.Date.Format(time.DateOnly),
+		}
+	}
+
+	return response
+}
+
+func mapRevenueAmountsResponse(amounts report.Amounts) dto.RevenueAmountsResponse {
+	return dto.RevenueAmountsResponse{
+		Invoiced: amounts.Invoiced,
+		Refunded: amounts.Refunded,
+		Net:      amounts.Net,
+	}
+}
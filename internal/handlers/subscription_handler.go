@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/assylzhan-a/subscription-service/internal/app/subscription"
 	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
 	"github.com/assylzhan-a/subscription-service/internal/middleware"
 	"github.com/assylzhan-a/subscription-service/internal/transport/dto"
 	"github.com/gin-gonic/gin"
@@ -27,11 +29,27 @@ func (h *SubscriptionHandler) RegisterRoutes(router *gin.RouterGroup) {
 	subscriptionRouter.Use(middleware.GetAuthMiddleware().Authenticate())
 	{
 		subscriptionRouter.POST("", h.CreateSubscription)
+		subscriptionRouter.POST("/quote", h.QuoteSubscription)
 		subscriptionRouter.GET("", h.GetUserSubscriptions)
 		subscriptionRouter.GET("/:id", h.GetSubscriptionByID)
+		subscriptionRouter.GET("/:id/actions", h.GetAllowedActions)
 		subscriptionRouter.PATCH("/:id/pause", h.PauseSubscription)
 		subscriptionRouter.PATCH("/:id/unpause", h.UnpauseSubscription)
 		subscriptionRouter.PATCH("/:id/cancel", h.CancelSubscription)
+		subscriptionRouter.PATCH("/:id/undo-cancel", h.UndoCancellation)
+		subscriptionRouter.PATCH("/:id/auto-renew", h.UpdateAutoRenew)
+		subscriptionRouter.PATCH("/:id/plan", h.ChangePlan)
+		subscriptionRouter.GET("/:id/pauses", h.GetPauseHistory)
+	}
+}
+
+// RegisterAdminRoutes registers the routes support staff use to look into any subscription
+func (h *SubscriptionHandler) RegisterAdminRoutes(router *gin.RouterGroup) {
+	authMiddleware := middleware.GetAuthMiddleware()
+	adminRouter := router.Group("")
+	adminRouter.Use(authMiddleware.Authenticate(), authMiddleware.RequireRole(models.UserRoleAdmin, models.UserRoleSupport))
+	{
+		adminRouter.GET("/:id/pauses", h.GetAnyPauseHistory)
 	}
 }
 
@@ -54,10 +72,19 @@ func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
 		return
 	}
 
+	// Subscriptions renew automatically unless the client opts out
+	autoRenew := true
+	if req.AutoRenew != nil {
+		autoRenew = *req.AutoRenew
+	}
+
 	input := subscription.CreateSubscriptionInput{
-		UserID:    userID,
-		ProductID: productID,
-		WithTrial: req.WithTrial,
+		UserID:      userID,
+		ProductID:   productID,
+		VoucherCode: req.VoucherCode,
+		WithTrial:   req.WithTrial,
+		AutoRenew:   autoRenew,
+		Currency:    req.Currency,
 	}
 
 	createdSubscription, err := h.subscriptionService.CreateSubscription(c.Request.Context(), input)
@@ -70,10 +97,20 @@ func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 			return
 		}
-		if err == errors.ErrInactiveProduct {
+		if err == errors.ErrInactiveProduct || err == errors.ErrCurrencyNotSold {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if err == errors.ErrVoucherNotFound || err == errors.ErrVoucherInactive || err == errors.ErrVoucherExpired ||
+			err == errors.ErrVoucherInvalid || err == errors.ErrVoucherCurrency ||
+			err == errors.ErrVoucherRedemptionLimitReached || err == errors.ErrVoucherUserLimitReached {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if status, ok := paymentErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -81,6 +118,88 @@ func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
 	c.JSON(http.StatusCreated, dto.MapSubscriptionToResponse(createdSubscription))
 }
 
+// QuoteSubscription returns the price of a subscription without creating it
+func (h *SubscriptionHandler) QuoteSubscription(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req dto.QuoteSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	productID, err := uuid.Parse(req.ProductID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+
+	input := subscription.QuoteInput{
+		UserID:      userID,
+		ProductID:   productID,
+		VoucherCode: req.VoucherCode,
+		WithTrial:   req.WithTrial,
+		Currency:    req.Currency,
+	}
+
+	quote, err := h.subscriptionService.QuoteSubscription(c.Request.Context(), input)
+	if err != nil {
+		if validationErrors, ok := err.(errors.ValidationErrors); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": validationErrors})
+			return
+		}
+		if err == errors.ErrProductNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err == errors.ErrInactiveProduct || err == errors.ErrCurrencyNotSold {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err == errors.ErrVoucherNotFound || err == errors.ErrVoucherInactive || err == errors.ErrVoucherExpired ||
+			err == errors.ErrVoucherInvalid || err == errors.ErrVoucherCurrency || err == errors.ErrVoucherRedemptionLimitReached {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapQuoteResponse(quote))
+}
+
+func mapQuoteResponse(quote *subscription.Quote) dto.QuoteResponse {
+	response := dto.QuoteResponse{
+		Product:         dto.MapProductToResponse(quote.Product),
+		StartDate:       quote.StartDate,
+		EndDate:         quote.EndDate,
+		TrialEndDate:    quote.TrialEndDate,
+		Currency:        quote.Currency,
+		OriginalPrice:   quote.OriginalPrice,
+		Discount:        quote.Discount,
+		DiscountedPrice: quote.DiscountedPrice,
+		TaxAmount:       quote.TaxAmount,
+		TaxComponents:   dto.MapTaxComponentsToResponse(quote.TaxComponents),
+		TotalAmount:     quote.TotalAmount,
+		ReverseCharge:   quote.ReverseCharge,
+	}
+
+	if quote.Voucher != nil {
+		response.VoucherCode = &quote.Voucher.Code
+		response.DiscountDuration = string(quote.Voucher.DiscountDuration)
+		if quote.Voucher.DiscountDuration == models.DiscountDurationRepeating {
+			periods := quote.Voucher.DiscountPeriods
+			response.DiscountPeriods = &periods
+		}
+	}
+
+	return response
+}
+
 func (h *SubscriptionHandler) GetUserSubscriptions(c *gin.Context) {
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
@@ -129,6 +248,49 @@ func (h *SubscriptionHandler) GetSubscriptionByID(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.MapSubscriptionToResponse(subscription))
 }
 
+func (h *SubscriptionHandler) GetAllowedActions(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription ID"})
+		return
+	}
+
+	currentSubscription, err := h.subscriptionService.GetSubscriptionByID(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrSubscriptionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Ensure the subscription belongs to the authenticated user
+	if currentSubscription.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	actions := subscription.AllowedActions(currentSubscription, time.Now())
+
+	response := dto.AllowedActionsResponse{
+		SubscriptionID: currentSubscription.ID.String(),
+		Status:         string(currentSubscription.Status),
+		Actions:        make([]string, len(actions)),
+	}
+	for i, action := range actions {
+		response.Actions[i] = string(action)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 func (h *SubscriptionHandler) PauseSubscription(c *gin.Context) {
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
@@ -142,6 +304,15 @@ func (h *SubscriptionHandler) PauseSubscription(c *gin.Context) {
 		return
 	}
 
+	// The body is optional; without a resume date the pause is only limited by the product
+	var req dto.PauseSubscriptionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// Verify ownership
 	subscription, err := h.subscriptionService.GetSubscriptionByID(c.Request.Context(), id)
 	if err != nil {
@@ -158,20 +329,36 @@ func (h *SubscriptionHandler) PauseSubscription(c *gin.Context) {
 		return
 	}
 
-	if err := h.subscriptionService.PauseSubscription(c.Request.Context(), id); err != nil {
+	pausedSubscription, err := h.subscriptionService.PauseSubscriptionUntil(c.Request.Context(), id, req.ResumeAt)
+	if err != nil {
+		if validationErrors, ok := err.(errors.ValidationErrors); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": validationErrors})
+			return
+		}
 		if err == errors.ErrSubscriptionNotActive {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err == errors.ErrSubscriptionInTrial {
+		if err == errors.ErrSubscriptionInTrial || err == errors.ErrSubscriptionAlreadyPaused {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err == errors.ErrPauseTooLong {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if err == errors.ErrSubscriptionConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "subscription paused successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "subscription paused successfully",
+		"subscription": dto.MapSubscriptionToResponse(pausedSubscription),
+	})
 }
 
 func (h *SubscriptionHandler) UnpauseSubscription(c *gin.Context) {
@@ -204,10 +391,14 @@ func (h *SubscriptionHandler) UnpauseSubscription(c *gin.Context) {
 	}
 
 	if err := h.subscriptionService.UnpauseSubscription(c.Request.Context(), id); err != nil {
-		if err == errors.ErrSubscriptionAlreadyPaused {
+		if err == errors.ErrSubscriptionNotPaused {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if err == errors.ErrSubscriptionConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -228,6 +419,135 @@ func (h *SubscriptionHandler) CancelSubscription(c *gin.Context) {
 		return
 	}
 
+	// The body is optional; without it the subscription is cancelled immediately
+	var req dto.CancelSubscriptionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Verify ownership
+	currentSubscription, err := h.subscriptionService.GetSubscriptionByID(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrSubscriptionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if currentSubscription.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	mode := subscription.CancelImmediately
+	if req.Mode != "" {
+		mode = subscription.CancelMode(req.Mode)
+	}
+
+	cancelledSubscription, err := h.subscriptionService.Cancel(c.Request.Context(), subscription.CancelSubscriptionInput{
+		SubscriptionID: id,
+		Mode:           mode,
+		Reason:         req.Reason,
+		Feedback:       models.CancellationFeedback(req.Feedback),
+	})
+	if err != nil {
+		if validationErrors, ok := err.(errors.ValidationErrors); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": validationErrors})
+			return
+		}
+		if err == errors.ErrSubscriptionNotActive || err == errors.ErrCancellationAlreadyScheduled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err == errors.ErrSubscriptionConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	message := "subscription cancelled successfully"
+	if cancelledSubscription.CancelAtPeriodEnd {
+		message = "subscription will be cancelled at the end of the period"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      message,
+		"subscription": dto.MapSubscriptionToResponse(cancelledSubscription),
+	})
+}
+
+func (h *SubscriptionHandler) UndoCancellation(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription ID"})
+		return
+	}
+
+	// Verify ownership
+	subscription, err := h.subscriptionService.GetSubscriptionByID(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrSubscriptionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if subscription.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	updatedSubscription, err := h.subscriptionService.UndoCancellation(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrCancellationNotScheduled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err == errors.ErrSubscriptionConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapSubscriptionToResponse(updatedSubscription))
+}
+
+func (h *SubscriptionHandler) UpdateAutoRenew(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription ID"})
+		return
+	}
+
+	var req dto.UpdateAutoRenewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Verify ownership
 	subscription, err := h.subscriptionService.GetSubscriptionByID(c.Request.Context(), id)
 	if err != nil {
@@ -244,10 +564,180 @@ func (h *SubscriptionHandler) CancelSubscription(c *gin.Context) {
 		return
 	}
 
-	if err := h.subscriptionService.CancelSubscription(c.Request.Context(), id); err != nil {
+	updatedSubscription, err := h.subscriptionService.SetAutoRenew(c.Request.Context(), id, *req.AutoRenew)
+	if err != nil {
+		if err == errors.ErrSubscriptionNotActive {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err == errors.ErrSubscriptionConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapSubscriptionToResponse(updatedSubscription))
+}
+
+func (h *SubscriptionHandler) ChangePlan(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription ID"})
+		return
+	}
+
+	var req dto.ChangePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	productID, err := uuid.Parse(req.ProductID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+
+	// Verify ownership
+	currentSubscription, err := h.subscriptionService.GetSubscriptionByID(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrSubscriptionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "subscription cancelled successfully"})
+	if currentSubscription.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	mode := subscription.PlanChangeImmediately
+	if req.Mode != "" {
+		mode = subscription.PlanChangeMode(req.Mode)
+	}
+
+	change, err := h.subscriptionService.ChangePlan(c.Request.Context(), subscription.ChangePlanInput{
+		SubscriptionID: id,
+		ProductID:      productID,
+		Mode:           mode,
+	})
+	if err != nil {
+		if validationErrors, ok := err.(errors.ValidationErrors); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": validationErrors})
+			return
+		}
+		if err == errors.ErrProductNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err == errors.ErrSubscriptionNotActive || err == errors.ErrSubscriptionSamePlan ||
+			err == errors.ErrInactiveProduct || err == errors.ErrCurrencyNotSold {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err == errors.ErrSubscriptionConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if status, ok := paymentErrorStatus(err); ok {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapPlanChangeResponse(change))
+}
+
+func mapPlanChangeResponse(change *subscription.PlanChange) dto.PlanChangeResponse {
+	return dto.PlanChangeResponse{
+		Subscription:    dto.MapSubscriptionToResponse(change.Subscription),
+		Mode:            string(change.Mode),
+		EffectiveAt:     change.EffectiveAt,
+		Credit:          change.Credit,
+		Charge:          change.Charge,
+		AmountDue:       change.AmountDue,
+		TaxAmount:       change.TaxAmount,
+		TaxComponents:   dto.MapTaxComponentsToResponse(change.TaxComponents),
+		TotalDue:        change.TotalDue,
+		CreditToBalance: change.CreditToBalance,
+	}
+}
+
+func (h *SubscriptionHandler) GetPauseHistory(c *gin.Context) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription ID"})
+		return
+	}
+
+	// Verify ownership
+	subscription, err := h.subscriptionService.GetSubscriptionByID(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrSubscriptionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if subscription.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	h.respondWithPauseHistory(c, id)
+}
+
+func (h *SubscriptionHandler) GetAnyPauseHistory(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription ID"})
+		return
+	}
+
+	h.respondWithPauseHistory(c, id)
+}
+
+func (h *SubscriptionHandler) respondWithPauseHistory(c *gin.Context, id uuid.UUID) {
+	history, err := h.subscriptionService.GetPauseHistory(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrSubscriptionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	response := dto.PauseHistoryResponse{
+		SubscriptionID:  id.String(),
+		TotalDaysPaused: dto.DurationInDays(history.TotalPaused),
+		Pauses:          make([]dto.SubscriptionPauseResponse, len(history.Pauses)),
+	}
+	for i, pause := range history.Pauses {
+		response.Pauses[i] = dto.MapPauseToResponse(pause, now)
+	}
+
+	c.JSON(http.StatusOK, response)
 }
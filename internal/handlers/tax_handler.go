@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/tax"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/middleware"
+	"github.com/assylzhan-a/subscription-service/internal/transport/dto"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type TaxHandler struct {
+	taxService *tax.Service
+}
+
+func NewTaxHandler(taxService *tax.Service) *TaxHandler {
+	return &TaxHandler{
+		taxService: taxService,
+	}
+}
+
+func (h *TaxHandler) RegisterRoutes(router *gin.RouterGroup) {
+	authMiddleware := middleware.GetAuthMiddleware()
+	adminRouter := router.Group("/admin/users")
+	adminRouter.Use(authMiddleware.Authenticate(), authMiddleware.RequireRole(models.UserRoleAdmin, models.UserRoleSupport))
+	{
+		adminRouter.GET("/:id/vat-validations", h.GetUserVATValidations)
+	}
+}
+
+// GetUserVATValidations lists the checks of a user's VAT IDs made at purchase time
+func (h *TaxHandler) GetUserVATValidations(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	validations, err := h.taxService.GetUserVATValidations(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	responses := make([]dto.VATValidationResponse, len(validations))
+	for i, validation := range validations {
+		responses[i] = dto.MapVATValidationToResponse(validation)
+	}
+
+	c.JSON(http.StatusOK, responses)
+}
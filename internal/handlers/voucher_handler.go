@@ -29,16 +29,20 @@ func (h *VoucherHandler) RegisterRoutes(router *gin.RouterGroup) {
 		publicRouter.POST("/validate", h.ValidateVoucher)
 	}
 
-	// potential admin routes for voucher management
+	// Admin routes for voucher management; support staff get read-only access
+	authMiddleware := middleware.GetAuthMiddleware()
 	adminRouter := router.Group("/admin/vouchers")
-	adminRouter.Use(middleware.GetAuthMiddleware().Authenticate())
+	adminRouter.Use(authMiddleware.Authenticate(), authMiddleware.RequireRole(models.UserRoleAdmin, models.UserRoleSupport))
 	{
-		adminRouter.POST("", h.CreateVoucher)
 		adminRouter.GET("", h.GetAllVouchers)
 		adminRouter.GET("/:id", h.GetVoucherByID)
+		adminRouter.GET("/:id/redemptions", h.GetVoucherRedemptions)
 		adminRouter.GET("/product/:id", h.GetVouchersByProductID)
-		adminRouter.PUT("/:id", h.UpdateVoucher)
-		adminRouter.DELETE("/:id", h.DeleteVoucher)
+
+		requireAdmin := authMiddleware.RequireRole(models.UserRoleAdmin)
+		adminRouter.POST("", requireAdmin, h.CreateVoucher)
+		adminRouter.PUT("/:id", requireAdmin, h.UpdateVoucher)
+		adminRouter.DELETE("/:id", requireAdmin, h.DeleteVoucher)
 	}
 }
 
@@ -58,6 +62,7 @@ func (h *VoucherHandler) ValidateVoucher(c *gin.Context) {
 	input := voucher.ValidateVoucherInput{
 		Code:      req.Code,
 		ProductID: productID,
+		Currency:  req.Currency,
 	}
 
 	voucherObj, err := h.voucherService.ValidateVoucher(c.Request.Context(), input)
@@ -97,9 +102,16 @@ func (h *VoucherHandler) CreateVoucher(c *gin.Context) {
 		Code:          req.Code,
 		DiscountType:  models.DiscountType(req.DiscountType),
 		DiscountValue: req.DiscountValue,
+		Currency:      req.Currency,
 		ProductID:     productID,
 		ExpiresAt:     req.ExpiresAt,
 		IsActive:      req.IsActive,
+
+		DiscountDuration: models.DiscountDuration(req.DiscountDuration),
+		DiscountPeriods:  req.DiscountPeriods,
+
+		MaxRedemptions:        req.MaxRedemptions,
+		MaxRedemptionsPerUser: req.MaxRedemptionsPerUser,
 	}
 
 	createdVoucher, err := h.voucherService.CreateVoucher(c.Request.Context(), input)
@@ -145,6 +157,26 @@ func (h *VoucherHandler) GetVoucherByID(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.MapVoucherToResponse(voucherObj))
 }
 
+func (h *VoucherHandler) GetVoucherRedemptions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid voucher ID"})
+		return
+	}
+
+	voucherObj, redemptions, err := h.voucherService.GetRedemptions(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrVoucherNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapVoucherRedemptionsToResponse(voucherObj, redemptions))
+}
+
 func (h *VoucherHandler) GetVouchersByProductID(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -189,9 +221,16 @@ func (h *VoucherHandler) UpdateVoucher(c *gin.Context) {
 		Code:          req.Code,
 		DiscountType:  models.DiscountType(req.DiscountType),
 		DiscountValue: req.DiscountValue,
+		Currency:      req.Currency,
 		ProductID:     productID,
 		ExpiresAt:     req.ExpiresAt,
 		IsActive:      req.IsActive,
+
+		DiscountDuration: models.DiscountDuration(req.DiscountDuration),
+		DiscountPeriods:  req.DiscountPeriods,
+
+		MaxRedemptions:        req.MaxRedemptions,
+		MaxRedemptionsPerUser: req.MaxRedemptionsPerUser,
 	}
 
 	updatedVoucher, err := h.voucherService.UpdateVoucher(c.Request.Context(), input)
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/assylzhan-a/subscription-service/internal/app/webhook"
+	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/assylzhan-a/subscription-service/internal/middleware"
+	"github.com/assylzhan-a/subscription-service/internal/transport/dto"
+	signature "github.com/assylzhan-a/subscription-service/pkg/webhook"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxWebhookBodyBytes limits the size of a webhook payload
+const maxWebhookBodyBytes = 1 << 20
+
+type WebhookHandler struct {
+	webhookService *webhook.Service
+}
+
+func NewWebhookHandler(webhookService *webhook.Service) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// RegisterRoutes registers the endpoint payment providers send webhooks to. It is
+// authenticated by the payload's signature instead of a token.
+func (h *WebhookHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/payments/:provider", h.ReceivePaymentEvent)
+}
+
+// RegisterAdminRoutes registers the routes for inspecting and replaying received events
+func (h *WebhookHandler) RegisterAdminRoutes(router *gin.RouterGroup) {
+	authMiddleware := middleware.GetAuthMiddleware()
+	adminRouter := router.Group("")
+	adminRouter.Use(authMiddleware.Authenticate(), authMiddleware.RequireRole(models.UserRoleAdmin, models.UserRoleSupport))
+	{
+		adminRouter.GET("", h.ListEvents)
+		adminRouter.GET("/:id", h.GetEvent)
+
+		requireAdmin := authMiddleware.RequireRole(models.UserRoleAdmin)
+		adminRouter.POST("/replay", requireAdmin, h.ReplayFailedEvents)
+		adminRouter.POST("/:id/replay", requireAdmin, h.ReplayEvent)
+	}
+}
+
+func (h *WebhookHandler) ReceivePaymentEvent(c *gin.Context) {
+	payload, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodyBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read payload"})
+		return
+	}
+
+	event, err := h.webhookService.Receive(c.Request.Context(), webhook.ReceiveInput{
+		Provider:  c.Param("provider"),
+		Payload:   payload,
+		Signature: c.GetHeader(signature.SignatureHeader),
+	})
+	if err != nil {
+		switch err {
+		case errors.ErrUnknownPaymentProvider:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.ErrInvalidWebhookSignature, errors.ErrInvalidWebhookPayload:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			// The provider retries the event, which is then processed again
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": event.ID, "status": event.Status})
+}
+
+func (h *WebhookHandler) ListEvents(c *gin.Context) {
+	limit, ok := limitQuery(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	events, err := h.webhookService.ListEvents(c.Request.Context(), models.WebhookEventStatus(c.Query("status")), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapWebhookEventsToResponse(events))
+}
+
+func (h *WebhookHandler) GetEvent(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event ID"})
+		return
+	}
+
+	event, err := h.webhookService.GetEvent(c.Request.Context(), id)
+	if err != nil {
+		if err == errors.ErrWebhookEventNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapWebhookEventToResponse(event))
+}
+
+// ReplayEvent processes a stored event again
+func (h *WebhookHandler) ReplayEvent(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event ID"})
+		return
+	}
+
+	event, err := h.webhookService.Replay(c.Request.Context(), id)
+	if err != nil {
+		switch err {
+		case errors.ErrWebhookEventNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.ErrUnknownPaymentProvider, errors.ErrInvalidWebhookPayload:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			if event != nil {
+				// The failure is stored on the event
+				c.JSON(http.StatusOK, dto.MapWebhookEventToResponse(event))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MapWebhookEventToResponse(event))
+}
+
+// ReplayFailedEvents processes the events whose processing failed again
+func (h *WebhookHandler) ReplayFailedEvents(c *gin.Context) {
+	limit, ok := limitQuery(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	summary, err := h.webhookService.ReplayFailed(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// limitQuery reads the optional limit query parameter; 0 means the service's default
+func limitQuery(c *gin.Context) (int, bool) {
+	value := c.Query("limit")
+	if value == "" {
+		return 0, true
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, false
+	}
+	return limit, true
+}
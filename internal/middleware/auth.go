@@ -1,21 +1,35 @@
 package middleware
 
 import (
+	"context"
 	"strings"
+	"time"
 
 	"github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
 	"github.com/assylzhan-a/subscription-service/pkg/jwt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+// TokenChecker checks an access token against the current state of its user
+type TokenChecker interface {
+	// IsTokenRevoked reports whether an access token has been revoked by its ID (jti)
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+	// GetUserRole returns the user's current role, which may have changed since the
+	// token was issued
+	GetUserRole(ctx context.Context, userID uuid.UUID) (models.UserRole, error)
+}
+
 type AuthMiddleware struct {
-	jwtManager *jwt.Manager
+	jwtManager   *jwt.Manager
+	tokenChecker TokenChecker
 }
 
-func NewAuthMiddleware(jwtManager *jwt.Manager) *AuthMiddleware {
+func NewAuthMiddleware(jwtManager *jwt.Manager, tokenChecker TokenChecker) *AuthMiddleware {
 	return &AuthMiddleware{
-		jwtManager: jwtManager,
+		jwtManager:   jwtManager,
+		tokenChecker: tokenChecker,
 	}
 }
 
@@ -41,8 +55,53 @@ func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 			return
 		}
 
-		// Set user ID in context for handlers to use
+		revoked, err := m.tokenChecker.IsTokenRevoked(c.Request.Context(), claims.ID)
+		if err != nil {
+			c.AbortWithStatusJSON(500, gin.H{"error": "failed to verify token"})
+			return
+		}
+		if revoked {
+			c.AbortWithStatusJSON(401, gin.H{"error": errors.ErrTokenRevoked.Error()})
+			return
+		}
+
+		// The role in the token is the one it was issued with; a changed role applies at once
+		role, err := m.tokenChecker.GetUserRole(c.Request.Context(), claims.UserID)
+		if err != nil {
+			if err == errors.ErrUserNotFound {
+				c.AbortWithStatusJSON(401, gin.H{"error": "invalid token"})
+				return
+			}
+			c.AbortWithStatusJSON(500, gin.H{"error": "failed to verify token"})
+			return
+		}
+
+		// Set user ID, role and token details in context for handlers to use
 		c.Set("userID", claims.UserID)
+		c.Set("userRole", role)
+		c.Set("tokenID", claims.ID)
+		if claims.ExpiresAt != nil {
+			c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
+		}
+
+		c.Next()
+	}
+}
+
+// RequireRole only lets requests through when the authenticated user has one of the given roles.
+// It must be chained after Authenticate.
+func (m *AuthMiddleware) RequireRole(roles ...models.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, err := GetUserRole(c)
+		if err != nil {
+			c.AbortWithStatusJSON(401, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !role.OneOf(roles...) {
+			c.AbortWithStatusJSON(403, gin.H{"error": errors.ErrForbidden.Error()})
+			return
+		}
 
 		c.Next()
 	}
@@ -56,3 +115,25 @@ func GetUserID(c *gin.Context) (uuid.UUID, error) {
 
 	return userID.(uuid.UUID), nil
 }
+
+func GetUserRole(c *gin.Context) (models.UserRole, error) {
+	role, exists := c.Get("userRole")
+	if !exists {
+		return "", errors.ErrUnauthorized
+	}
+
+	return role.(models.UserRole), nil
+}
+
+// GetTokenID returns the ID (jti) and expiry of the access token used for the request
+func GetTokenID(c *gin.Context) (string, time.Time, error) {
+	tokenID, exists := c.Get("tokenID")
+	if !exists {
+		return "", time.Time{}, errors.ErrUnauthorized
+	}
+
+	expiresAt, _ := c.Get("tokenExpiresAt")
+	expiresAtTime, _ := expiresAt.(time.Time)
+
+	return tokenID.(string), expiresAtTime, nil
+}
@@ -7,8 +7,8 @@ import (
 var authMiddleware *AuthMiddleware
 
 // InitAuthMiddleware initializes the global auth middleware
-func InitAuthMiddleware(jwtManager *jwt.Manager) {
-	authMiddleware = NewAuthMiddleware(jwtManager)
+func InitAuthMiddleware(jwtManager *jwt.Manager, tokenChecker TokenChecker) {
+	authMiddleware = NewAuthMiddleware(jwtManager, tokenChecker)
 }
 
 func GetAuthMiddleware() *AuthMiddleware {
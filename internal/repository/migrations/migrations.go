@@ -6,8 +6,9 @@ import (
 	"log"
 )
 
-// Migrate performs database migrations
-func Migrate(db *sql.DB) error {
+// Migrate performs database migrations. Existing rows are migrated to
+// defaultCurrency when amounts get a currency.
+func Migrate(db *sql.DB, defaultCurrency string) error {
 	log.Println("Running database migrations...")
 
 	// Create migrations table if not exists
@@ -40,6 +41,102 @@ func Migrate(db *sql.DB) error {
 			name: "05_create_subscription_state_changes_table",
 			up:   createSubscriptionStateChangesTable,
 		},
+		{
+			name: "06_add_role_to_users",
+			up:   addRoleToUsers,
+		},
+		{
+			name: "07_create_refresh_tokens_table",
+			up:   createRefreshTokensTable,
+		},
+		{
+			name: "08_create_revoked_access_tokens_table",
+			up:   createRevokedAccessTokensTable,
+		},
+		{
+			name: "09_add_renewal_columns_to_subscriptions",
+			up:   addRenewalColumnsToSubscriptions,
+		},
+		{
+			name: "10_add_scheduled_product_to_subscriptions",
+			up:   addScheduledProductToSubscriptions,
+		},
+		{
+			name: "11_add_pause_scheduling",
+			up:   addPauseScheduling,
+		},
+		{
+			name: "12_add_cancellation_columns",
+			up:   addCancellationColumns,
+		},
+		{
+			name: "13_move_trials_to_trialing_status",
+			up:   moveTrialsToTrialingStatus,
+		},
+		{
+			name: "14_add_subscription_version",
+			up:   addSubscriptionVersion,
+		},
+		{
+			name: "15_add_voucher_redemptions",
+			up:   addVoucherRedemptions,
+		},
+		{
+			name: "16_add_campaigns",
+			up:   addCampaigns,
+		},
+		{
+			name: "17_add_discount_durations",
+			up:   addDiscountDurations,
+		},
+		{
+			name: "18_add_invoices",
+			up:   addInvoices,
+		},
+		{
+			name: "19_create_payments_tables",
+			up:   createPaymentsTables,
+		},
+		{
+			name: "20_add_webhook_events",
+			up:   addWebhookEvents,
+		},
+		{
+			name: "21_add_dunning",
+			up:   addDunning,
+		},
+		{
+			name: "22_add_refunds",
+			up:   addRefunds,
+		},
+		{
+			name: "23_add_credit_balances",
+			up:   addCreditBalances,
+		},
+		{
+			name: "24_add_tax_engine",
+			up:   addTaxEngine,
+		},
+		{
+			name: "25_add_vat_reverse_charge",
+			up:   addVATReverseCharge,
+		},
+		{
+			name: "26_add_currencies",
+			up:   addCurrencies,
+		},
+		{
+			name: "27_add_exchange_rates",
+			up:   addExchangeRates,
+		},
+		{
+			name: "28_add_ledger",
+			up:   addLedger,
+		},
+		{
+			name: "29_keep_payments_without_subscription",
+			up:   keepPaymentsWithoutSubscription,
+		},
 	}
 
 	// Begin transaction
@@ -49,6 +146,11 @@ func Migrate(db *sql.DB) error {
 	}
 	defer tx.Rollback()
 
+	// Migrations read settings with current_setting; they only last for the transaction
+	if _, err := tx.Exec("SELECT set_config('app.default_currency', $1, true)", defaultCurrency); err != nil {
+		return fmt.Errorf("failed to set migration settings: %w", err)
+	}
+
 	// Execute migrations
 	for _, migration := range migrations {
 		// Check if migration has already been applied
@@ -166,4 +268,532 @@ const (
 			reason TEXT
 		)
 	`
+
+	addRoleToUsers = `
+		ALTER TABLE users
+		ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'customer'
+	`
+
+	createRefreshTokensTable = `
+		CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id UUID PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users(id),
+			family_id UUID NOT NULL,
+			token_hash VARCHAR(64) NOT NULL UNIQUE,
+			expires_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP NULL,
+			replaced_by UUID NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+	`
+
+	createRevokedAccessTokensTable = `
+		CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+			token_id VARCHAR(64) PRIMARY KEY,
+			expires_at TIMESTAMP NOT NULL
+		)
+	`
+
+	addRenewalColumnsToSubscriptions = `
+		ALTER TABLE subscriptions
+			ADD COLUMN IF NOT EXISTS auto_renew BOOLEAN NOT NULL DEFAULT TRUE,
+			ADD COLUMN IF NOT EXISTS renewal_locked_until TIMESTAMP NULL;
+		CREATE INDEX IF NOT EXISTS idx_subscriptions_status_end_date ON subscriptions(status, end_date);
+	`
+
+	addScheduledProductToSubscriptions = `
+		ALTER TABLE subscriptions
+			ADD COLUMN IF NOT EXISTS scheduled_product_id UUID NULL REFERENCES products(id);
+	`
+
+	addPauseScheduling = `
+		ALTER TABLE products
+			ADD COLUMN IF NOT EXISTS max_pause_days INT NOT NULL DEFAULT 0;
+		ALTER TABLE subscriptions
+			ADD COLUMN IF NOT EXISTS paused_at TIMESTAMP NULL,
+			ADD COLUMN IF NOT EXISTS resume_at TIMESTAMP NULL;
+		CREATE INDEX IF NOT EXISTS idx_subscriptions_status_resume_at ON subscriptions(status, resume_at);
+		CREATE TABLE IF NOT EXISTS subscription_pauses (
+			id UUID PRIMARY KEY,
+			subscription_id UUID NOT NULL REFERENCES subscriptions(id),
+			paused_at TIMESTAMP NOT NULL,
+			scheduled_resume_at TIMESTAMP NULL,
+			resumed_at TIMESTAMP NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_subscription_pauses_subscription_id ON subscription_pauses(subscription_id);
+	`
+
+	addCancellationColumns = `
+		ALTER TABLE subscriptions
+			ADD COLUMN IF NOT EXISTS cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
+			ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP NULL;
+		ALTER TABLE subscription_state_changes
+			ADD COLUMN IF NOT EXISTS cancellation_reason TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS feedback_category VARCHAR(50) NOT NULL DEFAULT '';
+	`
+
+	moveTrialsToTrialingStatus = `
+		UPDATE subscriptions
+		SET status = 'trialing'
+		WHERE status = 'active' AND trial_end_date > NOW();
+		CREATE INDEX IF NOT EXISTS idx_subscriptions_status_trial_end_date ON subscriptions(status, trial_end_date);
+	`
+
+	addSubscriptionVersion = `
+		ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+	`
+
+	addVoucherRedemptions = `
+		ALTER TABLE vouchers
+			ADD COLUMN IF NOT EXISTS max_redemptions INT NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS max_redemptions_per_user INT NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS redemption_count INT NOT NULL DEFAULT 0;
+		CREATE TABLE IF NOT EXISTS voucher_redemptions (
+			id UUID PRIMARY KEY,
+			voucher_id UUID NOT NULL REFERENCES vouchers(id),
+			user_id UUID NOT NULL REFERENCES users(id),
+			subscription_id UUID NOT NULL REFERENCES subscriptions(id),
+			discount_amount DECIMAL(10, 2) NOT NULL,
+			redeemed_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_voucher_redemptions_voucher_user ON voucher_redemptions(voucher_id, user_id);
+		INSERT INTO voucher_redemptions (id, voucher_id, user_id, subscription_id, discount_amount, redeemed_at)
+		SELECT gen_random_uuid(), voucher_id, user_id, id, original_price - COALESCE(discounted_price, original_price), created_at
+		FROM subscriptions
+		WHERE voucher_id IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM voucher_redemptions r WHERE r.subscription_id = subscriptions.id);
+		UPDATE vouchers v
+		SET redemption_count = (SELECT COUNT(*) FROM voucher_redemptions r WHERE r.voucher_id = v.id);
+	`
+
+	addCampaigns = `
+		CREATE TABLE IF NOT EXISTS campaigns (
+			id UUID PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			discount_type VARCHAR(10) NOT NULL,
+			discount_value DECIMAL(10, 2) NOT NULL,
+			product_id UUID NULL REFERENCES products(id),
+			expires_at TIMESTAMP NOT NULL,
+			max_redemptions_per_code INT NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);
+		ALTER TABLE vouchers
+			ADD COLUMN IF NOT EXISTS campaign_id UUID NULL REFERENCES campaigns(id);
+		CREATE INDEX IF NOT EXISTS idx_vouchers_campaign_id ON vouchers(campaign_id);
+	`
+
+	addDiscountDurations = `
+		ALTER TABLE vouchers
+			ADD COLUMN IF NOT EXISTS discount_duration VARCHAR(20) NOT NULL DEFAULT 'once',
+			ADD COLUMN IF NOT EXISTS discount_periods INT NOT NULL DEFAULT 0;
+		ALTER TABLE campaigns
+			ADD COLUMN IF NOT EXISTS discount_duration VARCHAR(20) NOT NULL DEFAULT 'once',
+			ADD COLUMN IF NOT EXISTS discount_periods INT NOT NULL DEFAULT 0;
+		ALTER TABLE subscriptions
+			ADD COLUMN IF NOT EXISTS discount_duration VARCHAR(20) NULL,
+			ADD COLUMN IF NOT EXISTS discount_periods_remaining INT NOT NULL DEFAULT 0;
+		UPDATE subscriptions
+		SET discount_duration = 'once',
+			discount_periods_remaining = CASE WHEN discounted_price IS NOT NULL THEN 1 ELSE 0 END
+		WHERE voucher_id IS NOT NULL AND discount_duration IS NULL;
+	`
+
+	addInvoices = `
+		CREATE TABLE IF NOT EXISTS invoice_sequences (
+			year INT PRIMARY KEY,
+			last_number INT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS invoices (
+			id UUID PRIMARY KEY,
+			number VARCHAR(20) NOT NULL UNIQUE,
+			user_id UUID NOT NULL REFERENCES users(id),
+			subscription_id UUID NOT NULL REFERENCES subscriptions(id),
+			reason VARCHAR(30) NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			period_start TIMESTAMP NOT NULL,
+			period_end TIMESTAMP NOT NULL,
+			subtotal DECIMAL(10, 2) NOT NULL,
+			tax_amount DECIMAL(10, 2) NOT NULL,
+			total DECIMAL(10, 2) NOT NULL,
+			issued_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_invoices_user_id ON invoices(user_id, issued_at);
+		CREATE TABLE IF NOT EXISTS invoice_lines (
+			id UUID PRIMARY KEY,
+			invoice_id UUID NOT NULL REFERENCES invoices(id),
+			position INT NOT NULL,
+			type VARCHAR(20) NOT NULL,
+			description VARCHAR(255) NOT NULL,
+			amount DECIMAL(10, 2) NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_invoice_lines_invoice_id ON invoice_lines(invoice_id);
+
+		-- Finalized invoices and their lines cannot be changed or deleted
+		CREATE OR REPLACE FUNCTION prevent_finalized_invoice_change() RETURNS trigger AS $$
+		BEGIN
+			IF OLD.status = 'finalized' THEN
+				RAISE EXCEPTION 'invoice % is finalized', OLD.number;
+			END IF;
+			IF TG_OP = 'DELETE' THEN
+				RETURN OLD;
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS invoices_immutable ON invoices;
+		CREATE TRIGGER invoices_immutable BEFORE UPDATE OR DELETE ON invoices
+			FOR EACH ROW EXECUTE FUNCTION prevent_finalized_invoice_change();
+
+		CREATE OR REPLACE FUNCTION prevent_finalized_invoice_line_change() RETURNS trigger AS $$
+		DECLARE
+			line_invoice_id UUID;
+		BEGIN
+			IF TG_OP = 'INSERT' THEN
+				line_invoice_id := NEW.invoice_id;
+			ELSE
+				line_invoice_id := OLD.invoice_id;
+			END IF;
+			IF EXISTS (SELECT 1 FROM invoices WHERE id = line_invoice_id AND status = 'finalized') THEN
+				RAISE EXCEPTION 'invoice % is finalized', line_invoice_id;
+			END IF;
+			IF TG_OP = 'DELETE' THEN
+				RETURN OLD;
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS invoice_lines_immutable ON invoice_lines;
+		CREATE TRIGGER invoice_lines_immutable BEFORE INSERT OR UPDATE OR DELETE ON invoice_lines
+			FOR EACH ROW EXECUTE FUNCTION prevent_finalized_invoice_line_change();
+	`
+
+	createPaymentsTables = `
+		CREATE TABLE IF NOT EXISTS payment_accounts (
+			user_id UUID NOT NULL REFERENCES users(id),
+			provider VARCHAR(50) NOT NULL,
+			customer_id VARCHAR(255) NOT NULL,
+			payment_method_id VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (user_id, provider)
+		);
+		CREATE TABLE IF NOT EXISTS payments (
+			id UUID PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users(id),
+			subscription_id UUID NOT NULL REFERENCES subscriptions(id),
+			invoice_id UUID REFERENCES invoices(id),
+			provider VARCHAR(50) NOT NULL,
+			provider_payment_id VARCHAR(255),
+			amount DECIMAL(10, 2) NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			failure_code VARCHAR(50),
+			failure_message VARCHAR(255),
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_payments_subscription_id ON payments(subscription_id, created_at);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_provider_payment_id ON payments(provider, provider_payment_id);
+	`
+
+	addWebhookEvents = `
+		-- Invoices are only issued for collected charges, so existing ones are paid
+		ALTER TABLE invoices ADD COLUMN IF NOT EXISTS payment_status VARCHAR(20) NOT NULL DEFAULT 'paid';
+		ALTER TABLE payments ADD COLUMN IF NOT EXISTS reason VARCHAR(30);
+
+		-- The payment status of a finalized invoice can still change
+		CREATE OR REPLACE FUNCTION prevent_finalized_invoice_change() RETURNS trigger AS $$
+		BEGIN
+			IF OLD.status = 'finalized' THEN
+				IF TG_OP = 'UPDATE' AND to_jsonb(NEW) - 'payment_status' = to_jsonb(OLD) - 'payment_status' THEN
+					RETURN NEW;
+				END IF;
+				RAISE EXCEPTION 'invoice % is finalized', OLD.number;
+			END IF;
+			IF TG_OP = 'DELETE' THEN
+				RETURN OLD;
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE TABLE IF NOT EXISTS webhook_events (
+			id UUID PRIMARY KEY,
+			provider VARCHAR(50) NOT NULL,
+			event_id VARCHAR(255) NOT NULL,
+			type VARCHAR(100) NOT NULL,
+			payload BYTEA NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			attempts INT NOT NULL DEFAULT 0,
+			last_error TEXT,
+			received_at TIMESTAMP NOT NULL,
+			processed_at TIMESTAMP,
+			UNIQUE (provider, event_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_events_status ON webhook_events(status, received_at);
+	`
+
+	addDunning = `
+		ALTER TABLE subscriptions
+			ADD COLUMN IF NOT EXISTS failed_payment_attempts INT NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS next_payment_attempt_at TIMESTAMP NULL;
+		CREATE INDEX IF NOT EXISTS idx_subscriptions_status_next_payment_attempt_at ON subscriptions(status, next_payment_attempt_at);
+
+		-- Subscriptions already past due for a failed renewal had it charged once; retry it now.
+		-- Those past due for a reversed or disputed payment are not retried.
+		UPDATE subscriptions
+		SET failed_payment_attempts = 1, next_payment_attempt_at = NOW()
+		WHERE status = 'past_due' AND end_date <= NOW() AND next_payment_attempt_at IS NULL;
+
+		ALTER TABLE payments ADD COLUMN IF NOT EXISTS attempt INT NOT NULL DEFAULT 1;
+		ALTER TABLE subscription_state_changes ADD COLUMN IF NOT EXISTS reason_code VARCHAR(50) NOT NULL DEFAULT '';
+	`
+
+	addRefunds = `
+		ALTER TABLE products
+			ADD COLUMN IF NOT EXISTS refund_policy VARCHAR(20) NOT NULL DEFAULT 'none',
+			ADD COLUMN IF NOT EXISTS refund_window_days INT NOT NULL DEFAULT 0;
+
+		ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_amount DECIMAL(10, 2) NOT NULL DEFAULT 0;
+		UPDATE payments SET refunded_amount = amount WHERE status = 'refunded';
+		CREATE INDEX IF NOT EXISTS idx_payments_invoice_id ON payments(invoice_id);
+
+		CREATE TABLE IF NOT EXISTS credit_note_sequences (
+			year INT PRIMARY KEY,
+			last_number INT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS credit_notes (
+			id UUID PRIMARY KEY,
+			number VARCHAR(20) NOT NULL UNIQUE,
+			invoice_id UUID NOT NULL REFERENCES invoices(id),
+			payment_id UUID NOT NULL REFERENCES payments(id),
+			user_id UUID NOT NULL REFERENCES users(id),
+			subscription_id UUID NOT NULL REFERENCES subscriptions(id),
+			reason VARCHAR(20) NOT NULL,
+			note TEXT NOT NULL DEFAULT '',
+			subtotal DECIMAL(10, 2) NOT NULL,
+			tax_amount DECIMAL(10, 2) NOT NULL,
+			total DECIMAL(10, 2) NOT NULL,
+			provider_refund_id VARCHAR(255),
+			issued_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_credit_notes_invoice_id ON credit_notes(invoice_id);
+		CREATE INDEX IF NOT EXISTS idx_credit_notes_user_id ON credit_notes(user_id, issued_at);
+
+		-- Credit notes cannot be changed or deleted
+		CREATE OR REPLACE FUNCTION prevent_credit_note_change() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'credit note % cannot be changed', OLD.number;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS credit_notes_immutable ON credit_notes;
+		CREATE TRIGGER credit_notes_immutable BEFORE UPDATE OR DELETE ON credit_notes
+			FOR EACH ROW EXECUTE FUNCTION prevent_credit_note_change();
+	`
+
+	addCreditBalances = `
+		ALTER TABLE invoices ADD COLUMN IF NOT EXISTS credit_applied DECIMAL(10, 2) NOT NULL DEFAULT 0;
+
+		-- One row per user holds the balance, so that concurrent entries are serialized
+		CREATE TABLE IF NOT EXISTS credit_balances (
+			user_id UUID PRIMARY KEY REFERENCES users(id),
+			balance DECIMAL(10, 2) NOT NULL CHECK (balance >= 0),
+			updated_at TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS credit_entries (
+			id UUID PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users(id),
+			type VARCHAR(10) NOT NULL,
+			amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+			reason VARCHAR(20) NOT NULL,
+			reference_id UUID,
+			note TEXT NOT NULL DEFAULT '',
+			balance_after DECIMAL(10, 2) NOT NULL,
+			created_by UUID REFERENCES users(id),
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_credit_entries_user_id ON credit_entries(user_id, created_at);
+
+		-- Credit entries cannot be changed or deleted
+		CREATE OR REPLACE FUNCTION prevent_credit_entry_change() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'credit entry % cannot be changed', OLD.id;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS credit_entries_immutable ON credit_entries;
+		CREATE TRIGGER credit_entries_immutable BEFORE UPDATE OR DELETE ON credit_entries
+			FOR EACH ROW EXECUTE FUNCTION prevent_credit_entry_change();
+	`
+
+	addTaxEngine = `
+		-- Rates such as 9.975% need more than two decimal places
+		ALTER TABLE products ALTER COLUMN tax_rate TYPE DECIMAL(9, 6);
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS tax_category VARCHAR(20) NOT NULL DEFAULT 'standard';
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS billing_address JSONB;
+
+		-- The tax as it was calculated, so that changes to the rules leave totals alone.
+		-- Invoices issued before have their tax in their tax line only.
+		ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS tax_components JSONB NOT NULL DEFAULT '[]';
+		ALTER TABLE invoices ADD COLUMN IF NOT EXISTS tax_components JSONB NOT NULL DEFAULT '[]';
+
+		-- Existing subscriptions were taxed at their product's rate; a trial still bills it when it ends
+		UPDATE subscriptions s
+		SET tax_components = jsonb_build_array(jsonb_build_object('name', 'Tax', 'rate', p.tax_rate, 'amount', s.tax_amount))
+		FROM products p
+		WHERE p.id = s.product_id AND s.tax_amount > 0 AND s.tax_components = '[]';
+	`
+
+	addVATReverseCharge = `
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS business_profile JSONB;
+
+		CREATE TABLE IF NOT EXISTS vat_validations (
+			id UUID PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users(id),
+			vat_id VARCHAR(20) NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			source VARCHAR(50) NOT NULL,
+			message TEXT NOT NULL DEFAULT '',
+			reference VARCHAR(255),
+			checked_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_vat_validations_user_id ON vat_validations(user_id, checked_at);
+
+		-- VAT ID validations are evidence for reverse charges and cannot be changed or deleted
+		CREATE OR REPLACE FUNCTION prevent_vat_validation_change() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'VAT ID validation % cannot be changed', OLD.id;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS vat_validations_immutable ON vat_validations;
+		CREATE TRIGGER vat_validations_immutable BEFORE UPDATE OR DELETE ON vat_validations
+			FOR EACH ROW EXECUTE FUNCTION prevent_vat_validation_change();
+
+		ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS reverse_charge BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS customer_vat_id VARCHAR(20);
+		ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS vat_validation_id UUID REFERENCES vat_validations(id);
+		ALTER TABLE invoices ADD COLUMN IF NOT EXISTS reverse_charge BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE invoices ADD COLUMN IF NOT EXISTS customer_vat_id VARCHAR(20);
+		ALTER TABLE invoices ADD COLUMN IF NOT EXISTS vat_validation_id UUID REFERENCES vat_validations(id);
+	`
+
+	addCurrencies = `
+		-- Existing rows are in the default currency, which Migrate puts in the
+		-- app.default_currency setting. A column added with a default is filled in
+		-- without updating the rows, so immutable records get their currency too.
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT current_setting('app.default_currency');
+		ALTER TABLE products ALTER COLUMN currency DROP DEFAULT;
+		-- Price points in other currencies, e.g. [{"currency": "USD", "amount": "21.99"}]
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS prices JSONB NOT NULL DEFAULT '[]';
+
+		ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT current_setting('app.default_currency');
+		ALTER TABLE subscriptions ALTER COLUMN currency DROP DEFAULT;
+		ALTER TABLE invoices ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT current_setting('app.default_currency');
+		ALTER TABLE invoices ALTER COLUMN currency DROP DEFAULT;
+		ALTER TABLE credit_notes ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT current_setting('app.default_currency');
+		ALTER TABLE credit_notes ALTER COLUMN currency DROP DEFAULT;
+		ALTER TABLE payments ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT current_setting('app.default_currency');
+		ALTER TABLE payments ALTER COLUMN currency DROP DEFAULT;
+
+		-- Only fixed discounts are in a currency
+		ALTER TABLE vouchers ADD COLUMN IF NOT EXISTS currency CHAR(3);
+		UPDATE vouchers SET currency = current_setting('app.default_currency') WHERE discount_type = 'fixed' AND currency IS NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS currency CHAR(3);
+		UPDATE campaigns SET currency = current_setting('app.default_currency') WHERE discount_type = 'fixed' AND currency IS NULL;
+
+		-- Users have a credit balance in each currency
+		ALTER TABLE credit_entries ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT current_setting('app.default_currency');
+		ALTER TABLE credit_entries ALTER COLUMN currency DROP DEFAULT;
+		ALTER TABLE credit_balances ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT current_setting('app.default_currency');
+		ALTER TABLE credit_balances ALTER COLUMN currency DROP DEFAULT;
+		ALTER TABLE credit_balances DROP CONSTRAINT IF EXISTS credit_balances_pkey;
+		ALTER TABLE credit_balances ADD PRIMARY KEY (user_id, currency);
+	`
+
+	addExchangeRates = `
+		-- One unit of base_currency is worth rate units of currency on the day
+		CREATE TABLE IF NOT EXISTS exchange_rates (
+			date DATE NOT NULL,
+			base_currency CHAR(3) NOT NULL,
+			currency CHAR(3) NOT NULL,
+			rate NUMERIC(20, 10) NOT NULL CHECK (rate > 0),
+			source VARCHAR(20) NOT NULL,
+			imported_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (base_currency, currency, date)
+		);
+
+		-- The rate each financial record was converted to the reporting currency with.
+		-- Records issued before rates were imported have none.
+		ALTER TABLE invoices ADD COLUMN IF NOT EXISTS exchange_rate JSONB;
+		ALTER TABLE credit_notes ADD COLUMN IF NOT EXISTS exchange_rate JSONB;
+		ALTER TABLE payments ADD COLUMN IF NOT EXISTS exchange_rate JSONB;
+		CREATE INDEX IF NOT EXISTS idx_invoices_issued_at ON invoices(issued_at);
+		CREATE INDEX IF NOT EXISTS idx_credit_notes_issued_at ON credit_notes(issued_at);
+	`
+
+	addLedger = `
+		CREATE TABLE IF NOT EXISTS journal_entries (
+			id UUID PRIMARY KEY,
+			type VARCHAR(30) NOT NULL,
+			reference_id UUID NOT NULL,
+			invoice_id UUID REFERENCES invoices(id),
+			user_id UUID REFERENCES users(id),
+			currency CHAR(3) NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_journal_entries_reference_id ON journal_entries(reference_id);
+		CREATE INDEX IF NOT EXISTS idx_journal_entries_invoice_id ON journal_entries(invoice_id);
+		CREATE INDEX IF NOT EXISTS idx_journal_entries_created_at ON journal_entries(created_at);
+		-- An invoice's revenue is recognized once, also by concurrent replicas
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_journal_entries_revenue_recognition
+			ON journal_entries(invoice_id) WHERE type = 'revenue_recognition';
+
+		CREATE TABLE IF NOT EXISTS journal_lines (
+			entry_id UUID NOT NULL REFERENCES journal_entries(id),
+			position INT NOT NULL,
+			account VARCHAR(30) NOT NULL,
+			debit DECIMAL(10, 2) NOT NULL DEFAULT 0,
+			credit DECIMAL(10, 2) NOT NULL DEFAULT 0,
+			PRIMARY KEY (entry_id, position),
+			CHECK ((debit > 0 AND credit = 0) OR (credit > 0 AND debit = 0))
+		);
+		CREATE INDEX IF NOT EXISTS idx_journal_lines_account ON journal_lines(account);
+
+		-- Journal entries and their lines cannot be changed or deleted
+		CREATE OR REPLACE FUNCTION prevent_journal_change() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'journal entries cannot be changed';
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS journal_entries_immutable ON journal_entries;
+		CREATE TRIGGER journal_entries_immutable BEFORE UPDATE OR DELETE ON journal_entries
+			FOR EACH ROW EXECUTE FUNCTION prevent_journal_change();
+		DROP TRIGGER IF EXISTS journal_lines_immutable ON journal_lines;
+		CREATE TRIGGER journal_lines_immutable BEFORE UPDATE OR DELETE ON journal_lines
+			FOR EACH ROW EXECUTE FUNCTION prevent_journal_change();
+
+		-- The debits of an entry equal its credits when the transaction commits
+		CREATE OR REPLACE FUNCTION check_journal_entry_balanced() RETURNS trigger AS $$
+		BEGIN
+			IF (SELECT SUM(debit) - SUM(credit) FROM journal_lines WHERE entry_id = NEW.entry_id) <> 0 THEN
+				RAISE EXCEPTION 'journal entry % is not balanced', NEW.entry_id;
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS journal_lines_balanced ON journal_lines;
+		CREATE CONSTRAINT TRIGGER journal_lines_balanced AFTER INSERT ON journal_lines
+			DEFERRABLE INITIALLY DEFERRED
+			FOR EACH ROW EXECUTE FUNCTION check_journal_entry_balanced();
+	`
+
+	keepPaymentsWithoutSubscription = `
+		-- A first charge that timed out is kept, so that it can be refunded if the
+		-- provider collects it, although its subscription was never created
+		ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_subscription_id_fkey;
+	`
 )
@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	domainErrors "github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+)
+
+// campaignColumns lists the columns read by scanCampaign, with the campaign aliased as c
+const campaignColumns = `
+	c.id, c.name, c.discount_type, c.discount_value, c.currency, c.discount_duration, c.discount_periods, c.product_id,
+	c.expires_at, c.max_redemptions_per_code, c.created_at, c.updated_at,
+	(SELECT COUNT(*) FROM vouchers v WHERE v.campaign_id = c.id)
+`
+
+type CampaignRepository struct {
+	db *sql.DB
+	// tx is set when the repository is used inside a unit of work
+	tx *sql.Tx
+}
+
+func NewCampaignRepository(db *sql.DB) *CampaignRepository {
+	return &CampaignRepository{db: db}
+}
+
+// conn returns the transaction the repository is bound to, or the database
+func (r *CampaignRepository) conn() dbtx {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+func (r *CampaignRepository) Create(ctx context.Context, campaign *models.Campaign) error {
+	if campaign.ID == uuid.Nil {
+		campaign.ID = uuid.New()
+	}
+
+	now := time.Now()
+	campaign.CreatedAt = now
+	campaign.UpdatedAt = now
+
+	query := `
+		INSERT INTO campaigns (
+			id, name, discount_type, discount_value, currency, discount_duration, discount_periods, product_id,
+			expires_at, max_redemptions_per_code, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+
+	_, err := r.conn().ExecContext(
+		ctx,
+		query,
+		campaign.ID,
+		campaign.Name,
+		campaign.DiscountType,
+		campaign.DiscountValue,
+		nullableString(campaign.Currency),
+		campaign.DiscountDuration,
+		campaign.DiscountPeriods,
+		nullableUUID(campaign.ProductID),
+		campaign.ExpiresAt,
+		campaign.MaxRedemptionsPerCode,
+		campaign.CreatedAt,
+		campaign.UpdatedAt,
+	)
+
+	return err
+}
+
+func (r *CampaignRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Campaign, error) {
+	query := `
+		SELECT ` + campaignColumns + `
+		FROM campaigns c
+		WHERE c.id = $1
+	`
+
+	campaign, err := scanCampaign(r.conn().QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domainErrors.ErrCampaignNotFound
+		}
+		return nil, err
+	}
+
+	return campaign, nil
+}
+
+func (r *CampaignRepository) GetAll(ctx context.Context) ([]*models.Campaign, error) {
+	query := `
+		SELECT ` + campaignColumns + `
+		FROM campaigns c
+		ORDER BY c.created_at DESC
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []*models.Campaign
+
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		campaigns = append(campaigns, campaign)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return campaigns, nil
+}
+
+// scanCampaign scans a row selected with campaignColumns
+func scanCampaign(row rowScanner) (*models.Campaign, error) {
+	var campaign models.Campaign
+	var productID uuid.NullUUID
+	var currency sql.NullString
+
+	err := row.Scan(
+		&campaign.ID,
+		&campaign.Name,
+		&campaign.DiscountType,
+		&campaign.DiscountValue,
+		&currency,
+		&campaign.DiscountDuration,
+		&campaign.DiscountPeriods,
+		&productID,
+		&campaign.ExpiresAt,
+		&campaign.MaxRedemptionsPerCode,
+		&campaign.CreatedAt,
+		&campaign.UpdatedAt,
+		&campaign.VoucherCount,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if productID.Valid {
+		campaign.ProductID = &productID.UUID
+	}
+
+	campaign.Currency = currency.String
+
+	return &campaign, nil
+}
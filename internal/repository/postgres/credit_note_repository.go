@@ -0,0 +1,206 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	domainErrors "github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+)
+
+// creditNoteColumns lists the columns read by scanCreditNote
+const creditNoteColumns = `
+	id, number, invoice_id, payment_id, user_id, subscription_id, reason, note, currency,
+	subtotal, tax_amount, total, exchange_rate, provider_refund_id, issued_at, created_at
+`
+
+type CreditNoteRepository struct {
+	db *sql.DB
+	// tx is set when the repository is used inside a unit of work
+	tx *sql.Tx
+}
+
+func NewCreditNoteRepository(db *sql.DB) *CreditNoteRepository {
+	return &CreditNoteRepository{db: db}
+}
+
+// conn returns the transaction the repository is bound to, or the database
+func (r *CreditNoteRepository) conn() dbtx {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// withTx runs fn in the transaction the repository is bound to, or in a new one
+func (r *CreditNoteRepository) withTx(ctx context.Context, fn func(tx dbtx) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *CreditNoteRepository) Create(ctx context.Context, creditNote *models.CreditNote) error {
+	if creditNote.ID == uuid.Nil {
+		creditNote.ID = uuid.New()
+	}
+	creditNote.CreatedAt = time.Now()
+
+	return r.withTx(ctx, func(tx dbtx) error {
+		year := creditNote.IssuedAt.UTC().Year()
+		var number int
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO credit_note_sequences (year, last_number)
+			VALUES ($1, 1)
+			ON CONFLICT (year) DO UPDATE SET last_number = credit_note_sequences.last_number + 1
+			RETURNING last_number
+		`, year).Scan(&number)
+		if err != nil {
+			return fmt.Errorf("failed to get credit note number: %w", err)
+		}
+		creditNote.Number = fmt.Sprintf("CN-%d-%06d", year, number)
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO credit_notes (
+				id, number, invoice_id, payment_id, user_id, subscription_id, reason, note, currency,
+				subtotal, tax_amount, total, exchange_rate, provider_refund_id, issued_at, created_at
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		`,
+			creditNote.ID,
+			creditNote.Number,
+			creditNote.InvoiceID,
+			creditNote.PaymentID,
+			creditNote.UserID,
+			creditNote.SubscriptionID,
+			creditNote.Reason,
+			creditNote.Note,
+			creditNote.Currency,
+			creditNote.Subtotal,
+			creditNote.TaxAmount,
+			creditNote.Total,
+			exchangeRateColumn(creditNote.ExchangeRate),
+			nullableString(creditNote.ProviderRefundID),
+			creditNote.IssuedAt,
+			creditNote.CreatedAt,
+		)
+		return err
+	})
+}
+
+func (r *CreditNoteRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.CreditNote, error) {
+	query := `
+		SELECT ` + creditNoteColumns + `
+		FROM credit_notes
+		WHERE id = $1
+	`
+
+	creditNote, err := scanCreditNote(r.conn().QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domainErrors.ErrCreditNoteNotFound
+		}
+		return nil, err
+	}
+
+	return creditNote, nil
+}
+
+func (r *CreditNoteRepository) GetByInvoiceID(ctx context.Context, invoiceID uuid.UUID) ([]*models.CreditNote, error) {
+	query := `
+		SELECT ` + creditNoteColumns + `
+		FROM credit_notes
+		WHERE invoice_id = $1
+		ORDER BY issued_at DESC, number DESC
+	`
+
+	return r.list(ctx, query, invoiceID)
+}
+
+func (r *CreditNoteRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.CreditNote, error) {
+	query := `
+		SELECT ` + creditNoteColumns + `
+		FROM credit_notes
+		WHERE user_id = $1
+		ORDER BY issued_at DESC, number DESC
+	`
+
+	return r.list(ctx, query, userID)
+}
+
+func (r *CreditNoteRepository) GetIssuedBetween(ctx context.Context, start, end time.Time) ([]*models.CreditNote, error) {
+	query := `
+		SELECT ` + creditNoteColumns + `
+		FROM credit_notes
+		WHERE issued_at >= $1 AND issued_at < $2
+		ORDER BY issued_at, number
+	`
+
+	return r.list(ctx, query, start, end)
+}
+
+func (r *CreditNoteRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.CreditNote, error) {
+	rows, err := r.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	creditNotes := []*models.CreditNote{}
+	for rows.Next() {
+		creditNote, err := scanCreditNote(rows)
+		if err != nil {
+			return nil, err
+		}
+		creditNotes = append(creditNotes, creditNote)
+	}
+
+	return creditNotes, rows.Err()
+}
+
+// scanCreditNote scans a row selected with creditNoteColumns
+func scanCreditNote(row rowScanner) (*models.CreditNote, error) {
+	var creditNote models.CreditNote
+	var providerRefundID sql.NullString
+
+	err := row.Scan(
+		&creditNote.ID,
+		&creditNote.Number,
+		&creditNote.InvoiceID,
+		&creditNote.PaymentID,
+		&creditNote.UserID,
+		&creditNote.SubscriptionID,
+		&creditNote.Reason,
+		&creditNote.Note,
+		&creditNote.Currency,
+		&creditNote.Subtotal,
+		&creditNote.TaxAmount,
+		&creditNote.Total,
+		jsonColumn{&creditNote.ExchangeRate},
+		&providerRefundID,
+		&creditNote.IssuedAt,
+		&creditNote.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	creditNote.ProviderRefundID = providerRefundID.String
+
+	return &creditNote, nil
+}
@@ -0,0 +1,198 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	domainErrors "github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type CreditRepository struct {
+	db *sql.DB
+	// tx is set when the repository is used inside a unit of work
+	tx *sql.Tx
+}
+
+func NewCreditRepository(db *sql.DB) *CreditRepository {
+	return &CreditRepository{db: db}
+}
+
+// conn returns the transaction the repository is bound to, or the database
+func (r *CreditRepository) conn() dbtx {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// withTx runs fn in the transaction the repository is bound to, or in a new one
+func (r *CreditRepository) withTx(ctx context.Context, fn func(tx dbtx) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *CreditRepository) GetBalance(ctx context.Context, userID uuid.UUID, currency string) (decimal.Decimal, error) {
+	var balance decimal.Decimal
+	err := r.conn().QueryRowContext(ctx,
+		"SELECT balance FROM credit_balances WHERE user_id = $1 AND currency = $2",
+		userID, currency).Scan(&balance)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return decimal.Zero, nil
+		}
+		return decimal.Zero, err
+	}
+
+	return balance, nil
+}
+
+func (r *CreditRepository) GetBalances(ctx context.Context, userID uuid.UUID) (map[string]decimal.Decimal, error) {
+	rows, err := r.conn().QueryContext(ctx, "SELECT currency, balance FROM credit_balances WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := make(map[string]decimal.Decimal)
+	for rows.Next() {
+		var currency string
+		var balance decimal.Decimal
+		if err := rows.Scan(&currency, &balance); err != nil {
+			return nil, err
+		}
+		balances[currency] = balance
+	}
+
+	return balances, rows.Err()
+}
+
+func (r *CreditRepository) AddEntry(ctx context.Context, entry *models.CreditEntry) error {
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	entry.CreatedAt = time.Now()
+
+	change := entry.Amount
+	if entry.Type == models.CreditEntryTypeDebit {
+		change = change.Neg()
+	}
+
+	return r.withTx(ctx, func(tx dbtx) error {
+		// The balance row stays locked until the transaction ends, so entries of the
+		// same user and currency are applied one at a time
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO credit_balances (user_id, currency, balance, updated_at)
+			VALUES ($1, $2, 0, $3)
+			ON CONFLICT (user_id, currency) DO NOTHING
+		`, entry.UserID, entry.Currency, entry.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		var balance decimal.Decimal
+		err = tx.QueryRowContext(ctx,
+			"SELECT balance FROM credit_balances WHERE user_id = $1 AND currency = $2 FOR UPDATE",
+			entry.UserID, entry.Currency).Scan(&balance)
+		if err != nil {
+			return err
+		}
+
+		entry.BalanceAfter = balance.Add(change)
+		if entry.BalanceAfter.IsNegative() {
+			return domainErrors.ErrInsufficientCredit
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE credit_balances SET balance = $1, updated_at = $2 WHERE user_id = $3 AND currency = $4",
+			entry.BalanceAfter, entry.CreatedAt, entry.UserID, entry.Currency)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO credit_entries (
+				id, user_id, type, amount, currency, reason, reference_id, note, balance_after, created_by, created_at
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		`,
+			entry.ID,
+			entry.UserID,
+			entry.Type,
+			entry.Amount,
+			entry.Currency,
+			entry.Reason,
+			nullableUUID(entry.ReferenceID),
+			entry.Note,
+			entry.BalanceAfter,
+			nullableUUID(entry.CreatedBy),
+			entry.CreatedAt,
+		)
+		return err
+	})
+}
+
+func (r *CreditRepository) GetEntries(ctx context.Context, userID uuid.UUID) ([]*models.CreditEntry, error) {
+	query := `
+		SELECT id, user_id, type, amount, currency, reason, reference_id, note, balance_after, created_by, created_at
+		FROM credit_entries
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*models.CreditEntry{}
+	for rows.Next() {
+		var entry models.CreditEntry
+		var referenceID, createdBy uuid.NullUUID
+
+		err := rows.Scan(
+			&entry.ID,
+			&entry.UserID,
+			&entry.Type,
+			&entry.Amount,
+			&entry.Currency,
+			&entry.Reason,
+			&referenceID,
+			&entry.Note,
+			&entry.BalanceAfter,
+			&createdBy,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if referenceID.Valid {
+			entry.ReferenceID = &referenceID.UUID
+		}
+		if createdBy.Valid {
+			entry.CreatedBy = &createdBy.UUID
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	domainErrors "github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+)
+
+// exchangeRateBatchSize is the number of rates saved per statement. A full ECB history
+// has a few hundred thousand rates.
+const exchangeRateBatchSize = 1000
+
+// dateLayout formats the days rates are stored for; days are in UTC
+const dateLayout = "2006-01-02"
+
+type ExchangeRateRepository struct {
+	db *sql.DB
+}
+
+func NewExchangeRateRepository(db *sql.DB) *ExchangeRateRepository {
+	return &ExchangeRateRepository{db: db}
+}
+
+// Save upserts the rates in batches in one transaction, so an import is saved
+// completely or not at all. The rates must not repeat a currency pair and day.
+func (r *ExchangeRateRepository) Save(ctx context.Context, rates []*models.ExchangeRate) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for start := 0; start < len(rates); start += exchangeRateBatchSize {
+		batch := rates[start:min(start+exchangeRateBatchSize, len(rates))]
+		if err := saveExchangeRateBatch(ctx, tx, batch, now); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func saveExchangeRateBatch(ctx context.Context, tx dbtx, rates []*models.ExchangeRate, importedAt time.Time) error {
+	const columns = 6
+
+	values := make([]string, len(rates))
+	args := make([]interface{}, 0, len(rates)*columns)
+
+	for i, rate := range rates {
+		rate.ImportedAt = importedAt
+
+		placeholders := make([]string, columns)
+		for j := range placeholders {
+			placeholders[j] = fmt.Sprintf("$%d", i*columns+j+1)
+		}
+		values[i] = "(" + strings.Join(placeholders, ", ") + ")"
+
+		args = append(args,
+			rate.Date.UTC().Format(dateLayout),
+			rate.Base,
+			rate.Currency,
+			rate.Rate,
+			rate.Source,
+			rate.ImportedAt,
+		)
+	}
+
+	query := `
+		INSERT INTO exchange_rates (date, base_currency, currency, rate, source, imported_at)
+		VALUES ` + strings.Join(values, ", ") + `
+		ON CONFLICT (base_currency, currency, date) DO UPDATE
+		SET rate = EXCLUDED.rate, source = EXCLUDED.source, imported_at = EXCLUDED.imported_at
+	`
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r *ExchangeRateRepository) GetLatest(ctx context.Context, base, currency string, on time.Time) (*models.ExchangeRate, error) {
+	query := `
+		SELECT date, base_currency, currency, rate, source, imported_at
+		FROM exchange_rates
+		WHERE base_currency = $1 AND currency = $2 AND date <= $3
+		ORDER BY date DESC
+		LIMIT 1
+	`
+
+	rate, err := scanExchangeRate(r.db.QueryRowContext(ctx, query, base, currency, on.UTC().Format(dateLayout)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domainErrors.ErrExchangeRateNotFound
+		}
+		return nil, err
+	}
+
+	return rate, nil
+}
+
+func (r *ExchangeRateRepository) GetByDate(ctx context.Context, date time.Time) ([]*models.ExchangeRate, error) {
+	query := `
+		SELECT date, base_currency, currency, rate, source, imported_at
+		FROM exchange_rates
+		WHERE date = $1
+		ORDER BY base_currency, currency
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, date.UTC().Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []*models.ExchangeRate{}
+	for rows.Next() {
+		rate, err := scanExchangeRate(rows)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+func scanExchangeRate(row rowScanner) (*models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	err := row.Scan(&rate.Date, &rate.Base, &rate.Currency, &rate.Rate, &rate.Source, &rate.ImportedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Days are stored without a time zone and are in UTC
+	rate.Date = rate.Date.UTC()
+	return &rate, nil
+}
@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx
+type dbtx interface {
+	execer
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Helpers to convert optional values to query arguments that are NULL when unset
+
+func nullableUUID(id *uuid.UUID) interface{} {
+	if id == nil {
+		return nil
+	}
+	return *id
+}
+
+func nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+func nullableString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullableDecimal(d *decimal.Decimal) interface{} {
+	if d == nil {
+		return nil
+	}
+	return *d
+}
+
+// jsonColumn writes a value to a JSONB column, or scans a JSONB column into the value
+// it points to. Scanning NULL leaves the value alone.
+type jsonColumn struct {
+	value interface{}
+}
+
+func (c jsonColumn) Value() (driver.Value, error) {
+	data, err := json.Marshal(c.value)
+	if err != nil {
+		return nil, err
+	}
+	// lib/pq sends []byte as bytea, which cannot be cast to JSONB
+	return string(data), nil
+}
+
+func (c jsonColumn) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(data, c.value)
+	case string:
+		return json.Unmarshal([]byte(data), c.value)
+	}
+	return fmt.Errorf("cannot scan %T into JSON", src)
+}
+
+// taxComponentsColumn writes tax components as a JSON array, which is empty if there are none
+func taxComponentsColumn(components []models.TaxComponent) jsonColumn {
+	if components == nil {
+		components = []models.TaxComponent{}
+	}
+	return jsonColumn{components}
+}
+
+// productPricesColumn writes a product's price points as a JSON array, which is empty if there are none
+func productPricesColumn(prices []models.ProductPrice) jsonColumn {
+	if prices == nil {
+		prices = []models.ProductPrice{}
+	}
+	return jsonColumn{prices}
+}
+
+// exchangeRateColumn writes the exchange rate a record was converted with as a JSON
+// object, or NULL if it has none
+func exchangeRateColumn(rate *models.ExchangeRateSnapshot) interface{} {
+	if rate == nil {
+		return nil
+	}
+	return jsonColumn{rate}
+}
@@ -0,0 +1,308 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	domainErrors "github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// invoiceColumns lists the columns read by scanInvoice
+const invoiceColumns = `
+	id, number, user_id, subscription_id, reason, status, payment_status,
+	period_start, period_end, currency, subtotal, tax_amount, tax_components, total, credit_applied,
+	reverse_charge, customer_vat_id, vat_validation_id, exchange_rate, issued_at, created_at
+`
+
+type InvoiceRepository struct {
+	db *sql.DB
+	// tx is set when the repository is used inside a unit of work
+	tx *sql.Tx
+}
+
+func NewInvoiceRepository(db *sql.DB) *InvoiceRepository {
+	return &InvoiceRepository{db: db}
+}
+
+// conn returns the transaction the repository is bound to, or the database
+func (r *InvoiceRepository) conn() dbtx {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// withTx runs fn in the transaction the repository is bound to, or in a new one
+func (r *InvoiceRepository) withTx(ctx context.Context, fn func(tx dbtx) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *InvoiceRepository) Create(ctx context.Context, invoice *models.Invoice) error {
+	if invoice.ID == uuid.Nil {
+		invoice.ID = uuid.New()
+	}
+	invoice.CreatedAt = time.Now()
+
+	return r.withTx(ctx, func(tx dbtx) error {
+		// The sequence row stays locked until the transaction ends, so numbers are
+		// handed out one at a time and a rollback returns the number
+		year := invoice.IssuedAt.UTC().Year()
+		var number int
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO invoice_sequences (year, last_number)
+			VALUES ($1, 1)
+			ON CONFLICT (year) DO UPDATE SET last_number = invoice_sequences.last_number + 1
+			RETURNING last_number
+		`, year).Scan(&number)
+		if err != nil {
+			return fmt.Errorf("failed to get invoice number: %w", err)
+		}
+		invoice.Number = fmt.Sprintf("INV-%d-%06d", year, number)
+
+		// Lines can only be added while the invoice is a draft, so it is finalized last
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO invoices (
+				id, number, user_id, subscription_id, reason, status, payment_status,
+				period_start, period_end, currency, subtotal, tax_amount, tax_components, total, credit_applied,
+				reverse_charge, customer_vat_id, vat_validation_id, exchange_rate, issued_at, created_at
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+		`,
+			invoice.ID,
+			invoice.Number,
+			invoice.UserID,
+			invoice.SubscriptionID,
+			invoice.Reason,
+			models.InvoiceStatusDraft,
+			invoice.PaymentStatus,
+			invoice.PeriodStart,
+			invoice.PeriodEnd,
+			invoice.Currency,
+			invoice.Subtotal,
+			invoice.TaxAmount,
+			taxComponentsColumn(invoice.TaxComponents),
+			invoice.Total,
+			invoice.CreditApplied,
+			invoice.ReverseCharge,
+			nullableString(invoice.CustomerVATID),
+			nullableUUID(invoice.VATValidationID),
+			exchangeRateColumn(invoice.ExchangeRate),
+			invoice.IssuedAt,
+			invoice.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, line := range invoice.Lines {
+			if line.ID == uuid.Nil {
+				line.ID = uuid.New()
+			}
+			line.InvoiceID = invoice.ID
+
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO invoice_lines (id, invoice_id, position, type, description, amount)
+				VALUES ($1, $2, $3, $4, $5, $6)
+			`, line.ID, line.InvoiceID, line.Position, line.Type, line.Description, line.Amount)
+			if err != nil {
+				return err
+			}
+		}
+
+		if invoice.Status == models.InvoiceStatusFinalized {
+			_, err := tx.ExecContext(ctx, "UPDATE invoices SET status = $1 WHERE id = $2", invoice.Status, invoice.ID)
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (r *InvoiceRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Invoice, error) {
+	query := `
+		SELECT ` + invoiceColumns + `
+		FROM invoices
+		WHERE id = $1
+	`
+
+	invoice, err := scanInvoice(r.conn().QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domainErrors.ErrInvoiceNotFound
+		}
+		return nil, err
+	}
+
+	if err := r.loadLines(ctx, []*models.Invoice{invoice}); err != nil {
+		return nil, err
+	}
+
+	return invoice, nil
+}
+
+func (r *InvoiceRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Invoice, error) {
+	query := `
+		SELECT ` + invoiceColumns + `
+		FROM invoices
+		WHERE user_id = $1
+		ORDER BY issued_at DESC, number DESC
+	`
+
+	return r.list(ctx, query, userID)
+}
+
+func (r *InvoiceRepository) GetIssuedBetween(ctx context.Context, start, end time.Time) ([]*models.Invoice, error) {
+	query := `
+		SELECT ` + invoiceColumns + `
+		FROM invoices
+		WHERE issued_at >= $1 AND issued_at < $2
+		ORDER BY issued_at, number
+	`
+
+	return r.list(ctx, query, start, end)
+}
+
+// list reads the invoices a query selects with invoiceColumns, with their lines
+func (r *InvoiceRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.Invoice, error) {
+	rows, err := r.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invoices := []*models.Invoice{}
+	for rows.Next() {
+		invoice, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, invoice)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadLines(ctx, invoices); err != nil {
+		return nil, err
+	}
+
+	return invoices, nil
+}
+
+func (r *InvoiceRepository) UpdatePaymentStatus(ctx context.Context, id uuid.UUID, status models.InvoicePaymentStatus) error {
+	result, err := r.conn().ExecContext(ctx, "UPDATE invoices SET payment_status = $1 WHERE id = $2", status, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return domainErrors.ErrInvoiceNotFound
+	}
+
+	return nil
+}
+
+// loadLines reads the lines of all given invoices in one query
+func (r *InvoiceRepository) loadLines(ctx context.Context, invoices []*models.Invoice) error {
+	if len(invoices) == 0 {
+		return nil
+	}
+
+	byID := make(map[uuid.UUID]*models.Invoice, len(invoices))
+	ids := make([]string, len(invoices))
+	for i, invoice := range invoices {
+		invoice.Lines = []*models.InvoiceLine{}
+		byID[invoice.ID] = invoice
+		ids[i] = invoice.ID.String()
+	}
+
+	query := `
+		SELECT id, invoice_id, position, type, description, amount
+		FROM invoice_lines
+		WHERE invoice_id = ANY($1::uuid[])
+		ORDER BY invoice_id, position
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line models.InvoiceLine
+		if err := rows.Scan(&line.ID, &line.InvoiceID, &line.Position, &line.Type, &line.Description, &line.Amount); err != nil {
+			return err
+		}
+		byID[line.InvoiceID].Lines = append(byID[line.InvoiceID].Lines, &line)
+	}
+
+	return rows.Err()
+}
+
+// scanInvoice scans a row selected with invoiceColumns
+func scanInvoice(row rowScanner) (*models.Invoice, error) {
+	var invoice models.Invoice
+	var customerVATID sql.NullString
+	var vatValidationID uuid.NullUUID
+
+	err := row.Scan(
+		&invoice.ID,
+		&invoice.Number,
+		&invoice.UserID,
+		&invoice.SubscriptionID,
+		&invoice.Reason,
+		&invoice.Status,
+		&invoice.PaymentStatus,
+		&invoice.PeriodStart,
+		&invoice.PeriodEnd,
+		&invoice.Currency,
+		&invoice.Subtotal,
+		&invoice.TaxAmount,
+		jsonColumn{&invoice.TaxComponents},
+		&invoice.Total,
+		&invoice.CreditApplied,
+		&invoice.ReverseCharge,
+		&customerVATID,
+		&vatValidationID,
+		jsonColumn{&invoice.ExchangeRate},
+		&invoice.IssuedAt,
+		&invoice.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice.CustomerVATID = customerVATID.String
+	if vatValidationID.Valid {
+		invoice.VATValidationID = &vatValidationID.UUID
+	}
+
+	return &invoice, nil
+}
@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	domainErrors "github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type LedgerRepository struct {
+	db *sql.DB
+	// tx is set when the repository is used inside a unit of work
+	tx *sql.Tx
+}
+
+func NewLedgerRepository(db *sql.DB) *LedgerRepository {
+	return &LedgerRepository{db: db}
+}
+
+// conn returns the transaction the repository is bound to, or the database
+func (r *LedgerRepository) conn() dbtx {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// withTx runs fn in the transaction the repository is bound to, or in a new one
+func (r *LedgerRepository) withTx(ctx context.Context, fn func(tx dbtx) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *LedgerRepository) Post(ctx context.Context, entry *models.JournalEntry) error {
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	entry.CreatedAt = time.Now()
+
+	return r.withTx(ctx, func(tx dbtx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO journal_entries (id, type, reference_id, invoice_id, user_id, currency, description, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`,
+			entry.ID,
+			entry.Type,
+			entry.ReferenceID,
+			nullableUUID(entry.InvoiceID),
+			nullableUUID(entry.UserID),
+			entry.Currency,
+			entry.Description,
+			entry.CreatedAt,
+		)
+		if err != nil {
+			if isPgUniqueViolation(err) {
+				return domainErrors.ErrJournalEntryExists
+			}
+			return err
+		}
+
+		for i, line := range entry.Lines {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO journal_lines (entry_id, position, account, debit, credit)
+				VALUES ($1, $2, $3, $4, $5)
+			`, entry.ID, i+1, line.Account, line.Debit, line.Credit)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *LedgerRepository) GetDeferredRevenue(ctx context.Context, invoiceID uuid.UUID) (decimal.Decimal, error) {
+	var amount decimal.Decimal
+	err := r.conn().QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(l.credit - l.debit), 0)
+		FROM journal_entries e
+		JOIN journal_lines l ON l.entry_id = e.id
+		WHERE e.invoice_id = $1 AND l.account = $2
+	`, invoiceID, models.LedgerAccountDeferredRevenue).Scan(&amount)
+	return amount, err
+}
+
+func (r *LedgerRepository) GetDueDeferredRevenue(ctx context.Context, end time.Time, limit int) ([]*models.DeferredRevenue, error) {
+	rows, err := r.conn().QueryContext(ctx, `
+		SELECT i.id, i.user_id, e.currency, SUM(l.credit - l.debit)
+		FROM invoices i
+		JOIN journal_entries e ON e.invoice_id = i.id
+		JOIN journal_lines l ON l.entry_id = e.id
+		WHERE i.period_end < $1 AND l.account = $2
+		GROUP BY i.id, i.user_id, e.currency, i.period_end
+		HAVING SUM(l.credit - l.debit) <> 0
+		ORDER BY i.period_end
+		LIMIT $3
+	`, end, models.LedgerAccountDeferredRevenue, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []*models.DeferredRevenue
+	for rows.Next() {
+		var deferred models.DeferredRevenue
+		if err := rows.Scan(&deferred.InvoiceID, &deferred.UserID, &deferred.Currency, &deferred.Amount); err != nil {
+			return nil, err
+		}
+		due = append(due, &deferred)
+	}
+
+	return due, rows.Err()
+}
+
+func (r *LedgerRepository) GetAccountTotals(ctx context.Context, asOf time.Time) ([]*models.AccountTotals, error) {
+	rows, err := r.conn().QueryContext(ctx, `
+		SELECT l.account, e.currency, SUM(l.debit), SUM(l.credit)
+		FROM journal_entries e
+		JOIN journal_lines l ON l.entry_id = e.id
+		WHERE e.created_at < $1
+		GROUP BY l.account, e.currency
+		ORDER BY e.currency, l.account
+	`, asOf)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := []*models.AccountTotals{}
+	for rows.Next() {
+		var account models.AccountTotals
+		if err := rows.Scan(&account.Account, &account.Currency, &account.Debits, &account.Credits); err != nil {
+			return nil, err
+		}
+		totals = append(totals, &account)
+	}
+
+	return totals, rows.Err()
+}
+
+func (r *LedgerRepository) GetUnbalancedEntries(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := r.conn().QueryContext(ctx, `
+		SELECT e.id
+		FROM journal_entries e
+		LEFT JOIN journal_lines l ON l.entry_id = e.id
+		GROUP BY e.id, e.created_at
+		HAVING COALESCE(SUM(l.debit), 0) <> COALESCE(SUM(l.credit), 0) OR COUNT(l.entry_id) = 0
+		ORDER BY e.created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
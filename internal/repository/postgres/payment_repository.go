@@ -0,0 +1,290 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	domainErrors "github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+)
+
+// paymentColumns lists the columns read by scanPayment
+const paymentColumns = `
+	id, user_id, subscription_id, invoice_id, reason, attempt, provider, provider_payment_id,
+	amount, currency, refunded_amount, status, failure_code, failure_message, exchange_rate, created_at, updated_at
+`
+
+type PaymentRepository struct {
+	db *sql.DB
+	// tx is set when the repository is used inside a unit of work
+	tx *sql.Tx
+}
+
+func NewPaymentRepository(db *sql.DB) *PaymentRepository {
+	return &PaymentRepository{db: db}
+}
+
+// conn returns the transaction the repository is bound to, or the database
+func (r *PaymentRepository) conn() dbtx {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+func (r *PaymentRepository) GetAccount(ctx context.Context, userID uuid.UUID, provider string) (*models.PaymentAccount, error) {
+	query := `
+		SELECT user_id, provider, customer_id, payment_method_id, created_at, updated_at
+		FROM payment_accounts
+		WHERE user_id = $1 AND provider = $2
+	`
+
+	var account models.PaymentAccount
+	err := r.conn().QueryRowContext(ctx, query, userID, provider).Scan(
+		&account.UserID,
+		&account.Provider,
+		&account.CustomerID,
+		&account.PaymentMethodID,
+		&account.CreatedAt,
+		&account.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domainErrors.ErrPaymentAccountNotFound
+		}
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+func (r *PaymentRepository) SaveAccount(ctx context.Context, account *models.PaymentAccount) error {
+	now := time.Now()
+	if account.CreatedAt.IsZero() {
+		account.CreatedAt = now
+	}
+	account.UpdatedAt = now
+
+	query := `
+		INSERT INTO payment_accounts (user_id, provider, customer_id, payment_method_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, provider) DO UPDATE SET
+			customer_id = EXCLUDED.customer_id,
+			payment_method_id = EXCLUDED.payment_method_id,
+			updated_at = EXCLUDED.updated_at
+		RETURNING created_at
+	`
+
+	return r.conn().QueryRowContext(ctx, query,
+		account.UserID,
+		account.Provider,
+		account.CustomerID,
+		account.PaymentMethodID,
+		account.CreatedAt,
+		account.UpdatedAt,
+	).Scan(&account.CreatedAt)
+}
+
+func (r *PaymentRepository) Create(ctx context.Context, payment *models.Payment) error {
+	if payment.ID == uuid.Nil {
+		payment.ID = uuid.New()
+	}
+	now := time.Now()
+	payment.CreatedAt = now
+	payment.UpdatedAt = now
+
+	query := `
+		INSERT INTO payments (
+			id, user_id, subscription_id, invoice_id, reason, attempt, provider, provider_payment_id,
+			amount, currency, refunded_amount, status, failure_code, failure_message, exchange_rate, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+	`
+
+	_, err := r.conn().ExecContext(ctx, query,
+		payment.ID,
+		payment.UserID,
+		payment.SubscriptionID,
+		nullableUUID(payment.InvoiceID),
+		nullableString(string(payment.Reason)),
+		payment.Attempt,
+		payment.Provider,
+		nullableString(payment.ProviderPaymentID),
+		payment.Amount,
+		payment.Currency,
+		payment.RefundedAmount,
+		payment.Status,
+		nullableString(payment.FailureCode),
+		nullableString(payment.FailureMessage),
+		exchangeRateColumn(payment.ExchangeRate),
+		payment.CreatedAt,
+		payment.UpdatedAt,
+	)
+
+	return err
+}
+
+func (r *PaymentRepository) GetBySubscriptionID(ctx context.Context, subscriptionID uuid.UUID) ([]*models.Payment, error) {
+	query := `
+		SELECT ` + paymentColumns + `
+		FROM payments
+		WHERE subscription_id = $1
+		ORDER BY created_at DESC
+	`
+
+	return r.list(ctx, query, subscriptionID)
+}
+
+func (r *PaymentRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.Payment, error) {
+	rows, err := r.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []*models.Payment{}
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+
+	return payments, rows.Err()
+}
+
+// GetByInvoiceID returns the payments made for an invoice, most recent first
+func (r *PaymentRepository) GetByInvoiceID(ctx context.Context, invoiceID uuid.UUID) ([]*models.Payment, error) {
+	query := `
+		SELECT ` + paymentColumns + `
+		FROM payments
+		WHERE invoice_id = $1
+		ORDER BY created_at DESC
+	`
+
+	return r.list(ctx, query, invoiceID)
+}
+
+func (r *PaymentRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Payment, error) {
+	return r.get(ctx, id, "")
+}
+
+func (r *PaymentRepository) GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*models.Payment, error) {
+	return r.get(ctx, id, "FOR UPDATE")
+}
+
+func (r *PaymentRepository) get(ctx context.Context, id uuid.UUID, lock string) (*models.Payment, error) {
+	query := `
+		SELECT ` + paymentColumns + `
+		FROM payments
+		WHERE id = $1
+	` + lock
+
+	payment, err := scanPayment(r.conn().QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domainErrors.ErrPaymentNotFound
+		}
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+func (r *PaymentRepository) GetByProviderPaymentID(ctx context.Context, provider, providerPaymentID string) (*models.Payment, error) {
+	query := `
+		SELECT ` + paymentColumns + `
+		FROM payments
+		WHERE provider = $1 AND provider_payment_id = $2
+	`
+
+	payment, err := scanPayment(r.conn().QueryRowContext(ctx, query, provider, providerPaymentID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domainErrors.ErrPaymentNotFound
+		}
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+func (r *PaymentRepository) Update(ctx context.Context, payment *models.Payment) error {
+	payment.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE payments
+		SET provider_payment_id = $1, invoice_id = $2, status = $3, failure_code = $4,
+			failure_message = $5, refunded_amount = $6, updated_at = $7
+		WHERE id = $8
+	`
+
+	result, err := r.conn().ExecContext(ctx, query,
+		nullableString(payment.ProviderPaymentID),
+		nullableUUID(payment.InvoiceID),
+		payment.Status,
+		nullableString(payment.FailureCode),
+		nullableString(payment.FailureMessage),
+		payment.RefundedAmount,
+		payment.UpdatedAt,
+		payment.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return domainErrors.ErrPaymentNotFound
+	}
+
+	return nil
+}
+
+// scanPayment scans a row selected with paymentColumns
+func scanPayment(row rowScanner) (*models.Payment, error) {
+	var payment models.Payment
+	var invoiceID uuid.NullUUID
+	var reason, providerPaymentID, failureCode, failureMessage sql.NullString
+
+	err := row.Scan(
+		&payment.ID,
+		&payment.UserID,
+		&payment.SubscriptionID,
+		&invoiceID,
+		&reason,
+		&payment.Attempt,
+		&payment.Provider,
+		&providerPaymentID,
+		&payment.Amount,
+		&payment.Currency,
+		&payment.RefundedAmount,
+		&payment.Status,
+		&failureCode,
+		&failureMessage,
+		jsonColumn{&payment.ExchangeRate},
+		&payment.CreatedAt,
+		&payment.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if invoiceID.Valid {
+		payment.InvoiceID = &invoiceID.UUID
+	}
+	payment.Reason = models.InvoiceReason(reason.String)
+	payment.ProviderPaymentID = providerPaymentID.String
+	payment.FailureCode = failureCode.String
+	payment.FailureMessage = failureMessage.String
+
+	return &payment, nil
+}
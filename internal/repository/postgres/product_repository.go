@@ -32,9 +32,10 @@ func (r *ProductRepository) Create(ctx context.Context, product *models.Product)
 	query := `
 		INSERT INTO products (
 			id, name, description, price, duration_months, 
-			tax_rate, is_active, created_at, updated_at
+			tax_rate, is_active, max_pause_days, refund_policy, refund_window_days,
+			tax_category, tax_inclusive, currency, prices, created_at, updated_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 	`
 
 	_, err := r.db.ExecContext(
@@ -47,6 +48,13 @@ func (r *ProductRepository) Create(ctx context.Context, product *models.Product)
 		product.DurationMonths,
 		product.TaxRate,
 		product.IsActive,
+		product.MaxPauseDays,
+		product.RefundPolicy,
+		product.RefundWindowDays,
+		product.TaxCategory,
+		product.TaxInclusive,
+		product.Currency,
+		productPricesColumn(product.Prices),
 		product.CreatedAt,
 		product.UpdatedAt,
 	)
@@ -62,7 +70,8 @@ func (r *ProductRepository) GetAll(ctx context.Context) ([]*models.Product, erro
 	query := `
 		SELECT 
 			id, name, description, price, duration_months, 
-			tax_rate, is_active, created_at, updated_at
+			tax_rate, is_active, max_pause_days, refund_policy, refund_window_days,
+			tax_category, tax_inclusive, currency, prices, created_at, updated_at
 		FROM products
 		ORDER BY created_at DESC
 	`
@@ -85,6 +94,13 @@ func (r *ProductRepository) GetAll(ctx context.Context) ([]*models.Product, erro
 			&product.DurationMonths,
 			&product.TaxRate,
 			&product.IsActive,
+			&product.MaxPauseDays,
+			&product.RefundPolicy,
+			&product.RefundWindowDays,
+			&product.TaxCategory,
+			&product.TaxInclusive,
+			&product.Currency,
+			jsonColumn{&product.Prices},
 			&product.CreatedAt,
 			&product.UpdatedAt,
 		)
@@ -107,7 +123,8 @@ func (r *ProductRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.
 	query := `
 		SELECT 
 			id, name, description, price, duration_months, 
-			tax_rate, is_active, created_at, updated_at
+			tax_rate, is_active, max_pause_days, refund_policy, refund_window_days,
+			tax_category, tax_inclusive, currency, prices, created_at, updated_at
 		FROM products
 		WHERE id = $1
 	`
@@ -125,6 +142,13 @@ func (r *ProductRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.
 		&product.DurationMonths,
 		&taxRate,
 		&product.IsActive,
+		&product.MaxPauseDays,
+		&product.RefundPolicy,
+		&product.RefundWindowDays,
+		&product.TaxCategory,
+		&product.TaxInclusive,
+		&product.Currency,
+		jsonColumn{&product.Prices},
 		&product.CreatedAt,
 		&product.UpdatedAt,
 	)
@@ -154,8 +178,15 @@ func (r *ProductRepository) Update(ctx context.Context, product *models.Product)
 			duration_months = $4, 
 			tax_rate = $5, 
 			is_active = $6, 
-			updated_at = $7
-		WHERE id = $8
+			max_pause_days = $7,
+			refund_policy = $8,
+			refund_window_days = $9,
+			tax_category = $10,
+			tax_inclusive = $11,
+			currency = $12,
+			prices = $13,
+			updated_at = $14
+		WHERE id = $15
 	`
 
 	result, err := r.db.ExecContext(
@@ -167,6 +198,13 @@ func (r *ProductRepository) Update(ctx context.Context, product *models.Product)
 		product.DurationMonths,
 		product.TaxRate,
 		product.IsActive,
+		product.MaxPauseDays,
+		product.RefundPolicy,
+		product.RefundWindowDays,
+		product.TaxCategory,
+		product.TaxInclusive,
+		product.Currency,
+		productPricesColumn(product.Prices),
 		product.UpdatedAt,
 		product.ID,
 	)
@@ -9,140 +9,167 @@ import (
 	domainErrors "github.com/assylzhan-a/subscription-service/internal/domain/errors"
 	"github.com/assylzhan-a/subscription-service/internal/domain/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
 )
 
+// subscriptionColumns lists the columns read by scanSubscription, with the
+// subscription aliased as s and its product as p
+const subscriptionColumns = `
+	s.id, s.user_id, s.product_id, s.voucher_id, s.status,
+	s.start_date, s.end_date, s.trial_end_date, s.currency, s.original_price,
+	s.discounted_price, s.discount_duration, s.discount_periods_remaining,
+	s.tax_amount, s.tax_components, s.reverse_charge, s.customer_vat_id, s.vat_validation_id,
+	s.total_amount, s.auto_renew,
+	s.scheduled_product_id, s.paused_at, s.resume_at,
+	s.cancel_at_period_end, s.cancelled_at,
+	s.failed_payment_attempts, s.next_payment_attempt_at,
+	s.version, s.created_at, s.updated_at,
+
+	p.id, p.name, p.description, p.price, p.duration_months,
+	p.tax_rate, p.is_active, p.max_pause_days, p.refund_policy, p.refund_window_days,
+	p.tax_category, p.tax_inclusive, p.currency, p.prices, p.created_at, p.updated_at
+`
+
 type SubscriptionRepository struct {
 	db *sql.DB
+	// tx is set when the repository is used inside a unit of work
+	tx *sql.Tx
 }
 
 func NewSubscriptionRepository(db *sql.DB) *SubscriptionRepository {
 	return &SubscriptionRepository{db: db}
 }
 
-func (r *SubscriptionRepository) Create(ctx context.Context, subscription *models.Subscription) error {
-	if subscription.ID == uuid.Nil {
-		subscription.ID = uuid.New()
+// conn returns the transaction the repository is bound to, or the database
+func (r *SubscriptionRepository) conn() dbtx {
+	if r.tx != nil {
+		return r.tx
 	}
+	return r.db
+}
 
-	now := time.Now()
-	subscription.CreatedAt = now
-	subscription.UpdatedAt = now
+// withTx runs fn in the transaction the repository is bound to, or in a new one
+func (r *SubscriptionRepository) withTx(ctx context.Context, fn func(tx dbtx) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
 
-	// Begin transaction
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	query := `
-		INSERT INTO subscriptions (
-			id, user_id, product_id, status,
-			start_date, end_date, trial_end_date, original_price,
-			tax_amount, total_amount, created_at, updated_at
-		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-	`
-
-	// Handle null values for trial_end_date
-	var trialEndDate interface{} = nil
-	if subscription.TrialEndDate != nil {
-		trialEndDate = *subscription.TrialEndDate
+	if err := fn(tx); err != nil {
+		return err
 	}
 
-	_, err = tx.ExecContext(
-		ctx,
-		query,
-		subscription.ID,
-		subscription.UserID,
-		subscription.ProductID,
-		subscription.Status,
-		subscription.StartDate,
-		subscription.EndDate,
-		trialEndDate,
-		subscription.OriginalPrice,
-		subscription.TaxAmount,
-		subscription.TotalAmount,
-		subscription.CreatedAt,
-		subscription.UpdatedAt,
-	)
+	return tx.Commit()
+}
 
-	if err != nil {
-		return err
+func (r *SubscriptionRepository) Create(ctx context.Context, subscription *models.Subscription) error {
+	if subscription.ID == uuid.Nil {
+		subscription.ID = uuid.New()
 	}
 
-	// Create initial state change record to track the 'active' state
-	stateChangeQuery := `
-		INSERT INTO subscription_state_changes (
-			id, subscription_id, previous_state, new_state,
-			changed_at, reason
+	now := time.Now()
+	subscription.CreatedAt = now
+	subscription.UpdatedAt = now
+	subscription.Version = 1
+
+	return r.withTx(ctx, func(tx dbtx) error {
+		query := `
+			INSERT INTO subscriptions (
+				id, user_id, product_id, voucher_id, status,
+				start_date, end_date, trial_end_date, currency, original_price,
+				discounted_price, discount_duration, discount_periods_remaining,
+				tax_amount, tax_components, reverse_charge, customer_vat_id, vat_validation_id,
+				total_amount, auto_renew,
+				scheduled_product_id, paused_at, resume_at,
+				cancel_at_period_end, cancelled_at,
+				failed_payment_attempts, next_payment_attempt_at,
+				version, created_at, updated_at
+			)
+			VALUES (
+				$1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+				$11, $12, $13, $14, $15, $16, $17, $18, $19, $20,
+				$21, $22, $23, $24, $25, $26, $27, $28, $29, $30
+			)
+		`
+
+		_, err := tx.ExecContext(
+			ctx,
+			query,
+			subscription.ID,
+			subscription.UserID,
+			subscription.ProductID,
+			nullableUUID(subscription.VoucherID),
+			subscription.Status,
+			subscription.StartDate,
+			subscription.EndDate,
+			nullableTime(subscription.TrialEndDate),
+			subscription.Currency,
+			subscription.OriginalPrice,
+			nullableDecimal(subscription.DiscountedPrice),
+			nullableString(string(subscription.DiscountDuration)),
+			subscription.DiscountPeriodsRemaining,
+			subscription.TaxAmount,
+			taxComponentsColumn(subscription.TaxComponents),
+			subscription.ReverseCharge,
+			nullableString(subscription.CustomerVATID),
+			nullableUUID(subscription.VATValidationID),
+			subscription.TotalAmount,
+			subscription.AutoRenew,
+			nullableUUID(subscription.ScheduledProductID),
+			nullableTime(subscription.PausedAt),
+			nullableTime(subscription.ResumeAt),
+			subscription.CancelAtPeriodEnd,
+			nullableTime(subscription.CancelledAt),
+			subscription.FailedPaymentAttempts,
+			nullableTime(subscription.NextPaymentAttemptAt),
+			subscription.Version,
+			subscription.CreatedAt,
+			subscription.UpdatedAt,
 		)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`
 
-	_, err = tx.ExecContext(
-		ctx,
-		stateChangeQuery,
-		uuid.New(),
-		subscription.ID,
-		"", // No previous state for a new subscription
-		subscription.Status,
-		now,
-		"Subscription created",
-	)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return err
-	}
+		// Create initial state change record to track the initial state
+		stateChangeQuery := `
+			INSERT INTO subscription_state_changes (
+				id, subscription_id, previous_state, new_state,
+				changed_at, reason
+			)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`
+
+		_, err = tx.ExecContext(
+			ctx,
+			stateChangeQuery,
+			uuid.New(),
+			subscription.ID,
+			"", // No previous state for a new subscription
+			subscription.Status,
+			now,
+			"Subscription created",
+		)
 
-	return tx.Commit()
+		return err
+	})
 }
 
 func (r *SubscriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
 	query := `
-		SELECT 
-			s.id, s.user_id, s.product_id, s.status,
-			s.start_date, s.end_date, s.trial_end_date, s.original_price,
-			s.tax_amount, s.total_amount, s.created_at, s.updated_at,
-			
-			p.id, p.name, p.description, p.price, p.duration_months, 
-			p.tax_rate, p.is_active, p.created_at, p.updated_at
+		SELECT ` + subscriptionColumns + `
 		FROM subscriptions s
 		JOIN products p ON s.product_id = p.id
 		WHERE s.id = $1
 	`
 
-	var subscription models.Subscription
-	var product models.Product
-
-	// Nullable fields
-	var trialEndDate sql.NullTime
-
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&subscription.ID,
-		&subscription.UserID,
-		&subscription.ProductID,
-		&subscription.Status,
-		&subscription.StartDate,
-		&subscription.EndDate,
-		&trialEndDate,
-		&subscription.OriginalPrice,
-		&subscription.TaxAmount,
-		&subscription.TotalAmount,
-		&subscription.CreatedAt,
-		&subscription.UpdatedAt,
-
-		&product.ID,
-		&product.Name,
-		&product.Description,
-		&product.Price,
-		&product.DurationMonths,
-		&product.TaxRate,
-		&product.IsActive,
-		&product.CreatedAt,
-		&product.UpdatedAt,
-	)
-
+	subscription, err := scanSubscription(r.conn().QueryRowContext(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, domainErrors.ErrSubscriptionNotFound
@@ -150,89 +177,99 @@ func (r *SubscriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*mo
 		return nil, err
 	}
 
-	// Handle nullable fields
-	if trialEndDate.Valid {
-		subscription.TrialEndDate = &trialEndDate.Time
-	}
-
-	return &subscription, nil
+	return subscription, nil
 }
 
 func (r *SubscriptionRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Subscription, error) {
 	query := `
-		SELECT 
-			s.id, s.user_id, s.product_id, s.status,
-			s.start_date, s.end_date, s.trial_end_date, s.original_price,
-			s.tax_amount, s.total_amount, s.created_at, s.updated_at,
-			
-			p.id, p.name, p.description, p.price, p.duration_months, 
-			p.tax_rate, p.is_active, p.created_at, p.updated_at
+		SELECT ` + subscriptionColumns + `
 		FROM subscriptions s
 		JOIN products p ON s.product_id = p.id
 		WHERE s.user_id = $1
 		ORDER BY s.created_at DESC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var subscriptions []*models.Subscription
-
-	for rows.Next() {
-		var subscription models.Subscription
-		var product models.Product
+	return r.queryMultipleSubscriptions(ctx, query, userID)
+}
 
-		// Nullable fields
-		var trialEndDate sql.NullTime
+// ClaimDueForRenewal leases up to limit active subscriptions whose period ended at or
+// before now and that are not scheduled to cancel
+func (r *SubscriptionRepository) ClaimDueForRenewal(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error) {
+	return r.claimDue(ctx, now, lease, limit, []models.SubscriptionStatus{models.SubscriptionStatusActive}, "end_date", "NOT cancel_at_period_end")
+}
 
-		err := rows.Scan(
-			&subscription.ID,
-			&subscription.UserID,
-			&subscription.ProductID,
-			&subscription.Status,
-			&subscription.StartDate,
-			&subscription.EndDate,
-			&trialEndDate,
-			&subscription.OriginalPrice,
-			&subscription.TaxAmount,
-			&subscription.TotalAmount,
-			&subscription.CreatedAt,
-			&subscription.UpdatedAt,
-
-			&product.ID,
-			&product.Name,
-			&product.Description,
-			&product.Price,
-			&product.DurationMonths,
-			&product.TaxRate,
-			&product.IsActive,
-			&product.CreatedAt,
-			&product.UpdatedAt,
-		)
+// ClaimDueForResume leases up to limit paused subscriptions whose resume date is at or before now
+func (r *SubscriptionRepository) ClaimDueForResume(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error) {
+	return r.claimDue(ctx, now, lease, limit, []models.SubscriptionStatus{models.SubscriptionStatusPaused}, "resume_at", "TRUE")
+}
 
-		if err != nil {
-			return nil, err
-		}
+// ClaimDueForActivation leases up to limit trialing subscriptions whose trial ended at or before now
+func (r *SubscriptionRepository) ClaimDueForActivation(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error) {
+	return r.claimDue(ctx, now, lease, limit, []models.SubscriptionStatus{models.SubscriptionStatusTrialing}, "trial_end_date", "TRUE")
+}
 
-		// Handle nullable fields
-		if trialEndDate.Valid {
-			subscription.TrialEndDate = &trialEndDate.Time
-		}
+// ClaimDueForCancellation leases up to limit active, past due or paused subscriptions
+// scheduled to cancel whose period ended at or before now. Paused subscriptions with a
+// resume date are left to resume first, which extends their period. Trialing
+// subscriptions are cancelled when their trial ends.
+func (r *SubscriptionRepository) ClaimDueForCancellation(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error) {
+	statuses := []models.SubscriptionStatus{
+		models.SubscriptionStatusActive,
+		models.SubscriptionStatusPastDue,
+		models.SubscriptionStatusPaused,
+	}
+	return r.claimDue(ctx, now, lease, limit, statuses, "end_date", "cancel_at_period_end AND (status <> 'paused' OR resume_at IS NULL)")
+}
 
-		// Add product relation
-		subscription.Product = &product
+// ClaimDueForPaymentRetry leases up to limit past due subscriptions whose next payment
+// attempt is at or before now and that are not scheduled to cancel
+func (r *SubscriptionRepository) ClaimDueForPaymentRetry(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error) {
+	return r.claimDue(ctx, now, lease, limit, []models.SubscriptionStatus{models.SubscriptionStatusPastDue}, "next_payment_attempt_at", "NOT cancel_at_period_end")
+}
 
-		subscriptions = append(subscriptions, &subscription)
-	}
+// claimDue leases up to limit subscriptions in one of the given statuses whose dueColumn is at or
+// before now and that match condition. Rows are claimed with FOR UPDATE SKIP LOCKED and
+// leased until now+lease, so concurrent workers on other replicas never pick the same
+// subscription. Update releases the lease; if a worker dies, the lease expires and
+// another worker retries. The jobs claim disjoint sets of subscriptions, so they share
+// the lease column.
+func (r *SubscriptionRepository) claimDue(
+	ctx context.Context,
+	now time.Time,
+	lease time.Duration,
+	limit int,
+	statuses []models.SubscriptionStatus,
+	dueColumn string,
+	condition string,
+) ([]*models.Subscription, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE subscriptions
+			SET renewal_locked_until = $2
+			WHERE id IN (
+				SELECT id FROM subscriptions
+				WHERE status = ANY($3)
+					AND ` + dueColumn + ` <= $1
+					AND ` + condition + `
+					AND (renewal_locked_until IS NULL OR renewal_locked_until < $1)
+				ORDER BY ` + dueColumn + `
+				LIMIT $4
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT ` + subscriptionColumns + `
+		FROM claimed s
+		JOIN products p ON s.product_id = p.id
+		ORDER BY s.` + dueColumn + `
+	`
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
 	}
 
-	return subscriptions, nil
+	return r.queryMultipleSubscriptions(ctx, query, now, now.Add(lease), pq.Array(names), limit)
 }
 
 func (r *SubscriptionRepository) Update(ctx context.Context, subscription *models.Subscription) error {
@@ -240,30 +277,67 @@ func (r *SubscriptionRepository) Update(ctx context.Context, subscription *model
 
 	query := `
 		UPDATE subscriptions
-		SET 
-			status = $1, 
-			start_date = $2, 
-			end_date = $3, 
-			trial_end_date = $4, 
-			updated_at = $5
-		WHERE id = $6
+		SET
+			product_id = $1,
+			voucher_id = $2,
+			status = $3,
+			start_date = $4,
+			end_date = $5,
+			trial_end_date = $6,
+			original_price = $7,
+			discounted_price = $8,
+			discount_duration = $9,
+			discount_periods_remaining = $10,
+			tax_amount = $11,
+			tax_components = $12,
+			reverse_charge = $13,
+			customer_vat_id = $14,
+			vat_validation_id = $15,
+			total_amount = $16,
+			auto_renew = $17,
+			scheduled_product_id = $18,
+			paused_at = $19,
+			resume_at = $20,
+			cancel_at_period_end = $21,
+			cancelled_at = $22,
+			failed_payment_attempts = $23,
+			next_payment_attempt_at = $24,
+			renewal_locked_until = NULL,
+			version = version + 1,
+			updated_at = $25
+		WHERE id = $26 AND version = $27
 	`
 
-	// Handle nullable trial_end_date
-	var trialEndDate interface{} = nil
-	if subscription.TrialEndDate != nil {
-		trialEndDate = *subscription.TrialEndDate
-	}
-
-	result, err := r.db.ExecContext(
+	result, err := r.conn().ExecContext(
 		ctx,
 		query,
+		subscription.ProductID,
+		nullableUUID(subscription.VoucherID),
 		subscription.Status,
 		subscription.StartDate,
 		subscription.EndDate,
-		trialEndDate,
+		nullableTime(subscription.TrialEndDate),
+		subscription.OriginalPrice,
+		nullableDecimal(subscription.DiscountedPrice),
+		nullableString(string(subscription.DiscountDuration)),
+		subscription.DiscountPeriodsRemaining,
+		subscription.TaxAmount,
+		taxComponentsColumn(subscription.TaxComponents),
+		subscription.ReverseCharge,
+		nullableString(subscription.CustomerVATID),
+		nullableUUID(subscription.VATValidationID),
+		subscription.TotalAmount,
+		subscription.AutoRenew,
+		nullableUUID(subscription.ScheduledProductID),
+		nullableTime(subscription.PausedAt),
+		nullableTime(subscription.ResumeAt),
+		subscription.CancelAtPeriodEnd,
+		nullableTime(subscription.CancelledAt),
+		subscription.FailedPaymentAttempts,
+		nullableTime(subscription.NextPaymentAttemptAt),
 		subscription.UpdatedAt,
 		subscription.ID,
+		subscription.Version,
 	)
 
 	if err != nil {
@@ -276,44 +350,62 @@ func (r *SubscriptionRepository) Update(ctx context.Context, subscription *model
 	}
 
 	if rowsAffected == 0 {
-		return domainErrors.ErrSubscriptionNotFound
+		// Either the subscription is gone or another request updated it first
+		var exists bool
+		existsQuery := `SELECT EXISTS(SELECT 1 FROM subscriptions WHERE id = $1)`
+		if err := r.conn().QueryRowContext(ctx, existsQuery, subscription.ID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return domainErrors.ErrSubscriptionNotFound
+		}
+		return domainErrors.ErrSubscriptionConflict
 	}
 
+	subscription.Version++
+
 	return nil
 }
 
 func (r *SubscriptionRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	// Begin transaction
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+	return r.withTx(ctx, func(tx dbtx) error {
+		// First delete state changes, pauses and redemptions (foreign key constraint)
+		stateChangeQuery := `DELETE FROM subscription_state_changes WHERE subscription_id = $1`
+		_, err := tx.ExecContext(ctx, stateChangeQuery, id)
+		if err != nil {
+			return err
+		}
 
-	// First delete state changes (foreign key constraint)
-	stateChangeQuery := `DELETE FROM subscription_state_changes WHERE subscription_id = $1`
-	_, err = tx.ExecContext(ctx, stateChangeQuery, id)
-	if err != nil {
-		return err
-	}
+		pauseQuery := `DELETE FROM subscription_pauses WHERE subscription_id = $1`
+		_, err = tx.ExecContext(ctx, pauseQuery, id)
+		if err != nil {
+			return err
+		}
 
-	// Then delete the subscription
-	subscriptionQuery := `DELETE FROM subscriptions WHERE id = $1`
-	result, err := tx.ExecContext(ctx, subscriptionQuery, id)
-	if err != nil {
-		return err
-	}
+		redemptionQuery := `DELETE FROM voucher_redemptions WHERE subscription_id = $1`
+		_, err = tx.ExecContext(ctx, redemptionQuery, id)
+		if err != nil {
+			return err
+		}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
+		// Then delete the subscription
+		subscriptionQuery := `DELETE FROM subscriptions WHERE id = $1`
+		result, err := tx.ExecContext(ctx, subscriptionQuery, id)
+		if err != nil {
+			return err
+		}
 
-	if rowsAffected == 0 {
-		return domainErrors.ErrSubscriptionNotFound
-	}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
 
-	return tx.Commit()
+		if rowsAffected == 0 {
+			return domainErrors.ErrSubscriptionNotFound
+		}
+
+		return nil
+	})
 }
 
 func (r *SubscriptionRepository) CreateStateChange(ctx context.Context, stateChange *models.SubscriptionStateChange) error {
@@ -328,12 +420,12 @@ func (r *SubscriptionRepository) CreateStateChange(ctx context.Context, stateCha
 	query := `
 		INSERT INTO subscription_state_changes (
 			id, subscription_id, previous_state, new_state,
-			changed_at, reason
+			changed_at, reason, reason_code, cancellation_reason, feedback_category
 		)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 
-	_, err := r.db.ExecContext(
+	_, err := r.conn().ExecContext(
 		ctx,
 		query,
 		stateChange.ID,
@@ -342,6 +434,9 @@ func (r *SubscriptionRepository) CreateStateChange(ctx context.Context, stateCha
 		stateChange.NewState,
 		stateChange.ChangedAt,
 		stateChange.Reason,
+		stateChange.ReasonCode,
+		stateChange.CancellationReason,
+		stateChange.FeedbackCategory,
 	)
 
 	return err
@@ -349,15 +444,15 @@ func (r *SubscriptionRepository) CreateStateChange(ctx context.Context, stateCha
 
 func (r *SubscriptionRepository) GetStateChangesBySubscriptionID(ctx context.Context, subscriptionID uuid.UUID) ([]*models.SubscriptionStateChange, error) {
 	query := `
-		SELECT 
+		SELECT
 			id, subscription_id, previous_state, new_state,
-			changed_at, reason
+			changed_at, reason, reason_code, cancellation_reason, feedback_category
 		FROM subscription_state_changes
 		WHERE subscription_id = $1
 		ORDER BY changed_at DESC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, subscriptionID)
+	rows, err := r.conn().QueryContext(ctx, query, subscriptionID)
 	if err != nil {
 		return nil, err
 	}
@@ -374,6 +469,9 @@ func (r *SubscriptionRepository) GetStateChangesBySubscriptionID(ctx context.Con
 			&stateChange.NewState,
 			&stateChange.ChangedAt,
 			&stateChange.Reason,
+			&stateChange.ReasonCode,
+			&stateChange.CancellationReason,
+			&stateChange.FeedbackCategory,
 		)
 
 		if err != nil {
@@ -389,3 +487,233 @@ func (r *SubscriptionRepository) GetStateChangesBySubscriptionID(ctx context.Con
 
 	return stateChanges, nil
 }
+
+func (r *SubscriptionRepository) CreatePause(ctx context.Context, pause *models.SubscriptionPause) error {
+	if pause.ID == uuid.Nil {
+		pause.ID = uuid.New()
+	}
+
+	query := `
+		INSERT INTO subscription_pauses (
+			id, subscription_id, paused_at, scheduled_resume_at, resumed_at
+		)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := r.conn().ExecContext(
+		ctx,
+		query,
+		pause.ID,
+		pause.SubscriptionID,
+		pause.PausedAt,
+		nullableTime(pause.ScheduledResumeAt),
+		nullableTime(pause.ResumedAt),
+	)
+
+	return err
+}
+
+func (r *SubscriptionRepository) EndPause(ctx context.Context, subscriptionID uuid.UUID, resumedAt time.Time) error {
+	query := `
+		UPDATE subscription_pauses
+		SET resumed_at = $1
+		WHERE subscription_id = $2 AND resumed_at IS NULL
+	`
+
+	_, err := r.conn().ExecContext(ctx, query, resumedAt, subscriptionID)
+	return err
+}
+
+func (r *SubscriptionRepository) GetPausesBySubscriptionID(ctx context.Context, subscriptionID uuid.UUID) ([]*models.SubscriptionPause, error) {
+	query := `
+		SELECT id, subscription_id, paused_at, scheduled_resume_at, resumed_at
+		FROM subscription_pauses
+		WHERE subscription_id = $1
+		ORDER BY paused_at DESC
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pauses []*models.SubscriptionPause
+
+	for rows.Next() {
+		pause := &models.SubscriptionPause{}
+		var scheduledResumeAt, resumedAt sql.NullTime
+
+		err := rows.Scan(
+			&pause.ID,
+			&pause.SubscriptionID,
+			&pause.PausedAt,
+			&scheduledResumeAt,
+			&resumedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if scheduledResumeAt.Valid {
+			pause.ScheduledResumeAt = &scheduledResumeAt.Time
+		}
+
+		if resumedAt.Valid {
+			pause.ResumedAt = &resumedAt.Time
+		}
+
+		pauses = append(pauses, pause)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pauses, nil
+}
+
+func (r *SubscriptionRepository) queryMultipleSubscriptions(ctx context.Context, query string, args ...interface{}) ([]*models.Subscription, error) {
+	rows, err := r.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []*models.Subscription
+
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+// scanSubscription scans a row selected with subscriptionColumns
+func scanSubscription(row rowScanner) (*models.Subscription, error) {
+	var subscription models.Subscription
+	var product models.Product
+
+	// Nullable fields
+	var voucherID uuid.NullUUID
+	var scheduledProductID uuid.NullUUID
+	var trialEndDate sql.NullTime
+	var pausedAt, resumeAt sql.NullTime
+	var cancelledAt sql.NullTime
+	var nextPaymentAttemptAt sql.NullTime
+	var discountedPrice decimal.NullDecimal
+	var discountDuration sql.NullString
+	var customerVATID sql.NullString
+	var vatValidationID uuid.NullUUID
+
+	err := row.Scan(
+		&subscription.ID,
+		&subscription.UserID,
+		&subscription.ProductID,
+		&voucherID,
+		&subscription.Status,
+		&subscription.StartDate,
+		&subscription.EndDate,
+		&trialEndDate,
+		&subscription.Currency,
+		&subscription.OriginalPrice,
+		&discountedPrice,
+		&discountDuration,
+		&subscription.DiscountPeriodsRemaining,
+		&subscription.TaxAmount,
+		jsonColumn{&subscription.TaxComponents},
+		&subscription.ReverseCharge,
+		&customerVATID,
+		&vatValidationID,
+		&subscription.TotalAmount,
+		&subscription.AutoRenew,
+		&scheduledProductID,
+		&pausedAt,
+		&resumeAt,
+		&subscription.CancelAtPeriodEnd,
+		&cancelledAt,
+		&subscription.FailedPaymentAttempts,
+		&nextPaymentAttemptAt,
+		&subscription.Version,
+		&subscription.CreatedAt,
+		&subscription.UpdatedAt,
+
+		&product.ID,
+		&product.Name,
+		&product.Description,
+		&product.Price,
+		&product.DurationMonths,
+		&product.TaxRate,
+		&product.IsActive,
+		&product.MaxPauseDays,
+		&product.RefundPolicy,
+		&product.RefundWindowDays,
+		&product.TaxCategory,
+		&product.TaxInclusive,
+		&product.Currency,
+		jsonColumn{&product.Prices},
+		&product.CreatedAt,
+		&product.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Handle nullable fields
+	if voucherID.Valid {
+		subscription.VoucherID = &voucherID.UUID
+	}
+
+	subscription.CustomerVATID = customerVATID.String
+	if vatValidationID.Valid {
+		subscription.VATValidationID = &vatValidationID.UUID
+	}
+
+	if scheduledProductID.Valid {
+		subscription.ScheduledProductID = &scheduledProductID.UUID
+	}
+
+	if trialEndDate.Valid {
+		subscription.TrialEndDate = &trialEndDate.Time
+	}
+
+	if pausedAt.Valid {
+		subscription.PausedAt = &pausedAt.Time
+	}
+
+	if resumeAt.Valid {
+		subscription.ResumeAt = &resumeAt.Time
+	}
+
+	if cancelledAt.Valid {
+		subscription.CancelledAt = &cancelledAt.Time
+	}
+
+	if nextPaymentAttemptAt.Valid {
+		subscription.NextPaymentAttemptAt = &nextPaymentAttemptAt.Time
+	}
+
+	if discountedPrice.Valid {
+		subscription.DiscountedPrice = &discountedPrice.Decimal
+	}
+
+	if discountDuration.Valid {
+		subscription.DiscountDuration = models.DiscountDuration(discountDuration.String)
+	}
+
+	// Add product relation
+	subscription.Product = &product
+
+	return &subscription, nil
+}
@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/assylzhan-a/subscription-service/internal/repository"
+)
+
+// UnitOfWork runs repository writes in a single database transaction
+type UnitOfWork struct {
+	db *sql.DB
+}
+
+func NewUnitOfWork(db *sql.DB) *UnitOfWork {
+	return &UnitOfWork{db: db}
+}
+
+func (u *UnitOfWork) Do(ctx context.Context, fn func(tx repository.Transaction) error) error {
+	// Begin transaction
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&transaction{db: u.db, tx: tx}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// transaction hands out repositories bound to one transaction
+type transaction struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func (t *transaction) Subscriptions() repository.SubscriptionRepository {
+	return &SubscriptionRepository{db: t.db, tx: t.tx}
+}
+
+func (t *transaction) Vouchers() repository.VoucherRepository {
+	return &VoucherRepository{db: t.db, tx: t.tx}
+}
+
+func (t *transaction) Campaigns() repository.CampaignRepository {
+	return &CampaignRepository{db: t.db, tx: t.tx}
+}
+
+func (t *transaction) Invoices() repository.InvoiceRepository {
+	return &InvoiceRepository{db: t.db, tx: t.tx}
+}
+
+func (t *transaction) Payments() repository.PaymentRepository {
+	return &PaymentRepository{db: t.db, tx: t.tx}
+}
+
+func (t *transaction) CreditNotes() repository.CreditNoteRepository {
+	return &CreditNoteRepository{db: t.db, tx: t.tx}
+}
+
+func (t *transaction) Credits() repository.CreditRepository {
+	return &CreditRepository{db: t.db, tx: t.tx}
+}
+
+func (t *transaction) Ledger() repository.LedgerRepository {
+	return &LedgerRepository{db: t.db, tx: t.tx}
+}
@@ -29,8 +29,8 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	user.UpdatedAt = now
 
 	query := `
-		INSERT INTO users (id, email, password, name, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO users (id, email, password, name, role, billing_address, business_profile, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 
 	_, err := r.db.ExecContext(
@@ -40,6 +40,9 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 		user.Email,
 		user.Password,
 		user.Name,
+		user.Role,
+		nullableAddress(user.BillingAddress),
+		nullableBusinessProfile(user.BusinessProfile),
 		user.CreatedAt,
 		user.UpdatedAt,
 	)
@@ -57,7 +60,7 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 
 func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	query := `
-		SELECT id, email, password, name, created_at, updated_at
+		SELECT id, email, password, name, role, billing_address, business_profile, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
@@ -68,6 +71,9 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Use
 		&user.Email,
 		&user.Password,
 		&user.Name,
+		&user.Role,
+		jsonColumn{&user.BillingAddress},
+		jsonColumn{&user.BusinessProfile},
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -84,7 +90,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Use
 
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, email, password, name, created_at, updated_at
+		SELECT id, email, password, name, role, billing_address, business_profile, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
@@ -95,6 +101,9 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 		&user.Email,
 		&user.Password,
 		&user.Name,
+		&user.Role,
+		jsonColumn{&user.BillingAddress},
+		jsonColumn{&user.BusinessProfile},
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -114,8 +123,8 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 
 	query := `
 		UPDATE users
-		SET email = $1, password = $2, name = $3, updated_at = $4
-		WHERE id = $5
+		SET email = $1, password = $2, name = $3, role = $4, billing_address = $5, business_profile = $6, updated_at = $7
+		WHERE id = $8
 	`
 
 	result, err := r.db.ExecContext(
@@ -124,6 +133,9 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 		user.Email,
 		user.Password,
 		user.Name,
+		user.Role,
+		nullableAddress(user.BillingAddress),
+		nullableBusinessProfile(user.BusinessProfile),
 		user.UpdatedAt,
 		user.ID,
 	)
@@ -148,6 +160,33 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	return nil
 }
 
+func (r *UserRepository) CountByRole(ctx context.Context, role models.UserRole) (int, error) {
+	query := `SELECT COUNT(*) FROM users WHERE role = $1`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, role).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// nullableAddress returns the address as a JSON query argument, or NULL if it is not set
+func nullableAddress(address *models.Address) interface{} {
+	if address == nil {
+		return nil
+	}
+	return jsonColumn{address}
+}
+
+// nullableBusinessProfile returns the profile as a JSON query argument, or NULL if it is not set
+func nullableBusinessProfile(profile *models.BusinessProfile) interface{} {
+	if profile == nil {
+		return nil
+	}
+	return jsonColumn{profile}
+}
+
 func isPgUniqueViolation(err error) bool {
 	return err != nil && err.Error() != "" && err.Error() == "pq: duplicate key value violates unique constraint"
 }
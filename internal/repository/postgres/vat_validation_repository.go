@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+)
+
+type VATValidationRepository struct {
+	db *sql.DB
+}
+
+func NewVATValidationRepository(db *sql.DB) *VATValidationRepository {
+	return &VATValidationRepository{db: db}
+}
+
+func (r *VATValidationRepository) Create(ctx context.Context, validation *models.VATValidation) error {
+	if validation.ID == uuid.Nil {
+		validation.ID = uuid.New()
+	}
+	if validation.CheckedAt.IsZero() {
+		validation.CheckedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO vat_validations (id, user_id, vat_id, status, source, message, reference, checked_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		validation.ID,
+		validation.UserID,
+		validation.VATID,
+		validation.Status,
+		validation.Source,
+		validation.Message,
+		nullableString(validation.Reference),
+		validation.CheckedAt,
+	)
+	return err
+}
+
+func (r *VATValidationRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.VATValidation, error) {
+	query := `
+		SELECT id, user_id, vat_id, status, source, message, reference, checked_at
+		FROM vat_validations
+		WHERE user_id = $1
+		ORDER BY checked_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	validations := []*models.VATValidation{}
+	for rows.Next() {
+		var validation models.VATValidation
+		var reference sql.NullString
+		if err := rows.Scan(
+			&validation.ID,
+			&validation.UserID,
+			&validation.VATID,
+			&validation.Status,
+			&validation.Source,
+			&validation.Message,
+			&reference,
+			&validation.CheckedAt,
+		); err != nil {
+			return nil, err
+		}
+		validation.Reference = reference.String
+		validations = append(validations, &validation)
+	}
+
+	return validations, rows.Err()
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	domainErrors "github.com/assylzhan-a/subscription-service/internal/domain/errors"
@@ -13,12 +15,41 @@ import (
 
 type VoucherRepository struct {
 	db *sql.DB
+	// tx is set when the repository is used inside a unit of work
+	tx *sql.Tx
 }
 
 func NewVoucherRepository(db *sql.DB) *VoucherRepository {
 	return &VoucherRepository{db: db}
 }
 
+// conn returns the transaction the repository is bound to, or the database
+func (r *VoucherRepository) conn() dbtx {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// withTx runs fn in the transaction the repository is bound to, or in a new one
+func (r *VoucherRepository) withTx(ctx context.Context, fn func(tx dbtx) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (r *VoucherRepository) Create(ctx context.Context, voucher *models.Voucher) error {
 	if voucher.ID == uuid.Nil {
 		voucher.ID = uuid.New()
@@ -30,10 +61,11 @@ func (r *VoucherRepository) Create(ctx context.Context, voucher *models.Voucher)
 
 	query := `
 		INSERT INTO vouchers (
-			id, code, discount_type, discount_value, product_id,
-			is_active, expires_at, created_at, updated_at
+			id, code, discount_type, discount_value, currency, discount_duration, discount_periods, product_id,
+			is_active, expires_at, campaign_id, max_redemptions,
+			max_redemptions_per_user, created_at, updated_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 	`
 
 	// Handle null product_id
@@ -42,16 +74,22 @@ func (r *VoucherRepository) Create(ctx context.Context, voucher *models.Voucher)
 		productID = *voucher.ProductID
 	}
 
-	_, err := r.db.ExecContext(
+	_, err := r.conn().ExecContext(
 		ctx,
 		query,
 		voucher.ID,
 		voucher.Code,
 		voucher.DiscountType,
 		voucher.DiscountValue,
+		nullableString(voucher.Currency),
+		voucher.DiscountDuration,
+		voucher.DiscountPeriods,
 		productID,
 		voucher.IsActive,
 		voucher.ExpiresAt,
+		nullableUUID(voucher.CampaignID),
+		voucher.MaxRedemptions,
+		voucher.MaxRedemptionsPerUser,
 		voucher.CreatedAt,
 		voucher.UpdatedAt,
 	)
@@ -70,8 +108,9 @@ func (r *VoucherRepository) Create(ctx context.Context, voucher *models.Voucher)
 func (r *VoucherRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Voucher, error) {
 	query := `
 		SELECT 
-			id, code, discount_type, discount_value, product_id,
-			is_active, expires_at, created_at, updated_at
+			id, code, discount_type, discount_value, currency, discount_duration, discount_periods, product_id,
+			is_active, expires_at, campaign_id, max_redemptions,
+			max_redemptions_per_user, redemption_count, created_at, updated_at
 		FROM vouchers
 		WHERE id = $1
 	`
@@ -82,8 +121,9 @@ func (r *VoucherRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.
 func (r *VoucherRepository) GetByCode(ctx context.Context, code string) (*models.Voucher, error) {
 	query := `
 		SELECT 
-			id, code, discount_type, discount_value, product_id,
-			is_active, expires_at, created_at, updated_at
+			id, code, discount_type, discount_value, currency, discount_duration, discount_periods, product_id,
+			is_active, expires_at, campaign_id, max_redemptions,
+			max_redemptions_per_user, redemption_count, created_at, updated_at
 		FROM vouchers
 		WHERE code = $1
 	`
@@ -94,8 +134,9 @@ func (r *VoucherRepository) GetByCode(ctx context.Context, code string) (*models
 func (r *VoucherRepository) GetByProductID(ctx context.Context, productID uuid.UUID) ([]*models.Voucher, error) {
 	query := `
 		SELECT 
-			id, code, discount_type, discount_value, product_id,
-			is_active, expires_at, created_at, updated_at
+			id, code, discount_type, discount_value, currency, discount_duration, discount_periods, product_id,
+			is_active, expires_at, campaign_id, max_redemptions,
+			max_redemptions_per_user, redemption_count, created_at, updated_at
 		FROM vouchers
 		WHERE product_id = $1 OR product_id IS NULL
 		ORDER BY created_at DESC
@@ -107,8 +148,9 @@ func (r *VoucherRepository) GetByProductID(ctx context.Context, productID uuid.U
 func (r *VoucherRepository) GetAllActive(ctx context.Context) ([]*models.Voucher, error) {
 	query := `
 		SELECT 
-			id, code, discount_type, discount_value, product_id,
-			is_active, expires_at, created_at, updated_at
+			id, code, discount_type, discount_value, currency, discount_duration, discount_periods, product_id,
+			is_active, expires_at, campaign_id, max_redemptions,
+			max_redemptions_per_user, redemption_count, created_at, updated_at
 		FROM vouchers
 		WHERE is_active = true AND expires_at > $1
 		ORDER BY created_at DESC
@@ -117,6 +159,125 @@ func (r *VoucherRepository) GetAllActive(ctx context.Context) ([]*models.Voucher
 	return r.scanMultipleVouchers(ctx, query, time.Now())
 }
 
+func (r *VoucherRepository) GetByCampaignID(ctx context.Context, campaignID uuid.UUID) ([]*models.Voucher, error) {
+	query := `
+		SELECT 
+			id, code, discount_type, discount_value, currency, discount_duration, discount_periods, product_id,
+			is_active, expires_at, campaign_id, max_redemptions,
+			max_redemptions_per_user, redemption_count, created_at, updated_at
+		FROM vouchers
+		WHERE campaign_id = $1
+		ORDER BY code
+	`
+
+	return r.scanMultipleVouchers(ctx, query, campaignID)
+}
+
+// voucherBatchSize keeps a batch insert well below PostgreSQL's limit of 65535 parameters
+const voucherBatchSize = 1000
+
+// CreateBatch inserts vouchers voucherBatchSize rows per statement. Codes that already
+// exist are skipped by ON CONFLICT instead of failing the batch, so callers can
+// replace them without checking each code first.
+func (r *VoucherRepository) CreateBatch(ctx context.Context, vouchers []*models.Voucher) ([]string, error) {
+	var skipped []string
+
+	err := r.withTx(ctx, func(tx dbtx) error {
+		for start := 0; start < len(vouchers); start += voucherBatchSize {
+			batch := vouchers[start:min(start+voucherBatchSize, len(vouchers))]
+
+			inserted, err := insertVoucherBatch(ctx, tx, batch)
+			if err != nil {
+				return err
+			}
+
+			for _, voucher := range batch {
+				if !inserted[voucher.Code] {
+					skipped = append(skipped, voucher.Code)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return skipped, nil
+}
+
+func insertVoucherBatch(ctx context.Context, tx dbtx, vouchers []*models.Voucher) (map[string]bool, error) {
+	const columns = 15
+
+	now := time.Now()
+	values := make([]string, len(vouchers))
+	args := make([]interface{}, 0, len(vouchers)*columns)
+
+	for i, voucher := range vouchers {
+		if voucher.ID == uuid.Nil {
+			voucher.ID = uuid.New()
+		}
+		voucher.CreatedAt = now
+		voucher.UpdatedAt = now
+
+		placeholders := make([]string, columns)
+		for j := range placeholders {
+			placeholders[j] = fmt.Sprintf("$%d", i*columns+j+1)
+		}
+		values[i] = "(" + strings.Join(placeholders, ", ") + ")"
+
+		args = append(args,
+			voucher.ID,
+			voucher.Code,
+			voucher.DiscountType,
+			voucher.DiscountValue,
+			nullableString(voucher.Currency),
+			voucher.DiscountDuration,
+			voucher.DiscountPeriods,
+			nullableUUID(voucher.ProductID),
+			voucher.IsActive,
+			voucher.ExpiresAt,
+			nullableUUID(voucher.CampaignID),
+			voucher.MaxRedemptions,
+			voucher.MaxRedemptionsPerUser,
+			voucher.CreatedAt,
+			voucher.UpdatedAt,
+		)
+	}
+
+	query := `
+		INSERT INTO vouchers (
+			id, code, discount_type, discount_value, currency, discount_duration, discount_periods, product_id,
+			is_active, expires_at, campaign_id, max_redemptions,
+			max_redemptions_per_user, created_at, updated_at
+		)
+		VALUES ` + strings.Join(values, ", ") + `
+		ON CONFLICT (code) DO NOTHING
+		RETURNING code
+	`
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inserted := make(map[string]bool, len(vouchers))
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		inserted[code] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return inserted, nil
+}
+
 func (r *VoucherRepository) Update(ctx context.Context, voucher *models.Voucher) error {
 	voucher.UpdatedAt = time.Now()
 
@@ -126,11 +287,16 @@ func (r *VoucherRepository) Update(ctx context.Context, voucher *models.Voucher)
 			code = $1, 
 			discount_type = $2, 
 			discount_value = $3, 
-			product_id = $4, 
-			is_active = $5, 
-			expires_at = $6,
-			updated_at = $7
-		WHERE id = $8
+			currency = $4,
+			discount_duration = $5,
+			discount_periods = $6,
+			product_id = $7, 
+			is_active = $8, 
+			expires_at = $9,
+			max_redemptions = $10,
+			max_redemptions_per_user = $11,
+			updated_at = $12
+		WHERE id = $13
 	`
 
 	var productID interface{} = nil
@@ -138,15 +304,20 @@ func (r *VoucherRepository) Update(ctx context.Context, voucher *models.Voucher)
 		productID = *voucher.ProductID
 	}
 
-	result, err := r.db.ExecContext(
+	result, err := r.conn().ExecContext(
 		ctx,
 		query,
 		voucher.Code,
 		voucher.DiscountType,
 		voucher.DiscountValue,
+		nullableString(voucher.Currency),
+		voucher.DiscountDuration,
+		voucher.DiscountPeriods,
 		productID,
 		voucher.IsActive,
 		voucher.ExpiresAt,
+		voucher.MaxRedemptions,
+		voucher.MaxRedemptionsPerUser,
 		voucher.UpdatedAt,
 		voucher.ID,
 	)
@@ -174,7 +345,7 @@ func (r *VoucherRepository) Update(ctx context.Context, voucher *models.Voucher)
 func (r *VoucherRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	query := `DELETE FROM vouchers WHERE id = $1`
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	result, err := r.conn().ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -191,18 +362,140 @@ func (r *VoucherRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// Redeem increments the voucher's redemption count only while it is below the limit.
+// The update locks the voucher row until the transaction ends, so concurrent
+// redemptions of the same voucher are counted one after another.
+func (r *VoucherRepository) Redeem(ctx context.Context, redemption *models.VoucherRedemption) error {
+	if redemption.ID == uuid.Nil {
+		redemption.ID = uuid.New()
+	}
+
+	if redemption.RedeemedAt.IsZero() {
+		redemption.RedeemedAt = time.Now()
+	}
+
+	return r.withTx(ctx, func(tx dbtx) error {
+		query := `
+			UPDATE vouchers
+			SET redemption_count = redemption_count + 1, updated_at = $2
+			WHERE id = $1 AND (max_redemptions = 0 OR redemption_count < max_redemptions)
+			RETURNING max_redemptions_per_user
+		`
+
+		var maxPerUser int
+		err := tx.QueryRowContext(ctx, query, redemption.VoucherID, redemption.RedeemedAt).Scan(&maxPerUser)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+
+			// Either the voucher is gone or it is used up
+			var exists bool
+			existsQuery := `SELECT EXISTS(SELECT 1 FROM vouchers WHERE id = $1)`
+			if err := tx.QueryRowContext(ctx, existsQuery, redemption.VoucherID).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				return domainErrors.ErrVoucherNotFound
+			}
+			return domainErrors.ErrVoucherRedemptionLimitReached
+		}
+
+		if maxPerUser > 0 {
+			var userRedemptions int
+			countQuery := `SELECT COUNT(*) FROM voucher_redemptions WHERE voucher_id = $1 AND user_id = $2`
+			if err := tx.QueryRowContext(ctx, countQuery, redemption.VoucherID, redemption.UserID).Scan(&userRedemptions); err != nil {
+				return err
+			}
+			if userRedemptions >= maxPerUser {
+				return domainErrors.ErrVoucherUserLimitReached
+			}
+		}
+
+		insertQuery := `
+			INSERT INTO voucher_redemptions (
+				id, voucher_id, user_id, subscription_id, discount_amount, redeemed_at
+			)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`
+
+		_, err = tx.ExecContext(
+			ctx,
+			insertQuery,
+			redemption.ID,
+			redemption.VoucherID,
+			redemption.UserID,
+			redemption.SubscriptionID,
+			redemption.DiscountAmount,
+			redemption.RedeemedAt,
+		)
+
+		return err
+	})
+}
+
+func (r *VoucherRepository) GetRedemptionsByVoucherID(ctx context.Context, voucherID uuid.UUID) ([]*models.VoucherRedemption, error) {
+	query := `
+		SELECT id, voucher_id, user_id, subscription_id, discount_amount, redeemed_at
+		FROM voucher_redemptions
+		WHERE voucher_id = $1
+		ORDER BY redeemed_at DESC
+	`
+
+	rows, err := r.conn().QueryContext(ctx, query, voucherID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var redemptions []*models.VoucherRedemption
+
+	for rows.Next() {
+		redemption := &models.VoucherRedemption{}
+		err := rows.Scan(
+			&redemption.ID,
+			&redemption.VoucherID,
+			&redemption.UserID,
+			&redemption.SubscriptionID,
+			&redemption.DiscountAmount,
+			&redemption.RedeemedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		redemptions = append(redemptions, redemption)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return redemptions, nil
+}
+
 func (r *VoucherRepository) scanVoucher(ctx context.Context, query string, args ...interface{}) (*models.Voucher, error) {
 	voucher := &models.Voucher{}
 	var productID sql.NullString
+	var campaignID uuid.NullUUID
+	var currency sql.NullString
 
-	err := r.db.QueryRowContext(ctx, query, args...).Scan(
+	err := r.conn().QueryRowContext(ctx, query, args...).Scan(
 		&voucher.ID,
 		&voucher.Code,
 		&voucher.DiscountType,
 		&voucher.DiscountValue,
+		&currency,
+		&voucher.DiscountDuration,
+		&voucher.DiscountPeriods,
 		&productID,
 		&voucher.IsActive,
 		&voucher.ExpiresAt,
+		&campaignID,
+		&voucher.MaxRedemptions,
+		&voucher.MaxRedemptionsPerUser,
+		&voucher.RedemptionCount,
 		&voucher.CreatedAt,
 		&voucher.UpdatedAt,
 	)
@@ -222,11 +515,17 @@ func (r *VoucherRepository) scanVoucher(ctx context.Context, query string, args
 		voucher.ProductID = &uid
 	}
 
+	if campaignID.Valid {
+		voucher.CampaignID = &campaignID.UUID
+	}
+
+	voucher.Currency = currency.String
+
 	return voucher, nil
 }
 
 func (r *VoucherRepository) scanMultipleVouchers(ctx context.Context, query string, args ...interface{}) ([]*models.Voucher, error) {
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	rows, err := r.conn().QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -237,15 +536,24 @@ func (r *VoucherRepository) scanMultipleVouchers(ctx context.Context, query stri
 	for rows.Next() {
 		voucher := &models.Voucher{}
 		var productID sql.NullString
+		var campaignID uuid.NullUUID
+		var currency sql.NullString
 
 		err := rows.Scan(
 			&voucher.ID,
 			&voucher.Code,
 			&voucher.DiscountType,
 			&voucher.DiscountValue,
+			&currency,
+			&voucher.DiscountDuration,
+			&voucher.DiscountPeriods,
 			&productID,
 			&voucher.IsActive,
 			&voucher.ExpiresAt,
+			&campaignID,
+			&voucher.MaxRedemptions,
+			&voucher.MaxRedemptionsPerUser,
+			&voucher.RedemptionCount,
 			&voucher.CreatedAt,
 			&voucher.UpdatedAt,
 		)
@@ -262,6 +570,12 @@ func (r *VoucherRepository) scanMultipleVouchers(ctx context.Context, query stri
 			voucher.ProductID = &uid
 		}
 
+		if campaignID.Valid {
+			voucher.CampaignID = &campaignID.UUID
+		}
+
+		voucher.Currency = currency.String
+
 		vouchers = append(vouchers, voucher)
 	}
 
@@ -0,0 +1,189 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	domainErrors "github.com/assylzhan-a/subscription-service/internal/domain/errors"
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/google/uuid"
+)
+
+// webhookEventColumns lists the columns read by scanWebhookEvent
+const webhookEventColumns = `
+	id, provider, event_id, type, payload, status, attempts, last_error, received_at, processed_at
+`
+
+type WebhookEventRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookEventRepository(db *sql.DB) *WebhookEventRepository {
+	return &WebhookEventRepository{db: db}
+}
+
+func (r *WebhookEventRepository) Create(ctx context.Context, event *models.WebhookEvent) error {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.ReceivedAt.IsZero() {
+		event.ReceivedAt = time.Now()
+	}
+
+	// The unique (provider, event_id) constraint makes a redelivered event a no-op
+	query := `
+		INSERT INTO webhook_events (
+			id, provider, event_id, type, payload, status, attempts, last_error, received_at, processed_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (provider, event_id) DO NOTHING
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		event.ID,
+		event.Provider,
+		event.EventID,
+		event.Type,
+		event.Payload,
+		event.Status,
+		event.Attempts,
+		nullableString(event.LastError),
+		event.ReceivedAt,
+		nullableTime(event.ProcessedAt),
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return domainErrors.ErrDuplicateWebhookEvent
+	}
+
+	return nil
+}
+
+func (r *WebhookEventRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.WebhookEvent, error) {
+	query := `
+		SELECT ` + webhookEventColumns + `
+		FROM webhook_events
+		WHERE id = $1
+	`
+
+	return r.getOne(ctx, query, id)
+}
+
+func (r *WebhookEventRepository) GetByProviderEventID(ctx context.Context, provider, eventID string) (*models.WebhookEvent, error) {
+	query := `
+		SELECT ` + webhookEventColumns + `
+		FROM webhook_events
+		WHERE provider = $1 AND event_id = $2
+	`
+
+	return r.getOne(ctx, query, provider, eventID)
+}
+
+func (r *WebhookEventRepository) getOne(ctx context.Context, query string, args ...interface{}) (*models.WebhookEvent, error) {
+	event, err := scanWebhookEvent(r.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domainErrors.ErrWebhookEventNotFound
+		}
+		return nil, err
+	}
+
+	return event, nil
+}
+
+func (r *WebhookEventRepository) List(ctx context.Context, status models.WebhookEventStatus, limit int) ([]*models.WebhookEvent, error) {
+	query := `
+		SELECT ` + webhookEventColumns + `
+		FROM webhook_events
+		WHERE $1 = '' OR status = $1
+		ORDER BY received_at DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*models.WebhookEvent{}
+	for rows.Next() {
+		event, err := scanWebhookEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (r *WebhookEventRepository) Update(ctx context.Context, event *models.WebhookEvent) error {
+	query := `
+		UPDATE webhook_events
+		SET status = $1, attempts = $2, last_error = $3, processed_at = $4
+		WHERE id = $5
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		event.Status,
+		event.Attempts,
+		nullableString(event.LastError),
+		nullableTime(event.ProcessedAt),
+		event.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return domainErrors.ErrWebhookEventNotFound
+	}
+
+	return nil
+}
+
+// scanWebhookEvent scans a row selected with webhookEventColumns
+func scanWebhookEvent(row rowScanner) (*models.WebhookEvent, error) {
+	var event models.WebhookEvent
+	var lastError sql.NullString
+	var processedAt sql.NullTime
+
+	err := row.Scan(
+		&event.ID,
+		&event.Provider,
+		&event.EventID,
+		&event.Type,
+		&event.Payload,
+		&event.Status,
+		&event.Attempts,
+		&lastError,
+		&event.ReceivedAt,
+		&processedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	event.LastError = lastError.String
+	if processedAt.Valid {
+		event.ProcessedAt = &processedAt.Time
+	}
+
+	return &event, nil
+}
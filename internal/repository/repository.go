@@ -2,9 +2,11 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/assylzhan-a/subscription-service/internal/domain/models"
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
 // UserRepository defines operations for user persistence
@@ -13,6 +15,19 @@ type UserRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
 	Update(ctx context.Context, user *models.User) error
+	CountByRole(ctx context.Context, role models.UserRole) (int, error)
+}
+
+// TokenRepository defines operations for refresh token and access token revocation persistence
+type TokenRepository interface {
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	// RotateRefreshToken atomically revokes the old token and stores its replacement.
+	// It returns ErrRefreshTokenReused if the old token was already revoked.
+	RotateRefreshToken(ctx context.Context, oldID uuid.UUID, replacement *models.RefreshToken) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, tokenID string) (bool, error)
 }
 
 // ProductRepository defines operations for product persistence
@@ -29,10 +44,49 @@ type SubscriptionRepository interface {
 	Create(ctx context.Context, subscription *models.Subscription) error
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
 	GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Subscription, error)
+	// Update saves the subscription if its version is unchanged since it was read and
+	// increments the version. It returns ErrSubscriptionConflict otherwise.
 	Update(ctx context.Context, subscription *models.Subscription) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	// ClaimDueForRenewal leases active subscriptions whose period has ended and that are
+	// not scheduled to cancel, so that only one worker processes each of them. Update
+	// releases the lease.
+	ClaimDueForRenewal(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error)
+	// ClaimDueForResume leases paused subscriptions whose resume date has arrived
+	ClaimDueForResume(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error)
+	// ClaimDueForActivation leases trialing subscriptions whose trial has ended
+	ClaimDueForActivation(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error)
+	// ClaimDueForCancellation leases active, past due or paused subscriptions scheduled to
+	// cancel whose period has ended. Paused subscriptions with a resume date are not
+	// claimed until they resume.
+	ClaimDueForCancellation(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error)
+	// ClaimDueForPaymentRetry leases past due subscriptions whose next payment attempt is due
+	// and that are not scheduled to cancel
+	ClaimDueForPaymentRetry(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Subscription, error)
 	CreateStateChange(ctx context.Context, stateChange *models.SubscriptionStateChange) error
 	GetStateChangesBySubscriptionID(ctx context.Context, subscriptionID uuid.UUID) ([]*models.SubscriptionStateChange, error)
+	CreatePause(ctx context.Context, pause *models.SubscriptionPause) error
+	// EndPause sets the resume time on the subscription's open pause
+	EndPause(ctx context.Context, subscriptionID uuid.UUID, resumedAt time.Time) error
+	GetPausesBySubscriptionID(ctx context.Context, subscriptionID uuid.UUID) ([]*models.SubscriptionPause, error)
+}
+
+// Transaction gives access to repositories whose writes commit or roll back together
+type Transaction interface {
+	Subscriptions() SubscriptionRepository
+	Vouchers() VoucherRepository
+	Campaigns() CampaignRepository
+	Invoices() InvoiceRepository
+	Payments() PaymentRepository
+	CreditNotes() CreditNoteRepository
+	Credits() CreditRepository
+	Ledger() LedgerRepository
+}
+
+// UnitOfWork runs a set of repository writes as one transaction
+type UnitOfWork interface {
+	// Do calls fn with a transaction. It commits when fn returns nil and rolls back otherwise.
+	Do(ctx context.Context, fn func(tx Transaction) error) error
 }
 
 // VoucherRepository defines operations for voucher persistence
@@ -42,6 +96,129 @@ type VoucherRepository interface {
 	GetByCode(ctx context.Context, code string) (*models.Voucher, error)
 	GetByProductID(ctx context.Context, productID uuid.UUID) ([]*models.Voucher, error)
 	GetAllActive(ctx context.Context) ([]*models.Voucher, error)
+	GetByCampaignID(ctx context.Context, campaignID uuid.UUID) ([]*models.Voucher, error)
+	// CreateBatch inserts vouchers in one statement and skips those whose code already
+	// exists. It returns the codes that were skipped.
+	CreateBatch(ctx context.Context, vouchers []*models.Voucher) ([]string, error)
 	Update(ctx context.Context, voucher *models.Voucher) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	// Redeem counts a redemption against the voucher's limits and records it. It
+	// returns ErrVoucherRedemptionLimitReached or ErrVoucherUserLimitReached when a
+	// limit would be exceeded, also under concurrent redemptions.
+	Redeem(ctx context.Context, redemption *models.VoucherRedemption) error
+	GetRedemptionsByVoucherID(ctx context.Context, voucherID uuid.UUID) ([]*models.VoucherRedemption, error)
+}
+
+// CampaignRepository defines operations for voucher campaign persistence
+type CampaignRepository interface {
+	Create(ctx context.Context, campaign *models.Campaign) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Campaign, error)
+	GetAll(ctx context.Context) ([]*models.Campaign, error)
+}
+
+// InvoiceRepository defines operations for invoice persistence. Invoices are finalized
+// when they are created; only their payment status can change afterwards.
+type InvoiceRepository interface {
+	// Create assigns the invoice the next number of its year and saves it with its lines.
+	// Numbers have no gaps, because a rolled back transaction also gives its number back.
+	Create(ctx context.Context, invoice *models.Invoice) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Invoice, error)
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Invoice, error)
+	// GetIssuedBetween returns the invoices issued from the start up to, not including,
+	// the end, in the order they were issued
+	GetIssuedBetween(ctx context.Context, start, end time.Time) ([]*models.Invoice, error)
+	UpdatePaymentStatus(ctx context.Context, id uuid.UUID, status models.InvoicePaymentStatus) error
+}
+
+// PaymentRepository defines operations for payment accounts and payment persistence
+type PaymentRepository interface {
+	GetAccount(ctx context.Context, userID uuid.UUID, provider string) (*models.PaymentAccount, error)
+	// SaveAccount creates the account or replaces the user's account at the same provider
+	SaveAccount(ctx context.Context, account *models.PaymentAccount) error
+	Create(ctx context.Context, payment *models.Payment) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Payment, error)
+	// GetByIDForUpdate is GetByID for a payment the unit of work changes; the payment
+	// stays locked until the unit of work ends
+	GetByIDForUpdate(ctx context.Context, id uuid.UUID) (*models.Payment, error)
+	GetBySubscriptionID(ctx context.Context, subscriptionID uuid.UUID) ([]*models.Payment, error)
+	GetByInvoiceID(ctx context.Context, invoiceID uuid.UUID) ([]*models.Payment, error)
+	GetByProviderPaymentID(ctx context.Context, provider, providerPaymentID string) (*models.Payment, error)
+	// Update saves the payment's provider payment ID, status, failure, refunded amount and invoice
+	Update(ctx context.Context, payment *models.Payment) error
+}
+
+// CreditNoteRepository defines operations for credit note persistence. Credit notes
+// cannot be changed once they are created.
+type CreditNoteRepository interface {
+	// Create assigns the credit note the next number of its year, like invoices are numbered
+	Create(ctx context.Context, creditNote *models.CreditNote) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.CreditNote, error)
+	GetByInvoiceID(ctx context.Context, invoiceID uuid.UUID) ([]*models.CreditNote, error)
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.CreditNote, error)
+	// GetIssuedBetween returns the credit notes issued from the start up to, not
+	// including, the end, in the order they were issued
+	GetIssuedBetween(ctx context.Context, start, end time.Time) ([]*models.CreditNote, error)
+}
+
+// CreditRepository defines operations for the users' credit balance ledger
+type CreditRepository interface {
+	// GetBalance returns the user's balance in the currency, zero if they never had
+	// credit in it
+	GetBalance(ctx context.Context, userID uuid.UUID, currency string) (decimal.Decimal, error)
+	// GetBalances returns the user's balances by currency
+	GetBalances(ctx context.Context, userID uuid.UUID) (map[string]decimal.Decimal, error)
+	// AddEntry locks the user's balance in the entry's currency, applies the entry to it and records the entry
+	// with the new balance. It returns ErrInsufficientCredit if a debit exceeds the balance.
+	AddEntry(ctx context.Context, entry *models.CreditEntry) error
+	GetEntries(ctx context.Context, userID uuid.UUID) ([]*models.CreditEntry, error)
+}
+
+// VATValidationRepository defines operations for VAT ID validation records, which
+// cannot be changed once they are created
+type VATValidationRepository interface {
+	Create(ctx context.Context, validation *models.VATValidation) error
+	// GetByUserID returns the user's validations, most recent first
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.VATValidation, error)
+}
+
+// ExchangeRateRepository defines operations for the exchange rates amounts are
+// converted to the reporting currency with
+type ExchangeRateRepository interface {
+	// Save creates the rates, replacing rates of the same currencies and day
+	Save(ctx context.Context, rates []*models.ExchangeRate) error
+	// GetLatest returns the most recent rate from base to currency on or before the
+	// day of on. It returns ErrExchangeRateNotFound if there is none.
+	GetLatest(ctx context.Context, base, currency string, on time.Time) (*models.ExchangeRate, error)
+	// GetByDate returns the rates of a day, ordered by base and currency
+	GetByDate(ctx context.Context, date time.Time) ([]*models.ExchangeRate, error)
+}
+
+// LedgerRepository defines operations for the double-entry ledger's journal entries
+type LedgerRepository interface {
+	// Post creates a balanced journal entry with its lines. It returns
+	// ErrJournalEntryExists if the invoice's revenue was already recognized.
+	Post(ctx context.Context, entry *models.JournalEntry) error
+	// GetDeferredRevenue returns the revenue of an invoice that is still deferred
+	GetDeferredRevenue(ctx context.Context, invoiceID uuid.UUID) (decimal.Decimal, error)
+	// GetDueDeferredRevenue returns up to limit invoices whose period ended before end
+	// that still have deferred revenue
+	GetDueDeferredRevenue(ctx context.Context, end time.Time, limit int) ([]*models.DeferredRevenue, error)
+	// GetAccountTotals returns the debits and credits of each account and currency
+	// posted before asOf
+	GetAccountTotals(ctx context.Context, asOf time.Time) ([]*models.AccountTotals, error)
+	// GetUnbalancedEntries returns the IDs of entries whose debits do not equal their credits
+	GetUnbalancedEntries(ctx context.Context) ([]uuid.UUID, error)
+}
+
+// WebhookEventRepository defines operations for received webhook event persistence
+type WebhookEventRepository interface {
+	// Create stores the event. It returns ErrDuplicateWebhookEvent if the provider's
+	// event ID was already stored.
+	Create(ctx context.Context, event *models.WebhookEvent) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.WebhookEvent, error)
+	GetByProviderEventID(ctx context.Context, provider, eventID string) (*models.WebhookEvent, error)
+	// List returns the most recently received events, only those with the status if it is set
+	List(ctx context.Context, status models.WebhookEventStatus, limit int) ([]*models.WebhookEvent, error)
+	// Update saves the event's processing status, attempts and error
+	Update(ctx context.Context, event *models.WebhookEvent) error
 }
@@ -17,24 +17,90 @@ type LoginUserRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type LoginResponse struct {
-	User      UserResponse `json:"user"`
-	Token     string       `json:"token"`
-	ExpiresAt int64        `json:"expires_at"`
+	User                  UserResponse `json:"user"`
+	Token                 string       `json:"token"`
+	ExpiresAt             int64        `json:"expires_at"`
+	RefreshToken          string       `json:"refresh_token"`
+	RefreshTokenExpiresAt int64        `json:"refresh_token_expires_at"`
 }
 
 type UserResponse struct {
-	ID        string    `json:"id"`
-	Email     string    `json:"email"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
+	ID              string                   `json:"id"`
+	Email           string                   `json:"email"`
+	Name            string                   `json:"name"`
+	Role            string                   `json:"role"`
+	BillingAddress  *AddressResponse         `json:"billing_address,omitempty"`
+	BusinessProfile *BusinessProfileResponse `json:"business_profile,omitempty"`
+	CreatedAt       time.Time                `json:"created_at"`
+}
+
+type BillingAddressRequest struct {
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	PostalCode string `json:"postal_code"`
+	Region     string `json:"region"`
+	Country    string `json:"country" binding:"required"`
+}
+
+type AddressResponse struct {
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	PostalCode string `json:"postal_code"`
+	Region     string `json:"region,omitempty"`
+	Country    string `json:"country"`
+}
+
+type BusinessProfileRequest struct {
+	CompanyName string `json:"company_name" binding:"required"`
+	VATID       string `json:"vat_id"`
+}
+
+type BusinessProfileResponse struct {
+	CompanyName string `json:"company_name"`
+	VATID       string `json:"vat_id,omitempty"`
+}
+
+type ChangeUserRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=customer support admin"`
 }
 
 func MapUserToResponse(user *models.User) UserResponse {
-	return UserResponse{
+	response := UserResponse{
 		ID:        user.ID.String(),
 		Email:     user.Email,
 		Name:      user.Name,
+		Role:      string(user.Role),
 		CreatedAt: user.CreatedAt,
 	}
+
+	if address := user.BillingAddress; address != nil {
+		response.BillingAddress = &AddressResponse{
+			Line1:      address.Line1,
+			Line2:      address.Line2,
+			City:       address.City,
+			PostalCode: address.PostalCode,
+			Region:     address.Region,
+			Country:    address.Country,
+		}
+	}
+
+	if profile := user.BusinessProfile; profile != nil {
+		response.BusinessProfile = &BusinessProfileResponse{
+			CompanyName: profile.CompanyName,
+			VATID:       profile.VATID,
+		}
+	}
+
+	return response
 }
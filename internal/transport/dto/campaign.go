@@ -0,0 +1,77 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/shopspring/decimal"
+)
+
+type CreateCampaignRequest struct {
+	Name          string          `json:"name" binding:"required"`
+	DiscountType  string          `json:"discount_type" binding:"required,oneof=fixed percentage"`
+	DiscountValue decimal.Decimal `json:"discount_value" binding:"required"`
+	Currency      string          `json:"currency,omitempty" binding:"omitempty,len=3"` // Required for fixed discounts
+	ProductID     *string         `json:"product_id,omitempty" binding:"omitempty,uuid"`
+	ExpiresAt     time.Time       `json:"expires_at" binding:"required"`
+	// DiscountDuration defaults to once; DiscountPeriods is required for repeating discounts
+	DiscountDuration string `json:"discount_duration" binding:"omitempty,oneof=once repeating forever"`
+	DiscountPeriods  int    `json:"discount_periods" binding:"min=0"`
+	// MaxRedemptionsPerCode defaults to 1, making single-use codes
+	MaxRedemptionsPerCode *int `json:"max_redemptions_per_code" binding:"omitempty,min=0"`
+}
+
+type GenerateCodesRequest struct {
+	Count    int    `json:"count" binding:"required,min=1"`
+	Prefix   string `json:"prefix"`
+	Alphabet string `json:"alphabet"`
+	Length   int    `json:"length"`
+}
+
+type CampaignResponse struct {
+	ID                    string          `json:"id"`
+	Name                  string          `json:"name"`
+	DiscountType          string          `json:"discount_type"`
+	DiscountValue         decimal.Decimal `json:"discount_value"`
+	Currency              string          `json:"currency,omitempty"`
+	ProductID             *string         `json:"product_id,omitempty"`
+	ExpiresAt             time.Time       `json:"expires_at"`
+	DiscountDuration      string          `json:"discount_duration"`
+	DiscountPeriods       int             `json:"discount_periods"`
+	MaxRedemptionsPerCode int             `json:"max_redemptions_per_code"`
+	VoucherCount          int             `json:"voucher_count"`
+	CreatedAt             time.Time       `json:"created_at"`
+	UpdatedAt             time.Time       `json:"updated_at"`
+}
+
+func MapCampaignToResponse(campaign *models.Campaign) CampaignResponse {
+	response := CampaignResponse{
+		ID:                    campaign.ID.String(),
+		Name:                  campaign.Name,
+		DiscountType:          string(campaign.DiscountType),
+		DiscountValue:         campaign.DiscountValue,
+		Currency:              campaign.Currency,
+		ExpiresAt:             campaign.ExpiresAt,
+		DiscountDuration:      string(campaign.DiscountDuration),
+		DiscountPeriods:       campaign.DiscountPeriods,
+		MaxRedemptionsPerCode: campaign.MaxRedemptionsPerCode,
+		VoucherCount:          campaign.VoucherCount,
+		CreatedAt:             campaign.CreatedAt,
+		UpdatedAt:             campaign.UpdatedAt,
+	}
+
+	if campaign.ProductID != nil {
+		productID := campaign.ProductID.String()
+		response.ProductID = &productID
+	}
+
+	return response
+}
+
+func MapCampaignsToResponse(campaigns []*models.Campaign) []CampaignResponse {
+	responses := make([]CampaignResponse, len(campaigns))
+	for i, campaign := range campaigns {
+		responses[i] = MapCampaignToResponse(campaign)
+	}
+	return responses
+}
@@ -0,0 +1,61 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/shopspring/decimal"
+)
+
+type GrantCreditRequest struct {
+	Amount   decimal.Decimal `json:"amount" binding:"required"`
+	Currency string          `json:"currency" binding:"required,len=3"`
+	Note     string          `json:"note" binding:"required,max=1000"`
+}
+
+type CreditEntryResponse struct {
+	ID           string          `json:"id"`
+	Type         string          `json:"type"`
+	Amount       decimal.Decimal `json:"amount"`
+	Currency     string          `json:"currency"`
+	Reason       string          `json:"reason"`
+	ReferenceID  *string         `json:"reference_id,omitempty"`
+	Note         string          `json:"note,omitempty"`
+	BalanceAfter decimal.Decimal `json:"balance_after"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+type CreditBalanceResponse struct {
+	UserID string `json:"user_id"`
+	// Balances maps each currency the user has had credit in to the balance in it
+	Balances map[string]decimal.Decimal `json:"balances"`
+	Entries  []CreditEntryResponse      `json:"entries"`
+}
+
+func MapCreditEntryToResponse(entry *models.CreditEntry) CreditEntryResponse {
+	response := CreditEntryResponse{
+		ID:           entry.ID.String(),
+		Type:         string(entry.Type),
+		Amount:       entry.Amount,
+		Currency:     entry.Currency,
+		Reason:       string(entry.Reason),
+		Note:         entry.Note,
+		BalanceAfter: entry.BalanceAfter,
+		CreatedAt:    entry.CreatedAt,
+	}
+
+	if entry.ReferenceID != nil {
+		referenceID := entry.ReferenceID.String()
+		response.ReferenceID = &referenceID
+	}
+
+	return response
+}
+
+func MapCreditEntriesToResponse(entries []*models.CreditEntry) []CreditEntryResponse {
+	responses := make([]CreditEntryResponse, len(entries))
+	for i, entry := range entries {
+		responses[i] = MapCreditEntryToResponse(entry)
+	}
+	return responses
+}
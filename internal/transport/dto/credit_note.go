@@ -0,0 +1,52 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/shopspring/decimal"
+)
+
+// RefundInvoiceRequest refunds all that is left of an invoice's payment when no amount is given
+type RefundInvoiceRequest struct {
+	Amount *decimal.Decimal `json:"amount"`
+	Note   string           `json:"note" binding:"max=1000"`
+}
+
+type CreditNoteResponse struct {
+	ID             string          `json:"id"`
+	Number         string          `json:"number"`
+	InvoiceID      string          `json:"invoice_id"`
+	SubscriptionID string          `json:"subscription_id"`
+	Reason         string          `json:"reason"`
+	Note           string          `json:"note,omitempty"`
+	Currency       string          `json:"currency"`
+	Subtotal       decimal.Decimal `json:"subtotal"`
+	TaxAmount      decimal.Decimal `json:"tax_amount"`
+	Total          decimal.Decimal `json:"total"`
+	IssuedAt       time.Time       `json:"issued_at"`
+}
+
+func MapCreditNoteToResponse(creditNote *models.CreditNote) CreditNoteResponse {
+	return CreditNoteResponse{
+		ID:             creditNote.ID.String(),
+		Number:         creditNote.Number,
+		InvoiceID:      creditNote.InvoiceID.String(),
+		SubscriptionID: creditNote.SubscriptionID.String(),
+		Reason:         string(creditNote.Reason),
+		Note:           creditNote.Note,
+		Currency:       creditNote.Currency,
+		Subtotal:       creditNote.Subtotal,
+		TaxAmount:      creditNote.TaxAmount,
+		Total:          creditNote.Total,
+		IssuedAt:       creditNote.IssuedAt,
+	}
+}
+
+func MapCreditNotesToResponse(creditNotes []*models.CreditNote) []CreditNoteResponse {
+	responses := make([]CreditNoteResponse, len(creditNotes))
+	for i, creditNote := range creditNotes {
+		responses[i] = MapCreditNoteToResponse(creditNote)
+	}
+	return responses
+}
@@ -0,0 +1,33 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/shopspring/decimal"
+)
+
+type ExchangeRateResponse struct {
+	Date     string `json:"date"`
+	Base     string `json:"base"`
+	Currency string `json:"currency"`
+	// Rate is the value of one unit of Base in Currency
+	Rate       decimal.Decimal `json:"rate"`
+	Source     string          `json:"source"`
+	ImportedAt time.Time       `json:"imported_at"`
+}
+
+func MapExchangeRatesToResponse(rates []*models.ExchangeRate) []ExchangeRateResponse {
+	responses := make([]ExchangeRateResponse, len(rates))
+	for i, rate := range rates {
+		responses[i] = ExchangeRateResponse{
+			Date:       rate.Date.Format(time.DateOnly),
+			Base:       rate.Base,
+			Currency:   rate.Currency,
+			Rate:       rate.Rate,
+			Source:     rate.Source,
+			ImportedAt: rate.ImportedAt,
+		}
+	}
+	return responses
+}
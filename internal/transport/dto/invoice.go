@@ -0,0 +1,84 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/shopspring/decimal"
+)
+
+type InvoiceLineResponse struct {
+	Type        string          `json:"type"`
+	Description string          `json:"description"`
+	Amount      decimal.Decimal `json:"amount"`
+}
+
+type InvoiceResponse struct {
+	ID             string                 `json:"id"`
+	Number         string                 `json:"number"`
+	SubscriptionID string                 `json:"subscription_id"`
+	Reason         string                 `json:"reason"`
+	Status         string                 `json:"status"`
+	PaymentStatus  string                 `json:"payment_status"`
+	PeriodStart    time.Time              `json:"period_start"`
+	PeriodEnd      time.Time              `json:"period_end"`
+	Currency       string                 `json:"currency"`
+	Lines          []InvoiceLineResponse  `json:"lines"`
+	Subtotal       decimal.Decimal        `json:"subtotal"`
+	TaxAmount      decimal.Decimal        `json:"tax_amount"`
+	TaxComponents  []TaxComponentResponse `json:"tax_components"`
+	Total          decimal.Decimal        `json:"total"`
+	CreditApplied  decimal.Decimal        `json:"credit_applied"`
+	AmountDue      decimal.Decimal        `json:"amount_due"`
+	IssuedAt       time.Time              `json:"issued_at"`
+	// ReverseCharge is set when the customer accounts for the VAT; Note then says so
+	ReverseCharge bool   `json:"reverse_charge"`
+	CustomerVATID string `json:"customer_vat_id,omitempty"`
+	Note          string `json:"note,omitempty"`
+}
+
+func MapInvoiceToResponse(invoice *models.Invoice) InvoiceResponse {
+	response := InvoiceResponse{
+		ID:             invoice.ID.String(),
+		Number:         invoice.Number,
+		SubscriptionID: invoice.SubscriptionID.String(),
+		Reason:         string(invoice.Reason),
+		Status:         string(invoice.Status),
+		PaymentStatus:  string(invoice.PaymentStatus),
+		PeriodStart:    invoice.PeriodStart,
+		PeriodEnd:      invoice.PeriodEnd,
+		Currency:       invoice.Currency,
+		Lines:          make([]InvoiceLineResponse, len(invoice.Lines)),
+		Subtotal:       invoice.Subtotal,
+		TaxAmount:      invoice.TaxAmount,
+		TaxComponents:  MapTaxComponentsToResponse(invoice.TaxComponents),
+		Total:          invoice.Total,
+		CreditApplied:  invoice.CreditApplied,
+		AmountDue:      invoice.AmountDue(),
+		IssuedAt:       invoice.IssuedAt,
+	}
+
+	if invoice.ReverseCharge {
+		response.ReverseCharge = true
+		response.CustomerVATID = invoice.CustomerVATID
+		response.Note = models.ReverseChargeNote
+	}
+
+	for i, line := range invoice.Lines {
+		response.Lines[i] = InvoiceLineResponse{
+			Type:        string(line.Type),
+			Description: line.Description,
+			Amount:      line.Amount,
+		}
+	}
+
+	return response
+}
+
+func MapInvoicesToResponse(invoices []*models.Invoice) []InvoiceResponse {
+	responses := make([]InvoiceResponse, len(invoices))
+	for i, invoice := range invoices {
+		responses[i] = MapInvoiceToResponse(invoice)
+	}
+	return responses
+}
@@ -0,0 +1,30 @@
+package dto
+
+import (
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type AccountBalanceResponse struct {
+	Account string          `json:"account"`
+	Debits  decimal.Decimal `json:"debits"`
+	Credits decimal.Decimal `json:"credits"`
+	// Balance is in the account's normal direction, e.g. debits less credits for cash
+	Balance decimal.Decimal `json:"balance"`
+}
+
+type CurrencyTrialBalanceResponse struct {
+	Currency string                   `json:"currency"`
+	Accounts []AccountBalanceResponse `json:"accounts"`
+	Debits   decimal.Decimal          `json:"debits"`
+	Credits  decimal.Decimal          `json:"credits"`
+	Balanced bool                     `json:"balanced"`
+}
+
+type TrialBalanceResponse struct {
+	AsOf       string                         `json:"as_of"`
+	Currencies []CurrencyTrialBalanceResponse `json:"currencies"`
+	// UnbalancedEntries are the journal entries whose debits do not equal their credits
+	UnbalancedEntries []uuid.UUID `json:"unbalanced_entries"`
+	Balanced          bool        `json:"balanced"`
+}
@@ -0,0 +1,25 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+)
+
+type SetPaymentMethodRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type PaymentMethodResponse struct {
+	Provider        string    `json:"provider"`
+	PaymentMethodID string    `json:"payment_method_id"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func MapPaymentAccountToResponse(account *models.PaymentAccount) PaymentMethodResponse {
+	return PaymentMethodResponse{
+		Provider:        account.Provider,
+		PaymentMethodID: account.PaymentMethodID,
+		UpdatedAt:       account.UpdatedAt,
+	}
+}
@@ -8,47 +8,101 @@ import (
 )
 
 type CreateProductRequest struct {
-	Name           string          `json:"name" binding:"required"`
-	Description    string          `json:"description"`
-	Price          decimal.Decimal `json:"price" binding:"required"`
-	DurationMonths int             `json:"duration_months" binding:"required,min=1"`
-	TaxRate        decimal.Decimal `json:"tax_rate" binding:"required"`
-	IsActive       bool            `json:"is_active"`
+	Name             string          `json:"name" binding:"required"`
+	Description      string          `json:"description"`
+	Price            decimal.Decimal `json:"price" binding:"required"`
+	DurationMonths   int             `json:"duration_months" binding:"required,min=1"`
+	TaxRate          decimal.Decimal `json:"tax_rate" binding:"required"`
+	IsActive         bool            `json:"is_active"`
+	MaxPauseDays     int             `json:"max_pause_days" binding:"min=0"`
+	RefundPolicy     string          `json:"refund_policy" binding:"omitempty,oneof=none prorated full_within_days"`
+	RefundWindowDays int             `json:"refund_window_days" binding:"min=0"`
+	TaxCategory      string          `json:"tax_category" binding:"omitempty,oneof=standard reduced exempt"`
+	TaxInclusive     bool            `json:"tax_inclusive"`
+	// Currency is the currency of Price; Prices are the price points in other currencies
+	Currency string              `json:"currency" binding:"omitempty,len=3"`
+	Prices   []ProductPriceEntry `json:"prices" binding:"dive"`
 }
 
 type UpdateProductRequest struct {
-	Name           string          `json:"name" binding:"required"`
-	Description    string          `json:"description"`
-	Price          decimal.Decimal `json:"price" binding:"required"`
-	DurationMonths int             `json:"duration_months" binding:"required,min=1"`
-	TaxRate        decimal.Decimal `json:"tax_rate" binding:"required"`
-	IsActive       bool            `json:"is_active"`
+	Name             string          `json:"name" binding:"required"`
+	Description      string          `json:"description"`
+	Price            decimal.Decimal `json:"price" binding:"required"`
+	DurationMonths   int             `json:"duration_months" binding:"required,min=1"`
+	TaxRate          decimal.Decimal `json:"tax_rate" binding:"required"`
+	IsActive         bool            `json:"is_active"`
+	MaxPauseDays     int             `json:"max_pause_days" binding:"min=0"`
+	RefundPolicy     string          `json:"refund_policy" binding:"omitempty,oneof=none prorated full_within_days"`
+	RefundWindowDays int             `json:"refund_window_days" binding:"min=0"`
+	TaxCategory      string          `json:"tax_category" binding:"omitempty,oneof=standard reduced exempt"`
+	TaxInclusive     bool            `json:"tax_inclusive"`
+	// Currency is the currency of Price; Prices are the price points in other currencies
+	Currency string              `json:"currency" binding:"omitempty,len=3"`
+	Prices   []ProductPriceEntry `json:"prices" binding:"dive"`
 }
 
 type ProductResponse struct {
-	ID             string          `json:"id"`
-	Name           string          `json:"name"`
-	Description    string          `json:"description"`
-	Price          decimal.Decimal `json:"price"`
-	DurationMonths int             `json:"duration_months"`
-	TaxRate        decimal.Decimal `json:"tax_rate"`
-	IsActive       bool            `json:"is_active"`
-	CreatedAt      time.Time       `json:"created_at"`
-	UpdatedAt      time.Time       `json:"updated_at"`
+	ID               string          `json:"id"`
+	Name             string          `json:"name"`
+	Description      string          `json:"description"`
+	Price            decimal.Decimal `json:"price"`
+	DurationMonths   int             `json:"duration_months"`
+	TaxRate          decimal.Decimal `json:"tax_rate"`
+	IsActive         bool            `json:"is_active"`
+	MaxPauseDays     int             `json:"max_pause_days"`
+	RefundPolicy     string          `json:"refund_policy"`
+	RefundWindowDays int             `json:"refund_window_days"`
+	TaxCategory      string          `json:"tax_category"`
+	TaxInclusive     bool            `json:"tax_inclusive"`
+	Currency         string          `json:"currency"`
+	// Prices are the price points in other currencies than Currency
+	Prices    []ProductPriceEntry `json:"prices"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+// ProductPriceEntry is a product's price in one currency
+type ProductPriceEntry struct {
+	Currency string          `json:"currency" binding:"required,len=3"`
+	Amount   decimal.Decimal `json:"amount" binding:"required"`
 }
 
 func MapProductToResponse(product *models.Product) ProductResponse {
 	return ProductResponse{
-		ID:             product.ID.String(),
-		Name:           product.Name,
-		Description:    product.Description,
-		Price:          product.Price,
-		DurationMonths: product.DurationMonths,
-		TaxRate:        product.TaxRate,
-		IsActive:       product.IsActive,
-		CreatedAt:      product.CreatedAt,
-		UpdatedAt:      product.UpdatedAt,
+		ID:               product.ID.String(),
+		Name:             product.Name,
+		Description:      product.Description,
+		Price:            product.Price,
+		DurationMonths:   product.DurationMonths,
+		TaxRate:          product.TaxRate,
+		IsActive:         product.IsActive,
+		MaxPauseDays:     product.MaxPauseDays,
+		RefundPolicy:     string(product.RefundPolicy),
+		RefundWindowDays: product.RefundWindowDays,
+		TaxCategory:      string(product.TaxCategory),
+		TaxInclusive:     product.TaxInclusive,
+		Currency:         product.Currency,
+		Prices:           MapProductPricesToResponse(product.Prices),
+		CreatedAt:        product.CreatedAt,
+		UpdatedAt:        product.UpdatedAt,
+	}
+}
+
+func MapProductPricesToResponse(prices []models.ProductPrice) []ProductPriceEntry {
+	entries := make([]ProductPriceEntry, len(prices))
+	for i, price := range prices {
+		entries[i] = ProductPriceEntry{Currency: price.Currency, Amount: price.Amount}
+	}
+	return entries
+}
+
+// MapProductPricesFromRequest converts the price points of a product request
+func MapProductPricesFromRequest(entries []ProductPriceEntry) []models.ProductPrice {
+	prices := make([]models.ProductPrice, len(entries))
+	for i, entry := range entries {
+		prices[i] = models.ProductPrice{Currency: entry.Currency, Amount: entry.Amount}
 	}
+	return prices
 }
 
 func MapProductsToResponse(products []*models.Product) []ProductResponse {
@@ -0,0 +1,34 @@
+package dto
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+type RevenueAmountsResponse struct {
+	Invoiced decimal.Decimal `json:"invoiced"`
+	Refunded decimal.Decimal `json:"refunded"`
+	Net      decimal.Decimal `json:"net"`
+}
+
+type CurrencyRevenueResponse struct {
+	Currency string                 `json:"currency"`
+	Amounts  RevenueAmountsResponse `json:"amounts"`
+	// Converted is the part of Amounts that could be converted, in the reporting currency
+	Converted RevenueAmountsResponse `json:"converted"`
+}
+
+type MissingRateResponse struct {
+	Currency string `json:"currency"`
+	Date     string `json:"date"`
+}
+
+type RevenueReportResponse struct {
+	From              string                    `json:"from"`
+	To                string                    `json:"to"`
+	ReportingCurrency string                    `json:"reporting_currency"`
+	Totals            RevenueAmountsResponse    `json:"totals"`
+	Currencies        []CurrencyRevenueResponse `json:"currencies"`
+	// MissingRates are the currencies and days no exchange rate is known for; their
+	// records are not in Totals
+	MissingRates []MissingRateResponse `json:"missing_rates"`
+}
@@ -11,34 +11,138 @@ type CreateSubscriptionRequest struct {
 	ProductID   string `json:"product_id" binding:"required,uuid"`
 	VoucherCode string `json:"voucher_code"`
 	WithTrial   bool   `json:"with_trial"`
+	AutoRenew   *bool  `json:"auto_renew"`
+	Currency    string `json:"currency" binding:"omitempty,len=3"`
+}
+
+type QuoteSubscriptionRequest struct {
+	ProductID   string `json:"product_id" binding:"required,uuid"`
+	VoucherCode string `json:"voucher_code"`
+	WithTrial   bool   `json:"with_trial"`
+	Currency    string `json:"currency" binding:"omitempty,len=3"`
+}
+
+type UpdateAutoRenewRequest struct {
+	AutoRenew *bool `json:"auto_renew" binding:"required"`
+}
+
+type PauseSubscriptionRequest struct {
+	ResumeAt *time.Time `json:"resume_at"`
+}
+
+type CancelSubscriptionRequest struct {
+	Mode     string `json:"mode" binding:"omitempty,oneof=immediately at_period_end"`
+	Reason   string `json:"reason"`
+	Feedback string `json:"feedback"`
+}
+
+type ChangePlanRequest struct {
+	ProductID string `json:"product_id" binding:"required,uuid"`
+	Mode      string `json:"mode" binding:"omitempty,oneof=immediately at_period_end"`
 }
 
 type SubscriptionResponse struct {
-	ID              string           `json:"id"`
-	UserID          string           `json:"user_id"`
-	ProductID       string           `json:"product_id"`
-	VoucherID       *string          `json:"voucher_id,omitempty"`
-	Status          string           `json:"status"`
-	StartDate       time.Time        `json:"start_date"`
-	EndDate         time.Time        `json:"end_date"`
-	TrialEndDate    *time.Time       `json:"trial_end_date,omitempty"`
-	OriginalPrice   decimal.Decimal  `json:"original_price"`
-	DiscountedPrice *decimal.Decimal `json:"discounted_price,omitempty"`
-	TaxAmount       decimal.Decimal  `json:"tax_amount"`
-	TotalAmount     decimal.Decimal  `json:"total_amount"`
-	CreatedAt       time.Time        `json:"created_at"`
-	UpdatedAt       time.Time        `json:"updated_at"`
-	Product         *ProductResponse `json:"product,omitempty"`
-	Voucher         *VoucherResponse `json:"voucher,omitempty"`
+	ID               string           `json:"id"`
+	UserID           string           `json:"user_id"`
+	ProductID        string           `json:"product_id"`
+	VoucherID        *string          `json:"voucher_id,omitempty"`
+	Status           string           `json:"status"`
+	StartDate        time.Time        `json:"start_date"`
+	EndDate          time.Time        `json:"end_date"`
+	TrialEndDate     *time.Time       `json:"trial_end_date,omitempty"`
+	Currency         string           `json:"currency"`
+	OriginalPrice    decimal.Decimal  `json:"original_price"`
+	DiscountedPrice  *decimal.Decimal `json:"discounted_price,omitempty"`
+	DiscountDuration string           `json:"discount_duration,omitempty"`
+	// DiscountPeriodsRemaining includes the current period; it is omitted for forever discounts
+	DiscountPeriodsRemaining *int                   `json:"discount_periods_remaining,omitempty"`
+	TaxAmount                decimal.Decimal        `json:"tax_amount"`
+	TaxComponents            []TaxComponentResponse `json:"tax_components"`
+	TotalAmount              decimal.Decimal        `json:"total_amount"`
+	AutoRenew                bool                   `json:"auto_renew"`
+	ScheduledProductID       *string                `json:"scheduled_product_id,omitempty"`
+	PausedAt                 *time.Time             `json:"paused_at,omitempty"`
+	ResumeAt                 *time.Time             `json:"resume_at,omitempty"`
+	CancelAtPeriodEnd        bool                   `json:"cancel_at_period_end"`
+	CancelledAt              *time.Time             `json:"cancelled_at,omitempty"`
+	// FailedPaymentAttempts and NextPaymentAttemptAt are set while a renewal payment is retried
+	FailedPaymentAttempts int              `json:"failed_payment_attempts,omitempty"`
+	NextPaymentAttemptAt  *time.Time       `json:"next_payment_attempt_at,omitempty"`
+	Version               int              `json:"version"`
+	CreatedAt             time.Time        `json:"created_at"`
+	UpdatedAt             time.Time        `json:"updated_at"`
+	Product               *ProductResponse `json:"product,omitempty"`
+	Voucher               *VoucherResponse `json:"voucher,omitempty"`
+	// ReverseCharge is set when the buyer accounts for the VAT on the current period
+	ReverseCharge bool   `json:"reverse_charge"`
+	CustomerVATID string `json:"customer_vat_id,omitempty"`
+}
+
+type PlanChangeResponse struct {
+	Subscription  SubscriptionResponse   `json:"subscription"`
+	Mode          string                 `json:"mode"`
+	EffectiveAt   time.Time              `json:"effective_at"`
+	Credit        decimal.Decimal        `json:"credit"`
+	Charge        decimal.Decimal        `json:"charge"`
+	AmountDue     decimal.Decimal        `json:"amount_due"`
+	TaxAmount     decimal.Decimal        `json:"tax_amount"`
+	TaxComponents []TaxComponentResponse `json:"tax_components"`
+	TotalDue      decimal.Decimal        `json:"total_due"`
+	// CreditToBalance is added to the user's credit balance
+	CreditToBalance decimal.Decimal `json:"credit_to_balance"`
+}
+
+// QuoteResponse is the order summary of a subscription that has not been created
+type QuoteResponse struct {
+	Product          ProductResponse  `json:"product"`
+	VoucherCode      *string          `json:"voucher_code,omitempty"`
+	StartDate        time.Time        `json:"start_date"`
+	EndDate          time.Time        `json:"end_date"`
+	TrialEndDate     *time.Time       `json:"trial_end_date,omitempty"`
+	Currency         string           `json:"currency"`
+	OriginalPrice    decimal.Decimal  `json:"original_price"`
+	Discount         decimal.Decimal  `json:"discount"`
+	DiscountedPrice  *decimal.Decimal `json:"discounted_price,omitempty"`
+	DiscountDuration string           `json:"discount_duration,omitempty"`
+	// DiscountPeriods is only set for repeating discounts
+	DiscountPeriods *int                   `json:"discount_periods,omitempty"`
+	TaxAmount       decimal.Decimal        `json:"tax_amount"`
+	TaxComponents   []TaxComponentResponse `json:"tax_components"`
+	TotalAmount     decimal.Decimal        `json:"total_amount"`
+	// ReverseCharge is set when the buyer will account for the VAT themselves
+	ReverseCharge bool `json:"reverse_charge"`
+}
+
+type AllowedActionsResponse struct {
+	SubscriptionID string   `json:"subscription_id"`
+	Status         string   `json:"status"`
+	Actions        []string `json:"actions"`
+}
+
+type SubscriptionPauseResponse struct {
+	ID                string          `json:"id"`
+	PausedAt          time.Time       `json:"paused_at"`
+	ScheduledResumeAt *time.Time      `json:"scheduled_resume_at,omitempty"`
+	ResumedAt         *time.Time      `json:"resumed_at,omitempty"`
+	DaysPaused        decimal.Decimal `json:"days_paused"`
+}
+
+type PauseHistoryResponse struct {
+	SubscriptionID  string                      `json:"subscription_id"`
+	TotalDaysPaused decimal.Decimal             `json:"total_days_paused"`
+	Pauses          []SubscriptionPauseResponse `json:"pauses"`
 }
 
 type SubscriptionStateChangeResponse struct {
-	ID             string    `json:"id"`
-	SubscriptionID string    `json:"subscription_id"`
-	PreviousState  string    `json:"previous_state"`
-	NewState       string    `json:"new_state"`
-	ChangedAt      time.Time `json:"changed_at"`
-	Reason         string    `json:"reason"`
+	ID                 string    `json:"id"`
+	SubscriptionID     string    `json:"subscription_id"`
+	PreviousState      string    `json:"previous_state"`
+	NewState           string    `json:"new_state"`
+	ChangedAt          time.Time `json:"changed_at"`
+	Reason             string    `json:"reason"`
+	ReasonCode         string    `json:"reason_code,omitempty"`
+	CancellationReason string    `json:"cancellation_reason,omitempty"`
+	FeedbackCategory   string    `json:"feedback_category,omitempty"`
 }
 
 func MapSubscriptionToResponse(subscription *models.Subscription) SubscriptionResponse {
@@ -49,11 +153,17 @@ func MapSubscriptionToResponse(subscription *models.Subscription) SubscriptionRe
 		Status:        string(subscription.Status),
 		StartDate:     subscription.StartDate,
 		EndDate:       subscription.EndDate,
+		Currency:      subscription.Currency,
 		OriginalPrice: subscription.OriginalPrice,
 		TaxAmount:     subscription.TaxAmount,
+		TaxComponents: MapTaxComponentsToResponse(subscription.TaxComponents),
 		TotalAmount:   subscription.TotalAmount,
+		AutoRenew:     subscription.AutoRenew,
+		Version:       subscription.Version,
 		CreatedAt:     subscription.CreatedAt,
 		UpdatedAt:     subscription.UpdatedAt,
+		ReverseCharge: subscription.ReverseCharge,
+		CustomerVATID: subscription.CustomerVATID,
 	}
 
 	if subscription.VoucherID != nil {
@@ -61,14 +171,34 @@ func MapSubscriptionToResponse(subscription *models.Subscription) SubscriptionRe
 		response.VoucherID = &voucherID
 	}
 
+	if subscription.ScheduledProductID != nil {
+		scheduledProductID := subscription.ScheduledProductID.String()
+		response.ScheduledProductID = &scheduledProductID
+	}
+
 	if subscription.TrialEndDate != nil {
 		response.TrialEndDate = subscription.TrialEndDate
 	}
 
+	response.PausedAt = subscription.PausedAt
+	response.ResumeAt = subscription.ResumeAt
+	response.CancelAtPeriodEnd = subscription.CancelAtPeriodEnd
+	response.CancelledAt = subscription.CancelledAt
+	response.FailedPaymentAttempts = subscription.FailedPaymentAttempts
+	response.NextPaymentAttemptAt = subscription.NextPaymentAttemptAt
+
 	if subscription.DiscountedPrice != nil {
 		response.DiscountedPrice = subscription.DiscountedPrice
 	}
 
+	if subscription.VoucherID != nil && subscription.DiscountDuration != "" {
+		response.DiscountDuration = string(subscription.DiscountDuration)
+		if subscription.DiscountDuration != models.DiscountDurationForever {
+			remaining := subscription.DiscountPeriodsRemaining
+			response.DiscountPeriodsRemaining = &remaining
+		}
+	}
+
 	if subscription.Product != nil {
 		product := MapProductToResponse(subscription.Product)
 		response.Product = &product
@@ -92,12 +222,15 @@ func MapSubscriptionsToResponse(subscriptions []*models.Subscription) []Subscrip
 
 func MapStateChangeToResponse(stateChange *models.SubscriptionStateChange) SubscriptionStateChangeResponse {
 	return SubscriptionStateChangeResponse{
-		ID:             stateChange.ID.String(),
-		SubscriptionID: stateChange.SubscriptionID.String(),
-		PreviousState:  string(stateChange.PreviousState),
-		NewState:       string(stateChange.NewState),
-		ChangedAt:      stateChange.ChangedAt,
-		Reason:         stateChange.Reason,
+		ID:                 stateChange.ID.String(),
+		SubscriptionID:     stateChange.SubscriptionID.String(),
+		PreviousState:      string(stateChange.PreviousState),
+		NewState:           string(stateChange.NewState),
+		ChangedAt:          stateChange.ChangedAt,
+		Reason:             stateChange.Reason,
+		ReasonCode:         string(stateChange.ReasonCode),
+		CancellationReason: stateChange.CancellationReason,
+		FeedbackCategory:   string(stateChange.FeedbackCategory),
 	}
 }
 
@@ -108,3 +241,18 @@ func MapStateChangesToResponse(stateChanges []*models.SubscriptionStateChange) [
 	}
 	return responses
 }
+
+func MapPauseToResponse(pause *models.SubscriptionPause, now time.Time) SubscriptionPauseResponse {
+	return SubscriptionPauseResponse{
+		ID:                pause.ID.String(),
+		PausedAt:          pause.PausedAt,
+		ScheduledResumeAt: pause.ScheduledResumeAt,
+		ResumedAt:         pause.ResumedAt,
+		DaysPaused:        DurationInDays(pause.Duration(now)),
+	}
+}
+
+// DurationInDays converts a duration to days, rounded to two decimals
+func DurationInDays(d time.Duration) decimal.Decimal {
+	return decimal.NewFromFloat(d.Hours() / 24).Round(2)
+}
@@ -0,0 +1,52 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+	"github.com/shopspring/decimal"
+)
+
+type TaxComponentResponse struct {
+	Name         string          `json:"name"`
+	Jurisdiction string          `json:"jurisdiction,omitempty"`
+	Rate         decimal.Decimal `json:"rate"`
+	Amount       decimal.Decimal `json:"amount"`
+}
+
+func MapTaxComponentsToResponse(components []models.TaxComponent) []TaxComponentResponse {
+	responses := make([]TaxComponentResponse, len(components))
+	for i, component := range components {
+		responses[i] = TaxComponentResponse{
+			Name:         component.Name,
+			Jurisdiction: component.Jurisdiction,
+			Rate:         component.Rate,
+			Amount:       component.Amount,
+		}
+	}
+	return responses
+}
+
+type VATValidationResponse struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	VATID     string    `json:"vat_id"`
+	Status    string    `json:"status"`
+	Source    string    `json:"source"`
+	Message   string    `json:"message,omitempty"`
+	Reference string    `json:"reference,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+func MapVATValidationToResponse(validation *models.VATValidation) VATValidationResponse {
+	return VATValidationResponse{
+		ID:        validation.ID.String(),
+		UserID:    validation.UserID.String(),
+		VATID:     validation.VATID,
+		Status:    string(validation.Status),
+		Source:    validation.Source,
+		Message:   validation.Message,
+		Reference: validation.Reference,
+		CheckedAt: validation.CheckedAt,
+	}
+}
@@ -11,23 +11,40 @@ type CreateVoucherRequest struct {
 	Code          string          `json:"code" binding:"required"`
 	DiscountType  string          `json:"discount_type" binding:"required,oneof=fixed percentage"`
 	DiscountValue decimal.Decimal `json:"discount_value" binding:"required"`
+	Currency      string          `json:"currency,omitempty" binding:"omitempty,len=3"` // Required for fixed discounts
 	ProductID     *string         `json:"product_id,omitempty" binding:"omitempty,uuid"`
 	ExpiresAt     time.Time       `json:"expires_at" binding:"required"`
 	IsActive      bool            `json:"is_active"`
+
+	// DiscountDuration defaults to once; DiscountPeriods is required for repeating discounts
+	DiscountDuration string `json:"discount_duration" binding:"omitempty,oneof=once repeating forever"`
+	DiscountPeriods  int    `json:"discount_periods" binding:"min=0"`
+
+	MaxRedemptions        int `json:"max_redemptions" binding:"min=0"`
+	MaxRedemptionsPerUser int `json:"max_redemptions_per_user" binding:"min=0"`
 }
 
 type UpdateVoucherRequest struct {
 	Code          string          `json:"code" binding:"required"`
 	DiscountType  string          `json:"discount_type" binding:"required,oneof=fixed percentage"`
 	DiscountValue decimal.Decimal `json:"discount_value" binding:"required"`
+	Currency      string          `json:"currency,omitempty" binding:"omitempty,len=3"` // Required for fixed discounts
 	ProductID     *string         `json:"product_id,omitempty" binding:"omitempty,uuid"`
 	ExpiresAt     time.Time       `json:"expires_at" binding:"required"`
 	IsActive      bool            `json:"is_active"`
+
+	// DiscountDuration defaults to once; DiscountPeriods is required for repeating discounts
+	DiscountDuration string `json:"discount_duration" binding:"omitempty,oneof=once repeating forever"`
+	DiscountPeriods  int    `json:"discount_periods" binding:"min=0"`
+
+	MaxRedemptions        int `json:"max_redemptions" binding:"min=0"`
+	MaxRedemptionsPerUser int `json:"max_redemptions_per_user" binding:"min=0"`
 }
 
 type ValidateVoucherRequest struct {
 	Code      string `json:"code" binding:"required"`
 	ProductID string `json:"product_id" binding:"required,uuid"`
+	Currency  string `json:"currency" binding:"omitempty,len=3"`
 }
 
 type VoucherResponse struct {
@@ -35,11 +52,35 @@ type VoucherResponse struct {
 	Code          string          `json:"code"`
 	DiscountType  string          `json:"discount_type"`
 	DiscountValue decimal.Decimal `json:"discount_value"`
+	Currency      string          `json:"currency,omitempty"`
 	ProductID     *string         `json:"product_id,omitempty"`
 	IsActive      bool            `json:"is_active"`
 	ExpiresAt     time.Time       `json:"expires_at"`
-	CreatedAt     time.Time       `json:"created_at"`
-	UpdatedAt     time.Time       `json:"updated_at"`
+
+	DiscountDuration string `json:"discount_duration"`
+	DiscountPeriods  int    `json:"discount_periods"`
+
+	MaxRedemptions        int `json:"max_redemptions"`
+	MaxRedemptionsPerUser int `json:"max_redemptions_per_user"`
+	RedemptionCount       int `json:"redemption_count"`
+	// RemainingRedemptions is null when the voucher has no global limit
+	RemainingRedemptions *int `json:"remaining_redemptions"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type VoucherRedemptionResponse struct {
+	ID             string          `json:"id"`
+	UserID         string          `json:"user_id"`
+	SubscriptionID string          `json:"subscription_id"`
+	DiscountAmount decimal.Decimal `json:"discount_amount"`
+	RedeemedAt     time.Time       `json:"redeemed_at"`
+}
+
+type VoucherRedemptionsResponse struct {
+	Voucher     VoucherResponse             `json:"voucher"`
+	Redemptions []VoucherRedemptionResponse `json:"redemptions"`
 }
 
 type ValidateVoucherResponse struct {
@@ -54,10 +95,22 @@ func MapVoucherToResponse(voucher *models.Voucher) VoucherResponse {
 		Code:          voucher.Code,
 		DiscountType:  string(voucher.DiscountType),
 		DiscountValue: voucher.DiscountValue,
+		Currency:      voucher.Currency,
 		IsActive:      voucher.IsActive,
 		ExpiresAt:     voucher.ExpiresAt,
 		CreatedAt:     voucher.CreatedAt,
 		UpdatedAt:     voucher.UpdatedAt,
+
+		DiscountDuration: string(voucher.DiscountDuration),
+		DiscountPeriods:  voucher.DiscountPeriods,
+
+		MaxRedemptions:        voucher.MaxRedemptions,
+		MaxRedemptionsPerUser: voucher.MaxRedemptionsPerUser,
+		RedemptionCount:       voucher.RedemptionCount,
+	}
+
+	if remaining := voucher.RemainingRedemptions(); remaining >= 0 {
+		response.RemainingRedemptions = &remaining
 	}
 
 	if voucher.ProductID != nil {
@@ -75,3 +128,22 @@ func MapVouchersToResponse(vouchers []*models.Voucher) []VoucherResponse {
 	}
 	return responses
 }
+
+func MapVoucherRedemptionsToResponse(voucher *models.Voucher, redemptions []*models.VoucherRedemption) VoucherRedemptionsResponse {
+	response := VoucherRedemptionsResponse{
+		Voucher:     MapVoucherToResponse(voucher),
+		Redemptions: make([]VoucherRedemptionResponse, len(redemptions)),
+	}
+
+	for i, redemption := range redemptions {
+		response.Redemptions[i] = VoucherRedemptionResponse{
+			ID:             redemption.ID.String(),
+			UserID:         redemption.UserID.String(),
+			SubscriptionID: redemption.SubscriptionID.String(),
+			DiscountAmount: redemption.DiscountAmount,
+			RedeemedAt:     redemption.RedeemedAt,
+		}
+	}
+
+	return response
+}
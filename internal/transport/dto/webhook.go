@@ -0,0 +1,50 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/internal/domain/models"
+)
+
+type WebhookEventResponse struct {
+	ID          string     `json:"id"`
+	Provider    string     `json:"provider"`
+	EventID     string     `json:"event_id"`
+	Type        string     `json:"type"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	ReceivedAt  time.Time  `json:"received_at"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty"`
+	// Payload is the event as the provider sent it, if it is JSON
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func MapWebhookEventToResponse(event *models.WebhookEvent) WebhookEventResponse {
+	response := WebhookEventResponse{
+		ID:          event.ID.String(),
+		Provider:    event.Provider,
+		EventID:     event.EventID,
+		Type:        event.Type,
+		Status:      string(event.Status),
+		Attempts:    event.Attempts,
+		LastError:   event.LastError,
+		ReceivedAt:  event.ReceivedAt,
+		ProcessedAt: event.ProcessedAt,
+	}
+
+	if json.Valid(event.Payload) {
+		response.Payload = event.Payload
+	}
+
+	return response
+}
+
+func MapWebhookEventsToResponse(events []*models.WebhookEvent) []WebhookEventResponse {
+	responses := make([]WebhookEventResponse, len(events))
+	for i, event := range events {
+		responses[i] = MapWebhookEventToResponse(event)
+	}
+	return responses
+}
@@ -2,10 +2,19 @@ package http
 
 import (
 	"github.com/assylzhan-a/subscription-service/internal/app/auth"
+	"github.com/assylzhan-a/subscription-service/internal/app/credit"
+	"github.com/assylzhan-a/subscription-service/internal/app/exchange"
+	"github.com/assylzhan-a/subscription-service/internal/app/invoice"
+	"github.com/assylzhan-a/subscription-service/internal/app/ledger"
+	"github.com/assylzhan-a/subscription-service/internal/app/payment"
 	"github.com/assylzhan-a/subscription-service/internal/app/product"
+	"github.com/assylzhan-a/subscription-service/internal/app/report"
 	"github.com/assylzhan-a/subscription-service/internal/app/subscription"
+	"github.com/assylzhan-a/subscription-service/internal/app/tax"
 	"github.com/assylzhan-a/subscription-service/internal/app/voucher"
+	"github.com/assylzhan-a/subscription-service/internal/app/webhook"
 	"github.com/assylzhan-a/subscription-service/internal/handlers"
+	"github.com/assylzhan-a/subscription-service/pkg/jwt"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -16,6 +25,15 @@ type Router struct {
 	productService      *product.Service
 	subscriptionService *subscription.Service
 	voucherService      *voucher.Service
+	invoiceService      *invoice.Service
+	paymentService      *payment.Service
+	webhookService      *webhook.Service
+	creditService       *credit.Service
+	taxService          *tax.Service
+	exchangeService     *exchange.Service
+	reportService       *report.Service
+	ledgerService       *ledger.Service
+	jwtManager          *jwt.Manager
 }
 
 func NewRouter(
@@ -23,6 +41,15 @@ func NewRouter(
 	productService *product.Service,
 	subscriptionService *subscription.Service,
 	voucherService *voucher.Service,
+	invoiceService *invoice.Service,
+	paymentService *payment.Service,
+	webhookService *webhook.Service,
+	creditService *credit.Service,
+	taxService *tax.Service,
+	exchangeService *exchange.Service,
+	reportService *report.Service,
+	ledgerService *ledger.Service,
+	jwtManager *jwt.Manager,
 ) *Router {
 	return &Router{
 		engine:              gin.Default(),
@@ -30,6 +57,15 @@ func NewRouter(
 		productService:      productService,
 		subscriptionService: subscriptionService,
 		voucherService:      voucherService,
+		invoiceService:      invoiceService,
+		paymentService:      paymentService,
+		webhookService:      webhookService,
+		creditService:       creditService,
+		taxService:          taxService,
+		exchangeService:     exchangeService,
+		reportService:       reportService,
+		ledgerService:       ledgerService,
+		jwtManager:          jwtManager,
 	}
 }
 
@@ -48,11 +84,39 @@ func (r *Router) Setup() {
 	productHandler := handlers.NewProductHandler(r.productService)
 	subscriptionHandler := handlers.NewSubscriptionHandler(r.subscriptionService)
 	voucherHandler := handlers.NewVoucherHandler(r.voucherService)
+	campaignHandler := handlers.NewCampaignHandler(r.voucherService)
+	invoiceHandler := handlers.NewInvoiceHandler(r.invoiceService)
+	creditNoteHandler := handlers.NewCreditNoteHandler(r.subscriptionService)
+	paymentHandler := handlers.NewPaymentHandler(r.paymentService)
+	webhookHandler := handlers.NewWebhookHandler(r.webhookService)
+	userHandler := handlers.NewUserHandler(r.authService)
+	creditHandler := handlers.NewCreditHandler(r.creditService)
+	taxHandler := handlers.NewTaxHandler(r.taxService)
+	reportHandler := handlers.NewReportHandler(r.reportService, r.exchangeService)
+	ledgerHandler := handlers.NewLedgerHandler(r.ledgerService)
 
 	authHandler.RegisterRoutes(v1.Group("/auth"))
 	productHandler.RegisterRoutes(v1)
 	subscriptionHandler.RegisterRoutes(v1.Group("/subscriptions"))
+	subscriptionHandler.RegisterAdminRoutes(v1.Group("/admin/subscriptions"))
 	voucherHandler.RegisterRoutes(v1)
+	campaignHandler.RegisterRoutes(v1)
+	invoiceHandler.RegisterRoutes(v1.Group("/invoices"))
+	creditNoteHandler.RegisterRoutes(v1.Group("/credit-notes"))
+	creditNoteHandler.RegisterAdminRoutes(v1.Group("/admin/invoices"))
+	paymentHandler.RegisterRoutes(v1.Group("/payment-method"))
+	webhookHandler.RegisterAdminRoutes(v1.Group("/admin/webhook-events"))
+	userHandler.RegisterRoutes(v1)
+	creditHandler.RegisterRoutes(v1)
+	taxHandler.RegisterRoutes(v1)
+	reportHandler.RegisterRoutes(v1)
+	ledgerHandler.RegisterRoutes(v1)
+
+	// Payment provider webhooks, outside the versioned API because providers are configured with the URL
+	webhookHandler.RegisterRoutes(r.engine.Group("/webhooks"))
+
+	// Public keys for verifying tokens issued by this service
+	handlers.NewJWKSHandler(r.jwtManager).RegisterRoutes(r.engine)
 
 	// Health check
 	r.engine.GET("/health", func(c *gin.Context) {
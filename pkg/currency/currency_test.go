@@ -0,0 +1,71 @@
+package currency_test
+
+import (
+	"testing"
+
+	"github.com/assylzhan-a/subscription-service/pkg/currency"
+	"github.com/shopspring/decimal"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected bool
+	}{
+		{"EUR", true},
+		{"JPY", true},
+		{"eur", false},
+		{"XXX", false},
+		// Three minor units do not fit the stored amounts
+		{"KWD", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if valid := currency.Valid(tt.code); valid != tt.expected {
+			t.Errorf("Expected Valid(%q) to be %v, got %v", tt.code, tt.expected, valid)
+		}
+	}
+
+	if code := currency.Normalize(" usd "); code != "USD" {
+		t.Errorf("Expected USD, got %q", code)
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   string
+		code     string
+		expected string
+		format   string
+	}{
+		// Test case 1: Amounts are rounded to cents in most currencies
+		{"euro", "19.995", "EUR", "20", "20.00"},
+		{"dollar", "10.004", "USD", "10", "10.00"},
+		// Test case 2: Currencies without minor units are rounded to whole amounts
+		{"yen", "1499.5", "JPY", "1500", "1500"},
+		{"won", "1200.4", "KRW", "1200", "1200"},
+		// Test case 3: Unknown currencies are rounded to cents
+		{"unknown", "1.235", "XXX", "1.24", "1.24"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount := decimal.RequireFromString(tt.amount)
+
+			rounded := currency.Round(amount, tt.code)
+			if !rounded.Equal(decimal.RequireFromString(tt.expected)) {
+				t.Errorf("Expected %s, got %s", tt.expected, rounded)
+			}
+
+			if formatted := currency.Format(amount, tt.code); formatted != tt.format {
+				t.Errorf("Expected %q, got %q", tt.format, formatted)
+			}
+
+			if !currency.IsRounded(rounded, tt.code) || currency.IsRounded(amount, tt.code) {
+				t.Errorf("Expected only %s to be rounded to %s", rounded, tt.code)
+			}
+		})
+	}
+}
@@ -1,31 +1,87 @@
 package jwt
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+// Manager issues and validates tokens. Without signing keys it signs with the
+// HMAC secret (HS256). Once asymmetric keys are added it signs with the newest
+// active key and identifies it with the kid header; HMAC tokens are then only
+// accepted until the configured migration deadline.
 type Manager struct {
 	secretKey []byte
 	issuer    string
+
+	mu              sync.RWMutex
+	keys            []*SigningKey // sorted by ActivatesAt
+	store           KeyStore
+	gracePeriod     time.Duration
+	hmacAcceptUntil time.Time
 }
 
 type CustomClaims struct {
 	jwt.RegisteredClaims
 	UserID uuid.UUID `json:"user_id"`
+	Role   string    `json:"role,omitempty"`
+}
+
+// Option configures a Manager
+type Option func(*Manager)
+
+// WithSigningKeys adds asymmetric signing keys to the manager
+func WithSigningKeys(keys ...*SigningKey) Option {
+	return func(m *Manager) {
+		m.keys = append(m.keys, keys...)
+	}
 }
 
-func NewManager(secretKey, issuer string) *Manager {
-	return &Manager{
+// WithKeyStore sets where keys are loaded from and rotated keys are saved to
+func WithKeyStore(store KeyStore) Option {
+	return func(m *Manager) {
+		m.store = store
+	}
+}
+
+// WithGracePeriod sets how long a key keeps verifying tokens after its successor
+// became active. It should be at least the access token lifetime.
+func WithGracePeriod(gracePeriod time.Duration) Option {
+	return func(m *Manager) {
+		m.gracePeriod = gracePeriod
+	}
+}
+
+// WithHMACAcceptedUntil keeps accepting HMAC signed tokens until the given time
+// even when asymmetric keys are in use
+func WithHMACAcceptedUntil(until time.Time) Option {
+	return func(m *Manager) {
+		m.hmacAcceptUntil = until
+	}
+}
+
+func NewManager(secretKey, issuer string, opts ...Option) *Manager {
+	m := &Manager{
 		secretKey: []byte(secretKey),
 		issuer:    issuer,
 	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	m.sortKeys()
+
+	return m
 }
 
-func (m *Manager) GenerateToken(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+func (m *Manager) GenerateToken(userID uuid.UUID, role string, expiresIn time.Duration) (string, error) {
 	claims := CustomClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
@@ -36,10 +92,26 @@ func (m *Manager) GenerateToken(userID uuid.UUID, expiresIn time.Duration) (stri
 			ID:        uuid.New().String(),
 		},
 		UserID: userID,
+		Role:   role,
+	}
+
+	m.mu.RLock()
+	key := m.activeKey(time.Now())
+	m.mu.RUnlock()
+
+	if key == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		signedToken, err := token.SignedString(m.secretKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign token: %w", err)
+		}
+		return signedToken, nil
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString(m.secretKey)
+	token := jwt.NewWithClaims(key.signingMethod(), claims)
+	token.Header["kid"] = key.ID
+
+	signedToken, err := token.SignedString(key.PrivateKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -48,12 +120,7 @@ func (m *Manager) GenerateToken(userID uuid.UUID, expiresIn time.Duration) (stri
 }
 
 func (m *Manager) ValidateToken(tokenString string) (*CustomClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return m.secretKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, m.verificationKey)
 
 	if err != nil {
 		return nil, fmt.Errorf("invalid token: %w", err)
@@ -66,3 +133,285 @@ func (m *Manager) ValidateToken(tokenString string) (*CustomClaims, error) {
 
 	return claims, nil
 }
+
+// JWKS returns the public keys that tokens may currently be verified with,
+// including keys that are published but not yet used for signing
+func (m *Manager) JWKS() JWKS {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	jwks := JWKS{Keys: []JWK{}}
+	for i, key := range m.keys {
+		if m.isRetired(i, now) {
+			continue
+		}
+		if jwk, ok := publicJWK(key); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+
+	return jwks
+}
+
+// AddSigningKey adds a key to the manager and persists it when a key store is configured
+func (m *Manager) AddSigningKey(key *SigningKey) error {
+	if m.store != nil {
+		if err := m.store.Save(key); err != nil {
+			return fmt.Errorf("failed to save signing key: %w", err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys = append(m.keys, key)
+	m.sortKeys()
+
+	return nil
+}
+
+// LoadKeys reloads keys from the key store, picking up keys rotated by other replicas
+func (m *Manager) LoadKeys() error {
+	if m.store == nil {
+		return nil
+	}
+
+	keys, err := m.store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys = keys
+	m.sortKeys()
+
+	return nil
+}
+
+// RotateKey generates a new key that takes over signing after activationDelay.
+// The delay gives other replicas and JWKS consumers time to learn the new key.
+func (m *Manager) RotateKey(alg Algorithm, activationDelay time.Duration) (*SigningKey, error) {
+	key, err := GenerateSigningKey(alg, time.Now().Add(activationDelay))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.AddSigningKey(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// lockRetryInterval is how long EnsureKey waits before it tries the key store's lock again
+const lockRetryInterval = time.Second
+
+// EnsureKey generates a key that signs right away if there is none yet. Replicas
+// sharing a key store take the store's lock and look for keys again under it, so
+// replicas that start together use the key the first of them generates. It returns
+// nil if a key already existed.
+func (m *Manager) EnsureKey(alg Algorithm) (*SigningKey, error) {
+	if m.store != nil {
+		for {
+			unlock, err := m.store.Lock()
+			if err == nil {
+				defer unlock()
+				break
+			}
+			if err != ErrKeyStoreLocked {
+				return nil, err
+			}
+
+			// Another replica may be generating the first key
+			time.Sleep(lockRetryInterval)
+			if err := m.LoadKeys(); err != nil {
+				return nil, err
+			}
+			if m.hasKeys() {
+				return nil, nil
+			}
+		}
+
+		if err := m.LoadKeys(); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.hasKeys() {
+		return nil, nil
+	}
+
+	return m.RotateKey(alg, 0)
+}
+
+func (m *Manager) hasKeys() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.keys) > 0
+}
+
+// PruneKeys removes keys whose grace period has ended
+func (m *Manager) PruneKeys() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	kept := make([]*SigningKey, 0, len(m.keys))
+	for i, key := range m.keys {
+		if !m.isRetired(i, now) {
+			kept = append(kept, key)
+			continue
+		}
+		if m.store != nil {
+			if err := m.store.Delete(key.ID); err != nil {
+				return fmt.Errorf("failed to delete signing key %s: %w", key.ID, err)
+			}
+		}
+	}
+	m.keys = kept
+
+	return nil
+}
+
+// RotationConfig controls scheduled key rotation
+type RotationConfig struct {
+	Algorithm       Algorithm
+	Interval        time.Duration // how long a key is used for signing
+	ActivationDelay time.Duration // how long a new key is published before it signs
+	CheckInterval   time.Duration // how often keys are reloaded and checked
+}
+
+// RunKeyRotation reloads keys from the store, rotates when the newest key is older
+// than the rotation interval and prunes retired keys. Replicas sharing a store take
+// turns, so one key is created per interval. It blocks until ctx is done.
+func (m *Manager) RunKeyRotation(ctx context.Context, cfg RotationConfig) {
+	ticker := time.NewTicker(cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.rotateIfDue(cfg); err != nil {
+			log.Printf("JWT key rotation failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Manager) rotateIfDue(cfg RotationConfig) error {
+	// The keys are reloaded under the lock, so a key saved by the replica that held it
+	// last counts as the newest
+	if m.store != nil {
+		unlock, err := m.store.Lock()
+		if err == ErrKeyStoreLocked {
+			// Another replica is rotating; its keys are picked up on the next check
+			return m.LoadKeys()
+		}
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	if err := m.LoadKeys(); err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	var newest *SigningKey
+	if len(m.keys) > 0 {
+		newest = m.keys[len(m.keys)-1]
+	}
+	m.mu.RUnlock()
+
+	if newest == nil || time.Since(newest.ActivatesAt) >= cfg.Interval {
+		key, err := m.RotateKey(cfg.Algorithm, cfg.ActivationDelay)
+		if err != nil {
+			return err
+		}
+		log.Printf("Rotated JWT signing key, new key %s activates at %s", key.ID, key.ActivatesAt.Format(time.RFC3339))
+	}
+
+	return m.PruneKeys()
+}
+
+func (m *Manager) verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if !m.acceptsHMAC(time.Now()) {
+			return nil, fmt.Errorf("HMAC signed tokens are no longer accepted")
+		}
+		return m.secretKey, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no key ID")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	for i, key := range m.keys {
+		if key.ID != kid {
+			continue
+		}
+		if m.isRetired(i, now) {
+			return nil, fmt.Errorf("signing key %s is retired", kid)
+		}
+		if token.Method.Alg() != key.signingMethod().Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.PublicKey(), nil
+	}
+
+	return nil, fmt.Errorf("unknown signing key: %s", kid)
+}
+
+func (m *Manager) acceptsHMAC(now time.Time) bool {
+	if len(m.secretKey) == 0 {
+		return false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.activeKey(now) == nil {
+		return true
+	}
+
+	return now.Before(m.hmacAcceptUntil)
+}
+
+// activeKey returns the newest key that is already active. Callers must hold mu.
+func (m *Manager) activeKey(now time.Time) *SigningKey {
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		if !m.keys[i].ActivatesAt.After(now) {
+			return m.keys[i]
+		}
+	}
+	return nil
+}
+
+// isRetired reports whether the key at index i was superseded by a newer key
+// that has been active for longer than the grace period. Callers must hold mu.
+func (m *Manager) isRetired(i int, now time.Time) bool {
+	for _, newer := range m.keys[i+1:] {
+		if newer.ActivatesAt.Add(m.gracePeriod).Before(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) sortKeys() {
+	sort.SliceStable(m.keys, func(i, j int) bool {
+		return m.keys[i].ActivatesAt.Before(m.keys[j].ActivatesAt)
+	})
+}
@@ -0,0 +1,273 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/pkg/jwt"
+	"github.com/google/uuid"
+)
+
+// Helper function to generate a signing key
+func mustGenerateKey(t *testing.T, alg jwt.Algorithm, activatesAt time.Time) *jwt.SigningKey {
+	t.Helper()
+	key, err := jwt.GenerateSigningKey(alg, activatesAt)
+	if err != nil {
+		t.Fatal("Failed to generate signing key:", err)
+	}
+	return key
+}
+
+func TestHMACTokens(t *testing.T) {
+	manager := jwt.NewManager("test-secret-key", "test-issuer")
+	userID := uuid.New()
+
+	token, err := manager.GenerateToken(userID, "customer", time.Hour)
+	if err != nil {
+		t.Fatal("Failed to generate token:", err)
+	}
+
+	claims, err := manager.ValidateToken(token)
+	if err != nil {
+		t.Fatal("Failed to validate token:", err)
+	}
+
+	if claims.UserID != userID {
+		t.Errorf("Expected user ID %v, got %v", userID, claims.UserID)
+	}
+
+	if len(manager.JWKS().Keys) != 0 {
+		t.Error("Expected no public keys in HMAC mode")
+	}
+}
+
+func TestAsymmetricTokens(t *testing.T) {
+	for _, alg := range []jwt.Algorithm{jwt.AlgorithmRS256, jwt.AlgorithmEdDSA} {
+		t.Run(string(alg), func(t *testing.T) {
+			key := mustGenerateKey(t, alg, time.Now().Add(-time.Minute))
+			manager := jwt.NewManager("", "test-issuer", jwt.WithSigningKeys(key))
+
+			token, err := manager.GenerateToken(uuid.New(), "customer", time.Hour)
+			if err != nil {
+				t.Fatal("Failed to generate token:", err)
+			}
+
+			if _, err := manager.ValidateToken(token); err != nil {
+				t.Fatal("Failed to validate token:", err)
+			}
+
+			// The public key is published in the JWKS
+			jwks := manager.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != key.ID || jwks.Keys[0].Algorithm != string(alg) {
+				t.Fatalf("Expected JWKS with key %s, got %+v", key.ID, jwks.Keys)
+			}
+
+			// A manager with a different key rejects the token
+			other := jwt.NewManager("", "test-issuer", jwt.WithSigningKeys(mustGenerateKey(t, alg, time.Now().Add(-time.Minute))))
+			if _, err := other.ValidateToken(token); err == nil {
+				t.Error("Expected token signed with an unknown key to be rejected")
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey := mustGenerateKey(t, jwt.AlgorithmEdDSA, time.Now().Add(-2*time.Hour))
+	manager := jwt.NewManager("", "test-issuer",
+		jwt.WithSigningKeys(oldKey),
+		jwt.WithGracePeriod(time.Hour),
+	)
+
+	oldToken, err := manager.GenerateToken(uuid.New(), "customer", time.Hour)
+	if err != nil {
+		t.Fatal("Failed to generate token:", err)
+	}
+
+	// Test case 1: A pending key is published but not used for signing yet
+	pendingKey, err := manager.RotateKey(jwt.AlgorithmRS256, time.Hour)
+	if err != nil {
+		t.Fatal("Failed to rotate key:", err)
+	}
+
+	if len(manager.JWKS().Keys) != 2 {
+		t.Errorf("Expected 2 published keys, got %d", len(manager.JWKS().Keys))
+	}
+
+	token, err := manager.GenerateToken(uuid.New(), "customer", time.Hour)
+	if err != nil {
+		t.Fatal("Failed to generate token:", err)
+	}
+	if _, err := jwt.NewManager("", "test-issuer", jwt.WithSigningKeys(oldKey)).ValidateToken(token); err != nil {
+		t.Error("Expected token to still be signed with the old key:", err)
+	}
+
+	// Test case 2: Once the new key is active, tokens from the old key are accepted during the grace period
+	activeKey := mustGenerateKey(t, jwt.AlgorithmRS256, time.Now().Add(-30*time.Minute))
+	if err := manager.AddSigningKey(activeKey); err != nil {
+		t.Fatal("Failed to add key:", err)
+	}
+
+	if _, err := manager.ValidateToken(oldToken); err != nil {
+		t.Error("Expected old token to be valid during the grace period:", err)
+	}
+
+	newToken, err := manager.GenerateToken(uuid.New(), "customer", time.Hour)
+	if err != nil {
+		t.Fatal("Failed to generate token:", err)
+	}
+	if _, err := jwt.NewManager("", "test-issuer", jwt.WithSigningKeys(activeKey)).ValidateToken(newToken); err != nil {
+		t.Error("Expected new token to be signed with the active key:", err)
+	}
+
+	// Test case 3: After the grace period the old key is retired and pruned
+	expiredGrace := jwt.NewManager("", "test-issuer",
+		jwt.WithSigningKeys(oldKey, activeKey, pendingKey),
+		jwt.WithGracePeriod(10*time.Minute),
+	)
+
+	if _, err := expiredGrace.ValidateToken(oldToken); err == nil {
+		t.Error("Expected token signed with a retired key to be rejected")
+	}
+
+	if err := expiredGrace.PruneKeys(); err != nil {
+		t.Fatal("Failed to prune keys:", err)
+	}
+	for _, jwk := range expiredGrace.JWKS().Keys {
+		if jwk.KeyID == oldKey.ID {
+			t.Error("Expected retired key to be removed from the JWKS")
+		}
+	}
+}
+
+func TestHMACMigrationWindow(t *testing.T) {
+	hmacToken, err := jwt.NewManager("test-secret-key", "test-issuer").GenerateToken(uuid.New(), "customer", time.Hour)
+	if err != nil {
+		t.Fatal("Failed to generate token:", err)
+	}
+
+	key := mustGenerateKey(t, jwt.AlgorithmRS256, time.Now().Add(-time.Minute))
+
+	// Test case 1: HMAC tokens are accepted during the migration window
+	manager := jwt.NewManager("test-secret-key", "test-issuer",
+		jwt.WithSigningKeys(key),
+		jwt.WithHMACAcceptedUntil(time.Now().Add(time.Hour)),
+	)
+	if _, err := manager.ValidateToken(hmacToken); err != nil {
+		t.Error("Expected HMAC token to be accepted during migration:", err)
+	}
+
+	// Test case 2: HMAC tokens are rejected after the migration window
+	manager = jwt.NewManager("test-secret-key", "test-issuer",
+		jwt.WithSigningKeys(key),
+		jwt.WithHMACAcceptedUntil(time.Now().Add(-time.Minute)),
+	)
+	if _, err := manager.ValidateToken(hmacToken); err == nil {
+		t.Error("Expected HMAC token to be rejected after migration")
+	}
+}
+
+func TestFileKeyStore(t *testing.T) {
+	store := jwt.NewFileKeyStore(t.TempDir())
+	manager := jwt.NewManager("", "test-issuer", jwt.WithKeyStore(store))
+
+	key, err := manager.RotateKey(jwt.AlgorithmEdDSA, 0)
+	if err != nil {
+		t.Fatal("Failed to rotate key:", err)
+	}
+
+	token, err := manager.GenerateToken(uuid.New(), "customer", time.Hour)
+	if err != nil {
+		t.Fatal("Failed to generate token:", err)
+	}
+
+	// Another replica sharing the store can verify the token
+	replica := jwt.NewManager("", "test-issuer", jwt.WithKeyStore(store))
+	if err := replica.LoadKeys(); err != nil {
+		t.Fatal("Failed to load keys:", err)
+	}
+
+	if _, err := replica.ValidateToken(token); err != nil {
+		t.Error("Expected replica to validate token:", err)
+	}
+
+	if jwks := replica.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != key.ID {
+		t.Errorf("Expected replica to publish key %s, got %+v", key.ID, jwks.Keys)
+	}
+
+	// A replica does not rotate while another one holds the store's lock
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rotation := jwt.RotationConfig{Algorithm: jwt.AlgorithmEdDSA, ActivationDelay: time.Hour, CheckInterval: time.Hour}
+
+	unlock, err := store.Lock()
+	if err != nil {
+		t.Fatal("Failed to lock key store:", err)
+	}
+	if _, err := store.Lock(); err != jwt.ErrKeyStoreLocked {
+		t.Errorf("Expected error %v, got %v", jwt.ErrKeyStoreLocked, err)
+	}
+
+	replica.RunKeyRotation(ctx, rotation)
+	if keys, err := store.Load(); err != nil || len(keys) != 1 {
+		t.Errorf("Expected 1 stored key while locked, got %d (err %v)", len(keys), err)
+	}
+
+	// Once the lock is released one replica rotates, and the others find its key
+	unlock()
+	replica.RunKeyRotation(ctx, rotation)
+
+	rotation.Interval = time.Hour
+	manager.RunKeyRotation(ctx, rotation)
+	if keys, err := store.Load(); err != nil || len(keys) != 2 {
+		t.Errorf("Expected 2 stored keys, got %d (err %v)", len(keys), err)
+	}
+	if len(manager.JWKS().Keys) != 2 {
+		t.Errorf("Expected the other replica to publish 2 keys, got %d", len(manager.JWKS().Keys))
+	}
+}
+
+func TestEnsureKey(t *testing.T) {
+	store := jwt.NewFileKeyStore(t.TempDir())
+	first := jwt.NewManager("", "test-issuer", jwt.WithKeyStore(store))
+	second := jwt.NewManager("", "test-issuer", jwt.WithKeyStore(store))
+
+	// Test case 1: While another replica holds the lock, a replica waits for its key
+	// instead of generating one
+	unlock, err := store.Lock()
+	if err != nil {
+		t.Fatal("Failed to lock key store:", err)
+	}
+
+	generated := make(chan *jwt.SigningKey, 1)
+	go func() {
+		key, err := second.EnsureKey(jwt.AlgorithmEdDSA)
+		if err != nil {
+			t.Error("Failed to ensure key:", err)
+		}
+		generated <- key
+	}()
+
+	key := mustGenerateKey(t, jwt.AlgorithmEdDSA, time.Now())
+	if err := store.Save(key); err != nil {
+		t.Fatal("Failed to save key:", err)
+	}
+	unlock()
+
+	if waited := <-generated; waited != nil {
+		t.Errorf("Expected no key to be generated, got %s", waited.ID)
+	}
+	if jwks := second.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != key.ID {
+		t.Errorf("Expected the replica to publish key %s, got %+v", key.ID, jwks.Keys)
+	}
+
+	// Test case 2: A key is only generated when the store has none
+	if generated, err := first.EnsureKey(jwt.AlgorithmEdDSA); err != nil || generated != nil {
+		t.Errorf("Expected the stored key to be used, got %v (err %v)", generated, err)
+	}
+
+	empty := jwt.NewManager("", "test-issuer", jwt.WithKeyStore(jwt.NewFileKeyStore(t.TempDir())))
+	if generated, err := empty.EnsureKey(jwt.AlgorithmEdDSA); err != nil || generated == nil {
+		t.Errorf("Expected a key to be generated, got %v (err %v)", generated, err)
+	}
+}
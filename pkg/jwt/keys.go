@@ -0,0 +1,165 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Algorithm identifies a JWT signing algorithm
+type Algorithm string
+
+const (
+	AlgorithmHS256 Algorithm = "HS256"
+	AlgorithmRS256 Algorithm = "RS256"
+	AlgorithmEdDSA Algorithm = "EdDSA"
+)
+
+const (
+	rsaKeyBits          = 2048
+	pemActivatesAtField = "Activates-At"
+	pemAlgorithmField   = "Algorithm"
+)
+
+// SigningKey is an asymmetric key used to sign tokens. A key can be verified
+// against as soon as it is known, but is only used for signing from ActivatesAt on.
+// This lets a new key be published to all replicas and JWKS consumers before
+// the first token is signed with it.
+type SigningKey struct {
+	ID          string
+	Algorithm   Algorithm
+	PrivateKey  crypto.Signer
+	ActivatesAt time.Time
+}
+
+// GenerateSigningKey creates a new random key for the given algorithm
+func GenerateSigningKey(alg Algorithm, activatesAt time.Time) (*SigningKey, error) {
+	var privateKey crypto.Signer
+	var err error
+
+	switch alg {
+	case AlgorithmRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key: %w", alg, err)
+	}
+
+	kid, err := newKeyID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:          kid,
+		Algorithm:   alg,
+		PrivateKey:  privateKey,
+		ActivatesAt: activatesAt,
+	}, nil
+}
+
+// PublicKey returns the public half of the key
+func (k *SigningKey) PublicKey() crypto.PublicKey {
+	return k.PrivateKey.Public()
+}
+
+// EncodePEM serializes the key as a PKCS#8 PEM block. The algorithm and
+// activation time are stored as PEM headers.
+func (k *SigningKey) EncodePEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key %s: %w", k.ID, err)
+	}
+
+	block := &pem.Block{
+		Type: "PRIVATE KEY",
+		Headers: map[string]string{
+			pemAlgorithmField:   string(k.Algorithm),
+			pemActivatesAtField: k.ActivatesAt.UTC().Format(time.RFC3339),
+		},
+		Bytes: der,
+	}
+
+	return pem.EncodeToMemory(block), nil
+}
+
+// ParseSigningKeyPEM parses a PKCS#8 or PKCS#1 PEM encoded private key.
+// Keys without an Activates-At header are considered active immediately.
+func ParseSigningKeyPEM(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM block found", kid)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: failed to parse private key: %w", kid, err)
+	}
+
+	key := &SigningKey{ID: kid}
+
+	switch privateKey := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm = AlgorithmRS256
+		key.PrivateKey = privateKey
+	case ed25519.PrivateKey:
+		key.Algorithm = AlgorithmEdDSA
+		key.PrivateKey = privateKey
+	case *ecdsa.PrivateKey:
+		return nil, fmt.Errorf("key %s: ECDSA keys are not supported", kid)
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", kid, parsed)
+	}
+
+	if alg, ok := block.Headers[pemAlgorithmField]; ok && Algorithm(alg) != key.Algorithm {
+		return nil, fmt.Errorf("key %s: algorithm header %s does not match key type", kid, alg)
+	}
+
+	if activatesAt, ok := block.Headers[pemActivatesAtField]; ok {
+		key.ActivatesAt, err = time.Parse(time.RFC3339, activatesAt)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid %s header: %w", kid, pemActivatesAtField, err)
+		}
+	}
+
+	return key, nil
+}
+
+func (k *SigningKey) signingMethod() jwt.SigningMethod {
+	switch k.Algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA
+	}
+	return nil
+}
+
+func newKeyID() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate key ID: %w", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
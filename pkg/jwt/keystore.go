@@ -0,0 +1,131 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrKeyStoreLocked is returned by KeyStore.Lock while another replica holds the lock
+var ErrKeyStoreLocked = errors.New("key store is locked by another replica")
+
+// KeyStore persists signing keys so they survive restarts and can be shared
+// between replicas
+type KeyStore interface {
+	Load() ([]*SigningKey, error)
+	Save(key *SigningKey) error
+	Delete(kid string) error
+	// Lock takes a lock shared by every replica using the store, so that one replica
+	// at a time rotates and prunes keys. It fails with ErrKeyStoreLocked while
+	// another replica holds the lock.
+	Lock() (unlock func(), err error)
+}
+
+// lockFile is created in the key directory by the replica holding the lock
+const lockFile = ".rotation.lock"
+
+// staleLockAge is how old a lock file gets before it is taken to be left behind by a
+// replica that stopped while holding it. Rotating takes a few seconds at most.
+const staleLockAge = time.Minute
+
+// FileKeyStore keeps one PEM file per key in a directory, named <kid>.pem.
+// Mounting the same directory into every replica lets them share keys.
+type FileKeyStore struct {
+	dir string
+}
+
+func NewFileKeyStore(dir string) *FileKeyStore {
+	return &FileKeyStore{dir: dir}
+}
+
+func (s *FileKeyStore) Load() ([]*SigningKey, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*SigningKey, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file %s: %w", path, err)
+		}
+
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParseSigningKeyPEM(kid, data)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (s *FileKeyStore) Save(key *SigningKey) error {
+	data, err := key.EncodePEM()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	// Write to a temporary file first so other replicas never read a partial key
+	tmp, err := os.CreateTemp(s.dir, ".key-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, key.ID+".pem"))
+}
+
+// Lock creates the lock file, which only one replica can do at a time
+func (s *FileKeyStore) Lock() (func(), error) {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	path := filepath.Join(s.dir, lockFile)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if os.IsExist(err) {
+		info, statErr := os.Stat(path)
+		if statErr != nil || time.Since(info.ModTime()) < staleLockAge {
+			return nil, ErrKeyStoreLocked
+		}
+
+		os.Remove(path)
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if os.IsExist(err) {
+			return nil, ErrKeyStoreLocked
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock key store: %w", err)
+	}
+	file.Close()
+
+	return func() { os.Remove(path) }, nil
+}
+
+func (s *FileKeyStore) Delete(kid string) error {
+	err := os.Remove(filepath.Join(s.dir, kid+".pem"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+// Package pdf writes simple single-column documents: text in the standard
+// Helvetica fonts, lines and raster images. The output only depends on what is
+// drawn, so the same document always produces the same bytes.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	_ "image/jpeg" // register the JPEG decoder for logos
+	_ "image/png"  // register the PNG decoder for logos
+	"io"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Font is one of the standard PDF fonts, which every reader has built in
+type Font string
+
+const (
+	Helvetica     Font = "Helvetica"
+	HelveticaBold Font = "Helvetica-Bold"
+)
+
+// fontResources are the resource names of the fonts in page content streams
+var fontResources = map[Font]string{
+	Helvetica:     "F1",
+	HelveticaBold: "F2",
+}
+
+// Image is a decoded raster image that can be drawn on any page of a document
+type Image struct {
+	name   string
+	width  int
+	height int
+	// data is the RGB samples, zlib compressed
+	data []byte
+}
+
+// Width and Height return the image size in pixels
+func (img *Image) Width() int  { return img.width }
+func (img *Image) Height() int { return img.height }
+
+// Page collects the drawing operations of one page. Coordinates are in points
+// with the origin at the top left corner.
+type Page struct {
+	content bytes.Buffer
+	images  []*Image
+}
+
+// Document is a PDF document made of A4 pages
+type Document struct {
+	pages  []*Page
+	images []*Image
+}
+
+func NewDocument() *Document {
+	return &Document{}
+}
+
+// AddPage appends an empty page and returns it
+func (d *Document) AddPage() *Page {
+	page := &Page{}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// LoadImage decodes a PNG or JPEG image. Transparent pixels are drawn on white.
+func (d *Document) LoadImage(data []byte) (*Image, error) {
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := decoded.Bounds()
+	var samples bytes.Buffer
+	writer, _ := zlib.NewWriterLevel(&samples, zlib.BestCompression)
+	row := make([]byte, 0, bounds.Dx()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row = row[:0]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := decoded.At(x, y).RGBA()
+			// Colors are premultiplied by alpha, so adding the missing white gives the blend
+			white := 0xffff - a
+			row = append(row, byte((r+white)>>8), byte((g+white)>>8), byte((b+white)>>8))
+		}
+		writer.Write(row)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	img := &Image{
+		name:   fmt.Sprintf("Im%d", len(d.images)+1),
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		data:   samples.Bytes(),
+	}
+	d.images = append(d.images, img)
+
+	return img, nil
+}
+
+// Text draws s with its baseline starting at x, y
+func (p *Page) Text(x, y float64, font Font, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td (%s) Tj ET\n",
+		fontResources[font], number(size), number(x), number(PageHeight-y), escape(encode(s)))
+}
+
+// TextRight draws s so that it ends at x
+func (p *Page) TextRight(x, y float64, font Font, size float64, s string) {
+	p.Text(x-TextWidth(font, size, s), y, font, size, s)
+}
+
+// Line draws a straight line of the given width
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s m %s %s l S\n",
+		number(width), number(x1), number(PageHeight-y1), number(x2), number(PageHeight-y2))
+}
+
+// Image draws img into the box with its top left corner at x, y
+func (p *Page) Image(img *Image, x, y, width, height float64) {
+	p.images = append(p.images, img)
+	fmt.Fprintf(&p.content, "q %s 0 0 %s %s %s cm /%s Do Q\n",
+		number(width), number(height), number(x), number(PageHeight-y-height), img.name)
+}
+
+// WriteTo writes the document
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var out bytes.Buffer
+	var offsets []int
+
+	// Objects are numbered in the order they are written: catalog, page tree,
+	// fonts, images, then a page and its content stream for every page
+	beginObject := func() int {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n", len(offsets))
+		return len(offsets)
+	}
+	endObject := func() {
+		out.WriteString("endobj\n")
+	}
+
+	fontObjects := 3
+	imageObjects := fontObjects + len(fontResources)
+	pageObjects := imageObjects + len(d.images)
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	beginObject()
+	out.WriteString("<< /Type /Catalog /Pages 2 0 R >>\n")
+	endObject()
+
+	beginObject()
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", pageObjects+i*2)
+	}
+	fmt.Fprintf(&out, "<< /Type /Pages /Kids [%s] /Count %d >>\n", strings.Join(kids, " "), len(d.pages))
+	endObject()
+
+	for _, font := range []Font{Helvetica, HelveticaBold} {
+		beginObject()
+		fmt.Fprintf(&out, "<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>\n", font)
+		endObject()
+	}
+
+	for _, img := range d.images {
+		beginObject()
+		fmt.Fprintf(&out, "<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>\nstream\n",
+			img.width, img.height, len(img.data))
+		out.Write(img.data)
+		out.WriteString("\nendstream\n")
+		endObject()
+	}
+
+	for _, page := range d.pages {
+		pageObject := beginObject()
+
+		var xObjects strings.Builder
+		seen := map[string]bool{}
+		for _, img := range page.images {
+			if !seen[img.name] {
+				seen[img.name] = true
+				fmt.Fprintf(&xObjects, " /%s %d 0 R", img.name, imageObjects+imageIndex(d.images, img))
+			}
+		}
+
+		fmt.Fprintf(&out, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> /XObject <<%s >> >> /Contents %d 0 R >>\n",
+			number(PageWidth), number(PageHeight), fontObjects, fontObjects+1, xObjects.String(), pageObject+1)
+		endObject()
+
+		beginObject()
+		fmt.Fprintf(&out, "<< /Length %d >>\nstream\n", page.content.Len())
+		out.Write(page.content.Bytes())
+		out.WriteString("endstream\n")
+		endObject()
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(out.Bytes())
+	return int64(n), err
+}
+
+// Bytes returns the written document
+func (d *Document) Bytes() []byte {
+	var out bytes.Buffer
+	d.WriteTo(&out)
+	return out.Bytes()
+}
+
+func imageIndex(images []*Image, img *Image) int {
+	for i, candidate := range images {
+		if candidate == img {
+			return i
+		}
+	}
+	return -1
+}
+
+// number formats a coordinate with at most two decimals
+func number(value float64) string {
+	s := fmt.Sprintf("%.2f", value)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// escape escapes the characters with a meaning in PDF string literals
+func escape(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`, "\r", `\r`, "\n", `\n`)
+	return replacer.Replace(s)
+}
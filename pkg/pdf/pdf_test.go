@@ -0,0 +1,89 @@
+package pdf_test
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/assylzhan-a/subscription-service/pkg/pdf"
+)
+
+func TestDocument(t *testing.T) {
+	var logo bytes.Buffer
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	img.Set(0, 0, color.NRGBA{R: 0xff, A: 0xff})
+	if err := png.Encode(&logo, img); err != nil {
+		t.Fatal("Failed to encode image:", err)
+	}
+
+	document := pdf.NewDocument()
+	image, err := document.LoadImage(logo.Bytes())
+	if err != nil {
+		t.Fatal("Failed to load image:", err)
+	}
+	if image.Width() != 4 || image.Height() != 2 {
+		t.Errorf("Expected 4x2 image, got %dx%d", image.Width(), image.Height())
+	}
+
+	first := document.AddPage()
+	first.Image(image, 50, 50, 40, 20)
+	first.Text(50, 100, pdf.Helvetica, 12, "Total (net) 10.00 €")
+	first.Line(50, 110, 200, 110, 1)
+	second := document.AddPage()
+	second.TextRight(500, 100, pdf.HelveticaBold, 12, `C:\path`)
+
+	output := document.Bytes()
+
+	// Test case 1: Every xref entry points at the start of its object
+	xrefStart := bytes.LastIndex(output, []byte("startxref\n"))
+	xrefOffset, err := strconv.Atoi(strings.Fields(string(output[xrefStart:]))[1])
+	if err != nil {
+		t.Fatal("Failed to read xref offset:", err)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(string(output[xrefOffset:]), -1)
+	if len(entries) != 9 {
+		t.Fatalf("Expected 9 objects, got %d", len(entries))
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(entry[1])
+		if header := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(output[offset:], []byte(header)) {
+			t.Errorf("Expected object %d at offset %d", i+1, offset)
+		}
+	}
+
+	// Test case 2: Text is escaped and encoded in WinAnsiEncoding
+	if !bytes.Contains(output, []byte("(Total \\(net\\) 10.00 \x80) Tj")) {
+		t.Error("Expected escaped text with euro sign")
+	}
+	if !bytes.Contains(output, []byte(`(C:\\path) Tj`)) {
+		t.Error("Expected escaped backslash")
+	}
+
+	// Test case 3: The image is only referenced by the page it is drawn on
+	if bytes.Count(output, []byte("/Im1 5 0 R")) != 1 {
+		t.Error("Expected the image to be a resource of the first page only")
+	}
+
+	// Test case 4: Documents are written deterministically
+	if !bytes.Equal(output, document.Bytes()) {
+		t.Error("Expected the same bytes when writing the document again")
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	// Test case 1: Widths come from the font metrics
+	if width := pdf.TextWidth(pdf.Helvetica, 10, "Ab"); width != 12.23 {
+		t.Errorf("Expected width 12.23, got %v", width)
+	}
+
+	// Test case 2: Bold glyphs are wider
+	if pdf.TextWidth(pdf.HelveticaBold, 10, "Total") <= pdf.TextWidth(pdf.Helvetica, 10, "Total") {
+		t.Error("Expected bold text to be wider")
+	}
+}
@@ -0,0 +1,275 @@
+// Package vatid validates EU VAT identification numbers offline.
+//
+// A VAT ID is a two-letter prefix followed by the national number, e.g.
+// "DE136695976". The prefix is the member state's ISO 3166-1 code, except for
+// Greece, which uses "EL". Validate checks the number's format and, for the
+// member states that publish one, its check digits. A VAT ID that passes may still
+// not be registered; only the tax authorities can tell that.
+package vatid
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownCountry  = errors.New("not an EU VAT ID prefix")
+	ErrInvalidFormat   = errors.New("invalid VAT ID format")
+	ErrInvalidChecksum = errors.New("invalid VAT ID check digits")
+)
+
+type format struct {
+	pattern *regexp.Regexp
+	// checksum is nil for member states whose check digits are not verified
+	checksum func(number string) bool
+}
+
+var formats = map[string]format{
+	"AT": {regexp.MustCompile(`^U\d{8}$`), checkAT},
+	"BE": {regexp.MustCompile(`^[01]\d{9}$`), checkBE},
+	"BG": {regexp.MustCompile(`^\d{9,10}$`), nil},
+	"CY": {regexp.MustCompile(`^\d{8}[A-Z]$`), nil},
+	"CZ": {regexp.MustCompile(`^\d{8,10}$`), nil},
+	"DE": {regexp.MustCompile(`^\d{9}$`), checkMod11And10},
+	"DK": {regexp.MustCompile(`^\d{8}$`), checkDK},
+	"EE": {regexp.MustCompile(`^10\d{7}$`), nil},
+	"EL": {regexp.MustCompile(`^\d{9}$`), checkEL},
+	"ES": {regexp.MustCompile(`^[A-Z0-9]\d{7}[A-Z0-9]$`), nil},
+	"FI": {regexp.MustCompile(`^\d{8}$`), checkFI},
+	"FR": {regexp.MustCompile(`^[0-9A-HJ-NP-Z]{2}\d{9}$`), checkFR},
+	"HR": {regexp.MustCompile(`^\d{11}$`), checkMod11And10},
+	"HU": {regexp.MustCompile(`^\d{8}$`), checkHU},
+	"IE": {regexp.MustCompile(`^(\d{7}[A-W][A-I]?|\d[A-Z+*]\d{5}[A-W])$`), nil},
+	"IT": {regexp.MustCompile(`^\d{11}$`), checkLuhn},
+	"LT": {regexp.MustCompile(`^(\d{9}|\d{12})$`), nil},
+	"LU": {regexp.MustCompile(`^\d{8}$`), checkLU},
+	"LV": {regexp.MustCompile(`^\d{11}$`), nil},
+	"MT": {regexp.MustCompile(`^\d{8}$`), nil},
+	"NL": {regexp.MustCompile(`^\d{9}B\d{2}$`), checkNL},
+	"PL": {regexp.MustCompile(`^\d{10}$`), checkPL},
+	"PT": {regexp.MustCompile(`^\d{9}$`), checkPT},
+	"RO": {regexp.MustCompile(`^[1-9]\d{1,9}$`), nil},
+	"SE": {regexp.MustCompile(`^\d{10}01$`), checkSE},
+	"SI": {regexp.MustCompile(`^[1-9]\d{7}$`), checkSI},
+	"SK": {regexp.MustCompile(`^[1-9]\d{9}$`), checkSK},
+}
+
+// Normalize returns a VAT ID in upper case without the spaces, dots and dashes
+// it is often written with
+func Normalize(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '.', '-':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(id)))
+}
+
+// Split returns the prefix and the national number of a normalized VAT ID
+func Split(id string) (prefix, number string) {
+	if len(id) < 2 {
+		return id, ""
+	}
+	return id[:2], id[2:]
+}
+
+// Country returns the ISO 3166-1 code of the member state a VAT ID prefix belongs
+// to, or "" if it is not an EU prefix
+func Country(prefix string) string {
+	if _, ok := formats[prefix]; !ok {
+		return ""
+	}
+	if prefix == "EL" {
+		return "GR"
+	}
+	return prefix
+}
+
+// IsMemberState reports whether an ISO 3166-1 country code is an EU member state
+func IsMemberState(country string) bool {
+	if country == "GR" {
+		return true
+	}
+	return country != "EL" && Country(country) != ""
+}
+
+// Validate checks the format and check digits of a normalized VAT ID
+func Validate(id string) error {
+	prefix, number := Split(id)
+	f, ok := formats[prefix]
+	if !ok {
+		return ErrUnknownCountry
+	}
+
+	if !f.pattern.MatchString(number) {
+		return ErrInvalidFormat
+	}
+
+	if f.checksum != nil && !f.checksum(number) {
+		return ErrInvalidChecksum
+	}
+
+	return nil
+}
+
+// digits returns the decimal digits of s, which must only contain digits
+func digits(s string) []int {
+	result := make([]int, len(s))
+	for i, r := range s {
+		result[i] = int(r - '0')
+	}
+	return result
+}
+
+// weightedSum returns the sum of the digits multiplied by the weights
+func weightedSum(d []int, weights ...int) int {
+	sum := 0
+	for i, weight := range weights {
+		sum += d[i] * weight
+	}
+	return sum
+}
+
+func checkAT(number string) bool {
+	d := digits(number[1:])
+	sum := 0
+	for i := 0; i < 7; i++ {
+		if i%2 == 1 {
+			product := d[i] * 2
+			sum += product/10 + product%10
+		} else {
+			sum += d[i]
+		}
+	}
+	return (10-(sum+4)%10)%10 == d[7]
+}
+
+func checkBE(number string) bool {
+	base, _ := strconv.Atoi(number[:8])
+	check, _ := strconv.Atoi(number[8:])
+	return 97-base%97 == check
+}
+
+// checkMod11And10 verifies an ISO 7064 MOD 11,10 check digit
+func checkMod11And10(number string) bool {
+	d := digits(number)
+	product := 10
+	for _, digit := range d[:len(d)-1] {
+		sum := (digit + product) % 10
+		if sum == 0 {
+			sum = 10
+		}
+		product = (2 * sum) % 11
+	}
+	return (11-product)%10 == d[len(d)-1]
+}
+
+func checkDK(number string) bool {
+	return weightedSum(digits(number), 2, 7, 6, 5, 4, 3, 2, 1)%11 == 0
+}
+
+func checkEL(number string) bool {
+	d := digits(number)
+	sum := weightedSum(d, 256, 128, 64, 32, 16, 8, 4, 2)
+	return sum%11%10 == d[8]
+}
+
+func checkFI(number string) bool {
+	d := digits(number)
+	remainder := weightedSum(d, 7, 9, 10, 5, 8, 4, 2) % 11
+	if remainder == 1 {
+		return false
+	}
+	return (11-remainder)%11 == d[7]
+}
+
+// checkFR only verifies numeric keys; alphanumeric keys have no published algorithm
+func checkFR(number string) bool {
+	key, err := strconv.Atoi(number[:2])
+	if err != nil {
+		return true
+	}
+	siren, _ := strconv.Atoi(number[2:])
+	return (12+3*(siren%97))%97 == key
+}
+
+func checkHU(number string) bool {
+	d := digits(number)
+	return (10-weightedSum(d, 9, 7, 3, 1, 9, 7, 3)%10)%10 == d[7]
+}
+
+func checkLuhn(number string) bool {
+	d := digits(number)
+	sum := 0
+	for i := len(d) - 1; i >= 0; i-- {
+		digit := d[i]
+		if (len(d)-1-i)%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
+
+func checkLU(number string) bool {
+	base, _ := strconv.Atoi(number[:6])
+	check, _ := strconv.Atoi(number[6:])
+	return base%89 == check
+}
+
+// checkNL accepts the check digit of company numbers and, for the numbers issued to
+// sole proprietors since 2020, the ISO 7064 MOD 97-10 check of the whole VAT ID
+func checkNL(number string) bool {
+	d := digits(number[:9])
+	if weightedSum(d, 9, 8, 7, 6, 5, 4, 3, 2)%11 == d[8] {
+		return true
+	}
+
+	remainder := 0
+	for _, r := range "NL" + number {
+		value := int(r - '0')
+		if r >= 'A' && r <= 'Z' {
+			value = int(r-'A') + 10
+		}
+		if value >= 10 {
+			remainder = (remainder*100 + value) % 97
+		} else {
+			remainder = (remainder*10 + value) % 97
+		}
+	}
+	return remainder == 1
+}
+
+func checkPL(number string) bool {
+	d := digits(number)
+	return weightedSum(d, 6, 5, 7, 2, 3, 4, 5, 6, 7)%11 == d[9]
+}
+
+func checkPT(number string) bool {
+	d := digits(number)
+	return (11-weightedSum(d, 9, 8, 7, 6, 5, 4, 3, 2)%11)%11%10 == d[8]
+}
+
+func checkSE(number string) bool {
+	return checkLuhn(number[:10])
+}
+
+func checkSI(number string) bool {
+	d := digits(number)
+	check := 11 - weightedSum(d, 8, 7, 6, 5, 4, 3, 2)%11
+	if check == 11 {
+		return false
+	}
+	return check%10 == d[7]
+}
+
+func checkSK(number string) bool {
+	value, _ := strconv.ParseInt(number, 10, 64)
+	return value%11 == 0
+}
@@ -0,0 +1,80 @@
+package vatid_test
+
+import (
+	"testing"
+
+	"github.com/assylzhan-a/subscription-service/pkg/vatid"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		expected error
+	}{
+		{"Austria", "ATU13585627", nil},
+		{"Belgium", "BE0403019261", nil},
+		{"Germany", "DE136695976", nil},
+		{"Denmark", "DK13585628", nil},
+		{"Greece", "EL094259216", nil},
+		{"Spain", "ESA13585625", nil},
+		{"Finland", "FI20774740", nil},
+		{"France", "FR40303265045", nil},
+		{"France with letter key", "FRK7399859412", nil},
+		{"Croatia", "HR33392005961", nil},
+		{"Hungary", "HU12892312", nil},
+		{"Ireland", "IE6388047V", nil},
+		{"Italy", "IT00743110157", nil},
+		{"Luxembourg", "LU15027442", nil},
+		{"Netherlands", "NL004495445B01", nil},
+		{"Netherlands sole proprietor", "NL000099998B57", nil},
+		{"Poland", "PL8567346215", nil},
+		{"Portugal", "PT501964843", nil},
+		{"Sweden", "SE123456789701", nil},
+		{"Slovenia", "SI50223054", nil},
+		{"Slovakia", "SK2021853504", nil},
+		{"wrong check digit", "DE136695977", vatid.ErrInvalidChecksum},
+		{"wrong Italian check digit", "IT00743110158", vatid.ErrInvalidChecksum},
+		{"too short", "DE13669597", vatid.ErrInvalidFormat},
+		{"missing Austrian U", "AT13585627", vatid.ErrInvalidFormat},
+		{"Greek country code", "GR094259216", vatid.ErrUnknownCountry},
+		{"not in the EU", "GB980780684", vatid.ErrUnknownCountry},
+		{"empty", "", vatid.ErrUnknownCountry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := vatid.Validate(tt.id); err != tt.expected {
+				t.Errorf("Expected error %v for %s, got %v", tt.expected, tt.id, err)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if id := vatid.Normalize(" de 136.695-976 "); id != "DE136695976" {
+		t.Errorf("Expected DE136695976, got %s", id)
+	}
+}
+
+func TestCountry(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		country  string
+		isMember bool
+	}{
+		{"DE", "DE", true},
+		{"EL", "GR", false},
+		{"GR", "", true},
+		{"GB", "", false},
+	}
+
+	for _, tt := range tests {
+		if country := vatid.Country(tt.prefix); country != tt.country {
+			t.Errorf("Expected country %q for prefix %s, got %q", tt.country, tt.prefix, country)
+		}
+		if isMember := vatid.IsMemberState(tt.prefix); isMember != tt.isMember {
+			t.Errorf("Expected IsMemberState(%s) to be %v", tt.prefix, tt.isMember)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package webhook_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/assylzhan-a/subscription-service/pkg/webhook"
+)
+
+func TestVerify(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"payment.succeeded"}`)
+	secret := "whsec_test"
+	now := time.Unix(1700000000, 0)
+	tolerance := 5 * time.Minute
+
+	tests := []struct {
+		name     string
+		payload  []byte
+		header   string
+		secret   string
+		expected error
+	}{
+		{"valid signature", payload, webhook.Sign(payload, secret, now), secret, nil},
+		{"within tolerance", payload, webhook.Sign(payload, secret, now.Add(-4*time.Minute)), secret, nil},
+		{"too old", payload, webhook.Sign(payload, secret, now.Add(-6*time.Minute)), secret, webhook.ErrTimestampTolerance},
+		{"too far ahead", payload, webhook.Sign(payload, secret, now.Add(6*time.Minute)), secret, webhook.ErrTimestampTolerance},
+		{"wrong secret", payload, webhook.Sign(payload, "other", now), secret, webhook.ErrNoValidSignature},
+		{"tampered payload", []byte(`{"id":"evt_2"}`), webhook.Sign(payload, secret, now), secret, webhook.ErrNoValidSignature},
+		{"no secret configured", payload, webhook.Sign(payload, "", now), "", webhook.ErrNoValidSignature},
+		{"missing timestamp", payload, "v1=abc", secret, webhook.ErrInvalidHeader},
+		{"missing signature", payload, "t=1700000000", secret, webhook.ErrInvalidHeader},
+		{"malformed header", payload, "garbage", secret, webhook.ErrInvalidHeader},
+		{"rotated secret", payload, webhook.Sign(payload, "old", now) + ",v1=" + signatureOf(payload, secret, now), secret, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := webhook.Verify(tt.payload, tt.header, tt.secret, tolerance, now)
+			if err != tt.expected {
+				t.Errorf("Expected error %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// signatureOf returns only the v1 value of a signature header
+func signatureOf(payload []byte, secret string, timestamp time.Time) string {
+	header := webhook.Sign(payload, secret, timestamp)
+	return header[len("t=1700000000,v1="):]
+}